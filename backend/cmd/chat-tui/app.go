@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"go-chat-react/pkg/client"
+)
+
+// requestTimeout bounds every request made for an action.
+const requestTimeout = 15 * time.Second
+
+// update applies the result of a request to the model. Requests run off
+// the loop, so their results wait for it as updates.
+type update func(m *model) []action
+
+type app struct {
+	client  *client.Client
+	model   *model
+	updates chan update
+}
+
+func newApp(c *client.Client, me client.Session) *app {
+	return &app{client: c, model: newModel(me), updates: make(chan update)}
+}
+
+// run shows the client on the terminal until the user quits, ctx is
+// cancelled or the server ends the session.
+func (a *app) run(ctx context.Context, in *os.File, out io.Writer) error {
+	fd := int(in.Fd())
+	restore, err := makeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("chat-tui needs a terminal: %w", err)
+	}
+	defer restore()
+	// switch to the alternate screen, leaving the shell's untouched
+	fmt.Fprint(out, "\x1b[?1049h")
+	defer fmt.Fprint(out, "\x1b[?1049l\x1b[?25h")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream := a.client.Stream(ctx, nil)
+	defer stream.Close()
+	keys := make(chan []key)
+	go readKeys(in, keys)
+	resize := make(chan os.Signal, 1)
+	notifyResize(resize)
+
+	a.dispatch(ctx, []action{reloadAction{}})
+	for {
+		a.draw(out, fd)
+		var actions []action
+		select {
+		case <-ctx.Done():
+			return nil
+		case pressed, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			for _, k := range pressed {
+				actions = append(actions, a.model.handleKey(k)...)
+			}
+		case event, ok := <-stream.Events():
+			if !ok {
+				return fmt.Errorf("disconnected: %w", stream.Err())
+			}
+			actions = a.model.applyEvent(event)
+		case u := <-a.updates:
+			actions = u(a.model)
+		case <-resize:
+		}
+		if a.dispatch(ctx, actions) {
+			return nil
+		}
+	}
+}
+
+// dispatch starts the requests of actions and reports whether the user
+// asked to quit.
+func (a *app) dispatch(ctx context.Context, actions []action) bool {
+	for _, act := range actions {
+		if _, ok := act.(quitAction); ok {
+			return true
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+			defer cancel()
+			u := a.perform(ctx, act)
+			select {
+			case a.updates <- u:
+			case <-ctx.Done():
+			}
+		}()
+	}
+	return false
+}
+
+// perform makes the request of an action. It runs off the loop, so it
+// must leave the model to the update it returns.
+func (a *app) perform(ctx context.Context, act action) update {
+	switch act := act.(type) {
+	case reloadAction:
+		groups, names, err := a.directory(ctx)
+		return func(m *model) []action {
+			if err != nil {
+				m.status = fmt.Sprintf("could not load servers: %v", err)
+				return nil
+			}
+			return m.setDirectory(groups, names)
+		}
+	case loadAction:
+		messages, err := a.client.ChannelMessages(ctx, act.channelid, historySize)
+		return func(m *model) []action {
+			if err != nil {
+				m.loadFailed(act.channelid, err)
+				return nil
+			}
+			m.setHistory(act.channelid, messages)
+			return nil
+		}
+	case sendAction:
+		posted, err := a.client.SendMessage(ctx, act.channelid, act.text, 0)
+		return func(m *model) []action {
+			switch {
+			case err != nil:
+				m.status = fmt.Sprintf("could not send: %v", err)
+			case posted.Ephemeral != nil:
+				m.status = posted.Ephemeral.Message
+			}
+			return nil
+		}
+	case editAction:
+		err := a.client.EditMessage(ctx, act.channelid, act.messageid, act.text)
+		return failed("could not edit", err)
+	case deleteAction:
+		err := a.client.DeleteMessage(ctx, act.channelid, act.messageid)
+		return failed("could not delete", err)
+	}
+	return func(m *model) []action { return nil }
+}
+
+// failed reports err on the status line, when there is one.
+func failed(what string, err error) update {
+	return func(m *model) []action {
+		if err != nil {
+			m.status = fmt.Sprintf("%s: %v", what, err)
+		}
+		return nil
+	}
+}
+
+// directory fetches the servers of the user with their channels, then the
+// direct messages.
+func (a *app) directory(ctx context.Context) ([]group, map[client.ID]string, error) {
+	me := a.model.me
+	servers, err := a.client.ServersOfUser(ctx, me.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var groups []group
+	names := map[client.ID]string{}
+	for _, server := range servers {
+		channels, err := a.client.ServerChannels(ctx, server.ServerID)
+		if err != nil {
+			return nil, nil, err
+		}
+		g := group{name: server.ServerName}
+		for _, channel := range channels {
+			g.channels = append(g.channels, channel.ChannelID)
+			names[channel.ChannelID] = "#" + channel.ChannelName
+		}
+		groups = append(groups, g)
+	}
+	dms, err := a.client.DirectMessages(ctx)
+	if err != nil && !errors.Is(err, client.ErrNotFound) {
+		return nil, nil, err
+	}
+	if len(dms) > 0 {
+		g := group{name: "Direct messages"}
+		for _, dm := range dms {
+			g.channels = append(g.channels, dm.ChannelID)
+			names[dm.ChannelID] = "@" + dmName(dm, me.UserID)
+		}
+		groups = append(groups, g)
+	}
+	return groups, names, nil
+}
+
+// dmName is the name of a conversation, or the other participants when it
+// has none.
+func dmName(dm client.DirectMessage, me client.ID) string {
+	if dm.Name != "" {
+		return dm.Name
+	}
+	var others []string
+	for _, participant := range dm.Participants {
+		if participant.UserID != me {
+			others = append(others, participant.UserName)
+		}
+	}
+	if len(others) == 0 {
+		return "yourself"
+	}
+	return strings.Join(others, ", ")
+}
+
+// draw renders the model to fill the terminal.
+func (a *app) draw(out io.Writer, fd int) {
+	width, height, err := terminalSize(fd)
+	if err != nil || width == 0 || height == 0 {
+		width, height = 80, 24
+	}
+	lines, x, y := a.model.render(width, height)
+	var b strings.Builder
+	b.WriteString("\x1b[?25l\x1b[H")
+	b.WriteString(strings.Join(lines, "\r\n"))
+	fmt.Fprintf(&b, "\x1b[%d;%dH\x1b[?25h", y+1, x+1)
+	io.WriteString(out, b.String())
+}
+
+// readKeys sends the keys pressed until the input ends.
+func readKeys(in io.Reader, keys chan<- []key) {
+	defer close(keys)
+	buf := make([]byte, 256)
+	var pending []byte
+	for {
+		n, err := in.Read(buf)
+		if err != nil {
+			return
+		}
+		var pressed []key
+		pressed, pending = decodeKeys(append(pending, buf[:n]...))
+		if len(pressed) > 0 {
+			keys <- pressed
+		}
+	}
+}
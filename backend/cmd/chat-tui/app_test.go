@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"go-chat-react/internal/server"
+	"go-chat-react/internal/storage"
+	"go-chat-react/pkg/client"
+)
+
+// newTestApp signs in as u1 against a server over the mock data, where u1
+// is in channels 1 and 2 of server 1.
+func newTestApp(t *testing.T) *app {
+	t.Helper()
+	srv := server.New(server.NewInMemoryDB(), storage.NewLocalStore(t.TempDir()))
+	ctx, cancel := context.WithCancel(context.Background())
+	go srv.Start(ctx)
+	ts := httptest.NewServer(srv.RegisterRoutes(false))
+	t.Cleanup(func() {
+		ts.Close()
+		cancel()
+	})
+	c, err := client.New(ts.URL, ts.Client())
+	if err != nil {
+		t.Fatalf("New: err: %v", err)
+	}
+	if _, err := c.Login(ctx, "u1", "1"); err != nil {
+		t.Fatalf("Login: err: %v", err)
+	}
+	me, err := c.Session(ctx)
+	if err != nil {
+		t.Fatalf("Session: err: %v", err)
+	}
+	return newApp(c, *me)
+}
+
+// apply performs actions one after the other, as the loop would, and
+// returns the actions that followed.
+func (a *app) apply(t *testing.T, actions ...action) []action {
+	t.Helper()
+	var next []action
+	for _, act := range actions {
+		next = append(next, a.perform(context.Background(), act)(a.model)...)
+	}
+	return next
+}
+
+func TestAppActions(t *testing.T) {
+	a := newTestApp(t)
+	actions := a.apply(t, reloadAction{})
+	if !slices.Equal(actions, []action{loadAction{1}}) {
+		t.Fatalf("reload: actions = %v, want channel 1 loaded", actions)
+	}
+	if len(a.model.groups) == 0 || !slices.Equal(a.model.groups[0].channels, []client.ID{1, 2}) {
+		t.Fatalf("groups = %v, want server 1 with channels 1 and 2", a.model.groups)
+	}
+	if name := a.model.channelName(1); name[0] != '#' {
+		t.Errorf("channel 1 is named %q, want a # name", name)
+	}
+	a.apply(t, actions...)
+	if h := a.model.history(1); !h.loaded || h.loading {
+		t.Fatalf("channel 1: loaded = %v, loading = %v after loading", h.loaded, h.loading)
+	}
+
+	a.apply(t, sendAction{channelid: 1, text: "from the terminal"})
+	if a.model.status != "" {
+		t.Fatalf("send: status = %q", a.model.status)
+	}
+	a.apply(t, loadAction{1})
+	messages := a.model.history(1).messages
+	sent := messages[len(messages)-1]
+	if sent.Message != "from the terminal" || sent.UserID != a.model.me.UserID {
+		t.Fatalf("latest message = %+v, want the one sent", sent)
+	}
+
+	a.apply(t, editAction{channelid: 1, messageid: sent.MessageID, text: "edited"})
+	a.apply(t, deleteAction{channelid: 1, messageid: sent.MessageID})
+	if a.model.status != "" {
+		t.Fatalf("edit and delete: status = %q", a.model.status)
+	}
+	a.apply(t, deleteAction{channelid: 1, messageid: sent.MessageID})
+	if a.model.status == "" {
+		t.Error("deleting a deleted message: no error on the status line")
+	}
+	a.apply(t, loadAction{1})
+	if slices.ContainsFunc(a.model.history(1).messages, func(m client.Message) bool { return m.MessageID == sent.MessageID }) {
+		t.Error("deleted message still in the history")
+	}
+}
+
+func TestDMName(t *testing.T) {
+	dm := client.DirectMessage{Participants: []client.User{{UserID: 1, UserName: "u1"}, {UserID: 2, UserName: "u2"}, {UserID: 3, UserName: "u3"}}}
+	if name := dmName(dm, 1); name != "u2, u3" {
+		t.Errorf("dmName = %q, want u2, u3", name)
+	}
+	dm.Name = "team"
+	if name := dmName(dm, 1); name != "team" {
+		t.Errorf("dmName = %q, want team", name)
+	}
+}
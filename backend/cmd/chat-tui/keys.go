@@ -0,0 +1,116 @@
+package main
+
+import (
+	"unicode/utf8"
+)
+
+type keyKind int
+
+const (
+	keyRune keyKind = iota
+	keyCtrl
+	keyEnter
+	keyBackspace
+	keyDelete
+	keyTab
+	keyEsc
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyPageUp
+	keyPageDown
+	// keyUnknown is a sequence the client has no use for
+	keyUnknown
+)
+
+// key is one key press. r holds the character of keyRune, and the lower
+// case letter held with Ctrl for keyCtrl. alt is set for keys pressed with
+// Alt, which terminals send prefixed with an escape.
+type key struct {
+	kind keyKind
+	r    rune
+	alt  bool
+}
+
+// escapeSequences maps the sequences terminals send after ESC for the keys
+// the client uses, in both the CSI and SS3 forms.
+var escapeSequences = map[string]keyKind{
+	"[A": keyUp, "[B": keyDown, "[C": keyRight, "[D": keyLeft,
+	"OA": keyUp, "OB": keyDown, "OC": keyRight, "OD": keyLeft,
+	"[H": keyHome, "[F": keyEnd, "OH": keyHome, "OF": keyEnd,
+	"[1~": keyHome, "[4~": keyEnd, "[7~": keyHome, "[8~": keyEnd,
+	"[3~": keyDelete, "[5~": keyPageUp, "[6~": keyPageDown,
+	"[1;3A": keyUp, "[1;3B": keyDown,
+}
+
+// decodeKeys splits terminal input into key presses. Input ending in the
+// middle of a sequence or character is returned as rest, to be completed
+// by the next read.
+func decodeKeys(data []byte) (keys []key, rest []byte) {
+	for len(data) > 0 {
+		b := data[0]
+		switch {
+		case b == 0x1b:
+			k, n, complete := decodeEscape(data)
+			if !complete {
+				return keys, data
+			}
+			if k.kind != keyUnknown {
+				keys = append(keys, k)
+			}
+			data = data[n:]
+			continue
+		case b == '\r' || b == '\n':
+			keys = append(keys, key{kind: keyEnter})
+		case b == '\t':
+			keys = append(keys, key{kind: keyTab})
+		case b == 0x7f || b == 0x08:
+			keys = append(keys, key{kind: keyBackspace})
+		case b < 0x20:
+			keys = append(keys, key{kind: keyCtrl, r: rune('a' + b - 1)})
+		default:
+			if !utf8.FullRune(data) {
+				return keys, data
+			}
+			r, n := utf8.DecodeRune(data)
+			keys = append(keys, key{kind: keyRune, r: r})
+			data = data[n:]
+			continue
+		}
+		data = data[1:]
+	}
+	return keys, nil
+}
+
+// decodeEscape reads a key starting with ESC. A lone ESC at the end of the
+// input is the Escape key itself.
+func decodeEscape(data []byte) (key, int, bool) {
+	if len(data) == 1 {
+		return key{kind: keyEsc}, 1, true
+	}
+	if data[1] != '[' && data[1] != 'O' {
+		// Alt held with another key
+		keys, _ := decodeKeys(data[1:2])
+		if len(keys) == 0 || data[1] == 0x1b {
+			return key{kind: keyEsc}, 1, true
+		}
+		k := keys[0]
+		k.alt = true
+		return k, 2, true
+	}
+	// a sequence runs until its final byte in the range @ to ~
+	for i := 2; i < len(data); i++ {
+		if data[i] >= 0x40 && data[i] <= 0x7e {
+			sequence := string(data[1 : i+1])
+			kind, ok := escapeSequences[sequence]
+			if !ok {
+				return key{kind: keyUnknown}, i + 1, true
+			}
+			return key{kind: kind, alt: sequence == "[1;3A" || sequence == "[1;3B"}, i + 1, true
+		}
+	}
+	return key{}, 0, false
+}
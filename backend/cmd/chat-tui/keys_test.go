@@ -0,0 +1,33 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDecodeKeys(t *testing.T) {
+	tests := []struct {
+		input string
+		keys  []key
+		rest  string
+	}{
+		{"hé", []key{{kind: keyRune, r: 'h'}, {kind: keyRune, r: 'é'}}, ""},
+		{"\r\x7f\t", []key{{kind: keyEnter}, {kind: keyBackspace}, {kind: keyTab}}, ""},
+		{"\x03\x0e", []key{{kind: keyCtrl, r: 'c'}, {kind: keyCtrl, r: 'n'}}, ""},
+		{"\x1b[A\x1bOB\x1b[3~\x1b[5~", []key{{kind: keyUp}, {kind: keyDown}, {kind: keyDelete}, {kind: keyPageUp}}, ""},
+		{"\x1b[1;3A", []key{{kind: keyUp, alt: true}}, ""},
+		{"\x1bx", []key{{kind: keyRune, r: 'x', alt: true}}, ""},
+		{"\x1b", []key{{kind: keyEsc}}, ""},
+		// unknown sequences are dropped
+		{"\x1b[15~a", []key{{kind: keyRune, r: 'a'}}, ""},
+		// incomplete input waits for the next read
+		{"a\x1b[5", []key{{kind: keyRune, r: 'a'}}, "\x1b[5"},
+		{"a\xc3", []key{{kind: keyRune, r: 'a'}}, "\xc3"},
+	}
+	for _, test := range tests {
+		keys, rest := decodeKeys([]byte(test.input))
+		if !slices.Equal(keys, test.keys) || string(rest) != test.rest {
+			t.Errorf("decodeKeys(%q) = %v, %q, want %v, %q", test.input, keys, rest, test.keys, test.rest)
+		}
+	}
+}
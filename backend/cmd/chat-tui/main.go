@@ -0,0 +1,109 @@
+// Command chat-tui is a chat client for the terminal. It signs in with a
+// username and password, then shows the servers and channels of the user
+// beside the history of the open one, live over the websocket.
+//
+//	chat-tui -url http://localhost:8080 -user u1
+//
+// Type and press Enter to send. Ctrl-N and Ctrl-P switch channels, with the
+// count of unread messages shown beside each; Up selects a message to edit
+// with e or delete with d; PgUp and PgDn scroll; Ctrl-C quits. The client
+// reconnects on its own when the connection drops.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"go-chat-react/pkg/client"
+)
+
+func main() {
+	baseURL := flag.String("url", envOr("CHAT_URL", "http://localhost:8080"), "base URL of the chat server")
+	username := flag.String("user", os.Getenv("CHAT_USER"), "username to sign in with, asked when empty")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	c, err := client.New(*baseURL, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	me, err := login(ctx, c, *username)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := newApp(c, *me).run(ctx, os.Stdin, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// login asks for what is missing to sign in, including a two-factor code
+// when the account has one.
+func login(ctx context.Context, c *client.Client, username string) (*client.Session, error) {
+	var err error
+	if username == "" {
+		fmt.Fprint(os.Stderr, "username: ")
+		if username, err = readLine(os.Stdin); err != nil {
+			return nil, err
+		}
+	}
+	fmt.Fprint(os.Stderr, "password: ")
+	password, err := readPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.Login(ctx, username, password)
+	if err != nil {
+		return nil, fmt.Errorf("login: %w", err)
+	}
+	if result.TwoFactorRequired {
+		fmt.Fprint(os.Stderr, "two-factor code: ")
+		code, err := readLine(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := c.CompleteTwoFactorLogin(ctx, result.Challenge, code); err != nil {
+			return nil, fmt.Errorf("login: %w", err)
+		}
+	}
+	return c.Session(ctx)
+}
+
+// readLine reads up to a newline one byte at a time, so nothing typed
+// after it is buffered away from the terminal.
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if errors.Is(err, io.EOF) && len(line) > 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimRight(string(line), "\r"), nil
+}
+
+func envOr(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
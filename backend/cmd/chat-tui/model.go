@@ -0,0 +1,466 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go-chat-react/pkg/client"
+)
+
+// historySize is how many messages are fetched when a channel is opened.
+const historySize = 100
+
+type mode int
+
+const (
+	// modeCompose types a new message
+	modeCompose mode = iota
+	// modeSelect moves through the messages to edit or delete one
+	modeSelect
+	// modeEdit types the new text of the selected message
+	modeEdit
+	// modeConfirmDelete asks before deleting the selected message
+	modeConfirmDelete
+)
+
+// group is a heading of the channel list: a server, or the direct messages.
+type group struct {
+	name     string
+	channels []client.ID
+}
+
+// history is what the client knows of a channel.
+type history struct {
+	messages []client.Message
+	loaded   bool
+	loading  bool
+	// arrived holds the messages received over the stream while loading,
+	// which the fetch may have missed
+	arrived []client.Message
+	// unread counts messages that arrived while the channel was not shown
+	unread int
+	// firstUnread is where the "new" divider goes while the channel is
+	// shown, zero when there is none
+	firstUnread client.ID
+}
+
+// actions are what key presses and events ask the app to do over the API.
+type action any
+
+type loadAction struct{ channelid client.ID }
+type sendAction struct {
+	channelid client.ID
+	text      string
+}
+type editAction struct {
+	channelid client.ID
+	messageid client.ID
+	text      string
+}
+type deleteAction struct {
+	channelid client.ID
+	messageid client.ID
+}
+type quitAction struct{}
+
+// reloadAction fetches the servers and channels again, after the user
+// joined or left some.
+type reloadAction struct{}
+
+// model is the state of the client. It only changes on the app's loop, and
+// leaves the requests it needs to the app as actions.
+type model struct {
+	me        client.Session
+	groups    []group
+	names     map[client.ID]string
+	histories map[client.ID]*history
+	current   client.ID
+
+	input  []rune
+	cursor int
+	// draft keeps the message being composed while another is edited
+	draft    []rune
+	mode     mode
+	selected client.ID
+
+	// scroll is how many lines the messages are scrolled up from the
+	// latest, and page how many lines were shown at the last render
+	scroll int
+	page   int
+
+	status    string
+	connected bool
+	// reconnected is set once a connection dropped, so the next one
+	// reloads what was missed
+	reconnected bool
+}
+
+func newModel(me client.Session) *model {
+	return &model{
+		me:        me,
+		names:     map[client.ID]string{},
+		histories: map[client.ID]*history{},
+		page:      10,
+	}
+}
+
+func (m *model) history(channelid client.ID) *history {
+	h, ok := m.histories[channelid]
+	if !ok {
+		h = &history{}
+		m.histories[channelid] = h
+	}
+	return h
+}
+
+// channels returns every channel in the order of the list.
+func (m *model) channels() []client.ID {
+	var channels []client.ID
+	for _, g := range m.groups {
+		channels = append(channels, g.channels...)
+	}
+	return channels
+}
+
+// setDirectory replaces the servers and channels, opening the first
+// channel when none is open yet.
+func (m *model) setDirectory(groups []group, names map[client.ID]string) []action {
+	m.groups = groups
+	m.names = names
+	channels := m.channels()
+	if len(channels) == 0 {
+		m.status = "you are not in any channel yet"
+		return nil
+	}
+	if m.current == 0 || !slices.Contains(channels, m.current) {
+		return m.open(channels[0])
+	}
+	return nil
+}
+
+// open shows a channel, loading its history when it is not known yet.
+func (m *model) open(channelid client.ID) []action {
+	if previous, ok := m.histories[m.current]; ok {
+		previous.firstUnread = 0
+	}
+	m.current = channelid
+	m.scroll = 0
+	m.leaveSelection()
+	h := m.history(channelid)
+	h.unread = 0
+	if h.loaded || h.loading {
+		return nil
+	}
+	return m.load(channelid)
+}
+
+// load fetches the history of a channel.
+func (m *model) load(channelid client.ID) []action {
+	h := m.history(channelid)
+	h.loading = true
+	h.arrived = nil
+	return []action{loadAction{channelid}}
+}
+
+// switchChannel moves by delta through the channel list, wrapping around.
+func (m *model) switchChannel(delta int) []action {
+	channels := m.channels()
+	if len(channels) == 0 {
+		return nil
+	}
+	i := slices.Index(channels, m.current)
+	i = ((i+delta)%len(channels) + len(channels)) % len(channels)
+	return m.open(channels[i])
+}
+
+// setHistory stores the messages fetched for a channel, keeping those that
+// arrived over the stream after it.
+func (m *model) setHistory(channelid client.ID, messages []client.Message) {
+	h := m.history(channelid)
+	h.loading = false
+	h.loaded = true
+	slices.SortFunc(messages, func(a, b client.Message) int { return cmp.Compare(a.MessageID, b.MessageID) })
+	var latest client.ID
+	if len(messages) > 0 {
+		latest = messages[len(messages)-1].MessageID
+	}
+	for _, message := range h.arrived {
+		if message.MessageID > latest {
+			messages = append(messages, message)
+		}
+	}
+	h.messages = messages
+	h.arrived = nil
+}
+
+// loadFailed lets a channel be loaded again after an error.
+func (m *model) loadFailed(channelid client.ID, err error) {
+	m.history(channelid).loading = false
+	m.status = fmt.Sprintf("could not load %s: %v", m.channelName(channelid), err)
+}
+
+func (m *model) channelName(channelid client.ID) string {
+	if name, ok := m.names[channelid]; ok {
+		return name
+	}
+	return fmt.Sprintf("#%d", channelid)
+}
+
+// addMessage records a new message from the stream.
+func (m *model) addMessage(message client.Message) {
+	if message.ThreadID != nil {
+		// thread replies are not shown in the channel
+		return
+	}
+	h := m.history(message.ChannelID)
+	if slices.ContainsFunc(h.messages, func(other client.Message) bool { return other.MessageID == message.MessageID }) {
+		return
+	}
+	if h.loaded || h.loading {
+		h.messages = append(h.messages, message)
+	}
+	if h.loading {
+		h.arrived = append(h.arrived, message)
+	}
+	if message.UserID == m.me.UserID {
+		return
+	}
+	if message.ChannelID != m.current {
+		h.unread++
+		if h.firstUnread == 0 {
+			h.firstUnread = message.MessageID
+		}
+	} else if m.scroll > 0 {
+		m.status = "new messages below, press End to jump"
+	}
+}
+
+func (m *model) updateMessage(message client.Message) {
+	h := m.history(message.ChannelID)
+	same := func(other client.Message) bool { return other.MessageID == message.MessageID }
+	if i := slices.IndexFunc(h.messages, same); i >= 0 {
+		h.messages[i] = message
+	}
+	if i := slices.IndexFunc(h.arrived, same); i >= 0 {
+		h.arrived[i] = message
+	}
+}
+
+func (m *model) removeMessage(channelid client.ID, messageid client.ID) {
+	h := m.history(channelid)
+	deleted := func(message client.Message) bool { return message.MessageID == messageid }
+	h.messages = slices.DeleteFunc(h.messages, deleted)
+	h.arrived = slices.DeleteFunc(h.arrived, deleted)
+	if m.selected == messageid {
+		m.leaveSelection()
+	}
+}
+
+// applyEvent updates the model with an event from the stream.
+func (m *model) applyEvent(event client.Event) []action {
+	switch event.Type {
+	case client.EventConnected:
+		m.connected = true
+		if !m.reconnected {
+			return nil
+		}
+		// messages may have been missed while disconnected
+		m.status = "reconnected"
+		for _, h := range m.histories {
+			h.loaded = false
+		}
+		if m.current == 0 {
+			return nil
+		}
+		return m.load(m.current)
+	case client.EventDisconnected:
+		m.connected = false
+		m.reconnected = true
+		m.status = "disconnected, reconnecting"
+	case client.EventMessage:
+		var message client.Message
+		if event.Decode(&message) == nil {
+			m.addMessage(message)
+		}
+	case client.EventMessageUpdated:
+		var message client.Message
+		if event.Decode(&message) == nil {
+			m.updateMessage(message)
+		}
+	case client.EventMessageDeleted:
+		var deleted client.MessageDeleted
+		if event.Decode(&deleted) == nil {
+			m.removeMessage(deleted.ChannelID, deleted.MessageID)
+		}
+	case client.EventMemberJoined, client.EventMemberLeft:
+		var membership client.MembershipEvent
+		if event.Decode(&membership) == nil && membership.UserID == m.me.UserID {
+			return []action{reloadAction{}}
+		}
+	case client.EventDMUpdated, client.EventDMRemoved:
+		return []action{reloadAction{}}
+	case client.EventEphemeralMessage:
+		var ephemeral client.EphemeralMessage
+		if event.Decode(&ephemeral) == nil && ephemeral.ChannelID == m.current {
+			m.status = ephemeral.Message
+		}
+	}
+	return nil
+}
+
+// handleKey applies a key press.
+func (m *model) handleKey(k key) []action {
+	switch {
+	case k.kind == keyCtrl && (k.r == 'c' || k.r == 'q'):
+		return []action{quitAction{}}
+	case k.kind == keyCtrl && k.r == 'n', k.kind == keyDown && k.alt:
+		return m.switchChannel(1)
+	case k.kind == keyCtrl && k.r == 'p', k.kind == keyUp && k.alt:
+		return m.switchChannel(-1)
+	case k.kind == keyPageUp:
+		m.scroll += max(m.page-1, 1)
+		return nil
+	case k.kind == keyPageDown:
+		m.scroll = max(m.scroll-max(m.page-1, 1), 0)
+		return nil
+	}
+	m.status = ""
+	switch m.mode {
+	case modeSelect:
+		return m.handleSelectKey(k)
+	case modeConfirmDelete:
+		if k.kind == keyRune && (k.r == 'y' || k.r == 'Y') {
+			m.mode = modeSelect
+			return []action{deleteAction{channelid: m.current, messageid: m.selected}}
+		}
+		m.mode = modeSelect
+		return nil
+	}
+	return m.handleInputKey(k)
+}
+
+func (m *model) handleSelectKey(k key) []action {
+	messages := m.history(m.current).messages
+	i := slices.IndexFunc(messages, func(message client.Message) bool { return message.MessageID == m.selected })
+	switch {
+	case k.kind == keyUp && i > 0:
+		m.selected = messages[i-1].MessageID
+	case k.kind == keyDown && i >= 0 && i < len(messages)-1:
+		m.selected = messages[i+1].MessageID
+	case k.kind == keyDown, k.kind == keyEsc:
+		m.leaveSelection()
+	case k.kind == keyRune && k.r == 'e', k.kind == keyEnter:
+		if i < 0 || messages[i].UserID != m.me.UserID {
+			m.status = "you can only edit your own messages"
+			return nil
+		}
+		m.draft = m.input
+		m.setInput(messages[i].Message)
+		m.mode = modeEdit
+	case k.kind == keyRune && k.r == 'd', k.kind == keyDelete:
+		if i < 0 || messages[i].UserID != m.me.UserID {
+			m.status = "you can only delete your own messages"
+			return nil
+		}
+		m.mode = modeConfirmDelete
+	}
+	return nil
+}
+
+func (m *model) handleInputKey(k key) []action {
+	switch k.kind {
+	case keyRune:
+		m.input = slices.Insert(m.input, m.cursor, k.r)
+		m.cursor++
+	case keyBackspace:
+		if m.cursor > 0 {
+			m.input = slices.Delete(m.input, m.cursor-1, m.cursor)
+			m.cursor--
+		}
+	case keyDelete:
+		if m.cursor < len(m.input) {
+			m.input = slices.Delete(m.input, m.cursor, m.cursor+1)
+		}
+	case keyLeft:
+		m.cursor = max(m.cursor-1, 0)
+	case keyRight:
+		m.cursor = min(m.cursor+1, len(m.input))
+	case keyHome:
+		m.cursor = 0
+	case keyEnd:
+		if m.mode == modeCompose && len(m.input) == 0 {
+			m.scroll = 0
+		}
+		m.cursor = len(m.input)
+	case keyCtrl:
+		switch k.r {
+		case 'a':
+			m.cursor = 0
+		case 'e':
+			m.cursor = len(m.input)
+		case 'u':
+			m.setInput("")
+		}
+	case keyEsc:
+		if m.mode == modeEdit {
+			m.setInput(string(m.draft))
+			m.mode = modeSelect
+		}
+	case keyUp:
+		if m.mode == modeCompose && len(m.input) == 0 {
+			m.startSelection()
+		}
+	case keyEnter:
+		return m.submit()
+	}
+	return nil
+}
+
+// submit sends the message typed, or saves the edit.
+func (m *model) submit() []action {
+	text := strings.TrimSpace(string(m.input))
+	if text == "" || m.current == 0 {
+		return nil
+	}
+	if m.mode == modeEdit {
+		edit := editAction{channelid: m.current, messageid: m.selected, text: text}
+		m.leaveSelection()
+		return []action{edit}
+	}
+	m.setInput("")
+	m.scroll = 0
+	return []action{sendAction{channelid: m.current, text: text}}
+}
+
+func (m *model) setInput(text string) {
+	m.input = []rune(text)
+	m.cursor = len(m.input)
+}
+
+// startSelection selects the latest message of the user, or the latest
+// message when they wrote none.
+func (m *model) startSelection() {
+	messages := m.history(m.current).messages
+	if len(messages) == 0 {
+		return
+	}
+	m.selected = messages[len(messages)-1].MessageID
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].UserID == m.me.UserID {
+			m.selected = messages[i].MessageID
+			break
+		}
+	}
+	m.mode = modeSelect
+}
+
+func (m *model) leaveSelection() {
+	if m.mode == modeEdit {
+		m.setInput(string(m.draft))
+	}
+	m.mode = modeCompose
+	m.selected = 0
+	m.draft = nil
+}
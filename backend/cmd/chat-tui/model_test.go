@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"go-chat-react/pkg/client"
+)
+
+func newTestModel(t *testing.T) *model {
+	t.Helper()
+	m := newModel(client.Session{UserID: 1, UserName: "u1"})
+	actions := m.setDirectory(
+		[]group{{name: "server", channels: []client.ID{1, 2}}},
+		map[client.ID]string{1: "#general", 2: "#random"},
+	)
+	if !slices.Equal(actions, []action{loadAction{1}}) {
+		t.Fatalf("setDirectory: actions = %v, want load of channel 1", actions)
+	}
+	m.setHistory(1, []client.Message{
+		{MessageID: 2, ChannelID: 1, UserID: 2, Message: "hi"},
+		{MessageID: 1, ChannelID: 1, UserID: 1, Message: "hello"},
+	})
+	return m
+}
+
+func event(t *testing.T, eventType string, payload any) client.Event {
+	t.Helper()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("Marshal: err: %v", err)
+	}
+	return client.Event{Type: eventType, Payload: data}
+}
+
+func typeText(m *model, text string) []action {
+	var actions []action
+	for _, r := range text {
+		actions = append(actions, m.handleKey(key{kind: keyRune, r: r})...)
+	}
+	return actions
+}
+
+func messageIDs(m *model, channelid client.ID) []client.ID {
+	var ids []client.ID
+	for _, message := range m.history(channelid).messages {
+		ids = append(ids, message.MessageID)
+	}
+	return ids
+}
+
+func TestModelSend(t *testing.T) {
+	m := newTestModel(t)
+	typeText(m, "hey")
+	m.handleKey(key{kind: keyLeft})
+	m.handleKey(key{kind: keyBackspace})
+	typeText(m, "Y")
+	actions := m.handleKey(key{kind: keyEnter})
+	if want := (sendAction{channelid: 1, text: "hYy"}); !slices.Equal(actions, []action{want}) {
+		t.Fatalf("Enter: actions = %v, want %v", actions, want)
+	}
+	if len(m.input) != 0 || m.cursor != 0 {
+		t.Errorf("input = %q, cursor %d after sending, want empty", string(m.input), m.cursor)
+	}
+	if actions := m.handleKey(key{kind: keyEnter}); actions != nil {
+		t.Errorf("Enter on empty input: actions = %v, want none", actions)
+	}
+}
+
+func TestModelUnread(t *testing.T) {
+	m := newTestModel(t)
+	m.applyEvent(event(t, client.EventMessage, client.Message{MessageID: 3, ChannelID: 2, UserID: 2}))
+	m.applyEvent(event(t, client.EventMessage, client.Message{MessageID: 4, ChannelID: 2, UserID: 2}))
+	// the user's own messages are never unread
+	m.applyEvent(event(t, client.EventMessage, client.Message{MessageID: 5, ChannelID: 2, UserID: 1}))
+	if h := m.history(2); h.unread != 2 || h.firstUnread != 3 {
+		t.Fatalf("channel 2: unread = %d, firstUnread = %d, want 2 and 3", h.unread, h.firstUnread)
+	}
+
+	actions := m.handleKey(key{kind: keyCtrl, r: 'n'})
+	if m.current != 2 || !slices.Equal(actions, []action{loadAction{2}}) {
+		t.Fatalf("Ctrl-N: current = %d, actions = %v, want channel 2 loaded", m.current, actions)
+	}
+	if h := m.history(2); h.unread != 0 || h.firstUnread != 3 {
+		t.Errorf("opened channel 2: unread = %d, firstUnread = %d, want 0 and the divider kept", h.unread, h.firstUnread)
+	}
+	// messages from the stream newer than the fetch are kept
+	m.applyEvent(event(t, client.EventMessage, client.Message{MessageID: 6, ChannelID: 2, UserID: 2}))
+	m.setHistory(2, []client.Message{
+		{MessageID: 5, ChannelID: 2, UserID: 1},
+		{MessageID: 4, ChannelID: 2, UserID: 2},
+		{MessageID: 3, ChannelID: 2, UserID: 2},
+	})
+	if ids := messageIDs(m, 2); !slices.Equal(ids, []client.ID{3, 4, 5, 6}) {
+		t.Errorf("channel 2 messages = %v, want [3 4 5 6]", ids)
+	}
+
+	m.handleKey(key{kind: keyCtrl, r: 'p'})
+	if m.current != 1 || m.history(2).firstUnread != 0 {
+		t.Errorf("Ctrl-P: current = %d, firstUnread of 2 = %d, want 1 and the divider gone", m.current, m.history(2).firstUnread)
+	}
+	if actions := m.handleKey(key{kind: keyCtrl, r: 'p'}); m.current != 2 || actions != nil {
+		t.Errorf("Ctrl-P wrapping: current = %d, actions = %v, want 2 without reloading", m.current, actions)
+	}
+}
+
+func TestModelEditAndDelete(t *testing.T) {
+	m := newTestModel(t)
+	typeText(m, "draft")
+	m.handleKey(key{kind: keyCtrl, r: 'u'})
+	m.handleKey(key{kind: keyUp})
+	if m.mode != modeSelect || m.selected != 1 {
+		t.Fatalf("Up: mode = %d, selected = %d, want the user's message 1 selected", m.mode, m.selected)
+	}
+	m.handleKey(key{kind: keyDown})
+	if m.selected != 2 {
+		t.Fatalf("Down: selected = %d, want 2", m.selected)
+	}
+	m.handleKey(key{kind: keyRune, r: 'e'})
+	if m.mode != modeSelect || m.status == "" {
+		t.Errorf("editing another user's message: mode = %d, status = %q, want refused", m.mode, m.status)
+	}
+
+	m.handleKey(key{kind: keyUp})
+	m.handleKey(key{kind: keyRune, r: 'e'})
+	if m.mode != modeEdit || string(m.input) != "hello" {
+		t.Fatalf("e: mode = %d, input = %q, want editing hello", m.mode, string(m.input))
+	}
+	typeText(m, "!")
+	actions := m.handleKey(key{kind: keyEnter})
+	if want := (editAction{channelid: 1, messageid: 1, text: "hello!"}); !slices.Equal(actions, []action{want}) {
+		t.Fatalf("Enter: actions = %v, want %v", actions, want)
+	}
+	if m.mode != modeCompose {
+		t.Errorf("mode after editing = %d, want compose", m.mode)
+	}
+	m.applyEvent(event(t, client.EventMessageUpdated, client.Message{MessageID: 1, ChannelID: 1, UserID: 1, Message: "hello!"}))
+	if text := m.history(1).messages[0].Message; text != "hello!" {
+		t.Errorf("message 1 = %q after message_updated, want hello!", text)
+	}
+
+	m.handleKey(key{kind: keyUp})
+	m.handleKey(key{kind: keyRune, r: 'd'})
+	if actions := m.handleKey(key{kind: keyRune, r: 'n'}); actions != nil || m.mode != modeSelect {
+		t.Errorf("declining delete: actions = %v, mode = %d, want nothing deleted", actions, m.mode)
+	}
+	m.handleKey(key{kind: keyRune, r: 'd'})
+	actions = m.handleKey(key{kind: keyRune, r: 'y'})
+	if want := (deleteAction{channelid: 1, messageid: 1}); !slices.Equal(actions, []action{want}) {
+		t.Fatalf("y: actions = %v, want %v", actions, want)
+	}
+	m.applyEvent(event(t, client.EventMessageDeleted, client.MessageDeleted{MessageID: 1, ChannelID: 1, ServerID: 1}))
+	if ids := messageIDs(m, 1); !slices.Equal(ids, []client.ID{2}) || m.mode != modeCompose {
+		t.Errorf("after message_deleted: messages = %v, mode = %d, want [2] and compose", ids, m.mode)
+	}
+}
+
+func TestModelReconnect(t *testing.T) {
+	m := newTestModel(t)
+	if actions := m.applyEvent(client.Event{Type: client.EventConnected}); actions != nil || !m.connected {
+		t.Fatalf("first connect: actions = %v, connected = %v", actions, m.connected)
+	}
+	m.applyEvent(client.Event{Type: client.EventDisconnected})
+	if m.connected {
+		t.Fatal("connected after disconnect")
+	}
+	actions := m.applyEvent(client.Event{Type: client.EventConnected})
+	if !slices.Equal(actions, []action{loadAction{1}}) {
+		t.Errorf("reconnect: actions = %v, want channel 1 reloaded", actions)
+	}
+	if m.history(2).loaded {
+		t.Error("channel 2 still loaded after reconnecting, want it fetched when opened")
+	}
+
+	actions = m.applyEvent(event(t, client.EventMemberJoined, client.MembershipEvent{ServerID: 2, ChannelID: 3, UserID: 1}))
+	if !slices.Equal(actions, []action{reloadAction{}}) {
+		t.Errorf("member_joined of the user: actions = %v, want the channels reloaded", actions)
+	}
+	if actions := m.applyEvent(event(t, client.EventMemberJoined, client.MembershipEvent{ServerID: 1, ChannelID: 1, UserID: 3})); actions != nil {
+		t.Errorf("member_joined of another user: actions = %v, want none", actions)
+	}
+}
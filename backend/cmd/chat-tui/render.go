@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"go-chat-react/pkg/client"
+)
+
+const (
+	styleReset   = "\x1b[0m"
+	styleBold    = "\x1b[1m"
+	styleDim     = "\x1b[2m"
+	styleReverse = "\x1b[7m"
+
+	// timeWidth is the column of message times, continuation lines are
+	// indented by as much
+	timeWidth = 6
+	// sidebarMinWidth is the narrowest window that still shows the channel
+	// list
+	sidebarMinWidth = 50
+)
+
+// line is a row of one pane with the style it is drawn in.
+type line struct {
+	text  string
+	style string
+}
+
+// fit cuts or pads s to width columns. Every rune is counted as one column,
+// which is off for wide characters.
+func fit(s string, width int) string {
+	n := utf8.RuneCountInString(s)
+	if n > width {
+		return string([]rune(s)[:width])
+	}
+	return s + strings.Repeat(" ", width-n)
+}
+
+func (l line) draw(width int) string {
+	if l.style == "" {
+		return fit(l.text, width)
+	}
+	return l.style + fit(l.text, width) + styleReset
+}
+
+// wrap breaks text into lines of at most width runes, at spaces when it
+// can.
+func wrap(text string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		runes := []rune(paragraph)
+		for len(runes) > width {
+			cut := width
+			for i := width; i > width/2; i-- {
+				if runes[i] == ' ' {
+					cut = i
+					break
+				}
+			}
+			lines = append(lines, string(runes[:cut]))
+			runes = runes[cut:]
+			if len(runes) > 0 && runes[0] == ' ' {
+				runes = runes[1:]
+			}
+		}
+		lines = append(lines, string(runes))
+	}
+	return lines
+}
+
+// render draws the screen as height rows of width columns and returns
+// where the cursor goes.
+func (m *model) render(width int, height int) ([]string, int, int) {
+	if width < 20 || height < 4 {
+		return []string{fit("window too small", width)}, 0, 0
+	}
+	sidebarWidth := 0
+	if width >= sidebarMinWidth {
+		sidebarWidth = min(24, width/4)
+	}
+	mainWidth := width
+	if sidebarWidth > 0 {
+		mainWidth = width - sidebarWidth - 1
+	}
+	rows := height - 2
+	sidebar := m.sidebar(rows)
+	messages := m.messageLines(mainWidth, rows)
+
+	screen := make([]string, 0, height)
+	for i := range rows {
+		row := messages[i].draw(mainWidth)
+		if sidebarWidth > 0 {
+			row = sidebar[i].draw(sidebarWidth) + styleDim + "│" + styleReset + row
+		}
+		screen = append(screen, row)
+	}
+	screen = append(screen, line{text: m.statusText(), style: styleReverse}.draw(width))
+	input, cursor := m.inputLine(width)
+	screen = append(screen, input)
+	return screen, cursor, height - 1
+}
+
+// sidebar lists the servers with their channels, scrolled to keep the
+// open channel in view.
+func (m *model) sidebar(rows int) []line {
+	var lines []line
+	current := 0
+	for _, g := range m.groups {
+		lines = append(lines, line{text: g.name, style: styleBold})
+		for _, channelid := range g.channels {
+			entry := line{text: "  " + m.channelName(channelid)}
+			if h, ok := m.histories[channelid]; ok && h.unread > 0 {
+				entry.text = fmt.Sprintf("%s (%d)", entry.text, h.unread)
+				entry.style = styleBold
+			}
+			if channelid == m.current {
+				entry.text = ">" + entry.text[1:]
+				entry.style = styleReverse
+				current = len(lines)
+			}
+			lines = append(lines, entry)
+		}
+	}
+	offset := max(current-rows+1, 0)
+	lines = lines[min(offset, len(lines)):]
+	for len(lines) < rows {
+		lines = append(lines, line{})
+	}
+	return lines[:rows]
+}
+
+// messageLines lays out the open channel, bottom aligned and scrolled by
+// m.scroll lines, keeping the selected message in view.
+func (m *model) messageLines(width int, rows int) []line {
+	m.page = rows
+	h := m.history(m.current)
+	var lines []line
+	selStart, selEnd := -1, -1
+	for _, message := range h.messages {
+		if message.MessageID == h.firstUnread {
+			lines = append(lines, line{text: "── new " + strings.Repeat("─", width), style: styleBold})
+		}
+		start := len(lines)
+		lines = append(lines, m.formatMessage(message, width)...)
+		if message.MessageID == m.selected {
+			selStart, selEnd = start, len(lines)
+			for i := start; i < len(lines); i++ {
+				lines[i].style = styleReverse
+			}
+		}
+	}
+	switch {
+	case len(h.messages) == 0 && h.loading:
+		lines = append(lines, line{text: "loading…", style: styleDim})
+	case len(h.messages) == 0 && h.loaded:
+		lines = append(lines, line{text: "no messages yet", style: styleDim})
+	}
+
+	total := len(lines)
+	if selStart >= 0 {
+		if selEnd > total-m.scroll {
+			m.scroll = total - selEnd
+		}
+		if selStart < total-rows-m.scroll {
+			m.scroll = total - rows - selStart
+		}
+	}
+	m.scroll = min(max(m.scroll, 0), max(total-rows, 0))
+	end := total - m.scroll
+	lines = lines[max(end-rows, 0):end]
+	for len(lines) < rows {
+		lines = append([]line{{}}, lines...)
+	}
+	return lines
+}
+
+// formatMessage lays out a message as its time, author and wrapped text.
+func (m *model) formatMessage(message client.Message, width int) []line {
+	stamp := strings.Repeat(" ", timeWidth)
+	if t, err := message.Time(); err == nil {
+		stamp = t.Local().Format("15:04") + " "
+	}
+	indent := strings.Repeat(" ", timeWidth)
+	text := message.Message
+	switch {
+	case message.Blocked:
+		text = "blocked message"
+	case message.Type == client.MessageTypePin:
+		return []line{{text: stamp + "* " + message.DisplayName + " pinned a message", style: styleDim}}
+	}
+	if len(message.Attachments) == 1 {
+		text += " [1 attachment]"
+	} else if len(message.Attachments) > 1 {
+		text += fmt.Sprintf(" [%d attachments]", len(message.Attachments))
+	}
+	var lines []line
+	if message.ReplyTo != nil {
+		reply := "message deleted"
+		if !message.ReplyTo.Deleted {
+			reply = strings.ReplaceAll(message.ReplyTo.Message, "\n", " ")
+		}
+		lines = append(lines, line{text: indent + "↪ " + reply, style: styleDim})
+	}
+	for i, part := range wrap(message.DisplayName+": "+text, max(width-timeWidth, 1)) {
+		prefix := indent
+		if i == 0 {
+			prefix = stamp
+		}
+		lines = append(lines, line{text: prefix + part})
+	}
+	return lines
+}
+
+func (m *model) statusText() string {
+	state := "○ reconnecting"
+	if m.connected {
+		state = "● " + m.me.UserName
+	}
+	text := state + " · " + m.channelName(m.current)
+	if m.scroll > 0 {
+		text += " · scrolled"
+	}
+	hint := m.status
+	if hint == "" {
+		switch m.mode {
+		case modeCompose:
+			hint = "Enter send · ↑ select · Ctrl-N/P channel · PgUp/PgDn scroll · Ctrl-C quit"
+		case modeSelect:
+			hint = "↑↓ move · e edit · d delete · Esc back"
+		case modeEdit:
+			hint = "Enter save · Esc cancel"
+		}
+	}
+	if m.mode == modeConfirmDelete {
+		hint = "delete this message? y/n"
+	}
+	return " " + text + "  │ " + hint
+}
+
+// inputLine draws the prompt and what is typed, scrolled sideways to keep
+// the cursor in view, and returns the column of the cursor.
+func (m *model) inputLine(width int) (string, int) {
+	prompt := "> "
+	if m.mode == modeEdit {
+		prompt = "edit> "
+	}
+	room := width - len(prompt) - 1
+	start := max(m.cursor-room, 0)
+	visible := m.input[start:min(start+room, len(m.input))]
+	return fit(prompt+string(visible), width), len(prompt) + m.cursor - start
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"go-chat-react/pkg/client"
+)
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+		want  []string
+	}{
+		{"short", 10, []string{"short"}},
+		{"one two three", 8, []string{"one two", "three"}},
+		{"abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"a\nb", 10, []string{"a", "b"}},
+	}
+	for _, test := range tests {
+		if got := wrap(test.text, test.width); !slices.Equal(got, test.want) {
+			t.Errorf("wrap(%q, %d) = %q, want %q", test.text, test.width, got, test.want)
+		}
+	}
+}
+
+// plain strips the styles from rendered rows.
+func plain(rows []string) []string {
+	replacer := strings.NewReplacer(styleReset, "", styleBold, "", styleDim, "", styleReverse, "")
+	var stripped []string
+	for _, row := range rows {
+		stripped = append(stripped, replacer.Replace(row))
+	}
+	return stripped
+}
+
+func TestRender(t *testing.T) {
+	m := newTestModel(t)
+	m.applyEvent(event(t, client.EventMessage, client.Message{MessageID: 3, ChannelID: 2, UserID: 2}))
+	typeText(m, "typing")
+
+	rows, x, y := m.render(80, 10)
+	if len(rows) != 10 {
+		t.Fatalf("render: %d rows, want 10", len(rows))
+	}
+	screen := plain(rows)
+	for i, row := range screen {
+		if n := len([]rune(row)); n != 80 {
+			t.Errorf("row %d is %d columns, want 80: %q", i, n, row)
+		}
+	}
+	if !strings.HasPrefix(screen[0], "server") || !strings.HasPrefix(screen[1], "> #general") {
+		t.Errorf("sidebar starts %q, %q, want the server and the open channel", screen[0], screen[1])
+	}
+	if !strings.HasPrefix(screen[2], "  #random (1)") {
+		t.Errorf("sidebar row %q, want the unread count of #random", screen[2])
+	}
+	if !strings.Contains(screen[7], ": hi") || !strings.Contains(screen[6], ": hello") {
+		t.Errorf("messages end %q, %q, want hello then hi at the bottom", screen[6], screen[7])
+	}
+	if !strings.Contains(screen[8], "#general") {
+		t.Errorf("status bar %q, want the channel name", screen[8])
+	}
+	if !strings.HasPrefix(screen[9], "> typing") || x != 8 || y != 9 {
+		t.Errorf("input %q with cursor at %d,%d, want the text typed with the cursor after it", screen[9], x, y)
+	}
+
+	// narrow windows drop the sidebar
+	rows, _, _ = m.render(40, 10)
+	if screen := plain(rows); strings.Contains(screen[0], "server") {
+		t.Errorf("render at 40 columns shows the sidebar: %q", screen[0])
+	}
+}
+
+func TestRenderUnreadDivider(t *testing.T) {
+	m := newTestModel(t)
+	m.handleKey(key{kind: keyCtrl, r: 'n'})
+	m.applyEvent(event(t, client.EventMessage, client.Message{MessageID: 3, ChannelID: 1, UserID: 2, Message: "new one"}))
+	m.setHistory(2, nil)
+	m.handleKey(key{kind: keyCtrl, r: 'p'})
+
+	rows, _, _ := m.render(80, 10)
+	screen := plain(rows)
+	divider := slices.IndexFunc(screen, func(row string) bool { return strings.Contains(row, "── new") })
+	if divider < 0 || !strings.Contains(screen[divider+1], "new one") {
+		t.Errorf("no divider before the unread message:\n%s", strings.Join(screen, "\n"))
+	}
+}
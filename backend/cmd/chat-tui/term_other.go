@@ -0,0 +1,24 @@
+//go:build !linux && !darwin && !freebsd
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoTerminal = errors.New("terminal control is not supported on this platform")
+
+func makeRaw(fd int) (func() error, error) {
+	return nil, errNoTerminal
+}
+
+func readPassword(fd int) (string, error) {
+	return "", errNoTerminal
+}
+
+func terminalSize(fd int) (int, int, error) {
+	return 0, 0, errNoTerminal
+}
+
+func notifyResize(ch chan<- os.Signal) {}
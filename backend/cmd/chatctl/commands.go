@@ -0,0 +1,436 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-chat-react/internal/database"
+)
+
+var commands = []command{
+	{name: "users list", help: "list every account", run: usersList},
+	{name: "users create", args: "<username> [password]", help: "create an account", run: usersCreate, needs: needsAdmin},
+	{name: "users reset-password", args: "<user> [password]", help: "set a new password and sign the user out", run: usersResetPassword, needs: needsAdmin},
+	{name: "users delete", args: "[-keep-messages] <user>", help: "delete an account and its bots now, with its messages unless kept", run: usersDelete, needs: needsAdmin},
+	{name: "servers list", help: "list every server", run: serversList},
+	{name: "servers transfer", args: "<serverid> <user>", help: "hand a server to another of its members", run: serversTransfer},
+	{name: "channels list", args: "<serverid>", help: "list the channels of a server", run: channelsList},
+	{name: "channels create", args: "<serverid> <name>", help: "add a channel to a server", run: channelsCreate, needs: needsAdmin},
+	{name: "channels rename", args: "<channelid> <name>", help: "rename a channel", run: channelsRename, needs: needsAdmin},
+	{name: "channels delete", args: "<channelid>", help: "delete a channel", run: channelsDelete, needs: needsAdmin},
+	{name: "sessions list", help: "list the users signed in", run: sessionsList},
+	{name: "sessions revoke", args: "<user>", help: "sign a user out", run: sessionsRevoke},
+	{name: "migrate status", args: "[-schema file]", help: "compare the tables and their columns with the schema", run: migrateStatus},
+	{name: "migrate init", args: "[-schema file]", help: "create the tables of an empty database", run: migrateInit, needs: createsDB},
+	{name: "backup", args: "<file>", help: "copy the database to a new file, safe while the server runs", run: backup},
+}
+
+const defaultSchema = "schema.sql"
+
+// parseID reads an id given on the command line.
+func parseID(value string) (database.Id, error) {
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid id %q", value)
+	}
+	return database.Id(id), nil
+}
+
+// resolveUser finds a user by id or username.
+func (c *ctl) resolveUser(value string) (database.User, error) {
+	userid, err := parseID(value)
+	if err != nil {
+		userid, err = c.db.GetUserIDFromUserName(value)
+		if err != nil {
+			return database.User{}, fmt.Errorf("user %q: %w", value, err)
+		}
+	}
+	user, err := c.db.GetUser(userid)
+	if err != nil {
+		return database.User{}, fmt.Errorf("user %q: %w", value, err)
+	}
+	return user, nil
+}
+
+// password returns the password argument at index i, reading a line from
+// stdin when it was left out so it stays out of the shell history.
+func (c *ctl) password(args []string, i int) (string, error) {
+	if len(args) > i {
+		return args[i], nil
+	}
+	line, err := bufio.NewReader(c.stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("no password given")
+	}
+	return password, nil
+}
+
+type userRow struct {
+	UserID      database.Id `json:"userid"`
+	UserName    string      `json:"username"`
+	DisplayName string      `json:"display_name"`
+	IsBot       bool        `json:"is_bot"`
+	BotOwner    database.Id `json:"bot_owner,omitempty"`
+}
+
+func usersList(c *ctl, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	users, err := c.db.GetUsers()
+	if err != nil {
+		return err
+	}
+	out := make([]userRow, 0, len(users))
+	var rows [][]string
+	for _, user := range users {
+		out = append(out, userRow{user.UserId, user.UserName, user.DisplayName, user.IsBot, user.BotOwnerId})
+		kind := "user"
+		if user.IsBot {
+			kind = fmt.Sprintf("bot of %d", user.BotOwnerId)
+		}
+		rows = append(rows, []string{strconv.FormatUint(uint64(user.UserId), 10), user.UserName, user.DisplayName, kind})
+	}
+	return c.out.table(out, []string{"ID", "USERNAME", "DISPLAY NAME", "KIND"}, rows)
+}
+
+func usersCreate(c *ctl, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errUsage
+	}
+	password, err := c.password(args, 1)
+	if err != nil {
+		return err
+	}
+	userid, err := c.admin.CreateUser(args[0], password)
+	if err != nil {
+		return err
+	}
+	return c.out.result(map[string]any{"userid": userid}, fmt.Sprintf("created user %s with id %d", args[0], userid))
+}
+
+func usersResetPassword(c *ctl, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errUsage
+	}
+	user, err := c.resolveUser(args[0])
+	if err != nil {
+		return err
+	}
+	password, err := c.password(args, 1)
+	if err != nil {
+		return err
+	}
+	if err := c.admin.ResetPassword(user.UserId, password); err != nil {
+		return err
+	}
+	return c.out.result(map[string]any{"userid": user.UserId}, fmt.Sprintf("reset the password of %s and signed them out", user.UserName))
+}
+
+func usersDelete(c *ctl, args []string) error {
+	flags := flag.NewFlagSet("users delete", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	keep := flags.Bool("keep-messages", false, "")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return errUsage
+	}
+	user, err := c.resolveUser(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := c.admin.DeleteAccount(context.Background(), user.UserId, !*keep); err != nil {
+		return err
+	}
+	return c.out.result(map[string]any{"userid": user.UserId}, fmt.Sprintf("deleted %s", user.UserName))
+}
+
+type serverRow struct {
+	ServerID   database.Id `json:"serverid"`
+	ServerName string      `json:"servername"`
+	OwnerID    database.Id `json:"ownerid"`
+	Members    int         `json:"members"`
+}
+
+func serversList(c *ctl, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	servers, err := c.db.GetServers()
+	if err != nil {
+		return err
+	}
+	out := make([]serverRow, 0, len(servers))
+	var rows [][]string
+	for _, server := range servers {
+		members, err := c.db.GetUsersOfServer(server.ServerId)
+		if err != nil {
+			return err
+		}
+		out = append(out, serverRow{server.ServerId, server.ServerName, server.OwnerId, len(members)})
+		rows = append(rows, []string{
+			strconv.FormatUint(uint64(server.ServerId), 10),
+			server.ServerName,
+			strconv.FormatUint(uint64(server.OwnerId), 10),
+			strconv.Itoa(len(members)),
+		})
+	}
+	return c.out.table(out, []string{"ID", "NAME", "OWNER", "MEMBERS"}, rows)
+}
+
+func serversTransfer(c *ctl, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	serverid, err := parseID(args[0])
+	if err != nil {
+		return err
+	}
+	user, err := c.resolveUser(args[1])
+	if err != nil {
+		return err
+	}
+	if err := c.db.TransferServerOwnership(serverid, user.UserId); err != nil {
+		return err
+	}
+	return c.out.result(
+		map[string]any{"serverid": serverid, "ownerid": user.UserId},
+		fmt.Sprintf("server %d is now owned by %s", serverid, user.UserName),
+	)
+}
+
+type channelRow struct {
+	ChannelID   database.Id `json:"channelid"`
+	ChannelName string      `json:"channelname"`
+	Created     time.Time   `json:"created"`
+}
+
+func channelsList(c *ctl, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	serverid, err := parseID(args[0])
+	if err != nil {
+		return err
+	}
+	if _, err := c.db.GetServer(serverid); err != nil {
+		return fmt.Errorf("server %d: %w", serverid, err)
+	}
+	channels, err := c.db.GetChannelsOfServer(serverid)
+	if err != nil {
+		return err
+	}
+	out := make([]channelRow, 0, len(channels))
+	var rows [][]string
+	for _, channel := range channels {
+		out = append(out, channelRow{channel.ChannelId, channel.ChannelName, channel.Timestamp})
+		rows = append(rows, []string{strconv.FormatUint(uint64(channel.ChannelId), 10), channel.ChannelName, formatTime(channel.Timestamp)})
+	}
+	return c.out.table(out, []string{"ID", "NAME", "CREATED"}, rows)
+}
+
+func channelsCreate(c *ctl, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	serverid, err := parseID(args[0])
+	if err != nil {
+		return err
+	}
+	channelid, err := c.admin.CreateChannel(serverid, args[1])
+	if err != nil {
+		return err
+	}
+	return c.out.result(map[string]any{"channelid": channelid}, fmt.Sprintf("created channel %s with id %d", args[1], channelid))
+}
+
+func channelsRename(c *ctl, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	channelid, err := parseID(args[0])
+	if err != nil {
+		return err
+	}
+	if err := c.admin.RenameChannel(channelid, args[1]); err != nil {
+		return err
+	}
+	return c.out.result(map[string]any{"channelid": channelid}, fmt.Sprintf("renamed channel %d to %s", channelid, args[1]))
+}
+
+func channelsDelete(c *ctl, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	channelid, err := parseID(args[0])
+	if err != nil {
+		return err
+	}
+	if err := c.admin.DeleteChannel(channelid); err != nil {
+		return err
+	}
+	return c.out.result(map[string]any{"channelid": channelid}, fmt.Sprintf("deleted channel %d", channelid))
+}
+
+type sessionRow struct {
+	UserID   database.Id `json:"userid"`
+	UserName string      `json:"username"`
+	Expires  time.Time   `json:"expires"`
+}
+
+func sessionsList(c *ctl, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	sessions, err := c.db.GetActiveSessions(time.Now())
+	if err != nil {
+		return err
+	}
+	out := make([]sessionRow, 0, len(sessions))
+	var rows [][]string
+	for _, session := range sessions {
+		out = append(out, sessionRow{session.UserId, session.UserName, session.Expires})
+		rows = append(rows, []string{strconv.FormatUint(uint64(session.UserId), 10), session.UserName, formatTime(session.Expires)})
+	}
+	return c.out.table(out, []string{"USERID", "USERNAME", "EXPIRES"}, rows)
+}
+
+func sessionsRevoke(c *ctl, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	user, err := c.resolveUser(args[0])
+	if err != nil {
+		return err
+	}
+	if err := c.db.DeleteUserSessionToken(user.UserId); err != nil {
+		return err
+	}
+	return c.out.result(map[string]any{"userid": user.UserId}, fmt.Sprintf("signed out %s", user.UserName))
+}
+
+// readSchema parses the -schema flag of the migrate commands and reads the
+// file.
+func readSchema(name string, args []string) (string, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	path := flags.String("schema", defaultSchema, "")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		return "", errUsage
+	}
+	schema, err := os.ReadFile(*path)
+	if err != nil {
+		return "", err
+	}
+	return string(schema), nil
+}
+
+type tableRow struct {
+	Name    string   `json:"name"`
+	Status  string   `json:"status"`
+	Columns []string `json:"columns,omitempty"`
+}
+
+func migrateStatus(c *ctl, args []string) error {
+	schema, err := readSchema("migrate status", args)
+	if err != nil {
+		return err
+	}
+	wanted, err := database.SchemaColumns(schema)
+	if err != nil {
+		return err
+	}
+	existing, err := c.db.GetTableColumns()
+	if err != nil {
+		return err
+	}
+	var out []tableRow
+	for _, name := range database.SchemaTables(schema) {
+		columns, ok := existing[name]
+		if !ok {
+			out = append(out, tableRow{Name: name, Status: "missing"})
+			continue
+		}
+		row := tableRow{Name: name, Status: "ok", Columns: columnChanges(wanted[name], columns)}
+		if len(row.Columns) > 0 {
+			row.Status = "differs"
+		}
+		out = append(out, row)
+	}
+	for _, name := range slices.Sorted(maps.Keys(existing)) {
+		if _, ok := wanted[name]; !ok {
+			out = append(out, tableRow{Name: name, Status: "unknown"})
+		}
+	}
+	rows := make([][]string, len(out))
+	for i, row := range out {
+		rows[i] = []string{row.Name, row.Status, strings.Join(row.Columns, ", ")}
+	}
+	return c.out.table(out, []string{"TABLE", "STATUS", "COLUMNS"}, rows)
+}
+
+// columnChanges describes how the columns of a table differ from those the
+// schema declares.
+func columnChanges(wanted []database.Column, existing []database.Column) []string {
+	var changes []string
+	for _, want := range wanted {
+		i := slices.IndexFunc(existing, func(c database.Column) bool { return c.Name == want.Name })
+		switch {
+		case i < 0:
+			changes = append(changes, "missing "+want.Name)
+		case existing[i] != want:
+			changes = append(changes, fmt.Sprintf("%s is %s, expected %s", want.Name, columnType(existing[i]), columnType(want)))
+		}
+	}
+	for _, column := range existing {
+		if !slices.ContainsFunc(wanted, func(c database.Column) bool { return c.Name == column.Name }) {
+			changes = append(changes, "unknown "+column.Name)
+		}
+	}
+	return changes
+}
+
+func columnType(column database.Column) string {
+	if column.NotNull {
+		return column.Type + " NOT NULL"
+	}
+	return column.Type
+}
+
+func migrateInit(c *ctl, args []string) error {
+	schema, err := readSchema("migrate init", args)
+	if err != nil {
+		return err
+	}
+	if err := c.db.InitSchema(schema); err != nil {
+		if errors.Is(err, database.ErrSchemaExists) {
+			return errors.New("the database already has tables, back it up and start from an empty file")
+		}
+		return err
+	}
+	tables := database.SchemaTables(schema)
+	return c.out.result(map[string]any{"tables": tables}, fmt.Sprintf("created %d tables", len(tables)))
+}
+
+func backup(c *ctl, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	if err := c.db.Backup(context.Background(), args[0]); err != nil {
+		return err
+	}
+	return c.out.result(map[string]any{"file": args[0]}, fmt.Sprintf("backed up to %s", args[0]))
+}
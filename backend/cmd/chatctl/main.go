@@ -0,0 +1,153 @@
+// Command chatctl operates a chat instance by working on its database
+// directly, for tasks the API does not offer such as resetting a password
+// or taking over a server whose owner left. It can run while the server is
+// up; server events it causes are queued for the server to deliver.
+//
+//	chatctl [-db file] [-o table|json] <command> [arguments]
+//
+// The database defaults to BLUEPRINT_DB_URL, read from .env like the
+// server does. Run chatctl without arguments for the list of commands.
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"go-chat-react/internal/database"
+	"go-chat-react/internal/server"
+	"go-chat-react/internal/storage"
+)
+
+// errUsage reports wrong arguments, after which the usage of the command is
+// printed.
+var errUsage = errors.New("invalid arguments")
+
+// command is a subcommand, named by one or two words such as "users list".
+type command struct {
+	name  string
+	args  string
+	help  string
+	run   func(c *ctl, args []string) error
+	needs requirement
+}
+
+type requirement int
+
+const (
+	needsDB requirement = iota
+	// needsAdmin commands also load the password policy and blob storage
+	needsAdmin
+	// createsDB commands may start from a database file that does not exist
+	createsDB
+)
+
+// ctl is the state shared by the commands of one run.
+type ctl struct {
+	db    *database.DBService
+	admin *server.Admin
+	out   output
+	stdin io.Reader
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("chatctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	dbPath := flags.String("db", os.Getenv("BLUEPRINT_DB_URL"), "SQLite database file")
+	format := flags.String("o", "table", "output format, table or json")
+	flags.Usage = func() { usage(stderr) }
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "table" && *format != "json" {
+		fmt.Fprintf(stderr, "chatctl: unknown output format %q\n", *format)
+		return 2
+	}
+	cmd, rest := findCommand(flags.Args())
+	if cmd == nil {
+		usage(stderr)
+		return 2
+	}
+	if *dbPath == "" {
+		fmt.Fprintln(stderr, "chatctl: no database, set -db or BLUEPRINT_DB_URL")
+		return 2
+	}
+
+	c, err := open(*dbPath, cmd.needs)
+	if err != nil {
+		fmt.Fprintf(stderr, "chatctl: %v\n", err)
+		return 1
+	}
+	defer c.db.Close()
+	c.out = output{w: stdout, json: *format == "json"}
+	c.stdin = stdin
+
+	if err := cmd.run(c, rest); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(stderr, "usage: chatctl %s %s\n", cmd.name, cmd.args)
+			return 2
+		}
+		fmt.Fprintf(stderr, "chatctl: %s: %v\n", cmd.name, err)
+		return 1
+	}
+	return 0
+}
+
+// findCommand matches the longest command name at the start of args.
+func findCommand(args []string) (*command, []string) {
+	for words := min(len(args), 2); words > 0; words-- {
+		name := strings.Join(args[:words], " ")
+		for i := range commands {
+			if commands[i].name == name {
+				return &commands[i], args[words:]
+			}
+		}
+	}
+	return nil, nil
+}
+
+func open(path string, needs requirement) (*ctl, error) {
+	// sqlite would quietly create an empty database for a mistyped path
+	if _, err := os.Stat(path); err != nil && (needs != createsDB || !errors.Is(err, os.ErrNotExist)) {
+		return nil, err
+	}
+	sqlDB, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	c := &ctl{db: database.New(sqlDB)}
+	if needs == needsAdmin {
+		blobs, err := storage.NewFromEnv()
+		if err != nil {
+			sqlDB.Close()
+			return nil, err
+		}
+		c.admin, err = server.NewAdmin(c.db, blobs)
+		if err != nil {
+			sqlDB.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: chatctl [-db file] [-o table|json] <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-40s %s\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.help)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "users are given by id or username; passwords left out are read from stdin")
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newTestDB creates a database file holding the schema and the mock data.
+func newTestDB(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "chat.db")
+	if stdout, stderr, code := chatctl(t, "", "-db", path, "migrate", "init", "-schema", "../../schema.sql"); code != 0 {
+		t.Fatalf("migrate init: exit %d: %s%s", code, stdout, stderr)
+	}
+	data, err := os.ReadFile("../../mockdata.sql")
+	if err != nil {
+		t.Fatalf("ReadFile: err: %v", err)
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Open: err: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(string(data)); err != nil {
+		t.Fatalf("Exec: err: %v", err)
+	}
+	return path
+}
+
+func chatctl(t *testing.T, stdin string, args ...string) (string, string, int) {
+	t.Helper()
+	t.Setenv("BLOB_LOCAL_PATH", t.TempDir())
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String(), stderr.String(), code
+}
+
+func TestUsers(t *testing.T) {
+	path := newTestDB(t)
+	stdout, stderr, code := chatctl(t, "", "-db", path, "users", "list")
+	if code != 0 || !strings.Contains(stdout, "USERNAME") || !strings.Contains(stdout, "u3") {
+		t.Fatalf("users list: exit %d: %s%s", code, stdout, stderr)
+	}
+
+	stdout, stderr, code = chatctl(t, "a long enough password\n", "-db", path, "-o", "json", "users", "create", "moderator")
+	if code != 0 {
+		t.Fatalf("users create: exit %d: %s", code, stderr)
+	}
+	var created struct {
+		UserID uint `json:"userid"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &created); err != nil || created.UserID == 0 {
+		t.Fatalf("users create: unexpected output %q err: %v", stdout, err)
+	}
+	if _, stderr, code := chatctl(t, "", "-db", path, "users", "create", "weak", "short"); code != 1 || !strings.Contains(stderr, "at least") {
+		t.Fatalf("users create: expected the password policy to apply, exit %d: %s", code, stderr)
+	}
+	if _, stderr, code := chatctl(t, "", "-db", path, "users", "reset-password", "moderator", "another fine password"); code != 0 {
+		t.Fatalf("users reset-password: exit %d: %s", code, stderr)
+	}
+	if _, stderr, code := chatctl(t, "", "-db", path, "users", "delete", "u3"); code != 0 {
+		t.Fatalf("users delete: exit %d: %s", code, stderr)
+	}
+	stdout, _, _ = chatctl(t, "", "-db", path, "-o", "json", "users", "list")
+	var users []userRow
+	if err := json.Unmarshal([]byte(stdout), &users); err != nil {
+		t.Fatalf("users list: unexpected output %q err: %v", stdout, err)
+	}
+	for _, user := range users {
+		if user.UserName == "u3" {
+			t.Fatalf("users delete: expected u3 gone, got %+v", users)
+		}
+	}
+	if _, stderr, code := chatctl(t, "", "-db", path, "users", "delete", "nobody"); code != 1 || !strings.Contains(stderr, "nobody") {
+		t.Fatalf("users delete: expected a missing user error, exit %d: %s", code, stderr)
+	}
+}
+
+func TestServersAndChannels(t *testing.T) {
+	path := newTestDB(t)
+	if _, stderr, code := chatctl(t, "", "-db", path, "servers", "transfer", "1", "u3"); code != 0 {
+		t.Fatalf("servers transfer: exit %d: %s", code, stderr)
+	}
+	stdout, _, _ := chatctl(t, "", "-db", path, "-o", "json", "servers", "list")
+	var servers []serverRow
+	if err := json.Unmarshal([]byte(stdout), &servers); err != nil || len(servers) != 2 || servers[0].OwnerID != 3 {
+		t.Fatalf("servers list: unexpected output %q err: %v", stdout, err)
+	}
+	if _, _, code := chatctl(t, "", "-db", path, "servers", "transfer", "1", "u2"); code != 1 {
+		t.Fatalf("servers transfer: expected a non-member to be refused, exit %d", code)
+	}
+
+	if _, stderr, code := chatctl(t, "", "-db", path, "channels", "create", "1", "announcements"); code != 0 {
+		t.Fatalf("channels create: exit %d: %s", code, stderr)
+	}
+	stdout, _, _ = chatctl(t, "", "-db", path, "channels", "list", "1")
+	if !strings.Contains(stdout, "announcements") {
+		t.Fatalf("channels list: expected the new channel in %q", stdout)
+	}
+	if _, stderr, code := chatctl(t, "", "-db", path, "channels", "delete", "1"); code != 0 {
+		t.Fatalf("channels delete: exit %d: %s", code, stderr)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	path := newTestDB(t)
+	if _, stderr, code := chatctl(t, "", "-db", path, "sessions", "revoke", "1"); code != 0 {
+		t.Fatalf("sessions revoke: exit %d: %s", code, stderr)
+	}
+	stdout, _, code := chatctl(t, "", "-db", path, "-o", "json", "sessions", "list")
+	var sessions []sessionRow
+	if err := json.Unmarshal([]byte(stdout), &sessions); code != 0 || err != nil {
+		t.Fatalf("sessions list: unexpected output %q err: %v", stdout, err)
+	}
+	for _, session := range sessions {
+		if session.UserID == 1 {
+			t.Fatalf("sessions revoke: expected u1 signed out, got %+v", sessions)
+		}
+	}
+}
+
+func TestMigrateAndBackup(t *testing.T) {
+	path := newTestDB(t)
+	stdout, stderr, code := chatctl(t, "", "-db", path, "migrate", "status", "-schema", "../../schema.sql")
+	if code != 0 || strings.Contains(stdout, "missing") || !strings.Contains(stdout, "UserTable") {
+		t.Fatalf("migrate status: exit %d: %s%s", code, stdout, stderr)
+	}
+	if strings.Contains(stdout, "differs") {
+		t.Fatalf("migrate status: expected the columns to match: %s", stdout)
+	}
+	// a database created by an older schema
+	drifted := newTestDB(t)
+	db, err := sql.Open("sqlite3", drifted)
+	if err != nil {
+		t.Fatalf("Open: err: %v", err)
+	}
+	for _, query := range []string{
+		"ALTER TABLE UserTable ADD COLUMN legacy TEXT",
+		"ALTER TABLE UserTable DROP COLUMN bannercolor",
+	} {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatalf("Exec(%q): err: %v", query, err)
+		}
+	}
+	db.Close()
+	stdout, _, code = chatctl(t, "", "-db", drifted, "-o", "json", "migrate", "status", "-schema", "../../schema.sql")
+	var status []struct {
+		Name    string   `json:"name"`
+		Status  string   `json:"status"`
+		Columns []string `json:"columns"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &status); code != 0 || err != nil {
+		t.Fatalf("migrate status: exit %d: %s err: %v", code, stdout, err)
+	}
+	for _, table := range status {
+		if table.Name == "UserTable" && (table.Status != "differs" ||
+			!slices.Equal(table.Columns, []string{"missing bannercolor", "unknown legacy"})) {
+			t.Fatalf("migrate status: unexpected UserTable %+v", table)
+		}
+	}
+	if _, stderr, code := chatctl(t, "", "-db", path, "migrate", "init", "-schema", "../../schema.sql"); code != 1 || !strings.Contains(stderr, "already has tables") {
+		t.Fatalf("migrate init: expected a refusal, exit %d: %s", code, stderr)
+	}
+
+	backupPath := filepath.Join(t.TempDir(), "copy.db")
+	if _, stderr, code := chatctl(t, "", "-db", path, "backup", backupPath); code != 0 {
+		t.Fatalf("backup: exit %d: %s", code, stderr)
+	}
+	stdout, _, code = chatctl(t, "", "-db", backupPath, "users", "list")
+	if code != 0 || !strings.Contains(stdout, "u1") {
+		t.Fatalf("users list of the backup: exit %d: %s", code, stdout)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	path := newTestDB(t)
+	for _, args := range [][]string{
+		{},
+		{"-db", path, "users"},
+		{"-db", path, "users", "frobnicate"},
+		{"-db", path, "-o", "yaml", "users", "list"},
+		{"-db", path, "servers", "transfer", "1"},
+	} {
+		if _, _, code := chatctl(t, "", args...); code != 2 {
+			t.Errorf("%v: expected exit 2, got %d", args, code)
+		}
+	}
+	missing := filepath.Join(t.TempDir(), "missing.db")
+	if _, _, code := chatctl(t, "", "-db", missing, "users", "list"); code != 1 {
+		t.Errorf("users list: expected a missing database to fail, got %d", code)
+	}
+	if _, err := os.Stat(missing); err == nil {
+		t.Errorf("users list: created %s", missing)
+	}
+}
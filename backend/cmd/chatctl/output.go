@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// output prints results either as aligned tables for people or as JSON for
+// scripts.
+type output struct {
+	w    io.Writer
+	json bool
+}
+
+// table prints rows under columns, or value as JSON.
+func (o output) table(value any, columns []string, rows [][]string) error {
+	if o.json {
+		return o.writeJSON(value)
+	}
+	tw := tabwriter.NewWriter(o.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(columns, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// result prints the outcome of an action: message for people, value as
+// JSON.
+func (o output) result(value any, message string) error {
+	if o.json {
+		return o.writeJSON(value)
+	}
+	_, err := fmt.Fprintln(o.w, message)
+	return err
+}
+
+func (o output) writeJSON(value any) error {
+	encoder := json.NewEncoder(o.w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
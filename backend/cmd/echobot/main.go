@@ -0,0 +1,126 @@
+// Command echobot is an example bot. It repeats messages that start with
+// "!echo", welcomes users added to its channels and answers two slash
+// commands:
+//
+//	/echo <text>             repeats the text
+//	/remindme <in> <text>    posts the text back after the duration
+//
+// Create a bot account and a token with the users:read, messages:read,
+// messages:write and commands:manage scopes, add the bot to a server, then
+// run it with the token in BOT_TOKEN:
+//
+//	BOT_TOKEN=... go run ./cmd/echobot -url http://localhost:8080
+//
+// Reminders are kept in memory and lost when the bot stops.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"go-chat-react/pkg/bot"
+	"go-chat-react/pkg/client"
+)
+
+// maxReminder bounds how far ahead a reminder may be set.
+const maxReminder = 7 * 24 * time.Hour
+
+func main() {
+	baseURL := flag.String("url", envOr("CHAT_URL", "http://localhost:8080"), "base URL of the chat server")
+	token := flag.String("token", os.Getenv("BOT_TOKEN"), "API token of the bot account")
+	flag.Parse()
+
+	b, err := newBot(*baseURL, *token, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	log.Println("echobot running, press Ctrl+C to stop")
+	if err := b.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("echobot stopped")
+}
+
+// newBot sets up the handlers and commands of the example bot.
+func newBot(baseURL string, token string, opts *bot.Options) (*bot.Bot, error) {
+	b, err := bot.New(baseURL, token, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	b.OnMessage(func(ctx context.Context, m *bot.Message) {
+		text, ok := strings.CutPrefix(m.Message.Message, "!echo ")
+		if !ok {
+			return
+		}
+		if err := m.Reply(ctx, text); err != nil {
+			log.Printf("echo: %v", err)
+		}
+	})
+	b.OnMemberJoin(func(ctx context.Context, m *bot.MemberJoin) {
+		if err := m.Send(ctx, fmt.Sprintf("Welcome, user %d! Try /echo or /remindme.", m.UserID)); err != nil {
+			log.Printf("welcome: %v", err)
+		}
+	})
+	b.Command(bot.Command{
+		Name:        "echo",
+		Description: "Repeat some text",
+		Options: []client.CommandOption{
+			{Name: "text", Type: client.CommandOptionText, Required: true},
+		},
+		Handler: func(ctx context.Context, c *bot.CommandContext) error {
+			return c.Reply(ctx, c.String("text"))
+		},
+	})
+	b.Command(bot.Command{
+		Name:        "remindme",
+		Description: "Post a reminder later",
+		Options: []client.CommandOption{
+			{Name: "in", Description: "when, such as 10m or 2h", Type: client.CommandOptionDuration, Required: true},
+			{Name: "text", Type: client.CommandOptionText, Required: true},
+		},
+		Handler: func(ctx context.Context, c *bot.CommandContext) error {
+			return remind(ctx, c)
+		},
+	})
+	return b, nil
+}
+
+func remind(ctx context.Context, c *bot.CommandContext) error {
+	in := c.Duration("in")
+	if in <= 0 || in > maxReminder {
+		return errors.New("reminders can be set up to a week ahead")
+	}
+	if err := c.ReplyEphemeral(ctx, fmt.Sprintf("I will remind you in %s.", in)); err != nil {
+		return err
+	}
+	text := fmt.Sprintf("Reminder for user %d: %s", c.UserID, c.String("text"))
+	channelid := c.ChannelID
+	b := c.Bot()
+	time.AfterFunc(in, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if _, err := b.Send(ctx, channelid, text, 0); err != nil {
+			log.Printf("remind: %v", err)
+		}
+	})
+	return nil
+}
+
+func envOr(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"go-chat-react/internal/server"
+	"go-chat-react/internal/storage"
+	"go-chat-react/pkg/bot"
+	"go-chat-react/pkg/client"
+)
+
+// TestCommandsRegister runs the example bot against the API and checks that
+// the server accepts its commands.
+func TestCommandsRegister(t *testing.T) {
+	db := server.NewInMemoryDB()
+	srv := server.New(db, storage.NewLocalStore(t.TempDir()))
+	ts := httptest.NewServer(srv.RegisterRoutes(false))
+	defer ts.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	u1, err := client.New(ts.URL, ts.Client())
+	if err != nil {
+		t.Fatalf("New: err: %v", err)
+	}
+	if _, err := u1.Login(ctx, "u1", "1"); err != nil {
+		t.Fatalf("Login: err: %v", err)
+	}
+	botid, err := u1.CreateBot(ctx, "echobot")
+	if err != nil {
+		t.Fatalf("CreateBot: err: %v", err)
+	}
+	created, err := u1.CreateBotAPIToken(ctx, botid, client.APITokenRequest{
+		Name:   "bot",
+		Scopes: []string{"users:read", "messages:read", "messages:write", "commands:manage"},
+	})
+	if err != nil {
+		t.Fatalf("CreateBotAPIToken: err: %v", err)
+	}
+	b, err := newBot(ts.URL, created.Token, &bot.Options{
+		HTTPClient: ts.Client(),
+		Logger:     log.New(io.Discard, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("newBot: err: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+
+	botClient, _ := client.New(ts.URL, ts.Client())
+	botClient = botClient.WithToken(created.Token)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-done:
+			t.Fatalf("Run: err: %v", err)
+		default:
+		}
+		registered, err := botClient.BotCommands(ctx)
+		if err != nil {
+			t.Fatalf("BotCommands: err: %v", err)
+		}
+		var names []string
+		for _, command := range registered.Commands {
+			names = append(names, command.Name)
+		}
+		slices.Sort(names)
+		if slices.Equal(names, []string{"echo", "remindme"}) {
+			cancel()
+			if err := <-done; err != nil {
+				t.Fatalf("Run: err: %v", err)
+			}
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("the commands of the bot were not registered")
+}
@@ -0,0 +1,256 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DeletedUserName is shown in place of the name of deleted accounts whose
+// messages were kept.
+const DeletedUserName = "Deleted User"
+
+// ScheduleAccountDeletion marks an account for deletion once deleteAfter has
+// passed, replacing any earlier request.
+func (r *DBService) ScheduleAccountDeletion(userid Id, deleteAfter time.Time, removeMessages bool) error {
+	_, err := r.conn.Exec(
+		"INSERT OR REPLACE INTO AccountDeletionTable (userid, deleteafter, removemessages) VALUES (?, ?, ?)",
+		userid,
+		deleteAfter.UTC(),
+		removeMessages,
+	)
+	if err != nil {
+		return fmt.Errorf("schedule deletion - userid: %d err: %w", userid, err)
+	}
+	return nil
+}
+
+func (r *DBService) CancelAccountDeletion(userid Id) error {
+	result, err := r.conn.Exec("DELETE FROM AccountDeletionTable WHERE userid = ?", userid)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// IsDeletionPending reports whether an account is scheduled for deletion.
+// Bots follow the account of their owner.
+func (r *DBService) IsDeletionPending(userid Id) (bool, error) {
+	var pending bool
+	err := r.conn.QueryRowContext(
+		context.Background(),
+		`SELECT EXISTS (SELECT 1 FROM AccountDeletionTable WHERE userid = ?
+			OR userid = (SELECT botowner FROM UserTable WHERE userid = ? AND isbot = 1))`,
+		userid,
+		userid,
+	).Scan(&pending)
+	return pending, err
+}
+
+// GetDueAccountDeletions returns the deletion requests whose grace period
+// ended before now.
+func (r *DBService) GetDueAccountDeletions(now time.Time) ([]AccountDeletion, error) {
+	rows, err := r.conn.Query(
+		"SELECT userid, requested, deleteafter, removemessages FROM AccountDeletionTable WHERE deleteafter <= ? ORDER BY deleteafter",
+		now.UTC(),
+	)
+	if err != nil {
+		return []AccountDeletion{}, err
+	}
+	defer rows.Close()
+	var deletions []AccountDeletion
+	for rows.Next() {
+		var deletion AccountDeletion
+		err := rows.Scan(&deletion.UserId, &deletion.Requested, &deletion.DeleteAfter, &deletion.RemoveMessages)
+		if err != nil {
+			return []AccountDeletion{}, err
+		}
+		deletions = append(deletions, deletion)
+	}
+	return deletions, nil
+}
+
+// GetMessagesOfUser returns every message written by a user, oldest first.
+func (r *DBService) GetMessagesOfUser(userid Id) ([]Message, error) {
+	return r.queryMessages(messageSelect+" WHERE m.userid = ? ORDER BY m.messageid", userid)
+}
+
+// GetNicknamesOfUser returns the nickname history of a user in every server.
+func (r *DBService) GetNicknamesOfUser(userid Id) ([]UserNicknameLogEntry, error) {
+	rows, err := r.conn.Query(
+		"SELECT userid, serverid, nickname, timestamp FROM UserNicknameLogTable WHERE userid = ? ORDER BY id",
+		userid,
+	)
+	if err != nil {
+		return []UserNicknameLogEntry{}, err
+	}
+	defer rows.Close()
+	var names []UserNicknameLogEntry
+	for rows.Next() {
+		var name UserNicknameLogEntry
+		err := rows.Scan(&name.UserId, &name.ServerId, &name.Nickname, &name.Timestamp)
+		if err != nil {
+			return []UserNicknameLogEntry{}, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// DeleteUserAccount removes a user for good. Owned servers pass to their
+// longest standing member and are deleted when there is none, owned group
+// DMs pass to the participant who joined first. Messages are either removed or kept
+// under a tombstone user named DeletedUserName. The login row is removed so
+// every session is revoked. The returned blobs are no longer referenced and
+// should be removed by the caller.
+func (r *DBService) DeleteUserAccount(userid Id, removeMessages bool) (DeletedAccount, error) {
+	var deleted DeletedAccount
+	err := r.inTx(func(tx *DBService) error {
+		user, err := tx.GetUser(userid)
+		if err != nil {
+			return err
+		}
+		deleted.AvatarKey = user.AvatarKey
+
+		servers, err := tx.ownedServers(userid)
+		if err != nil {
+			return err
+		}
+		for _, serverid := range servers {
+			attachments, err := tx.transferOrDeleteServer(serverid, userid)
+			if err != nil {
+				return err
+			}
+			deleted.Attachments = append(deleted.Attachments, attachments...)
+		}
+		_, err = tx.conn.Exec(
+			`UPDATE DirectMessageTable SET ownerid = (
+				SELECT UC.userid FROM UsersChannelTable as UC
+				WHERE UC.channelid = DirectMessageTable.channelid AND UC.userid != ?
+				ORDER BY UC.rowid LIMIT 1
+			) WHERE ownerid = ? AND isgroup = 1`,
+			userid,
+			userid,
+		)
+		if err != nil {
+			return err
+		}
+
+		if removeMessages {
+			attachments, err := tx.queryAttachments(attachmentSelect+" WHERE userid = ?", userid)
+			if err != nil {
+				return err
+			}
+			deleted.Attachments = append(deleted.Attachments, attachments...)
+			for _, query := range []string{
+				"DELETE FROM ChannelMessageTable WHERE userid = ?",
+				"DELETE FROM AttachmentTable WHERE userid = ?",
+			} {
+				if _, err := tx.conn.Exec(query, userid); err != nil {
+					return err
+				}
+			}
+		}
+
+		_, err = tx.conn.Exec(
+			"UPDATE UserTable SET username = ?, displayname = ?, avatarkey = '', bannercolor = '', bio = '', pronouns = '', email = '', emailverified = 0, isbot = 0, botowner = 0 WHERE userid = ?",
+			fmt.Sprintf("deleted-user-%d", userid),
+			DeletedUserName,
+			userid,
+		)
+		if err != nil {
+			return err
+		}
+		// the rename above is logged by a trigger, so history goes last
+		for _, query := range []string{
+			"DELETE FROM UserLoginTable WHERE userid = ?",
+			"DELETE FROM UsersServerTable WHERE userid = ?",
+			"DELETE FROM UsersChannelTable WHERE userid = ?",
+			"DELETE FROM ThreadFollowerTable WHERE userid = ?",
+			"DELETE FROM FriendTable WHERE userid = ?1 OR friendid = ?1",
+			"DELETE FROM FriendRequestTable WHERE senderid = ?1 OR receiverid = ?1",
+			"DELETE FROM BlockTable WHERE userid = ?1 OR blockedid = ?1",
+			"DELETE FROM UserNameLogTable WHERE userid = ?",
+			"DELETE FROM UserNicknameLogTable WHERE userid = ?",
+			"DELETE FROM AccountDeletionTable WHERE userid = ?",
+			"DELETE FROM AuthTokenTable WHERE userid = ?",
+			"DELETE FROM TwoFactorTable WHERE userid = ?",
+			"DELETE FROM RecoveryCodeTable WHERE userid = ?",
+			"DELETE FROM UserIdentityTable WHERE userid = ?",
+			"DELETE FROM APITokenTable WHERE userid = ?",
+			"DELETE FROM BotCommandTable WHERE userid = ?",
+			"DELETE FROM BotCallbackTable WHERE userid = ?",
+			"DELETE FROM ReminderTable WHERE userid = ?",
+		} {
+			if _, err := tx.conn.Exec(query, userid); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+func (r *DBService) ownedServers(userid Id) ([]Id, error) {
+	rows, err := r.conn.Query("SELECT serverid FROM ServerTable WHERE ownerid = ?", userid)
+	if err != nil {
+		return []Id{}, err
+	}
+	defer rows.Close()
+	var serverids []Id
+	for rows.Next() {
+		var serverid Id
+		if err := rows.Scan(&serverid); err != nil {
+			return []Id{}, err
+		}
+		serverids = append(serverids, serverid)
+	}
+	return serverids, nil
+}
+
+// transferOrDeleteServer hands a server to its longest standing member other
+// than ownerid, or deletes it with all of its channels and messages when
+// there is no one left. The attachments of a deleted server are returned.
+func (r *DBService) transferOrDeleteServer(serverid Id, ownerid Id) ([]Attachment, error) {
+	var successor Id
+	err := r.conn.QueryRowContext(
+		context.Background(),
+		"SELECT userid FROM UsersServerTable WHERE serverid = ? AND userid != ? ORDER BY timestamp LIMIT 1",
+		serverid,
+		ownerid,
+	).Scan(&successor)
+	if err == nil {
+		_, err = r.conn.Exec("UPDATE ServerTable SET ownerid = ? WHERE serverid = ?", successor, serverid)
+		return nil, err
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	channels := "SELECT channelid FROM ChannelTable WHERE serverid = ?"
+	attachments, err := r.queryAttachments(attachmentSelect+" WHERE channelid IN ("+channels+")", serverid)
+	if err != nil {
+		return nil, err
+	}
+	for _, query := range []string{
+		"DELETE FROM ChannelMessageTable WHERE channelid IN (" + channels + ")",
+		"DELETE FROM AttachmentTable WHERE channelid IN (" + channels + ")",
+		"DELETE FROM UsersChannelTable WHERE channelid IN (" + channels + ")",
+		"DELETE FROM ChannelTable WHERE serverid = ?",
+		"DELETE FROM UsersServerTable WHERE serverid = ?",
+		"DELETE FROM ServerTable WHERE serverid = ?",
+	} {
+		if _, err := r.conn.Exec(query, serverid); err != nil {
+			return nil, err
+		}
+	}
+	return attachments, nil
+}
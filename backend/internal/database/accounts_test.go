@@ -0,0 +1,133 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_AccountDeletionSchedule(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	now := time.Now()
+	if err := db.ScheduleAccountDeletion(1, now.Add(-time.Minute), true); err != nil {
+		t.Fatalf("ScheduleAccountDeletion: err: %v", err)
+	}
+	if err := db.ScheduleAccountDeletion(2, now.Add(time.Hour), false); err != nil {
+		t.Fatalf("ScheduleAccountDeletion: err: %v", err)
+	}
+	due, err := db.GetDueAccountDeletions(now)
+	if err != nil {
+		t.Fatalf("GetDueAccountDeletions: err: %v", err)
+	}
+	if len(due) != 1 || due[0].UserId != 1 || !due[0].RemoveMessages {
+		t.Fatalf("GetDueAccountDeletions: unexpected %+v", due)
+	}
+	if err := db.CancelAccountDeletion(1); err != nil {
+		t.Fatalf("CancelAccountDeletion: err: %v", err)
+	}
+	if err := db.CancelAccountDeletion(1); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("CancelAccountDeletion: expected ErrRecordNotFound got %v", err)
+	}
+}
+
+func Test_IsDeletionPending(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	botid, err := db.CreateBotUser(1, "helper")
+	if err != nil {
+		t.Fatalf("CreateBotUser: err: %v", err)
+	}
+	if err := db.ScheduleAccountDeletion(1, time.Now().Add(time.Hour), false); err != nil {
+		t.Fatalf("ScheduleAccountDeletion: err: %v", err)
+	}
+	for userid, expected := range map[Id]bool{1: true, botid: true, 2: false} {
+		pending, err := db.IsDeletionPending(userid)
+		if err != nil || pending != expected {
+			t.Fatalf("IsDeletionPending(%d): expected %v got %v, err: %v", userid, expected, pending, err)
+		}
+	}
+}
+
+func Test_DeleteUserAccount_Anonymize(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	if _, err := db.DeleteUserAccount(1, false); err != nil {
+		t.Fatalf("DeleteUserAccount: err: %v", err)
+	}
+	user, err := db.GetUser(1)
+	if err != nil {
+		t.Fatalf("GetUser: err: %v", err)
+	}
+	if user.UserName != "deleted-user-1" || user.EffectiveName() != DeletedUserName {
+		t.Fatalf("GetUser: expected tombstone got %+v", user)
+	}
+	message, err := db.GetMessage(1)
+	if err != nil {
+		t.Fatalf("GetMessage: expected message to be kept, err: %v", err)
+	}
+	if message.AuthorName != DeletedUserName {
+		t.Fatalf("GetMessage: expected tombstone author got %q", message.AuthorName)
+	}
+	server, err := db.GetServer(1)
+	if err != nil || server.OwnerId != 3 {
+		t.Fatalf("GetServer: expected ownership to pass to 3 got %+v err: %v", server, err)
+	}
+	if _, err := db.GetUserLoginInfo(1); err == nil {
+		t.Fatalf("GetUserLoginInfo: expected login to be removed")
+	}
+	servers, err := db.GetServersOfUser(1)
+	if err != nil || len(servers) != 0 {
+		t.Fatalf("GetServersOfUser: expected no memberships got %+v", servers)
+	}
+	names, err := db.GetRecentUsernames(1, 10)
+	if err != nil || len(names) != 0 {
+		t.Fatalf("GetRecentUsernames: expected history to be removed got %+v", names)
+	}
+}
+
+func Test_DeleteUserAccount_RemoveMessages(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	serverid, err := db.CreateServer(3, "solo")
+	if err != nil {
+		t.Fatalf("CreateServer: err: %v", err)
+	}
+	if err := db.AddUserToServer(3, serverid, ""); err != nil {
+		t.Fatalf("AddUserToServer: err: %v", err)
+	}
+	channelid, err := db.AddChannel(serverid, "general")
+	if err != nil {
+		t.Fatalf("AddChannel: err: %v", err)
+	}
+	if err := db.AddUserToChannel(3, channelid); err != nil {
+		t.Fatalf("AddUserToChannel: err: %v", err)
+	}
+	attachmentid, err := db.CreateAttachment(Attachment{
+		ChannelId:   channelid,
+		UserId:      3,
+		FileName:    "a.txt",
+		ContentType: "text/plain",
+		StorageKey:  "attachments/a",
+	})
+	if err != nil {
+		t.Fatalf("CreateAttachment: err: %v", err)
+	}
+	deleted, err := db.DeleteUserAccount(3, true)
+	if err != nil {
+		t.Fatalf("DeleteUserAccount: err: %v", err)
+	}
+	if len(deleted.Attachments) == 0 || deleted.Attachments[0].AttachmentId != attachmentid {
+		t.Fatalf("DeleteUserAccount: expected attachment blobs to be returned got %+v", deleted)
+	}
+	if _, err := db.GetServer(serverid); err == nil {
+		t.Fatalf("GetServer: expected server without members to be deleted")
+	}
+	if _, err := db.GetMessage(4); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("GetMessage: expected message to be removed got %v", err)
+	}
+	messages, err := db.GetMessagesOfUser(3)
+	if err != nil || len(messages) != 0 {
+		t.Fatalf("GetMessagesOfUser: expected no messages got %d err: %v", len(messages), err)
+	}
+}
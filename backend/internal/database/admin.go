@@ -0,0 +1,199 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// ErrSchemaExists is returned by InitSchema when the database already has
+// tables, which the schema script would drop.
+var ErrSchemaExists = errors.New("schema already exists")
+
+// GetUsers returns every account, bots included, ordered by id.
+func (r *DBService) GetUsers() ([]User, error) {
+	rows, err := r.conn.Query("SELECT " + userColumns + " FROM UserTable as U ORDER BY U.userid")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var users []User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// GetServers returns every server ordered by id.
+func (r *DBService) GetServers() ([]Server, error) {
+	rows, err := r.conn.Query("SELECT serverid, ownerid, servername, uploadquota FROM ServerTable ORDER BY serverid")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var servers []Server
+	for rows.Next() {
+		var server Server
+		if err := rows.Scan(&server.ServerId, &server.OwnerId, &server.ServerName, &server.UploadQuota); err != nil {
+			return nil, err
+		}
+		servers = append(servers, server)
+	}
+	return servers, rows.Err()
+}
+
+// TransferServerOwnership makes ownerid the owner of a server. The new
+// owner must already be a member of it.
+func (r *DBService) TransferServerOwnership(serverid Id, ownerid Id) error {
+	if _, err := r.GetServer(serverid); err != nil {
+		return err
+	}
+	member, err := r.IsUserInServer(ownerid, serverid)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return fmt.Errorf("user %d is not a member of server %d: %w", ownerid, serverid, ErrRecordNotFound)
+	}
+	_, err = r.conn.Exec("UPDATE ServerTable SET ownerid = ? WHERE serverid = ?", ownerid, serverid)
+	return err
+}
+
+// GetActiveSessions returns the users whose session token is still valid at
+// now, soonest to expire first.
+func (r *DBService) GetActiveSessions(now time.Time) ([]UserSession, error) {
+	rows, err := r.conn.Query(
+		`SELECT L.userid, U.username, L.token_expire_time FROM UserLoginTable as L
+		JOIN UserTable as U ON U.userid = L.userid
+		WHERE L.token != ''`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var sessions []UserSession
+	for rows.Next() {
+		var session UserSession
+		if err := rows.Scan(&session.UserId, &session.UserName, &session.Expires); err != nil {
+			return nil, err
+		}
+		// expiry times are stored in more than one format, so compare them
+		// here rather than in SQL
+		if session.Expires.After(now) {
+			sessions = append(sessions, session)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(sessions, func(a, b UserSession) int {
+		return a.Expires.Compare(b.Expires)
+	})
+	return sessions, nil
+}
+
+// GetTableNames returns the names of the tables in the database, sorted.
+func (r *DBService) GetTableNames() ([]string, error) {
+	rows, err := r.conn.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// Column describes a column of a table as SQLite reports it.
+type Column struct {
+	Name    string
+	Type    string
+	NotNull bool
+}
+
+// GetTableColumns returns the columns of every table in the database, in
+// the order they are declared.
+func (r *DBService) GetTableColumns() (map[string][]Column, error) {
+	rows, err := r.conn.Query(
+		`SELECT m.name, p.name, p.type, p."notnull" FROM sqlite_master m JOIN pragma_table_info(m.name) p
+		WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%' ORDER BY m.name, p.cid`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := make(map[string][]Column)
+	for rows.Next() {
+		var table string
+		var column Column
+		if err := rows.Scan(&table, &column.Name, &column.Type, &column.NotNull); err != nil {
+			return nil, err
+		}
+		columns[table] = append(columns[table], column)
+	}
+	return columns, rows.Err()
+}
+
+// SchemaColumns returns the columns of the tables a schema script creates,
+// found by running it on a scratch in-memory database.
+func SchemaColumns(schema string) (map[string][]Column, error) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	// every connection to :memory: is a database of its own
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		return nil, fmt.Errorf("run schema: %w", err)
+	}
+	return New(db).GetTableColumns()
+}
+
+var createTablePattern = regexp.MustCompile(`(?i)CREATE TABLE(?: IF NOT EXISTS)?\s+"?(\w+)"?`)
+
+// SchemaTables returns the names of the tables a schema script creates, in
+// the order it creates them.
+func SchemaTables(schema string) []string {
+	var names []string
+	for _, match := range createTablePattern.FindAllStringSubmatch(schema, -1) {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// InitSchema runs a schema script on an empty database. The script drops
+// the tables it creates, so a database that already has tables is refused
+// with ErrSchemaExists rather than wiped.
+func (r *DBService) InitSchema(schema string) error {
+	tables, err := r.GetTableNames()
+	if err != nil {
+		return err
+	}
+	if len(tables) > 0 {
+		return ErrSchemaExists
+	}
+	_, err = r.conn.Exec(schema)
+	return err
+}
+
+// Backup writes a consistent copy of the database to path, which must not
+// exist yet. It is safe to run while the server is using the database.
+func (r *DBService) Backup(ctx context.Context, path string) error {
+	_, err := r.conn.ExecContext(ctx, "VACUUM INTO ?", path)
+	return err
+}
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func Test_GetUsersAndServers(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	users, err := db.GetUsers()
+	if err != nil || len(users) != 3 || users[0].UserName != "u1" {
+		t.Fatalf("GetUsers: unexpected users %+v err: %v", users, err)
+	}
+	servers, err := db.GetServers()
+	if err != nil || len(servers) != 2 || servers[0].OwnerId != 1 {
+		t.Fatalf("GetServers: unexpected servers %+v err: %v", servers, err)
+	}
+}
+
+func Test_TransferServerOwnership(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	if err := db.TransferServerOwnership(1, 3); err != nil {
+		t.Fatalf("TransferServerOwnership: err: %v", err)
+	}
+	if server, _ := db.GetServer(1); server.OwnerId != 3 {
+		t.Fatalf("GetServer: expected owner 3 got %d", server.OwnerId)
+	}
+	if err := db.TransferServerOwnership(1, 2); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("TransferServerOwnership: expected ErrRecordNotFound for a non-member got %v", err)
+	}
+	if err := db.TransferServerOwnership(99, 1); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("TransferServerOwnership: expected ErrRecordNotFound got %v", err)
+	}
+}
+
+func Test_GetActiveSessions(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	if _, _, err := db.UpdateUserSessionToken(2); err != nil {
+		t.Fatalf("UpdateUserSessionToken: err: %v", err)
+	}
+	sessions, err := db.GetActiveSessions(time.Now())
+	if err != nil {
+		t.Fatalf("GetActiveSessions: err: %v", err)
+	}
+	if !slices.ContainsFunc(sessions, func(s UserSession) bool { return s.UserId == 2 && s.UserName == "u2" }) {
+		t.Fatalf("GetActiveSessions: expected the session of u2 got %+v", sessions)
+	}
+	if err := db.DeleteUserSessionToken(2); err != nil {
+		t.Fatalf("DeleteUserSessionToken: err: %v", err)
+	}
+	sessions, _ = db.GetActiveSessions(time.Now())
+	if slices.ContainsFunc(sessions, func(s UserSession) bool { return s.UserId == 2 }) {
+		t.Fatalf("GetActiveSessions: expected the session of u2 revoked got %+v", sessions)
+	}
+}
+
+func Test_InitSchema(t *testing.T) {
+	schema, err := os.ReadFile("../../schema.sql")
+	if err != nil {
+		t.Fatalf("ReadFile: err: %v", err)
+	}
+	tables := SchemaTables(string(schema))
+	if !slices.Contains(tables, "UserTable") || !slices.Contains(tables, "ChannelTable") {
+		t.Fatalf("SchemaTables: unexpected tables %v", tables)
+	}
+
+	db := setup()
+	defer db.Close()
+	if err := db.InitSchema(string(schema)); !errors.Is(err, ErrSchemaExists) {
+		t.Fatalf("InitSchema: expected ErrSchemaExists got %v", err)
+	}
+	if users, _ := db.GetUsers(); len(users) != 3 {
+		t.Fatalf("InitSchema: expected the data kept got %d users", len(users))
+	}
+	existing, err := db.GetTableNames()
+	if err != nil {
+		t.Fatalf("GetTableNames: err: %v", err)
+	}
+	for _, table := range tables {
+		if !slices.Contains(existing, table) {
+			t.Fatalf("GetTableNames: missing %s in %v", table, existing)
+		}
+	}
+}
+
+func Test_SchemaColumns(t *testing.T) {
+	schema, err := os.ReadFile("../../schema.sql")
+	if err != nil {
+		t.Fatalf("ReadFile: err: %v", err)
+	}
+	wanted, err := SchemaColumns(string(schema))
+	if err != nil {
+		t.Fatalf("SchemaColumns: err: %v", err)
+	}
+	// channels of direct messages have no server
+	if !slices.Contains(wanted["ChannelTable"], Column{Name: "serverid", Type: "INTEGER"}) {
+		t.Fatalf("SchemaColumns: unexpected ChannelTable %+v", wanted["ChannelTable"])
+	}
+	if _, err := SchemaColumns("CREATE TABLE"); err == nil {
+		t.Fatalf("SchemaColumns: expected an invalid schema to fail")
+	}
+
+	db := setup()
+	defer db.Close()
+	existing, err := db.GetTableColumns()
+	if err != nil {
+		t.Fatalf("GetTableColumns: err: %v", err)
+	}
+	if len(existing) != len(wanted) {
+		t.Fatalf("GetTableColumns: expected %d tables got %d", len(wanted), len(existing))
+	}
+	for table, columns := range wanted {
+		if !slices.Equal(existing[table], columns) {
+			t.Fatalf("GetTableColumns: %s: expected %+v got %+v", table, columns, existing[table])
+		}
+	}
+}
+
+func Test_Backup(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	path := filepath.Join(t.TempDir(), "backup.db")
+	if err := db.Backup(context.Background(), path); err != nil {
+		t.Fatalf("Backup: err: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+		t.Fatalf("Backup: expected a copy at %s err: %v", path, err)
+	}
+	if err := db.Backup(context.Background(), path); err == nil {
+		t.Fatalf("Backup: expected an error overwriting %s", path)
+	}
+}
@@ -0,0 +1,221 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const attachmentSelect = "SELECT attachmentid, channelid, userid, messageid, filename, contenttype, size, storagekey, timestamp, width, height, blurhash FROM AttachmentTable"
+
+func scanAttachment(row rowScanner) (Attachment, error) {
+	var attachment Attachment
+	err := row.Scan(
+		&attachment.AttachmentId,
+		&attachment.ChannelId,
+		&attachment.UserId,
+		&attachment.MessageId,
+		&attachment.FileName,
+		&attachment.ContentType,
+		&attachment.Size,
+		&attachment.StorageKey,
+		&attachment.Timestamp,
+		&attachment.Width,
+		&attachment.Height,
+		&attachment.BlurHash,
+	)
+	return attachment, err
+}
+
+func (r *DBService) queryAttachments(query string, args ...any) ([]Attachment, error) {
+	rows, err := r.conn.Query(query, args...)
+	if err != nil {
+		return []Attachment{}, err
+	}
+	var attachments []Attachment
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			rows.Close()
+			return []Attachment{}, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	// close before loading thumbnails so the follow up query reuses the
+	// connection
+	rows.Close()
+	if err := r.loadThumbnails(attachments); err != nil {
+		return []Attachment{}, err
+	}
+	return attachments, nil
+}
+
+func (r *DBService) loadThumbnails(attachments []Attachment) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+	index := make(map[Id]int, len(attachments))
+	args := make([]any, len(attachments))
+	for i, attachment := range attachments {
+		index[attachment.AttachmentId] = i
+		args[i] = attachment.AttachmentId
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(attachments)), ", ")
+	rows, err := r.conn.Query(
+		"SELECT attachmentid, size, width, height, contenttype, storagekey FROM AttachmentThumbnailTable WHERE attachmentid IN ("+placeholders+") ORDER BY size",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var thumbnail AttachmentThumbnail
+		err := rows.Scan(
+			&thumbnail.AttachmentId,
+			&thumbnail.Size,
+			&thumbnail.Width,
+			&thumbnail.Height,
+			&thumbnail.ContentType,
+			&thumbnail.StorageKey,
+		)
+		if err != nil {
+			return err
+		}
+		i := index[thumbnail.AttachmentId]
+		attachments[i].Thumbnails = append(attachments[i].Thumbnails, thumbnail)
+	}
+	return nil
+}
+
+func (r *DBService) CreateAttachment(attachment Attachment) (Id, error) {
+	d, err := r.conn.Exec(
+		"INSERT INTO AttachmentTable (channelid, userid, messageid, filename, contenttype, size, storagekey) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		attachment.ChannelId,
+		attachment.UserId,
+		attachment.MessageId,
+		attachment.FileName,
+		attachment.ContentType,
+		attachment.Size,
+		attachment.StorageKey,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("add attachment - filename: %s err: %w", attachment.FileName, err)
+	}
+	id, err := d.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if id < 0 {
+		return 0, ErrNegativeRowIndex
+	}
+	return Id(id), nil
+}
+
+func (r *DBService) GetAttachment(attachmentid Id) (Attachment, error) {
+	attachments, err := r.queryAttachments(attachmentSelect+" WHERE attachmentid = ?", attachmentid)
+	if err != nil {
+		return Attachment{}, err
+	}
+	if len(attachments) == 0 {
+		return Attachment{}, ErrRecordNotFound
+	}
+	return attachments[0], nil
+}
+
+func (r *DBService) DeleteAttachment(attachmentid Id) error {
+	result, err := r.conn.Exec("DELETE FROM AttachmentTable WHERE attachmentid = ?", attachmentid)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// SetAttachmentImageInfo records the decoded dimensions and blurhash
+// placeholder of an image attachment.
+func (r *DBService) SetAttachmentImageInfo(attachmentid Id, width int, height int, blurhash string) error {
+	result, err := r.conn.Exec(
+		"UPDATE AttachmentTable SET width = ?, height = ?, blurhash = ? WHERE attachmentid = ?",
+		width,
+		height,
+		blurhash,
+		attachmentid,
+	)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// AddAttachmentThumbnail stores a thumbnail, replacing any earlier one of the
+// same size.
+func (r *DBService) AddAttachmentThumbnail(thumbnail AttachmentThumbnail) error {
+	_, err := r.conn.Exec(
+		"INSERT OR REPLACE INTO AttachmentThumbnailTable (attachmentid, size, width, height, contenttype, storagekey) VALUES (?, ?, ?, ?, ?, ?)",
+		thumbnail.AttachmentId,
+		thumbnail.Size,
+		thumbnail.Width,
+		thumbnail.Height,
+		thumbnail.ContentType,
+		thumbnail.StorageKey,
+	)
+	if err != nil {
+		return fmt.Errorf("add thumbnail - attachmentid: %d err: %w", thumbnail.AttachmentId, err)
+	}
+	return nil
+}
+
+// GetServerAttachmentUsage returns the number of bytes of attachments stored
+// across all channels of a server.
+func (r *DBService) GetServerAttachmentUsage(serverid Id) (int64, error) {
+	var usage int64
+	err := r.conn.QueryRowContext(
+		context.Background(),
+		"SELECT COALESCE(SUM(a.size), 0) FROM AttachmentTable a JOIN ChannelTable c ON a.channelid = c.channelid WHERE c.serverid = ?",
+		serverid,
+	).Scan(&usage)
+	if err != nil {
+		return 0, err
+	}
+	return usage, nil
+}
+
+// loadAttachments fills in the Attachments of every message in place.
+func (r *DBService) loadAttachments(messages []Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	index := make(map[Id]int, len(messages))
+	args := make([]any, len(messages))
+	for i, message := range messages {
+		index[message.MessageId] = i
+		args[i] = message.MessageId
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(messages)), ", ")
+	attachments, err := r.queryAttachments(
+		attachmentSelect+" WHERE messageid IN ("+placeholders+") ORDER BY attachmentid",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		i := index[*attachment.MessageId]
+		messages[i].Attachments = append(messages[i].Attachments, attachment)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func Test_CreateAttachment(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	messageid, err := db.AddMessage(1, 1, "with file")
+	if err != nil {
+		t.Fatalf("AddMessage: err: %v", err)
+	}
+	for _, key := range []string{"a", "b"} {
+		_, err := db.CreateAttachment(Attachment{
+			ChannelId:   1,
+			UserId:      1,
+			MessageId:   &messageid,
+			FileName:    key + ".txt",
+			ContentType: "text/plain",
+			Size:        100,
+			StorageKey:  key,
+		})
+		if err != nil {
+			t.Fatalf("CreateAttachment: err: %v", err)
+		}
+	}
+	message, err := db.GetMessage(messageid)
+	if err != nil {
+		t.Fatalf("GetMessage: err: %v", err)
+	}
+	if len(message.Attachments) != 2 || message.Attachments[0].FileName != "a.txt" {
+		t.Fatalf("GetMessage: unexpected attachments %+v", message.Attachments)
+	}
+	usage, err := db.GetServerAttachmentUsage(1)
+	if err != nil {
+		t.Fatalf("GetServerAttachmentUsage: err: %v", err)
+	}
+	if usage != 200 {
+		t.Fatalf("GetServerAttachmentUsage: expected 200 got %d", usage)
+	}
+	usage, err = db.GetServerAttachmentUsage(2)
+	if err != nil {
+		t.Fatalf("GetServerAttachmentUsage: err: %v", err)
+	}
+	if usage != 0 {
+		t.Fatalf("GetServerAttachmentUsage: expected 0 got %d", usage)
+	}
+}
+
+func Test_DeleteMessage_RemovesAttachments(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	messageid, err := db.AddMessage(1, 1, "with file")
+	if err != nil {
+		t.Fatalf("AddMessage: err: %v", err)
+	}
+	attachmentid, err := db.CreateAttachment(Attachment{
+		ChannelId:   1,
+		UserId:      1,
+		MessageId:   &messageid,
+		FileName:    "a.txt",
+		ContentType: "text/plain",
+		Size:        100,
+		StorageKey:  "a",
+	})
+	if err != nil {
+		t.Fatalf("CreateAttachment: err: %v", err)
+	}
+	_, err = db.DeleteMessage(messageid)
+	if err != nil {
+		t.Fatalf("DeleteMessage: err: %v", err)
+	}
+	_, err = db.GetAttachment(attachmentid)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("GetAttachment: expected ErrRecordNotFound got %v", err)
+	}
+}
+
+func Test_AttachmentImageInfo(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	messageid, err := db.AddMessage(1, 1, "photo")
+	if err != nil {
+		t.Fatalf("AddMessage: err: %v", err)
+	}
+	attachmentid, err := db.CreateAttachment(Attachment{
+		ChannelId:   1,
+		UserId:      1,
+		MessageId:   &messageid,
+		FileName:    "photo.png",
+		ContentType: "image/png",
+		Size:        100,
+		StorageKey:  "photo",
+	})
+	if err != nil {
+		t.Fatalf("CreateAttachment: err: %v", err)
+	}
+	err = db.SetAttachmentImageInfo(attachmentid, 640, 480, "LKO2?U%2Tw=w]~RBVZRi};RPxuwH")
+	if err != nil {
+		t.Fatalf("SetAttachmentImageInfo: err: %v", err)
+	}
+	for _, size := range []int{320, 64} {
+		err = db.AddAttachmentThumbnail(AttachmentThumbnail{
+			AttachmentId: attachmentid,
+			Size:         size,
+			Width:        size,
+			Height:       size * 3 / 4,
+			ContentType:  "image/png",
+			StorageKey:   "photo-" + strconv.Itoa(size),
+		})
+		if err != nil {
+			t.Fatalf("AddAttachmentThumbnail: err: %v", err)
+		}
+	}
+	message, err := db.GetMessage(messageid)
+	if err != nil {
+		t.Fatalf("GetMessage: err: %v", err)
+	}
+	attachment := message.Attachments[0]
+	if attachment.Width == nil || *attachment.Width != 640 || attachment.BlurHash == nil {
+		t.Fatalf("GetMessage: expected image info got %+v", attachment)
+	}
+	if len(attachment.Thumbnails) != 2 || attachment.Thumbnails[0].Size != 64 {
+		t.Fatalf("GetMessage: unexpected thumbnails %+v", attachment.Thumbnails)
+	}
+
+	err = db.SetAttachmentImageInfo(attachmentid+1, 1, 1, "")
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("SetAttachmentImageInfo: expected ErrRecordNotFound got %v", err)
+	}
+}
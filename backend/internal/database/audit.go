@@ -0,0 +1,103 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// AddAuditEntry records an administrative change. Before and After may be
+// nil when the change has no values on that side.
+func (r *DBService) AddAuditEntry(entry AuditEntry) (Id, error) {
+	before, err := json.Marshal(auditValues(entry.Before))
+	if err != nil {
+		return 0, err
+	}
+	after, err := json.Marshal(auditValues(entry.After))
+	if err != nil {
+		return 0, err
+	}
+	result, err := r.conn.Exec(
+		"INSERT INTO AuditLogTable (serverid, actorid, action, targettype, targetid, before, after, reason) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		entry.ServerId,
+		entry.ActorId,
+		entry.Action,
+		entry.TargetType,
+		entry.TargetId,
+		string(before),
+		string(after),
+		entry.Reason,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("add audit entry - serverid: %d err: %w", entry.ServerId, err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return Id(id), nil
+}
+
+func auditValues(values map[string]any) map[string]any {
+	if values == nil {
+		return map[string]any{}
+	}
+	return values
+}
+
+// GetAuditLog returns up to number entries of a server matching filter,
+// newest first.
+func (r *DBService) GetAuditLog(serverid Id, filter AuditLogFilter, number uint) ([]AuditEntry, error) {
+	conditions := []string{"serverid = ?"}
+	args := []any{serverid}
+	if filter.ActorId != 0 {
+		conditions = append(conditions, "actorid = ?")
+		args = append(args, filter.ActorId)
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.Before != 0 {
+		conditions = append(conditions, "entryid < ?")
+		args = append(args, filter.Before)
+	}
+	args = append(args, number)
+	rows, err := r.conn.Query(
+		"SELECT entryid, serverid, actorid, action, targettype, targetid, before, after, reason, created FROM AuditLogTable WHERE "+
+			strings.Join(conditions, " AND ")+" ORDER BY entryid DESC LIMIT ?",
+		args...,
+	)
+	if err != nil {
+		return []AuditEntry{}, err
+	}
+	defer rows.Close()
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		var before, after string
+		err := rows.Scan(
+			&entry.EntryId,
+			&entry.ServerId,
+			&entry.ActorId,
+			&entry.Action,
+			&entry.TargetType,
+			&entry.TargetId,
+			&before,
+			&after,
+			&entry.Reason,
+			&entry.Created,
+		)
+		if err != nil {
+			return []AuditEntry{}, err
+		}
+		if err := json.Unmarshal([]byte(before), &entry.Before); err != nil {
+			return []AuditEntry{}, fmt.Errorf("before of audit entry %d: %w", entry.EntryId, err)
+		}
+		if err := json.Unmarshal([]byte(after), &entry.After); err != nil {
+			return []AuditEntry{}, fmt.Errorf("after of audit entry %d: %w", entry.EntryId, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
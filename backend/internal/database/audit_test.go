@@ -0,0 +1,62 @@
+package database
+
+import (
+	"testing"
+)
+
+func Test_AuditLog(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	entries := []AuditEntry{
+		{ServerId: 1, ActorId: 1, Action: "channel_update", TargetType: AuditTargetChannel, TargetId: 1,
+			Before: map[string]any{"channelname": "general"}, After: map[string]any{"channelname": "lobby"}},
+		{ServerId: 1, ActorId: 1, Action: "channel_member_remove", TargetType: AuditTargetMember, TargetId: 3, Reason: "spam"},
+		{ServerId: 1, ActorId: 3, Action: "channel_update", TargetType: AuditTargetChannel, TargetId: 2},
+		{ServerId: 2, ActorId: 2, Action: "server_update", TargetType: AuditTargetServer, TargetId: 2},
+	}
+	var ids []Id
+	for _, entry := range entries {
+		id, err := db.AddAuditEntry(entry)
+		if err != nil {
+			t.Fatalf("AddAuditEntry: err: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	log, err := db.GetAuditLog(1, AuditLogFilter{}, 10)
+	if err != nil || len(log) != 3 || log[0].EntryId != ids[2] || log[2].EntryId != ids[0] {
+		t.Fatalf("GetAuditLog: expected the 3 entries of server 1 newest first got %+v err: %v", log, err)
+	}
+	first := log[2]
+	if first.Before["channelname"] != "general" || first.After["channelname"] != "lobby" || first.Created.IsZero() {
+		t.Fatalf("GetAuditLog: expected values to round trip got %+v", first)
+	}
+	if removal := log[1]; removal.Reason != "spam" || removal.Before == nil || len(removal.After) != 0 {
+		t.Fatalf("GetAuditLog: expected the reason and empty values got %+v", removal)
+	}
+
+	if log, _ := db.GetAuditLog(1, AuditLogFilter{ActorId: 1}, 10); len(log) != 2 {
+		t.Fatalf("GetAuditLog: expected 2 entries by user 1 got %+v", log)
+	}
+	if log, _ := db.GetAuditLog(1, AuditLogFilter{Action: "channel_update"}, 10); len(log) != 2 {
+		t.Fatalf("GetAuditLog: expected 2 channel updates got %+v", log)
+	}
+	if log, _ := db.GetAuditLog(1, AuditLogFilter{ActorId: 1, Action: "channel_update"}, 10); len(log) != 1 || log[0].EntryId != ids[0] {
+		t.Fatalf("GetAuditLog: expected the one channel update by user 1 got %+v", log)
+	}
+	page, _ := db.GetAuditLog(1, AuditLogFilter{}, 2)
+	if len(page) != 2 {
+		t.Fatalf("GetAuditLog: expected a page of 2 got %+v", page)
+	}
+	rest, _ := db.GetAuditLog(1, AuditLogFilter{Before: page[1].EntryId}, 2)
+	if len(rest) != 1 || rest[0].EntryId != ids[0] {
+		t.Fatalf("GetAuditLog: expected the oldest entry on the next page got %+v", rest)
+	}
+
+	if err := db.DeleteServer(2); err != nil {
+		t.Fatalf("DeleteServer: err: %v", err)
+	}
+	if log, _ := db.GetAuditLog(2, AuditLogFilter{}, 10); len(log) != 0 {
+		t.Fatalf("GetAuditLog: expected the log to go with the server got %+v", log)
+	}
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CreateBotUser adds a bot account managed by ownerid. Bots cannot log in
+// with a password, so they get a random one and act through API tokens.
+func (r *DBService) CreateBotUser(ownerid Id, username string) (Id, error) {
+	var botid Id
+	err := r.inTx(func(tx *DBService) error {
+		id, err := tx.CreateUser(username, rand.Text())
+		if err != nil {
+			return err
+		}
+		_, err = tx.conn.Exec("UPDATE UserTable SET isbot = 1, botowner = ? WHERE userid = ?", ownerid, id)
+		if err != nil {
+			return fmt.Errorf("create bot - username: %s err: %w", username, err)
+		}
+		botid = id
+		return nil
+	})
+	return botid, err
+}
+
+// GetBotsOfUser returns the bots managed by a user.
+func (r *DBService) GetBotsOfUser(ownerid Id) ([]User, error) {
+	rows, err := r.conn.Query(
+		"SELECT "+userColumns+" FROM UserTable as U WHERE U.isbot = 1 AND U.botowner = ? ORDER BY U.userid",
+		ownerid,
+	)
+	if err != nil {
+		return []User{}, err
+	}
+	defer rows.Close()
+	var bots []User
+	for rows.Next() {
+		bot, err := scanUser(rows)
+		if err != nil {
+			return []User{}, err
+		}
+		bots = append(bots, bot)
+	}
+	return bots, nil
+}
+
+const apiTokenSelect = "SELECT tokenid, userid, name, scopes, created, lastused, expires FROM APITokenTable"
+
+func scanAPIToken(row rowScanner) (APIToken, error) {
+	var token APIToken
+	var scopes string
+	err := row.Scan(&token.TokenId, &token.UserId, &token.Name, &scopes, &token.Created, &token.LastUsed, &token.Expires)
+	token.Scopes = strings.Fields(scopes)
+	return token, err
+}
+
+// CreateAPIToken stores a token by the hash of its secret.
+func (r *DBService) CreateAPIToken(token APIToken, tokenhash string) (Id, error) {
+	var expires any
+	if token.Expires != nil {
+		expires = token.Expires.UTC()
+	}
+	result, err := r.conn.Exec(
+		"INSERT INTO APITokenTable (userid, name, tokenhash, scopes, expires) VALUES (?, ?, ?, ?, ?)",
+		token.UserId,
+		token.Name,
+		tokenhash,
+		strings.Join(token.Scopes, " "),
+		expires,
+	)
+	if isConstraintError(err) {
+		return 0, ErrRecordAlreadyExists
+	}
+	if err != nil {
+		return 0, fmt.Errorf("create api token - userid: %d err: %w", token.UserId, err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return Id(id), nil
+}
+
+func (r *DBService) GetAPITokensOfUser(userid Id) ([]APIToken, error) {
+	rows, err := r.conn.Query(apiTokenSelect+" WHERE userid = ? ORDER BY tokenid", userid)
+	if err != nil {
+		return []APIToken{}, err
+	}
+	defer rows.Close()
+	var tokens []APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return []APIToken{}, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// GetAPITokenByHash looks up the token a bearer secret belongs to. Expiry is
+// left to the caller.
+func (r *DBService) GetAPITokenByHash(tokenhash string) (APIToken, error) {
+	token, err := scanAPIToken(r.conn.QueryRowContext(
+		context.Background(),
+		apiTokenSelect+" WHERE tokenhash = ?",
+		tokenhash,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIToken{}, ErrRecordNotFound
+	}
+	return token, err
+}
+
+// DeleteAPIToken revokes a token, provided it belongs to userid.
+func (r *DBService) DeleteAPIToken(tokenid Id, userid Id) error {
+	result, err := r.conn.Exec("DELETE FROM APITokenTable WHERE tokenid = ? AND userid = ?", tokenid, userid)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// TouchAPIToken records when a token was last used.
+func (r *DBService) TouchAPIToken(tokenid Id, now time.Time) error {
+	_, err := r.conn.Exec("UPDATE APITokenTable SET lastused = ? WHERE tokenid = ?", now.UTC(), tokenid)
+	return err
+}
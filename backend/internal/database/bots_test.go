@@ -0,0 +1,78 @@
+package database
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func Test_CreateBotUser(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	botid, err := db.CreateBotUser(1, "helper")
+	if err != nil {
+		t.Fatalf("CreateBotUser: err: %v", err)
+	}
+	bot, err := db.GetUser(botid)
+	if err != nil {
+		t.Fatalf("GetUser: err: %v", err)
+	}
+	if !bot.IsBot || bot.BotOwnerId != 1 {
+		t.Fatalf("GetUser: expected bot owned by 1 got %+v", bot)
+	}
+	if _, err := db.CreateBotUser(1, "u2"); !errors.Is(err, ErrRecordAlreadyExists) {
+		t.Fatalf("CreateBotUser: expected ErrRecordAlreadyExists got %v", err)
+	}
+	bots, err := db.GetBotsOfUser(1)
+	if err != nil || len(bots) != 1 || bots[0].UserId != botid {
+		t.Fatalf("GetBotsOfUser: unexpected bots %+v err: %v", bots, err)
+	}
+	if bots, _ := db.GetBotsOfUser(2); len(bots) != 0 {
+		t.Fatalf("GetBotsOfUser: expected no bots got %+v", bots)
+	}
+}
+
+func Test_APITokens(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	expires := time.Now().Add(time.Hour)
+	tokenid, err := db.CreateAPIToken(APIToken{
+		UserId:  1,
+		Name:    "ci",
+		Scopes:  []string{"messages:read", "messages:write"},
+		Expires: &expires,
+	}, "hash")
+	if err != nil {
+		t.Fatalf("CreateAPIToken: err: %v", err)
+	}
+	if _, err := db.CreateAPIToken(APIToken{UserId: 2, Name: "dup"}, "hash"); !errors.Is(err, ErrRecordAlreadyExists) {
+		t.Fatalf("CreateAPIToken: expected ErrRecordAlreadyExists got %v", err)
+	}
+
+	token, err := db.GetAPITokenByHash("hash")
+	if err != nil {
+		t.Fatalf("GetAPITokenByHash: err: %v", err)
+	}
+	if token.TokenId != tokenid || token.UserId != 1 || !slices.Equal(token.Scopes, []string{"messages:read", "messages:write"}) ||
+		token.Expires == nil || token.LastUsed != nil {
+		t.Fatalf("GetAPITokenByHash: unexpected token %+v", token)
+	}
+	if err := db.TouchAPIToken(tokenid, time.Now()); err != nil {
+		t.Fatalf("TouchAPIToken: err: %v", err)
+	}
+	tokens, err := db.GetAPITokensOfUser(1)
+	if err != nil || len(tokens) != 1 || tokens[0].LastUsed == nil {
+		t.Fatalf("GetAPITokensOfUser: unexpected tokens %+v err: %v", tokens, err)
+	}
+
+	if err := db.DeleteAPIToken(tokenid, 2); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("DeleteAPIToken: expected ErrRecordNotFound got %v", err)
+	}
+	if err := db.DeleteAPIToken(tokenid, 1); err != nil {
+		t.Fatalf("DeleteAPIToken: err: %v", err)
+	}
+	if _, err := db.GetAPITokenByHash("hash"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("GetAPITokenByHash: expected ErrRecordNotFound got %v", err)
+	}
+}
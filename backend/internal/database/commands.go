@@ -0,0 +1,169 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const botCommandSelect = "SELECT C.commandid, C.userid, C.name, C.description, C.options, C.created FROM BotCommandTable as C"
+
+func (r *DBService) queryBotCommands(query string, args ...any) ([]BotCommand, error) {
+	rows, err := r.conn.Query(query, args...)
+	if err != nil {
+		return []BotCommand{}, err
+	}
+	defer rows.Close()
+	var commands []BotCommand
+	for rows.Next() {
+		var command BotCommand
+		var options string
+		err := rows.Scan(&command.CommandId, &command.BotId, &command.Name, &command.Description, &options, &command.Created)
+		if err != nil {
+			return []BotCommand{}, err
+		}
+		if err := json.Unmarshal([]byte(options), &command.Options); err != nil {
+			return []BotCommand{}, fmt.Errorf("options of command %d: %w", command.CommandId, err)
+		}
+		commands = append(commands, command)
+	}
+	return commands, nil
+}
+
+// SetBotCommands replaces every command of a bot.
+func (r *DBService) SetBotCommands(botid Id, commands []BotCommand) error {
+	return r.inTx(func(tx *DBService) error {
+		if _, err := tx.conn.Exec("DELETE FROM BotCommandTable WHERE userid = ?", botid); err != nil {
+			return err
+		}
+		for _, command := range commands {
+			options, err := json.Marshal(command.Options)
+			if err != nil {
+				return err
+			}
+			_, err = tx.conn.Exec(
+				"INSERT INTO BotCommandTable (userid, name, description, options) VALUES (?, ?, ?, ?)",
+				botid,
+				command.Name,
+				command.Description,
+				string(options),
+			)
+			if isConstraintError(err) {
+				return ErrRecordAlreadyExists
+			}
+			if err != nil {
+				return fmt.Errorf("set commands - userid: %d err: %w", botid, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *DBService) GetBotCommands(botid Id) ([]BotCommand, error) {
+	return r.queryBotCommands(botCommandSelect+" WHERE C.userid = ? ORDER BY C.name", botid)
+}
+
+// GetBotCommandsOfServer returns the commands of every bot that is a member
+// of the server, oldest registration first.
+func (r *DBService) GetBotCommandsOfServer(serverid Id) ([]BotCommand, error) {
+	return r.queryBotCommands(
+		botCommandSelect+` JOIN UsersServerTable as US ON US.userid = C.userid
+			WHERE US.serverid = ? ORDER BY C.commandid`,
+		serverid,
+	)
+}
+
+// SetBotCallback stores the callback of a bot, or removes it when url is
+// empty.
+func (r *DBService) SetBotCallback(callback BotCallback) error {
+	if callback.URL == "" {
+		_, err := r.conn.Exec("DELETE FROM BotCallbackTable WHERE userid = ?", callback.BotId)
+		return err
+	}
+	_, err := r.conn.Exec(
+		`INSERT INTO BotCallbackTable (userid, url, secret) VALUES (?, ?, ?)
+			ON CONFLICT(userid) DO UPDATE SET url = excluded.url, secret = excluded.secret`,
+		callback.BotId,
+		callback.URL,
+		callback.Secret,
+	)
+	return err
+}
+
+func (r *DBService) GetBotCallback(botid Id) (BotCallback, error) {
+	var callback BotCallback
+	err := r.conn.QueryRowContext(
+		context.Background(),
+		"SELECT userid, url, secret FROM BotCallbackTable WHERE userid = ?",
+		botid,
+	).Scan(&callback.BotId, &callback.URL, &callback.Secret)
+	if errors.Is(err, sql.ErrNoRows) {
+		return BotCallback{}, ErrRecordNotFound
+	}
+	return callback, err
+}
+
+func (r *DBService) CreateReminder(reminder Reminder) (Id, error) {
+	result, err := r.conn.Exec(
+		"INSERT INTO ReminderTable (userid, channelid, message, due) VALUES (?, ?, ?, ?)",
+		reminder.UserId,
+		reminder.ChannelId,
+		reminder.Message,
+		reminder.Due.UTC(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("create reminder - userid: %d err: %w", reminder.UserId, err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return Id(id), nil
+}
+
+// GetDueReminders returns the reminders whose time has come, oldest first.
+func (r *DBService) GetDueReminders(now time.Time) ([]Reminder, error) {
+	rows, err := r.conn.Query(
+		"SELECT reminderid, userid, channelid, message, due, created FROM ReminderTable WHERE due <= ? ORDER BY due",
+		now.UTC(),
+	)
+	if err != nil {
+		return []Reminder{}, err
+	}
+	defer rows.Close()
+	var reminders []Reminder
+	for rows.Next() {
+		var reminder Reminder
+		err := rows.Scan(
+			&reminder.ReminderId,
+			&reminder.UserId,
+			&reminder.ChannelId,
+			&reminder.Message,
+			&reminder.Due,
+			&reminder.Created,
+		)
+		if err != nil {
+			return []Reminder{}, err
+		}
+		reminders = append(reminders, reminder)
+	}
+	return reminders, nil
+}
+
+func (r *DBService) DeleteReminder(reminderid Id) error {
+	result, err := r.conn.Exec("DELETE FROM ReminderTable WHERE reminderid = ?", reminderid)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_BotCommands(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	botid, err := db.CreateBotUser(1, "helper")
+	if err != nil {
+		t.Fatalf("CreateBotUser: err: %v", err)
+	}
+	commands := []BotCommand{
+		{Name: "deploy", Description: "ship it", Options: []CommandOption{{Name: "env", Type: CommandOptionString, Choices: []string{"prod", "staging"}}}},
+		{Name: "status"},
+	}
+	if err := db.SetBotCommands(botid, commands); err != nil {
+		t.Fatalf("SetBotCommands: err: %v", err)
+	}
+	if err := db.SetBotCommands(botid, []BotCommand{{Name: "a"}, {Name: "a"}}); !errors.Is(err, ErrRecordAlreadyExists) {
+		t.Fatalf("SetBotCommands: expected ErrRecordAlreadyExists for duplicate names got %v", err)
+	}
+	stored, err := db.GetBotCommands(botid)
+	if err != nil || len(stored) != 2 || stored[0].Name != "deploy" || stored[0].Options[0].Choices[1] != "staging" {
+		t.Fatalf("GetBotCommands: unexpected commands %+v err: %v", stored, err)
+	}
+
+	if inserver, _ := db.GetBotCommandsOfServer(1); len(inserver) != 0 {
+		t.Fatalf("GetBotCommandsOfServer: expected no commands before the bot joins got %+v", inserver)
+	}
+	if err := db.AddUserToServer(botid, 1, ""); err != nil {
+		t.Fatalf("AddUserToServer: err: %v", err)
+	}
+	if inserver, _ := db.GetBotCommandsOfServer(1); len(inserver) != 2 {
+		t.Fatalf("GetBotCommandsOfServer: expected 2 commands got %+v", inserver)
+	}
+
+	if _, err := db.GetBotCallback(botid); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("GetBotCallback: expected ErrRecordNotFound got %v", err)
+	}
+	for _, url := range []string{"https://a.example.com", "https://b.example.com"} {
+		if err := db.SetBotCallback(BotCallback{BotId: botid, URL: url, Secret: "s"}); err != nil {
+			t.Fatalf("SetBotCallback: err: %v", err)
+		}
+	}
+	if callback, err := db.GetBotCallback(botid); err != nil || callback.URL != "https://b.example.com" {
+		t.Fatalf("GetBotCallback: unexpected callback %+v err: %v", callback, err)
+	}
+	if err := db.SetBotCallback(BotCallback{BotId: botid}); err != nil {
+		t.Fatalf("SetBotCallback: err: %v", err)
+	}
+	if _, err := db.GetBotCallback(botid); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("GetBotCallback: expected callback removed got %v", err)
+	}
+
+	if _, err := db.DeleteUserAccount(botid, false); err != nil {
+		t.Fatalf("DeleteUserAccount: err: %v", err)
+	}
+	if stored, _ := db.GetBotCommands(botid); len(stored) != 0 {
+		t.Fatalf("GetBotCommands: expected commands removed with the bot got %+v", stored)
+	}
+}
+
+func Test_Reminders(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	now := time.Now()
+	reminderid, err := db.CreateReminder(Reminder{UserId: 1, ChannelId: 1, Message: "stand up", Due: now.Add(time.Minute)})
+	if err != nil {
+		t.Fatalf("CreateReminder: err: %v", err)
+	}
+	if _, err := db.CreateReminder(Reminder{UserId: 1, ChannelId: 2, Message: "later", Due: now.Add(time.Hour)}); err != nil {
+		t.Fatalf("CreateReminder: err: %v", err)
+	}
+	if due, _ := db.GetDueReminders(now); len(due) != 0 {
+		t.Fatalf("GetDueReminders: expected nothing due got %+v", due)
+	}
+	due, err := db.GetDueReminders(now.Add(2 * time.Minute))
+	if err != nil || len(due) != 1 || due[0].ReminderId != reminderid || due[0].Message != "stand up" {
+		t.Fatalf("GetDueReminders: unexpected reminders %+v err: %v", due, err)
+	}
+	if err := db.DeleteReminder(reminderid); err != nil {
+		t.Fatalf("DeleteReminder: err: %v", err)
+	}
+	if err := db.DeleteReminder(reminderid); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("DeleteReminder: expected ErrRecordNotFound got %v", err)
+	}
+	if err := db.DeleteChannel(2); err != nil {
+		t.Fatalf("DeleteChannel: err: %v", err)
+	}
+	if due, _ := db.GetDueReminders(now.Add(2 * time.Hour)); len(due) != 0 {
+		t.Fatalf("GetDueReminders: expected reminders removed with the channel got %+v", due)
+	}
+}
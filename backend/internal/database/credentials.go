@@ -0,0 +1,215 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+func newSessionToken() (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// SetUserEmail changes the email address of a user. The new address starts
+// out unverified.
+func (r *DBService) SetUserEmail(userid Id, email string) error {
+	result, err := r.conn.Exec(
+		"UPDATE UserTable SET email = ?, emailverified = 0 WHERE userid = ?",
+		email,
+		userid,
+	)
+	if isConstraintError(err) {
+		return ErrRecordAlreadyExists
+	}
+	if err != nil {
+		return fmt.Errorf("set email - userid: %d err: %w", userid, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *DBService) GetUserEmail(userid Id) (UserEmail, error) {
+	var email UserEmail
+	err := r.conn.QueryRowContext(
+		context.Background(),
+		"SELECT email, emailverified FROM UserTable WHERE userid = ?",
+		userid,
+	).Scan(&email.Email, &email.Verified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return UserEmail{}, ErrRecordNotFound
+	}
+	return email, err
+}
+
+func (r *DBService) GetUserIDFromEmail(email string) (Id, error) {
+	var userid Id
+	err := r.conn.QueryRowContext(
+		context.Background(),
+		"SELECT userid FROM UserTable WHERE email = ? AND email != ''",
+		email,
+	).Scan(&userid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrRecordNotFound
+	}
+	return userid, err
+}
+
+// MarkEmailVerified verifies the address of a user, provided it is still the
+// one the verification was sent to.
+func (r *DBService) MarkEmailVerified(userid Id, email string) error {
+	result, err := r.conn.Exec(
+		"UPDATE UserTable SET emailverified = 1 WHERE userid = ? AND email = ? AND email != ''",
+		userid,
+		email,
+	)
+	if err != nil {
+		return fmt.Errorf("verify email - userid: %d err: %w", userid, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *DBService) UpdateUserPassword(userid Id, password string) error {
+	login, err := r.GetUserLoginInfo(userid)
+	if err != nil {
+		return err
+	}
+	_, err = r.conn.Exec(
+		"UPDATE UserLoginTable SET passwordhash = ? WHERE userid = ?",
+		hashPassword(password, login.Salt),
+		userid,
+	)
+	if err != nil {
+		return fmt.Errorf("update password - userid: %d err: %w", userid, err)
+	}
+	return nil
+}
+
+// RemoveUserPassword leaves a user without a password, so password sign-in
+// fails until UpdateUserPassword sets one.
+func (r *DBService) RemoveUserPassword(userid Id) error {
+	_, err := r.conn.Exec("UPDATE UserLoginTable SET passwordhash = '' WHERE userid = ?", userid)
+	if err != nil {
+		return fmt.Errorf("remove password - userid: %d err: %w", userid, err)
+	}
+	return nil
+}
+
+// CreateAuthToken stores a newly issued token. Tokens issued earlier to the
+// same user for the same purpose stop working.
+func (r *DBService) CreateAuthToken(token AuthToken) error {
+	return r.inTx(func(tx *DBService) error {
+		_, err := tx.conn.Exec(
+			"DELETE FROM AuthTokenTable WHERE userid = ? AND purpose = ?",
+			token.UserId,
+			token.Purpose,
+		)
+		if err != nil {
+			return err
+		}
+		_, err = tx.conn.Exec(
+			"INSERT INTO AuthTokenTable (tokenid, userid, purpose, email, expires) VALUES (?, ?, ?, ?, ?)",
+			token.TokenId,
+			token.UserId,
+			token.Purpose,
+			token.Email,
+			token.Expires,
+		)
+		if err != nil {
+			return fmt.Errorf("create auth token - userid: %d err: %w", token.UserId, err)
+		}
+		return nil
+	})
+}
+
+// GetAuthToken returns a token without using it up. Expiry is left to the
+// caller.
+func (r *DBService) GetAuthToken(tokenid string, purpose string) (AuthToken, error) {
+	var token AuthToken
+	err := r.conn.QueryRowContext(
+		context.Background(),
+		"SELECT tokenid, userid, purpose, email, expires FROM AuthTokenTable WHERE tokenid = ? AND purpose = ?",
+		tokenid,
+		purpose,
+	).Scan(&token.TokenId, &token.UserId, &token.Purpose, &token.Email, &token.Expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return AuthToken{}, ErrRecordNotFound
+	}
+	return token, err
+}
+
+// ConsumeAuthToken removes a token and returns it, so each token can be
+// redeemed at most once. Expiry is left to the caller.
+func (r *DBService) ConsumeAuthToken(tokenid string, purpose string) (AuthToken, error) {
+	var token AuthToken
+	err := r.inTx(func(tx *DBService) error {
+		err := tx.conn.QueryRowContext(
+			context.Background(),
+			"SELECT tokenid, userid, purpose, email, expires FROM AuthTokenTable WHERE tokenid = ? AND purpose = ?",
+			tokenid,
+			purpose,
+		).Scan(&token.TokenId, &token.UserId, &token.Purpose, &token.Email, &token.Expires)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrRecordNotFound
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.conn.Exec("DELETE FROM AuthTokenTable WHERE tokenid = ?", tokenid)
+		return err
+	})
+	return token, err
+}
+
+// GetUserIDFromIdentity finds the user linked to an account at an external
+// identity provider.
+func (r *DBService) GetUserIDFromIdentity(provider string, subject string) (Id, error) {
+	var userid Id
+	err := r.conn.QueryRowContext(
+		context.Background(),
+		"SELECT userid FROM UserIdentityTable WHERE provider = ? AND subject = ?",
+		provider,
+		subject,
+	).Scan(&userid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrRecordNotFound
+	}
+	return userid, err
+}
+
+// LinkUserIdentity lets a user sign in through an external identity
+// provider account.
+func (r *DBService) LinkUserIdentity(userid Id, provider string, subject string) error {
+	_, err := r.conn.Exec(
+		"INSERT INTO UserIdentityTable (provider, subject, userid) VALUES (?, ?, ?)",
+		provider,
+		subject,
+		userid,
+	)
+	if isConstraintError(err) {
+		return ErrRecordAlreadyExists
+	}
+	if err != nil {
+		return fmt.Errorf("link identity - userid: %d err: %w", userid, err)
+	}
+	return nil
+}
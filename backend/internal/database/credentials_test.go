@@ -0,0 +1,164 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_UserEmail(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	email, err := db.GetUserEmail(1)
+	if err != nil || email.Email != "u1@example.com" || !email.Verified {
+		t.Fatalf("GetUserEmail: unexpected %+v err: %v", email, err)
+	}
+	if err := db.SetUserEmail(3, "u1@example.com"); !errors.Is(err, ErrRecordAlreadyExists) {
+		t.Fatalf("SetUserEmail: expected ErrRecordAlreadyExists got %v", err)
+	}
+	if err := db.SetUserEmail(1, "one@example.com"); err != nil {
+		t.Fatalf("SetUserEmail: err: %v", err)
+	}
+	email, _ = db.GetUserEmail(1)
+	if email.Verified {
+		t.Fatalf("SetUserEmail: expected new address to be unverified")
+	}
+	if err := db.MarkEmailVerified(1, "u1@example.com"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("MarkEmailVerified: expected ErrRecordNotFound for old address got %v", err)
+	}
+	if err := db.MarkEmailVerified(1, "one@example.com"); err != nil {
+		t.Fatalf("MarkEmailVerified: err: %v", err)
+	}
+	userid, err := db.GetUserIDFromEmail("one@example.com")
+	if err != nil || userid != 1 {
+		t.Fatalf("GetUserIDFromEmail: expected 1 got %d err: %v", userid, err)
+	}
+	if _, err := db.GetUserIDFromEmail(""); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("GetUserIDFromEmail: expected ErrRecordNotFound for empty address got %v", err)
+	}
+}
+
+func Test_AuthTokens(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	expires := time.Now().Add(time.Hour)
+	if err := db.CreateAuthToken(AuthToken{TokenId: "a", UserId: 1, Purpose: "reset", Expires: expires}); err != nil {
+		t.Fatalf("CreateAuthToken: err: %v", err)
+	}
+	if err := db.CreateAuthToken(AuthToken{TokenId: "b", UserId: 1, Purpose: "reset", Expires: expires}); err != nil {
+		t.Fatalf("CreateAuthToken: err: %v", err)
+	}
+	if _, err := db.ConsumeAuthToken("a", "reset"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("ConsumeAuthToken: expected superseded token to be gone got %v", err)
+	}
+	if _, err := db.ConsumeAuthToken("b", "verify"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("ConsumeAuthToken: expected purpose mismatch to fail got %v", err)
+	}
+	token, err := db.ConsumeAuthToken("b", "reset")
+	if err != nil || token.UserId != 1 || !token.Expires.Equal(expires) {
+		t.Fatalf("ConsumeAuthToken: unexpected %+v err: %v", token, err)
+	}
+	if _, err := db.ConsumeAuthToken("b", "reset"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("ConsumeAuthToken: expected token to be single use got %v", err)
+	}
+}
+
+func Test_GetAuthToken(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	token := AuthToken{TokenId: "a", UserId: 1, Purpose: "reset", Expires: time.Now().Add(time.Hour)}
+	if err := db.CreateAuthToken(token); err != nil {
+		t.Fatalf("CreateAuthToken: err: %v", err)
+	}
+	if _, err := db.GetAuthToken("a", "verify"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("GetAuthToken: expected ErrRecordNotFound for another purpose got %v", err)
+	}
+	stored, err := db.GetAuthToken("a", "reset")
+	if err != nil || stored.UserId != 1 {
+		t.Fatalf("GetAuthToken: unexpected %+v err: %v", stored, err)
+	}
+	if _, err := db.ConsumeAuthToken("a", "reset"); err != nil {
+		t.Fatalf("ConsumeAuthToken: expected the token to be left in place got %v", err)
+	}
+}
+
+func Test_UpdateUserPassword(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	if err := db.UpdateUserPassword(1, "new"); err != nil {
+		t.Fatalf("UpdateUserPassword: err: %v", err)
+	}
+	if valid, _ := db.ValidateUserLoginInfo(1, "1"); valid {
+		t.Fatalf("ValidateUserLoginInfo: expected old password to be rejected")
+	}
+	if valid, _ := db.ValidateUserLoginInfo(1, "new"); !valid {
+		t.Fatalf("ValidateUserLoginInfo: expected new password to be accepted")
+	}
+}
+
+func Test_RemoveUserPassword(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	if err := db.RemoveUserPassword(1); err != nil {
+		t.Fatalf("RemoveUserPassword: err: %v", err)
+	}
+	login, err := db.GetUserLoginInfo(1)
+	if err != nil || login.HasPassword() {
+		t.Fatalf("GetUserLoginInfo: expected no password got %+v err: %v", login, err)
+	}
+	for _, password := range []string{"1", ""} {
+		if valid, _ := db.ValidateUserLoginInfo(1, password); valid {
+			t.Fatalf("ValidateUserLoginInfo: expected %q to be rejected", password)
+		}
+	}
+	if err := db.UpdateUserPassword(1, "new"); err != nil {
+		t.Fatalf("UpdateUserPassword: err: %v", err)
+	}
+	if valid, _ := db.ValidateUserLoginInfo(1, "new"); !valid {
+		t.Fatalf("ValidateUserLoginInfo: expected new password to be accepted")
+	}
+}
+
+func Test_SessionTokens(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	first, _, err := db.UpdateUserSessionToken(1)
+	if err != nil {
+		t.Fatalf("UpdateUserSessionToken: err: %v", err)
+	}
+	second, _, err := db.UpdateUserSessionToken(1)
+	if err != nil || second != first {
+		t.Fatalf("UpdateUserSessionToken: expected valid token %q to be kept got %q err: %v", first, second, err)
+	}
+	rotated, _, err := db.RotateUserSessionToken(1)
+	if err != nil || rotated == first {
+		t.Fatalf("RotateUserSessionToken: expected a new token got %q err: %v", rotated, err)
+	}
+	if err := db.DeleteUserSessionToken(1); err != nil {
+		t.Fatalf("DeleteUserSessionToken: err: %v", err)
+	}
+	if _, err := db.GetUserLoginInfoFromToken(rotated); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("GetUserLoginInfoFromToken: expected revoked token to be gone got %v", err)
+	}
+}
+
+func Test_UserIdentity(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	if _, err := db.GetUserIDFromIdentity("corp", "sub-1"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("GetUserIDFromIdentity: expected ErrRecordNotFound got %v", err)
+	}
+	if err := db.LinkUserIdentity(2, "corp", "sub-1"); err != nil {
+		t.Fatalf("LinkUserIdentity: err: %v", err)
+	}
+	if err := db.LinkUserIdentity(3, "corp", "sub-1"); !errors.Is(err, ErrRecordAlreadyExists) {
+		t.Fatalf("LinkUserIdentity: expected ErrRecordAlreadyExists got %v", err)
+	}
+	userid, err := db.GetUserIDFromIdentity("corp", "sub-1")
+	if err != nil || userid != 2 {
+		t.Fatalf("GetUserIDFromIdentity: expected 2 got %d err: %v", userid, err)
+	}
+	if _, err := db.GetUserIDFromIdentity("other", "sub-1"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("GetUserIDFromIdentity: expected identities to be per provider got %v", err)
+	}
+}
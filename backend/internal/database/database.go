@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
@@ -11,6 +12,8 @@ import (
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/mattn/go-sqlite3"
 	_ "github.com/mattn/go-sqlite3"
+
+	"go-chat-react/internal/markdown"
 )
 
 type dbConn interface {
@@ -49,7 +52,10 @@ func New(db *sql.DB) *DBService {
 }
 
 func (r *DBService) DeleteUserSessionToken(userid Id) error {
-	random_token := "TODO_FIND_METHODALATER"
+	random_token, err := newSessionToken()
+	if err != nil {
+		return err
+	}
 	expire := time.Now().Add(-24 * time.Hour)
 	result, err := r.conn.Exec(
 		"UPDATE UserLoginTable SET token = ?, token_expire_time = ? WHERE userid=? ",
@@ -152,30 +158,70 @@ func (r *DBService) CreateServer(ownerid Id, servername string) (Id, error) {
 	return Id(id), nil
 }
 
-func (r *DBService) DeleteMessage(messageid Id) error {
-	a, err := r.conn.Exec("DELETE FROM ChannelMessageTable WHERE messageid = ?", messageid)
-	if err != nil {
+// DeleteMessage removes a message. Deleting the root of a thread removes
+// its replies and followers too. It returns the attachments of every
+// removed message so their blobs can be deleted.
+func (r *DBService) DeleteMessage(messageid Id) ([]Attachment, error) {
+	var attachments []Attachment
+	err := r.inTx(func(tx *DBService) error {
+		var err error
+		attachments, err = tx.queryAttachments(
+			attachmentSelect+" WHERE messageid IN (SELECT messageid FROM ChannelMessageTable WHERE messageid = ? OR threadid = ?) ORDER BY attachmentid",
+			messageid,
+			messageid,
+		)
+		if err != nil {
+			return err
+		}
+		a, err := tx.conn.Exec("DELETE FROM ChannelMessageTable WHERE messageid = ?", messageid)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := a.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("error getting rows affected: %w", err)
+		}
+		if rowsAffected == 0 {
+			return ErrRecordNotFound
+		}
+		if _, err := tx.conn.Exec("DELETE FROM ChannelMessageTable WHERE threadid = ?", messageid); err != nil {
+			return fmt.Errorf("delete thread replies - rootid: %d err: %w", messageid, err)
+		}
+		if _, err := tx.conn.Exec("DELETE FROM ThreadFollowerTable WHERE rootid = ?", messageid); err != nil {
+			return fmt.Errorf("delete thread followers - rootid: %d err: %w", messageid, err)
+		}
+		_, err = tx.conn.Exec("DELETE FROM ThreadTable WHERE rootid = ?", messageid)
 		return err
-	}
-	rowsAffected, err := a.RowsAffected()
+	})
 	if err != nil {
-		return fmt.Errorf("error getting rows affected: %w", err)
-	}
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+		return nil, err
 	}
-	return nil
+	return attachments, nil
 }
 
 func (r *DBService) UpdateMessage(messageid Id, message string) error {
-	_, err := r.conn.Exec(
-		"UPDATE ChannelMessageTable SET contents = ? WHERE messageid=? ",
+	ast, err := encodeAST(message)
+	if err != nil {
+		return err
+	}
+	_, err = r.conn.Exec(
+		"UPDATE ChannelMessageTable SET contents = ?, ast = ? WHERE messageid=? ",
 		message,
+		ast,
 		messageid,
 	)
 	return err
 }
 
+// encodeAST parses message contents into the JSON stored next to them.
+func encodeAST(contents string) (string, error) {
+	data, err := json.Marshal(markdown.Parse(contents))
+	if err != nil {
+		return "", fmt.Errorf("encode message ast: %w", err)
+	}
+	return string(data), nil
+}
+
 func (r *DBService) GetUserIDFromUserName(username string) (Id, error) {
 	rows, err := r.conn.Query("SELECT userid FROM UserTable WHERE username = ?", username)
 	if err != nil {
@@ -200,8 +246,30 @@ func (r *DBService) GetUserIDFromUserName(username string) (Id, error) {
 	return userid, nil
 }
 
+// UpdateUserSessionToken starts a session for a user, extending the current
+// session token when it is still valid so other devices stay signed in.
 func (r *DBService) UpdateUserSessionToken(userid Id) (string, time.Time, error) {
-	token := "token" + strconv.FormatUint(uint64(userid), 10)
+	login, err := r.GetUserLoginInfo(userid)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if login.Token != "" && time.Now().Before(login.TokenExpireTime) {
+		return r.setUserSessionToken(userid, login.Token)
+	}
+	return r.RotateUserSessionToken(userid)
+}
+
+// RotateUserSessionToken replaces the session token of a user with a fresh
+// one, signing out every other holder of the old token.
+func (r *DBService) RotateUserSessionToken(userid Id) (string, time.Time, error) {
+	token, err := newSessionToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return r.setUserSessionToken(userid, token)
+}
+
+func (r *DBService) setUserSessionToken(userid Id, token string) (string, time.Time, error) {
 	expire := time.Now().Add(24 * time.Hour)
 	_, err := r.conn.Exec(
 		"UPDATE UserLoginTable SET token = ?, token_expire_time = ? WHERE userid=? ",
@@ -282,7 +350,7 @@ func (r *DBService) GetUserLoginInfoFromToken(token string) (UserLoginInfo, erro
 }
 
 func (r *DBService) GetUser(userid Id) (User, error) {
-	rows, err := r.conn.Query("SELECT userid, username FROM UserTable WHERE userid = ?", userid)
+	rows, err := r.conn.Query("SELECT "+userColumns+" FROM UserTable as U WHERE U.userid = ?", userid)
 	if errors.Is(err, sql.ErrNoRows) {
 		return User{}, ErrRecordNotFound
 	}
@@ -297,7 +365,7 @@ func (r *DBService) GetUser(userid Id) (User, error) {
 		if count > 1 {
 			return User{}, ErrMultipleRecords
 		}
-		err := rows.Scan(&user.UserId, &user.UserName)
+		user, err = scanUser(rows)
 		if err != nil {
 			return User{}, err
 		}
@@ -355,6 +423,15 @@ func (r *DBService) UpdateServerName(serverid Id, servername string) error {
 	return err
 }
 
+func (r *DBService) UpdateServerUploadQuota(serverid Id, quota int64) error {
+	_, err := r.conn.Exec(
+		"UPDATE ServerTable SET uploadquota = ? WHERE serverid=? ",
+		quota,
+		serverid,
+	)
+	return err
+}
+
 func (r *DBService) GetRecentUsernames(userid Id, number uint) ([]UsernameLogEntry, error) {
 	rows, err := r.conn.Query(
 		"SELECT userid, username, timestamp FROM UserNameLogTable WHERE userid = ? ORDER BY timestamp DESC LIMIT ?",
@@ -379,7 +456,7 @@ func (r *DBService) GetRecentUsernames(userid Id, number uint) ([]UsernameLogEnt
 
 func (r *DBService) GetUsersOfServer(serverid Id) ([]User, error) {
 	rows, err := r.conn.Query(
-		"SELECT U.userid, U.username FROM UsersServerTable as US INNER JOIN UserTable as U ON US.userid = U.userid WHERE US.serverid = ?",
+		"SELECT "+userColumns+" FROM UsersServerTable as US INNER JOIN UserTable as U ON US.userid = U.userid WHERE US.serverid = ?",
 		serverid,
 	)
 	if err != nil {
@@ -388,8 +465,7 @@ func (r *DBService) GetUsersOfServer(serverid Id) ([]User, error) {
 	defer rows.Close()
 	var names []User
 	for rows.Next() {
-		var name User
-		err := rows.Scan(&name.UserId, &name.UserName)
+		name, err := scanUser(rows)
 		if err != nil {
 			return []User{}, err
 		}
@@ -405,7 +481,7 @@ func (r *DBService) DeleteServer(serverid Id) error {
 
 func (r *DBService) GetServersOfUser(userid Id) ([]Server, error) {
 	rows, err := r.conn.Query(
-		"SELECT S.serverid, S.ownerid, S.servername FROM UsersServerTable as U INNER JOIN ServerTable as S ON U.serverid = S.serverid WHERE U.userid = ?",
+		"SELECT S.serverid, S.ownerid, S.servername, S.uploadquota FROM UsersServerTable as U INNER JOIN ServerTable as S ON U.serverid = S.serverid WHERE U.userid = ?",
 		userid,
 	)
 	if err != nil {
@@ -415,7 +491,7 @@ func (r *DBService) GetServersOfUser(userid Id) ([]Server, error) {
 	var servers []Server
 	for rows.Next() {
 		var s Server
-		err := rows.Scan(&s.ServerId, &s.OwnerId, &s.ServerName)
+		err := rows.Scan(&s.ServerId, &s.OwnerId, &s.ServerName, &s.UploadQuota)
 		if err != nil {
 			return []Server{}, err
 		}
@@ -426,7 +502,7 @@ func (r *DBService) GetServersOfUser(userid Id) ([]Server, error) {
 
 func (r *DBService) GetChannelsOfServer(serverid Id) ([]Channel, error) {
 	rows, err := r.conn.Query(
-		"SELECT channelid, serverid, channelname, timestamp FROM ChannelTable WHERE serverid = ?",
+		"SELECT channelid, serverid, channelname, timestamp, pinlimit FROM ChannelTable WHERE serverid = ?",
 		serverid,
 	)
 	if err != nil {
@@ -436,7 +512,7 @@ func (r *DBService) GetChannelsOfServer(serverid Id) ([]Channel, error) {
 	var servers []Channel
 	for rows.Next() {
 		var s Channel
-		err := rows.Scan(&s.ChannelId, &s.ServerId, &s.ChannelName, &s.Timestamp)
+		err := rows.Scan(&s.ChannelId, &s.ServerId, &s.ChannelName, &s.Timestamp, &s.PinLimit)
 		if err != nil {
 			return []Channel{}, err
 		}
@@ -505,7 +581,7 @@ func (r *DBService) IsUserInServer(userid Id, serverid Id) (bool, error) {
 
 func (r *DBService) GetChannel(channelid Id) (Channel, error) {
 	rows, err := r.conn.Query(
-		"SELECT channelid, channelname, serverid, timestamp FROM ChannelTable WHERE channelid = ?",
+		"SELECT channelid, channelname, COALESCE(serverid, 0), timestamp, pinlimit FROM ChannelTable WHERE channelid = ?",
 		channelid,
 	)
 	if err != nil {
@@ -524,6 +600,7 @@ func (r *DBService) GetChannel(channelid Id) (Channel, error) {
 			&channel.ChannelName,
 			&channel.ServerId,
 			&channel.Timestamp,
+			&channel.PinLimit,
 		)
 		if err != nil {
 			return Channel{}, err
@@ -544,9 +621,18 @@ func (r *DBService) UpdateChannel(channelid Id, new_server_name string) error {
 	return err
 }
 
+func (r *DBService) UpdateChannelPinLimit(channelid Id, pinlimit uint) error {
+	_, err := r.conn.Exec(
+		"UPDATE ChannelTable SET pinlimit = ? WHERE channelid = ? ",
+		pinlimit,
+		channelid,
+	)
+	return err
+}
+
 func (r *DBService) GetServer(serverid Id) (Server, error) {
 	rows, err := r.conn.Query(
-		"SELECT serverid, ownerid, servername FROM ServerTable WHERE serverid = ? ",
+		"SELECT serverid, ownerid, servername, uploadquota FROM ServerTable WHERE serverid = ? ",
 		serverid,
 	)
 	if err != nil {
@@ -561,6 +647,7 @@ func (r *DBService) GetServer(serverid Id) (Server, error) {
 			&server.ServerId,
 			&server.OwnerId,
 			&server.ServerName,
+			&server.UploadQuota,
 		)
 		if err != nil {
 			return Server{}, err
@@ -572,51 +659,108 @@ func (r *DBService) GetServer(serverid Id) (Server, error) {
 	return server, nil
 }
 
-func (r *DBService) GetMessage(messageid Id) (Message, error) {
-	rows, err := r.conn.Query(
-		"SELECT m.messageid, m.channelid, m.userid, m.contents, m.timestamp, m.editted, m.edittimestamp, c.serverid FROM ChannelMessageTable m JOIN ChannelTable c on m.channelid = c.channelid WHERE m.messageid = ?",
-		messageid,
+// messageSelect is the shared projection used by every query that returns
+// Message rows. Results must be read back with scanMessage.
+const messageSelect = `SELECT m.messageid, m.channelid, m.userid, m.contents, m.timestamp, m.editted, m.edittimestamp, COALESCE(c.serverid, 0), m.replytoid, m.threadid, m.messagetype, m.ast, ` + effectiveNameColumn + `, p.messageid, p.userid, p.contents, t.replycount, t.lastreply
+	FROM ChannelMessageTable m
+	JOIN ChannelTable c on m.channelid = c.channelid
+	LEFT JOIN UserTable U ON U.userid = m.userid
+	LEFT JOIN UsersServerTable US ON US.userid = m.userid AND US.serverid = c.serverid
+	LEFT JOIN ChannelMessageTable p ON m.replytoid = p.messageid
+	LEFT JOIN ThreadTable t ON t.rootid = m.messageid`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMessage(row rowScanner) (Message, error) {
+	var message Message
+	var parentid, parentuserid, replycount sql.NullInt64
+	var parentcontents, ast, authorname sql.NullString
+	var lastreply *time.Time
+	err := row.Scan(
+		&message.MessageId,
+		&message.ChannelId,
+		&message.UserId,
+		&message.Contents,
+		&message.Timestamp,
+		&message.Editted,
+		&message.EdittedTimeStamp,
+		&message.ServerId,
+		&message.ReplyToId,
+		&message.ThreadId,
+		&message.Type,
+		&ast,
+		&authorname,
+		&parentid,
+		&parentuserid,
+		&parentcontents,
+		&replycount,
+		&lastreply,
 	)
 	if err != nil {
 		return Message{}, err
 	}
-	defer rows.Close()
-	count := 0
-	var message Message
-	for rows.Next() {
-		count += 1
-		err := rows.Scan(
-			&message.MessageId,
-			&message.ChannelId,
-			&message.UserId,
-			&message.Contents,
-			&message.Timestamp,
-			&message.Editted,
-			&message.EdittedTimeStamp,
-			&message.ServerId,
-		)
-		if err != nil {
-			return Message{}, err
+	message.AuthorName = authorname.String
+	// messages written before the AST column existed are parsed on read
+	if !ast.Valid || json.Unmarshal([]byte(ast.String), &message.AST) != nil {
+		message.AST = markdown.Parse(message.Contents)
+	}
+	if message.ReplyToId != nil {
+		message.ReplyTo = &MessageReference{MessageId: *message.ReplyToId, Deleted: !parentid.Valid}
+		if parentid.Valid {
+			message.ReplyTo.UserId = Id(parentuserid.Int64)
+			message.ReplyTo.Contents = parentcontents.String
 		}
 	}
-	if count == 0 {
-		return Message{}, ErrRecordNotFound
+	if replycount.Valid {
+		message.Thread = &ThreadSummary{
+			RootId:     message.MessageId,
+			ReplyCount: uint(replycount.Int64),
+			LastReply:  lastreply,
+		}
 	}
 	return message, nil
 }
 
+func (r *DBService) GetMessage(messageid Id) (Message, error) {
+	messages, err := r.queryMessages(messageSelect+" WHERE m.messageid = ?", messageid)
+	if err != nil {
+		return Message{}, err
+	}
+	if len(messages) == 0 {
+		return Message{}, ErrRecordNotFound
+	}
+	return messages[0], nil
+}
+
 func (r *DBService) AddMessage(channelid Id, userid Id, message string) (Id, error) {
-	if userid == 0 || channelid == 0 {
+	return r.CreateMessage(NewMessage{ChannelId: channelid, UserId: userid, Contents: message})
+}
+
+func (r *DBService) CreateMessage(message NewMessage) (Id, error) {
+	if message.UserId == 0 || message.ChannelId == 0 {
 		return 0, fmt.Errorf("add message - zero userid or channel id")
 	}
+	if message.Type == "" {
+		message.Type = MessageTypeDefault
+	}
+	ast, err := encodeAST(message.Contents)
+	if err != nil {
+		return 0, err
+	}
 	d, err := r.conn.Exec(
-		"INSERT INTO ChannelMessageTable (userid, channelid, contents) VALUES ( ?, ?, ?)",
-		userid,
-		channelid,
-		message,
+		"INSERT INTO ChannelMessageTable (userid, channelid, contents, replytoid, threadid, messagetype, ast) VALUES ( ?, ?, ?, ?, ?, ?, ?)",
+		message.UserId,
+		message.ChannelId,
+		message.Contents,
+		message.ReplyToId,
+		message.ThreadId,
+		message.Type,
+		ast,
 	)
 	if err != nil {
-		return 0, fmt.Errorf("add user - userid: %d err: %w", userid, err)
+		return 0, fmt.Errorf("add message - userid: %d err: %w", message.UserId, err)
 	}
 	id, err := d.LastInsertId()
 	if err != nil {
@@ -628,41 +772,50 @@ func (r *DBService) AddMessage(channelid Id, userid Id, message string) (Id, err
 	return Id(id), nil
 }
 
-// "SELECT m.messageid, m.channelid, m.userid, m.contents, m.timestamp, m.editted, m.edittimestamp, c.serverid FROM ChannelMessageTable m JOIN ChannelServeTable c ON m.channelid = c.channelid WHERE m.channelid = ? ORDER BY m.timestamp DESC LIMIT ?",
-func (r *DBService) GetMessagesInChannel(channelid Id, number uint) ([]Message, error) {
-	rows, err := r.conn.Query(
-		"SELECT m.messageid, m.channelid, m.userid, m.contents, m.timestamp, m.editted, m.edittimestamp, c.serverid FROM ChannelMessageTable m JOIN ChannelTable c on m.channelid = c.channelid WHERE m.channelid = ? ORDER BY m.timestamp DESC LIMIT ?",
-		channelid,
-		number,
-	)
+func (r *DBService) queryMessages(query string, args ...any) ([]Message, error) {
+	rows, err := r.conn.Query(query, args...)
 	if err != nil {
 		return []Message{}, err
 	}
-	defer rows.Close()
 	var messages []Message
 	for rows.Next() {
-		var message Message
-		err := rows.Scan(
-			&message.MessageId,
-			&message.ChannelId,
-			&message.UserId,
-			&message.Contents,
-			&message.Timestamp,
-			&message.Editted,
-			&message.EdittedTimeStamp,
-			&message.ServerId,
-		)
+		message, err := scanMessage(rows)
 		if err != nil {
+			rows.Close()
 			return []Message{}, err
 		}
 		messages = append(messages, message)
 	}
+	// rows must be released before issuing the follow up attachment query
+	rows.Close()
+	err = r.loadAttachments(messages)
+	if err != nil {
+		return []Message{}, err
+	}
+	err = r.loadEmbeds(messages)
+	if err != nil {
+		return []Message{}, err
+	}
+	err = r.loadWebhookAuthors(messages)
+	if err != nil {
+		return []Message{}, err
+	}
 	return messages, nil
 }
 
+// GetMessagesInChannel returns the newest top level messages of a channel.
+// Thread replies are only returned through GetThreadMessages.
+func (r *DBService) GetMessagesInChannel(channelid Id, number uint) ([]Message, error) {
+	return r.queryMessages(
+		messageSelect+" WHERE m.channelid = ? AND m.threadid IS NULL ORDER BY m.timestamp DESC LIMIT ?",
+		channelid,
+		number,
+	)
+}
+
 func (r *DBService) GetUsersInChannel(channelid Id) ([]User, error) {
 	rows, err := r.conn.Query(
-		"SELECT U.userid, U.username FROM UsersChannelTable as UC INNER JOIN UserTable as U ON UC.userid = U.userid WHERE UC.channelid = ?",
+		"SELECT "+userColumns+" FROM UsersChannelTable as UC INNER JOIN UserTable as U ON UC.userid = U.userid WHERE UC.channelid = ?",
 		channelid,
 	)
 	if err != nil {
@@ -671,8 +824,7 @@ func (r *DBService) GetUsersInChannel(channelid Id) ([]User, error) {
 	defer rows.Close()
 	var names []User
 	for rows.Next() {
-		var name User
-		err := rows.Scan(&name.UserId, &name.UserName)
+		name, err := scanUser(rows)
 		if err != nil {
 			return []User{}, err
 		}
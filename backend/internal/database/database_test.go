@@ -10,6 +10,8 @@ import (
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+
+	"go-chat-react/internal/markdown"
 )
 
 func loadDB(filename string, schemafile string, datafile string) (*sql.DB, error) {
@@ -59,7 +61,7 @@ func Test_DeleteMessage(t *testing.T) {
 	if err != nil {
 		t.Fatalf("TestA: err: %v", err)
 	}
-	err = db.DeleteMessage(id)
+	_, err = db.DeleteMessage(id)
 	if err != nil {
 		t.Fatalf("TestA: err: %v", err)
 	}
@@ -125,6 +127,41 @@ func Test_UpdateMessage(t *testing.T) {
 	}
 }
 
+func Test_MessageAST(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	id, err := db.AddMessage(1, 1, "**bold**")
+	if err != nil {
+		t.Fatalf("AddMessage: err: %v", err)
+	}
+	message, err := db.GetMessage(id)
+	if err != nil {
+		t.Fatalf("GetMessage: err: %v", err)
+	}
+	if len(message.AST) != 1 || message.AST[0].Type != markdown.TypeBold {
+		t.Fatalf("GetMessage: unexpected ast %+v", message.AST)
+	}
+	err = db.UpdateMessage(id, "`code`")
+	if err != nil {
+		t.Fatalf("UpdateMessage: err: %v", err)
+	}
+	message, err = db.GetMessage(id)
+	if err != nil {
+		t.Fatalf("GetMessage: err: %v", err)
+	}
+	if len(message.AST) != 1 || message.AST[0].Type != markdown.TypeCode {
+		t.Fatalf("UpdateMessage: expected ast to be reparsed got %+v", message.AST)
+	}
+	// mock messages have no stored ast and are parsed on read
+	message, err = db.GetMessage(1)
+	if err != nil {
+		t.Fatalf("GetMessage: err: %v", err)
+	}
+	if len(message.AST) != 1 || message.AST[0].Content != message.Contents {
+		t.Fatalf("GetMessage: unexpected ast %+v", message.AST)
+	}
+}
+
 func Test_GetUser(t *testing.T) {
 	db := setup()
 	expectedUsername := "u1"
@@ -0,0 +1,246 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// inTx runs fn inside a transaction, committing when it returns nil.
+func (r *DBService) inTx(fn func(tx *DBService) error) error {
+	a, err := r.Atomic(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(a.Service()); err != nil {
+		a.Rollback()
+		return err
+	}
+	return a.Commit()
+}
+
+// createDirectMessageChannel inserts the channel row and conversation record
+// of a new DM and adds every participant to it.
+func (r *DBService) createDirectMessageChannel(
+	ownerid Id,
+	participants []Id,
+	name string,
+	group bool,
+	dmkey *string,
+) (Id, error) {
+	var channelid Id
+	err := r.inTx(func(tx *DBService) error {
+		// the channel of a conversation belongs to no server, it only
+		// shares the regular message, membership and history tables
+		d, err := tx.conn.Exec(
+			"INSERT INTO ChannelTable (serverid, channelname) VALUES (NULL, ?)",
+			"dm-"+uuid.New().String(),
+		)
+		if err != nil {
+			return err
+		}
+		id, err := d.LastInsertId()
+		if err != nil {
+			return err
+		}
+		channelid = Id(id)
+		_, err = tx.conn.Exec(
+			"INSERT INTO DirectMessageTable (channelid, ownerid, name, isgroup, dmkey) VALUES (?, ?, ?, ?, ?)",
+			channelid,
+			ownerid,
+			name,
+			group,
+			dmkey,
+		)
+		if err != nil {
+			if isConstraintError(err) {
+				return ErrRecordAlreadyExists
+			}
+			return fmt.Errorf("add direct message - ownerid: %d err: %w", ownerid, err)
+		}
+		for _, userid := range participants {
+			if err := tx.AddUserToChannel(userid, channelid); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return channelid, nil
+}
+
+func directMessageKey(a Id, b Id) string {
+	if a > b {
+		a, b = b, a
+	}
+	return fmt.Sprintf("%d:%d", a, b)
+}
+
+// OpenDirectMessage returns the one to one conversation between two users,
+// creating it on first use.
+func (r *DBService) OpenDirectMessage(userid Id, otherid Id) (Id, error) {
+	key := directMessageKey(userid, otherid)
+	lookup := func() (Id, error) {
+		var channelid Id
+		err := r.conn.QueryRowContext(
+			context.Background(),
+			"SELECT channelid FROM DirectMessageTable WHERE dmkey = ?",
+			key,
+		).Scan(&channelid)
+		return channelid, err
+	}
+	if channelid, err := lookup(); err == nil {
+		return channelid, nil
+	}
+	participants := []Id{userid}
+	if otherid != userid {
+		participants = append(participants, otherid)
+	}
+	channelid, err := r.createDirectMessageChannel(userid, participants, "", false, &key)
+	if errors.Is(err, ErrRecordAlreadyExists) {
+		// lost a race with the other participant opening the same DM
+		return lookup()
+	}
+	return channelid, err
+}
+
+// CreateGroupDirectMessage starts a new group conversation owned by ownerid.
+// The owner is always a participant.
+func (r *DBService) CreateGroupDirectMessage(ownerid Id, participants []Id, name string) (Id, error) {
+	members := []Id{ownerid}
+	for _, userid := range participants {
+		if userid != ownerid {
+			members = append(members, userid)
+		}
+	}
+	return r.createDirectMessageChannel(ownerid, members, name, true, nil)
+}
+
+const directMessageSelect = `SELECT d.channelid, d.ownerid, d.name, d.isgroup, d.timestamp,
+	(SELECT MAX(m.messageid) FROM ChannelMessageTable m WHERE m.channelid = d.channelid AND m.threadid IS NULL)
+	FROM DirectMessageTable d`
+
+// queryDirectMessages loads conversations together with their participants
+// and most recent message.
+func (r *DBService) queryDirectMessages(query string, args ...any) ([]DirectMessage, error) {
+	rows, err := r.conn.Query(query, args...)
+	if err != nil {
+		return []DirectMessage{}, err
+	}
+	var dms []DirectMessage
+	var lastids []any
+	for rows.Next() {
+		var dm DirectMessage
+		var lastid *Id
+		err := rows.Scan(&dm.ChannelId, &dm.OwnerId, &dm.Name, &dm.IsGroup, &dm.Timestamp, &lastid)
+		if err != nil {
+			rows.Close()
+			return []DirectMessage{}, err
+		}
+		if lastid != nil {
+			lastids = append(lastids, *lastid)
+		}
+		dms = append(dms, dm)
+	}
+	rows.Close()
+	if len(dms) == 0 {
+		return dms, nil
+	}
+
+	index := make(map[Id]int, len(dms))
+	channelids := make([]any, len(dms))
+	for i, dm := range dms {
+		index[dm.ChannelId] = i
+		channelids[i] = dm.ChannelId
+	}
+	rows, err = r.conn.Query(
+		"SELECT UC.channelid, "+userColumns+" FROM UsersChannelTable as UC INNER JOIN UserTable as U ON UC.userid = U.userid WHERE UC.channelid IN ("+placeholders(len(channelids))+") ORDER BY UC.rowid",
+		channelids...,
+	)
+	if err != nil {
+		return []DirectMessage{}, err
+	}
+	for rows.Next() {
+		var channelid Id
+		var user User
+		if err := rows.Scan(append([]any{&channelid}, user.scanFields()...)...); err != nil {
+			rows.Close()
+			return []DirectMessage{}, err
+		}
+		i := index[channelid]
+		dms[i].Participants = append(dms[i].Participants, user)
+	}
+	rows.Close()
+
+	if len(lastids) > 0 {
+		messages, err := r.queryMessages(
+			messageSelect+" WHERE m.messageid IN ("+placeholders(len(lastids))+")",
+			lastids...,
+		)
+		if err != nil {
+			return []DirectMessage{}, err
+		}
+		for _, message := range messages {
+			i := index[message.ChannelId]
+			dms[i].LastMessage = &message
+		}
+	}
+	return dms, nil
+}
+
+func (r *DBService) GetDirectMessage(channelid Id) (DirectMessage, error) {
+	dms, err := r.queryDirectMessages(directMessageSelect+" WHERE d.channelid = ?", channelid)
+	if err != nil {
+		return DirectMessage{}, err
+	}
+	if len(dms) == 0 {
+		return DirectMessage{}, ErrRecordNotFound
+	}
+	return dms[0], nil
+}
+
+// GetDirectMessagesOfUser lists the conversations a user takes part in,
+// most recently active first.
+func (r *DBService) GetDirectMessagesOfUser(userid Id) ([]DirectMessage, error) {
+	dms, err := r.queryDirectMessages(
+		directMessageSelect+" JOIN UsersChannelTable uc ON uc.channelid = d.channelid WHERE uc.userid = ?",
+		userid,
+	)
+	if err != nil {
+		return []DirectMessage{}, err
+	}
+	sort.SliceStable(dms, func(i, j int) bool {
+		return dms[i].lastActivity().After(dms[j].lastActivity())
+	})
+	return dms, nil
+}
+
+// UpdateDirectMessageOwner hands a group conversation over to a new owner.
+func (r *DBService) UpdateDirectMessageOwner(channelid Id, ownerid Id) error {
+	result, err := r.conn.Exec(
+		"UPDATE DirectMessageTable SET ownerid = ? WHERE channelid = ?",
+		ownerid,
+		channelid,
+	)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func Test_OpenDirectMessage(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	channelid, err := db.OpenDirectMessage(1, 3)
+	if err != nil {
+		t.Fatalf("OpenDirectMessage: err: %v", err)
+	}
+	again, err := db.OpenDirectMessage(3, 1)
+	if err != nil {
+		t.Fatalf("OpenDirectMessage: err: %v", err)
+	}
+	if again != channelid {
+		t.Fatalf("OpenDirectMessage: expected existing conversation %d got %d", channelid, again)
+	}
+	for _, userid := range []Id{1, 3} {
+		inchannel, err := db.IsUserInChannel(userid, channelid)
+		if err != nil || !inchannel {
+			t.Fatalf("IsUserInChannel: expected user %d in dm, err: %v", userid, err)
+		}
+	}
+	channel, err := db.GetChannel(channelid)
+	if err != nil {
+		t.Fatalf("GetChannel: err: %v", err)
+	}
+	if !channel.IsDirectMessage() {
+		t.Fatalf("GetChannel: expected dm channel got server %d", channel.ServerId)
+	}
+	// the channel must not reference a server that does not exist
+	var violations int
+	err = db.conn.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM pragma_foreign_key_check('ChannelTable')").Scan(&violations)
+	if err != nil || violations != 0 {
+		t.Fatalf("foreign_key_check: expected no violations got %d, err: %v", violations, err)
+	}
+}
+
+func Test_GetDirectMessagesOfUser(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	first, err := db.OpenDirectMessage(1, 2)
+	if err != nil {
+		t.Fatalf("OpenDirectMessage: err: %v", err)
+	}
+	group, err := db.CreateGroupDirectMessage(1, []Id{2, 3, 1}, "friends")
+	if err != nil {
+		t.Fatalf("CreateGroupDirectMessage: err: %v", err)
+	}
+	if _, err := db.AddMessage(first, 2, "hello"); err != nil {
+		t.Fatalf("AddMessage: err: %v", err)
+	}
+	dms, err := db.GetDirectMessagesOfUser(1)
+	if err != nil {
+		t.Fatalf("GetDirectMessagesOfUser: err: %v", err)
+	}
+	if len(dms) != 2 {
+		t.Fatalf("GetDirectMessagesOfUser: expected 2 got %d", len(dms))
+	}
+	if dms[0].ChannelId != first || dms[0].LastMessage == nil || dms[0].LastMessage.Contents != "hello" {
+		t.Fatalf("GetDirectMessagesOfUser: expected active dm first got %+v", dms[0])
+	}
+	if dms[1].ChannelId != group || !dms[1].IsGroup || dms[1].Name != "friends" {
+		t.Fatalf("GetDirectMessagesOfUser: unexpected group %+v", dms[1])
+	}
+	if len(dms[1].Participants) != 3 || dms[1].LastMessage != nil {
+		t.Fatalf("GetDirectMessagesOfUser: unexpected group participants %+v", dms[1].Participants)
+	}
+
+	dms, err = db.GetDirectMessagesOfUser(3)
+	if err != nil {
+		t.Fatalf("GetDirectMessagesOfUser: err: %v", err)
+	}
+	if len(dms) != 1 || dms[0].ChannelId != group {
+		t.Fatalf("GetDirectMessagesOfUser: expected only the group got %+v", dms)
+	}
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GetLinkPreview returns the cached preview of url if it was fetched within
+// maxAge, otherwise ErrRecordNotFound.
+func (r *DBService) GetLinkPreview(url string, maxAge time.Duration) (LinkPreview, error) {
+	rows, err := r.conn.Query(
+		"SELECT url, title, description, sitename, imageurl, timestamp FROM LinkPreviewTable WHERE url = ? AND timestamp > strftime('%Y-%m-%d %H:%M:%f', 'now', ?)",
+		url,
+		fmt.Sprintf("-%d seconds", int64(maxAge.Seconds())),
+	)
+	if err != nil {
+		return LinkPreview{}, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return LinkPreview{}, ErrRecordNotFound
+	}
+	var preview LinkPreview
+	err = rows.Scan(
+		&preview.URL,
+		&preview.Title,
+		&preview.Description,
+		&preview.SiteName,
+		&preview.ImageURL,
+		&preview.Timestamp,
+	)
+	return preview, err
+}
+
+// SaveLinkPreview stores or refreshes the cached preview of a URL.
+func (r *DBService) SaveLinkPreview(preview LinkPreview) error {
+	_, err := r.conn.Exec(
+		"INSERT OR REPLACE INTO LinkPreviewTable (url, title, description, sitename, imageurl) VALUES (?, ?, ?, ?, ?)",
+		preview.URL,
+		preview.Title,
+		preview.Description,
+		preview.SiteName,
+		preview.ImageURL,
+	)
+	if err != nil {
+		return fmt.Errorf("save link preview - url: %s err: %w", preview.URL, err)
+	}
+	return nil
+}
+
+// AddMessageEmbed attaches the cached preview of url to a message. Embeds
+// keep the order they were added in.
+func (r *DBService) AddMessageEmbed(messageid Id, url string) error {
+	_, err := r.conn.Exec(
+		"INSERT OR IGNORE INTO MessageEmbedTable (messageid, position, url) SELECT ?, COUNT(*), ? FROM MessageEmbedTable WHERE messageid = ?",
+		messageid,
+		url,
+		messageid,
+	)
+	if err != nil {
+		return fmt.Errorf("add embed - messageid: %d err: %w", messageid, err)
+	}
+	return nil
+}
+
+// loadEmbeds fills in the Embeds of every message in place.
+func (r *DBService) loadEmbeds(messages []Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	index := make(map[Id]int, len(messages))
+	args := make([]any, len(messages))
+	for i, message := range messages {
+		index[message.MessageId] = i
+		args[i] = message.MessageId
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(messages)), ", ")
+	rows, err := r.conn.Query(
+		"SELECT e.messageid, p.url, p.title, p.description, p.sitename, p.imageurl, p.timestamp FROM MessageEmbedTable e JOIN LinkPreviewTable p ON e.url = p.url WHERE e.messageid IN ("+placeholders+") ORDER BY e.messageid, e.position",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var messageid Id
+		var preview LinkPreview
+		err := rows.Scan(
+			&messageid,
+			&preview.URL,
+			&preview.Title,
+			&preview.Description,
+			&preview.SiteName,
+			&preview.ImageURL,
+			&preview.Timestamp,
+		)
+		if err != nil {
+			return err
+		}
+		i := index[messageid]
+		messages[i].Embeds = append(messages[i].Embeds, preview)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_LinkPreviewCache(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	_, err := db.GetLinkPreview("https://example.com", time.Hour)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("GetLinkPreview: expected ErrRecordNotFound got %v", err)
+	}
+	err = db.SaveLinkPreview(LinkPreview{URL: "https://example.com", Title: "Example"})
+	if err != nil {
+		t.Fatalf("SaveLinkPreview: err: %v", err)
+	}
+	preview, err := db.GetLinkPreview("https://example.com", time.Hour)
+	if err != nil {
+		t.Fatalf("GetLinkPreview: err: %v", err)
+	}
+	if preview.Title != "Example" {
+		t.Fatalf("GetLinkPreview: unexpected preview %+v", preview)
+	}
+	_, err = db.conn.Exec("UPDATE LinkPreviewTable SET timestamp = '2000-01-01 00:00:00.000'")
+	if err != nil {
+		t.Fatalf("Exec: err: %v", err)
+	}
+	_, err = db.GetLinkPreview("https://example.com", time.Hour)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("GetLinkPreview: expected stale preview to be ignored got %v", err)
+	}
+}
+
+func Test_MessageEmbeds(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	for _, url := range []string{"https://b.com", "https://a.com"} {
+		if err := db.SaveLinkPreview(LinkPreview{URL: url, Title: url}); err != nil {
+			t.Fatalf("SaveLinkPreview: err: %v", err)
+		}
+		if err := db.AddMessageEmbed(1, url); err != nil {
+			t.Fatalf("AddMessageEmbed: err: %v", err)
+		}
+	}
+	if err := db.AddMessageEmbed(1, "https://b.com"); err != nil {
+		t.Fatalf("AddMessageEmbed: err: %v", err)
+	}
+	message, err := db.GetMessage(1)
+	if err != nil {
+		t.Fatalf("GetMessage: err: %v", err)
+	}
+	if len(message.Embeds) != 2 || message.Embeds[0].URL != "https://b.com" {
+		t.Fatalf("GetMessage: unexpected embeds %+v", message.Embeds)
+	}
+	if _, err := db.DeleteMessage(1); err != nil {
+		t.Fatalf("DeleteMessage: err: %v", err)
+	}
+	var count int
+	if err := db.db.QueryRow("SELECT COUNT(*) FROM MessageEmbedTable").Scan(&count); err != nil {
+		t.Fatalf("QueryRow: err: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("DeleteMessage: expected embeds to be removed, %d left", count)
+	}
+}
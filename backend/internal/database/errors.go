@@ -11,6 +11,7 @@ var (
 	ErrRecordAlreadyExists = errors.New("already exists")
 	ErrUserAlreadyExists   = errors.New("user already exists")
 	ErrNegativeRowIndex    = errors.New("negative row index")
+	ErrLimitReached        = errors.New("limit reached")
 )
 
 // type conversion errors
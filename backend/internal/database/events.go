@@ -0,0 +1,257 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const eventEndpointSelect = "SELECT endpointid, serverid, creatorid, url, secret, events, enabled, failures, created FROM EventEndpointTable"
+
+func scanEventEndpoint(row rowScanner) (EventEndpoint, error) {
+	var endpoint EventEndpoint
+	var events string
+	err := row.Scan(
+		&endpoint.EndpointId,
+		&endpoint.ServerId,
+		&endpoint.CreatorId,
+		&endpoint.URL,
+		&endpoint.Secret,
+		&events,
+		&endpoint.Enabled,
+		&endpoint.Failures,
+		&endpoint.Created,
+	)
+	endpoint.Events = strings.Fields(events)
+	return endpoint, err
+}
+
+func (r *DBService) CreateEventEndpoint(endpoint EventEndpoint) (Id, error) {
+	result, err := r.conn.Exec(
+		"INSERT INTO EventEndpointTable (serverid, creatorid, url, secret, events) VALUES (?, ?, ?, ?, ?)",
+		endpoint.ServerId,
+		endpoint.CreatorId,
+		endpoint.URL,
+		endpoint.Secret,
+		strings.Join(endpoint.Events, " "),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("create endpoint - serverid: %d err: %w", endpoint.ServerId, err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return Id(id), nil
+}
+
+func (r *DBService) GetEventEndpoint(endpointid Id) (EventEndpoint, error) {
+	endpoint, err := scanEventEndpoint(r.conn.QueryRowContext(
+		context.Background(),
+		eventEndpointSelect+" WHERE endpointid = ?",
+		endpointid,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return EventEndpoint{}, ErrRecordNotFound
+	}
+	return endpoint, err
+}
+
+func (r *DBService) GetEventEndpointsOfServer(serverid Id) ([]EventEndpoint, error) {
+	rows, err := r.conn.Query(eventEndpointSelect+" WHERE serverid = ? ORDER BY endpointid", serverid)
+	if err != nil {
+		return []EventEndpoint{}, err
+	}
+	defer rows.Close()
+	var endpoints []EventEndpoint
+	for rows.Next() {
+		endpoint, err := scanEventEndpoint(rows)
+		if err != nil {
+			return []EventEndpoint{}, err
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints, nil
+}
+
+// UpdateEventEndpoint changes the subscriptions of an endpoint and turns it
+// on or off. Enabling an endpoint clears its failure count.
+func (r *DBService) UpdateEventEndpoint(endpointid Id, url string, events []string, enabled bool) error {
+	result, err := r.conn.Exec(
+		"UPDATE EventEndpointTable SET url = ?, events = ?, enabled = ?, failures = CASE WHEN ? THEN 0 ELSE failures END WHERE endpointid = ?",
+		url,
+		strings.Join(events, " "),
+		enabled,
+		enabled,
+		endpointid,
+	)
+	if err != nil {
+		return fmt.Errorf("update endpoint - endpointid: %d err: %w", endpointid, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteEventEndpoint removes an endpoint together with its delivery log.
+func (r *DBService) DeleteEventEndpoint(endpointid Id) error {
+	result, err := r.conn.Exec("DELETE FROM EventEndpointTable WHERE endpointid = ?", endpointid)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// EnqueueEvent queues payload for every enabled endpoint of the server that
+// subscribed to event and returns how many deliveries were queued.
+func (r *DBService) EnqueueEvent(serverid Id, event string, payload string, now time.Time) (int64, error) {
+	result, err := r.conn.Exec(
+		`INSERT INTO EventDeliveryTable (endpointid, event, payload, nextattempt)
+			SELECT endpointid, ?, ?, ? FROM EventEndpointTable
+			WHERE serverid = ? AND enabled = 1 AND ' ' || events || ' ' LIKE '% ' || ? || ' %'`,
+		event,
+		payload,
+		now.UTC(),
+		serverid,
+		event,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("enqueue event - serverid: %d err: %w", serverid, err)
+	}
+	return result.RowsAffected()
+}
+
+const eventDeliverySelect = "SELECT d.deliveryid, d.endpointid, d.event, d.payload, d.status, d.attempts, d.nextattempt, d.lastattempt, d.responsecode, d.error, d.created FROM EventDeliveryTable d"
+
+func (r *DBService) queryEventDeliveries(query string, args ...any) ([]EventDelivery, error) {
+	rows, err := r.conn.Query(query, args...)
+	if err != nil {
+		return []EventDelivery{}, err
+	}
+	defer rows.Close()
+	var deliveries []EventDelivery
+	for rows.Next() {
+		var delivery EventDelivery
+		err := rows.Scan(
+			&delivery.DeliveryId,
+			&delivery.EndpointId,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttempt,
+			&delivery.LastAttempt,
+			&delivery.ResponseCode,
+			&delivery.Error,
+			&delivery.Created,
+		)
+		if err != nil {
+			return []EventDelivery{}, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// GetDueEventDeliveries returns pending deliveries of enabled endpoints
+// whose next attempt is due, oldest first.
+func (r *DBService) GetDueEventDeliveries(now time.Time, limit uint) ([]EventDelivery, error) {
+	return r.queryEventDeliveries(
+		eventDeliverySelect+` JOIN EventEndpointTable e ON e.endpointid = d.endpointid
+			WHERE d.status = ? AND d.nextattempt <= ? AND e.enabled = 1
+			ORDER BY d.nextattempt, d.deliveryid LIMIT ?`,
+		EventDeliveryPending,
+		now.UTC(),
+		limit,
+	)
+}
+
+// GetEventDeliveries returns the delivery log of an endpoint, newest first.
+func (r *DBService) GetEventDeliveries(endpointid Id, limit uint) ([]EventDelivery, error) {
+	return r.queryEventDeliveries(
+		eventDeliverySelect+" WHERE d.endpointid = ? ORDER BY d.deliveryid DESC LIMIT ?",
+		endpointid,
+		limit,
+	)
+}
+
+// RecordEventDeliveryAttempt stores the outcome of an attempt. A success
+// resets the failure count of the endpoint, a failure increments it and
+// disables the endpoint once it reaches disableAfter, which is reported
+// back to the caller.
+func (r *DBService) RecordEventDeliveryAttempt(delivery EventDelivery, succeeded bool, disableAfter int) (bool, error) {
+	disabled := false
+	err := r.inTx(func(tx *DBService) error {
+		var lastattempt any
+		if delivery.LastAttempt != nil {
+			lastattempt = delivery.LastAttempt.UTC()
+		}
+		_, err := tx.conn.Exec(
+			"UPDATE EventDeliveryTable SET status = ?, attempts = ?, nextattempt = ?, lastattempt = ?, responsecode = ?, error = ? WHERE deliveryid = ?",
+			delivery.Status,
+			delivery.Attempts,
+			delivery.NextAttempt.UTC(),
+			lastattempt,
+			delivery.ResponseCode,
+			delivery.Error,
+			delivery.DeliveryId,
+		)
+		if err != nil {
+			return fmt.Errorf("record delivery - deliveryid: %d err: %w", delivery.DeliveryId, err)
+		}
+		if succeeded {
+			_, err = tx.conn.Exec("UPDATE EventEndpointTable SET failures = 0 WHERE endpointid = ?", delivery.EndpointId)
+			return err
+		}
+		var failures int
+		err = tx.conn.QueryRowContext(
+			context.Background(),
+			"UPDATE EventEndpointTable SET failures = failures + 1 WHERE endpointid = ? RETURNING failures",
+			delivery.EndpointId,
+		).Scan(&failures)
+		if err != nil {
+			return err
+		}
+		if failures >= disableAfter {
+			result, err := tx.conn.Exec(
+				"UPDATE EventEndpointTable SET enabled = 0 WHERE endpointid = ? AND enabled = 1",
+				delivery.EndpointId,
+			)
+			if err != nil {
+				return err
+			}
+			rowsAffected, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			disabled = rowsAffected > 0
+		}
+		return nil
+	})
+	return disabled, err
+}
+
+// PruneEventDeliveries drops finished deliveries created before cutoff.
+func (r *DBService) PruneEventDeliveries(before time.Time) error {
+	_, err := r.conn.Exec(
+		"DELETE FROM EventDeliveryTable WHERE status != ? AND created < ?",
+		EventDeliveryPending,
+		before.UTC(),
+	)
+	return err
+}
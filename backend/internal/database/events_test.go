@@ -0,0 +1,94 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_EventDeliveries(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	now := time.Now()
+	endpointid, err := db.CreateEventEndpoint(EventEndpoint{
+		ServerId:  1,
+		CreatorId: 1,
+		URL:       "https://hooks.example.com",
+		Secret:    "secret",
+		Events:    []string{"message.created", "member.joined"},
+	})
+	if err != nil {
+		t.Fatalf("CreateEventEndpoint: err: %v", err)
+	}
+	if _, err := db.CreateEventEndpoint(EventEndpoint{ServerId: 1, CreatorId: 1, URL: "https://other.example.com", Events: []string{"message.deleted"}}); err != nil {
+		t.Fatalf("CreateEventEndpoint: err: %v", err)
+	}
+
+	queued, err := db.EnqueueEvent(1, "message.created", `{"n":1}`, now)
+	if err != nil || queued != 1 {
+		t.Fatalf("EnqueueEvent: expected 1 delivery got %d err: %v", queued, err)
+	}
+	if queued, _ := db.EnqueueEvent(1, "message", `{}`, now); queued != 0 {
+		t.Fatalf("EnqueueEvent: expected partial event names not to match got %d", queued)
+	}
+	if queued, _ := db.EnqueueEvent(2, "message.created", `{}`, now); queued != 0 {
+		t.Fatalf("EnqueueEvent: expected no deliveries for other servers got %d", queued)
+	}
+
+	if due, _ := db.GetDueEventDeliveries(now.Add(-time.Second), 10); len(due) != 0 {
+		t.Fatalf("GetDueEventDeliveries: expected nothing due yet got %+v", due)
+	}
+	due, err := db.GetDueEventDeliveries(now, 10)
+	if err != nil || len(due) != 1 || due[0].Payload != `{"n":1}` || due[0].EndpointId != endpointid {
+		t.Fatalf("GetDueEventDeliveries: unexpected deliveries %+v err: %v", due, err)
+	}
+
+	delivery := due[0]
+	delivery.Attempts = 1
+	delivery.LastAttempt = &now
+	delivery.NextAttempt = now.Add(time.Minute)
+	delivery.ResponseCode = 500
+	for i := range 2 {
+		disabled, err := db.RecordEventDeliveryAttempt(delivery, false, 2)
+		if err != nil || disabled != (i == 1) {
+			t.Fatalf("RecordEventDeliveryAttempt: attempt %d disabled: %v err: %v", i, disabled, err)
+		}
+	}
+	endpoint, err := db.GetEventEndpoint(endpointid)
+	if err != nil || endpoint.Enabled || endpoint.Failures != 2 || len(endpoint.Events) != 2 {
+		t.Fatalf("GetEventEndpoint: expected disabled endpoint got %+v err: %v", endpoint, err)
+	}
+	if due, _ := db.GetDueEventDeliveries(now.Add(time.Hour), 10); len(due) != 0 {
+		t.Fatalf("GetDueEventDeliveries: expected disabled endpoint to be skipped got %+v", due)
+	}
+	if queued, _ := db.EnqueueEvent(1, "member.joined", `{}`, now); queued != 0 {
+		t.Fatalf("EnqueueEvent: expected disabled endpoint to be skipped got %d", queued)
+	}
+
+	if err := db.UpdateEventEndpoint(endpointid, endpoint.URL, endpoint.Events, true); err != nil {
+		t.Fatalf("UpdateEventEndpoint: err: %v", err)
+	}
+	delivery.Status = EventDeliveryDelivered
+	delivery.ResponseCode = 200
+	if _, err := db.RecordEventDeliveryAttempt(delivery, true, 2); err != nil {
+		t.Fatalf("RecordEventDeliveryAttempt: err: %v", err)
+	}
+	endpoint, _ = db.GetEventEndpoint(endpointid)
+	if !endpoint.Enabled || endpoint.Failures != 0 {
+		t.Fatalf("GetEventEndpoint: expected enabled endpoint got %+v", endpoint)
+	}
+	log, err := db.GetEventDeliveries(endpointid, 10)
+	if err != nil || len(log) != 1 || log[0].Status != EventDeliveryDelivered || log[0].LastAttempt == nil {
+		t.Fatalf("GetEventDeliveries: unexpected log %+v err: %v", log, err)
+	}
+
+	if err := db.DeleteServer(1); err != nil {
+		t.Fatalf("DeleteServer: err: %v", err)
+	}
+	if _, err := db.GetEventEndpoint(endpointid); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("GetEventEndpoint: expected endpoint removed with server got %v", err)
+	}
+	if log, _ := db.GetEventDeliveries(endpointid, 10); len(log) != 0 {
+		t.Fatalf("GetEventDeliveries: expected log removed with endpoint got %+v", log)
+	}
+}
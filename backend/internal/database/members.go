@@ -0,0 +1,82 @@
+package database
+
+import "fmt"
+
+// effectiveNameColumn resolves the name shown for a user inside a server:
+// their nickname there, falling back to their display name and username. It
+// expects UserTable aliased as U and UsersServerTable as US.
+const effectiveNameColumn = "COALESCE(NULLIF(US.nickname, ''), NULLIF(U.displayname, ''), U.username)"
+
+// EffectiveName is the name shown for a user outside of any server.
+func (u User) EffectiveName() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	return u.UserName
+}
+
+func (r *DBService) GetServerMembers(serverid Id) ([]ServerMember, error) {
+	rows, err := r.conn.Query(
+		"SELECT "+userColumns+", US.nickname, "+effectiveNameColumn+" FROM UsersServerTable as US INNER JOIN UserTable as U ON US.userid = U.userid WHERE US.serverid = ? ORDER BY US.timestamp",
+		serverid,
+	)
+	if err != nil {
+		return []ServerMember{}, err
+	}
+	defer rows.Close()
+	var members []ServerMember
+	for rows.Next() {
+		member := ServerMember{ServerId: serverid}
+		err := rows.Scan(append(member.User.scanFields(), &member.Nickname, &member.EffectiveName)...)
+		if err != nil {
+			return []ServerMember{}, err
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// UpdateUserNickname sets the nickname of a member of a server, an empty
+// nickname clears it. The change is recorded in UserNicknameLogTable.
+func (r *DBService) UpdateUserNickname(userid Id, serverid Id, nickname string) error {
+	result, err := r.conn.Exec(
+		"UPDATE UsersServerTable SET nickname = ? WHERE userid = ? AND serverid = ?",
+		nickname,
+		userid,
+		serverid,
+	)
+	if err != nil {
+		return fmt.Errorf("update nickname - userid: %d err: %w", userid, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *DBService) GetRecentNicknames(userid Id, serverid Id, number uint) ([]UserNicknameLogEntry, error) {
+	rows, err := r.conn.Query(
+		"SELECT userid, serverid, nickname, timestamp FROM UserNicknameLogTable WHERE userid = ? AND serverid = ? ORDER BY timestamp DESC, id DESC LIMIT ?",
+		userid,
+		serverid,
+		number,
+	)
+	if err != nil {
+		return []UserNicknameLogEntry{}, err
+	}
+	defer rows.Close()
+	var names []UserNicknameLogEntry
+	for rows.Next() {
+		var name UserNicknameLogEntry
+		err := rows.Scan(&name.UserId, &name.ServerId, &name.Nickname, &name.Timestamp)
+		if err != nil {
+			return []UserNicknameLogEntry{}, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_UpdateUserNickname(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	if err := db.UpdateUserNickname(3, 1, "three"); err != nil {
+		t.Fatalf("UpdateUserNickname: err: %v", err)
+	}
+	if err := db.UpdateUserNickname(2, 1, "two"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("UpdateUserNickname: expected ErrRecordNotFound for non member got %v", err)
+	}
+	history, err := db.GetRecentNicknames(3, 1, 2)
+	if err != nil {
+		t.Fatalf("GetRecentNicknames: err: %v", err)
+	}
+	if len(history) != 2 || history[0].Nickname != "three" || history[1].Nickname != "31" {
+		t.Fatalf("GetRecentNicknames: unexpected history %+v", history)
+	}
+}
+
+func Test_GetServerMembers_EffectiveName(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	if err := db.UpdateUserNickname(1, 1, ""); err != nil {
+		t.Fatalf("UpdateUserNickname: err: %v", err)
+	}
+	if err := db.UpdateUserProfile(3, UserProfile{DisplayName: "Three"}); err != nil {
+		t.Fatalf("UpdateUserProfile: err: %v", err)
+	}
+	if err := db.UpdateUserNickname(3, 1, ""); err != nil {
+		t.Fatalf("UpdateUserNickname: err: %v", err)
+	}
+	members, err := db.GetServerMembers(1)
+	if err != nil {
+		t.Fatalf("GetServerMembers: err: %v", err)
+	}
+	expected := map[Id]string{1: "u1", 3: "Three"}
+	if len(members) != len(expected) {
+		t.Fatalf("GetServerMembers: expected %d members got %d", len(expected), len(members))
+	}
+	for _, member := range members {
+		if member.EffectiveName != expected[member.UserId] {
+			t.Fatalf("GetServerMembers: expected %q got %+v", expected[member.UserId], member)
+		}
+	}
+	message, err := db.GetMessage(4)
+	if err != nil {
+		t.Fatalf("GetMessage: err: %v", err)
+	}
+	if message.AuthorName != "Three" {
+		t.Fatalf("GetMessage: expected author name Three got %q", message.AuthorName)
+	}
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// PinMessage pins a message to its channel. It returns ErrRecordAlreadyExists
+// if the message is already pinned and ErrLimitReached if the channel has no
+// pin slots left.
+func (r *DBService) PinMessage(channelid Id, messageid Id, userid Id) error {
+	result, err := r.conn.Exec(
+		`INSERT INTO PinnedMessageTable (messageid, channelid, pinnedby)
+		SELECT ?, ?, ? WHERE (SELECT COUNT(1) FROM PinnedMessageTable WHERE channelid = ?) <
+			(SELECT pinlimit FROM ChannelTable WHERE channelid = ?)`,
+		messageid,
+		channelid,
+		userid,
+		channelid,
+		channelid,
+	)
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+		return ErrRecordAlreadyExists
+	}
+	if err != nil {
+		return fmt.Errorf("pin message - messageid: %d err: %w", messageid, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrLimitReached
+	}
+	return nil
+}
+
+func (r *DBService) UnpinMessage(channelid Id, messageid Id) error {
+	result, err := r.conn.Exec(
+		"DELETE FROM PinnedMessageTable WHERE channelid = ? AND messageid = ?",
+		channelid,
+		messageid,
+	)
+	if err != nil {
+		return fmt.Errorf("unpin message - messageid: %d err: %w", messageid, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetPinnedMessages returns the pins of a channel, most recently pinned first.
+func (r *DBService) GetPinnedMessages(channelid Id) ([]PinnedMessage, error) {
+	rows, err := r.conn.Query(
+		"SELECT messageid, pinnedby, timestamp FROM PinnedMessageTable WHERE channelid = ? ORDER BY timestamp DESC",
+		channelid,
+	)
+	if err != nil {
+		return []PinnedMessage{}, err
+	}
+	var pins []PinnedMessage
+	for rows.Next() {
+		var pin PinnedMessage
+		err := rows.Scan(&pin.MessageId, &pin.PinnedBy, &pin.PinnedAt)
+		if err != nil {
+			rows.Close()
+			return []PinnedMessage{}, err
+		}
+		pins = append(pins, pin)
+	}
+	rows.Close()
+	for i := range pins {
+		message, err := r.GetMessage(pins[i].MessageId)
+		if err != nil {
+			return []PinnedMessage{}, err
+		}
+		pins[i].Message = message
+	}
+	return pins, nil
+}
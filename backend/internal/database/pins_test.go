@@ -0,0 +1,81 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_PinMessage(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	err := db.PinMessage(1, 1, 2)
+	if err != nil {
+		t.Fatalf("PinMessage: err: %v", err)
+	}
+	err = db.PinMessage(1, 1, 2)
+	if !errors.Is(err, ErrRecordAlreadyExists) {
+		t.Fatalf("PinMessage: expected ErrRecordAlreadyExists got %v", err)
+	}
+	pins, err := db.GetPinnedMessages(1)
+	if err != nil {
+		t.Fatalf("GetPinnedMessages: err: %v", err)
+	}
+	if len(pins) != 1 {
+		t.Fatalf("GetPinnedMessages: expected 1 pin got %d", len(pins))
+	}
+	if pins[0].MessageId != 1 || pins[0].PinnedBy != 2 || pins[0].Contents != "1111" {
+		t.Fatalf("GetPinnedMessages: invalid pin %+v", pins[0])
+	}
+	err = db.UnpinMessage(1, 1)
+	if err != nil {
+		t.Fatalf("UnpinMessage: err: %v", err)
+	}
+	err = db.UnpinMessage(1, 1)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("UnpinMessage: expected ErrRecordNotFound got %v", err)
+	}
+}
+
+func Test_PinMessage_Limit(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	err := db.UpdateChannelPinLimit(1, 1)
+	if err != nil {
+		t.Fatalf("UpdateChannelPinLimit: err: %v", err)
+	}
+	channel, err := db.GetChannel(1)
+	if err != nil {
+		t.Fatalf("GetChannel: err: %v", err)
+	}
+	if channel.PinLimit != 1 {
+		t.Fatalf("UpdateChannelPinLimit: expected limit 1 got %d", channel.PinLimit)
+	}
+	err = db.PinMessage(1, 1, 1)
+	if err != nil {
+		t.Fatalf("PinMessage: err: %v", err)
+	}
+	err = db.PinMessage(1, 2, 1)
+	if !errors.Is(err, ErrLimitReached) {
+		t.Fatalf("PinMessage: expected ErrLimitReached got %v", err)
+	}
+}
+
+func Test_PinMessage_RemovedWithMessage(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	err := db.PinMessage(1, 2, 1)
+	if err != nil {
+		t.Fatalf("PinMessage: err: %v", err)
+	}
+	_, err = db.DeleteMessage(2)
+	if err != nil {
+		t.Fatalf("DeleteMessage: err: %v", err)
+	}
+	pins, err := db.GetPinnedMessages(1)
+	if err != nil {
+		t.Fatalf("GetPinnedMessages: err: %v", err)
+	}
+	if len(pins) != 0 {
+		t.Fatalf("GetPinnedMessages: expected no pins got %d", len(pins))
+	}
+}
@@ -0,0 +1,57 @@
+package database
+
+import "fmt"
+
+// userColumns selects every column of a User from UserTable aliased as U.
+const userColumns = "U.userid, U.username, U.displayname, U.avatarkey, U.bannercolor, U.bio, U.pronouns, U.isbot, U.botowner"
+
+func (u *User) scanFields() []any {
+	return []any{&u.UserId, &u.UserName, &u.DisplayName, &u.AvatarKey, &u.BannerColor, &u.Bio, &u.Pronouns, &u.IsBot, &u.BotOwnerId}
+}
+
+func scanUser(row rowScanner) (User, error) {
+	var user User
+	err := row.Scan(user.scanFields()...)
+	return user, err
+}
+
+// UpdateUserProfile replaces the editable profile fields of a user. The
+// avatar is managed separately through SetUserAvatar.
+func (r *DBService) UpdateUserProfile(userid Id, profile UserProfile) error {
+	result, err := r.conn.Exec(
+		"UPDATE UserTable SET displayname = ?, bannercolor = ?, bio = ?, pronouns = ? WHERE userid = ?",
+		profile.DisplayName,
+		profile.BannerColor,
+		profile.Bio,
+		profile.Pronouns,
+		userid,
+	)
+	if err != nil {
+		return fmt.Errorf("update profile - userid: %d err: %w", userid, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// SetUserAvatar stores the blob key of the avatar of a user, an empty key
+// removes the avatar.
+func (r *DBService) SetUserAvatar(userid Id, avatarkey string) error {
+	result, err := r.conn.Exec("UPDATE UserTable SET avatarkey = ? WHERE userid = ?", avatarkey, userid)
+	if err != nil {
+		return fmt.Errorf("set avatar - userid: %d err: %w", userid, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_UpdateUserProfile(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	profile := UserProfile{DisplayName: "One", BannerColor: "#112233", Bio: "hi", Pronouns: "she/her"}
+	if err := db.UpdateUserProfile(1, profile); err != nil {
+		t.Fatalf("UpdateUserProfile: err: %v", err)
+	}
+	if err := db.SetUserAvatar(1, "avatars/1/a"); err != nil {
+		t.Fatalf("SetUserAvatar: err: %v", err)
+	}
+	user, err := db.GetUser(1)
+	if err != nil {
+		t.Fatalf("GetUser: err: %v", err)
+	}
+	if user.DisplayName != "One" || user.BannerColor != "#112233" || user.Bio != "hi" ||
+		user.Pronouns != "she/her" || user.AvatarKey != "avatars/1/a" {
+		t.Fatalf("GetUser: unexpected profile %+v", user)
+	}
+	members, err := db.GetUsersOfServer(1)
+	if err != nil || len(members) == 0 {
+		t.Fatalf("GetUsersOfServer: err: %v", err)
+	}
+	for _, member := range members {
+		if member.UserId == 1 && member.DisplayName != "One" {
+			t.Fatalf("GetUsersOfServer: expected profile fields got %+v", member)
+		}
+	}
+	if err := db.UpdateUserProfile(99, profile); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("UpdateUserProfile: expected ErrRecordNotFound got %v", err)
+	}
+}
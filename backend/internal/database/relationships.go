@@ -0,0 +1,242 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func isConstraintError(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint
+}
+
+func (r *DBService) queryUsers(query string, args ...any) ([]User, error) {
+	rows, err := r.conn.Query(query, args...)
+	if err != nil {
+		return []User{}, err
+	}
+	defer rows.Close()
+	var users []User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return []User{}, err
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func (r *DBService) exists(query string, args ...any) (bool, error) {
+	var count int
+	err := r.conn.QueryRowContext(context.Background(), query, args...).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// SendFriendRequest records a pending request from senderid to receiverid.
+// If receiverid already asked senderid the two become friends instead and
+// accepted is returned as true. ErrRecordAlreadyExists is returned when the
+// request is pending or the users are already friends.
+func (r *DBService) SendFriendRequest(senderid Id, receiverid Id) (bool, error) {
+	if senderid == receiverid {
+		return false, fmt.Errorf("friend request - cannot befriend yourself")
+	}
+	friends, err := r.AreFriends(senderid, receiverid)
+	if err != nil {
+		return false, err
+	}
+	if friends {
+		return false, ErrRecordAlreadyExists
+	}
+	reverse, err := r.exists(
+		"SELECT COUNT(1) FROM FriendRequestTable WHERE senderid = ? AND receiverid = ?",
+		receiverid,
+		senderid,
+	)
+	if err != nil {
+		return false, err
+	}
+	if reverse {
+		return true, r.AcceptFriendRequest(senderid, receiverid)
+	}
+	_, err = r.conn.Exec(
+		"INSERT INTO FriendRequestTable (senderid, receiverid) VALUES (?, ?)",
+		senderid,
+		receiverid,
+	)
+	if isConstraintError(err) {
+		return false, ErrRecordAlreadyExists
+	}
+	if err != nil {
+		return false, fmt.Errorf("friend request - senderid: %d err: %w", senderid, err)
+	}
+	return false, nil
+}
+
+// AcceptFriendRequest turns the pending request sent by senderid to
+// receiverid into a friendship.
+func (r *DBService) AcceptFriendRequest(receiverid Id, senderid Id) error {
+	return r.inTx(func(tx *DBService) error {
+		if err := tx.DeleteFriendRequest(senderid, receiverid); err != nil {
+			return err
+		}
+		_, err := tx.conn.Exec(
+			"INSERT OR IGNORE INTO FriendTable (userid, friendid) VALUES (?, ?), (?, ?)",
+			senderid,
+			receiverid,
+			receiverid,
+			senderid,
+		)
+		return err
+	})
+}
+
+// DeleteFriendRequest removes a pending request, used both when the sender
+// cancels and when the receiver declines.
+func (r *DBService) DeleteFriendRequest(senderid Id, receiverid Id) error {
+	result, err := r.conn.Exec(
+		"DELETE FROM FriendRequestTable WHERE senderid = ? AND receiverid = ?",
+		senderid,
+		receiverid,
+	)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetFriendRequests returns the pending requests a user has sent or received.
+func (r *DBService) GetFriendRequests(userid Id) ([]FriendRequest, error) {
+	rows, err := r.conn.Query(
+		"SELECT senderid, receiverid, timestamp FROM FriendRequestTable WHERE senderid = ? OR receiverid = ? ORDER BY timestamp",
+		userid,
+		userid,
+	)
+	if err != nil {
+		return []FriendRequest{}, err
+	}
+	defer rows.Close()
+	var requests []FriendRequest
+	for rows.Next() {
+		var request FriendRequest
+		if err := rows.Scan(&request.SenderId, &request.ReceiverId, &request.Timestamp); err != nil {
+			return []FriendRequest{}, err
+		}
+		requests = append(requests, request)
+	}
+	return requests, nil
+}
+
+func (r *DBService) GetFriends(userid Id) ([]User, error) {
+	return r.queryUsers(
+		"SELECT "+userColumns+" FROM FriendTable as F INNER JOIN UserTable as U ON F.friendid = U.userid WHERE F.userid = ? ORDER BY U.username",
+		userid,
+	)
+}
+
+func (r *DBService) AreFriends(userid Id, otherid Id) (bool, error) {
+	return r.exists(
+		"SELECT COUNT(1) FROM FriendTable WHERE userid = ? AND friendid = ?",
+		userid,
+		otherid,
+	)
+}
+
+func (r *DBService) RemoveFriend(userid Id, friendid Id) error {
+	result, err := r.conn.Exec(
+		"DELETE FROM FriendTable WHERE (userid = ? AND friendid = ?) OR (userid = ? AND friendid = ?)",
+		userid,
+		friendid,
+		friendid,
+		userid,
+	)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// BlockUser blocks blockedid for userid, ending any friendship and pending
+// requests between them.
+func (r *DBService) BlockUser(userid Id, blockedid Id) error {
+	if userid == blockedid {
+		return fmt.Errorf("block user - cannot block yourself")
+	}
+	return r.inTx(func(tx *DBService) error {
+		_, err := tx.conn.Exec(
+			"INSERT INTO BlockTable (userid, blockedid) VALUES (?, ?)",
+			userid,
+			blockedid,
+		)
+		if isConstraintError(err) {
+			return ErrRecordAlreadyExists
+		}
+		if err != nil {
+			return fmt.Errorf("block user - userid: %d err: %w", userid, err)
+		}
+		for _, query := range []string{
+			"DELETE FROM FriendTable WHERE (userid = ? AND friendid = ?) OR (userid = ? AND friendid = ?)",
+			"DELETE FROM FriendRequestTable WHERE (senderid = ? AND receiverid = ?) OR (senderid = ? AND receiverid = ?)",
+		} {
+			if _, err := tx.conn.Exec(query, userid, blockedid, blockedid, userid); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *DBService) UnblockUser(userid Id, blockedid Id) error {
+	result, err := r.conn.Exec(
+		"DELETE FROM BlockTable WHERE userid = ? AND blockedid = ?",
+		userid,
+		blockedid,
+	)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *DBService) GetBlockedUsers(userid Id) ([]User, error) {
+	return r.queryUsers(
+		"SELECT "+userColumns+" FROM BlockTable as B INNER JOIN UserTable as U ON B.blockedid = U.userid WHERE B.userid = ? ORDER BY U.username",
+		userid,
+	)
+}
+
+// HasBlocked reports whether userid has blocked otherid.
+func (r *DBService) HasBlocked(userid Id, otherid Id) (bool, error) {
+	return r.exists(
+		"SELECT COUNT(1) FROM BlockTable WHERE userid = ? AND blockedid = ?",
+		userid,
+		otherid,
+	)
+}
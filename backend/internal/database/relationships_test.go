@@ -0,0 +1,109 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_FriendRequests(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	accepted, err := db.SendFriendRequest(1, 2)
+	if err != nil || accepted {
+		t.Fatalf("SendFriendRequest: expected pending request, accepted: %v err: %v", accepted, err)
+	}
+	if _, err := db.SendFriendRequest(1, 2); !errors.Is(err, ErrRecordAlreadyExists) {
+		t.Fatalf("SendFriendRequest: expected ErrRecordAlreadyExists got %v", err)
+	}
+	requests, err := db.GetFriendRequests(2)
+	if err != nil || len(requests) != 1 || requests[0].SenderId != 1 {
+		t.Fatalf("GetFriendRequests: unexpected %+v err: %v", requests, err)
+	}
+	if err := db.AcceptFriendRequest(2, 1); err != nil {
+		t.Fatalf("AcceptFriendRequest: err: %v", err)
+	}
+	for _, pair := range [][2]Id{{1, 2}, {2, 1}} {
+		friends, err := db.AreFriends(pair[0], pair[1])
+		if err != nil || !friends {
+			t.Fatalf("AreFriends: expected %d and %d to be friends, err: %v", pair[0], pair[1], err)
+		}
+	}
+	if err := db.AcceptFriendRequest(2, 1); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("AcceptFriendRequest: expected ErrRecordNotFound got %v", err)
+	}
+	if _, err := db.SendFriendRequest(2, 1); !errors.Is(err, ErrRecordAlreadyExists) {
+		t.Fatalf("SendFriendRequest: expected ErrRecordAlreadyExists for friends got %v", err)
+	}
+	if err := db.RemoveFriend(2, 1); err != nil {
+		t.Fatalf("RemoveFriend: err: %v", err)
+	}
+	friends, err := db.GetFriends(1)
+	if err != nil || len(friends) != 0 {
+		t.Fatalf("GetFriends: expected no friends got %+v err: %v", friends, err)
+	}
+}
+
+func Test_FriendRequests_Mutual(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	if _, err := db.SendFriendRequest(1, 3); err != nil {
+		t.Fatalf("SendFriendRequest: err: %v", err)
+	}
+	accepted, err := db.SendFriendRequest(3, 1)
+	if err != nil || !accepted {
+		t.Fatalf("SendFriendRequest: expected mutual request to be accepted, err: %v", err)
+	}
+	friends, err := db.GetFriends(3)
+	if err != nil || len(friends) != 1 || friends[0].UserId != 1 {
+		t.Fatalf("GetFriends: unexpected %+v err: %v", friends, err)
+	}
+	requests, err := db.GetFriendRequests(1)
+	if err != nil || len(requests) != 0 {
+		t.Fatalf("GetFriendRequests: expected no pending requests got %+v", requests)
+	}
+}
+
+func Test_BlockUser(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	if _, err := db.SendFriendRequest(1, 2); err != nil {
+		t.Fatalf("SendFriendRequest: err: %v", err)
+	}
+	if err := db.AcceptFriendRequest(2, 1); err != nil {
+		t.Fatalf("AcceptFriendRequest: err: %v", err)
+	}
+	if _, err := db.SendFriendRequest(3, 1); err != nil {
+		t.Fatalf("SendFriendRequest: err: %v", err)
+	}
+	for _, blocked := range []Id{2, 3} {
+		if err := db.BlockUser(1, blocked); err != nil {
+			t.Fatalf("BlockUser: err: %v", err)
+		}
+	}
+	if err := db.BlockUser(1, 2); !errors.Is(err, ErrRecordAlreadyExists) {
+		t.Fatalf("BlockUser: expected ErrRecordAlreadyExists got %v", err)
+	}
+	if friends, _ := db.AreFriends(1, 2); friends {
+		t.Fatalf("BlockUser: expected friendship to be removed")
+	}
+	if requests, _ := db.GetFriendRequests(1); len(requests) != 0 {
+		t.Fatalf("BlockUser: expected friend request to be removed got %+v", requests)
+	}
+	blocked, err := db.HasBlocked(1, 2)
+	if err != nil || !blocked {
+		t.Fatalf("HasBlocked: expected block, err: %v", err)
+	}
+	if blocked, _ := db.HasBlocked(2, 1); blocked {
+		t.Fatalf("HasBlocked: blocks should be one directional")
+	}
+	if err := db.UnblockUser(1, 2); err != nil {
+		t.Fatalf("UnblockUser: err: %v", err)
+	}
+	users, err := db.GetBlockedUsers(1)
+	if err != nil || len(users) != 1 || users[0].UserId != 3 {
+		t.Fatalf("GetBlockedUsers: unexpected %+v err: %v", users, err)
+	}
+	if err := db.UnblockUser(1, 2); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("UnblockUser: expected ErrRecordNotFound got %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const restrictionSelect = "SELECT restrictionid, serverid, channelid, userid, moderatorid, reason, expires, created FROM RestrictionTable"
+
+func scanRestriction(row rowScanner) (Restriction, error) {
+	var restriction Restriction
+	err := row.Scan(
+		&restriction.RestrictionId,
+		&restriction.ServerId,
+		&restriction.ChannelId,
+		&restriction.UserId,
+		&restriction.ModeratorId,
+		&restriction.Reason,
+		&restriction.Expires,
+		&restriction.Created,
+	)
+	return restriction, err
+}
+
+// SetRestriction times out or mutes a member, replacing the restriction
+// they had in the same place. Restrictions that expired before now are
+// cleared on the way.
+func (r *DBService) SetRestriction(restriction Restriction, now time.Time) (Id, error) {
+	var id Id
+	err := r.inTx(func(tx *DBService) error {
+		if _, err := tx.conn.Exec("DELETE FROM RestrictionTable WHERE expires <= ?", now.UTC()); err != nil {
+			return err
+		}
+		_, err := tx.conn.Exec(
+			`INSERT INTO RestrictionTable (serverid, channelid, userid, moderatorid, reason, expires) VALUES (?, ?, ?, ?, ?, ?)
+				ON CONFLICT(serverid, channelid, userid) DO UPDATE SET
+				moderatorid = excluded.moderatorid, reason = excluded.reason, expires = excluded.expires,
+				created = strftime('%Y-%m-%d %H:%M:%f', 'now')`,
+			restriction.ServerId,
+			restriction.ChannelId,
+			restriction.UserId,
+			restriction.ModeratorId,
+			restriction.Reason,
+			restriction.Expires.UTC(),
+		)
+		if err != nil {
+			return fmt.Errorf("set restriction - serverid: %d userid: %d err: %w", restriction.ServerId, restriction.UserId, err)
+		}
+		return tx.conn.QueryRowContext(
+			context.Background(),
+			"SELECT restrictionid FROM RestrictionTable WHERE serverid = ? AND channelid = ? AND userid = ?",
+			restriction.ServerId,
+			restriction.ChannelId,
+			restriction.UserId,
+		).Scan(&id)
+	})
+	return id, err
+}
+
+func (r *DBService) GetRestriction(restrictionid Id) (Restriction, error) {
+	restriction, err := scanRestriction(r.conn.QueryRowContext(
+		context.Background(),
+		restrictionSelect+" WHERE restrictionid = ?",
+		restrictionid,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Restriction{}, ErrRecordNotFound
+	}
+	return restriction, err
+}
+
+// GetActiveRestrictions returns the restrictions of a server that have not
+// expired by now, soonest to lift first.
+func (r *DBService) GetActiveRestrictions(serverid Id, now time.Time) ([]Restriction, error) {
+	rows, err := r.conn.Query(restrictionSelect+" WHERE serverid = ? AND expires > ? ORDER BY expires, restrictionid", serverid, now.UTC())
+	if err != nil {
+		return []Restriction{}, err
+	}
+	defer rows.Close()
+	var restrictions []Restriction
+	for rows.Next() {
+		restriction, err := scanRestriction(rows)
+		if err != nil {
+			return []Restriction{}, err
+		}
+		restrictions = append(restrictions, restriction)
+	}
+	return restrictions, rows.Err()
+}
+
+// GetPostingRestriction returns the restriction keeping a user from posting
+// in a channel at now, either a timeout in its server or a mute in the
+// channel. The one lifting last wins when both apply.
+func (r *DBService) GetPostingRestriction(userid Id, channelid Id, now time.Time) (Restriction, error) {
+	restriction, err := scanRestriction(r.conn.QueryRowContext(
+		context.Background(),
+		restrictionSelect+` WHERE userid = ? AND expires > ? AND (channelid = ? OR
+			(channelid = 0 AND serverid = (SELECT serverid FROM ChannelTable WHERE channelid = ?)))
+			ORDER BY expires DESC LIMIT 1`,
+		userid,
+		now.UTC(),
+		channelid,
+		channelid,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Restriction{}, ErrRecordNotFound
+	}
+	return restriction, err
+}
+
+// DeleteRestriction lifts a restriction before it expires.
+func (r *DBService) DeleteRestriction(restrictionid Id) error {
+	result, err := r.conn.Exec("DELETE FROM RestrictionTable WHERE restrictionid = ?", restrictionid)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func Test_Restrictions(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	now := time.Now()
+
+	muteid, err := db.SetRestriction(Restriction{ServerId: 1, ChannelId: 2, UserId: 3, ModeratorId: 1, Reason: "heated", Expires: now.Add(time.Hour)}, now)
+	if err != nil {
+		t.Fatalf("SetRestriction: err: %v", err)
+	}
+	if _, err := db.GetPostingRestriction(3, 1, now); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("GetPostingRestriction: expected a mute to leave other channels alone got err: %v", err)
+	}
+	mute, err := db.GetPostingRestriction(3, 2, now)
+	if err != nil || mute.RestrictionId != muteid || mute.Reason != "heated" || mute.Expires.Sub(now.Add(time.Hour)).Abs() > time.Millisecond {
+		t.Fatalf("GetPostingRestriction: unexpected restriction %+v err: %v", mute, err)
+	}
+	if _, err := db.GetPostingRestriction(3, 2, now.Add(2*time.Hour)); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("GetPostingRestriction: expected the mute to lift got err: %v", err)
+	}
+
+	timeoutid, err := db.SetRestriction(Restriction{ServerId: 1, UserId: 3, ModeratorId: 1, Expires: now.Add(time.Minute)}, now)
+	if err != nil {
+		t.Fatalf("SetRestriction: err: %v", err)
+	}
+	if timeout, err := db.GetPostingRestriction(3, 1, now); err != nil || timeout.RestrictionId != timeoutid {
+		t.Fatalf("GetPostingRestriction: expected the timeout in channel 1 got %+v err: %v", timeout, err)
+	}
+	// the mute lifts after the timeout, so it is the one reported
+	if restriction, _ := db.GetPostingRestriction(3, 2, now); restriction.RestrictionId != muteid {
+		t.Fatalf("GetPostingRestriction: expected the longer mute got %+v", restriction)
+	}
+	if _, err := db.GetPostingRestriction(2, 3, now); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("GetPostingRestriction: expected other servers to be unaffected got err: %v", err)
+	}
+
+	// restricting again replaces the restriction
+	again, err := db.SetRestriction(Restriction{ServerId: 1, UserId: 3, ModeratorId: 1, Reason: "longer", Expires: now.Add(3 * time.Hour)}, now)
+	if err != nil || again != timeoutid {
+		t.Fatalf("SetRestriction: expected the timeout to be replaced got %d err: %v", again, err)
+	}
+	active, err := db.GetActiveRestrictions(1, now)
+	if err != nil || len(active) != 2 || active[0].RestrictionId != muteid || active[1].Reason != "longer" {
+		t.Fatalf("GetActiveRestrictions: unexpected restrictions %+v err: %v", active, err)
+	}
+	if active, _ := db.GetActiveRestrictions(1, now.Add(2*time.Hour)); len(active) != 1 {
+		t.Fatalf("GetActiveRestrictions: expected the expired mute to be left out got %+v", active)
+	}
+
+	if err := db.DeleteRestriction(timeoutid); err != nil {
+		t.Fatalf("DeleteRestriction: err: %v", err)
+	}
+	if err := db.DeleteRestriction(timeoutid); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("DeleteRestriction: expected ErrRecordNotFound got %v", err)
+	}
+	// expired restrictions are cleared by the next one
+	if _, err := db.SetRestriction(Restriction{ServerId: 2, UserId: 1, ModeratorId: 2, Expires: now.Add(3 * time.Hour)}, now.Add(2*time.Hour)); err != nil {
+		t.Fatalf("SetRestriction: err: %v", err)
+	}
+	if _, err := db.GetRestriction(muteid); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("GetRestriction: expected the expired mute to be cleared got err: %v", err)
+	}
+
+	channelmute, err := db.SetRestriction(Restriction{ServerId: 1, ChannelId: 1, UserId: 3, ModeratorId: 1, Expires: now.Add(time.Hour)}, now)
+	if err != nil {
+		t.Fatalf("SetRestriction: err: %v", err)
+	}
+	if err := db.DeleteChannel(1); err != nil {
+		t.Fatalf("DeleteChannel: err: %v", err)
+	}
+	if _, err := db.GetRestriction(channelmute); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("GetRestriction: expected the mute to go with its channel got err: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"fmt"
+)
+
+// GetThreadMessages returns up to number replies of the thread rooted at
+// rootid, newest first. When before is non zero only replies with a smaller
+// message id are returned, which allows paging backwards through a thread.
+func (r *DBService) GetThreadMessages(rootid Id, before Id, number uint) ([]Message, error) {
+	if before == 0 {
+		return r.queryMessages(
+			messageSelect+" WHERE m.threadid = ? ORDER BY m.messageid DESC LIMIT ?",
+			rootid,
+			number,
+		)
+	}
+	return r.queryMessages(
+		messageSelect+" WHERE m.threadid = ? AND m.messageid < ? ORDER BY m.messageid DESC LIMIT ?",
+		rootid,
+		before,
+		number,
+	)
+}
+
+func (r *DBService) FollowThread(rootid Id, userid Id) error {
+	_, err := r.conn.Exec(
+		"INSERT OR IGNORE INTO ThreadFollowerTable (rootid, userid) VALUES (?, ?)",
+		rootid,
+		userid,
+	)
+	if err != nil {
+		return fmt.Errorf("follow thread - rootid: %d userid: %d err: %w", rootid, userid, err)
+	}
+	return nil
+}
+
+func (r *DBService) UnfollowThread(rootid Id, userid Id) error {
+	result, err := r.conn.Exec(
+		"DELETE FROM ThreadFollowerTable WHERE rootid = ? AND userid = ?",
+		rootid,
+		userid,
+	)
+	if err != nil {
+		return fmt.Errorf("unfollow thread - rootid: %d userid: %d err: %w", rootid, userid, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *DBService) GetThreadFollowers(rootid Id) ([]Id, error) {
+	rows, err := r.conn.Query("SELECT userid FROM ThreadFollowerTable WHERE rootid = ?", rootid)
+	if err != nil {
+		return []Id{}, err
+	}
+	defer rows.Close()
+	var followers []Id
+	for rows.Next() {
+		var userid Id
+		err := rows.Scan(&userid)
+		if err != nil {
+			return []Id{}, err
+		}
+		followers = append(followers, userid)
+	}
+	return followers, nil
+}
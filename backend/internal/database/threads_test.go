@@ -0,0 +1,191 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_CreateMessage_Reply(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	parentid := Id(1)
+	id, err := db.CreateMessage(NewMessage{ChannelId: 1, UserId: 1, Contents: "reply", ReplyToId: &parentid})
+	if err != nil {
+		t.Fatalf("CreateMessage: err: %v", err)
+	}
+	message, err := db.GetMessage(id)
+	if err != nil {
+		t.Fatalf("GetMessage: err: %v", err)
+	}
+	if message.ReplyTo == nil {
+		t.Fatalf("CreateMessage: reply reference missing")
+	}
+	if message.ReplyTo.Contents != "1111" || message.ReplyTo.Deleted {
+		t.Fatalf("CreateMessage: invalid reply reference %+v", message.ReplyTo)
+	}
+
+	_, err = db.DeleteMessage(parentid)
+	if err != nil {
+		t.Fatalf("DeleteMessage: err: %v", err)
+	}
+	message, err = db.GetMessage(id)
+	if err != nil {
+		t.Fatalf("GetMessage: err: %v", err)
+	}
+	if message.ReplyTo == nil || !message.ReplyTo.Deleted {
+		t.Fatalf("CreateMessage: expected deleted reply reference, got %+v", message.ReplyTo)
+	}
+	if message.ReplyTo.MessageId != parentid {
+		t.Fatalf("CreateMessage: expected parent id %d got %d", parentid, message.ReplyTo.MessageId)
+	}
+}
+
+func Test_ThreadSummary(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	rootid := Id(1)
+	var replies []Id
+	for _, contents := range []string{"a", "b", "c"} {
+		id, err := db.CreateMessage(NewMessage{ChannelId: 1, UserId: 2, Contents: contents, ThreadId: &rootid})
+		if err != nil {
+			t.Fatalf("CreateMessage: err: %v", err)
+		}
+		replies = append(replies, id)
+	}
+	root, err := db.GetMessage(rootid)
+	if err != nil {
+		t.Fatalf("GetMessage: err: %v", err)
+	}
+	if root.Thread == nil || root.Thread.ReplyCount != 3 || root.Thread.LastReply == nil {
+		t.Fatalf("ThreadSummary: invalid summary %+v", root.Thread)
+	}
+
+	_, err = db.DeleteMessage(replies[2])
+	if err != nil {
+		t.Fatalf("DeleteMessage: err: %v", err)
+	}
+	root, err = db.GetMessage(rootid)
+	if err != nil {
+		t.Fatalf("GetMessage: err: %v", err)
+	}
+	if root.Thread.ReplyCount != 2 {
+		t.Fatalf("ThreadSummary: expected 2 replies got %d", root.Thread.ReplyCount)
+	}
+
+	channelMessages, err := db.GetMessagesInChannel(1, 100)
+	if err != nil {
+		t.Fatalf("GetMessagesInChannel: err: %v", err)
+	}
+	for _, message := range channelMessages {
+		if message.ThreadId != nil {
+			t.Fatalf("GetMessagesInChannel: thread reply %d returned", message.MessageId)
+		}
+	}
+}
+
+func Test_GetThreadMessages_Pagination(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	rootid := Id(1)
+	var replies []Id
+	for _, contents := range []string{"a", "b", "c", "d"} {
+		id, err := db.CreateMessage(NewMessage{ChannelId: 1, UserId: 1, Contents: contents, ThreadId: &rootid})
+		if err != nil {
+			t.Fatalf("CreateMessage: err: %v", err)
+		}
+		replies = append(replies, id)
+	}
+	page, err := db.GetThreadMessages(rootid, 0, 2)
+	if err != nil {
+		t.Fatalf("GetThreadMessages: err: %v", err)
+	}
+	if len(page) != 2 || page[0].MessageId != replies[3] || page[1].MessageId != replies[2] {
+		t.Fatalf("GetThreadMessages: unexpected first page %+v", page)
+	}
+	page, err = db.GetThreadMessages(rootid, page[1].MessageId, 10)
+	if err != nil {
+		t.Fatalf("GetThreadMessages: err: %v", err)
+	}
+	if len(page) != 2 || page[0].MessageId != replies[1] || page[1].MessageId != replies[0] {
+		t.Fatalf("GetThreadMessages: unexpected second page %+v", page)
+	}
+}
+
+func Test_FollowThread(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	rootid := Id(1)
+	err := db.FollowThread(rootid, 1)
+	if err != nil {
+		t.Fatalf("FollowThread: err: %v", err)
+	}
+	// following twice is not an error
+	err = db.FollowThread(rootid, 1)
+	if err != nil {
+		t.Fatalf("FollowThread: err: %v", err)
+	}
+	err = db.FollowThread(rootid, 2)
+	if err != nil {
+		t.Fatalf("FollowThread: err: %v", err)
+	}
+	followers, err := db.GetThreadFollowers(rootid)
+	if err != nil {
+		t.Fatalf("GetThreadFollowers: err: %v", err)
+	}
+	if len(followers) != 2 {
+		t.Fatalf("GetThreadFollowers: expected 2 followers got %d", len(followers))
+	}
+	err = db.UnfollowThread(rootid, 2)
+	if err != nil {
+		t.Fatalf("UnfollowThread: err: %v", err)
+	}
+	err = db.UnfollowThread(rootid, 2)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("UnfollowThread: expected ErrRecordNotFound got %v", err)
+	}
+}
+
+func Test_DeleteMessage_ThreadRoot(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	rootid := Id(1)
+	replyid, err := db.CreateMessage(NewMessage{ChannelId: 1, UserId: 2, Contents: "reply", ThreadId: &rootid})
+	if err != nil {
+		t.Fatalf("CreateMessage: err: %v", err)
+	}
+	_, err = db.CreateAttachment(Attachment{
+		ChannelId:   1,
+		UserId:      2,
+		MessageId:   &replyid,
+		FileName:    "a.txt",
+		ContentType: "text/plain",
+		Size:        100,
+		StorageKey:  "reply-file",
+	})
+	if err != nil {
+		t.Fatalf("CreateAttachment: err: %v", err)
+	}
+	if err := db.FollowThread(rootid, 2); err != nil {
+		t.Fatalf("FollowThread: err: %v", err)
+	}
+
+	attachments, err := db.DeleteMessage(rootid)
+	if err != nil {
+		t.Fatalf("DeleteMessage: err: %v", err)
+	}
+	if len(attachments) != 1 || attachments[0].StorageKey != "reply-file" {
+		t.Fatalf("DeleteMessage: expected the attachment of the reply got %+v", attachments)
+	}
+	if _, err := db.GetMessage(replyid); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("GetMessage: expected the reply to be deleted got %v", err)
+	}
+	if replies, err := db.GetThreadMessages(rootid, 0, 10); err != nil || len(replies) != 0 {
+		t.Fatalf("GetThreadMessages: expected no replies got %+v err: %v", replies, err)
+	}
+	if followers, err := db.GetThreadFollowers(rootid); err != nil || len(followers) != 0 {
+		t.Fatalf("GetThreadFollowers: expected no followers got %v err: %v", followers, err)
+	}
+	if _, err := db.DeleteMessage(rootid); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("DeleteMessage: expected ErrRecordNotFound got %v", err)
+	}
+}
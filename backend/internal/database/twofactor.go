@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// SetTwoFactorSecret starts a new, not yet confirmed, TOTP enrollment.
+func (r *DBService) SetTwoFactorSecret(userid Id, secret string) error {
+	_, err := r.conn.Exec(
+		"INSERT OR REPLACE INTO TwoFactorTable (userid, secret, enabled, laststep) VALUES (?, ?, 0, 0)",
+		userid,
+		secret,
+	)
+	if err != nil {
+		return fmt.Errorf("set two factor secret - userid: %d err: %w", userid, err)
+	}
+	return nil
+}
+
+func (r *DBService) GetTwoFactor(userid Id) (TwoFactor, error) {
+	var twofactor TwoFactor
+	err := r.conn.QueryRowContext(
+		context.Background(),
+		"SELECT userid, secret, enabled, laststep FROM TwoFactorTable WHERE userid = ?",
+		userid,
+	).Scan(&twofactor.UserId, &twofactor.Secret, &twofactor.Enabled, &twofactor.LastStep)
+	if errors.Is(err, sql.ErrNoRows) {
+		return TwoFactor{}, ErrRecordNotFound
+	}
+	return twofactor, err
+}
+
+// EnableTwoFactor confirms the pending enrollment of a user, recording the
+// step of the confirming code, and stores their recovery codes.
+func (r *DBService) EnableTwoFactor(userid Id, step int64, codehashes []string) error {
+	return r.inTx(func(tx *DBService) error {
+		result, err := tx.conn.Exec(
+			"UPDATE TwoFactorTable SET enabled = 1, laststep = ? WHERE userid = ?",
+			step,
+			userid,
+		)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("error getting rows affected: %w", err)
+		}
+		if rowsAffected == 0 {
+			return ErrRecordNotFound
+		}
+		return tx.replaceRecoveryCodes(userid, codehashes)
+	})
+}
+
+func (r *DBService) DisableTwoFactor(userid Id) error {
+	return r.inTx(func(tx *DBService) error {
+		if _, err := tx.conn.Exec("DELETE FROM RecoveryCodeTable WHERE userid = ?", userid); err != nil {
+			return err
+		}
+		_, err := tx.conn.Exec("DELETE FROM TwoFactorTable WHERE userid = ?", userid)
+		return err
+	})
+}
+
+// UseTwoFactorStep records that the code of a time step was accepted. It
+// returns ErrRecordNotFound when that step or a later one was already used.
+func (r *DBService) UseTwoFactorStep(userid Id, step int64) error {
+	result, err := r.conn.Exec(
+		"UPDATE TwoFactorTable SET laststep = ? WHERE userid = ? AND laststep < ?",
+		step,
+		userid,
+		step,
+	)
+	if err != nil {
+		return fmt.Errorf("use two factor step - userid: %d err: %w", userid, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// SetRecoveryCodes replaces the recovery codes of a user.
+func (r *DBService) SetRecoveryCodes(userid Id, codehashes []string) error {
+	return r.inTx(func(tx *DBService) error {
+		return tx.replaceRecoveryCodes(userid, codehashes)
+	})
+}
+
+func (r *DBService) replaceRecoveryCodes(userid Id, codehashes []string) error {
+	if _, err := r.conn.Exec("DELETE FROM RecoveryCodeTable WHERE userid = ?", userid); err != nil {
+		return err
+	}
+	for _, codehash := range codehashes {
+		_, err := r.conn.Exec(
+			"INSERT INTO RecoveryCodeTable (userid, codehash) VALUES (?, ?)",
+			userid,
+			codehash,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode removes a recovery code so it works only once.
+func (r *DBService) UseRecoveryCode(userid Id, codehash string) error {
+	result, err := r.conn.Exec(
+		"DELETE FROM RecoveryCodeTable WHERE userid = ? AND codehash = ?",
+		userid,
+		codehash,
+	)
+	if err != nil {
+		return fmt.Errorf("use recovery code - userid: %d err: %w", userid, err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *DBService) CountRecoveryCodes(userid Id) (int, error) {
+	var count int
+	err := r.conn.QueryRowContext(
+		context.Background(),
+		"SELECT COUNT(*) FROM RecoveryCodeTable WHERE userid = ?",
+		userid,
+	).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_TwoFactor(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	if _, err := db.GetTwoFactor(1); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("GetTwoFactor: expected ErrRecordNotFound got %v", err)
+	}
+	if err := db.SetTwoFactorSecret(1, "SECRET"); err != nil {
+		t.Fatalf("SetTwoFactorSecret: err: %v", err)
+	}
+	twofactor, err := db.GetTwoFactor(1)
+	if err != nil || twofactor.Enabled || twofactor.Secret != "SECRET" {
+		t.Fatalf("GetTwoFactor: unexpected %+v err: %v", twofactor, err)
+	}
+	if err := db.EnableTwoFactor(1, 10, []string{"a", "b"}); err != nil {
+		t.Fatalf("EnableTwoFactor: err: %v", err)
+	}
+	twofactor, _ = db.GetTwoFactor(1)
+	if !twofactor.Enabled || twofactor.LastStep != 10 {
+		t.Fatalf("GetTwoFactor: expected enabled at step 10 got %+v", twofactor)
+	}
+	if err := db.UseTwoFactorStep(1, 10); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("UseTwoFactorStep: expected replay to be rejected got %v", err)
+	}
+	if err := db.UseTwoFactorStep(1, 11); err != nil {
+		t.Fatalf("UseTwoFactorStep: err: %v", err)
+	}
+	if err := db.UseRecoveryCode(1, "a"); err != nil {
+		t.Fatalf("UseRecoveryCode: err: %v", err)
+	}
+	if err := db.UseRecoveryCode(1, "a"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("UseRecoveryCode: expected code to be single use got %v", err)
+	}
+	if count, err := db.CountRecoveryCodes(1); err != nil || count != 1 {
+		t.Fatalf("CountRecoveryCodes: expected 1 got %d err: %v", count, err)
+	}
+	if err := db.DisableTwoFactor(1); err != nil {
+		t.Fatalf("DisableTwoFactor: err: %v", err)
+	}
+	if count, _ := db.CountRecoveryCodes(1); count != 0 {
+		t.Fatalf("DisableTwoFactor: expected recovery codes to be removed")
+	}
+	if err := db.EnableTwoFactor(1, 1, nil); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("EnableTwoFactor: expected ErrRecordNotFound without enrollment got %v", err)
+	}
+}
@@ -3,6 +3,8 @@ package database
 import (
 	"strconv"
 	"time"
+
+	"go-chat-react/internal/markdown"
 )
 
 type Id = uint
@@ -23,8 +25,24 @@ func ParseStringToID(id string) (Id, error) {
 }
 
 type User struct {
-	UserId   Id
-	UserName string
+	UserId      Id
+	UserName    string
+	DisplayName string
+	AvatarKey   string
+	BannerColor string
+	Bio         string
+	Pronouns    string
+	IsBot       bool
+	// BotOwnerId is the user that manages a bot, zero for humans.
+	BotOwnerId Id
+}
+
+// UserProfile holds the fields of a User that its owner can edit freely.
+type UserProfile struct {
+	DisplayName string
+	BannerColor string
+	Bio         string
+	Pronouns    string
 }
 
 type UserLoginInfo struct {
@@ -35,6 +53,19 @@ type UserLoginInfo struct {
 	TokenExpireTime time.Time
 }
 
+// HasPassword reports whether the user can sign in with a password. Users
+// created through single sign-on have none until they set one.
+func (u UserLoginInfo) HasPassword() bool {
+	return u.PasswordHash != ""
+}
+
+// UserSession is the signed in session of a user and when it expires.
+type UserSession struct {
+	UserId   Id
+	UserName string
+	Expires  time.Time
+}
+
 type UsernameLogEntry struct {
 	UserId    Id
 	Username  string
@@ -48,26 +79,396 @@ type UserNicknameLogEntry struct {
 	Timestamp time.Time
 }
 
+// ServerMember is a User as seen inside one server.
+type ServerMember struct {
+	User
+	ServerId Id
+	Nickname string
+	// EffectiveName is the nickname, display name or username, whichever
+	// is set first
+	EffectiveName string
+}
+
 type Server struct {
-	ServerId   Id
-	OwnerId    Id
-	ServerName string
+	ServerId    Id
+	OwnerId     Id
+	ServerName  string
+	UploadQuota int64
 }
 
 type Channel struct {
-	ChannelId   Id
+	ChannelId Id
+	// ServerId is zero for the channel of a direct message
 	ServerId    Id
 	ChannelName string
 	Timestamp   time.Time
+	PinLimit    uint
+}
+
+// IsDirectMessage reports whether the channel holds a direct message
+// conversation rather than belonging to a server.
+func (c Channel) IsDirectMessage() bool {
+	return c.ServerId == 0
 }
 
+// message types stored in ChannelMessageTable.messagetype. Anything other
+// than MessageTypeDefault is a notice generated by the server.
+const (
+	MessageTypeDefault = "default"
+	MessageTypePin     = "pin"
+)
+
 type Message struct {
-	MessageId        Id
-	UserId           Id
+	MessageId Id
+	UserId    Id
+	// ServerId is zero for messages of a direct message conversation
 	ServerId         Id
 	ChannelId        Id
 	Contents         string
 	Timestamp        time.Time
 	Editted          *bool
 	EdittedTimeStamp *time.Time
+	ReplyToId        *Id
+	ThreadId         *Id
+	Type             string
+	// AuthorName is the effective name of the author in the server the
+	// message was posted in
+	AuthorName string
+	// AST is the parsed markdown of Contents
+	AST         []markdown.Node
+	ReplyTo     *MessageReference
+	Thread      *ThreadSummary
+	Attachments []Attachment
+	Embeds      []LinkPreview
+	// Webhook is set on messages posted through an incoming webhook
+	Webhook *WebhookAuthor
+}
+
+// NewMessage holds everything needed to insert a row into ChannelMessageTable.
+// Optional fields are left nil when unused.
+type NewMessage struct {
+	ChannelId Id
+	UserId    Id
+	Contents  string
+	ReplyToId *Id
+	ThreadId  *Id
+	// Type defaults to MessageTypeDefault when empty
+	Type string
+}
+
+// MessageReference is the quoted parent of a reply. Deleted is set when the
+// parent has since been removed, in which case only MessageId is populated.
+type MessageReference struct {
+	MessageId Id
+	UserId    Id
+	Contents  string
+	Deleted   bool
+}
+
+type ThreadSummary struct {
+	RootId     Id
+	ReplyCount uint
+	LastReply  *time.Time
+}
+
+type PinnedMessage struct {
+	Message
+	PinnedBy Id
+	PinnedAt time.Time
+}
+
+type Attachment struct {
+	AttachmentId Id
+	ChannelId    Id
+	UserId       Id
+	MessageId    *Id
+	FileName     string
+	ContentType  string
+	Size         int64
+	StorageKey   string
+	Timestamp    time.Time
+	// Width, Height and BlurHash are filled in once an image attachment has
+	// been processed and stay nil for other files.
+	Width      *int
+	Height     *int
+	BlurHash   *string
+	Thumbnails []AttachmentThumbnail
+}
+
+// AttachmentThumbnail is a downscaled copy of an image attachment bounded by
+// Size pixels on its longest side.
+type AttachmentThumbnail struct {
+	AttachmentId Id
+	Size         int
+	Width        int
+	Height       int
+	ContentType  string
+	StorageKey   string
+}
+
+// LinkPreview is the cached card metadata of a URL. Timestamp is when the
+// page was last fetched.
+type LinkPreview struct {
+	URL         string
+	Title       string
+	Description string
+	SiteName    string
+	ImageURL    string
+	Timestamp   time.Time
+}
+
+// DirectMessage is a conversation outside of any server. One to one
+// conversations have IsGroup unset and exactly the two users as
+// participants; group conversations have an owner who may remove others.
+type DirectMessage struct {
+	ChannelId Id
+	OwnerId   Id
+	Name      string
+	IsGroup   bool
+	Timestamp time.Time
+	// Participants are in the order they joined the conversation
+	Participants []User
+	LastMessage  *Message
+}
+
+func (d DirectMessage) lastActivity() time.Time {
+	if d.LastMessage != nil {
+		return d.LastMessage.Timestamp
+	}
+	return d.Timestamp
+}
+
+type FriendRequest struct {
+	SenderId   Id
+	ReceiverId Id
+	Timestamp  time.Time
+}
+
+type AccountDeletion struct {
+	UserId         Id
+	Requested      time.Time
+	DeleteAfter    time.Time
+	RemoveMessages bool
+}
+
+// DeletedAccount lists the blobs left behind by DeleteUserAccount.
+type DeletedAccount struct {
+	AvatarKey   string
+	Attachments []Attachment
+}
+
+// UserEmail is the email address of a user and whether they proved they
+// own it.
+type UserEmail struct {
+	Email    string
+	Verified bool
+}
+
+// AuthToken is an issued single-use token, such as a password reset link.
+// Email records the address a verification token was sent to.
+type AuthToken struct {
+	TokenId string
+	UserId  Id
+	Purpose string
+	Email   string
+	Expires time.Time
+}
+
+// TwoFactor is the TOTP setup of a user. It stays disabled until the user
+// confirms enrollment with a code. LastStep is the time step of the last
+// accepted code, which cannot be used again.
+type TwoFactor struct {
+	UserId   Id
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
+
+// APIToken is a personal access token. Only the hash of the secret is
+// stored, and the token grants no more than its scopes. A nil Expires never
+// expires.
+type APIToken struct {
+	TokenId  Id
+	UserId   Id
+	Name     string
+	Scopes   []string
+	Created  time.Time
+	LastUsed *time.Time
+	Expires  *time.Time
+}
+
+// Webhook posts into a channel on behalf of an external service. Its
+// messages are authored by a dedicated bot user named after the webhook.
+type Webhook struct {
+	WebhookId Id
+	ChannelId Id
+	UserId    Id
+	CreatorId Id
+	Name      string
+	Created   time.Time
+}
+
+// WebhookAuthor records how a webhook presented itself on one message.
+// UserName and AvatarURL are empty unless the payload overrode them.
+type WebhookAuthor struct {
+	WebhookId Id
+	UserName  string
+	AvatarURL string
+	Embeds    []RichEmbed
+}
+
+// RichEmbed is a card supplied by a webhook rather than unfurled from a
+// link. It is stored as JSON so the tags are part of the schema.
+type RichEmbed struct {
+	Title        string           `json:"title,omitempty"`
+	Description  string           `json:"description,omitempty"`
+	URL          string           `json:"url,omitempty"`
+	Color        string           `json:"color,omitempty"`
+	AuthorName   string           `json:"author_name,omitempty"`
+	ImageURL     string           `json:"image_url,omitempty"`
+	ThumbnailURL string           `json:"thumbnail_url,omitempty"`
+	Footer       string           `json:"footer,omitempty"`
+	Fields       []RichEmbedField `json:"fields,omitempty"`
+}
+
+type RichEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+// event delivery states stored in EventDeliveryTable.status
+const (
+	EventDeliveryPending   = "pending"
+	EventDeliveryDelivered = "delivered"
+	EventDeliveryFailed    = "failed"
+)
+
+// EventEndpoint is an outgoing webhook that receives the events of a server
+// it subscribed to. Failures counts consecutive failed attempts and an
+// endpoint is disabled once it reaches the limit.
+type EventEndpoint struct {
+	EndpointId Id
+	ServerId   Id
+	CreatorId  Id
+	URL        string
+	Secret     string
+	Events     []string
+	Enabled    bool
+	Failures   int
+	Created    time.Time
+}
+
+// EventDelivery is one event queued for one endpoint, along with the
+// outcome of its latest attempt.
+type EventDelivery struct {
+	DeliveryId   Id
+	EndpointId   Id
+	Event        string
+	Payload      string
+	Status       string
+	Attempts     int
+	NextAttempt  time.Time
+	LastAttempt  *time.Time
+	ResponseCode int
+	Error        string
+	Created      time.Time
+}
+
+// audit log target types
+const (
+	AuditTargetServer   = "server"
+	AuditTargetChannel  = "channel"
+	AuditTargetMember   = "member"
+	AuditTargetMessage  = "message"
+	AuditTargetWebhook  = "webhook"
+	AuditTargetEndpoint = "outgoing_webhook"
+)
+
+// AuditEntry records one administrative change to a server: who made it,
+// what it was applied to, the values it changed and the reason given.
+type AuditEntry struct {
+	EntryId    Id
+	ServerId   Id
+	ActorId    Id
+	Action     string
+	TargetType string
+	TargetId   Id
+	Before     map[string]any
+	After      map[string]any
+	Reason     string
+	Created    time.Time
+}
+
+// AuditLogFilter narrows down the audit log of a server. Zero values match
+// every entry, and Before pages back from an entry id.
+type AuditLogFilter struct {
+	ActorId Id
+	Action  string
+	Before  Id
+}
+
+// command option types understood by the slash command parser
+const (
+	CommandOptionString   = "string"
+	CommandOptionText     = "text"
+	CommandOptionInteger  = "integer"
+	CommandOptionBoolean  = "boolean"
+	CommandOptionUser     = "user"
+	CommandOptionChannel  = "channel"
+	CommandOptionDuration = "duration"
+)
+
+// CommandOption is one typed argument of a slash command. A text option
+// takes the rest of the line and a variadic option every remaining word,
+// so either can only be the last option.
+type CommandOption struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required,omitempty"`
+	Variadic    bool     `json:"variadic,omitempty"`
+	Choices     []string `json:"choices,omitempty"`
+}
+
+// BotCommand is a slash command registered by a bot. It can be used in the
+// servers the bot is a member of.
+type BotCommand struct {
+	CommandId   Id
+	BotId       Id
+	Name        string
+	Description string
+	Options     []CommandOption
+	Created     time.Time
+}
+
+// BotCallback is where the commands of a bot are posted when it does not
+// take them over its websocket. Secret signs every request.
+type BotCallback struct {
+	BotId  Id
+	URL    string
+	Secret string
+}
+
+// Restriction keeps a member from posting until it expires: in every
+// channel of a server for a timeout, or in ChannelId only for a mute.
+type Restriction struct {
+	RestrictionId Id
+	ServerId      Id
+	// ChannelId is zero for a timeout
+	ChannelId   Id
+	UserId      Id
+	ModeratorId Id
+	Reason      string
+	Expires     time.Time
+	Created     time.Time
+}
+
+type Reminder struct {
+	ReminderId Id
+	UserId     Id
+	ChannelId  Id
+	Message    string
+	Due        time.Time
+	Created    time.Time
 }
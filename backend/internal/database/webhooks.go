@@ -0,0 +1,198 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const webhookSelect = "SELECT webhookid, channelid, userid, creatorid, name, created FROM WebhookTable"
+
+func scanWebhook(row rowScanner) (Webhook, error) {
+	var webhook Webhook
+	err := row.Scan(
+		&webhook.WebhookId,
+		&webhook.ChannelId,
+		&webhook.UserId,
+		&webhook.CreatorId,
+		&webhook.Name,
+		&webhook.Created,
+	)
+	return webhook, err
+}
+
+// CreateWebhook adds a webhook to a channel along with the bot user its
+// messages are posted as. The bot has no owner, so it never shows up among
+// the bots of the creator.
+func (r *DBService) CreateWebhook(channelid Id, creatorid Id, name string, secrethash string) (Id, error) {
+	var webhookid Id
+	err := r.inTx(func(tx *DBService) error {
+		userid, err := tx.CreateUser("webhook-"+strings.ToLower(rand.Text()), rand.Text())
+		if err != nil {
+			return err
+		}
+		_, err = tx.conn.Exec("UPDATE UserTable SET isbot = 1, displayname = ? WHERE userid = ?", name, userid)
+		if err != nil {
+			return err
+		}
+		result, err := tx.conn.Exec(
+			"INSERT INTO WebhookTable (channelid, userid, creatorid, name, secrethash) VALUES (?, ?, ?, ?, ?)",
+			channelid,
+			userid,
+			creatorid,
+			name,
+			secrethash,
+		)
+		if err != nil {
+			return fmt.Errorf("create webhook - channelid: %d err: %w", channelid, err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		webhookid = Id(id)
+		return nil
+	})
+	return webhookid, err
+}
+
+func (r *DBService) GetWebhook(webhookid Id) (Webhook, error) {
+	webhook, err := scanWebhook(r.conn.QueryRowContext(
+		context.Background(),
+		webhookSelect+" WHERE webhookid = ?",
+		webhookid,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Webhook{}, ErrRecordNotFound
+	}
+	return webhook, err
+}
+
+// GetWebhookByHash finds the webhook with the given id and secret hash, so
+// guessing either alone gets nowhere.
+func (r *DBService) GetWebhookByHash(webhookid Id, secrethash string) (Webhook, error) {
+	webhook, err := scanWebhook(r.conn.QueryRowContext(
+		context.Background(),
+		webhookSelect+" WHERE webhookid = ? AND secrethash = ?",
+		webhookid,
+		secrethash,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Webhook{}, ErrRecordNotFound
+	}
+	return webhook, err
+}
+
+func (r *DBService) GetWebhooksOfChannel(channelid Id) ([]Webhook, error) {
+	rows, err := r.conn.Query(webhookSelect+" WHERE channelid = ? ORDER BY webhookid", channelid)
+	if err != nil {
+		return []Webhook{}, err
+	}
+	defer rows.Close()
+	var webhooks []Webhook
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return []Webhook{}, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook stops a webhook from posting. Its earlier messages stay.
+func (r *DBService) DeleteWebhook(webhookid Id) error {
+	result, err := r.conn.Exec("DELETE FROM WebhookTable WHERE webhookid = ?", webhookid)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// AddWebhookMessage posts a message through a webhook. The message and its
+// author are written together, so a message never shows up as sent by the
+// webhook user itself.
+func (r *DBService) AddWebhookMessage(channelid Id, userid Id, contents string, author WebhookAuthor) (Id, error) {
+	var messageid Id
+	err := r.inTx(func(tx *DBService) error {
+		var err error
+		messageid, err = tx.AddMessage(channelid, userid, contents)
+		if err != nil {
+			return err
+		}
+		return tx.setMessageWebhookAuthor(messageid, author)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return messageid, nil
+}
+
+// setMessageWebhookAuthor marks a message as posted through a webhook.
+func (r *DBService) setMessageWebhookAuthor(messageid Id, author WebhookAuthor) error {
+	embeds, err := json.Marshal(author.Embeds)
+	if err != nil {
+		return err
+	}
+	if author.Embeds == nil {
+		embeds = []byte("[]")
+	}
+	_, err = r.conn.Exec(
+		"INSERT OR REPLACE INTO MessageWebhookTable (messageid, webhookid, username, avatarurl, embeds) VALUES (?, ?, ?, ?, ?)",
+		messageid,
+		author.WebhookId,
+		author.UserName,
+		author.AvatarURL,
+		string(embeds),
+	)
+	if err != nil {
+		return fmt.Errorf("set webhook author - messageid: %d err: %w", messageid, err)
+	}
+	return nil
+}
+
+// loadWebhookAuthors fills in the Webhook of every message in place.
+func (r *DBService) loadWebhookAuthors(messages []Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	index := make(map[Id]int, len(messages))
+	args := make([]any, len(messages))
+	for i, message := range messages {
+		index[message.MessageId] = i
+		args[i] = message.MessageId
+	}
+	rows, err := r.conn.Query(
+		"SELECT messageid, webhookid, username, avatarurl, embeds FROM MessageWebhookTable WHERE messageid IN ("+placeholders(len(messages))+")",
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var messageid Id
+		var author WebhookAuthor
+		var embeds string
+		err := rows.Scan(&messageid, &author.WebhookId, &author.UserName, &author.AvatarURL, &embeds)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(embeds), &author.Embeds); err != nil {
+			return fmt.Errorf("decode webhook embeds - messageid: %d err: %w", messageid, err)
+		}
+		messages[index[messageid]].Webhook = &author
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_Webhooks(t *testing.T) {
+	db := setup()
+	defer db.Close()
+	webhookid, err := db.CreateWebhook(1, 1, "CI", "hash")
+	if err != nil {
+		t.Fatalf("CreateWebhook: err: %v", err)
+	}
+	webhook, err := db.GetWebhookByHash(webhookid, "hash")
+	if err != nil {
+		t.Fatalf("GetWebhookByHash: err: %v", err)
+	}
+	if _, err := db.GetWebhookByHash(webhookid, "other"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("GetWebhookByHash: expected ErrRecordNotFound got %v", err)
+	}
+	user, err := db.GetUser(webhook.UserId)
+	if err != nil || !user.IsBot || user.BotOwnerId != 0 || user.DisplayName != "CI" {
+		t.Fatalf("GetUser: unexpected webhook user %+v err: %v", user, err)
+	}
+
+	author := WebhookAuthor{
+		WebhookId: webhookid,
+		UserName:  "Jenkins",
+		Embeds:    []RichEmbed{{Title: "#42", Color: "#00ff00", Fields: []RichEmbedField{{Name: "branch", Value: "main"}}}},
+	}
+	messageid, err := db.AddWebhookMessage(1, webhook.UserId, "build passed", author)
+	if err != nil {
+		t.Fatalf("AddWebhookMessage: err: %v", err)
+	}
+	message, err := db.GetMessage(messageid)
+	if err != nil {
+		t.Fatalf("GetMessage: err: %v", err)
+	}
+	if message.Webhook == nil || message.Webhook.UserName != "Jenkins" || len(message.Webhook.Embeds) != 1 ||
+		message.Webhook.Embeds[0].Fields[0].Value != "main" || message.AuthorName != "CI" {
+		t.Fatalf("GetMessage: unexpected webhook message %+v", message)
+	}
+
+	if err := db.DeleteChannel(1); err != nil {
+		t.Fatalf("DeleteChannel: err: %v", err)
+	}
+	if webhooks, _ := db.GetWebhooksOfChannel(1); len(webhooks) != 0 {
+		t.Fatalf("GetWebhooksOfChannel: expected webhooks removed with channel got %+v", webhooks)
+	}
+	if err := db.DeleteWebhook(webhookid); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("DeleteWebhook: expected ErrRecordNotFound got %v", err)
+	}
+}
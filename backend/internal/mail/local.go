@@ -0,0 +1,59 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LogMailer writes emails to the server log instead of sending them. It is
+// meant for development setups without a mail server.
+type LogMailer struct {
+	from string
+}
+
+func NewLogMailer(from string) *LogMailer {
+	return &LogMailer{from: from}
+}
+
+func (l *LogMailer) Send(ctx context.Context, message Message) error {
+	data, err := format(l.from, message, time.Now())
+	if err != nil {
+		return err
+	}
+	log.Printf("mail to %s:\n%s", message.To, data)
+	return nil
+}
+
+// FileMailer stores every email as an .eml file in a directory.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir string, from string) *FileMailer {
+	return &FileMailer{dir: dir, from: from}
+}
+
+func (f *FileMailer) Send(ctx context.Context, message Message) error {
+	now := time.Now()
+	data, err := format(f.from, message, now)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(f.dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("file mailer - create directory: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405"), uuid.New().String())
+	err = os.WriteFile(filepath.Join(f.dir, name), data, 0o644)
+	if err != nil {
+		return fmt.Errorf("file mailer - write file: %w", err)
+	}
+	return nil
+}
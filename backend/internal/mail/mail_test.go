@@ -0,0 +1,114 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat_RejectsHeaderInjection(t *testing.T) {
+	_, err := format("a@example.com", Message{To: "b@example.com", Subject: "hi\r\nBcc: c@example.com"}, time.Now())
+	if !errors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("expected ErrInvalidMessage got %v", err)
+	}
+	_, err = format("a@example.com", Message{To: "b@example.com\r\nBcc: c@example.com"}, time.Now())
+	if !errors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("expected ErrInvalidMessage got %v", err)
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer := NewFileMailer(dir, "go-chat <no-reply@example.com>")
+	err := mailer.Send(context.Background(), Message{To: "u1@example.com", Subject: "Hello", Body: "line 1\nline 2"})
+	if err != nil {
+		t.Fatalf("Send: err: %v", err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one email file got %v err: %v", files, err)
+	}
+	data, _ := os.ReadFile(files[0])
+	for _, expected := range []string{"To: u1@example.com\r\n", "Subject: Hello\r\n", "\r\n\r\nline 1\r\nline 2"} {
+		if !strings.Contains(string(data), expected) {
+			t.Fatalf("expected %q in email %q", expected, data)
+		}
+	}
+}
+
+// fakeSMTP accepts a single email over an unauthenticated SMTP session, the
+// way local stand-ins such as MailHog do.
+func fakeSMTP(t *testing.T) (string, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: err: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		text := textproto.NewConn(conn)
+		text.PrintfLine("220 localhost fake smtp")
+		var envelope []string
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch command {
+			case "EHLO", "HELO":
+				text.PrintfLine("250 localhost")
+			case "MAIL", "RCPT":
+				envelope = append(envelope, line)
+				text.PrintfLine("250 ok")
+			case "DATA":
+				text.PrintfLine("354 go ahead")
+				data, err := text.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				received <- strings.Join(envelope, "\n") + "\n" + string(data)
+				text.PrintfLine("250 queued")
+			case "QUIT":
+				text.PrintfLine("221 bye")
+				return
+			default:
+				text.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestSMTPMailer(t *testing.T) {
+	addr, received := fakeSMTP(t)
+	mailer, err := NewSMTPMailer(SMTPConfig{Addr: addr, From: "go-chat <no-reply@example.com>"})
+	if err != nil {
+		t.Fatalf("NewSMTPMailer: err: %v", err)
+	}
+	err = mailer.Send(context.Background(), Message{To: "u1@example.com", Subject: "Reset", Body: "token"})
+	if err != nil {
+		t.Fatalf("Send: err: %v", err)
+	}
+	select {
+	case data := <-received:
+		for _, expected := range []string{"MAIL FROM:<no-reply@example.com>", "RCPT TO:<u1@example.com>", "Subject: Reset", "token"} {
+			if !strings.Contains(data, expected) {
+				t.Fatalf("expected %q in session %q", expected, data)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for email")
+	}
+}
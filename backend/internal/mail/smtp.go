@@ -0,0 +1,67 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+type SMTPConfig struct {
+	// Addr is the host:port of the server. Local stand-ins such as MailHog
+	// listen on localhost:1025 and need no credentials.
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPMailer sends emails through an SMTP server, upgrading to TLS when the
+// server offers it and authenticating when credentials are configured.
+type SMTPMailer struct {
+	config SMTPConfig
+	host   string
+	sender string
+}
+
+func NewSMTPMailer(config SMTPConfig) (*SMTPMailer, error) {
+	host, _, err := net.SplitHostPort(config.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("smtp mailer - invalid address %q: %w", config.Addr, err)
+	}
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("smtp mailer - invalid sender %q: %w", config.From, err)
+	}
+	return &SMTPMailer{config: config, host: host, sender: from.Address}, nil
+}
+
+func (s *SMTPMailer) Send(ctx context.Context, message Message) error {
+	data, err := format(s.config.From, message, time.Now())
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return fmt.Errorf("%w: recipient %q", ErrInvalidMessage, message.To)
+	}
+	var auth smtp.Auth
+	if s.config.Username != "" {
+		auth = smtp.PlainAuth("", s.config.Username, s.config.Password, s.host)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(s.config.Addr, auth, s.sender, []string{to.Address}, data)
+	}()
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("smtp mailer - send: %w", ctx.Err())
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("smtp mailer - send: %w", err)
+		}
+		return nil
+	}
+}
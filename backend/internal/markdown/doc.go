@@ -0,0 +1,23 @@
+// Package markdown parses the chat flavoured markdown of message contents
+// into a small AST so every client renders messages the same way.
+//
+// A message is a list of nodes. Each node has a "type" and, depending on the
+// type, a few more fields:
+//
+//	text        literal text in "content", newlines included
+//	bold        **children**
+//	italic      *children* or _children_
+//	spoiler     ||children||
+//	code        `content`, inline code
+//	code_block  ```language\ncontent```, "language" may be empty
+//	block_quote consecutive lines starting with "> ", parsed into children
+//	link        a bare http(s) url, <url> or [children](url), target in "url"
+//	mention     <@id>, the mentioned user id in "id"
+//	channel     <#id>, the linked channel id in "id"
+//	emoji       :name:, the shortcode in "name"
+//
+// The AST never carries markup to be interpreted by the client: text and
+// code content are literal strings, so HTML in a message is displayed as
+// typed rather than rendered. Links are only produced for http and https
+// urls. A backslash escapes the following punctuation character.
+package markdown
@@ -0,0 +1,307 @@
+package markdown
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	TypeText       = "text"
+	TypeBold       = "bold"
+	TypeItalic     = "italic"
+	TypeSpoiler    = "spoiler"
+	TypeCode       = "code"
+	TypeCodeBlock  = "code_block"
+	TypeBlockQuote = "block_quote"
+	TypeLink       = "link"
+	TypeMention    = "mention"
+	TypeChannel    = "channel"
+	TypeEmoji      = "emoji"
+)
+
+// maxDepth bounds how deeply formatting may nest; anything deeper is kept as
+// text.
+const maxDepth = 16
+
+type Node struct {
+	Type     string `json:"type"`
+	Content  string `json:"content,omitempty"`
+	Language string `json:"language,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Id       uint   `json:"id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Children []Node `json:"children,omitempty"`
+}
+
+var (
+	languagePattern  = regexp.MustCompile(`^[A-Za-z0-9_+#.-]{1,32}$`)
+	emojiPattern     = regexp.MustCompile(`^:([a-z0-9_+-]{1,32}):`)
+	referencePattern = regexp.MustCompile(`^<([@#])(\d{1,19})>`)
+	urlPattern       = regexp.MustCompile(`^https?://[^\s<>]+`)
+	maskedPattern    = regexp.MustCompile(`^\[([^\[\]\n]+)\]\((https?://[^\s()<>]+)\)`)
+	angledPattern    = regexp.MustCompile(`^<(https?://[^\s<>]+)>`)
+)
+
+// Parse converts message contents into its AST. Parsing never fails;
+// unmatched markers are kept as text.
+func Parse(contents string) []Node {
+	var nodes []Node
+	for contents != "" {
+		start := strings.Index(contents, "```")
+		if start < 0 {
+			nodes = append(nodes, parseLines(contents)...)
+			break
+		}
+		end := strings.Index(contents[start+3:], "```")
+		if end < 0 {
+			nodes = append(nodes, parseLines(contents)...)
+			break
+		}
+		nodes = append(nodes, parseLines(contents[:start])...)
+		nodes = append(nodes, codeBlock(contents[start+3:start+3+end]))
+		contents = strings.TrimPrefix(contents[start+3+end+3:], "\n")
+	}
+	return mergeText(nodes)
+}
+
+func codeBlock(body string) Node {
+	node := Node{Type: TypeCodeBlock, Content: body}
+	first, rest, found := strings.Cut(body, "\n")
+	if found && languagePattern.MatchString(first) {
+		node.Language = first
+		node.Content = rest
+	}
+	node.Content = strings.TrimPrefix(node.Content, "\n")
+	node.Content = strings.TrimSuffix(node.Content, "\n")
+	return node
+}
+
+// parseLines groups runs of "> " prefixed lines into block quotes and parses
+// everything else inline. Like code blocks, a quote implies the line break
+// that ends it.
+func parseLines(text string) []Node {
+	var nodes []Node
+	var plain, quoted []string
+	flushPlain := func() {
+		if plain != nil {
+			nodes = append(nodes, parseInline(strings.Join(plain, "\n"), 0)...)
+			plain = nil
+		}
+	}
+	flushQuote := func() {
+		if quoted != nil {
+			nodes = append(nodes, Node{
+				Type:     TypeBlockQuote,
+				Children: mergeText(parseInline(strings.Join(quoted, "\n"), 0)),
+			})
+			quoted = nil
+		}
+	}
+	lines := strings.Split(text, "\n")
+	for _, line := range lines {
+		if body, ok := quoteLine(line); ok {
+			flushPlain()
+			quoted = append(quoted, body)
+			continue
+		}
+		flushQuote()
+		plain = append(plain, line)
+	}
+	flushQuote()
+	flushPlain()
+	return nodes
+}
+
+func quoteLine(line string) (string, bool) {
+	if line == ">" {
+		return "", true
+	}
+	return strings.CutPrefix(line, "> ")
+}
+
+// inline delimiters in the order they are tried
+var delimiters = []struct {
+	marker string
+	node   string
+}{
+	{"||", TypeSpoiler},
+	{"**", TypeBold},
+	{"*", TypeItalic},
+	{"_", TypeItalic},
+}
+
+func parseInline(text string, depth int) []Node {
+	var nodes []Node
+	var literal strings.Builder
+	flush := func() {
+		if literal.Len() > 0 {
+			nodes = append(nodes, Node{Type: TypeText, Content: literal.String()})
+			literal.Reset()
+		}
+	}
+	emit := func(node Node) {
+		flush()
+		nodes = append(nodes, node)
+	}
+
+	for i := 0; i < len(text); {
+		rest := text[i:]
+		if rest[0] == '\\' && len(rest) > 1 && isPunctuation(rest[1]) {
+			literal.WriteByte(rest[1])
+			i += 2
+			continue
+		}
+		if rest[0] == '`' {
+			if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+				emit(Node{Type: TypeCode, Content: rest[1 : end+1]})
+				i += end + 2
+				continue
+			}
+		}
+		if match := referencePattern.FindStringSubmatch(rest); match != nil {
+			if id, err := strconv.ParseUint(match[2], 10, 64); err == nil && id > 0 && id <= uint64(^uint(0)) {
+				node := Node{Type: TypeMention, Id: uint(id)}
+				if match[1] == "#" {
+					node.Type = TypeChannel
+				}
+				emit(node)
+				i += len(match[0])
+				continue
+			}
+		}
+		if match := angledPattern.FindStringSubmatch(rest); match != nil && validURL(match[1]) {
+			emit(Node{Type: TypeLink, URL: match[1], Children: []Node{{Type: TypeText, Content: match[1]}}})
+			i += len(match[0])
+			continue
+		}
+		if match := maskedPattern.FindStringSubmatch(rest); match != nil && validURL(match[2]) && depth < maxDepth {
+			emit(Node{Type: TypeLink, URL: match[2], Children: mergeText(parseInline(match[1], depth+1))})
+			i += len(match[0])
+			continue
+		}
+		if (i == 0 || !isWordByte(text[i-1])) && strings.HasPrefix(rest, "http") {
+			if match := urlPattern.FindString(rest); match != "" {
+				link := strings.TrimRight(match, ".,;:!?)]}*_~|'\"")
+				if validURL(link) {
+					emit(Node{Type: TypeLink, URL: link, Children: []Node{{Type: TypeText, Content: link}}})
+					i += len(link)
+					continue
+				}
+			}
+		}
+		if match := emojiPattern.FindStringSubmatch(rest); match != nil {
+			emit(Node{Type: TypeEmoji, Name: match[1]})
+			i += len(match[0])
+			continue
+		}
+		if node, size, ok := parseDelimited(text, i, depth); ok {
+			emit(node)
+			i += size
+			continue
+		}
+		literal.WriteByte(rest[0])
+		i++
+	}
+	flush()
+	return nodes
+}
+
+// parseDelimited tries to parse a span such as **bold** starting at text[i].
+// It returns the node and the number of bytes consumed.
+func parseDelimited(text string, i int, depth int) (Node, int, bool) {
+	if depth >= maxDepth {
+		return Node{}, 0, false
+	}
+	rest := text[i:]
+	for _, delimiter := range delimiters {
+		marker := delimiter.marker
+		if !strings.HasPrefix(rest, marker) {
+			continue
+		}
+		// an underscore inside a word, like snake_case, is not formatting
+		if marker == "_" && i > 0 && isWordByte(text[i-1]) {
+			return Node{}, 0, false
+		}
+		body := rest[len(marker):]
+		if body == "" || body[0] == ' ' || body[0] == '\n' {
+			continue
+		}
+		end := findClosing(body, marker)
+		if end <= 0 {
+			continue
+		}
+		after := len(marker) + end + len(marker)
+		if marker == "_" && after < len(rest) && isWordByte(rest[after]) {
+			continue
+		}
+		return Node{
+			Type:     delimiter.node,
+			Children: mergeText(parseInline(body[:end], depth+1)),
+		}, after, true
+	}
+	return Node{}, 0, false
+}
+
+// findClosing returns the index of the marker closing a span in body,
+// skipping over escaped characters and inline code.
+func findClosing(body string, marker string) int {
+	for j := 0; j < len(body); j++ {
+		switch body[j] {
+		case '\\':
+			j++
+			continue
+		case '`':
+			if end := strings.IndexByte(body[j+1:], '`'); end >= 0 {
+				j += end + 1
+				continue
+			}
+		}
+		if j == 0 || !strings.HasPrefix(body[j:], marker) || body[j-1] == ' ' {
+			continue
+		}
+		// in ***, the closing ** is the last two characters so that an
+		// italic span inside bold keeps its own closing *
+		if marker == "**" && strings.HasPrefix(body[j:], "***") {
+			return j + 1
+		}
+		// a single * directly followed by another * belongs to a ** marker
+		if marker == "*" && strings.HasPrefix(body[j:], "**") {
+			if j+2 < len(body) && body[j+2] == '*' {
+				return j + 2
+			}
+			j++
+			continue
+		}
+		return j
+	}
+	return -1
+}
+
+func validURL(raw string) bool {
+	parsed, err := url.Parse(raw)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isPunctuation(c byte) bool {
+	return strings.IndexByte("\\`*_|~<>[]():#@>-", c) >= 0
+}
+
+// mergeText joins adjacent text nodes.
+func mergeText(nodes []Node) []Node {
+	merged := make([]Node, 0, len(nodes))
+	for _, node := range nodes {
+		last := len(merged) - 1
+		if node.Type == TypeText && last >= 0 && merged[last].Type == TypeText {
+			merged[last].Content += node.Content
+			continue
+		}
+		merged = append(merged, node)
+	}
+	return merged
+}
@@ -0,0 +1,146 @@
+package markdown
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func text(content string) Node {
+	return Node{Type: TypeText, Content: content}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []Node
+	}{
+		{"plain", "hello world", []Node{text("hello world")}},
+		{"empty", "", nil},
+		{
+			"bold and italic",
+			"**bold** and *it* or _it_",
+			[]Node{
+				{Type: TypeBold, Children: []Node{text("bold")}},
+				text(" and "),
+				{Type: TypeItalic, Children: []Node{text("it")}},
+				text(" or "),
+				{Type: TypeItalic, Children: []Node{text("it")}},
+			},
+		},
+		{
+			"nested",
+			"***both*** **a *b* c**",
+			[]Node{
+				{Type: TypeBold, Children: []Node{{Type: TypeItalic, Children: []Node{text("both")}}}},
+				text(" "),
+				{Type: TypeBold, Children: []Node{
+					text("a "),
+					{Type: TypeItalic, Children: []Node{text("b")}},
+					text(" c"),
+				}},
+			},
+		},
+		{"snake case", "snake_case_name", []Node{text("snake_case_name")}},
+		{"unclosed", "**not bold", []Node{text("**not bold")}},
+		{"escaped", `\*not italic\*`, []Node{text("*not italic*")}},
+		{
+			"spoiler",
+			"||secret **x**||",
+			[]Node{{Type: TypeSpoiler, Children: []Node{
+				text("secret "),
+				{Type: TypeBold, Children: []Node{text("x")}},
+			}}},
+		},
+		{
+			"inline code is literal",
+			"run `**rm** <b>`",
+			[]Node{text("run "), {Type: TypeCode, Content: "**rm** <b>"}},
+		},
+		{
+			"code block with language",
+			"look:\n```go\nfmt.Println(\"*hi*\")\n```\ndone",
+			[]Node{
+				text("look:\n"),
+				{Type: TypeCodeBlock, Language: "go", Content: "fmt.Println(\"*hi*\")"},
+				text("done"),
+			},
+		},
+		{
+			"code block without language",
+			"```a b\nc```",
+			[]Node{{Type: TypeCodeBlock, Content: "a b\nc"}},
+		},
+		{
+			"block quote",
+			"> quoted *text*\n> more\nreply",
+			[]Node{
+				{Type: TypeBlockQuote, Children: []Node{
+					text("quoted "),
+					{Type: TypeItalic, Children: []Node{text("text")}},
+					text("\nmore"),
+				}},
+				text("reply"),
+			},
+		},
+		{
+			"links",
+			"see https://example.com/a_b_c. or [docs](https://example.com/docs) <https://x.com>",
+			[]Node{
+				text("see "),
+				{Type: TypeLink, URL: "https://example.com/a_b_c", Children: []Node{text("https://example.com/a_b_c")}},
+				text(". or "),
+				{Type: TypeLink, URL: "https://example.com/docs", Children: []Node{text("docs")}},
+				text(" "),
+				{Type: TypeLink, URL: "https://x.com", Children: []Node{text("https://x.com")}},
+			},
+		},
+		{
+			"unsafe link",
+			"[click](javascript:alert(1))",
+			[]Node{text("[click](javascript:alert(1))")},
+		},
+		{
+			"mentions channels and emoji",
+			"hi <@12> see <#3> :wave: :not valid:",
+			[]Node{
+				text("hi "),
+				{Type: TypeMention, Id: 12},
+				text(" see "),
+				{Type: TypeChannel, Id: 3},
+				text(" "),
+				{Type: TypeEmoji, Name: "wave"},
+				text(" :not valid:"),
+			},
+		},
+		{
+			"html is text",
+			"<script>alert('x')</script>",
+			[]Node{text("<script>alert('x')</script>")},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Parse(test.input)
+			if len(got) == 0 && len(test.expected) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				gotJSON, _ := json.Marshal(got)
+				expectedJSON, _ := json.Marshal(test.expected)
+				t.Fatalf("Parse(%q):\nexpected %s\ngot      %s", test.input, expectedJSON, gotJSON)
+			}
+		})
+	}
+}
+
+func TestParse_DeepNesting(t *testing.T) {
+	input := ""
+	for i := 0; i < 100; i++ {
+		input += "||"
+	}
+	input = "||" + input + "x" + input + "||"
+	// must terminate without exhausting the stack
+	Parse(input)
+}
@@ -0,0 +1,150 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	xmpHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	pngMagic   = []byte("\x89PNG\r\n\x1a\n")
+)
+
+const gpsInfoTag = 0x8825
+
+// StripLocation removes embedded location metadata from an image. For JPEG
+// the GPS directory of the EXIF block is blanked in place, keeping the rest
+// of the EXIF data (orientation, camera) intact, and XMP packets are dropped
+// since they may repeat the coordinates. For PNG any eXIf chunk is removed.
+// Other formats and malformed input are returned unchanged.
+func StripLocation(contentType string, data []byte) []byte {
+	switch contentType {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		return stripPNG(data)
+	}
+	return data
+}
+
+func stripJPEG(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return data
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			break
+		}
+		marker := data[pos+1]
+		// start of scan, everything that follows is entropy coded image data
+		if marker == 0xDA {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return data
+		}
+		segment := data[pos:end]
+		if marker == 0xE1 {
+			payload := segment[4:]
+			if bytes.HasPrefix(payload, xmpHeader) {
+				pos = end
+				continue
+			}
+			if bytes.HasPrefix(payload, exifHeader) {
+				segment = append([]byte{}, segment...)
+				blankGPS(segment[4+len(exifHeader):])
+			}
+		}
+		out = append(out, segment...)
+		pos = end
+	}
+	return append(out, data[pos:]...)
+}
+
+var tiffTypeSizes = map[uint16]uint32{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// blankGPS zeroes the GPS IFD referenced from IFD0 of a TIFF structure,
+// leaving an empty directory behind so existing offsets stay valid.
+func blankGPS(tiff []byte) {
+	if len(tiff) < 8 {
+		return
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return
+	}
+	ifd0 := order.Uint32(tiff[4:8])
+	if uint64(ifd0)+2 > uint64(len(tiff)) {
+		return
+	}
+	count := uint64(order.Uint16(tiff[ifd0:]))
+	for i := uint64(0); i < count; i++ {
+		entry := uint64(ifd0) + 2 + i*12
+		if entry+12 > uint64(len(tiff)) {
+			return
+		}
+		if order.Uint16(tiff[entry:]) != gpsInfoTag {
+			continue
+		}
+		blankIFD(tiff, order, order.Uint32(tiff[entry+8:]))
+	}
+}
+
+func blankIFD(tiff []byte, order binary.ByteOrder, offset uint32) {
+	start := uint64(offset)
+	if start+2 > uint64(len(tiff)) {
+		return
+	}
+	count := uint64(order.Uint16(tiff[start:]))
+	end := start + 2 + count*12 + 4
+	if end > uint64(len(tiff)) {
+		return
+	}
+	for i := uint64(0); i < count; i++ {
+		entry := start + 2 + i*12
+		size := uint64(tiffTypeSizes[order.Uint16(tiff[entry+2:])]) *
+			uint64(order.Uint32(tiff[entry+4:]))
+		if size <= 4 {
+			continue
+		}
+		valueOffset := uint64(order.Uint32(tiff[entry+8:]))
+		if valueOffset+size <= uint64(len(tiff)) {
+			clear(tiff[valueOffset : valueOffset+size])
+		}
+	}
+	clear(tiff[start:end])
+}
+
+func stripPNG(data []byte) []byte {
+	if !bytes.HasPrefix(data, pngMagic) {
+		return data
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, pngMagic...)
+	pos := len(pngMagic)
+	for pos+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			return data
+		}
+		if string(data[pos+4:pos+8]) != "eXIf" {
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+	return append(out, data[pos:]...)
+}
@@ -0,0 +1,126 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// maxPixels guards against decompression bombs: images whose header claims
+// more pixels than this are not decoded.
+const maxPixels = 50_000_000
+
+var ErrUnsupportedImage = errors.New("unsupported image")
+
+type Thumbnail struct {
+	Size        int
+	Width       int
+	Height      int
+	ContentType string
+	Data        []byte
+}
+
+type ImageInfo struct {
+	Width      int
+	Height     int
+	BlurHash   string
+	Thumbnails []Thumbnail
+}
+
+func IsSupportedImage(contentType string) bool {
+	switch contentType {
+	case "image/png", "image/jpeg", "image/gif":
+		return true
+	}
+	return false
+}
+
+// Process decodes an image (the first frame for GIFs) and produces its
+// dimensions, blurhash and one thumbnail per requested bounding size.
+// Thumbnails are never larger than the original.
+func Process(contentType string, data []byte, sizes []int) (ImageInfo, error) {
+	img, err := decode(contentType, data)
+	if err != nil {
+		return ImageInfo{}, err
+	}
+
+	info := ImageInfo{Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}
+	info.BlurHash, err = EncodeBlurHash(Resize(img, 32), 4, 3)
+	if err != nil {
+		return ImageInfo{}, err
+	}
+	for _, size := range sizes {
+		resized := Resize(img, size)
+		thumbnail := Thumbnail{
+			Size:   size,
+			Width:  resized.Bounds().Dx(),
+			Height: resized.Bounds().Dy(),
+		}
+		var buf bytes.Buffer
+		if contentType == "image/jpeg" {
+			thumbnail.ContentType = "image/jpeg"
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+		} else {
+			thumbnail.ContentType = "image/png"
+			err = png.Encode(&buf, resized)
+		}
+		if err != nil {
+			return ImageInfo{}, fmt.Errorf("encode thumbnail: %w", err)
+		}
+		thumbnail.Data = buf.Bytes()
+		info.Thumbnails = append(info.Thumbnails, thumbnail)
+	}
+	return info, nil
+}
+
+// Avatar center crops an image to a square and scales it down to at most
+// size pixels per side, returning it encoded as PNG.
+func Avatar(contentType string, data []byte, size int) ([]byte, error) {
+	img, err := decode(contentType, data)
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	crop := image.Rect(0, 0, side, side).Add(image.Point{
+		X: bounds.Min.X + (bounds.Dx()-side)/2,
+		Y: bounds.Min.Y + (bounds.Dy()-side)/2,
+	})
+	square := image.NewNRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(square, square.Bounds(), img, crop.Min, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, Resize(square, size)); err != nil {
+		return nil, fmt.Errorf("encode avatar: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func decode(contentType string, data []byte) (image.Image, error) {
+	if !IsSupportedImage(contentType) {
+		return nil, ErrUnsupportedImage
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image config: %w", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrUnsupportedImage, config.Width, config.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	return img, nil
+}
+
+// register decoders used by image.Decode
+var (
+	_ = gif.Decode
+	_ = jpeg.Decode
+	_ = png.Decode
+)
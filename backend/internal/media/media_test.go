@@ -0,0 +1,197 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testImage(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	return img
+}
+
+// gpsExifSegment builds an APP1 segment holding an IFD0 with a single GPS
+// pointer, followed by a GPS IFD with one latitude rational.
+func gpsExifSegment() []byte {
+	tiff := make([]byte, 0, 64)
+	le := binary.LittleEndian
+	tiff = append(tiff, 'I', 'I', 42, 0)
+	tiff = le.AppendUint32(tiff, 8)
+	// IFD0 at 8: one entry pointing at the GPS IFD at 26
+	tiff = le.AppendUint16(tiff, 1)
+	tiff = le.AppendUint16(tiff, gpsInfoTag)
+	tiff = le.AppendUint16(tiff, 4)
+	tiff = le.AppendUint32(tiff, 1)
+	tiff = le.AppendUint32(tiff, 26)
+	tiff = le.AppendUint32(tiff, 0)
+	// GPS IFD at 26: GPSLatitude, 3 rationals stored at 44
+	tiff = le.AppendUint16(tiff, 1)
+	tiff = le.AppendUint16(tiff, 2)
+	tiff = le.AppendUint16(tiff, 5)
+	tiff = le.AppendUint32(tiff, 3)
+	tiff = le.AppendUint32(tiff, 44)
+	tiff = le.AppendUint32(tiff, 0)
+	for _, v := range []uint32{51, 1, 30, 1, 0, 1} {
+		tiff = le.AppendUint32(tiff, v)
+	}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+func TestStripLocation_JPEG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(16, 16), nil); err != nil {
+		t.Fatalf("jpeg.Encode: err: %v", err)
+	}
+	encoded := buf.Bytes()
+	segment := gpsExifSegment()
+	data := append(append(append([]byte{}, encoded[:2]...), segment...), encoded[2:]...)
+
+	stripped := StripLocation("image/jpeg", data)
+	if len(stripped) != len(data) {
+		t.Fatalf("StripLocation: expected length %d got %d", len(data), len(stripped))
+	}
+	tiff := stripped[2+4+6:]
+	if count := binary.LittleEndian.Uint16(tiff[26:]); count != 0 {
+		t.Fatalf("StripLocation: expected empty GPS IFD got %d entries", count)
+	}
+	if bytes.Contains(stripped, binary.LittleEndian.AppendUint32(nil, 51)) {
+		t.Fatalf("StripLocation: latitude still present")
+	}
+	if binary.LittleEndian.Uint16(tiff[10:]) != gpsInfoTag {
+		t.Fatalf("StripLocation: IFD0 should be left intact")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Fatalf("StripLocation: result no longer decodes: %v", err)
+	}
+	if !bytes.Equal(data[len(data)-100:], stripped[len(stripped)-100:]) {
+		t.Fatalf("StripLocation: image data changed")
+	}
+}
+
+func TestStripLocation_PNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(4, 4)); err != nil {
+		t.Fatalf("png.Encode: err: %v", err)
+	}
+	encoded := buf.Bytes()
+	chunk := binary.BigEndian.AppendUint32(nil, 4)
+	chunk = append(chunk, "eXIfMM\x00\x2a"...)
+	chunk = append(chunk, 0, 0, 0, 0)
+	// insert after the IHDR chunk (8 byte signature + 25 byte chunk)
+	data := append(append(append([]byte{}, encoded[:33]...), chunk...), encoded[33:]...)
+
+	stripped := StripLocation("image/png", data)
+	if !bytes.Equal(stripped, encoded) {
+		t.Fatalf("StripLocation: expected eXIf chunk to be removed")
+	}
+}
+
+func TestStripLocation_Malformed(t *testing.T) {
+	data := []byte{0xFF, 0xD8, 0xFF, 0xE1, 0xFF, 0xFF}
+	if !bytes.Equal(StripLocation("image/jpeg", data), data) {
+		t.Fatalf("StripLocation: malformed input should be returned unchanged")
+	}
+}
+
+func TestResize(t *testing.T) {
+	resized := Resize(testImage(200, 100), 50)
+	if resized.Bounds().Dx() != 50 || resized.Bounds().Dy() != 25 {
+		t.Fatalf("Resize: expected 50x25 got %v", resized.Bounds())
+	}
+	resized = Resize(testImage(20, 10), 50)
+	if resized.Bounds().Dx() != 20 || resized.Bounds().Dy() != 10 {
+		t.Fatalf("Resize: should not upscale, got %v", resized.Bounds())
+	}
+}
+
+func TestEncodeBlurHash(t *testing.T) {
+	solid := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for i := 0; i < len(solid.Pix); i += 4 {
+		copy(solid.Pix[i:], []byte{255, 0, 0, 255})
+	}
+	hash, err := EncodeBlurHash(solid, 4, 3)
+	if err != nil {
+		t.Fatalf("EncodeBlurHash: err: %v", err)
+	}
+	if len(hash) != 28 {
+		t.Fatalf("EncodeBlurHash: expected 28 characters got %q", hash)
+	}
+	// size flag for 4x3 components, then the DC value encoding pure red
+	if hash[0] != 'L' || hash[2:6] != encode83(255<<16, 4) {
+		t.Fatalf("EncodeBlurHash: unexpected header %q", hash[:6])
+	}
+	if _, err := EncodeBlurHash(solid, 0, 3); err == nil {
+		t.Fatalf("EncodeBlurHash: expected error for invalid components")
+	}
+}
+
+func TestProcess(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(400, 200)); err != nil {
+		t.Fatalf("png.Encode: err: %v", err)
+	}
+	info, err := Process("image/png", buf.Bytes(), []int{64, 1024})
+	if err != nil {
+		t.Fatalf("Process: err: %v", err)
+	}
+	if info.Width != 400 || info.Height != 200 || info.BlurHash == "" {
+		t.Fatalf("Process: unexpected info %+v", info)
+	}
+	if len(info.Thumbnails) != 2 {
+		t.Fatalf("Process: expected 2 thumbnails got %d", len(info.Thumbnails))
+	}
+	small := info.Thumbnails[0]
+	if small.Width != 64 || small.Height != 32 || small.ContentType != "image/png" {
+		t.Fatalf("Process: unexpected thumbnail %+v", small)
+	}
+	if info.Thumbnails[1].Width != 400 {
+		t.Fatalf("Process: thumbnail should not exceed original")
+	}
+	decoded, err := png.Decode(bytes.NewReader(small.Data))
+	if err != nil || decoded.Bounds().Dx() != 64 {
+		t.Fatalf("Process: thumbnail does not decode: %v", err)
+	}
+
+	_, err = Process("image/png", []byte("not an image"), []int{64})
+	if err == nil {
+		t.Fatalf("Process: expected error for invalid data")
+	}
+	_, err = Process("text/plain", buf.Bytes(), []int{64})
+	if err != ErrUnsupportedImage {
+		t.Fatalf("Process: expected ErrUnsupportedImage got %v", err)
+	}
+}
+
+func TestAvatar(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(400, 200), nil); err != nil {
+		t.Fatalf("jpeg.Encode: err: %v", err)
+	}
+	data, err := Avatar("image/jpeg", buf.Bytes(), 128)
+	if err != nil {
+		t.Fatalf("Avatar: err: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Avatar: expected png output, err: %v", err)
+	}
+	if img.Bounds().Dx() != 128 || img.Bounds().Dy() != 128 {
+		t.Fatalf("Avatar: expected 128x128 got %v", img.Bounds())
+	}
+	if _, err := Avatar("text/plain", buf.Bytes(), 128); err != ErrUnsupportedImage {
+		t.Fatalf("Avatar: expected ErrUnsupportedImage got %v", err)
+	}
+}
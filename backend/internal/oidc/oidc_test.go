@@ -0,0 +1,148 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go-chat-react/internal/oidc/oidctest"
+)
+
+func setupProvider(t *testing.T) (*oidctest.Provider, *Provider) {
+	mock, err := oidctest.NewProvider("chat", "secret")
+	if err != nil {
+		t.Fatalf("oidctest.NewProvider: err: %v", err)
+	}
+	t.Cleanup(mock.Close)
+	provider := NewProvider(Config{
+		Name:         "corp",
+		Issuer:       mock.Issuer(),
+		ClientID:     "chat",
+		ClientSecret: "secret",
+		RedirectURL:  "http://chat.example.com/api/auth/oidc/corp/callback",
+	}, nil)
+	return mock, provider
+}
+
+// signIn runs the authorization code flow up to the callback and returns
+// the code handed to it.
+func signIn(t *testing.T, mock *oidctest.Provider, provider *Provider, verifier string, nonce string) string {
+	authURL, err := provider.AuthCodeURL(context.Background(), "state", nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: err: %v", err)
+	}
+	redirect, err := mock.Authorize(authURL, oidctest.User{
+		Subject:       "sub-1",
+		Email:         "alice@example.com",
+		EmailVerified: true,
+		Name:          "Alice",
+	})
+	if err != nil {
+		t.Fatalf("Authorize: err: %v", err)
+	}
+	if redirect.Query().Get("state") != "state" {
+		t.Fatalf("Authorize: expected state to be returned got %s", redirect)
+	}
+	return redirect.Query().Get("code")
+}
+
+func TestExchange(t *testing.T) {
+	mock, provider := setupProvider(t)
+	verifier, _ := NewVerifier()
+	code := signIn(t, mock, provider, verifier, "nonce")
+	claims, err := provider.Exchange(context.Background(), code, verifier, "nonce")
+	if err != nil {
+		t.Fatalf("Exchange: err: %v", err)
+	}
+	if claims.Subject != "sub-1" || claims.Email != "alice@example.com" || !claims.EmailVerified || claims.Name != "Alice" {
+		t.Fatalf("Exchange: unexpected claims %+v", claims)
+	}
+	if _, err := provider.Exchange(context.Background(), code, verifier, "nonce"); err == nil {
+		t.Fatalf("Exchange: expected code to be single use")
+	}
+}
+
+func TestExchange_RejectsWrongVerifierAndNonce(t *testing.T) {
+	mock, provider := setupProvider(t)
+	verifier, _ := NewVerifier()
+	code := signIn(t, mock, provider, verifier, "nonce")
+	if _, err := provider.Exchange(context.Background(), code, "other verifier", "nonce"); err == nil {
+		t.Fatalf("Exchange: expected wrong verifier to be rejected")
+	}
+	code = signIn(t, mock, provider, verifier, "nonce")
+	_, err := provider.Exchange(context.Background(), code, verifier, "other nonce")
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Exchange: expected ErrInvalidToken for nonce mismatch got %v", err)
+	}
+}
+
+func TestVerify_Claims(t *testing.T) {
+	mock, provider := setupProvider(t)
+	document, err := provider.getDiscovery(context.Background())
+	if err != nil {
+		t.Fatalf("getDiscovery: err: %v", err)
+	}
+	now := time.Now()
+	valid := func() map[string]any {
+		return map[string]any{
+			"iss":   mock.Issuer(),
+			"aud":   []string{"other", "chat"},
+			"sub":   "sub-1",
+			"nonce": "n",
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Minute).Unix(),
+			// providers disagree on the type of this claim
+			"email_verified": "true",
+		}
+	}
+	token, _ := mock.Sign(valid())
+	claims, err := provider.verify(context.Background(), document, token, "n")
+	if err != nil || !claims.EmailVerified {
+		t.Fatalf("verify: unexpected %+v err: %v", claims, err)
+	}
+	for name, change := range map[string]func(map[string]any){
+		"issuer":   func(c map[string]any) { c["iss"] = "http://evil.example.com" },
+		"audience": func(c map[string]any) { c["aud"] = "other" },
+		"expired":  func(c map[string]any) { c["exp"] = now.Add(-time.Hour).Unix() },
+		"future":   func(c map[string]any) { c["iat"] = now.Add(time.Hour).Unix() },
+		"subject":  func(c map[string]any) { delete(c, "sub") },
+	} {
+		claims := valid()
+		change(claims)
+		token, _ := mock.Sign(claims)
+		if _, err := provider.verify(context.Background(), document, token, "n"); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("verify %s: expected ErrInvalidToken got %v", name, err)
+		}
+	}
+	// tampering with the payload breaks the signature
+	other, _ := mock.Sign(map[string]any{"sub": "sub-2"})
+	forged := other[:strings.LastIndex(other, ".")] + token[strings.LastIndex(token, "."):]
+	if _, err := provider.verify(context.Background(), document, forged, "n"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("verify: expected forged token to be rejected got %v", err)
+	}
+}
+
+func TestConfigsFromEnv(t *testing.T) {
+	t.Setenv("OIDC_PROVIDERS", "corp, google")
+	t.Setenv("OIDC_CORP_ISSUER", "https://idp.example.com")
+	t.Setenv("OIDC_CORP_CLIENT_ID", "chat")
+	t.Setenv("OIDC_CORP_SCOPES", "openid email")
+	t.Setenv("OIDC_GOOGLE_ISSUER", "https://accounts.google.com")
+	t.Setenv("OIDC_GOOGLE_CLIENT_ID", "chat-google")
+	configs, err := ConfigsFromEnv("http://localhost:8080/")
+	if err != nil {
+		t.Fatalf("ConfigsFromEnv: err: %v", err)
+	}
+	if len(configs) != 2 || configs[0].Name != "corp" || len(configs[0].Scopes) != 2 {
+		t.Fatalf("ConfigsFromEnv: unexpected %+v", configs)
+	}
+	if configs[1].RedirectURL != "http://localhost:8080/api/auth/oidc/google/callback" {
+		t.Fatalf("ConfigsFromEnv: unexpected redirect %s", configs[1].RedirectURL)
+	}
+	t.Setenv("OIDC_PROVIDERS", "missing")
+	if _, err := ConfigsFromEnv(""); err == nil {
+		t.Fatalf("ConfigsFromEnv: expected error for unconfigured provider")
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"go-chat-react/internal/database"
+)
+
+const (
+	defaultDeletionGracePeriod = 14 * 24 * time.Hour
+	accountDeletionInterval    = 10 * time.Minute
+)
+
+// deletionGracePeriodFromEnv reads how long deleted accounts can still be
+// restored by logging in from ACCOUNT_DELETION_GRACE_PERIOD.
+func deletionGracePeriodFromEnv() time.Duration {
+	value := os.Getenv("ACCOUNT_DELETION_GRACE_PERIOD")
+	if value == "" {
+		return defaultDeletionGracePeriod
+	}
+	grace, err := time.ParseDuration(value)
+	if err != nil || grace < 0 {
+		log.Fatalf("invalid ACCOUNT_DELETION_GRACE_PERIOD %q", value)
+	}
+	return grace
+}
+
+// accountDeletionWorker periodically removes the accounts whose deletion
+// grace period has ended.
+type accountDeletionWorker struct {
+	server   *Server
+	interval time.Duration
+}
+
+func newAccountDeletionWorker(server *Server, interval time.Duration) *accountDeletionWorker {
+	return &accountDeletionWorker{server: server, interval: interval}
+}
+
+func (w *accountDeletionWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := w.process(ctx, now); err != nil {
+				log.Printf("accountDeletionWorker: %v", err)
+			}
+		}
+	}
+}
+
+func (w *accountDeletionWorker) process(ctx context.Context, now time.Time) error {
+	deletions, err := w.server.db.GetDueAccountDeletions(now)
+	if err != nil {
+		return err
+	}
+	for _, deletion := range deletions {
+		if err := w.server.purgeAccount(ctx, deletion); err != nil {
+			log.Printf("accountDeletionWorker: user %d: %v", deletion.UserId, err)
+		}
+	}
+	return nil
+}
+
+// purgeAccount deletes an account, removes the blobs it leaves behind and
+// disconnects any session still open.
+func (s *Server) purgeAccount(ctx context.Context, deletion database.AccountDeletion) error {
+	// bots cannot outlive the account that manages them
+	bots, err := s.db.GetBotsOfUser(deletion.UserId)
+	if err != nil {
+		return err
+	}
+	for _, bot := range bots {
+		if err := s.purgeAccount(ctx, database.AccountDeletion{UserId: bot.UserId}); err != nil {
+			return err
+		}
+	}
+	peers := s.serverPeers(deletion.UserId)
+	servers, err := s.db.GetServersOfUser(deletion.UserId)
+	if err != nil {
+		return err
+	}
+	deleted, err := s.db.DeleteUserAccount(deletion.UserId, deletion.RemoveMessages)
+	if err != nil {
+		return err
+	}
+	for _, server := range servers {
+		s.publishEvent(server.ServerId, eventMemberLeft, channelMemberEvent{UserId: deletion.UserId})
+	}
+	if deleted.AvatarKey != "" {
+		s.deleteBlob(ctx, deleted.AvatarKey)
+	}
+	s.deleteAttachments(ctx, deleted.Attachments)
+	s.closeSessionsOfUser(deletion.UserId)
+
+	user, err := s.db.GetUser(deletion.UserId)
+	if err != nil {
+		return err
+	}
+	byte_data, err := newServerResponse("user_updated", fromDBUserToProfile(user))
+	if err != nil {
+		return err
+	}
+	for _, peer := range peers {
+		s.sendToUser(peer, byte_data)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"go-chat-react/internal/database"
+	"go-chat-react/internal/storage"
+)
+
+// Admin performs operator tasks directly on the database, for tools such as
+// chatctl that run beside the server instead of going through its API. The
+// rules and side effects match the routes doing the same thing: passwords
+// follow the policy, sessions are revoked and server events are queued for
+// the running instance to deliver.
+type Admin struct {
+	server *Server
+}
+
+// NewAdmin prepares admin tasks on db, removing the blobs of deleted
+// accounts from blobs. The password policy is read from the environment
+// like the server's.
+func NewAdmin(db Service, blobs storage.BlobStore) (*Admin, error) {
+	passwords, err := passwordPolicyFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	s := New(db, blobs)
+	s.passwords = passwords
+	return &Admin{server: s}, nil
+}
+
+// checkPassword applies the password policy, without the "error: " prefix
+// meant for API responses.
+func (a *Admin) checkPassword(username string, password string) error {
+	if err := a.server.passwords.check(username, password); err != nil {
+		return errors.New(strings.TrimPrefix(err.Error(), "error: "))
+	}
+	return nil
+}
+
+// CreateUser creates an account with a password following the policy.
+func (a *Admin) CreateUser(username string, password string) (database.Id, error) {
+	if err := a.checkPassword(username, password); err != nil {
+		return 0, err
+	}
+	return a.server.db.CreateUser(username, password)
+}
+
+// ResetPassword sets a new password and signs the user out everywhere.
+func (a *Admin) ResetPassword(userid database.Id, password string) error {
+	user, err := a.server.db.GetUser(userid)
+	if err != nil {
+		return err
+	}
+	if err := a.checkPassword(user.UserName, password); err != nil {
+		return err
+	}
+	if err := a.server.db.UpdateUserPassword(userid, password); err != nil {
+		return err
+	}
+	return a.server.db.DeleteUserSessionToken(userid)
+}
+
+// DeleteAccount deletes an account and its bots right away, skipping the
+// grace period users get when they delete their own. removeMessages also
+// deletes everything they posted, as for spam accounts.
+func (a *Admin) DeleteAccount(ctx context.Context, userid database.Id, removeMessages bool) error {
+	if _, err := a.server.db.GetUser(userid); err != nil {
+		return err
+	}
+	return a.server.purgeAccount(ctx, database.AccountDeletion{UserId: userid, RemoveMessages: removeMessages})
+}
+
+// CreateChannel adds a channel to a server.
+func (a *Admin) CreateChannel(serverid database.Id, name string) (database.Id, error) {
+	if _, err := a.server.db.GetServer(serverid); err != nil {
+		return 0, err
+	}
+	channelid, err := a.server.db.AddChannel(serverid, name)
+	if err != nil {
+		return 0, err
+	}
+	if channel, err := a.server.db.GetChannel(channelid); err == nil {
+		a.server.publishEvent(serverid, eventChannelCreated, fromDBChannelToChannelInfo(channel))
+	}
+	return channelid, nil
+}
+
+// RenameChannel changes the name of a channel.
+func (a *Admin) RenameChannel(channelid database.Id, name string) error {
+	if _, err := a.server.db.GetChannel(channelid); err != nil {
+		return err
+	}
+	if err := a.server.db.UpdateChannel(channelid, name); err != nil {
+		return err
+	}
+	if channel, err := a.server.db.GetChannel(channelid); err == nil {
+		a.server.publishEvent(channel.ServerId, eventChannelUpdated, fromDBChannelToChannelInfo(channel))
+	}
+	return nil
+}
+
+// DeleteChannel deletes a channel.
+func (a *Admin) DeleteChannel(channelid database.Id) error {
+	channel, err := a.server.db.GetChannel(channelid)
+	if err != nil {
+		return err
+	}
+	if err := a.server.db.DeleteChannel(channelid); err != nil {
+		return err
+	}
+	a.server.publishEvent(channel.ServerId, eventChannelDeleted, fromDBChannelToChannelInfo(channel))
+	return nil
+}
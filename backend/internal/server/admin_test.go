@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go-chat-react/internal/database"
+	"go-chat-react/internal/storage"
+)
+
+func TestAdmin(t *testing.T) {
+	db := NewInMemoryDB()
+	admin, err := NewAdmin(db, storage.NewLocalStore(t.TempDir()))
+	if err != nil {
+		t.Fatalf("NewAdmin: err: %v", err)
+	}
+	if _, err := admin.CreateUser("spammer", "short"); err == nil {
+		t.Fatalf("CreateUser: expected the password policy to reject a short password")
+	}
+	userid, err := admin.CreateUser("spammer", "correct horse battery")
+	if err != nil {
+		t.Fatalf("CreateUser: err: %v", err)
+	}
+	if err := admin.ResetPassword(userid, "spammer2024!"); err == nil {
+		t.Fatalf("ResetPassword: expected a password containing the username to be rejected")
+	}
+	if err := admin.ResetPassword(userid, "staple battery horse"); err != nil {
+		t.Fatalf("ResetPassword: err: %v", err)
+	}
+	if valid, err := db.ValidateUserLoginInfo(userid, "staple battery horse"); err != nil || !valid {
+		t.Fatalf("ValidateUserLoginInfo: expected the new password to work, got %v err: %v", valid, err)
+	}
+
+	if err := db.AddUserToServer(userid, 1, ""); err != nil {
+		t.Fatalf("AddUserToServer: err: %v", err)
+	}
+	messageid, err := db.AddMessage(1, userid, "buy now")
+	if err != nil {
+		t.Fatalf("AddMessage: err: %v", err)
+	}
+	if err := admin.DeleteAccount(context.Background(), userid, true); err != nil {
+		t.Fatalf("DeleteAccount: err: %v", err)
+	}
+	if _, err := db.GetMessage(messageid); err == nil {
+		t.Fatalf("GetMessage: expected the messages of the account removed")
+	}
+	if member, _ := db.IsUserInServer(userid, 1); member {
+		t.Fatalf("IsUserInServer: expected the account removed from its servers")
+	}
+	if err := admin.DeleteAccount(context.Background(), 99, true); err == nil {
+		t.Fatalf("DeleteAccount: expected an error for a missing account")
+	}
+
+	channelid, err := admin.CreateChannel(1, "announcements")
+	if err != nil {
+		t.Fatalf("CreateChannel: err: %v", err)
+	}
+	if err := admin.RenameChannel(channelid, "news"); err != nil {
+		t.Fatalf("RenameChannel: err: %v", err)
+	}
+	if channel, _ := db.GetChannel(channelid); channel.ChannelName != "news" {
+		t.Fatalf("RenameChannel: expected news, got %q", channel.ChannelName)
+	}
+	if err := admin.DeleteChannel(channelid); err != nil {
+		t.Fatalf("DeleteChannel: err: %v", err)
+	}
+	if _, err := db.GetChannel(channelid); err == nil {
+		t.Fatalf("GetChannel: expected the channel deleted")
+	}
+	if _, err := admin.CreateChannel(99, "nowhere"); !errors.Is(err, database.ErrRecordNotFound) {
+		t.Fatalf("CreateChannel: expected ErrRecordNotFound, got %v", err)
+	}
+}
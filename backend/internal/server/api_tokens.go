@@ -0,0 +1,184 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"go-chat-react/internal/database"
+)
+
+// Scopes limit what an API token may do on behalf of its user.
+const (
+	scopeUsersRead      = "users:read"
+	scopeProfileWrite   = "profile:write"
+	scopeServersRead    = "servers:read"
+	scopeServersManage  = "servers:manage"
+	scopeChannelsManage = "channels:manage"
+	scopeMessagesRead   = "messages:read"
+	scopeMessagesWrite  = "messages:write"
+	scopeCommandsManage = "commands:manage"
+)
+
+var apiScopes = []string{
+	scopeUsersRead,
+	scopeProfileWrite,
+	scopeServersRead,
+	scopeServersManage,
+	scopeChannelsManage,
+	scopeMessagesRead,
+	scopeMessagesWrite,
+	scopeCommandsManage,
+}
+
+// routeScopes maps the pattern of every route reachable with an API token to
+// the scope it needs. Routes missing here, such as credential, token and bot
+// management, only accept a browser session.
+var routeScopes = map[string]string{
+	"/websocket": scopeMessagesRead,
+
+	"POST /api/auth/session":            scopeUsersRead,
+	"GET /api/users/{userid}/servers":   scopeUsersRead,
+	"GET /api/users/{userid}/usernames": scopeUsersRead,
+
+	"PATCH /api/users/{userid}":                         scopeProfileWrite,
+	"PATCH /api/users/me/profile":                       scopeProfileWrite,
+	"PUT /api/users/me/avatar":                          scopeProfileWrite,
+	"DELETE /api/users/me/avatar":                       scopeProfileWrite,
+	"PATCH /api/servers/{serverid}/members/me/nickname": scopeProfileWrite,
+
+	"GET /api/servers/{serverid}/channels":                                  scopeServersRead,
+	"GET /api/servers/{serverid}/members":                                   scopeServersRead,
+	"GET /api/servers/{serverid}/members/{userid}/nicknames":                scopeServersRead,
+	"GET /api/channels/{channelid}":                                         scopeServersRead,
+	"GET /api/channels/{channelid}/members":                                 scopeServersRead,
+	"POST /api/servers":                                                     scopeServersManage,
+	"PATCH /api/servers/{serverid}":                                         scopeServersManage,
+	"DELETE /api/servers/{serverid}":                                        scopeServersManage,
+	"PATCH /api/servers/{serverid}/members/{userid}/nickname":               scopeServersManage,
+	"GET /api/servers/{serverid}/outgoing-webhooks":                         scopeServersManage,
+	"POST /api/servers/{serverid}/outgoing-webhooks":                        scopeServersManage,
+	"PATCH /api/servers/{serverid}/outgoing-webhooks/{endpointid}":          scopeServersManage,
+	"DELETE /api/servers/{serverid}/outgoing-webhooks/{endpointid}":         scopeServersManage,
+	"GET /api/servers/{serverid}/outgoing-webhooks/{endpointid}/deliveries": scopeServersManage,
+	"GET /api/servers/{serverid}/audit-log":                                 scopeServersManage,
+	"GET /api/servers/{serverid}/restrictions":                              scopeServersManage,
+	"POST /api/servers/{serverid}/restrictions":                             scopeServersManage,
+	"DELETE /api/servers/{serverid}/restrictions/{restrictionid}":           scopeServersManage,
+
+	"POST /api/servers/{serverid}/channels":                 scopeChannelsManage,
+	"PATCH /api/channels/{channelid}":                       scopeChannelsManage,
+	"DELETE /api/channels/{channelid}":                      scopeChannelsManage,
+	"POST /api/channels/{channelid}/members":                scopeChannelsManage,
+	"DELETE /api/channels/{channelid}/members":              scopeChannelsManage,
+	"GET /api/channels/{channelid}/webhooks":                scopeChannelsManage,
+	"POST /api/channels/{channelid}/webhooks":               scopeChannelsManage,
+	"DELETE /api/channels/{channelid}/webhooks/{webhookid}": scopeChannelsManage,
+
+	"GET /api/servers/{serverid}/messages":                                scopeMessagesRead,
+	"GET /api/channels/{channelid}/messages":                              scopeMessagesRead,
+	"GET /api/channels/{channelid}/messages/{messageid}/thread":           scopeMessagesRead,
+	"GET /api/channels/{channelid}/pins":                                  scopeMessagesRead,
+	"GET /api/channels/{channelid}/commands":                              scopeMessagesRead,
+	"GET /api/channels/{channelid}/commands/autocomplete":                 scopeMessagesRead,
+	"GET /api/attachments/{attachmentid}":                                 scopeMessagesRead,
+	"GET /api/attachments/{attachmentid}/thumbnails/{size}":               scopeMessagesRead,
+	"GET /api/users/me/dms":                                               scopeMessagesRead,
+	"POST /api/channels/{channelid}/messages":                             scopeMessagesWrite,
+	"PATCH /api/channels/{channelid}/messages/{messageid}":                scopeMessagesWrite,
+	"DELETE /api/channels/{channelid}/messages/{messageid}":               scopeMessagesWrite,
+	"POST /api/channels/{channelid}/messages/{messageid}/thread":          scopeMessagesWrite,
+	"PUT /api/channels/{channelid}/messages/{messageid}/thread/follow":    scopeMessagesWrite,
+	"DELETE /api/channels/{channelid}/messages/{messageid}/thread/follow": scopeMessagesWrite,
+	"PUT /api/channels/{channelid}/pins/{messageid}":                      scopeMessagesWrite,
+	"DELETE /api/channels/{channelid}/pins/{messageid}":                   scopeMessagesWrite,
+	"POST /api/channels/{channelid}/attachments":                          scopeMessagesWrite,
+	"POST /api/users/me/dms":                                              scopeMessagesWrite,
+	"PUT /api/dms/{channelid}/participants/{userid}":                      scopeMessagesWrite,
+	"DELETE /api/dms/{channelid}/participants/{userid}":                   scopeMessagesWrite,
+	"POST /api/interactions/{interactionid}":                              scopeMessagesWrite,
+
+	"GET /api/users/me/commands": scopeCommandsManage,
+	"PUT /api/users/me/commands": scopeCommandsManage,
+}
+
+const apiTokenPrefix = "gct_"
+
+var (
+	errInvalidAPIToken = errors.New("invalid api token")
+	errUnknownScope    = errors.New("unknown scope")
+)
+
+// newAPIToken returns a fresh bearer secret and the hash it is stored under.
+func newAPIToken() (string, string) {
+	secret := apiTokenPrefix + rand.Text()
+	return secret, hashAPIToken(secret)
+}
+
+func hashAPIToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func validateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if !slices.Contains(apiScopes, scope) {
+			return errUnknownScope
+		}
+	}
+	return nil
+}
+
+// bearerToken returns the secret of an Authorization: Bearer header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, secret, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(secret), true
+}
+
+// authenticateAPIToken resolves a bearer secret to its token and records the
+// use. Tokens stop working while the account, or the owner of a bot, is
+// pending deletion; signing in again cancels that and restores them.
+func (s *Server) authenticateAPIToken(secret string, now time.Time) (database.APIToken, error) {
+	if !strings.HasPrefix(secret, apiTokenPrefix) {
+		return database.APIToken{}, errInvalidAPIToken
+	}
+	token, err := s.db.GetAPITokenByHash(hashAPIToken(secret))
+	if errors.Is(err, database.ErrRecordNotFound) {
+		return database.APIToken{}, errInvalidAPIToken
+	}
+	if err != nil {
+		return database.APIToken{}, err
+	}
+	if token.Expires != nil && now.After(*token.Expires) {
+		return database.APIToken{}, errInvalidAPIToken
+	}
+	pending, err := s.db.IsDeletionPending(token.UserId)
+	if err != nil {
+		return database.APIToken{}, err
+	}
+	if pending {
+		return database.APIToken{}, errInvalidAPIToken
+	}
+	if err := s.db.TouchAPIToken(token.TokenId, now); err != nil {
+		return database.APIToken{}, err
+	}
+	return token, nil
+}
+
+// hasScope reports whether a request may use scope. Browser sessions carry
+// no scopes and may do anything their user can.
+func hasScope(r *http.Request, scope string) bool {
+	scopes, ok := r.Context().Value("scopes").([]string)
+	if !ok {
+		return true
+	}
+	return slices.Contains(scopes, scope)
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"go-chat-react/internal/database"
+)
+
+const (
+	tokenPurposePasswordReset  = "password_reset"
+	tokenPurposeVerifyEmail    = "verify_email"
+	tokenPurposeLoginChallenge = "login_challenge"
+
+	passwordResetTokenLifetime     = time.Hour
+	emailVerificationTokenLifetime = 48 * time.Hour
+	loginChallengeLifetime         = 5 * time.Minute
+)
+
+var errInvalidAuthToken = errors.New("invalid or expired token")
+
+// tokenSigner signs the ids of emailed tokens so forged or mistyped tokens
+// are rejected before touching the database. The signature covers the
+// purpose, which keeps a token from being redeemed for something else.
+type tokenSigner struct {
+	key []byte
+}
+
+func newTokenSigner(key []byte) *tokenSigner {
+	return &tokenSigner{key: key}
+}
+
+// tokenSignerFromEnv reads the signing key from AUTH_TOKEN_SECRET. Without
+// one a random key is used, which invalidates outstanding tokens on restart.
+func tokenSignerFromEnv() *tokenSigner {
+	secret := os.Getenv("AUTH_TOKEN_SECRET")
+	if secret != "" {
+		return newTokenSigner([]byte(secret))
+	}
+	log.Printf("AUTH_TOKEN_SECRET not set, emailed links will not survive a restart")
+	return newRandomTokenSigner()
+}
+
+// newRandomTokenSigner signs with a fresh key, so its tokens only last as
+// long as the process.
+func newRandomTokenSigner() *tokenSigner {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatal(err)
+	}
+	return newTokenSigner(key)
+}
+
+func (t *tokenSigner) mac(purpose string, tokenid string) []byte {
+	mac := hmac.New(sha256.New, t.key)
+	mac.Write([]byte(purpose + ":" + tokenid))
+	return mac.Sum(nil)
+}
+
+func (t *tokenSigner) sign(purpose string, tokenid string) string {
+	return tokenid + "." + base64.RawURLEncoding.EncodeToString(t.mac(purpose, tokenid))
+}
+
+// verify returns the token id of a signed token.
+func (t *tokenSigner) verify(purpose string, token string) (string, error) {
+	tokenid, signature, found := strings.Cut(token, ".")
+	if !found {
+		return "", errInvalidAuthToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, t.mac(purpose, tokenid)) {
+		return "", errInvalidAuthToken
+	}
+	return tokenid, nil
+}
+
+// issueAuthToken stores a new single-use token and returns its signed form
+// to be emailed to the user.
+func (s *Server) issueAuthToken(
+	userid database.Id,
+	purpose string,
+	email string,
+	lifetime time.Duration,
+) (string, error) {
+	id := make([]byte, 24)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	tokenid := base64.RawURLEncoding.EncodeToString(id)
+	err := s.db.CreateAuthToken(database.AuthToken{
+		TokenId: tokenid,
+		UserId:  userid,
+		Purpose: purpose,
+		Email:   email,
+		Expires: time.Now().Add(lifetime),
+	})
+	if err != nil {
+		return "", err
+	}
+	return s.authTokens.sign(purpose, tokenid), nil
+}
+
+// checkAuthToken checks a signed token without using it up, so a request
+// that is refused for other reasons can be retried with the same link.
+func (s *Server) checkAuthToken(purpose string, token string) (database.AuthToken, error) {
+	tokenid, err := s.authTokens.verify(purpose, token)
+	if err != nil {
+		return database.AuthToken{}, err
+	}
+	stored, err := s.db.GetAuthToken(tokenid, purpose)
+	if errors.Is(err, database.ErrRecordNotFound) {
+		return database.AuthToken{}, errInvalidAuthToken
+	}
+	if err != nil {
+		return database.AuthToken{}, err
+	}
+	if time.Now().After(stored.Expires) {
+		return database.AuthToken{}, errInvalidAuthToken
+	}
+	return stored, nil
+}
+
+// redeemAuthToken checks a signed token and uses it up.
+func (s *Server) redeemAuthToken(purpose string, token string) (database.AuthToken, error) {
+	tokenid, err := s.authTokens.verify(purpose, token)
+	if err != nil {
+		return database.AuthToken{}, err
+	}
+	stored, err := s.db.ConsumeAuthToken(tokenid, purpose)
+	if errors.Is(err, database.ErrRecordNotFound) {
+		return database.AuthToken{}, errInvalidAuthToken
+	}
+	if err != nil {
+		return database.AuthToken{}, err
+	}
+	if time.Now().After(stored.Expires) {
+		return database.AuthToken{}, errInvalidAuthToken
+	}
+	return stored, nil
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+
+	"go-chat-react/internal/database"
+)
+
+func newServerResponse(message_type string, payload any) ([]byte, error) {
+	return json.Marshal(ServerResponseMessage{Message_type: message_type, Payload: payload})
+}
+
+// addSession records a websocket client as listening to every server the user
+// belongs to, as well as to events addressed to the user directly. It reports
+// whether this is the first session of the user.
+func (s *Server) addSession(id string, userid database.Id, servers []database.Server) bool {
+	s.sessions_mutex.Lock()
+	defer s.sessions_mutex.Unlock()
+	if s.sessions_in_channel == nil {
+		s.sessions_in_channel = make(map[database.Id]map[string]bool)
+	}
+	if s.sessions_of_user == nil {
+		s.sessions_of_user = make(map[database.Id]map[string]bool)
+	}
+	for _, server := range servers {
+		if _, ok := s.sessions_in_channel[server.ServerId]; !ok {
+			s.sessions_in_channel[server.ServerId] = make(map[string]bool)
+		}
+		s.sessions_in_channel[server.ServerId][id] = true
+	}
+	first := len(s.sessions_of_user[userid]) == 0
+	if _, ok := s.sessions_of_user[userid]; !ok {
+		s.sessions_of_user[userid] = make(map[string]bool)
+	}
+	s.sessions_of_user[userid][id] = true
+	return first
+}
+
+// removeSession undoes addSession and reports whether it removed the last
+// session of the user.
+func (s *Server) removeSession(id string, userid database.Id, servers []database.Server) bool {
+	s.sessions_mutex.Lock()
+	defer s.sessions_mutex.Unlock()
+	for _, server := range servers {
+		if _, ok := s.sessions_in_channel[server.ServerId]; !ok {
+			continue
+		}
+		delete(s.sessions_in_channel[server.ServerId], id)
+		if len(s.sessions_in_channel[server.ServerId]) == 0 {
+			delete(s.sessions_in_channel, server.ServerId)
+		}
+	}
+	if _, ok := s.sessions_of_user[userid]; ok {
+		delete(s.sessions_of_user[userid], id)
+		if len(s.sessions_of_user[userid]) == 0 {
+			delete(s.sessions_of_user, userid)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) broadcastToServer(serverid database.Id, data []byte) {
+	s.sessions_mutex.RLock()
+	defer s.sessions_mutex.RUnlock()
+	for k := range s.sessions_in_channel[serverid] {
+		s.ws_manager.SendToClient(k, data)
+	}
+}
+
+// broadcastToChannel delivers a channel event to everyone who can see the
+// channel: all sessions of the server, or for direct message conversations
+// every participant.
+func (s *Server) broadcastToChannel(serverid database.Id, channelid database.Id, data []byte) {
+	if serverid != 0 {
+		s.broadcastToServer(serverid, data)
+		return
+	}
+	participants, err := s.db.GetUsersInChannel(channelid)
+	if err != nil {
+		log.Printf("broadcastToChannel: unable to fetch participants of %d: %v", channelid, err)
+		return
+	}
+	for _, participant := range participants {
+		s.sendToUser(participant.UserId, data)
+	}
+}
+
+// broadcastMembership tells everyone who can see a channel that a user
+// joined or left it.
+func (s *Server) broadcastMembership(message_type string, channel database.Channel, userid database.Id) {
+	byte_data, err := newServerResponse(message_type, map[string]any{
+		"serverid":  channel.ServerId,
+		"channelid": channel.ChannelId,
+		"userid":    userid,
+	})
+	if err != nil {
+		log.Printf("broadcastMembership: error marshalling %s: %v", message_type, err)
+		return
+	}
+	s.broadcastToChannel(channel.ServerId, channel.ChannelId, byte_data)
+}
+
+func (s *Server) sendToUser(userid database.Id, data []byte) {
+	s.sessions_mutex.RLock()
+	defer s.sessions_mutex.RUnlock()
+	for k := range s.sessions_of_user[userid] {
+		s.ws_manager.SendToClient(k, data)
+	}
+}
+
+// broadcastPresence tells everyone who shares a server with the user, as well
+// as their friends, that the user came online or went offline. Users the
+// subject has blocked are left out.
+func (s *Server) broadcastPresence(userid database.Id, status string) {
+	byte_data, err := newServerResponse("presence_updated", map[string]any{
+		"userid": userid,
+		"status": status,
+	})
+	if err != nil {
+		log.Printf("broadcastPresence: error marshalling presence: %v", err)
+		return
+	}
+	for _, recipient := range s.presenceAudience(userid) {
+		s.sendToUser(recipient, byte_data)
+	}
+}
+
+func (s *Server) presenceAudience(userid database.Id) []database.Id {
+	excluded := map[database.Id]bool{userid: true}
+	blocked, err := s.db.GetBlockedUsers(userid)
+	if err != nil {
+		log.Printf("presenceAudience: unable to fetch blocked users of %d: %v", userid, err)
+		return nil
+	}
+	for _, user := range blocked {
+		excluded[user.UserId] = true
+	}
+	var audience []database.Id
+	add := func(id database.Id) {
+		if !excluded[id] {
+			excluded[id] = true
+			audience = append(audience, id)
+		}
+	}
+	if friends, err := s.db.GetFriends(userid); err == nil {
+		for _, friend := range friends {
+			add(friend.UserId)
+		}
+	} else {
+		log.Printf("presenceAudience: unable to fetch friends of %d: %v", userid, err)
+	}
+	for _, peer := range s.serverPeers(userid) {
+		add(peer)
+	}
+	return audience
+}
+
+// serverPeers returns every user sharing at least one server with userid,
+// not including userid itself.
+func (s *Server) serverPeers(userid database.Id) []database.Id {
+	servers, err := s.db.GetServersOfUser(userid)
+	if err != nil {
+		log.Printf("serverPeers: unable to fetch servers of %d: %v", userid, err)
+		return nil
+	}
+	seen := map[database.Id]bool{userid: true}
+	var peers []database.Id
+	for _, server := range servers {
+		members, err := s.db.GetUsersOfServer(server.ServerId)
+		if err != nil {
+			log.Printf("serverPeers: unable to fetch members of %d: %v", server.ServerId, err)
+			continue
+		}
+		for _, member := range members {
+			if !seen[member.UserId] {
+				seen[member.UserId] = true
+				peers = append(peers, member.UserId)
+			}
+		}
+	}
+	return peers
+}
+
+// closeSessionsOfUser disconnects every websocket of a user.
+func (s *Server) closeSessionsOfUser(userid database.Id) {
+	if s.ws_manager == nil {
+		return
+	}
+	s.sessions_mutex.RLock()
+	var ids []string
+	for id := range s.sessions_of_user[userid] {
+		ids = append(ids, id)
+	}
+	s.sessions_mutex.RUnlock()
+	for _, id := range ids {
+		s.ws_manager.CloseConnection(id)
+	}
+}
@@ -0,0 +1,648 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-chat-react/internal/database"
+	"go-chat-react/internal/markdown"
+)
+
+const (
+	// bots answering over their websocket have this long to respond
+	commandInteractionTTL  = 15 * time.Minute
+	commandCallbackTimeout = 3 * time.Second
+	maxCommandResponseSize = 16 << 10
+)
+
+var commandNamePattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// commandError is a problem with how a command was used. Its message is
+// shown to the invoker, unlike other errors which are only logged.
+type commandError struct {
+	message string
+}
+
+func (e commandError) Error() string {
+	return e.message
+}
+
+func commandErrorf(format string, args ...any) error {
+	return commandError{message: fmt.Sprintf(format, args...)}
+}
+
+// commandArgs holds the parsed arguments of an invocation by option name.
+// Values are string, int64, bool, database.Id (users and channels),
+// time.Duration, or a slice of those for variadic options.
+type commandArgs map[string]any
+
+func (a commandArgs) String(name string) string {
+	value, _ := a[name].(string)
+	return value
+}
+
+func (a commandArgs) Duration(name string) time.Duration {
+	value, _ := a[name].(time.Duration)
+	return value
+}
+
+func (a commandArgs) Strings(name string) []string {
+	var values []string
+	list, _ := a[name].([]any)
+	for _, value := range list {
+		if str, ok := value.(string); ok {
+			values = append(values, str)
+		}
+	}
+	return values
+}
+
+// forBots converts durations to whole seconds so every value has a plain
+// JSON representation.
+func (a commandArgs) forBots() map[string]any {
+	converted := make(map[string]any, len(a))
+	convert := func(value any) any {
+		if duration, ok := value.(time.Duration); ok {
+			return int64(duration.Seconds())
+		}
+		return value
+	}
+	for name, value := range a {
+		if list, ok := value.([]any); ok {
+			values := make([]any, len(list))
+			for i, item := range list {
+				values[i] = convert(item)
+			}
+			converted[name] = values
+			continue
+		}
+		converted[name] = convert(value)
+	}
+	return converted
+}
+
+type commandInvocation struct {
+	UserId  database.Id
+	Channel database.Channel
+	Name    string
+	Args    commandArgs
+}
+
+// commandResponse is what a command answers with. An empty response posts
+// nothing, an ephemeral one is only shown to the invoker.
+type commandResponse struct {
+	Content   string `json:"content"`
+	Ephemeral bool   `json:"ephemeral"`
+}
+
+// slashCommand is either a built-in with a run function or a command
+// registered by the bot BotId.
+type slashCommand struct {
+	Name        string
+	Description string
+	Options     []database.CommandOption
+	BotId       database.Id
+	run         func(ctx context.Context, s *Server, invocation commandInvocation) (commandResponse, error)
+}
+
+// commandOutcome tells the caller what became of an invocation: a message
+// was posted, an ephemeral response was sent, or the command was handed to
+// a bot that answers later.
+type commandOutcome struct {
+	Message       *database.Message
+	Ephemeral     *EphemeralMessage
+	InteractionId string
+}
+
+// EphemeralMessage is a command response that only its invoker sees. It is
+// pushed over the websocket and never stored. UserId is the bot that
+// answered, or zero for built-in commands.
+type EphemeralMessage struct {
+	ChannelId database.Id     `json:"channelid"`
+	ServerId  database.Id     `json:"serverid"`
+	UserId    database.Id     `json:"userid"`
+	Command   string          `json:"command"`
+	Message   string          `json:"message"`
+	AST       []markdown.Node `json:"ast"`
+	Date      string          `json:"date"`
+}
+
+// commandInteraction is sent to a bot when one of its commands is used.
+// The bot answers by posting to /api/interactions/{interactionid}, or
+// directly in the body of its callback response.
+type commandInteraction struct {
+	InteractionId string         `json:"interactionid"`
+	Command       string         `json:"command"`
+	Args          map[string]any `json:"args"`
+	UserId        database.Id    `json:"userid"`
+	ChannelId     database.Id    `json:"channelid"`
+	ServerId      database.Id    `json:"serverid"`
+	Timestamp     time.Time      `json:"timestamp"`
+}
+
+type pendingInteraction struct {
+	botid      database.Id
+	invocation commandInvocation
+	expires    time.Time
+}
+
+// commandRegistry holds the built-in commands and the bot interactions that
+// still await a response.
+type commandRegistry struct {
+	builtins map[string]slashCommand
+	client   *http.Client
+	giphy    *giphyClient
+
+	mu           sync.Mutex
+	interactions map[string]pendingInteraction
+}
+
+func newCommandRegistry(client *http.Client, giphy *giphyClient) *commandRegistry {
+	registry := &commandRegistry{
+		builtins:     make(map[string]slashCommand),
+		client:       client,
+		giphy:        giphy,
+		interactions: make(map[string]pendingInteraction),
+	}
+	for _, command := range builtinCommands(giphy != nil) {
+		registry.builtins[command.Name] = command
+	}
+	return registry
+}
+
+func (c *commandRegistry) startInteraction(botid database.Id, invocation commandInvocation, now time.Time) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, pending := range c.interactions {
+		if now.After(pending.expires) {
+			delete(c.interactions, id)
+		}
+	}
+	id := rand.Text()
+	c.interactions[id] = pendingInteraction{botid: botid, invocation: invocation, expires: now.Add(commandInteractionTTL)}
+	return id
+}
+
+// finishInteraction hands out a pending interaction of botid once.
+func (c *commandRegistry) finishInteraction(id string, botid database.Id, now time.Time) (commandInvocation, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pending, ok := c.interactions[id]
+	if !ok || pending.botid != botid || now.After(pending.expires) {
+		return commandInvocation{}, false
+	}
+	delete(c.interactions, id)
+	return pending.invocation, true
+}
+
+// parseSlashCommand splits "/name rest" into its parts. Text that merely
+// starts with a slash, such as a path, is not a command.
+func parseSlashCommand(contents string) (string, string, bool) {
+	if !strings.HasPrefix(contents, "/") {
+		return "", "", false
+	}
+	name, rest := contents[1:], ""
+	if end := strings.IndexAny(name, " \t\n"); end >= 0 {
+		name, rest = name[:end], name[end+1:]
+	}
+	name = strings.ToLower(name)
+	if !commandNamePattern.MatchString(name) {
+		return "", "", false
+	}
+	return name, rest, true
+}
+
+type commandToken struct {
+	value string
+	start int
+}
+
+// tokenizeCommand splits arguments on spaces, keeping "quoted phrases"
+// together.
+func tokenizeCommand(raw string) []commandToken {
+	var tokens []commandToken
+	i := 0
+	for i < len(raw) {
+		if raw[i] == ' ' || raw[i] == '\t' || raw[i] == '\n' {
+			i++
+			continue
+		}
+		start := i
+		if raw[i] == '"' {
+			end := strings.IndexByte(raw[i+1:], '"')
+			if end < 0 {
+				tokens = append(tokens, commandToken{value: raw[i+1:], start: start})
+				break
+			}
+			tokens = append(tokens, commandToken{value: raw[i+1 : i+1+end], start: start})
+			i += end + 2
+			continue
+		}
+		for i < len(raw) && raw[i] != ' ' && raw[i] != '\t' && raw[i] != '\n' {
+			i++
+		}
+		tokens = append(tokens, commandToken{value: raw[start:i], start: start})
+	}
+	return tokens
+}
+
+func commandUsage(name string, options []database.CommandOption) string {
+	usage := "/" + name
+	for _, option := range options {
+		label := option.Name
+		if option.Variadic {
+			label += "..."
+		}
+		if option.Required {
+			usage += " <" + label + ">"
+		} else {
+			usage += " [" + label + "]"
+		}
+	}
+	return usage
+}
+
+// parseCommandArgs matches the words after a command to its options in
+// order and converts each to the option type.
+func (s *Server) parseCommandArgs(channel database.Channel, command slashCommand, raw string) (commandArgs, error) {
+	tokens := tokenizeCommand(raw)
+	args := make(commandArgs)
+	usage := func(format string, a ...any) error {
+		return commandErrorf("%s (usage: %s)", fmt.Sprintf(format, a...), commandUsage(command.Name, command.Options))
+	}
+	consumed := 0
+	for i, option := range command.Options {
+		if option.Type == database.CommandOptionText {
+			if i < len(tokens) {
+				args[option.Name] = strings.TrimSpace(raw[tokens[i].start:])
+			}
+			consumed = len(tokens)
+		} else if option.Variadic {
+			var values []any
+			for _, token := range tokens[min(i, len(tokens)):] {
+				value, err := s.convertCommandArg(channel, option, token.value)
+				if err != nil {
+					return nil, usage("%v", err)
+				}
+				values = append(values, value)
+			}
+			if len(values) > 0 {
+				args[option.Name] = values
+			}
+			consumed = len(tokens)
+		} else if i < len(tokens) {
+			value, err := s.convertCommandArg(channel, option, tokens[i].value)
+			if err != nil {
+				return nil, usage("%v", err)
+			}
+			args[option.Name] = value
+			consumed = i + 1
+		}
+		if _, ok := args[option.Name]; !ok && option.Required {
+			return nil, usage("missing %s", option.Name)
+		}
+	}
+	if consumed < len(tokens) {
+		return nil, usage("too many arguments")
+	}
+	return args, nil
+}
+
+func (s *Server) convertCommandArg(channel database.Channel, option database.CommandOption, value string) (any, error) {
+	if len(option.Choices) > 0 && !slices.Contains(option.Choices, value) {
+		return nil, fmt.Errorf("%s must be one of %s", option.Name, strings.Join(option.Choices, ", "))
+	}
+	switch option.Type {
+	case database.CommandOptionInteger:
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a whole number", option.Name)
+		}
+		return number, nil
+	case database.CommandOptionBoolean:
+		flag, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be true or false", option.Name)
+		}
+		return flag, nil
+	case database.CommandOptionDuration:
+		duration, err := parseCommandDuration(value)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("%s must be a duration such as 10m, 2h or 3d", option.Name)
+		}
+		return duration, nil
+	case database.CommandOptionUser:
+		userid, err := s.db.GetUserIDFromUserName(strings.TrimPrefix(value, "@"))
+		if err != nil {
+			return nil, fmt.Errorf("unknown user %s", value)
+		}
+		var member bool
+		if channel.IsDirectMessage() {
+			member, err = s.db.IsUserInChannel(userid, channel.ChannelId)
+		} else {
+			member, err = s.db.IsUserInServer(userid, channel.ServerId)
+		}
+		if err != nil || !member {
+			return nil, fmt.Errorf("unknown user %s", value)
+		}
+		return userid, nil
+	case database.CommandOptionChannel:
+		name := strings.TrimPrefix(value, "#")
+		channels, err := s.db.GetChannelsOfServer(channel.ServerId)
+		if err == nil && !channel.IsDirectMessage() {
+			for _, candidate := range channels {
+				if candidate.ChannelName == name {
+					return candidate.ChannelId, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("unknown channel %s", value)
+	}
+	return value, nil
+}
+
+// parseCommandDuration accepts Go durations plus a "d" suffix for days.
+func parseCommandDuration(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		count, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(count) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// commandsForChannel lists the built-ins followed by the commands of bots
+// in the server. A bot command never shadows a built-in or an earlier bot.
+func (s *Server) commandsForChannel(channel database.Channel) ([]slashCommand, error) {
+	commands := make([]slashCommand, 0, len(s.commands.builtins))
+	for _, command := range s.commands.builtins {
+		commands = append(commands, command)
+	}
+	slices.SortFunc(commands, func(a, b slashCommand) int { return strings.Compare(a.Name, b.Name) })
+	if channel.IsDirectMessage() {
+		return commands, nil
+	}
+	botCommands, err := s.db.GetBotCommandsOfServer(channel.ServerId)
+	if err != nil {
+		return nil, err
+	}
+	for _, command := range botCommands {
+		if slices.ContainsFunc(commands, func(c slashCommand) bool { return c.Name == command.Name }) {
+			continue
+		}
+		commands = append(commands, slashCommand{
+			Name:        command.Name,
+			Description: command.Description,
+			Options:     command.Options,
+			BotId:       command.BotId,
+		})
+	}
+	return commands, nil
+}
+
+func (s *Server) findCommand(channel database.Channel, name string) (slashCommand, error) {
+	commands, err := s.commandsForChannel(channel)
+	if err != nil {
+		return slashCommand{}, err
+	}
+	for _, command := range commands {
+		if command.Name == name {
+			return command, nil
+		}
+	}
+	return slashCommand{}, commandErrorf("unknown command /%s, start the message with // to send it as text", name)
+}
+
+// runCommand executes a slash command typed by userid in channel. The
+// caller has already checked that the user may post there.
+func (s *Server) runCommand(ctx context.Context, userid database.Id, channel database.Channel, name string, raw string) (commandOutcome, error) {
+	command, err := s.findCommand(channel, name)
+	if err != nil {
+		return commandOutcome{}, err
+	}
+	args, err := s.parseCommandArgs(channel, command, raw)
+	if err != nil {
+		return commandOutcome{}, err
+	}
+	invocation := commandInvocation{UserId: userid, Channel: channel, Name: name, Args: args}
+	if command.BotId != 0 {
+		return s.dispatchToBot(ctx, command.BotId, invocation)
+	}
+	response, err := command.run(ctx, s, invocation)
+	if err != nil {
+		return commandOutcome{}, err
+	}
+	return s.respondToCommand(invocation, 0, response)
+}
+
+// respondToCommand posts the response of botid, or of a built-in when botid
+// is zero, or shows it to the invoker alone when it is ephemeral. Built-in
+// responses are posted in the name of the invoker.
+func (s *Server) respondToCommand(invocation commandInvocation, botid database.Id, response commandResponse) (commandOutcome, error) {
+	if response.Content == "" {
+		return commandOutcome{}, nil
+	}
+	if len(response.Content) > maxMessageLength {
+		return commandOutcome{}, commandErrorf("the response of /%s is too long", invocation.Name)
+	}
+	if response.Ephemeral {
+		ephemeral := s.sendEphemeral(invocation, botid, response.Content)
+		return commandOutcome{Ephemeral: &ephemeral}, nil
+	}
+	authorid := botid
+	if authorid == 0 {
+		authorid = invocation.UserId
+	}
+	messageid, err := s.db.CreateMessage(database.NewMessage{
+		ChannelId: invocation.Channel.ChannelId,
+		UserId:    authorid,
+		Contents:  response.Content,
+	})
+	if err != nil {
+		return commandOutcome{}, err
+	}
+	s.previews.Enqueue(messageid, response.Content)
+	dbmsg, err := s.db.GetMessage(messageid)
+	if err != nil {
+		return commandOutcome{}, err
+	}
+	smsg := fromDBMessageToSeverMessage(dbmsg)
+	if byte_data, err := newServerResponse("message", smsg); err == nil {
+		s.broadcastToChannel(dbmsg.ServerId, dbmsg.ChannelId, byte_data)
+	}
+	s.publishEvent(dbmsg.ServerId, eventMessageCreated, smsg)
+	return commandOutcome{Message: &dbmsg}, nil
+}
+
+// sendEphemeral pushes a message to the sessions of the invoker only.
+// botid is the bot that answered, zero when the server did.
+func (s *Server) sendEphemeral(invocation commandInvocation, botid database.Id, content string) EphemeralMessage {
+	ephemeral := EphemeralMessage{
+		ChannelId: invocation.Channel.ChannelId,
+		ServerId:  invocation.Channel.ServerId,
+		UserId:    botid,
+		Command:   invocation.Name,
+		Message:   content,
+		AST:       markdown.Parse(content),
+		Date:      time.Now().Format(time.UnixDate),
+	}
+	byte_data, err := newServerResponse("ephemeral_message", ephemeral)
+	if err != nil {
+		log.Printf("sendEphemeral: error marshalling message: %v", err)
+		return ephemeral
+	}
+	s.sendToUser(invocation.UserId, byte_data)
+	return ephemeral
+}
+
+// dispatchToBot hands an invocation to the bot owning the command. Bots
+// with a callback URL get a signed POST and may answer in its response;
+// the others receive a "command_invoked" event over their websocket.
+func (s *Server) dispatchToBot(ctx context.Context, botid database.Id, invocation commandInvocation) (commandOutcome, error) {
+	now := time.Now()
+	interactionid := s.commands.startInteraction(botid, invocation, now)
+	interaction := commandInteraction{
+		InteractionId: interactionid,
+		Command:       invocation.Name,
+		Args:          invocation.Args.forBots(),
+		UserId:        invocation.UserId,
+		ChannelId:     invocation.Channel.ChannelId,
+		ServerId:      invocation.Channel.ServerId,
+		Timestamp:     now.UTC(),
+	}
+	callback, err := s.db.GetBotCallback(botid)
+	if errors.Is(err, database.ErrRecordNotFound) {
+		if !s.isOnline(botid) {
+			s.commands.finishInteraction(interactionid, botid, now)
+			return commandOutcome{}, commandErrorf("the bot behind /%s is offline", invocation.Name)
+		}
+		byte_data, err := newServerResponse("command_invoked", interaction)
+		if err != nil {
+			return commandOutcome{}, err
+		}
+		s.sendToUser(botid, byte_data)
+		return commandOutcome{InteractionId: interactionid}, nil
+	}
+	if err != nil {
+		return commandOutcome{}, err
+	}
+
+	response, err := s.callBot(ctx, callback, interaction)
+	if err != nil {
+		log.Printf("dispatchToBot: callback of bot %d: %v", botid, err)
+		s.commands.finishInteraction(interactionid, botid, now)
+		return commandOutcome{}, commandErrorf("the bot behind /%s did not respond", invocation.Name)
+	}
+	if response == nil {
+		// the bot answers later through the interaction
+		return commandOutcome{InteractionId: interactionid}, nil
+	}
+	s.commands.finishInteraction(interactionid, botid, now)
+	return s.respondToCommand(invocation, botid, *response)
+}
+
+// callBot posts an interaction to a bot callback, signed like outgoing
+// webhooks. A nil response means the bot deferred its answer.
+func (s *Server) callBot(ctx context.Context, callback database.BotCallback, interaction commandInteraction) (*commandResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, commandCallbackTimeout)
+	defer cancel()
+	body, err := json.Marshal(interaction)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callback.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(eventTimestampHeader, timestamp)
+	req.Header.Set(eventSignatureHeader, signEventPayload(callback.Secret, timestamp, body))
+	resp, err := s.commands.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCommandResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	var response commandResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// reminderWorker delivers the reminders set with /remind. Reminders of
+// users that are offline wait until they are back.
+type reminderWorker struct {
+	server   *Server
+	interval time.Duration
+}
+
+const reminderInterval = 15 * time.Second
+
+func newReminderWorker(server *Server, interval time.Duration) *reminderWorker {
+	return &reminderWorker{server: server, interval: interval}
+}
+
+func (w *reminderWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := w.process(ctx, now); err != nil {
+				log.Printf("reminderWorker: %v", err)
+			}
+		}
+	}
+}
+
+func (w *reminderWorker) process(ctx context.Context, now time.Time) error {
+	s := w.server
+	reminders, err := s.db.GetDueReminders(now)
+	if err != nil {
+		return err
+	}
+	for _, reminder := range reminders {
+		if !s.isOnline(reminder.UserId) {
+			continue
+		}
+		channel, err := s.db.GetChannel(reminder.ChannelId)
+		if err != nil {
+			log.Printf("reminderWorker: reminder %d: %v", reminder.ReminderId, err)
+			continue
+		}
+		invocation := commandInvocation{UserId: reminder.UserId, Channel: channel, Name: "remind"}
+		s.sendEphemeral(invocation, 0, "⏰ Reminder: "+reminder.Message)
+		if err := s.db.DeleteReminder(reminder.ReminderId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"go-chat-react/internal/database"
+)
+
+const (
+	maxPollOptions   = 10
+	maxReminderDelay = 30 * 24 * time.Hour
+	giphyAPIURL      = "https://api.giphy.com"
+)
+
+var pollMarkers = []string{"1️⃣", "2️⃣", "3️⃣", "4️⃣", "5️⃣", "6️⃣", "7️⃣", "8️⃣", "9️⃣", "🔟"}
+
+// builtinCommands returns the commands handled by the server itself.
+// /giphy is only offered when a GIPHY_API_KEY is configured.
+func builtinCommands(withGiphy bool) []slashCommand {
+	commands := []slashCommand{
+		{
+			Name:        "help",
+			Description: "List the commands available in this channel",
+			run:         runHelpCommand,
+		},
+		{
+			Name:        "me",
+			Description: "Describe what you are doing",
+			Options: []database.CommandOption{
+				{Name: "action", Type: database.CommandOptionText, Required: true},
+			},
+			run: func(ctx context.Context, s *Server, invocation commandInvocation) (commandResponse, error) {
+				return commandResponse{Content: "_" + invocation.Args.String("action") + "_"}, nil
+			},
+		},
+		{
+			Name:        "shrug",
+			Description: `Append ¯\_(ツ)_/¯ to your message`,
+			Options: []database.CommandOption{
+				{Name: "message", Type: database.CommandOptionText},
+			},
+			run: func(ctx context.Context, s *Server, invocation commandInvocation) (commandResponse, error) {
+				content := strings.TrimSpace(invocation.Args.String("message") + ` ¯\\\_(ツ)\_/¯`)
+				return commandResponse{Content: content}, nil
+			},
+		},
+		{
+			Name:        "poll",
+			Description: "Ask a question with numbered answers",
+			Options: []database.CommandOption{
+				{Name: "question", Type: database.CommandOptionString, Required: true},
+				{Name: "answers", Type: database.CommandOptionString, Required: true, Variadic: true},
+			},
+			run: runPollCommand,
+		},
+		{
+			Name:        "remind",
+			Description: "Get a private reminder in this channel",
+			Options: []database.CommandOption{
+				{Name: "in", Description: "such as 10m, 2h or 3d", Type: database.CommandOptionDuration, Required: true},
+				{Name: "message", Type: database.CommandOptionText, Required: true},
+			},
+			run: runRemindCommand,
+		},
+	}
+	if withGiphy {
+		commands = append(commands, slashCommand{
+			Name:        "giphy",
+			Description: "Post a GIF",
+			Options: []database.CommandOption{
+				{Name: "query", Type: database.CommandOptionText, Required: true},
+			},
+			run: runGiphyCommand,
+		})
+	}
+	return commands
+}
+
+func runHelpCommand(ctx context.Context, s *Server, invocation commandInvocation) (commandResponse, error) {
+	commands, err := s.commandsForChannel(invocation.Channel)
+	if err != nil {
+		return commandResponse{}, err
+	}
+	lines := make([]string, 0, len(commands))
+	for _, command := range commands {
+		lines = append(lines, fmt.Sprintf("`%s` %s", commandUsage(command.Name, command.Options), command.Description))
+	}
+	return commandResponse{Content: strings.Join(lines, "\n"), Ephemeral: true}, nil
+}
+
+func runPollCommand(ctx context.Context, s *Server, invocation commandInvocation) (commandResponse, error) {
+	answers := invocation.Args.Strings("answers")
+	if len(answers) < 2 || len(answers) > maxPollOptions {
+		return commandResponse{}, commandErrorf("a poll needs 2 to %d answers", maxPollOptions)
+	}
+	lines := []string{"📊 **" + invocation.Args.String("question") + "**"}
+	for i, answer := range answers {
+		lines = append(lines, pollMarkers[i]+" "+answer)
+	}
+	return commandResponse{Content: strings.Join(lines, "\n")}, nil
+}
+
+func runRemindCommand(ctx context.Context, s *Server, invocation commandInvocation) (commandResponse, error) {
+	delay := invocation.Args.Duration("in")
+	if delay > maxReminderDelay {
+		return commandResponse{}, commandErrorf("reminders can be set at most %d days ahead", int(maxReminderDelay.Hours()/24))
+	}
+	message := invocation.Args.String("message")
+	_, err := s.db.CreateReminder(database.Reminder{
+		UserId:    invocation.UserId,
+		ChannelId: invocation.Channel.ChannelId,
+		Message:   message,
+		Due:       time.Now().Add(delay),
+	})
+	if err != nil {
+		return commandResponse{}, err
+	}
+	return commandResponse{
+		Content:   fmt.Sprintf("I will remind you in %s: %s", delay, message),
+		Ephemeral: true,
+	}, nil
+}
+
+// giphyClient searches GIFs with the Giphy API.
+type giphyClient struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+// giphyClientFromEnv returns nil unless GIPHY_API_KEY is set.
+func giphyClientFromEnv() *giphyClient {
+	key := os.Getenv("GIPHY_API_KEY")
+	if key == "" {
+		return nil
+	}
+	return &giphyClient{apiKey: key, baseURL: giphyAPIURL, client: &http.Client{Timeout: commandCallbackTimeout}}
+}
+
+// search returns the URL of the best match for query, or "" without one.
+func (g *giphyClient) search(ctx context.Context, query string) (string, error) {
+	params := url.Values{"api_key": {g.apiKey}, "q": {query}, "limit": {"1"}, "rating": {"pg"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.baseURL+"/v1/gifs/search?"+params.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("giphy: unexpected status %d", resp.StatusCode)
+	}
+	result := struct {
+		Data []struct {
+			Images struct {
+				Original struct {
+					URL string `json:"url"`
+				} `json:"original"`
+			} `json:"images"`
+		} `json:"data"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if len(result.Data) == 0 {
+		return "", nil
+	}
+	return result.Data[0].Images.Original.URL, nil
+}
+
+func runGiphyCommand(ctx context.Context, s *Server, invocation commandInvocation) (commandResponse, error) {
+	query := invocation.Args.String("query")
+	gif, err := s.commands.giphy.search(ctx, query)
+	if err != nil {
+		return commandResponse{}, err
+	}
+	if gif == "" {
+		return commandResponse{}, commandErrorf("no GIFs found for %q", query)
+	}
+	return commandResponse{Content: query + "\n" + gif}, nil
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"go-chat-react/internal/database"
+)
+
+func TestParseSlashCommand(t *testing.T) {
+	tests := []struct {
+		contents string
+		name     string
+		rest     string
+		ok       bool
+	}{
+		{"/shrug", "shrug", "", true},
+		{"/Poll \"a b\" c", "poll", "\"a b\" c", true},
+		{"/usr/bin is a path", "", "", false},
+		{"//shrug", "", "", false},
+		{"hello /shrug", "", "", false},
+	}
+	for _, test := range tests {
+		name, rest, ok := parseSlashCommand(test.contents)
+		if name != test.name || rest != test.rest || ok != test.ok {
+			t.Errorf("parseSlashCommand(%q) = %q, %q, %v", test.contents, name, rest, ok)
+		}
+	}
+	if unescaped := unescapeSlashCommand("//shrug"); unescaped != "/shrug" {
+		t.Errorf("unescapeSlashCommand: got %q", unescaped)
+	}
+}
+
+func TestParseCommandArgs(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	channel, err := s.db.GetChannel(1)
+	if err != nil {
+		t.Fatalf("GetChannel: err: %v", err)
+	}
+	command := slashCommand{
+		Name: "deploy",
+		Options: []database.CommandOption{
+			{Name: "env", Type: database.CommandOptionString, Required: true, Choices: []string{"prod", "staging"}},
+			{Name: "after", Type: database.CommandOptionDuration},
+			{Name: "notify", Type: database.CommandOptionUser},
+			{Name: "note", Type: database.CommandOptionText},
+		},
+	}
+
+	args, err := s.app.parseCommandArgs(channel, command, `prod 1d @u1 ship "it" now`)
+	if err != nil {
+		t.Fatalf("parseCommandArgs: err: %v", err)
+	}
+	if args.String("env") != "prod" || args.Duration("after") != 24*time.Hour ||
+		args["notify"] != database.Id(1) || args.String("note") != `ship "it" now` {
+		t.Fatalf("parseCommandArgs: unexpected args %+v", args)
+	}
+
+	for _, raw := range []string{"", "dev", "prod soon", "prod 1h @nobody", "prod 1h @u2"} {
+		if _, err := s.app.parseCommandArgs(channel, command, raw); err == nil {
+			t.Errorf("parseCommandArgs(%q): expected an error", raw)
+		}
+	}
+
+	poll := s.app.commands.builtins["poll"]
+	args, err = s.app.parseCommandArgs(channel, poll, `"Lunch where?" pizza "the usual"`)
+	if err != nil {
+		t.Fatalf("parseCommandArgs: err: %v", err)
+	}
+	if args.String("question") != "Lunch where?" || len(args.Strings("answers")) != 2 || args.Strings("answers")[1] != "the usual" {
+		t.Fatalf("parseCommandArgs: unexpected poll args %+v", args)
+	}
+	if _, err := s.app.parseCommandArgs(channel, s.app.commands.builtins["help"], "extra"); err == nil {
+		t.Fatalf("parseCommandArgs: expected too many arguments")
+	}
+}
@@ -0,0 +1,251 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-chat-react/internal/database"
+)
+
+// events delivered to outgoing webhooks
+const (
+	eventMessageCreated = "message.created"
+	eventMessageUpdated = "message.updated"
+	eventMessageDeleted = "message.deleted"
+	eventMemberJoined   = "member.joined"
+	eventMemberLeft     = "member.left"
+	eventChannelCreated = "channel.created"
+	eventChannelUpdated = "channel.updated"
+	eventChannelDeleted = "channel.deleted"
+)
+
+var eventNames = []string{
+	eventMessageCreated,
+	eventMessageUpdated,
+	eventMessageDeleted,
+	eventMemberJoined,
+	eventMemberLeft,
+	eventChannelCreated,
+	eventChannelUpdated,
+	eventChannelDeleted,
+}
+
+const (
+	eventDeliveryTimeout  = 10 * time.Second
+	eventDeliveryInterval = 15 * time.Second
+	eventDeliveryBatch    = 50
+	// a delivery is given up after this many attempts
+	eventDeliveryMaxAttempts = 8
+	eventRetryBaseDelay      = 30 * time.Second
+	eventRetryMaxDelay       = time.Hour
+	// an endpoint is disabled after this many consecutive failed attempts
+	eventEndpointMaxFailures = 10
+	// delivery logs are kept for this long
+	eventDeliveryRetention = 7 * 24 * time.Hour
+	// at most this much of a response body is stored in the delivery log
+	eventResponseExcerpt = 512
+
+	eventSignatureHeader = "X-Chat-Signature"
+	eventTimestampHeader = "X-Chat-Timestamp"
+)
+
+// eventEnvelope is the JSON body posted to outgoing webhooks.
+type eventEnvelope struct {
+	Event     string      `json:"event"`
+	ServerID  database.Id `json:"serverid"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      any         `json:"data"`
+}
+
+// channelMemberEvent is the data of member events. ChannelId is left out
+// when the user left the whole server, e.g. by deleting their account.
+type channelMemberEvent struct {
+	UserId    database.Id `json:"userid"`
+	ChannelId database.Id `json:"channelid,omitempty"`
+}
+
+type messageDeletedEvent struct {
+	MessageId database.Id `json:"messageid"`
+	ChannelId database.Id `json:"channelid"`
+}
+
+// signEventPayload computes the signature sent with every delivery:
+// the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the endpoint secret.
+func signEventPayload(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// eventRetryDelay doubles the wait after each failed attempt, up to an hour.
+func eventRetryDelay(attempts int) time.Duration {
+	delay := eventRetryBaseDelay
+	for i := 1; i < attempts && delay < eventRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, eventRetryMaxDelay)
+}
+
+// publishEvent queues an event for the outgoing webhooks of a server.
+// Failures are only logged, they never affect the request that caused them.
+func (s *Server) publishEvent(serverid database.Id, event string, data any) {
+	// direct messages belong to no server and have no webhooks
+	if serverid == 0 {
+		return
+	}
+	now := time.Now()
+	payload, err := json.Marshal(eventEnvelope{Event: event, ServerID: serverid, Timestamp: now.UTC(), Data: data})
+	if err != nil {
+		log.Printf("publishEvent: %s: %v", event, err)
+		return
+	}
+	queued, err := s.db.EnqueueEvent(serverid, event, string(payload), now)
+	if err != nil {
+		log.Printf("publishEvent: %s: %v", event, err)
+		return
+	}
+	if queued > 0 {
+		s.events.Wake()
+	}
+}
+
+// eventDeliveryWorker posts queued events to outgoing webhooks. Deliveries
+// live in the database so they survive restarts; failed ones are retried
+// with exponential backoff.
+type eventDeliveryWorker struct {
+	server   *Server
+	client   *http.Client
+	interval time.Duration
+	wake     chan struct{}
+}
+
+func newEventDeliveryWorker(server *Server, client *http.Client) *eventDeliveryWorker {
+	return &eventDeliveryWorker{
+		server:   server,
+		client:   client,
+		interval: eventDeliveryInterval,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Wake makes the worker look for due deliveries right away. It never blocks.
+func (w *eventDeliveryWorker) Wake() {
+	if w == nil {
+		return
+	}
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *eventDeliveryWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+		now := time.Now()
+		if err := w.process(ctx, now); err != nil {
+			log.Printf("eventDeliveryWorker: %v", err)
+		}
+		if err := w.server.db.PruneEventDeliveries(now.Add(-eventDeliveryRetention)); err != nil {
+			log.Printf("eventDeliveryWorker: %v", err)
+		}
+	}
+}
+
+func (w *eventDeliveryWorker) process(ctx context.Context, now time.Time) error {
+	deliveries, err := w.server.db.GetDueEventDeliveries(now, eventDeliveryBatch)
+	if err != nil {
+		return err
+	}
+	endpoints := make(map[database.Id]database.EventEndpoint)
+	for _, delivery := range deliveries {
+		endpoint, ok := endpoints[delivery.EndpointId]
+		if !ok {
+			endpoint, err = w.server.db.GetEventEndpoint(delivery.EndpointId)
+			if err != nil {
+				log.Printf("eventDeliveryWorker: delivery %d: %v", delivery.DeliveryId, err)
+				continue
+			}
+			endpoints[endpoint.EndpointId] = endpoint
+		}
+		if !endpoint.Enabled {
+			continue
+		}
+
+		code, deliverErr := w.deliver(ctx, endpoint, delivery)
+		delivery.Attempts++
+		delivery.LastAttempt = &now
+		delivery.ResponseCode = code
+		delivery.Error = ""
+		succeeded := deliverErr == nil
+		switch {
+		case succeeded:
+			delivery.Status = database.EventDeliveryDelivered
+		case delivery.Attempts >= eventDeliveryMaxAttempts:
+			delivery.Status = database.EventDeliveryFailed
+			delivery.Error = deliverErr.Error()
+		default:
+			delivery.NextAttempt = now.Add(eventRetryDelay(delivery.Attempts))
+			delivery.Error = deliverErr.Error()
+		}
+		disabled, err := w.server.db.RecordEventDeliveryAttempt(delivery, succeeded, eventEndpointMaxFailures)
+		if err != nil {
+			return err
+		}
+		if disabled {
+			endpoint.Enabled = false
+			endpoints[endpoint.EndpointId] = endpoint
+			log.Printf("eventDeliveryWorker: disabled endpoint %d after %d failures", endpoint.EndpointId, eventEndpointMaxFailures)
+		}
+	}
+	return nil
+}
+
+// deliver posts a single delivery and returns the response status code.
+// Anything but a 2xx response is an error.
+func (w *eventDeliveryWorker) deliver(ctx context.Context, endpoint database.EventEndpoint, delivery database.EventDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, eventDeliveryTimeout)
+	defer cancel()
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-chat-webhooks")
+	req.Header.Set("X-Chat-Event", delivery.Event)
+	req.Header.Set("X-Chat-Delivery", strconv.FormatInt(int64(delivery.DeliveryId), 10))
+	req.Header.Set(eventTimestampHeader, timestamp)
+	req.Header.Set(eventSignatureHeader, signEventPayload(endpoint.Secret, timestamp, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, eventResponseExcerpt))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(excerpt))
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go-chat-react/internal/database"
+	"go-chat-react/internal/unfurl"
+)
+
+const (
+	linkPreviewQueueSize = 256
+	// previews are refetched once the cached copy is older than this
+	linkPreviewMaxAge  = 24 * time.Hour
+	linkPreviewTimeout = 5 * time.Second
+)
+
+// linkPreviewWorker unfurls links of new messages in the background. Each
+// preview is cached by URL, attached to the message as an embed and the
+// updated message is pushed to the server as "message_updated".
+type linkPreviewWorker struct {
+	server  *Server
+	fetcher *unfurl.Fetcher
+	queue   chan database.Id
+}
+
+func newLinkPreviewWorker(server *Server, fetcher *unfurl.Fetcher) *linkPreviewWorker {
+	return &linkPreviewWorker{
+		server:  server,
+		fetcher: fetcher,
+		queue:   make(chan database.Id, linkPreviewQueueSize),
+	}
+}
+
+// Enqueue schedules a message for unfurling if its contents contain links.
+// It never blocks; when the queue is full the message goes without previews.
+func (w *linkPreviewWorker) Enqueue(messageid database.Id, contents string) {
+	if w == nil || len(unfurl.ExtractURLs(contents)) == 0 {
+		return
+	}
+	select {
+	case w.queue <- messageid:
+	default:
+		log.Printf("linkPreviewWorker: queue full, skipping message %d", messageid)
+	}
+}
+
+func (w *linkPreviewWorker) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case messageid := <-w.queue:
+			if err := w.process(ctx, messageid); err != nil {
+				log.Printf("linkPreviewWorker: message %d: %v", messageid, err)
+			}
+		}
+	}
+}
+
+func (w *linkPreviewWorker) process(ctx context.Context, messageid database.Id) error {
+	s := w.server
+	message, err := s.db.GetMessage(messageid)
+	if err != nil {
+		return err
+	}
+	added := 0
+	for _, url := range unfurl.ExtractURLs(message.Contents) {
+		_, err := s.db.GetLinkPreview(url, linkPreviewMaxAge)
+		if errors.Is(err, database.ErrRecordNotFound) {
+			err = w.fetch(ctx, url)
+		}
+		if err != nil {
+			log.Printf("linkPreviewWorker: unable to unfurl %s: %v", url, err)
+			continue
+		}
+		if err := s.db.AddMessageEmbed(messageid, url); err != nil {
+			return err
+		}
+		added++
+	}
+	if added == 0 {
+		return nil
+	}
+
+	message, err = s.db.GetMessage(messageid)
+	if err != nil {
+		return err
+	}
+	byte_data, err := newServerResponse("message_updated", fromDBMessageToSeverMessage(message))
+	if err != nil {
+		return err
+	}
+	s.broadcastToChannel(message.ServerId, message.ChannelId, byte_data)
+	return nil
+}
+
+func (w *linkPreviewWorker) fetch(ctx context.Context, url string) error {
+	ctx, cancel := context.WithTimeout(ctx, linkPreviewTimeout)
+	defer cancel()
+	preview, err := w.fetcher.Fetch(ctx, url)
+	if err != nil {
+		return err
+	}
+	return w.server.db.SaveLinkPreview(database.LinkPreview{
+		URL:         preview.URL,
+		Title:       preview.Title,
+		Description: preview.Description,
+		SiteName:    preview.SiteName,
+		ImageURL:    preview.ImageURL,
+	})
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newPreviewSite(t *testing.T, hits *atomic.Int32) *httptest.Server {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head>
+			<title>Example page</title>
+			<meta property="og:description" content="An example">
+			<meta property="og:image" content="/image.png">
+			</head></html>`))
+	}))
+	t.Cleanup(site.Close)
+	return site
+}
+
+func (s *TestServer) waitForEmbeds(t *testing.T, messageid uint) ServerMessage {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := s.sendAuthRequest(
+			http.MethodGet,
+			fmt.Sprintf("/api/channels/1/messages/%d", messageid),
+			nil,
+			nil,
+			nil,
+		)
+		if err != nil {
+			t.Fatalf("error getting message. Err: %v", err)
+		}
+		message := ServerMessage{}
+		body, _ := io.ReadAll(resp.Body)
+		if err := json.Unmarshal(body, &message); err != nil {
+			t.Fatalf("error unmarshalling response body. Err: %v", err)
+		}
+		if len(message.Embeds) > 0 {
+			return message
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for embeds")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func (s *TestServer) postMessage(t *testing.T, contents string) uint {
+	resp, err := s.sendAuthJSON(
+		http.MethodPost,
+		"/api/channels/1/messages",
+		map[string]any{"message": contents},
+		nil,
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("error posting message. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status OK; got %v", resp.Status)
+	}
+	result := struct {
+		MessageId uint `json:"messageid"`
+	}{}
+	body, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Fatalf("error unmarshalling response body. Err: %v", err)
+	}
+	return result.MessageId
+}
+
+func TestLinkPreview_Unfurled(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	var hits atomic.Int32
+	site := newPreviewSite(t, &hits)
+	link := site.URL + "/page"
+
+	message := s.waitForEmbeds(t, s.postMessage(t, "check this out "+link))
+	embed := message.Embeds[0]
+	if embed.URL != link || embed.Title != "Example page" || embed.Description != "An example" {
+		t.Fatalf("unexpected embed %+v", embed)
+	}
+	if embed.ImageURL != site.URL+"/image.png" {
+		t.Errorf("expected absolute image url; got %s", embed.ImageURL)
+	}
+
+	// a second message with the same link is served from the cache
+	s.waitForEmbeds(t, s.postMessage(t, link))
+	if hits.Load() != 1 {
+		t.Fatalf("expected preview to be fetched once; got %d", hits.Load())
+	}
+}
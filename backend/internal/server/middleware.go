@@ -2,8 +2,11 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"slices"
 	"time"
 )
 
@@ -16,10 +19,16 @@ func (s *Server) logEndpoint(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 		end_time := time.Since(startTime.Add(start_time))
 
+		// the route pattern rather than the url, which can carry secrets
+		// such as the one in a webhook url
+		endpoint := r.Pattern
+		if endpoint == "" {
+			endpoint = r.Method + " (no matching route)"
+		}
 		log.Printf(
 			"%d Endpoint hit: %s took %d ms\n",
 			counter,
-			r.URL,
+			endpoint,
 			end_time.Milliseconds(),
 		)
 	})
@@ -27,6 +36,10 @@ func (s *Server) logEndpoint(next http.Handler) http.Handler {
 
 func (s *Server) WithAuthUser(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if secret, ok := bearerToken(r); ok {
+			s.withAPIToken(w, r, secret, next)
+			return
+		}
 		cookieName := "token"
 		cookie, err := r.Cookie(cookieName)
 		if err != nil {
@@ -56,6 +69,32 @@ func (s *Server) WithAuthUser(next http.HandlerFunc) http.HandlerFunc {
 	})
 }
 
+// withAPIToken authenticates a request by bearer token. Only routes listed
+// in routeScopes are reachable, and only when the token holds their scope.
+func (s *Server) withAPIToken(w http.ResponseWriter, r *http.Request, secret string, next http.HandlerFunc) {
+	token, err := s.authenticateAPIToken(secret, time.Now())
+	if errors.Is(err, errInvalidAPIToken) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	scope, ok := routeScopes[r.Pattern]
+	if !ok {
+		http.Error(w, "error: endpoint not available to api tokens", http.StatusForbidden)
+		return
+	}
+	if !slices.Contains(token.Scopes, scope) {
+		http.Error(w, fmt.Sprintf("error: token lacks the %s scope", scope), http.StatusForbidden)
+		return
+	}
+	ctx := context.WithValue(r.Context(), "userid", token.UserId)
+	ctx = context.WithValue(ctx, "scopes", token.Scopes)
+	next(w, r.WithContext(ctx))
+}
+
 func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Set CORS headers
@@ -64,7 +103,7 @@ func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 			// Replace "*" with specific origins if needed
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS, PATCH")
 		w.Header().
-			Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, X-CSRF-Token")
+			Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, X-CSRF-Token, X-Audit-Log-Reason")
 		w.Header().
 			Set("Access-Control-Allow-Credentials", "true")
 			// Set to "true" if credentials are required
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogEndpoint_HidesSecrets(t *testing.T) {
+	var output bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&output)
+	defer log.SetOutput(previous)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/webhooks/{webhookid}/{secret}", func(w http.ResponseWriter, r *http.Request) {})
+	handler := (&Server{}).logEndpoint(mux)
+	for _, target := range []string{"/api/webhooks/1/s3cret", "/api/webhooks/1/s3cret/extra?token=s3cret"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, target, nil))
+	}
+	logged := output.String()
+	if strings.Contains(logged, "s3cret") {
+		t.Fatalf("expected the secret to stay out of the log; got %q", logged)
+	}
+	if !strings.Contains(logged, "POST /api/webhooks/{webhookid}/{secret}") {
+		t.Fatalf("expected the route pattern to be logged; got %q", logged)
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultMinPasswordLength = 8
+	maxPasswordLength        = 128
+)
+
+// passwordPolicy decides which passwords users may choose.
+type passwordPolicy struct {
+	minLength int
+	// breached holds known leaked passwords, lowercased
+	breached map[string]struct{}
+}
+
+func newPasswordPolicy(minLength int, breached []string) *passwordPolicy {
+	policy := &passwordPolicy{minLength: minLength, breached: make(map[string]struct{}, len(breached))}
+	for _, password := range breached {
+		policy.breached[strings.ToLower(password)] = struct{}{}
+	}
+	return policy
+}
+
+// passwordPolicyFromEnv builds the policy from PASSWORD_MIN_LENGTH and
+// PASSWORD_BREACHED_LIST, a file holding one leaked password per line.
+func passwordPolicyFromEnv() (*passwordPolicy, error) {
+	minLength := defaultMinPasswordLength
+	if value := os.Getenv("PASSWORD_MIN_LENGTH"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxPasswordLength {
+			return nil, fmt.Errorf("invalid PASSWORD_MIN_LENGTH %q", value)
+		}
+		minLength = parsed
+	}
+	var breached []string
+	if path := os.Getenv("PASSWORD_BREACHED_LIST"); path != "" {
+		var err error
+		breached, err = readBreachedPasswords(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return newPasswordPolicy(minLength, breached), nil
+}
+
+func readBreachedPasswords(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("password policy - open breached list: %w", err)
+	}
+	defer file.Close()
+	var passwords []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); line != "" {
+			passwords = append(passwords, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("password policy - read breached list: %w", err)
+	}
+	return passwords, nil
+}
+
+// check returns an error describing why a password is not acceptable for
+// the given user.
+func (p *passwordPolicy) check(username string, password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.minLength {
+		return fmt.Errorf("error: password must be at least %d characters", p.minLength)
+	}
+	if length > maxPasswordLength {
+		return fmt.Errorf("error: password must be at most %d characters", maxPasswordLength)
+	}
+	lowered := strings.ToLower(password)
+	if username != "" && strings.Contains(lowered, strings.ToLower(username)) {
+		return errors.New("error: password must not contain your username")
+	}
+	if _, found := p.breached[lowered]; found {
+		return errors.New("error: password appears in a list of breached passwords")
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(list, []byte("password123\r\nLetMeIn2024\n\n"), 0o644); err != nil {
+		t.Fatalf("error writing list. Err: %v", err)
+	}
+	t.Setenv("PASSWORD_MIN_LENGTH", "10")
+	t.Setenv("PASSWORD_BREACHED_LIST", list)
+	policy, err := passwordPolicyFromEnv()
+	if err != nil {
+		t.Fatalf("passwordPolicyFromEnv: err: %v", err)
+	}
+	for _, tc := range []struct {
+		username string
+		password string
+		valid    bool
+	}{
+		{"alice", "", false},
+		{"alice", "short", false},
+		{"alice", "long enough phrase", true},
+		{"alice", "my name is ALICE!", false},
+		{"bob", "letmein2024", false},
+		{"bob", "password123", false},
+		{"bob", string(make([]byte, maxPasswordLength+1)), false},
+	} {
+		err := policy.check(tc.username, tc.password)
+		if (err == nil) != tc.valid {
+			t.Errorf("check(%q, %q): expected valid=%v got err: %v", tc.username, tc.password, tc.valid, err)
+		}
+	}
+}
+
+func TestPasswordPolicy_InvalidConfig(t *testing.T) {
+	t.Setenv("PASSWORD_MIN_LENGTH", "zero")
+	if _, err := passwordPolicyFromEnv(); err == nil {
+		t.Fatalf("expected error for invalid minimum length")
+	}
+	t.Setenv("PASSWORD_MIN_LENGTH", "")
+	t.Setenv("PASSWORD_BREACHED_LIST", filepath.Join(t.TempDir(), "missing.txt"))
+	if _, err := passwordPolicyFromEnv(); err == nil {
+		t.Fatalf("expected error for missing breached list")
+	}
+}
@@ -1,8 +1,10 @@
 package server
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"time"
@@ -93,3 +95,103 @@ func (s *Server) GetServerFromChannel(channelid database.Id) (database.Server, e
 	}
 	return server, nil
 }
+
+func writeJSON(w http.ResponseWriter, payload any) {
+	jsonResp, err := json.Marshal(payload)
+	if err != nil {
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(jsonResp); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+// parseCountFromQuery reads the optional "count" query parameter used by the
+// paginated endpoints, falling back to defaultCount when it is absent.
+func parseCountFromQuery(r *http.Request, defaultCount uint) (uint, error) {
+	count_str := r.URL.Query().Get("count")
+	if count_str == "" {
+		return defaultCount, nil
+	}
+	count, err := strconv.Atoi(count_str)
+	if err != nil {
+		return 0, errors.New("invalid request: unable to parse count")
+	}
+	if count <= 0 {
+		return 0, errors.New("invalid request: invalid count")
+	}
+	return uint(count), nil
+}
+
+// parseIDFromQuery reads an optional id query parameter, returning zero when
+// it is absent.
+func parseIDFromQuery(r *http.Request, field string) (database.Id, error) {
+	fieldStr := r.URL.Query().Get(field)
+	if fieldStr == "" {
+		return 0, nil
+	}
+	fieldID, err := database.ParseStringToID(fieldStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid request: unable to parse %s", field)
+	}
+	return fieldID, nil
+}
+
+// validateReplyTarget makes sure a message being replied to lives in the same
+// channel and in the same thread (nil for top level) as the new message.
+func (s *Server) validateReplyTarget(
+	channelid database.Id,
+	threadid *database.Id,
+	replyto database.Id,
+) error {
+	parent, err := s.db.GetMessage(replyto)
+	if errors.Is(err, database.ErrRecordNotFound) {
+		return errors.New("error: reply target not found")
+	}
+	if err != nil {
+		return errors.New("error: unable to fetch reply target")
+	}
+	if parent.ChannelId != channelid {
+		return errors.New("error: reply target in different channel")
+	}
+	if threadid == nil {
+		if parent.ThreadId != nil {
+			return errors.New("error: reply target is part of a thread")
+		}
+		return nil
+	}
+	if parent.MessageId != *threadid && (parent.ThreadId == nil || *parent.ThreadId != *threadid) {
+		return errors.New("error: reply target in different thread")
+	}
+	return nil
+}
+
+func setSessionCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "token",
+		Value:    token,
+		Path:     "/",
+		Secure:   false,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// expireSessionCookie tells the browser to drop the session cookie.
+func expireSessionCookie(w http.ResponseWriter) {
+	cookie := &http.Cookie{
+		Name:     "token", // Replace with your actual cookie name
+		Value:    "",
+		Path:     "/", // Ensure this matches the cookie's original path
+		HttpOnly: true,
+		Secure:   false, // Set to true if your site uses HTTPS
+		SameSite: http.SameSiteStrictMode,
+		Expires:  time.Now().Add(-time.Hour), // Set the expiration time to the past
+		MaxAge:   -1,                         // Set MaxAge to 0 or a negative value to delete the cookie immediately
+	}
+
+	// Set the expired cookie in the response header.
+	http.SetCookie(w, cookie)
+}
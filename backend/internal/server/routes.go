@@ -1,15 +1,18 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"go-chat-react/internal/database"
+	"go-chat-react/internal/markdown"
 	"go-chat-react/internal/websocket"
 )
 
@@ -27,6 +30,68 @@ type ServerMessage struct {
 	ServerId  database.Id `json:"serverid"`
 	Message   string      `json:"message"`
 	Date      string      `json:"date"`
+	Type      string      `json:"type"`
+	// DisplayName is the author's nickname in the server, or their display
+	// name or username when none is set
+	DisplayName string        `json:"display_name"`
+	ReplyTo     *MessageReply `json:"reply_to,omitempty"`
+	ThreadId    *database.Id  `json:"threadid,omitempty"`
+	Thread      *ThreadInfo   `json:"thread,omitempty"`
+
+	AST         []markdown.Node  `json:"ast"`
+	Attachments []AttachmentInfo `json:"attachments,omitempty"`
+	Embeds      []EmbedInfo      `json:"embeds,omitempty"`
+	// Blocked marks messages from users the viewer has blocked so clients
+	// can collapse them.
+	Blocked bool               `json:"blocked,omitempty"`
+	Webhook *WebhookAuthorInfo `json:"webhook,omitempty"`
+}
+
+type MessageReply struct {
+	MessageID database.Id `json:"messageid"`
+	UserId    database.Id `json:"userid"`
+	Message   string      `json:"message"`
+	Deleted   bool        `json:"deleted"`
+}
+
+type ThreadInfo struct {
+	ReplyCount uint   `json:"reply_count"`
+	LastReply  string `json:"last_reply,omitempty"`
+}
+
+// EmbedInfo is a card attached to a message, either a link preview or one
+// supplied by a webhook. Only webhook cards use the fields after ImageURL.
+type EmbedInfo struct {
+	URL          string           `json:"url"`
+	Title        string           `json:"title,omitempty"`
+	Description  string           `json:"description,omitempty"`
+	SiteName     string           `json:"site_name,omitempty"`
+	ImageURL     string           `json:"image_url,omitempty"`
+	Color        string           `json:"color,omitempty"`
+	AuthorName   string           `json:"author_name,omitempty"`
+	ThumbnailURL string           `json:"thumbnail_url,omitempty"`
+	Footer       string           `json:"footer,omitempty"`
+	Fields       []EmbedFieldInfo `json:"fields,omitempty"`
+}
+
+type EmbedFieldInfo struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+// WebhookAuthorInfo marks a message posted through an incoming webhook.
+type WebhookAuthorInfo struct {
+	WebhookID database.Id `json:"webhookid"`
+	AvatarURL string      `json:"avatar_url,omitempty"`
+}
+
+type ChannelInfo struct {
+	ChannelId   database.Id `json:"channelid"`
+	ServerId    database.Id `json:"serverid"`
+	ChannelName string      `json:"channelname"`
+	Timestamp   time.Time   `json:"timestamp"`
+	PinLimit    uint        `json:"pinlimit"`
 }
 
 type User struct {
@@ -50,13 +115,85 @@ func (s *Server) RegisterRoutes(logserver bool) http.Handler {
 	mux.HandleFunc("/websocket", s.WithAuthUser(s.websocketHandler))
 
 	mux.HandleFunc("POST /api/auth/login", s.loginHandler)
+	mux.HandleFunc("POST /api/auth/login/2fa", s.CompleteTwoFactorLogin)
+	mux.HandleFunc("GET /api/auth/oidc/providers", s.GetOIDCProviders)
+	mux.HandleFunc("GET /api/auth/oidc/{provider}/start", s.StartOIDCLogin)
+	mux.HandleFunc("GET /api/auth/oidc/{provider}/callback", s.OIDCCallback)
 	mux.HandleFunc("POST /api/auth/session", s.WithAuthUser(s.sessionHandler))
 	mux.HandleFunc("POST /api/auth/logout", s.WithAuthUser(s.LogoutHandler))
+	mux.HandleFunc("POST /api/auth/password-reset", s.RequestPasswordReset)
+	mux.HandleFunc("POST /api/auth/password-reset/confirm", s.ConfirmPasswordReset)
+	mux.HandleFunc("POST /api/auth/verify-email", s.VerifyEmail)
 
 	mux.HandleFunc("POST /api/users", s.createUserHandler)
 	mux.HandleFunc("GET /api/users/{userid}", s.GetUserHandler)
 	mux.HandleFunc("PATCH /api/users/{userid}", s.WithAuthUser(s.UpdateUser))
 	mux.HandleFunc("GET /api/users/{userid}/servers", s.WithAuthUser(s.GetServersOfUser))
+	mux.HandleFunc("GET /api/users/{userid}/avatar/{avatarid}", s.DownloadAvatar)
+	mux.HandleFunc("GET /api/users/{userid}/usernames", s.WithAuthUser(s.GetUsernameHistory))
+	mux.HandleFunc("DELETE /api/users/me", s.WithAuthUser(s.DeleteAccount))
+	mux.HandleFunc("GET /api/users/me/export", s.WithAuthUser(s.ExportUserData))
+	mux.HandleFunc("GET /api/users/me/email", s.WithAuthUser(s.GetEmail))
+	mux.HandleFunc("PUT /api/users/me/email", s.WithAuthUser(s.UpdateEmail))
+	mux.HandleFunc("POST /api/users/me/password", s.WithAuthUser(s.ChangePassword))
+	mux.HandleFunc("GET /api/users/me/2fa", s.WithAuthUser(s.GetTwoFactorStatus))
+	mux.HandleFunc("POST /api/users/me/2fa", s.WithAuthUser(s.EnrollTwoFactor))
+	mux.HandleFunc("DELETE /api/users/me/2fa", s.WithAuthUser(s.DisableTwoFactor))
+	mux.HandleFunc("POST /api/users/me/2fa/confirm", s.WithAuthUser(s.ConfirmTwoFactor))
+	mux.HandleFunc(
+		"POST /api/users/me/2fa/recovery-codes",
+		s.WithAuthUser(s.RegenerateRecoveryCodes),
+	)
+	mux.HandleFunc("GET /api/users/me/tokens", s.WithAuthUser(s.GetAPITokens))
+	mux.HandleFunc("POST /api/users/me/tokens", s.WithAuthUser(s.CreateAPIToken))
+	mux.HandleFunc("DELETE /api/users/me/tokens/{tokenid}", s.WithAuthUser(s.DeleteAPIToken))
+	mux.HandleFunc("GET /api/users/me/commands", s.WithAuthUser(s.GetBotCommands))
+	mux.HandleFunc("PUT /api/users/me/commands", s.WithAuthUser(s.SetBotCommands))
+	mux.HandleFunc(
+		"POST /api/interactions/{interactionid}",
+		s.WithAuthUser(s.RespondToInteraction),
+	)
+	mux.HandleFunc("GET /api/users/me/bots", s.WithAuthUser(s.GetBots))
+	mux.HandleFunc("POST /api/users/me/bots", s.WithAuthUser(s.CreateBot))
+	mux.HandleFunc("DELETE /api/users/me/bots/{userid}", s.WithAuthUser(s.DeleteBot))
+	mux.HandleFunc("GET /api/users/me/bots/{userid}/tokens", s.WithAuthUser(s.GetBotAPITokens))
+	mux.HandleFunc("POST /api/users/me/bots/{userid}/tokens", s.WithAuthUser(s.CreateBotAPIToken))
+	mux.HandleFunc(
+		"DELETE /api/users/me/bots/{userid}/tokens/{tokenid}",
+		s.WithAuthUser(s.DeleteBotAPIToken),
+	)
+	mux.HandleFunc("PATCH /api/users/me/profile", s.WithAuthUser(s.UpdateProfile))
+	mux.HandleFunc("PUT /api/users/me/avatar", s.WithAuthUser(s.UploadAvatar))
+	mux.HandleFunc("DELETE /api/users/me/avatar", s.WithAuthUser(s.DeleteAvatar))
+	mux.HandleFunc("GET /api/users/me/dms", s.WithAuthUser(s.GetDirectMessages))
+	mux.HandleFunc("POST /api/users/me/dms", s.WithAuthUser(s.CreateDirectMessage))
+	mux.HandleFunc("GET /api/users/me/friends", s.WithAuthUser(s.GetFriends))
+	mux.HandleFunc("DELETE /api/users/me/friends/{userid}", s.WithAuthUser(s.RemoveFriend))
+	mux.HandleFunc("GET /api/users/me/friend-requests", s.WithAuthUser(s.GetFriendRequests))
+	mux.HandleFunc("POST /api/users/me/friend-requests", s.WithAuthUser(s.SendFriendRequest))
+	mux.HandleFunc(
+		"POST /api/users/me/friend-requests/{userid}/accept",
+		s.WithAuthUser(s.AcceptFriendRequest),
+	)
+	mux.HandleFunc(
+		"POST /api/users/me/friend-requests/{userid}/decline",
+		s.WithAuthUser(s.DeclineFriendRequest),
+	)
+	mux.HandleFunc(
+		"DELETE /api/users/me/friend-requests/{userid}",
+		s.WithAuthUser(s.CancelFriendRequest),
+	)
+	mux.HandleFunc("GET /api/users/me/blocks", s.WithAuthUser(s.GetBlockedUsers))
+	mux.HandleFunc("PUT /api/users/me/blocks/{userid}", s.WithAuthUser(s.BlockUser))
+	mux.HandleFunc("DELETE /api/users/me/blocks/{userid}", s.WithAuthUser(s.UnblockUser))
+	mux.HandleFunc(
+		"PUT /api/dms/{channelid}/participants/{userid}",
+		s.WithAuthUser(s.AddDirectMessageParticipant),
+	)
+	mux.HandleFunc(
+		"DELETE /api/dms/{channelid}/participants/{userid}",
+		s.WithAuthUser(s.RemoveDirectMessageParticipant),
+	)
 
 	mux.HandleFunc("POST /api/servers", s.WithAuthUser(s.createNewServer))
 	mux.HandleFunc("GET /api/servers/{serverid}", s.GetServerInformation)
@@ -65,7 +202,46 @@ func (s *Server) RegisterRoutes(logserver bool) http.Handler {
 	mux.HandleFunc("GET /api/servers/{serverid}/channels", s.WithAuthUser(s.GetServerChannels))
 	mux.HandleFunc("POST /api/servers/{serverid}/channels", s.WithAuthUser(s.CreateChannel))
 	mux.HandleFunc("GET /api/servers/{serverid}/members", s.WithAuthUser(s.GetServerMembersHandler))
+	mux.HandleFunc(
+		"PATCH /api/servers/{serverid}/members/me/nickname",
+		s.WithAuthUser(s.UpdateOwnNickname),
+	)
+	mux.HandleFunc(
+		"PATCH /api/servers/{serverid}/members/{userid}/nickname",
+		s.WithAuthUser(s.UpdateMemberNickname),
+	)
+	mux.HandleFunc(
+		"GET /api/servers/{serverid}/members/{userid}/nicknames",
+		s.WithAuthUser(s.GetNicknameHistory),
+	)
 	mux.HandleFunc("GET /api/servers/{serverid}/messages", s.WithAuthUser(s.GetServerMessages))
+	mux.HandleFunc("GET /api/servers/{serverid}/audit-log", s.WithAuthUser(s.GetAuditLog))
+	mux.HandleFunc("GET /api/servers/{serverid}/restrictions", s.WithAuthUser(s.GetRestrictions))
+	mux.HandleFunc("POST /api/servers/{serverid}/restrictions", s.WithAuthUser(s.CreateRestriction))
+	mux.HandleFunc(
+		"DELETE /api/servers/{serverid}/restrictions/{restrictionid}",
+		s.WithAuthUser(s.DeleteRestriction),
+	)
+	mux.HandleFunc(
+		"GET /api/servers/{serverid}/outgoing-webhooks",
+		s.WithAuthUser(s.GetEventEndpoints),
+	)
+	mux.HandleFunc(
+		"POST /api/servers/{serverid}/outgoing-webhooks",
+		s.WithAuthUser(s.CreateEventEndpoint),
+	)
+	mux.HandleFunc(
+		"PATCH /api/servers/{serverid}/outgoing-webhooks/{endpointid}",
+		s.WithAuthUser(s.UpdateEventEndpoint),
+	)
+	mux.HandleFunc(
+		"DELETE /api/servers/{serverid}/outgoing-webhooks/{endpointid}",
+		s.WithAuthUser(s.DeleteEventEndpoint),
+	)
+	mux.HandleFunc(
+		"GET /api/servers/{serverid}/outgoing-webhooks/{endpointid}/deliveries",
+		s.WithAuthUser(s.GetEventDeliveries),
+	)
 
 	mux.HandleFunc("GET /api/channels/{channelid}", s.WithAuthUser(s.GetChannel))
 	mux.HandleFunc("PATCH /api/channels/{channelid}", s.WithAuthUser(s.UpdateChannel))
@@ -76,9 +252,39 @@ func (s *Server) RegisterRoutes(logserver bool) http.Handler {
 		"DELETE /api/channels/{channelid}/members",
 		s.WithAuthUser(s.RemoveChannelMember),
 	)
+	mux.HandleFunc(
+		"POST /api/channels/{channelid}/attachments",
+		s.WithAuthUser(s.UploadAttachments),
+	)
+	mux.HandleFunc("GET /api/attachments/{attachmentid}", s.WithAuthUser(s.DownloadAttachment))
+	mux.HandleFunc(
+		"GET /api/attachments/{attachmentid}/thumbnails/{size}",
+		s.WithAuthUser(s.DownloadThumbnail),
+	)
+	mux.HandleFunc("GET /api/channels/{channelid}/webhooks", s.WithAuthUser(s.GetWebhooks))
+	mux.HandleFunc("POST /api/channels/{channelid}/webhooks", s.WithAuthUser(s.CreateWebhook))
+	mux.HandleFunc(
+		"DELETE /api/channels/{channelid}/webhooks/{webhookid}",
+		s.WithAuthUser(s.DeleteWebhook),
+	)
+	mux.HandleFunc("POST /api/webhooks/{webhookid}/{secret}", s.ExecuteWebhook)
+	mux.HandleFunc("GET /api/channels/{channelid}/commands", s.WithAuthUser(s.GetChannelCommands))
+	mux.HandleFunc(
+		"GET /api/channels/{channelid}/commands/autocomplete",
+		s.WithAuthUser(s.AutocompleteCommand),
+	)
+	mux.HandleFunc("GET /api/channels/{channelid}/pins", s.WithAuthUser(s.GetChannelPins))
+	mux.HandleFunc("PUT /api/channels/{channelid}/pins/{messageid}", s.WithAuthUser(s.PinMessage))
+	mux.HandleFunc(
+		"DELETE /api/channels/{channelid}/pins/{messageid}",
+		s.WithAuthUser(s.UnpinMessage),
+	)
 
-	mux.HandleFunc("GET /api/channels/{channelid}/messages", s.GetChannelMessages)
-	mux.HandleFunc("POST /api/channels/{channelid}/messages", s.CreateChannelMessage)
+	mux.HandleFunc("GET /api/channels/{channelid}/messages", s.WithAuthUser(s.GetChannelMessages))
+	mux.HandleFunc(
+		"POST /api/channels/{channelid}/messages",
+		s.WithAuthUser(s.CreateChannelMessage),
+	)
 	mux.HandleFunc("GET /api/channels/{channelid}/messages/{messageid}", s.GetMessage)
 	mux.HandleFunc(
 		"PATCH /api/channels/{channelid}/messages/{messageid}",
@@ -88,6 +294,22 @@ func (s *Server) RegisterRoutes(logserver bool) http.Handler {
 		"DELETE /api/channels/{channelid}/messages/{messageid}",
 		s.WithAuthUser(s.DeleteMessage),
 	)
+	mux.HandleFunc(
+		"GET /api/channels/{channelid}/messages/{messageid}/thread",
+		s.WithAuthUser(s.GetThread),
+	)
+	mux.HandleFunc(
+		"POST /api/channels/{channelid}/messages/{messageid}/thread",
+		s.WithAuthUser(s.CreateThreadMessage),
+	)
+	mux.HandleFunc(
+		"PUT /api/channels/{channelid}/messages/{messageid}/thread/follow",
+		s.WithAuthUser(s.FollowThread),
+	)
+	mux.HandleFunc(
+		"DELETE /api/channels/{channelid}/messages/{messageid}/thread/follow",
+		s.WithAuthUser(s.UnfollowThread),
+	)
 
 	handler := http.Handler(mux)
 	if logserver {
@@ -138,6 +360,16 @@ func (s *Server) UpdateServer(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "error: unable to update server name", http.StatusBadRequest)
 		return
 	}
+	if new_server_name.ServerName != server_info.ServerName {
+		s.recordAudit(r, database.AuditEntry{
+			ServerId:   serverid,
+			Action:     auditServerUpdate,
+			TargetType: database.AuditTargetServer,
+			TargetId:   serverid,
+			Before:     map[string]any{"servername": server_info.ServerName},
+			After:      map[string]any{"servername": new_server_name.ServerName},
+		})
+	}
 }
 
 func (s *Server) DeleteServer(w http.ResponseWriter, r *http.Request) {
@@ -195,19 +427,52 @@ func (s *Server) UpdateChannel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	new_channel_name := struct {
-		UpdatedChannelName string `json:"channelname"`
+	new_channel_info := struct {
+		UpdatedChannelName *string `json:"channelname"`
+		PinLimit           *uint   `json:"pinlimit"`
 	}{}
-	err = json.NewDecoder(r.Body).Decode(&new_channel_name)
+	err = json.NewDecoder(r.Body).Decode(&new_channel_info)
 	if err != nil {
 		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
 		return
 	}
-	err = s.db.UpdateChannel(channelid, new_channel_name.UpdatedChannelName)
-	if err != nil {
-		http.Error(w, "error: unable to update channel", http.StatusBadRequest)
+	if new_channel_info.PinLimit != nil && *new_channel_info.PinLimit > maxPinLimit {
+		http.Error(w, "error: pin limit too large", http.StatusBadRequest)
 		return
-
+	}
+	if new_channel_info.UpdatedChannelName != nil {
+		err = s.db.UpdateChannel(channelid, *new_channel_info.UpdatedChannelName)
+		if err != nil {
+			http.Error(w, "error: unable to update channel", http.StatusBadRequest)
+			return
+		}
+	}
+	if new_channel_info.PinLimit != nil {
+		err = s.db.UpdateChannelPinLimit(channelid, *new_channel_info.PinLimit)
+		if err != nil {
+			http.Error(w, "error: unable to update channel", http.StatusBadRequest)
+			return
+		}
+	}
+	before, after := map[string]any{}, map[string]any{}
+	if name := new_channel_info.UpdatedChannelName; name != nil && *name != channel_info.ChannelName {
+		before["channelname"], after["channelname"] = channel_info.ChannelName, *name
+	}
+	if limit := new_channel_info.PinLimit; limit != nil && *limit != channel_info.PinLimit {
+		before["pinlimit"], after["pinlimit"] = channel_info.PinLimit, *limit
+	}
+	if len(after) > 0 {
+		s.recordAudit(r, database.AuditEntry{
+			ServerId:   channel_info.ServerId,
+			Action:     auditChannelUpdate,
+			TargetType: database.AuditTargetChannel,
+			TargetId:   channelid,
+			Before:     before,
+			After:      after,
+		})
+	}
+	if updated, err := s.db.GetChannel(channelid); err == nil {
+		s.publishEvent(updated.ServerId, eventChannelUpdated, fromDBChannelToChannelInfo(updated))
 	}
 }
 
@@ -319,11 +584,20 @@ func (s *Server) AddChannelMember(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "user not in server", http.StatusBadRequest)
 		return
 	}
-	err = s.db.AddUserToChannel(newuserid, server_info.ServerId)
+	err = s.db.AddUserToChannel(newuserid, channel.ChannelId)
 	if err != nil {
 		http.Error(w, "error: unable to add user to channel", http.StatusBadRequest)
 		return
 	}
+	s.recordAudit(r, database.AuditEntry{
+		ServerId:   channel.ServerId,
+		Action:     auditMemberAdd,
+		TargetType: database.AuditTargetMember,
+		TargetId:   newuserid,
+		After:      map[string]any{"channelid": channel.ChannelId},
+	})
+	s.publishEvent(channel.ServerId, eventMemberJoined, channelMemberEvent{UserId: newuserid, ChannelId: channel.ChannelId})
+	s.broadcastMembership("member_joined", channel, newuserid)
 }
 
 func (s *Server) RemoveChannelMember(w http.ResponseWriter, r *http.Request) {
@@ -385,6 +659,15 @@ func (s *Server) RemoveChannelMember(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "error: unable to remove user from channel", http.StatusBadRequest)
 		return
 	}
+	s.recordAudit(r, database.AuditEntry{
+		ServerId:   channel.ServerId,
+		Action:     auditMemberRemove,
+		TargetType: database.AuditTargetMember,
+		TargetId:   newuserid,
+		Before:     map[string]any{"channelid": channel.ChannelId},
+	})
+	s.publishEvent(channel.ServerId, eventMemberLeft, channelMemberEvent{UserId: newuserid, ChannelId: channel.ChannelId})
+	s.broadcastMembership("member_left", channel, newuserid)
 }
 
 func (s *Server) UpdateMessage(w http.ResponseWriter, r *http.Request) {
@@ -420,6 +703,10 @@ func (s *Server) UpdateMessage(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "error: user not in channel", http.StatusBadRequest)
 		return
 	}
+	if err := s.checkRestriction(userid, message.ChannelId); err != nil {
+		writeRestrictionError(w, err)
+		return
+	}
 
 	message_data := struct {
 		Message string `json:"message"`
@@ -434,6 +721,12 @@ func (s *Server) UpdateMessage(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "error: issue while updating message", http.StatusBadRequest)
 		return
 	}
+	if updated, err := s.db.GetMessage(message.MessageId); err == nil {
+		s.publishEvent(updated.ServerId, eventMessageUpdated, fromDBMessageToSeverMessage(updated))
+		if byte_data, err := newServerResponse("message_updated", fromDBMessageToSeverMessage(updated)); err == nil {
+			s.broadcastToChannel(updated.ServerId, updated.ChannelId, byte_data)
+		}
+	}
 }
 
 func (s *Server) DeleteMessage(w http.ResponseWriter, r *http.Request) {
@@ -456,16 +749,44 @@ func (s *Server) DeleteMessage(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "error: unable to fetch message", http.StatusBadRequest)
 		return
 	}
-	if message.UserId != userid {
-
-		http.Error(w, "error: attempting to modify different user message", http.StatusBadRequest)
-		return
+	// server owners may remove the messages of others, which is audited.
+	// Direct messages have no server and so no owner to do that.
+	moderated := message.UserId != userid
+	if moderated {
+		server, err := s.db.GetServer(message.ServerId)
+		if err != nil || message.ServerId == 0 || server.OwnerId != userid {
+			http.Error(w, "error: attempting to modify different user message", http.StatusBadRequest)
+			return
+		}
 	}
-	err = s.db.DeleteMessage(message.MessageId)
+	// replies in the thread of the message go with it
+	attachments, err := s.db.DeleteMessage(message.MessageId)
 	if err != nil {
 		http.Error(w, "error: issue while deleting message", http.StatusBadRequest)
 		return
 	}
+	if moderated {
+		s.recordAudit(r, database.AuditEntry{
+			ServerId:   message.ServerId,
+			Action:     auditMessageDelete,
+			TargetType: database.AuditTargetMessage,
+			TargetId:   message.MessageId,
+			Before:     map[string]any{"userid": message.UserId, "channelid": message.ChannelId},
+		})
+	}
+	s.deleteAttachments(r.Context(), attachments)
+	s.publishEvent(message.ServerId, eventMessageDeleted, messageDeletedEvent{
+		MessageId: message.MessageId,
+		ChannelId: message.ChannelId,
+	})
+	byte_data, err := newServerResponse("message_deleted", map[string]any{
+		"messageid": message.MessageId,
+		"channelid": message.ChannelId,
+		"serverid":  message.ServerId,
+	})
+	if err == nil {
+		s.broadcastToChannel(message.ServerId, message.ChannelId, byte_data)
+	}
 }
 
 func (s *Server) UpdateUser(w http.ResponseWriter, r *http.Request) {
@@ -529,6 +850,14 @@ func (s *Server) DeleteChannel(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "error: unable to delete channel", http.StatusBadRequest)
 		return
 	}
+	s.recordAudit(r, database.AuditEntry{
+		ServerId:   channel.ServerId,
+		Action:     auditChannelDelete,
+		TargetType: database.AuditTargetChannel,
+		TargetId:   channel.ChannelId,
+		Before:     map[string]any{"channelname": channel.ChannelName},
+	})
+	s.publishEvent(channel.ServerId, eventChannelDeleted, fromDBChannelToChannelInfo(channel))
 }
 
 func (s *Server) CreateChannel(w http.ResponseWriter, r *http.Request) {
@@ -560,6 +889,16 @@ func (s *Server) CreateChannel(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "error: unable to create channel", http.StatusBadRequest)
 		return
 	}
+	s.recordAudit(r, database.AuditEntry{
+		ServerId:   serverid,
+		Action:     auditChannelCreate,
+		TargetType: database.AuditTargetChannel,
+		TargetId:   channelid,
+		After:      map[string]any{"channelname": channel_data.ChannelName},
+	})
+	if channel, err := s.db.GetChannel(channelid); err == nil {
+		s.publishEvent(serverid, eventChannelCreated, fromDBChannelToChannelInfo(channel))
+	}
 	resp := map[string]any{
 		"channelid": channelid,
 	}
@@ -589,19 +928,7 @@ func (s *Server) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "error: unable to delete session token", http.StatusBadRequest)
 		return
 	}
-	cookie := &http.Cookie{
-		Name:     "token", // Replace with your actual cookie name
-		Value:    "",
-		Path:     "/", // Ensure this matches the cookie's original path
-		HttpOnly: true,
-		Secure:   false, // Set to true if your site uses HTTPS
-		SameSite: http.SameSiteStrictMode,
-		Expires:  time.Now().Add(-time.Hour), // Set the expiration time to the past
-		MaxAge:   -1,                         // Set MaxAge to 0 or a negative value to delete the cookie immediately
-	}
-
-	// Set the expired cookie in the response header.
-	http.SetCookie(w, cookie)
+	expireSessionCookie(w)
 	return
 }
 
@@ -629,19 +956,61 @@ func (s *Server) CreateChannelMessage(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "user not in channel", http.StatusBadRequest)
 		return
 	}
+	if err := s.checkDirectMessageBlock(userid, channelid); err != nil {
+		http.Error(w, "error: unable to message user", http.StatusForbidden)
+		return
+	}
+	if err := s.checkRestriction(userid, channelid); err != nil {
+		writeRestrictionError(w, err)
+		return
+	}
 	message_data := struct {
-		Message string `json:"message"`
+		Message string       `json:"message"`
+		ReplyTo *database.Id `json:"reply_to"`
 	}{}
 	err = json.NewDecoder(r.Body).Decode(&message_data)
 	if err != nil {
 		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
 		return
 	}
-	messageid, err := s.db.AddMessage(userid, channelid, message_data.Message)
+	if len(message_data.Message) > maxMessageLength {
+		http.Error(w, "error: message too long", http.StatusBadRequest)
+		return
+	}
+	if name, raw, ok := parseSlashCommand(message_data.Message); ok {
+		s.runCommandFromRequest(w, r, userid, channelid, name, raw)
+		return
+	}
+	// a leading "//" posts text that would otherwise run a command
+	message_data.Message = unescapeSlashCommand(message_data.Message)
+	if message_data.ReplyTo != nil {
+		err = s.validateReplyTarget(channelid, nil, *message_data.ReplyTo)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	messageid, err := s.db.CreateMessage(database.NewMessage{
+		ChannelId: channelid,
+		UserId:    userid,
+		Contents:  message_data.Message,
+		ReplyToId: message_data.ReplyTo,
+	})
 	if err != nil {
 		http.Error(w, "error: unable to create message", http.StatusBadRequest)
 		return
 	}
+	s.previews.Enqueue(messageid, message_data.Message)
+	dbmsg, err := s.db.GetMessage(messageid)
+	if err != nil {
+		http.Error(w, "error: unable to fetch message", http.StatusInternalServerError)
+		return
+	}
+	byte_data, err := newServerResponse("message", fromDBMessageToSeverMessage(dbmsg))
+	if err == nil {
+		s.broadcastToChannel(dbmsg.ServerId, dbmsg.ChannelId, byte_data)
+	}
+	s.publishEvent(dbmsg.ServerId, eventMessageCreated, fromDBMessageToSeverMessage(dbmsg))
 	resp := map[string]any{
 		"messageid": messageid,
 	}
@@ -704,16 +1073,10 @@ func (s *Server) GetChannelMessages(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "database error", http.StatusInternalServerError)
 		return
 	}
-	resp := map[string]any{"messages": messages}
-	jsonResp, err := json.Marshal(resp)
-	if err != nil {
-		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
-		return
-	}
-	w.Header().Set("Content-Type", "application/json")
-	if _, err := w.Write(jsonResp); err != nil {
-		log.Printf("Failed to write response: %v", err)
-	}
+	servermessages := fromDBMessagesToServerMessages(messages)
+	s.flagBlockedMessages(userid, servermessages)
+	resp := map[string]any{"messages": servermessages}
+	writeJSON(w, resp)
 }
 
 func (s *Server) GetChannel(w http.ResponseWriter, r *http.Request) {
@@ -742,18 +1105,7 @@ func (s *Server) GetChannel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	payload := struct {
-		ChannelId   database.Id `json:"channelid"`
-		ServerId    database.Id `json:"serverid"`
-		ChannelName string      `json:"channelname"`
-		Timestamp   time.Time   `json:"timestamp"`
-	}{
-		ChannelId:   channel_info.ChannelId,
-		ServerId:    channel_info.ServerId,
-		ChannelName: channel_info.ChannelName,
-		Timestamp:   channel_info.Timestamp,
-	}
-	jsonResp, err := json.Marshal(payload)
+	jsonResp, err := json.Marshal(fromDBChannelToChannelInfo(channel_info))
 	if err != nil {
 		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
 		return
@@ -869,37 +1221,55 @@ func (s *Server) loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, _, err := s.db.UpdateUserSessionToken(userid)
+	twofactor, err := s.db.GetTwoFactor(userid)
+	if err != nil && !errors.Is(err, database.ErrRecordNotFound) {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if err == nil && twofactor.Enabled {
+		// the password alone only earns a challenge to answer with a code
+		challenge, err := s.issueAuthToken(userid, tokenPurposeLoginChallenge, "", loginChallengeLifetime)
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]any{
+			"userid":              userid,
+			"two_factor_required": true,
+			"challenge":           challenge,
+		})
+		return
+	}
+	s.startSession(w, userid)
+}
+
+// startSession signs a user in, setting the session cookie and responding
+// with their id.
+func (s *Server) startSession(w http.ResponseWriter, userid database.Id) {
+	cancelled, err := s.createSession(w, userid)
 	if err != nil {
 		http.Error(w, "unable to update session token", http.StatusBadRequest)
 		return
 	}
-
 	resp := map[string]any{
 		"userid": userid,
 	}
+	if cancelled {
+		resp["deletion_cancelled"] = true
+	}
+	writeJSON(w, resp)
+}
 
-	// Set a cookie (you can modify the cookie as needed)
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    token,
-		Path:     "/",
-		Secure:   false,
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-	})
-
-	// Redirect the user to /chat
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(resp)
+// createSession sets the session cookie of a user. It reports whether
+// signing in cancelled a pending account deletion.
+func (s *Server) createSession(w http.ResponseWriter, userid database.Id) (bool, error) {
+	token, _, err := s.db.UpdateUserSessionToken(userid)
 	if err != nil {
-		http.Error(
-			w,
-			"internal error: unable to send encoded response",
-			http.StatusInternalServerError,
-		)
-		return
+		return false, err
 	}
+	setSessionCookie(w, token)
+	// logging in during the grace period restores an account pending deletion
+	return s.db.CancelAccountDeletion(userid) == nil, nil
 }
 
 func (s *Server) AddUserToServer(w http.ResponseWriter, r *http.Request) {
@@ -950,7 +1320,7 @@ func (s *Server) createNewServer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: add proper user name here
+	// members start without a nickname and are shown by their display name
 	err = s.db.AddUserToServer(userid, serverid, "")
 	if err != nil {
 		http.Error(w, "unable to add user to server", http.StatusBadRequest)
@@ -991,10 +1361,27 @@ func (s *Server) createUserHandler(w http.ResponseWriter, r *http.Request) {
 	loginData := struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
+		Email    string `json:"email"`
 	}{}
 	err = json.NewDecoder(r.Body).Decode(&loginData)
 	username := loginData.Username
 	password := loginData.Password
+	email := ""
+	if strings.TrimSpace(loginData.Email) != "" {
+		email, err = normalizeEmail(loginData.Email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, err := s.db.GetUserIDFromEmail(email); err == nil {
+			http.Error(w, "email address already in use", http.StatusBadRequest)
+			return
+		}
+	}
+	if err := s.passwords.check(username, password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	userid, err := s.db.CreateUser(username, password)
 	if errors.Is(err, database.ErrRecordAlreadyExists) {
 		http.Error(w, "user already exists", http.StatusBadRequest)
@@ -1005,6 +1392,16 @@ func (s *Server) createUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if email != "" {
+		err = s.db.SetUserEmail(userid, email)
+		if err == nil {
+			err = s.sendVerificationEmail(r.Context(), userid, email)
+		}
+		if err != nil {
+			log.Printf("createUserHandler: unable to set email of %d: %v", userid, err)
+		}
+	}
+
 	valid_user, err := s.db.ValidateUserLoginInfo(userid, password)
 	if err != nil {
 		http.Error(w, "internal error", http.StatusInternalServerError)
@@ -1025,15 +1422,7 @@ func (s *Server) createUserHandler(w http.ResponseWriter, r *http.Request) {
 		"userid": userid,
 	}
 
-	// Set a cookie (you can modify the cookie as needed)
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    token,
-		Path:     "/",
-		Secure:   false,
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-	})
+	setSessionCookie(w, token)
 
 	// Redirect the user to /chat
 	w.Header().Set("Content-Type", "application/json")
@@ -1208,20 +1597,10 @@ func (s *Server) GetServerMessages(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		tempmsgs := make([]ServerMessage, len(db_messages))
-		for i, dbmsg := range db_messages {
-			tempmsgs[i] = ServerMessage{
-				UserId:    dbmsg.UserId,
-				MessageID: dbmsg.MessageId,
-				ServerId:  serverid,
-				ChannelId: dbmsg.ChannelId,
-				Message:   dbmsg.Contents,
-				Date:      dbmsg.Timestamp.Format(time.UnixDate),
-			}
-		}
-		messages = append(messages, tempmsgs...)
+		messages = append(messages, fromDBMessagesToServerMessages(db_messages)...)
 
 	}
+	s.flagBlockedMessages(userid, messages)
 	resp := map[string]any{"serverid": serverid, "messages": messages}
 	jsonResp, err := json.Marshal(resp)
 	if err != nil {
@@ -1241,11 +1620,15 @@ func (s *Server) GetServerMembersHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	users, err := s.db.GetUsersOfServer(serverid)
+	members, err := s.db.GetServerMembers(serverid)
 	if err != nil {
 		http.Error(w, "database error", http.StatusInternalServerError)
 		return
 	}
+	users := make([]MemberInfo, len(members))
+	for i, member := range members {
+		users[i] = fromDBMemberToMemberInfo(member)
+	}
 	resp := map[string]any{"users": users, "serverid": serverid}
 	jsonResp, err := json.Marshal(resp)
 	if err != nil {
@@ -1274,21 +1657,15 @@ func (s *Server) GetUserHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "database error", http.StatusInternalServerError)
 		return
 	}
-	resp := map[string]string{"username": user.UserName}
-	jsonResp, err := json.Marshal(resp)
-	if err != nil {
-		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
-		return
-	}
-	w.Header().Set("Content-Type", "application/json")
-	if _, err := w.Write(jsonResp); err != nil {
-		log.Printf("Failed to write response: %v", err)
-	}
+	writeJSON(w, fromDBUserToProfile(user))
 }
 
+const maxMessageLength = 1000
+
 type rawChannelMessage struct {
 	channel_id database.Id
 	message    string
+	reply_to   *database.Id
 }
 
 func (s *Server) websocketHandler(w http.ResponseWriter, r *http.Request) {
@@ -1315,30 +1692,20 @@ func (s *Server) websocketHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	id, incoming := s.ws_manager.NewConnection(conn)
-	for _, channel := range servers {
-		if _, ok := s.sessions_in_channel[channel.ServerId]; !ok {
-			s.sessions_in_channel[channel.ServerId] = make(map[string]bool)
-		}
-		s.sessions_in_channel[channel.ServerId][id] = true
+	if s.addSession(id, userinfo.UserId, servers) {
+		s.broadcastPresence(userinfo.UserId, "online")
 	}
 	defer func() {
 		s.ws_manager.CloseConnection(id)
-
-		for _, channel := range servers {
-			if _, ok := s.sessions_in_channel[channel.ServerId]; !ok {
-				continue
-			}
-			// TODO: Add some kind of mutex lock
-			delete(s.sessions_in_channel[channel.ServerId], id)
-			if len(s.sessions_in_channel[channel.ServerId]) == 0 {
-				delete(s.sessions_in_channel, channel.ServerId)
-			}
+		if s.removeSession(id, userinfo.UserId, servers) {
+			s.broadcastPresence(userinfo.UserId, "offline")
 		}
 	}()
 
 	fmt.Printf("starting websocket loop: %d ms\n",
 		time.Since(startTime).Milliseconds(),
 	)
+	canSend := hasScope(r, scopeMessagesWrite)
 	for {
 		select {
 		case msg, ok := <-incoming:
@@ -1346,8 +1713,17 @@ func (s *Server) websocketHandler(w http.ResponseWriter, r *http.Request) {
 				log.Printf("websocketHandler: incoming channel closed for user %d", userinfo.UserId)
 				return
 			}
-			serverid, byte_data, err := s.ProcessMessage(userinfo.UserId, msg)
+			if !canSend {
+				log.Printf("websocketHandler: token of user %d lacks the %s scope", userinfo.UserId, scopeMessagesWrite)
+				continue
+			}
+			dbmsg, byte_data, err := s.ProcessMessage(r.Context(), userinfo.UserId, msg)
 			if err != nil {
+				var rejected *rejectedMessageError
+				if errors.As(err, &rejected) {
+					s.rejectMessage(id, rejected)
+					continue
+				}
 				log.Printf(
 					"websocketHandler: error processing message for user %d: %v",
 					userinfo.UserId,
@@ -1355,43 +1731,45 @@ func (s *Server) websocketHandler(w http.ResponseWriter, r *http.Request) {
 				)
 				continue
 			}
-			for k := range s.sessions_in_channel[serverid] {
-				s.ws_manager.SendToClient(k, byte_data)
+			if byte_data == nil {
+				continue
 			}
+			s.broadcastToChannel(dbmsg.ServerId, dbmsg.ChannelId, byte_data)
 		}
 	}
 }
 
 func (s *Server) ProcessMessage(
+	ctx context.Context,
 	userid database.Id,
 	msg websocket.IncomingMessage,
-) (database.Id, []byte, error) {
+) (database.Message, []byte, error) {
 	// todo add message parsing
 	data := ServerResponseMessage{}
 	err := json.Unmarshal(msg.Payload, &data)
 	if err != nil {
 		fmt.Printf("error getting message from websocket: %e\n", err)
-		return 0, nil, err
+		return database.Message{}, nil, err
 	}
 	if data.Message_type != "channel_message" {
 		fmt.Printf("websocketHandler: invalid message type %s\n\n", data.Message_type)
-		return 0, nil, err
+		return database.Message{}, nil, err
 	}
 	paymap, ok := data.Payload.(map[string]any)
 
 	if !ok {
 		fmt.Printf("websocketHandler: invalid payload type %T\n", data.Payload)
-		return 0, nil, err
+		return database.Message{}, nil, err
 	}
 	channelidstr, ok := paymap["channel_id"]
 	if !ok {
 		fmt.Printf("websocketHandler: invalid payload %s\n", data.Payload)
-		return 0, nil, err
+		return database.Message{}, nil, err
 	}
 	channelidfloat, ok := channelidstr.(float64)
 	if !ok {
 		fmt.Printf("websocketHandler: invalid payload %s\n", data.Payload)
-		return 0, nil, err
+		return database.Message{}, nil, err
 	}
 	var channelid database.Id
 	channelid = database.Id(channelidfloat)
@@ -1399,45 +1777,74 @@ func (s *Server) ProcessMessage(
 		channel_id: database.Id(channelid),
 		message:    paymap["message"].(string),
 	}
+	if replytofloat, ok := paymap["reply_to"].(float64); ok && replytofloat > 0 {
+		replyto := database.Id(replytofloat)
+		payload.reply_to = &replyto
+	}
 	if payload.channel_id <= 0 {
 		fmt.Printf(
 			"websocketHandler: invalid channel id channe_id=%d\n",
 			payload.channel_id,
 		)
-		return 0, nil, err
+		return database.Message{}, nil, err
 	}
-	if len(payload.message) > 1000 {
+	if len(payload.message) > maxMessageLength {
 		fmt.Printf(
 			"format error: length of message to large length=%d\n",
 			len(payload.message),
 		)
-		return 0, nil, err
+		return database.Message{}, nil, err
 	}
-	messageid, err := s.db.AddMessage(payload.channel_id, userid, payload.message)
+	inchannel, err := s.db.IsUserInChannel(userid, payload.channel_id)
+	if err != nil {
+		return database.Message{}, nil, err
+	}
+	if !inchannel {
+		return database.Message{}, nil, errors.New("user not in channel")
+	}
+	if err := s.checkDirectMessageBlock(userid, payload.channel_id); err != nil {
+		return database.Message{}, nil, rejectedMessage(payload.channel_id, err)
+	}
+	if err := s.checkRestriction(userid, payload.channel_id); err != nil {
+		return database.Message{}, nil, rejectedMessage(payload.channel_id, err)
+	}
+	if name, raw, ok := parseSlashCommand(payload.message); ok {
+		// command results are delivered by runCommand itself
+		return database.Message{}, nil, s.runCommandFromSocket(ctx, userid, payload.channel_id, name, raw)
+	}
+	payload.message = unescapeSlashCommand(payload.message)
+	if payload.reply_to != nil {
+		err = s.validateReplyTarget(payload.channel_id, nil, *payload.reply_to)
+		if err != nil {
+			fmt.Printf("websocketHandler: invalid reply target: %v\n", err)
+			return database.Message{}, nil, err
+		}
+	}
+	messageid, err := s.db.CreateMessage(database.NewMessage{
+		ChannelId: payload.channel_id,
+		UserId:    userid,
+		Contents:  payload.message,
+		ReplyToId: payload.reply_to,
+	})
 	if err != nil {
 		fmt.Printf("error saving message: %e\n", err)
-		return 0, nil, err
+		return database.Message{}, nil, err
 	}
+	s.previews.Enqueue(messageid, payload.message)
 	dbmsg, err := s.db.GetMessage(messageid)
 	if err != nil {
 		fmt.Printf("error saving message: %e\n", err)
-		return 0, nil, err
+		return database.Message{}, nil, err
 	}
 
-	smsg := ServerMessage{
-		UserId:    dbmsg.UserId,
-		MessageID: messageid,
-		ServerId:  dbmsg.ServerId,
-		ChannelId: dbmsg.ChannelId,
-		Message:   dbmsg.Contents,
-		Date:      dbmsg.Timestamp.Format(time.UnixDate),
-	}
+	smsg := fromDBMessageToSeverMessage(dbmsg)
+	s.publishEvent(dbmsg.ServerId, eventMessageCreated, smsg)
 	server_msg := ServerResponseMessage{Message_type: "message", Payload: smsg}
 	byte_data, err := json.Marshal(server_msg)
 	if err != nil {
 		fmt.Printf("error marshalling message: %e\n", err)
-		return 0, nil, err
+		return database.Message{}, nil, err
 	}
 	log.Printf("websocketHandler: sending message to user %d", userid)
-	return dbmsg.ServerId, byte_data, nil
+	return dbmsg, byte_data, nil
 }
@@ -0,0 +1,290 @@
+package server
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"go-chat-react/internal/database"
+)
+
+// maxExportedNames caps the username history included in exports.
+const maxExportedNames = 10000
+
+type ExportedMembership struct {
+	ServerID   database.Id `json:"serverid"`
+	ServerName string      `json:"servername"`
+	Nickname   string      `json:"nickname,omitempty"`
+	Owner      bool        `json:"owner"`
+}
+
+type ExportedNickname struct {
+	ServerID  database.Id `json:"serverid"`
+	Nickname  string      `json:"nickname"`
+	Timestamp string      `json:"timestamp"`
+}
+
+// buildExport gathers every file of a user's data export, keyed by file
+// name.
+func (s *Server) buildExport(userid database.Id) (map[string]any, error) {
+	user, err := s.db.GetUser(userid)
+	if err != nil {
+		return nil, err
+	}
+	servers, err := s.db.GetServersOfUser(userid)
+	if err != nil {
+		return nil, err
+	}
+	memberships := make([]ExportedMembership, len(servers))
+	for i, server := range servers {
+		memberships[i] = ExportedMembership{
+			ServerID:   server.ServerId,
+			ServerName: server.ServerName,
+			Owner:      server.OwnerId == userid,
+		}
+		if member, err := s.getServerMember(server.ServerId, userid); err == nil {
+			memberships[i].Nickname = member.Nickname
+		}
+	}
+	messages, err := s.db.GetMessagesOfUser(userid)
+	if err != nil {
+		return nil, err
+	}
+	dms, err := s.db.GetDirectMessagesOfUser(userid)
+	if err != nil {
+		return nil, err
+	}
+	conversations := make([]DirectMessageInfo, len(dms))
+	for i, dm := range dms {
+		conversations[i] = fromDBDirectMessageToInfo(dm)
+	}
+	usernames, err := s.db.GetRecentUsernames(userid, maxExportedNames)
+	if err != nil {
+		return nil, err
+	}
+	usernameHistory := make([]NameHistoryEntry, len(usernames))
+	for i, entry := range usernames {
+		usernameHistory[i] = NameHistoryEntry{Name: entry.Username, Timestamp: entry.Timestamp.String()}
+	}
+	nicknames, err := s.db.GetNicknamesOfUser(userid)
+	if err != nil {
+		return nil, err
+	}
+	nicknameHistory := make([]ExportedNickname, len(nicknames))
+	for i, entry := range nicknames {
+		nicknameHistory[i] = ExportedNickname{
+			ServerID:  entry.ServerId,
+			Nickname:  entry.Nickname,
+			Timestamp: entry.Timestamp.String(),
+		}
+	}
+	email, err := s.db.GetUserEmail(userid)
+	if err != nil {
+		return nil, err
+	}
+	friends, err := s.db.GetFriends(userid)
+	if err != nil {
+		return nil, err
+	}
+	blocked, err := s.db.GetBlockedUsers(userid)
+	if err != nil {
+		return nil, err
+	}
+	toUsers := func(users []database.User) []User {
+		result := make([]User, len(users))
+		for i, user := range users {
+			result[i] = User{UserID: user.UserId, UserName: user.UserName}
+		}
+		return result
+	}
+	return map[string]any{
+		"profile.json":          fromDBUserToProfile(user),
+		"email.json":            map[string]any{"email": email.Email, "verified": email.Verified},
+		"servers.json":          memberships,
+		"messages.json":         fromDBMessagesToServerMessages(messages),
+		"direct_messages.json":  conversations,
+		"username_history.json": usernameHistory,
+		"nickname_history.json": nicknameHistory,
+		"friends.json":          toUsers(friends),
+		"blocked_users.json":    toUsers(blocked),
+	}, nil
+}
+
+// ExportUserData sends the caller a zip archive of everything stored about
+// them: profile, memberships, messages, conversations, relationships and
+// name history, plus their avatar if one is set.
+func (s *Server) ExportUserData(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	files, err := s.buildExport(userid)
+	if err != nil {
+		log.Printf("ExportUserData: unable to export user %d: %v", userid, err)
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	user, err := s.db.GetUser(userid)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set(
+		"Content-Disposition",
+		fmt.Sprintf("attachment; filename=\"export-%d-%s.zip\"", userid, time.Now().UTC().Format("20060102")),
+	)
+	archive := zip.NewWriter(w)
+	for name, data := range files {
+		file, err := archive.Create(name)
+		if err != nil {
+			log.Printf("ExportUserData: unable to add %s: %v", name, err)
+			return
+		}
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(data); err != nil {
+			log.Printf("ExportUserData: unable to write %s: %v", name, err)
+			return
+		}
+	}
+	if user.AvatarKey != "" {
+		if blob, err := s.blobs.Get(r.Context(), user.AvatarKey); err == nil {
+			if file, err := archive.Create("avatar.png"); err == nil {
+				io.Copy(file, blob)
+			}
+			blob.Close()
+		}
+	}
+	if err := archive.Close(); err != nil {
+		log.Printf("ExportUserData: unable to finish archive: %v", err)
+	}
+}
+
+// confirmPassword checks the password a user gives to confirm a sensitive
+// change. Users without a password, created through single sign-on, have
+// nothing to confirm with and pass.
+func (s *Server) confirmPassword(userid database.Id, password string) (bool, error) {
+	login, err := s.db.GetUserLoginInfo(userid)
+	if err != nil {
+		return false, err
+	}
+	if !login.HasPassword() {
+		return true, nil
+	}
+	return s.db.ValidateUserLoginInfo(userid, password)
+}
+
+// ChangePassword replaces the caller's password after checking the current
+// one, if they have one. Every other session is signed out and the caller receives a new
+// session cookie.
+func (s *Server) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	request := struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	valid, err := s.confirmPassword(userid, request.CurrentPassword)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "invalid password", http.StatusForbidden)
+		return
+	}
+	if request.NewPassword == request.CurrentPassword {
+		http.Error(w, "error: new password must differ from the current one", http.StatusBadRequest)
+		return
+	}
+	user, err := s.db.GetUser(userid)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.passwords.check(user.UserName, request.NewPassword); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = s.db.UpdateUserPassword(userid, request.NewPassword)
+	if err != nil {
+		http.Error(w, "error: unable to update password", http.StatusInternalServerError)
+		return
+	}
+	s.closeSessionsOfUser(userid)
+	token, _, err := s.db.RotateUserSessionToken(userid)
+	if err != nil {
+		log.Printf("ChangePassword: unable to rotate session of %d: %v", userid, err)
+		http.Error(w, "unable to update session token", http.StatusInternalServerError)
+		return
+	}
+	setSessionCookie(w, token)
+	writeJSON(w, map[string]any{"userid": userid})
+}
+
+// DeleteAccount schedules the caller's account for deletion after the grace
+// period and logs them out everywhere. Logging in again before the period
+// ends cancels the deletion. The request chooses whether messages are
+// removed or kept under a "deleted user" tombstone.
+func (s *Server) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	request := struct {
+		Password       string `json:"password"`
+		RemoveMessages bool   `json:"remove_messages"`
+	}{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	valid, err := s.confirmPassword(userid, request.Password)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "invalid password", http.StatusForbidden)
+		return
+	}
+	deleteAfter := time.Now().Add(s.deletionGrace)
+	err = s.db.ScheduleAccountDeletion(userid, deleteAfter, request.RemoveMessages)
+	if err != nil {
+		http.Error(w, "error: unable to schedule deletion", http.StatusInternalServerError)
+		return
+	}
+	err = s.db.DeleteUserSessionToken(userid)
+	if err != nil {
+		log.Printf("DeleteAccount: unable to revoke session of %d: %v", userid, err)
+	}
+	s.closeSessionsOfUser(userid)
+	// the tokens of the account and its bots are refused from now on, so
+	// sockets opened with them go as well
+	bots, err := s.db.GetBotsOfUser(userid)
+	if err != nil {
+		log.Printf("DeleteAccount: unable to fetch bots of %d: %v", userid, err)
+	}
+	for _, bot := range bots {
+		s.closeSessionsOfUser(bot.UserId)
+	}
+	expireSessionCookie(w)
+	writeJSON(w, map[string]any{"delete_after": deleteAfter.UTC().Format(time.RFC3339)})
+}
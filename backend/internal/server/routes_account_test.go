@@ -0,0 +1,171 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestExportUserData(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	resp := s.expectStatus(t, http.MethodGet, "/api/users/me/export", nil, "u1", "1", http.StatusOK)
+	if resp.Header.Get("Content-Type") != "application/zip" {
+		t.Fatalf("expected zip archive; got %q", resp.Header.Get("Content-Type"))
+	}
+	data, _ := io.ReadAll(resp.Body)
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("error reading archive. Err: %v", err)
+	}
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatalf("error opening %s. Err: %v", file.Name, err)
+		}
+		files[file.Name], _ = io.ReadAll(reader)
+		reader.Close()
+	}
+	profile := UserProfile{}
+	if err := json.Unmarshal(files["profile.json"], &profile); err != nil || profile.UserName != "u1" {
+		t.Fatalf("unexpected profile %s err: %v", files["profile.json"], err)
+	}
+	messages := []ServerMessage{}
+	if err := json.Unmarshal(files["messages.json"], &messages); err != nil {
+		t.Fatalf("error decoding messages. Err: %v", err)
+	}
+	if len(messages) != 3 {
+		t.Fatalf("expected 3 exported messages; got %d", len(messages))
+	}
+	memberships := []ExportedMembership{}
+	if err := json.Unmarshal(files["servers.json"], &memberships); err != nil || len(memberships) != 2 {
+		t.Fatalf("unexpected memberships %s err: %v", files["servers.json"], err)
+	}
+	for _, name := range []string{"username_history.json", "nickname_history.json", "direct_messages.json"} {
+		if _, ok := files[name]; !ok {
+			t.Fatalf("expected %s in export", name)
+		}
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	s.expectStatus(t, http.MethodDelete, "/api/users/me",
+		map[string]any{"password": "wrong"}, "u1", "1", http.StatusForbidden)
+	s.expectStatus(t, http.MethodDelete, "/api/users/me",
+		map[string]any{"password": "1"}, "u1", "1", http.StatusOK)
+
+	deletions := newAccountDeletionWorker(s.app, time.Hour)
+	if err := deletions.process(context.Background(), time.Now()); err != nil {
+		t.Fatalf("error processing deletions. Err: %v", err)
+	}
+	profile := s.getProfile(t, "1")
+	if profile.DisplayName != "Deleted User" {
+		t.Fatalf("expected tombstone profile; got %+v", profile)
+	}
+	if _, err := s.getLoginCookie(profile.UserName, "1"); err == nil {
+		t.Fatalf("expected login of deleted account to fail")
+	}
+	resp := s.expectStatus(t, http.MethodGet, "/api/servers/1", nil, "u3", "3", http.StatusOK)
+	server := struct {
+		OwnerId uint `json:"ownerid"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&server); err != nil || server.OwnerId != 3 {
+		t.Fatalf("expected ownership to pass to user 3; got %+v err: %v", server, err)
+	}
+}
+
+func TestDeleteAccount_CancelledByLogin(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	s.app.deletionGrace = time.Hour
+	s.expectStatus(t, http.MethodDelete, "/api/users/me",
+		map[string]any{"password": "3"}, "u3", "3", http.StatusOK)
+	deletions := newAccountDeletionWorker(s.app, time.Hour)
+	if err := deletions.process(context.Background(), time.Now()); err != nil {
+		t.Fatalf("error processing deletions. Err: %v", err)
+	}
+	if profile := s.getProfile(t, "3"); profile.UserName != "u3" {
+		t.Fatalf("expected account to survive the grace period; got %+v", profile)
+	}
+	if _, err := s.getLoginCookie("u3", "3"); err != nil {
+		t.Fatalf("error logging in. Err: %v", err)
+	}
+	if err := deletions.process(context.Background(), time.Now().Add(2*time.Hour)); err != nil {
+		t.Fatalf("error processing deletions. Err: %v", err)
+	}
+	if profile := s.getProfile(t, "3"); profile.UserName != "u3" {
+		t.Fatalf("expected login to cancel deletion; got %+v", profile)
+	}
+}
+
+func TestDeleteAccount_RefusesAPITokens(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	s.app.deletionGrace = time.Hour
+	token, _ := s.createAPIToken(t, "/api/users/me/tokens", []string{scopeMessagesRead})
+	_, botToken := s.createCommandBot(t)
+	s.expectBearerStatus(t, http.MethodGet, "/api/channels/1/messages", nil, token, http.StatusOK)
+	s.expectStatus(t, http.MethodDelete, "/api/users/me",
+		map[string]any{"password": "1"}, "u1", "1", http.StatusOK)
+
+	s.expectBearerStatus(t, http.MethodGet, "/api/channels/1/messages", nil, token, http.StatusUnauthorized)
+	s.expectBearerStatus(t, http.MethodGet, "/api/users/me/commands", nil, botToken, http.StatusUnauthorized)
+
+	if _, err := s.getLoginCookie("u1", "1"); err != nil {
+		t.Fatalf("error logging in. Err: %v", err)
+	}
+	s.expectBearerStatus(t, http.MethodGet, "/api/channels/1/messages", nil, token, http.StatusOK)
+	s.expectBearerStatus(t, http.MethodGet, "/api/users/me/commands", nil, botToken, http.StatusOK)
+}
+
+func TestChangePassword(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	other, err := s.getLoginCookie("u1", "1")
+	if err != nil {
+		t.Fatalf("error logging in. Err: %v", err)
+	}
+	path := "/api/users/me/password"
+	s.expectStatus(t, http.MethodPost, path,
+		map[string]any{"current_password": "wrong", "new_password": "a new passphrase"}, "u1", "1", http.StatusForbidden)
+	s.expectStatus(t, http.MethodPost, path,
+		map[string]any{"current_password": "1", "new_password": "short"}, "u1", "1", http.StatusBadRequest)
+	s.expectStatus(t, http.MethodPost, path,
+		map[string]any{"current_password": "1", "new_password": "password123"}, "u1", "1", http.StatusBadRequest)
+	s.expectStatus(t, http.MethodPost, path,
+		map[string]any{"current_password": "1", "new_password": "my name is u1"}, "u1", "1", http.StatusBadRequest)
+	resp := s.expectStatus(t, http.MethodPost, path,
+		map[string]any{"current_password": "1", "new_password": "a new passphrase"}, "u1", "1", http.StatusOK)
+
+	var fresh *http.Cookie
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "token" {
+			fresh = cookie
+		}
+	}
+	if fresh == nil || fresh.Value == other.Value {
+		t.Fatalf("expected a new session cookie; got %+v", fresh)
+	}
+	for cookie, status := range map[*http.Cookie]int{other: http.StatusBadRequest, fresh: http.StatusOK} {
+		req, _ := http.NewRequest(http.MethodGet, s.server.URL+"/api/users/me/email", nil)
+		req.AddCookie(cookie)
+		resp, err := s.server.Client().Do(req)
+		if err != nil {
+			t.Fatalf("error sending request. Err: %v", err)
+		}
+		if resp.StatusCode != status {
+			t.Fatalf("expected status %d for cookie %s; got %v", status, cookie.Value, resp.Status)
+		}
+	}
+	if _, err := s.getLoginCookie("u1", "a new passphrase"); err != nil {
+		t.Fatalf("error logging in with new password. Err: %v", err)
+	}
+}
@@ -0,0 +1,368 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"go-chat-react/internal/database"
+	"go-chat-react/internal/media"
+	"go-chat-react/internal/storage"
+)
+
+const (
+	maxAttachmentSize        = 25 << 20
+	maxAttachmentsPerMessage = 10
+	maxAttachmentNameLength  = 255
+	// multipart parts larger than this are spooled to disk while parsing
+	attachmentMemoryLimit = 8 << 20
+)
+
+type AttachmentInfo struct {
+	AttachmentId database.Id     `json:"attachmentid"`
+	FileName     string          `json:"filename"`
+	ContentType  string          `json:"content_type"`
+	Size         int64           `json:"size"`
+	URL          string          `json:"url"`
+	Width        *int            `json:"width,omitempty"`
+	Height       *int            `json:"height,omitempty"`
+	BlurHash     *string         `json:"blurhash,omitempty"`
+	Thumbnails   []ThumbnailInfo `json:"thumbnails,omitempty"`
+}
+
+type ThumbnailInfo struct {
+	Size   int    `json:"size"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+}
+
+func sanitizeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == "" {
+		name = "file"
+	}
+	if len(name) > maxAttachmentNameLength {
+		name = name[len(name)-maxAttachmentNameLength:]
+	}
+	return name
+}
+
+// storeAttachment uploads a single multipart file to the blob store. The
+// content type is sniffed from the data rather than trusting the client and
+// location metadata is stripped from images before anything is stored.
+func (s *Server) storeAttachment(
+	ctx context.Context,
+	channelid database.Id,
+	userid database.Id,
+	header *multipart.FileHeader,
+) (database.Attachment, error) {
+	file, err := header.Open()
+	if err != nil {
+		return database.Attachment{}, err
+	}
+	defer file.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return database.Attachment{}, err
+	}
+	head = head[:n]
+	attachment := database.Attachment{
+		ChannelId:   channelid,
+		UserId:      userid,
+		FileName:    sanitizeFileName(header.Filename),
+		ContentType: http.DetectContentType(head),
+		Size:        header.Size,
+		StorageKey:  fmt.Sprintf("attachments/%d/%s", channelid, uuid.New().String()),
+	}
+	var body io.Reader = io.MultiReader(bytes.NewReader(head), file)
+	if media.IsSupportedImage(attachment.ContentType) {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return database.Attachment{}, err
+		}
+		data = media.StripLocation(attachment.ContentType, data)
+		attachment.Size = int64(len(data))
+		body = bytes.NewReader(data)
+	}
+	err = s.blobs.Put(ctx, attachment.StorageKey, body, attachment.Size, attachment.ContentType)
+	if err != nil {
+		return database.Attachment{}, err
+	}
+	return attachment, nil
+}
+
+func (s *Server) deleteAttachments(ctx context.Context, attachments []database.Attachment) {
+	for _, attachment := range attachments {
+		keys := []string{attachment.StorageKey}
+		for _, thumbnail := range attachment.Thumbnails {
+			keys = append(keys, thumbnail.StorageKey)
+		}
+		for _, key := range keys {
+			err := s.blobs.Delete(ctx, key)
+			if err != nil && !errors.Is(err, storage.ErrBlobNotFound) {
+				log.Printf("deleteAttachments: unable to delete %s: %v", key, err)
+			}
+		}
+	}
+}
+
+func (s *Server) UploadAttachments(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	channelid, err := parsePathFromID(r, "channelid")
+	if err != nil {
+		http.Error(w, "invalid request: unable to parse channel id", http.StatusBadRequest)
+		return
+	}
+	inchannel, err := s.db.IsUserInChannel(userid, channelid)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error: %s", err), http.StatusBadRequest)
+		return
+	}
+	if !inchannel {
+		http.Error(w, "user not in channel", http.StatusBadRequest)
+		return
+	}
+	if err := s.checkDirectMessageBlock(userid, channelid); err != nil {
+		http.Error(w, "error: unable to message user", http.StatusForbidden)
+		return
+	}
+	if err := s.checkRestriction(userid, channelid); err != nil {
+		writeRestrictionError(w, err)
+		return
+	}
+	channel, err := s.db.GetChannel(channelid)
+	if err != nil {
+		http.Error(w, "error: unable to locate channel", http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAttachmentSize*maxAttachmentsPerMessage+(1<<20))
+	err = r.ParseMultipartForm(attachmentMemoryLimit)
+	if err != nil {
+		http.Error(w, "error: unable to parse upload", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	files := r.MultipartForm.File["file"]
+	if len(files) == 0 {
+		http.Error(w, "error: no files uploaded", http.StatusBadRequest)
+		return
+	}
+	if len(files) > maxAttachmentsPerMessage {
+		http.Error(w, "error: too many files", http.StatusBadRequest)
+		return
+	}
+	contents := r.FormValue("message")
+	if len(contents) > maxMessageLength {
+		http.Error(w, "error: message too long", http.StatusBadRequest)
+		return
+	}
+	var total int64
+	for _, header := range files {
+		if header.Size > maxAttachmentSize {
+			http.Error(w, "error: file too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		total += header.Size
+	}
+	// direct messages have no server and only the per file limit applies
+	if !channel.IsDirectMessage() {
+		server, err := s.db.GetServer(channel.ServerId)
+		if err != nil {
+			http.Error(w, "error: unable to locate server", http.StatusBadRequest)
+			return
+		}
+		usage, err := s.db.GetServerAttachmentUsage(server.ServerId)
+		if err != nil {
+			http.Error(w, "database error", http.StatusInternalServerError)
+			return
+		}
+		if usage+total > server.UploadQuota {
+			http.Error(w, "error: server upload quota exceeded", http.StatusRequestEntityTooLarge)
+			return
+		}
+	}
+
+	var attachments []database.Attachment
+	for _, header := range files {
+		attachment, err := s.storeAttachment(r.Context(), channelid, userid, header)
+		if err != nil {
+			log.Printf("UploadAttachments: unable to store %s: %v", header.Filename, err)
+			s.deleteAttachments(r.Context(), attachments)
+			http.Error(w, "error: unable to store file", http.StatusInternalServerError)
+			return
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	messageid, err := s.db.CreateMessage(database.NewMessage{
+		ChannelId: channelid,
+		UserId:    userid,
+		Contents:  contents,
+	})
+	if err != nil {
+		s.deleteAttachments(r.Context(), attachments)
+		http.Error(w, "error: unable to create message", http.StatusBadRequest)
+		return
+	}
+	s.previews.Enqueue(messageid, contents)
+	for i := range attachments {
+		attachments[i].MessageId = &messageid
+		attachments[i].AttachmentId, err = s.db.CreateAttachment(attachments[i])
+		if err != nil {
+			s.deleteAttachments(r.Context(), attachments)
+			http.Error(w, "error: unable to save attachment", http.StatusInternalServerError)
+			return
+		}
+		if media.IsSupportedImage(attachments[i].ContentType) {
+			s.thumbnails.Enqueue(attachments[i].AttachmentId)
+		}
+	}
+
+	infos := make([]AttachmentInfo, len(attachments))
+	for i, attachment := range attachments {
+		infos[i] = fromDBAttachmentToAttachmentInfo(attachment)
+	}
+	if dbmsg, err := s.db.GetMessage(messageid); err == nil {
+		if byte_data, err := newServerResponse("message", fromDBMessageToSeverMessage(dbmsg)); err == nil {
+			s.broadcastToChannel(dbmsg.ServerId, dbmsg.ChannelId, byte_data)
+		}
+		s.publishEvent(dbmsg.ServerId, eventMessageCreated, fromDBMessageToSeverMessage(dbmsg))
+	}
+	writeJSON(w, map[string]any{"messageid": messageid, "attachments": infos})
+}
+
+// getAttachmentFromRequest resolves {attachmentid} and checks the caller can
+// read the channel it was posted in. Attachments of other channels are
+// reported as missing so their existence is not revealed.
+func (s *Server) getAttachmentFromRequest(r *http.Request) (database.Attachment, httpErrorInfo, error) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		return database.Attachment{}, httpErrorInfo{http.StatusInternalServerError, err.Error()}, err
+	}
+	attachmentid, err := parsePathFromID(r, "attachmentid")
+	if err != nil {
+		return database.Attachment{}, httpErrorInfo{
+			http.StatusBadRequest,
+			"invalid request: unable to parse attachment id",
+		}, err
+	}
+	attachment, err := s.db.GetAttachment(attachmentid)
+	if errors.Is(err, database.ErrRecordNotFound) {
+		return database.Attachment{}, httpErrorInfo{
+			http.StatusNotFound,
+			"error: unable to locate attachment",
+		}, err
+	}
+	if err != nil {
+		return database.Attachment{}, httpErrorInfo{http.StatusInternalServerError, "database error"}, err
+	}
+	inchannel, err := s.db.IsUserInChannel(userid, attachment.ChannelId)
+	if err != nil {
+		return database.Attachment{}, httpErrorInfo{http.StatusInternalServerError, "database error"}, err
+	}
+	if !inchannel {
+		err = errors.New("error: unable to locate attachment")
+		return database.Attachment{}, httpErrorInfo{http.StatusNotFound, err.Error()}, err
+	}
+	return attachment, httpErrorInfo{}, nil
+}
+
+func (s *Server) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	attachment, errInfo, err := s.getAttachmentFromRequest(r)
+	if err != nil {
+		http.Error(w, errInfo.Message, errInfo.StatusCode)
+		return
+	}
+	blob, err := s.blobs.Get(r.Context(), attachment.StorageKey)
+	if errors.Is(err, storage.ErrBlobNotFound) {
+		http.Error(w, "error: unable to locate attachment", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "error: unable to read attachment", http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	disposition := "attachment"
+	if strings.HasPrefix(attachment.ContentType, "image/") {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set(
+		"Content-Disposition",
+		mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName}),
+	)
+	if _, err := io.Copy(w, blob); err != nil {
+		log.Printf("DownloadAttachment: failed to write response: %v", err)
+	}
+}
+
+// DownloadThumbnail serves a generated thumbnail. Thumbnail keys never change
+// once written so responses may be cached indefinitely.
+func (s *Server) DownloadThumbnail(w http.ResponseWriter, r *http.Request) {
+	attachment, errInfo, err := s.getAttachmentFromRequest(r)
+	if err != nil {
+		http.Error(w, errInfo.Message, errInfo.StatusCode)
+		return
+	}
+	size, err := strconv.Atoi(r.PathValue("size"))
+	if err != nil {
+		http.Error(w, "invalid request: unable to parse size", http.StatusBadRequest)
+		return
+	}
+	var thumbnail *database.AttachmentThumbnail
+	for i := range attachment.Thumbnails {
+		if attachment.Thumbnails[i].Size == size {
+			thumbnail = &attachment.Thumbnails[i]
+		}
+	}
+	if thumbnail == nil {
+		http.Error(w, "error: unable to locate thumbnail", http.StatusNotFound)
+		return
+	}
+
+	etag := fmt.Sprintf("\"%d-%d\"", attachment.AttachmentId, thumbnail.Size)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	blob, err := s.blobs.Get(r.Context(), thumbnail.StorageKey)
+	if errors.Is(err, storage.ErrBlobNotFound) {
+		http.Error(w, "error: unable to locate thumbnail", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "error: unable to read thumbnail", http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+	w.Header().Set("Content-Type", thumbnail.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, blob); err != nil {
+		log.Printf("DownloadThumbnail: failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+var pngHeader = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0, 0, 0, 0}
+
+func (s *TestServer) uploadFiles(
+	channelid int,
+	message string,
+	files map[string][]byte,
+	username string,
+	password string,
+) (*http.Response, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, data := range files {
+		part, err := writer.CreateFormFile("file", name)
+		if err != nil {
+			return nil, err
+		}
+		part.Write(data)
+	}
+	writer.WriteField("message", message)
+	writer.Close()
+	req, err := http.NewRequest(
+		http.MethodPost,
+		fmt.Sprintf("%s/api/channels/%d/attachments", s.server.URL, channelid),
+		&body,
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	cookie, err := s.getLoginCookie(username, password)
+	if err != nil {
+		return nil, err
+	}
+	req.AddCookie(cookie)
+	return s.server.Client().Do(req)
+}
+
+func TestUploadAttachment_Valid(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	data := append(append([]byte{}, pngHeader...), []byte("image data")...)
+	resp, err := s.uploadFiles(1, "look", map[string][]byte{"../../pic.txt": data}, "u1", "1")
+	if err != nil {
+		t.Fatalf("error uploading. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status OK; got %v", resp.Status)
+	}
+	result := struct {
+		MessageId   uint             `json:"messageid"`
+		Attachments []AttachmentInfo `json:"attachments"`
+	}{}
+	body, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Fatalf("error unmarshalling response body. Err: %v", err)
+	}
+	if len(result.Attachments) != 1 {
+		t.Fatalf("expected one attachment; got %d", len(result.Attachments))
+	}
+	attachment := result.Attachments[0]
+	if attachment.ContentType != "image/png" {
+		t.Errorf("expected sniffed content type image/png; got %s", attachment.ContentType)
+	}
+	if attachment.FileName != "pic.txt" {
+		t.Errorf("expected sanitized file name; got %s", attachment.FileName)
+	}
+
+	getresp, err := s.sendAuthRequest(
+		http.MethodGet,
+		fmt.Sprintf("/api/channels/1/messages/%d", result.MessageId),
+		nil,
+		nil,
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("error getting message. Err: %v", err)
+	}
+	message := ServerMessage{}
+	body, _ = io.ReadAll(getresp.Body)
+	if err := json.Unmarshal(body, &message); err != nil {
+		t.Fatalf("error unmarshalling response body. Err: %v", err)
+	}
+	if message.Message != "look" || len(message.Attachments) != 1 {
+		t.Fatalf("expected message with attachment; got %+v", message)
+	}
+
+	download, err := s.sendAuthRequest(http.MethodGet, attachment.URL, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error downloading. Err: %v", err)
+	}
+	if download.StatusCode != http.StatusOK {
+		t.Fatalf("expected status OK; got %v", download.Status)
+	}
+	downloaded, _ := io.ReadAll(download.Body)
+	if !bytes.Equal(downloaded, data) {
+		t.Fatalf("downloaded data does not match upload")
+	}
+	if download.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("expected content type image/png; got %s", download.Header.Get("Content-Type"))
+	}
+}
+
+func TestDownloadAttachment_NotInChannel(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	resp, err := s.uploadFiles(1, "", map[string][]byte{"a.txt": []byte("secret")}, "u1", "1")
+	if err != nil {
+		t.Fatalf("error uploading. Err: %v", err)
+	}
+	result := struct {
+		Attachments []AttachmentInfo `json:"attachments"`
+	}{}
+	body, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Fatalf("error unmarshalling response body. Err: %v", err)
+	}
+	username := "u3"
+	password := "3"
+	download, err := s.sendAuthRequest(
+		http.MethodGet,
+		result.Attachments[0].URL,
+		nil,
+		&username,
+		&password,
+	)
+	if err != nil {
+		t.Fatalf("error downloading. Err: %v", err)
+	}
+	if download.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status NotFound; got %v", download.Status)
+	}
+}
+
+func TestUploadAttachment_QuotaExceeded(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	err := s.db.UpdateServerUploadQuota(1, 10)
+	if err != nil {
+		t.Fatalf("error updating quota. Err: %v", err)
+	}
+	resp, err := s.uploadFiles(
+		1,
+		"",
+		map[string][]byte{"big.txt": []byte("more than ten bytes")},
+		"u1",
+		"1",
+	)
+	if err != nil {
+		t.Fatalf("error uploading. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status RequestEntityTooLarge; got %v", resp.Status)
+	}
+}
+
+func TestUploadAttachment_NotInChannel(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	resp, err := s.uploadFiles(1, "", map[string][]byte{"a.txt": []byte("x")}, "u3", "3")
+	if err != nil {
+		t.Fatalf("error uploading. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status BadRequest; got %v", resp.Status)
+	}
+}
+
+func TestUploadAttachment_ImageThumbnails(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	img := image.NewNRGBA(image.Rect(0, 0, 600, 300))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i)
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		t.Fatalf("error encoding image. Err: %v", err)
+	}
+	resp, err := s.uploadFiles(1, "", map[string][]byte{"pic.png": encoded.Bytes()}, "u1", "1")
+	if err != nil {
+		t.Fatalf("error uploading. Err: %v", err)
+	}
+	result := struct {
+		MessageId uint `json:"messageid"`
+	}{}
+	body, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Fatalf("error unmarshalling response body. Err: %v", err)
+	}
+
+	// thumbnails are generated in the background
+	var attachment AttachmentInfo
+	deadline := time.Now().Add(5 * time.Second)
+	for len(attachment.Thumbnails) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for thumbnails")
+		}
+		time.Sleep(20 * time.Millisecond)
+		getresp, err := s.sendAuthRequest(
+			http.MethodGet,
+			fmt.Sprintf("/api/channels/1/messages/%d", result.MessageId),
+			nil,
+			nil,
+			nil,
+		)
+		if err != nil {
+			t.Fatalf("error getting message. Err: %v", err)
+		}
+		message := ServerMessage{}
+		body, _ = io.ReadAll(getresp.Body)
+		if err := json.Unmarshal(body, &message); err != nil {
+			t.Fatalf("error unmarshalling response body. Err: %v", err)
+		}
+		attachment = message.Attachments[0]
+	}
+	if attachment.Width == nil || *attachment.Width != 600 || *attachment.Height != 300 {
+		t.Fatalf("expected image dimensions; got %+v", attachment)
+	}
+	if attachment.BlurHash == nil || len(*attachment.BlurHash) == 0 {
+		t.Fatalf("expected blurhash; got %+v", attachment)
+	}
+	if len(attachment.Thumbnails) != len(thumbnailSizes) {
+		t.Fatalf("expected %d thumbnails; got %d", len(thumbnailSizes), len(attachment.Thumbnails))
+	}
+	thumbnail := attachment.Thumbnails[0]
+	if thumbnail.Width != 64 || thumbnail.Height != 32 {
+		t.Fatalf("unexpected thumbnail size %+v", thumbnail)
+	}
+
+	download, err := s.sendAuthRequest(http.MethodGet, thumbnail.URL, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error downloading thumbnail. Err: %v", err)
+	}
+	if download.StatusCode != http.StatusOK {
+		t.Fatalf("expected status OK; got %v", download.Status)
+	}
+	if !strings.Contains(download.Header.Get("Cache-Control"), "immutable") {
+		t.Errorf("expected immutable cache header; got %s", download.Header.Get("Cache-Control"))
+	}
+	decoded, err := png.Decode(download.Body)
+	if err != nil || decoded.Bounds().Dx() != 64 {
+		t.Fatalf("thumbnail does not decode. Err: %v", err)
+	}
+
+	username := "u3"
+	password := "3"
+	denied, err := s.sendAuthRequest(http.MethodGet, thumbnail.URL, nil, &username, &password)
+	if err != nil {
+		t.Fatalf("error downloading thumbnail. Err: %v", err)
+	}
+	if denied.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status NotFound; got %v", denied.Status)
+	}
+}
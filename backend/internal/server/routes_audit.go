@@ -0,0 +1,161 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"go-chat-react/internal/database"
+)
+
+const (
+	auditLogPerPage      = 50
+	maxAuditReasonLength = 512
+	// auditReasonHeader carries the reason for a change, as there is no
+	// room for it in the bodies of the requests making them
+	auditReasonHeader = "X-Audit-Log-Reason"
+)
+
+// actions recorded in the audit log
+const (
+	auditServerUpdate   = "server_update"
+	auditChannelCreate  = "channel_create"
+	auditChannelUpdate  = "channel_update"
+	auditChannelDelete  = "channel_delete"
+	auditMemberAdd      = "channel_member_add"
+	auditMemberRemove   = "channel_member_remove"
+	auditNicknameUpdate = "member_nickname_update"
+	auditMessageDelete  = "message_delete"
+	auditWebhookCreate  = "webhook_create"
+	auditWebhookDelete  = "webhook_delete"
+	auditEndpointCreate = "outgoing_webhook_create"
+	auditEndpointUpdate = "outgoing_webhook_update"
+	auditEndpointDelete = "outgoing_webhook_delete"
+	auditMemberTimeout  = "member_timeout"
+	auditMemberMute     = "member_mute"
+	auditRestrictLift   = "member_restriction_lift"
+)
+
+// auditActions lists every action the audit log records, for filtering.
+var auditActions = []string{
+	auditServerUpdate,
+	auditChannelCreate,
+	auditChannelUpdate,
+	auditChannelDelete,
+	auditMemberAdd,
+	auditMemberRemove,
+	auditNicknameUpdate,
+	auditMessageDelete,
+	auditWebhookCreate,
+	auditWebhookDelete,
+	auditEndpointCreate,
+	auditEndpointUpdate,
+	auditEndpointDelete,
+	auditMemberTimeout,
+	auditMemberMute,
+	auditRestrictLift,
+}
+
+type AuditEntryInfo struct {
+	EntryID    database.Id    `json:"entryid"`
+	ServerID   database.Id    `json:"serverid"`
+	ActorID    database.Id    `json:"actorid"`
+	Action     string         `json:"action"`
+	TargetType string         `json:"target_type"`
+	TargetID   database.Id    `json:"targetid"`
+	Before     map[string]any `json:"before"`
+	After      map[string]any `json:"after"`
+	Reason     string         `json:"reason,omitempty"`
+	Created    time.Time      `json:"created"`
+}
+
+func fromDBAuditEntry(entry database.AuditEntry) AuditEntryInfo {
+	return AuditEntryInfo{
+		EntryID:    entry.EntryId,
+		ServerID:   entry.ServerId,
+		ActorID:    entry.ActorId,
+		Action:     entry.Action,
+		TargetType: entry.TargetType,
+		TargetID:   entry.TargetId,
+		Before:     entry.Before,
+		After:      entry.After,
+		Reason:     entry.Reason,
+		Created:    entry.Created,
+	}
+}
+
+// auditReason reads the optional reason for a change from its header.
+// Clients may percent-encode it to send text outside of ASCII.
+func auditReason(r *http.Request) string {
+	reason := r.Header.Get(auditReasonHeader)
+	if decoded, err := url.PathUnescape(reason); err == nil {
+		reason = decoded
+	}
+	reason = strings.TrimSpace(reason)
+	if len(reason) > maxAuditReasonLength {
+		reason = strings.ToValidUTF8(reason[:maxAuditReasonLength], "")
+	}
+	return reason
+}
+
+// recordAudit adds an entry to the audit log of a server on behalf of the
+// caller, with the reason from the request over the one of the entry. The
+// change has already been made, so a failure is only logged.
+func (s *Server) recordAudit(r *http.Request, entry database.AuditEntry) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		log.Printf("recordAudit: %v", err)
+		return
+	}
+	entry.ActorId = userid
+	if reason := auditReason(r); reason != "" {
+		entry.Reason = reason
+	}
+	if _, err := s.db.AddAuditEntry(entry); err != nil {
+		log.Printf("recordAudit: unable to record %s on server %d: %v", entry.Action, entry.ServerId, err)
+	}
+}
+
+// GetAuditLog returns the administrative changes made to a server, newest
+// first. It can be filtered by actorid and action, and paged back with
+// before.
+func (s *Server) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	server, errorInfo, err := s.getManagedServer(r)
+	if err != nil {
+		http.Error(w, errorInfo.Message, errorInfo.StatusCode)
+		return
+	}
+	count, err := parseCountFromQuery(r, auditLogPerPage)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var filter database.AuditLogFilter
+	if filter.ActorId, err = parseIDFromQuery(r, "actorid"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.Before, err = parseIDFromQuery(r, "before"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.Action = r.URL.Query().Get("action")
+	if filter.Action != "" && !slices.Contains(auditActions, filter.Action) {
+		http.Error(w, fmt.Sprintf("error: unknown action %q", filter.Action), http.StatusBadRequest)
+		return
+	}
+	entries, err := s.db.GetAuditLog(server.ServerId, filter, min(count, auditLogPerPage))
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	infos := make([]AuditEntryInfo, 0, len(entries))
+	for _, entry := range entries {
+		infos = append(infos, fromDBAuditEntry(entry))
+	}
+	writeJSON(w, map[string]any{"entries": infos, "actions": auditActions})
+}
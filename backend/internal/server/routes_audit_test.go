@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func (s *TestServer) auditLog(t *testing.T, query string) []AuditEntryInfo {
+	resp := s.expectStatus(t, http.MethodGet, "/api/servers/1/audit-log"+query, nil, "u1", "1", http.StatusOK)
+	result := struct {
+		Entries []AuditEntryInfo `json:"entries"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("error decoding audit log. Err: %v", err)
+	}
+	return result.Entries
+}
+
+func auditActionsOf(entries []AuditEntryInfo) []string {
+	var actions []string
+	for _, entry := range entries {
+		actions = append(actions, entry.Action)
+	}
+	return actions
+}
+
+func TestAuditLog_RecordsChanges(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+
+	req, err := s.buildRequest(http.MethodPatch, "/api/servers/1", map[string]string{"servername": "renamed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(auditReasonHeader, "tidy%20up")
+	cookie, err := s.getLoginCookie("u1", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.AddCookie(cookie)
+	resp, err := s.server.Client().Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("PATCH /api/servers/1: expected status 200; got %v err: %v", resp, err)
+	}
+	s.expectStatus(t, http.MethodPatch, "/api/channels/1", map[string]any{"channelname": "lobby"}, "u1", "1", http.StatusOK)
+	s.expectStatus(t, http.MethodDelete, "/api/channels/1/members", map[string]any{"userid": "2"}, "u1", "1", http.StatusOK)
+	// the owner removes a message of u3, then one of their own
+	s.expectStatus(t, http.MethodDelete, "/api/channels/2/messages/4", nil, "u1", "1", http.StatusOK)
+	s.expectStatus(t, http.MethodDelete, "/api/channels/1/messages/5", nil, "u1", "1", http.StatusOK)
+
+	entries := s.auditLog(t, "")
+	want := []string{auditMessageDelete, auditMemberRemove, auditChannelUpdate, auditServerUpdate}
+	if actions := auditActionsOf(entries); !slices.Equal(actions, want) {
+		t.Fatalf("expected actions %v; got %v", want, actions)
+	}
+	rename := entries[3]
+	if rename.ActorID != 1 || rename.Reason != "tidy up" || rename.Before["servername"] != "server1" || rename.After["servername"] != "renamed" {
+		t.Errorf("unexpected server update entry %+v", rename)
+	}
+	if update := entries[2]; update.TargetID != 1 || update.After["channelname"] != "lobby" || update.Before["channelname"] == nil {
+		t.Errorf("unexpected channel update entry %+v", update)
+	}
+	if removal := entries[1]; removal.TargetID != 2 || removal.Before["channelid"] != float64(1) {
+		t.Errorf("unexpected member removal entry %+v", removal)
+	}
+	if deletion := entries[0]; deletion.TargetID != 4 || deletion.Before["userid"] != float64(3) {
+		t.Errorf("unexpected message deletion entry %+v", deletion)
+	}
+
+	if actions := auditActionsOf(s.auditLog(t, "?action=channel_update")); !slices.Equal(actions, []string{auditChannelUpdate}) {
+		t.Errorf("expected the channel update only; got %v", actions)
+	}
+	if entries := s.auditLog(t, "?actorid=2"); len(entries) != 0 {
+		t.Errorf("expected no entries by u2; got %+v", entries)
+	}
+	page := s.auditLog(t, "?count=3")
+	rest := s.auditLog(t, fmt.Sprintf("?count=3&before=%d", page[2].EntryID))
+	if len(page) != 3 || !slices.Equal(auditActionsOf(rest), []string{auditServerUpdate}) {
+		t.Errorf("expected pages of 3 and 1; got %v and %v", auditActionsOf(page), auditActionsOf(rest))
+	}
+}
+
+func TestAuditLog_OwnerOnly(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	s.expectStatus(t, http.MethodGet, "/api/servers/1/audit-log", nil, "u3", "3", http.StatusForbidden)
+	s.expectStatus(t, http.MethodGet, "/api/servers/1/audit-log?action=nope", nil, "u1", "1", http.StatusBadRequest)
+	// members still cannot delete the messages of others
+	s.expectStatus(t, http.MethodDelete, "/api/channels/1/messages/1", nil, "u2", "2", http.StatusBadRequest)
+	if entries := s.auditLog(t, ""); len(entries) != 0 {
+		t.Errorf("expected an empty audit log; got %+v", entries)
+	}
+}
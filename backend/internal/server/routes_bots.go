@@ -0,0 +1,270 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-chat-react/internal/database"
+)
+
+const (
+	maxAPITokenNameLength = 64
+	maxAPITokensPerUser   = 25
+	// maxAPITokenLifetime bounds expires_in, in seconds; tokens that should
+	// outlive it are created without an expiry
+	maxAPITokenLifetime = 365 * 24 * 60 * 60
+)
+
+type APITokenInfo struct {
+	TokenId  database.Id `json:"tokenid"`
+	Name     string      `json:"name"`
+	Scopes   []string    `json:"scopes"`
+	Created  time.Time   `json:"created"`
+	LastUsed *time.Time  `json:"last_used,omitempty"`
+	Expires  *time.Time  `json:"expires,omitempty"`
+}
+
+func fromDBAPIToken(token database.APIToken) APITokenInfo {
+	return APITokenInfo{
+		TokenId:  token.TokenId,
+		Name:     token.Name,
+		Scopes:   token.Scopes,
+		Created:  token.Created,
+		LastUsed: token.LastUsed,
+		Expires:  token.Expires,
+	}
+}
+
+// getOwnedBot loads the bot in the userid path value and checks that the
+// caller manages it.
+func (s *Server) getOwnedBot(r *http.Request) (database.User, httpErrorInfo, error) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		return database.User{}, httpErrorInfo{http.StatusInternalServerError, err.Error()}, err
+	}
+	botid, err := parsePathFromID(r, "userid")
+	if err != nil {
+		return database.User{}, httpErrorInfo{http.StatusBadRequest, err.Error()}, err
+	}
+	bot, err := s.db.GetUser(botid)
+	if errors.Is(err, database.ErrRecordNotFound) || (err == nil && (!bot.IsBot || bot.BotOwnerId != userid)) {
+		return database.User{}, httpErrorInfo{http.StatusNotFound, "error: bot not found"}, errors.New("bot not found")
+	}
+	if err != nil {
+		return database.User{}, httpErrorInfo{http.StatusInternalServerError, "database error"}, err
+	}
+	return bot, httpErrorInfo{}, nil
+}
+
+func (s *Server) GetBots(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	bots, err := s.db.GetBotsOfUser(userid)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	profiles := make([]UserProfile, 0, len(bots))
+	for _, bot := range bots {
+		profiles = append(profiles, fromDBUserToProfile(bot))
+	}
+	writeJSON(w, map[string]any{"bots": profiles})
+}
+
+// CreateBot adds a bot account owned by the caller. Bots cannot log in and
+// act through the API tokens their owner issues for them.
+func (s *Server) CreateBot(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	request := struct {
+		Username string `json:"username"`
+	}{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	username := strings.TrimSpace(request.Username)
+	if username == "" {
+		http.Error(w, "error: username is required", http.StatusBadRequest)
+		return
+	}
+	botid, err := s.db.CreateBotUser(userid, username)
+	if errors.Is(err, database.ErrRecordAlreadyExists) {
+		http.Error(w, "error: username already in use", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "error: unable to create bot", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"userid": botid})
+}
+
+// DeleteBot removes a bot right away. Its messages are kept under the
+// deleted user tombstone.
+func (s *Server) DeleteBot(w http.ResponseWriter, r *http.Request) {
+	bot, errorInfo, err := s.getOwnedBot(r)
+	if err != nil {
+		http.Error(w, errorInfo.Message, errorInfo.StatusCode)
+		return
+	}
+	err = s.purgeAccount(r.Context(), database.AccountDeletion{UserId: bot.UserId})
+	if err != nil {
+		http.Error(w, "error: unable to delete bot", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"userid": bot.UserId})
+}
+
+func (s *Server) GetAPITokens(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeAPITokens(w, userid)
+}
+
+func (s *Server) CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.issueAPIToken(w, r, userid)
+}
+
+func (s *Server) DeleteAPIToken(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.revokeAPIToken(w, r, userid)
+}
+
+func (s *Server) GetBotAPITokens(w http.ResponseWriter, r *http.Request) {
+	bot, errorInfo, err := s.getOwnedBot(r)
+	if err != nil {
+		http.Error(w, errorInfo.Message, errorInfo.StatusCode)
+		return
+	}
+	s.writeAPITokens(w, bot.UserId)
+}
+
+func (s *Server) CreateBotAPIToken(w http.ResponseWriter, r *http.Request) {
+	bot, errorInfo, err := s.getOwnedBot(r)
+	if err != nil {
+		http.Error(w, errorInfo.Message, errorInfo.StatusCode)
+		return
+	}
+	s.issueAPIToken(w, r, bot.UserId)
+}
+
+func (s *Server) DeleteBotAPIToken(w http.ResponseWriter, r *http.Request) {
+	bot, errorInfo, err := s.getOwnedBot(r)
+	if err != nil {
+		http.Error(w, errorInfo.Message, errorInfo.StatusCode)
+		return
+	}
+	s.revokeAPIToken(w, r, bot.UserId)
+}
+
+func (s *Server) writeAPITokens(w http.ResponseWriter, userid database.Id) {
+	tokens, err := s.db.GetAPITokensOfUser(userid)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	infos := make([]APITokenInfo, 0, len(tokens))
+	for _, token := range tokens {
+		infos = append(infos, fromDBAPIToken(token))
+	}
+	writeJSON(w, map[string]any{"tokens": infos, "scopes": apiScopes})
+}
+
+// issueAPIToken creates a token for userid. The secret is only returned
+// here, the server keeps nothing but its hash.
+func (s *Server) issueAPIToken(w http.ResponseWriter, r *http.Request, userid database.Id) {
+	request := struct {
+		Name      string   `json:"name"`
+		Scopes    []string `json:"scopes"`
+		ExpiresIn int64    `json:"expires_in"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(request.Name)
+	if name == "" || len(name) > maxAPITokenNameLength {
+		http.Error(w, fmt.Sprintf("error: name must be 1 to %d characters", maxAPITokenNameLength), http.StatusBadRequest)
+		return
+	}
+	if len(request.Scopes) == 0 {
+		http.Error(w, "error: at least one scope is required", http.StatusBadRequest)
+		return
+	}
+	if err := validateScopes(request.Scopes); err != nil {
+		http.Error(w, "error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.ExpiresIn < 0 || request.ExpiresIn > maxAPITokenLifetime {
+		http.Error(w, fmt.Sprintf("error: expires_in must be between 0 and %d seconds", maxAPITokenLifetime), http.StatusBadRequest)
+		return
+	}
+	tokens, err := s.db.GetAPITokensOfUser(userid)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if len(tokens) >= maxAPITokensPerUser {
+		http.Error(w, "error: too many tokens", http.StatusConflict)
+		return
+	}
+
+	token := database.APIToken{UserId: userid, Name: name, Scopes: request.Scopes}
+	if request.ExpiresIn > 0 {
+		expires := time.Now().Add(time.Duration(request.ExpiresIn) * time.Second)
+		token.Expires = &expires
+	}
+	secret, hash := newAPIToken()
+	token.TokenId, err = s.db.CreateAPIToken(token, hash)
+	if err != nil {
+		log.Printf("issueAPIToken: unable to create token for %d: %v", userid, err)
+		http.Error(w, "error: unable to create token", http.StatusInternalServerError)
+		return
+	}
+	token.Created = time.Now()
+	writeJSON(w, map[string]any{"token": secret, "info": fromDBAPIToken(token)})
+}
+
+func (s *Server) revokeAPIToken(w http.ResponseWriter, r *http.Request, userid database.Id) {
+	tokenid, err := parsePathFromID(r, "tokenid")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = s.db.DeleteAPIToken(tokenid, userid)
+	if errors.Is(err, database.ErrRecordNotFound) {
+		http.Error(w, "error: token not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"tokenid": tokenid})
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go-chat-react/internal/database"
+)
+
+func (s *TestServer) createAPIToken(t *testing.T, path string, scopes []string) (string, APITokenInfo) {
+	resp := s.expectStatus(t, http.MethodPost, path,
+		map[string]any{"name": "script", "scopes": scopes}, "u1", "1", http.StatusOK)
+	created := struct {
+		Token string       `json:"token"`
+		Info  APITokenInfo `json:"info"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("error decoding token. Err: %v", err)
+	}
+	if !strings.HasPrefix(created.Token, apiTokenPrefix) {
+		t.Fatalf("unexpected token %q", created.Token)
+	}
+	return created.Token, created.Info
+}
+
+func (s *TestServer) expectBearerStatus(t *testing.T, method string, path string, payload any, token string, status int) *http.Response {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			t.Fatalf("failed to marshal payload: %v", err)
+		}
+		body = strings.NewReader(string(data))
+	}
+	req, err := http.NewRequest(method, s.server.URL+path, body)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := s.server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: err: %v", method, path, err)
+	}
+	if resp.StatusCode != status {
+		data, _ := io.ReadAll(resp.Body)
+		t.Fatalf("%s %s: expected status %d; got %v: %s", method, path, status, resp.Status, data)
+	}
+	return resp
+}
+
+func TestAPIToken_ExpiresIn(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	path := "/api/users/me/tokens"
+	for _, expiresIn := range []int64{-1, maxAPITokenLifetime + 1, 1 << 62} {
+		s.expectStatus(t, http.MethodPost, path,
+			map[string]any{"name": "script", "scopes": []string{scopeMessagesRead}, "expires_in": expiresIn}, "u1", "1", http.StatusBadRequest)
+	}
+	resp := s.expectStatus(t, http.MethodPost, path,
+		map[string]any{"name": "script", "scopes": []string{scopeMessagesRead}, "expires_in": maxAPITokenLifetime}, "u1", "1", http.StatusOK)
+	created := struct {
+		Info APITokenInfo `json:"info"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("error decoding token. Err: %v", err)
+	}
+	want := time.Now().Add(maxAPITokenLifetime * time.Second)
+	if created.Info.Expires == nil || created.Info.Expires.Sub(want).Abs() > time.Minute {
+		t.Fatalf("expected the token to expire in a year; got %v", created.Info.Expires)
+	}
+}
+
+func TestAPIToken_Scopes(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	token, _ := s.createAPIToken(t, "/api/users/me/tokens", []string{scopeMessagesRead})
+
+	s.expectBearerStatus(t, http.MethodGet, "/api/channels/1/messages", nil, token, http.StatusOK)
+	s.expectBearerStatus(t, http.MethodPost, "/api/channels/1/messages",
+		map[string]any{"message": "hi"}, token, http.StatusForbidden)
+	s.expectBearerStatus(t, http.MethodGet, "/api/servers/1/channels", nil, token, http.StatusForbidden)
+	// account management never accepts api tokens
+	s.expectBearerStatus(t, http.MethodGet, "/api/users/me/tokens", nil, token, http.StatusForbidden)
+	s.expectBearerStatus(t, http.MethodGet, "/api/users/me/email", nil, token, http.StatusForbidden)
+	s.expectBearerStatus(t, http.MethodGet, "/api/channels/1/messages", nil, token+"x", http.StatusUnauthorized)
+
+	s.expectStatus(t, http.MethodPost, "/api/users/me/tokens",
+		map[string]any{"name": "bad", "scopes": []string{"admin"}}, "u1", "1", http.StatusBadRequest)
+	s.expectStatus(t, http.MethodPost, "/api/users/me/tokens",
+		map[string]any{"name": "none", "scopes": []string{}}, "u1", "1", http.StatusBadRequest)
+}
+
+func TestAPIToken_Revoke(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	token, info := s.createAPIToken(t, "/api/users/me/tokens", []string{scopeMessagesRead, scopeMessagesWrite})
+	s.expectBearerStatus(t, http.MethodPost, "/api/channels/1/messages",
+		map[string]any{"message": "from a script"}, token, http.StatusOK)
+
+	resp := s.expectStatus(t, http.MethodGet, "/api/users/me/tokens", nil, "u1", "1", http.StatusOK)
+	listed := struct {
+		Tokens []APITokenInfo `json:"tokens"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&listed); err != nil {
+		t.Fatalf("error decoding tokens. Err: %v", err)
+	}
+	if len(listed.Tokens) != 1 || listed.Tokens[0].TokenId != info.TokenId || listed.Tokens[0].LastUsed == nil {
+		t.Fatalf("unexpected tokens %+v", listed.Tokens)
+	}
+
+	path := fmt.Sprintf("/api/users/me/tokens/%d", info.TokenId)
+	s.expectStatus(t, http.MethodDelete, path, nil, "u2", "2", http.StatusNotFound)
+	s.expectStatus(t, http.MethodDelete, path, nil, "u1", "1", http.StatusOK)
+	s.expectBearerStatus(t, http.MethodGet, "/api/channels/1/messages", nil, token, http.StatusUnauthorized)
+}
+
+func TestBot_Tokens(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	resp := s.expectStatus(t, http.MethodPost, "/api/users/me/bots",
+		map[string]any{"username": "helper"}, "u1", "1", http.StatusOK)
+	created := struct {
+		UserID database.Id `json:"userid"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("error decoding bot. Err: %v", err)
+	}
+	s.expectStatus(t, http.MethodPost, "/api/users/me/bots",
+		map[string]any{"username": "u2"}, "u1", "1", http.StatusConflict)
+	if err := s.db.AddUserToServer(created.UserID, 1, "helper"); err != nil {
+		t.Fatalf("AddUserToServer: err: %v", err)
+	}
+
+	tokens := fmt.Sprintf("/api/users/me/bots/%d/tokens", created.UserID)
+	s.expectStatus(t, http.MethodGet, tokens, nil, "u2", "2", http.StatusNotFound)
+	s.expectStatus(t, http.MethodGet, "/api/users/me/bots/2/tokens", nil, "u1", "1", http.StatusNotFound)
+	token, _ := s.createAPIToken(t, tokens, []string{scopeServersRead, scopeUsersRead})
+	resp = s.expectBearerStatus(t, http.MethodPost, "/api/auth/session", nil, token, http.StatusOK)
+	session := struct {
+		UserID   database.Id `json:"userid"`
+		UserName string      `json:"username"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		t.Fatalf("error decoding session. Err: %v", err)
+	}
+	if session.UserID != created.UserID || session.UserName != "helper" {
+		t.Fatalf("expected the session of the bot got %+v", session)
+	}
+
+	resp = s.expectBearerStatus(t, http.MethodGet, "/api/servers/1/members", nil, token, http.StatusOK)
+	members := struct {
+		Users []MemberInfo `json:"users"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&members); err != nil {
+		t.Fatalf("error decoding members. Err: %v", err)
+	}
+	found := false
+	for _, member := range members.Users {
+		found = found || member.UserID == created.UserID
+	}
+	if !found {
+		t.Fatalf("expected bot among members %+v", members.Users)
+	}
+
+	s.expectStatus(t, http.MethodDelete, fmt.Sprintf("/api/users/me/bots/%d", created.UserID), nil, "u1", "1", http.StatusOK)
+	s.expectBearerStatus(t, http.MethodGet, "/api/servers/1/members", nil, token, http.StatusUnauthorized)
+	s.expectStatus(t, http.MethodGet, tokens, nil, "u1", "1", http.StatusNotFound)
+}
+
+func TestAPIToken_WebsocketScope(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	token, _ := s.createAPIToken(t, "/api/users/me/tokens", []string{scopeMessagesWrite})
+	s.expectBearerStatus(t, http.MethodGet, "/websocket", nil, token, http.StatusForbidden)
+
+	req, _ := http.NewRequest(http.MethodGet, "/websocket", nil)
+	if !hasScope(req, scopeMessagesWrite) {
+		t.Fatalf("expected browser sessions to hold every scope")
+	}
+}
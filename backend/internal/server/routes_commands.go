@@ -0,0 +1,461 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"go-chat-react/internal/database"
+)
+
+const (
+	maxBotCommands           = 50
+	maxCommandOptions        = 10
+	maxCommandChoices        = 25
+	maxCommandDescription    = 100
+	maxCommandSuggestions    = 25
+	maxCommandCallbackLength = 2048
+)
+
+var commandOptionTypes = []string{
+	database.CommandOptionString,
+	database.CommandOptionText,
+	database.CommandOptionInteger,
+	database.CommandOptionBoolean,
+	database.CommandOptionUser,
+	database.CommandOptionChannel,
+	database.CommandOptionDuration,
+}
+
+type CommandInfo struct {
+	Name        string                   `json:"name"`
+	Description string                   `json:"description"`
+	Usage       string                   `json:"usage"`
+	Options     []database.CommandOption `json:"options"`
+	BotID       database.Id              `json:"botid,omitempty"`
+}
+
+func fromSlashCommand(command slashCommand) CommandInfo {
+	options := command.Options
+	if options == nil {
+		options = []database.CommandOption{}
+	}
+	return CommandInfo{
+		Name:        command.Name,
+		Description: command.Description,
+		Usage:       commandUsage(command.Name, command.Options),
+		Options:     options,
+		BotID:       command.BotId,
+	}
+}
+
+type CommandSuggestion struct {
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+}
+
+// unescapeSlashCommand turns a leading "//" into "/" so text starting with
+// a command name can still be posted.
+func unescapeSlashCommand(contents string) string {
+	if strings.HasPrefix(contents, "//") {
+		return contents[1:]
+	}
+	return contents
+}
+
+// runCommandFromRequest runs a command posted to the messages endpoint and
+// answers with what became of it. Usage errors are reported as 400s.
+func (s *Server) runCommandFromRequest(w http.ResponseWriter, r *http.Request, userid database.Id, channelid database.Id, name string, raw string) {
+	channel, err := s.db.GetChannel(channelid)
+	if err != nil {
+		http.Error(w, "error: unable to locate channel", http.StatusBadRequest)
+		return
+	}
+	outcome, err := s.runCommand(r.Context(), userid, channel, name, raw)
+	var usageErr commandError
+	if errors.As(err, &usageErr) {
+		http.Error(w, "error: "+usageErr.message, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("runCommandFromRequest: /%s: %v", name, err)
+		http.Error(w, "error: unable to run command", http.StatusInternalServerError)
+		return
+	}
+	writeCommandOutcome(w, outcome)
+}
+
+// runCommandFromSocket starts a command sent over the websocket. Commands
+// may wait on a bot or on /giphy, so they run apart from the read loop and
+// are cancelled with ctx when the connection closes. Failures are shown to
+// the invoker as an ephemeral message.
+func (s *Server) runCommandFromSocket(ctx context.Context, userid database.Id, channelid database.Id, name string, raw string) error {
+	channel, err := s.db.GetChannel(channelid)
+	if err != nil {
+		return err
+	}
+	go func() {
+		_, err := s.runCommand(ctx, userid, channel, name, raw)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		invocation := commandInvocation{UserId: userid, Channel: channel, Name: name}
+		var usageErr commandError
+		if errors.As(err, &usageErr) {
+			s.sendEphemeral(invocation, 0, usageErr.message)
+			return
+		}
+		log.Printf("runCommandFromSocket: /%s of user %d: %v", name, userid, err)
+		s.sendEphemeral(invocation, 0, fmt.Sprintf("/%s failed, try again later", name))
+	}()
+	return nil
+}
+
+func writeCommandOutcome(w http.ResponseWriter, outcome commandOutcome) {
+	resp := map[string]any{}
+	if outcome.Message != nil {
+		resp["messageid"] = outcome.Message.MessageId
+	}
+	if outcome.Ephemeral != nil {
+		resp["ephemeral"] = outcome.Ephemeral
+	}
+	if outcome.InteractionId != "" {
+		resp["interactionid"] = outcome.InteractionId
+	}
+	writeJSON(w, resp)
+}
+
+// getCommandChannel loads the channel in the path and checks the caller is
+// a member of it.
+func (s *Server) getCommandChannel(r *http.Request) (database.Channel, httpErrorInfo, error) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		return database.Channel{}, httpErrorInfo{http.StatusInternalServerError, err.Error()}, err
+	}
+	channel, err := s.GetChannelFromRequest(r)
+	if err != nil {
+		return database.Channel{}, httpErrorInfo{http.StatusNotFound, "error: unable to locate channel"}, err
+	}
+	inchannel, err := s.db.IsUserInChannel(userid, channel.ChannelId)
+	if err != nil {
+		return database.Channel{}, httpErrorInfo{http.StatusInternalServerError, "database error"}, err
+	}
+	if !inchannel {
+		return database.Channel{}, httpErrorInfo{http.StatusForbidden, "error: user not in channel"},
+			errors.New("not in channel")
+	}
+	return channel, httpErrorInfo{}, nil
+}
+
+func (s *Server) GetChannelCommands(w http.ResponseWriter, r *http.Request) {
+	channel, errorInfo, err := s.getCommandChannel(r)
+	if err != nil {
+		http.Error(w, errorInfo.Message, errorInfo.StatusCode)
+		return
+	}
+	commands, err := s.commandsForChannel(channel)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	infos := make([]CommandInfo, 0, len(commands))
+	for _, command := range commands {
+		infos = append(infos, fromSlashCommand(command))
+	}
+	writeJSON(w, map[string]any{"commands": infos})
+}
+
+// AutocompleteCommand suggests how to continue the partial command in the
+// "text" query parameter: command names first, then values for the option
+// being typed.
+func (s *Server) AutocompleteCommand(w http.ResponseWriter, r *http.Request) {
+	channel, errorInfo, err := s.getCommandChannel(r)
+	if err != nil {
+		http.Error(w, errorInfo.Message, errorInfo.StatusCode)
+		return
+	}
+	text := r.URL.Query().Get("text")
+	if !strings.HasPrefix(text, "/") {
+		http.Error(w, "error: text must start with /", http.StatusBadRequest)
+		return
+	}
+	commands, err := s.commandsForChannel(channel)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	suggestions := []CommandSuggestion{}
+
+	end := strings.IndexAny(text, " \t\n")
+	if end < 0 {
+		prefix := strings.ToLower(text[1:])
+		for _, command := range commands {
+			if strings.HasPrefix(command.Name, prefix) && len(suggestions) < maxCommandSuggestions {
+				suggestions = append(suggestions, CommandSuggestion{Value: "/" + command.Name, Description: command.Description})
+			}
+		}
+		writeJSON(w, map[string]any{"suggestions": suggestions})
+		return
+	}
+	name := strings.ToLower(text[1:end])
+	index := slices.IndexFunc(commands, func(c slashCommand) bool { return c.Name == name })
+	if index < 0 || len(commands[index].Options) == 0 {
+		writeJSON(w, map[string]any{"suggestions": suggestions})
+		return
+	}
+	command := commands[index]
+
+	raw := text[end+1:]
+	tokens := tokenizeCommand(raw)
+	position, partial := len(tokens), ""
+	if len(tokens) > 0 && !strings.ContainsAny(raw[len(raw)-1:], " \t\n") {
+		position, partial = len(tokens)-1, tokens[len(tokens)-1].value
+	}
+	last := command.Options[len(command.Options)-1]
+	if position >= len(command.Options) && !last.Variadic && last.Type != database.CommandOptionText {
+		writeJSON(w, map[string]any{"command": fromSlashCommand(command), "suggestions": suggestions})
+		return
+	}
+	option := command.Options[min(position, len(command.Options)-1)]
+	values, err := s.commandOptionValues(channel, option)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	for _, value := range values {
+		if strings.HasPrefix(strings.ToLower(value), strings.ToLower(partial)) && len(suggestions) < maxCommandSuggestions {
+			suggestions = append(suggestions, CommandSuggestion{Value: value})
+		}
+	}
+	writeJSON(w, map[string]any{
+		"command":     fromSlashCommand(command),
+		"option":      option,
+		"suggestions": suggestions,
+	})
+}
+
+// commandOptionValues lists the values an option can take, when they are
+// known up front.
+func (s *Server) commandOptionValues(channel database.Channel, option database.CommandOption) ([]string, error) {
+	if len(option.Choices) > 0 {
+		return option.Choices, nil
+	}
+	var values []string
+	switch option.Type {
+	case database.CommandOptionBoolean:
+		values = []string{"true", "false"}
+	case database.CommandOptionUser:
+		users, err := s.db.GetUsersInChannel(channel.ChannelId)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			values = append(values, "@"+user.UserName)
+		}
+	case database.CommandOptionChannel:
+		if channel.IsDirectMessage() {
+			return nil, nil
+		}
+		channels, err := s.db.GetChannelsOfServer(channel.ServerId)
+		if err != nil {
+			return nil, err
+		}
+		for _, candidate := range channels {
+			values = append(values, "#"+candidate.ChannelName)
+		}
+	}
+	return values, nil
+}
+
+// getCallingBot loads the caller and checks it is a bot account. Webhook
+// users are bots too but have no owner and cannot register commands.
+func (s *Server) getCallingBot(r *http.Request) (database.User, httpErrorInfo, error) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		return database.User{}, httpErrorInfo{http.StatusInternalServerError, err.Error()}, err
+	}
+	user, err := s.db.GetUser(userid)
+	if err != nil {
+		return database.User{}, httpErrorInfo{http.StatusInternalServerError, "database error"}, err
+	}
+	if !user.IsBot || user.BotOwnerId == 0 {
+		return database.User{}, httpErrorInfo{http.StatusForbidden, "error: only bots have commands"},
+			errors.New("not a bot")
+	}
+	return user, httpErrorInfo{}, nil
+}
+
+func validateBotCommands(commands []database.BotCommand) error {
+	if len(commands) > maxBotCommands {
+		return fmt.Errorf("error: at most %d commands", maxBotCommands)
+	}
+	builtins := builtinCommands(true)
+	for _, command := range commands {
+		if !commandNamePattern.MatchString(command.Name) {
+			return fmt.Errorf("error: invalid command name %q", command.Name)
+		}
+		if slices.ContainsFunc(builtins, func(c slashCommand) bool { return c.Name == command.Name }) {
+			return fmt.Errorf("error: /%s is a built-in command", command.Name)
+		}
+		if len(command.Description) > maxCommandDescription || len(command.Options) > maxCommandOptions {
+			return fmt.Errorf("error: /%s has too long a description or too many options", command.Name)
+		}
+		optional := false
+		for i, option := range command.Options {
+			if !commandNamePattern.MatchString(option.Name) || !slices.Contains(commandOptionTypes, option.Type) {
+				return fmt.Errorf("error: /%s has an invalid option %q", command.Name, option.Name)
+			}
+			if (option.Variadic || option.Type == database.CommandOptionText) && i != len(command.Options)-1 {
+				return fmt.Errorf("error: only the last option of /%s can take the rest of the line", command.Name)
+			}
+			if option.Required && optional {
+				return fmt.Errorf("error: required options of /%s must come first", command.Name)
+			}
+			if len(option.Choices) > maxCommandChoices || len(option.Description) > maxCommandDescription {
+				return fmt.Errorf("error: option %s of /%s is too large", option.Name, command.Name)
+			}
+			optional = optional || !option.Required
+		}
+	}
+	return nil
+}
+
+func (s *Server) writeBotCommands(w http.ResponseWriter, botid database.Id, extra map[string]any) {
+	commands, err := s.db.GetBotCommands(botid)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	infos := make([]CommandInfo, 0, len(commands))
+	for _, command := range commands {
+		infos = append(infos, fromSlashCommand(slashCommand{
+			Name:        command.Name,
+			Description: command.Description,
+			Options:     command.Options,
+			BotId:       command.BotId,
+		}))
+	}
+	callbackURL := ""
+	callback, err := s.db.GetBotCallback(botid)
+	if err == nil {
+		callbackURL = callback.URL
+	} else if !errors.Is(err, database.ErrRecordNotFound) {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	resp := map[string]any{"commands": infos, "callback_url": callbackURL}
+	for key, value := range extra {
+		resp[key] = value
+	}
+	writeJSON(w, resp)
+}
+
+func (s *Server) GetBotCommands(w http.ResponseWriter, r *http.Request) {
+	bot, errorInfo, err := s.getCallingBot(r)
+	if err != nil {
+		http.Error(w, errorInfo.Message, errorInfo.StatusCode)
+		return
+	}
+	s.writeBotCommands(w, bot.UserId, nil)
+}
+
+// SetBotCommands replaces the commands of the calling bot. Setting a
+// callback URL returns a new secret that signs every callback request.
+func (s *Server) SetBotCommands(w http.ResponseWriter, r *http.Request) {
+	bot, errorInfo, err := s.getCallingBot(r)
+	if err != nil {
+		http.Error(w, errorInfo.Message, errorInfo.StatusCode)
+		return
+	}
+	request := struct {
+		Commands []struct {
+			Name        string                   `json:"name"`
+			Description string                   `json:"description"`
+			Options     []database.CommandOption `json:"options"`
+		} `json:"commands"`
+		CallbackURL string `json:"callback_url"`
+	}{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	commands := make([]database.BotCommand, 0, len(request.Commands))
+	for _, command := range request.Commands {
+		commands = append(commands, database.BotCommand{
+			Name:        strings.ToLower(command.Name),
+			Description: command.Description,
+			Options:     command.Options,
+		})
+	}
+	if err := validateBotCommands(commands); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.CallbackURL != "" {
+		parsed, err := url.Parse(request.CallbackURL)
+		if err != nil || parsed.Scheme != "https" || parsed.Host == "" || len(request.CallbackURL) > maxCommandCallbackLength {
+			http.Error(w, "error: callback_url must be an https address", http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = s.db.SetBotCommands(bot.UserId, commands)
+	if errors.Is(err, database.ErrRecordAlreadyExists) {
+		http.Error(w, "error: command names must be unique", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	callback := database.BotCallback{BotId: bot.UserId, URL: request.CallbackURL}
+	extra := map[string]any{}
+	if callback.URL != "" {
+		callback.Secret = rand.Text()
+		extra["callback_secret"] = callback.Secret
+	}
+	if err := s.db.SetBotCallback(callback); err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	s.writeBotCommands(w, bot.UserId, extra)
+}
+
+// RespondToInteraction lets a bot answer a command it was handed, once.
+func (s *Server) RespondToInteraction(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var response commandResponse
+	if err := json.NewDecoder(r.Body).Decode(&response); err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	if response.Content == "" || len(response.Content) > maxMessageLength {
+		http.Error(w, fmt.Sprintf("error: content must be 1 to %d bytes", maxMessageLength), http.StatusBadRequest)
+		return
+	}
+	invocation, ok := s.commands.finishInteraction(r.PathValue("interactionid"), userid, time.Now())
+	if !ok {
+		http.Error(w, "error: unknown or expired interaction", http.StatusNotFound)
+		return
+	}
+	outcome, err := s.respondToCommand(invocation, userid, response)
+	if err != nil {
+		log.Printf("RespondToInteraction: /%s: %v", invocation.Name, err)
+		http.Error(w, "error: unable to respond", http.StatusInternalServerError)
+		return
+	}
+	writeCommandOutcome(w, outcome)
+}
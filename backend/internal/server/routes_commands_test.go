@@ -0,0 +1,416 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-chat-react/internal/database"
+	"go-chat-react/internal/unfurl"
+	"go-chat-react/internal/websocket"
+)
+
+// createCommandBot creates a bot of u1 in server 1 and returns it with a
+// token that may register commands and answer interactions.
+func (s *TestServer) createCommandBot(t *testing.T) (database.Id, string) {
+	resp := s.expectStatus(t, http.MethodPost, "/api/users/me/bots",
+		map[string]any{"username": "deployer"}, "u1", "1", http.StatusOK)
+	created := struct {
+		UserID database.Id `json:"userid"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("error decoding bot. Err: %v", err)
+	}
+	if err := s.db.AddUserToServer(created.UserID, 1, "deployer"); err != nil {
+		t.Fatalf("AddUserToServer: err: %v", err)
+	}
+	token, _ := s.createAPIToken(t, fmt.Sprintf("/api/users/me/bots/%d/tokens", created.UserID),
+		[]string{scopeCommandsManage, scopeMessagesWrite})
+	return created.UserID, token
+}
+
+var deployCommand = map[string]any{
+	"name":        "deploy",
+	"description": "Ship a build",
+	"options": []map[string]any{
+		{"name": "env", "type": "string", "required": true, "choices": []string{"prod", "staging"}},
+	},
+}
+
+func (s *TestServer) setOnline(userid database.Id) {
+	s.app.sessions_mutex.Lock()
+	defer s.app.sessions_mutex.Unlock()
+	if s.app.sessions_of_user == nil {
+		s.app.sessions_of_user = make(map[database.Id]map[string]bool)
+		s.app.ws_manager = websocket.NewWebSocketManager()
+	}
+	s.app.sessions_of_user[userid] = map[string]bool{fmt.Sprintf("session-%d", userid): true}
+}
+
+func TestCommand_Builtins(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+
+	s.expectStatus(t, http.MethodPost, "/api/channels/1/messages",
+		map[string]any{"message": "/shrug oh well"}, "u1", "1", http.StatusOK)
+	if latest := s.latestMessage(t, 1); latest.Message != `oh well ¯\\\_(ツ)\_/¯` || latest.UserId != 1 {
+		t.Fatalf("expected a shrug from u1 got %+v", latest)
+	}
+
+	s.expectStatus(t, http.MethodPost, "/api/channels/1/messages",
+		map[string]any{"message": `/poll "Lunch?" pizza sushi`}, "u1", "1", http.StatusOK)
+	if latest := s.latestMessage(t, 1); !strings.Contains(latest.Message, "2️⃣ sushi") {
+		t.Fatalf("expected a poll got %q", latest.Message)
+	}
+
+	resp := s.expectStatus(t, http.MethodPost, "/api/channels/1/messages",
+		map[string]any{"message": "/help"}, "u1", "1", http.StatusOK)
+	result := struct {
+		Ephemeral EphemeralMessage `json:"ephemeral"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("error decoding response. Err: %v", err)
+	}
+	if !strings.Contains(result.Ephemeral.Message, "/remind <in> <message>") || result.Ephemeral.ChannelId != 1 {
+		t.Fatalf("expected the command list got %+v", result.Ephemeral)
+	}
+
+	s.expectStatus(t, http.MethodPost, "/api/channels/1/messages",
+		map[string]any{"message": "/nope"}, "u1", "1", http.StatusBadRequest)
+	s.expectStatus(t, http.MethodPost, "/api/channels/1/messages",
+		map[string]any{"message": "/poll only-a-question"}, "u1", "1", http.StatusBadRequest)
+	s.expectStatus(t, http.MethodPost, "/api/channels/3/messages",
+		map[string]any{"message": "/shrug"}, "u3", "3", http.StatusBadRequest)
+
+	s.expectStatus(t, http.MethodPost, "/api/channels/1/messages",
+		map[string]any{"message": "//nope is literal"}, "u1", "1", http.StatusOK)
+	if latest := s.latestMessage(t, 1); latest.Message != "/nope is literal" {
+		t.Fatalf("expected the escaped text got %q", latest.Message)
+	}
+	s.expectStatus(t, http.MethodPost, "/api/channels/1/messages",
+		map[string]any{"message": "/usr/bin is a path"}, "u1", "1", http.StatusOK)
+}
+
+func TestCommand_Remind(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	s.expectStatus(t, http.MethodPost, "/api/channels/1/messages",
+		map[string]any{"message": "/remind 40d too late"}, "u1", "1", http.StatusBadRequest)
+	s.expectStatus(t, http.MethodPost, "/api/channels/1/messages",
+		map[string]any{"message": "/remind 10m stand up"}, "u1", "1", http.StatusOK)
+
+	later := time.Now().Add(11 * time.Minute)
+	// reminders wait for their user to be online
+	if err := s.app.reminders.process(t.Context(), later); err != nil {
+		t.Fatalf("process: err: %v", err)
+	}
+	if due, _ := s.db.GetDueReminders(later); len(due) != 1 || due[0].Message != "stand up" {
+		t.Fatalf("expected the reminder to wait got %+v", due)
+	}
+	s.setOnline(1)
+	if err := s.app.reminders.process(t.Context(), later); err != nil {
+		t.Fatalf("process: err: %v", err)
+	}
+	if due, _ := s.db.GetDueReminders(later); len(due) != 0 {
+		t.Fatalf("expected the reminder delivered got %+v", due)
+	}
+}
+
+// waitForLatest waits for the newest message of a channel to read contents,
+// for commands that run in the background.
+func (s *TestServer) waitForLatest(t *testing.T, channelid int, contents string) ServerMessage {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		latest := s.latestMessage(t, channelid)
+		if latest.Message == contents {
+			return latest
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %q; latest is %q", contents, latest.Message)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestCommand_Socket(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	send := func(message string) []byte {
+		payload, _ := json.Marshal(map[string]any{
+			"message_type": "channel_message",
+			"payload":      map[string]any{"channel_id": 1, "message": message},
+		})
+		_, data, err := s.app.ProcessMessage(context.Background(), 1, websocket.IncomingMessage{Payload: payload})
+		if err != nil {
+			t.Fatalf("ProcessMessage(%q): err: %v", message, err)
+		}
+		return data
+	}
+	if data := send("/me waves"); data != nil {
+		t.Fatalf("expected commands to broadcast by themselves got %s", data)
+	}
+	s.waitForLatest(t, 1, "_waves_")
+	// usage errors go back to the sender instead of failing the socket
+	send("/nope")
+	if data := send("//me"); data == nil {
+		t.Fatalf("expected the escaped message to be broadcast")
+	}
+	if latest := s.latestMessage(t, 1); latest.Message != "/me" {
+		t.Fatalf("expected the escaped text got %q", latest.Message)
+	}
+}
+
+func TestCommand_BotCallback(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	botid, token := s.createCommandBot(t)
+
+	var interaction commandInteraction
+	var signature string
+	callback := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get(eventSignatureHeader)
+		if err := json.NewDecoder(r.Body).Decode(&interaction); err != nil {
+			t.Errorf("error decoding interaction. Err: %v", err)
+		}
+		writeJSON(w, map[string]any{"content": "deploying " + interaction.Args["env"].(string)})
+	}))
+	defer callback.Close()
+	s.app.commands.client = callback.Client()
+
+	resp := s.expectBearerStatus(t, http.MethodPut, "/api/users/me/commands", map[string]any{
+		"commands":     []any{deployCommand},
+		"callback_url": callback.URL,
+	}, token, http.StatusOK)
+	registered := struct {
+		Commands []CommandInfo `json:"commands"`
+		Secret   string        `json:"callback_secret"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&registered); err != nil {
+		t.Fatalf("error decoding commands. Err: %v", err)
+	}
+	if len(registered.Commands) != 1 || registered.Secret == "" {
+		t.Fatalf("unexpected registration %+v", registered)
+	}
+
+	s.expectStatus(t, http.MethodPost, "/api/channels/1/messages",
+		map[string]any{"message": "/deploy dev"}, "u1", "1", http.StatusBadRequest)
+	s.expectStatus(t, http.MethodPost, "/api/channels/1/messages",
+		map[string]any{"message": "/deploy prod"}, "u1", "1", http.StatusOK)
+	if latest := s.latestMessage(t, 1); latest.Message != "deploying prod" || latest.UserId != botid {
+		t.Fatalf("expected the bot response got %+v", latest)
+	}
+	if interaction.Command != "deploy" || interaction.UserId != 1 || interaction.ChannelId != 1 || !strings.HasPrefix(signature, "sha256=") {
+		t.Fatalf("unexpected interaction %+v signature %q", interaction, signature)
+	}
+	// the command is not offered where the bot is not a member
+	s.expectStatus(t, http.MethodPost, "/api/channels/3/messages",
+		map[string]any{"message": "/deploy prod"}, "u1", "1", http.StatusBadRequest)
+}
+
+func TestCommand_SocketDoesNotWaitForBots(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	botid, token := s.createCommandBot(t)
+
+	var calls atomic.Int32
+	called := make(chan struct{})
+	release := make(chan struct{})
+	abandoned := make(chan struct{})
+	callback := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the server only notices the caller leaving once the body is read
+		io.Copy(io.Discard, r.Body)
+		first := calls.Add(1) == 1
+		called <- struct{}{}
+		if first {
+			select {
+			case <-release:
+				writeJSON(w, map[string]any{"content": "deploying prod"})
+			case <-r.Context().Done():
+			}
+			return
+		}
+		<-r.Context().Done()
+		close(abandoned)
+	}))
+	defer callback.Close()
+	s.app.commands.client = callback.Client()
+	s.expectBearerStatus(t, http.MethodPut, "/api/users/me/commands", map[string]any{
+		"commands":     []any{deployCommand},
+		"callback_url": callback.URL,
+	}, token, http.StatusOK)
+
+	send := func(ctx context.Context) {
+		payload, _ := json.Marshal(map[string]any{
+			"message_type": "channel_message",
+			"payload":      map[string]any{"channel_id": 1, "message": "/deploy prod"},
+		})
+		if _, _, err := s.app.ProcessMessage(ctx, 1, websocket.IncomingMessage{Payload: payload}); err != nil {
+			t.Fatalf("ProcessMessage: err: %v", err)
+		}
+	}
+	// the read loop moves on while the bot is still thinking
+	send(context.Background())
+	<-called
+	close(release)
+	response := s.waitForLatest(t, 1, "deploying prod")
+	if response.UserId != botid {
+		t.Fatalf("expected the bot response got %+v", response)
+	}
+
+	// closing the connection gives up on the bot
+	ctx, cancel := context.WithCancel(context.Background())
+	send(ctx)
+	<-called
+	cancel()
+	select {
+	case <-abandoned:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the callback to be cancelled with the connection")
+	}
+	if latest := s.latestMessage(t, 1); latest.MessageID != response.MessageID {
+		t.Fatalf("expected no response after the connection closed got %+v", latest)
+	}
+}
+
+func TestCommand_BotCallbackRefusesInternalAddresses(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	_, token := s.createCommandBot(t)
+
+	called := false
+	callback := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		writeJSON(w, map[string]any{"content": "internal response"})
+	}))
+	defer callback.Close()
+	// the callback listens on 127.0.0.1
+	s.app.commands.client = unfurl.NewClient(time.Second, false)
+
+	s.expectBearerStatus(t, http.MethodPut, "/api/users/me/commands", map[string]any{
+		"commands":     []any{deployCommand},
+		"callback_url": callback.URL,
+	}, token, http.StatusOK)
+	resp := s.expectStatus(t, http.MethodPost, "/api/channels/1/messages",
+		map[string]any{"message": "/deploy prod"}, "u1", "1", http.StatusBadRequest)
+	body, _ := io.ReadAll(resp.Body)
+	if called || !strings.Contains(string(body), "did not respond") {
+		t.Fatalf("expected the loopback callback to be refused got %s", body)
+	}
+	if latest := s.latestMessage(t, 1); latest.Message == "internal response" {
+		t.Fatalf("expected no response to be posted got %+v", latest)
+	}
+}
+
+func TestCommand_Interaction(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	botid, token := s.createCommandBot(t)
+	s.expectBearerStatus(t, http.MethodPut, "/api/users/me/commands",
+		map[string]any{"commands": []any{deployCommand}}, token, http.StatusOK)
+
+	s.expectStatus(t, http.MethodPost, "/api/channels/1/messages",
+		map[string]any{"message": "/deploy prod"}, "u1", "1", http.StatusBadRequest)
+	s.setOnline(botid)
+	resp := s.expectStatus(t, http.MethodPost, "/api/channels/1/messages",
+		map[string]any{"message": "/deploy staging"}, "u1", "1", http.StatusOK)
+	result := struct {
+		InteractionId string `json:"interactionid"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result.InteractionId == "" {
+		t.Fatalf("expected an interaction got %+v err: %v", result, err)
+	}
+
+	path := "/api/interactions/" + result.InteractionId
+	s.expectStatus(t, http.MethodPost, path,
+		map[string]any{"content": "not yours"}, "u1", "1", http.StatusNotFound)
+	s.expectBearerStatus(t, http.MethodPost, path,
+		map[string]any{"content": "staging is up"}, token, http.StatusOK)
+	if latest := s.latestMessage(t, 1); latest.Message != "staging is up" || latest.UserId != botid {
+		t.Fatalf("expected the bot response got %+v", latest)
+	}
+	s.expectBearerStatus(t, http.MethodPost, path,
+		map[string]any{"content": "again"}, token, http.StatusNotFound)
+}
+
+func TestCommand_Register(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	_, token := s.createCommandBot(t)
+
+	s.expectStatus(t, http.MethodPut, "/api/users/me/commands",
+		map[string]any{"commands": []any{deployCommand}}, "u1", "1", http.StatusForbidden)
+	invalid := []any{
+		map[string]any{"name": "Not Valid"},
+		map[string]any{"name": "shrug"},
+		map[string]any{"name": "x", "options": []map[string]any{{"name": "a", "type": "float"}}},
+		map[string]any{"name": "x", "options": []map[string]any{{"name": "a", "type": "text"}, {"name": "b", "type": "string"}}},
+		map[string]any{"name": "x", "options": []map[string]any{{"name": "a", "type": "string"}, {"name": "b", "type": "string", "required": true}}},
+	}
+	for _, command := range invalid {
+		s.expectBearerStatus(t, http.MethodPut, "/api/users/me/commands",
+			map[string]any{"commands": []any{command}}, token, http.StatusBadRequest)
+	}
+	s.expectBearerStatus(t, http.MethodPut, "/api/users/me/commands",
+		map[string]any{"commands": []any{deployCommand, deployCommand}}, token, http.StatusBadRequest)
+	s.expectBearerStatus(t, http.MethodPut, "/api/users/me/commands",
+		map[string]any{"commands": []any{deployCommand}, "callback_url": "http://insecure.example.com"}, token, http.StatusBadRequest)
+	s.expectBearerStatus(t, http.MethodPut, "/api/users/me/commands",
+		map[string]any{"commands": []any{deployCommand}}, token, http.StatusOK)
+
+	resp := s.expectStatus(t, http.MethodGet, "/api/channels/1/commands", nil, "u1", "1", http.StatusOK)
+	listed := struct {
+		Commands []CommandInfo `json:"commands"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&listed); err != nil {
+		t.Fatalf("error decoding commands. Err: %v", err)
+	}
+	last := listed.Commands[len(listed.Commands)-1]
+	if last.Name != "deploy" || last.Usage != "/deploy <env>" || last.BotID == 0 {
+		t.Fatalf("expected the bot command last got %+v", listed.Commands)
+	}
+	s.expectStatus(t, http.MethodGet, "/api/channels/3/commands", nil, "u3", "3", http.StatusForbidden)
+}
+
+func TestCommand_Autocomplete(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	_, token := s.createCommandBot(t)
+	s.expectBearerStatus(t, http.MethodPut, "/api/users/me/commands",
+		map[string]any{"commands": []any{deployCommand}}, token, http.StatusOK)
+
+	suggest := func(text string) []string {
+		path := "/api/channels/1/commands/autocomplete?text=" + strings.ReplaceAll(text, " ", "%20")
+		resp := s.expectStatus(t, http.MethodGet, path, nil, "u1", "1", http.StatusOK)
+		result := struct {
+			Suggestions []CommandSuggestion `json:"suggestions"`
+		}{}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatalf("error decoding suggestions. Err: %v", err)
+		}
+		var values []string
+		for _, suggestion := range result.Suggestions {
+			values = append(values, suggestion.Value)
+		}
+		return values
+	}
+	if values := suggest("/s"); len(values) != 1 || values[0] != "/shrug" {
+		t.Fatalf("expected /shrug got %v", values)
+	}
+	if values := suggest("/deploy st"); len(values) != 1 || values[0] != "staging" {
+		t.Fatalf("expected staging got %v", values)
+	}
+	if values := suggest("/deploy prod "); len(values) != 0 {
+		t.Fatalf("expected nothing after the last option got %v", values)
+	}
+	if values := suggest("/poll "); len(values) != 0 {
+		t.Fatalf("expected free text to have no suggestions got %v", values)
+	}
+	s.expectStatus(t, http.MethodGet, "/api/channels/1/commands/autocomplete?text=shrug", nil, "u1", "1", http.StatusBadRequest)
+}
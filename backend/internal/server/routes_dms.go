@@ -0,0 +1,271 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"go-chat-react/internal/database"
+)
+
+const (
+	maxGroupParticipants = 10
+	maxGroupNameLength   = 100
+)
+
+type DirectMessageInfo struct {
+	ChannelId    database.Id    `json:"channelid"`
+	OwnerId      database.Id    `json:"ownerid"`
+	Name         string         `json:"name,omitempty"`
+	IsGroup      bool           `json:"is_group"`
+	Participants []User         `json:"participants"`
+	LastMessage  *ServerMessage `json:"last_message,omitempty"`
+}
+
+func fromDBDirectMessageToInfo(dm database.DirectMessage) DirectMessageInfo {
+	info := DirectMessageInfo{
+		ChannelId:    dm.ChannelId,
+		OwnerId:      dm.OwnerId,
+		Name:         dm.Name,
+		IsGroup:      dm.IsGroup,
+		Participants: make([]User, len(dm.Participants)),
+	}
+	for i, user := range dm.Participants {
+		info.Participants[i] = User{UserID: user.UserId, UserName: user.UserName}
+	}
+	if dm.LastMessage != nil {
+		last := fromDBMessageToSeverMessage(*dm.LastMessage)
+		info.LastMessage = &last
+	}
+	return info
+}
+
+func (s *Server) GetDirectMessages(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	dms, err := s.db.GetDirectMessagesOfUser(userid)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	infos := make([]DirectMessageInfo, len(dms))
+	for i, dm := range dms {
+		infos[i] = fromDBDirectMessageToInfo(dm)
+	}
+	writeJSON(w, map[string]any{"dms": infos})
+}
+
+// CreateDirectMessage opens a conversation. A single other user yields the
+// one to one DM with them, reusing an existing one; several users start a
+// new group DM owned by the caller.
+func (s *Server) CreateDirectMessage(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	request := struct {
+		UserIds []database.Id `json:"userids"`
+		Name    string        `json:"name"`
+	}{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	seen := map[database.Id]bool{userid: true}
+	var participants []database.Id
+	for _, participant := range request.UserIds {
+		if seen[participant] {
+			continue
+		}
+		seen[participant] = true
+		if _, err := s.db.GetUser(participant); err != nil {
+			http.Error(w, fmt.Sprintf("error: unable to locate user %d", participant), http.StatusBadRequest)
+			return
+		}
+		blocked, err := s.blockedBetween(userid, participant)
+		if err != nil {
+			http.Error(w, "database error", http.StatusInternalServerError)
+			return
+		}
+		if blocked {
+			http.Error(w, fmt.Sprintf("error: unable to message user %d", participant), http.StatusForbidden)
+			return
+		}
+		participants = append(participants, participant)
+	}
+	if len(participants) == 0 {
+		http.Error(w, "error: no other participants", http.StatusBadRequest)
+		return
+	}
+	if len(participants)+1 > maxGroupParticipants {
+		http.Error(w, "error: too many participants", http.StatusBadRequest)
+		return
+	}
+	if len(request.Name) > maxGroupNameLength {
+		http.Error(w, "error: name too long", http.StatusBadRequest)
+		return
+	}
+
+	var channelid database.Id
+	if len(participants) == 1 && request.Name == "" {
+		channelid, err = s.db.OpenDirectMessage(userid, participants[0])
+	} else {
+		channelid, err = s.db.CreateGroupDirectMessage(userid, participants, request.Name)
+	}
+	if err != nil {
+		http.Error(w, "error: unable to create conversation", http.StatusBadRequest)
+		return
+	}
+	s.notifyDirectMessage(channelid)
+	writeJSON(w, map[string]any{"channelid": channelid})
+}
+
+// getGroupFromRequest resolves {channelid} to a group DM the caller takes
+// part in.
+func (s *Server) getGroupFromRequest(
+	r *http.Request,
+	userid database.Id,
+) (database.DirectMessage, httpErrorInfo, error) {
+	channelid, err := parsePathFromID(r, "channelid")
+	if err != nil {
+		return database.DirectMessage{}, httpErrorInfo{http.StatusBadRequest, err.Error()}, err
+	}
+	dm, err := s.db.GetDirectMessage(channelid)
+	if errors.Is(err, database.ErrRecordNotFound) {
+		return database.DirectMessage{}, httpErrorInfo{
+			http.StatusNotFound,
+			"error: unable to locate conversation",
+		}, err
+	}
+	if err != nil {
+		return database.DirectMessage{}, httpErrorInfo{http.StatusInternalServerError, "database error"}, err
+	}
+	participant := false
+	for _, user := range dm.Participants {
+		participant = participant || user.UserId == userid
+	}
+	if !participant {
+		err = errors.New("error: unable to locate conversation")
+		return database.DirectMessage{}, httpErrorInfo{http.StatusNotFound, err.Error()}, err
+	}
+	if !dm.IsGroup {
+		err = errors.New("error: participants of a direct message cannot be changed")
+		return database.DirectMessage{}, httpErrorInfo{http.StatusBadRequest, err.Error()}, err
+	}
+	return dm, httpErrorInfo{}, nil
+}
+
+func (s *Server) AddDirectMessageParticipant(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	dm, errInfo, err := s.getGroupFromRequest(r, userid)
+	if err != nil {
+		http.Error(w, errInfo.Message, errInfo.StatusCode)
+		return
+	}
+	target, err := parsePathFromID(r, "userid")
+	if err != nil {
+		http.Error(w, "invalid request: unable to parse user id", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.db.GetUser(target); err != nil {
+		http.Error(w, "error: unable to locate user", http.StatusBadRequest)
+		return
+	}
+	blocked, err := s.blockedBetween(userid, target)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		http.Error(w, "error: unable to add user", http.StatusForbidden)
+		return
+	}
+	if len(dm.Participants) >= maxGroupParticipants {
+		http.Error(w, "error: too many participants", http.StatusBadRequest)
+		return
+	}
+	err = s.db.AddUserToChannel(target, dm.ChannelId)
+	if err != nil {
+		http.Error(w, "error: user already in conversation", http.StatusBadRequest)
+		return
+	}
+	s.notifyDirectMessage(dm.ChannelId)
+}
+
+// RemoveDirectMessageParticipant removes a user from a group DM. Anyone may
+// leave; only the owner may remove others. When the owner leaves ownership
+// passes to the remaining participant who joined first.
+func (s *Server) RemoveDirectMessageParticipant(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	dm, errInfo, err := s.getGroupFromRequest(r, userid)
+	if err != nil {
+		http.Error(w, errInfo.Message, errInfo.StatusCode)
+		return
+	}
+	target, err := parsePathFromID(r, "userid")
+	if err != nil {
+		http.Error(w, "invalid request: unable to parse user id", http.StatusBadRequest)
+		return
+	}
+	if target != userid && dm.OwnerId != userid {
+		http.Error(w, "error: only the owner can remove participants", http.StatusForbidden)
+		return
+	}
+	err = s.db.RemoveUserFromChannel(dm.ChannelId, target)
+	if errors.Is(err, database.ErrRecordNotFound) {
+		http.Error(w, "error: user not in conversation", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "error: unable to remove user", http.StatusBadRequest)
+		return
+	}
+	if target == dm.OwnerId {
+		for _, participant := range dm.Participants {
+			if participant.UserId == target {
+				continue
+			}
+			if err := s.db.UpdateDirectMessageOwner(dm.ChannelId, participant.UserId); err != nil {
+				log.Printf("RemoveDirectMessageParticipant: unable to transfer ownership: %v", err)
+			}
+			break
+		}
+	}
+	if byte_data, err := newServerResponse("dm_removed", map[string]any{"channelid": dm.ChannelId}); err == nil {
+		s.sendToUser(target, byte_data)
+	}
+	s.notifyDirectMessage(dm.ChannelId)
+}
+
+// notifyDirectMessage sends the current state of a conversation to all of
+// its participants.
+func (s *Server) notifyDirectMessage(channelid database.Id) {
+	dm, err := s.db.GetDirectMessage(channelid)
+	if err != nil {
+		log.Printf("notifyDirectMessage: unable to fetch conversation %d: %v", channelid, err)
+		return
+	}
+	byte_data, err := newServerResponse("dm_updated", fromDBDirectMessageToInfo(dm))
+	if err != nil {
+		log.Printf("notifyDirectMessage: error marshalling conversation: %v", err)
+		return
+	}
+	for _, participant := range dm.Participants {
+		s.sendToUser(participant.UserId, byte_data)
+	}
+}
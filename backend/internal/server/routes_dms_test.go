@@ -0,0 +1,200 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"go-chat-react/internal/database"
+)
+
+func (s *TestServer) createDM(
+	t *testing.T,
+	payload map[string]any,
+	username string,
+	password string,
+) database.Id {
+	resp, err := s.sendAuthJSON(http.MethodPost, "/api/users/me/dms", payload, &username, &password)
+	if err != nil {
+		t.Fatalf("error creating dm. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status OK; got %v", resp.Status)
+	}
+	result := struct {
+		ChannelId database.Id `json:"channelid"`
+	}{}
+	body, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Fatalf("error unmarshalling response body. Err: %v", err)
+	}
+	return result.ChannelId
+}
+
+func (s *TestServer) getDMs(t *testing.T, username string, password string) []DirectMessageInfo {
+	resp, err := s.sendAuthRequest(http.MethodGet, "/api/users/me/dms", nil, &username, &password)
+	if err != nil {
+		t.Fatalf("error getting dms. Err: %v", err)
+	}
+	result := struct {
+		DMs []DirectMessageInfo `json:"dms"`
+	}{}
+	body, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Fatalf("error unmarshalling response body. Err: %v", err)
+	}
+	return result.DMs
+}
+
+func TestDirectMessage_OneToOne(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	channelid := s.createDM(t, map[string]any{"userids": []int{3}}, "u1", "1")
+	if again := s.createDM(t, map[string]any{"userids": []int{1}}, "u3", "3"); again != channelid {
+		t.Fatalf("expected existing dm %d; got %d", channelid, again)
+	}
+
+	resp, err := s.sendAuthJSON(
+		http.MethodPost,
+		fmt.Sprintf("/api/channels/%d/messages", channelid),
+		map[string]any{"message": "hey"},
+		nil,
+		nil,
+	)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected message to be sent; err: %v", err)
+	}
+
+	dms := s.getDMs(t, "u3", "3")
+	if len(dms) != 1 || dms[0].ChannelId != channelid || dms[0].IsGroup {
+		t.Fatalf("unexpected dms %+v", dms)
+	}
+	if dms[0].LastMessage == nil || dms[0].LastMessage.Message != "hey" {
+		t.Fatalf("expected last message preview; got %+v", dms[0].LastMessage)
+	}
+	if len(dms[0].Participants) != 2 {
+		t.Fatalf("expected two participants; got %+v", dms[0].Participants)
+	}
+
+	// other users cannot read the conversation
+	username := "u2"
+	password := "2"
+	resp, err = s.sendAuthRequest(
+		http.MethodGet,
+		fmt.Sprintf("/api/channels/%d/messages", channelid),
+		nil,
+		&username,
+		&password,
+	)
+	if err != nil {
+		t.Fatalf("error getting messages. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status BadRequest; got %v", resp.Status)
+	}
+
+	resp, err = s.sendAuthRequest(
+		http.MethodPut,
+		fmt.Sprintf("/api/dms/%d/participants/2", channelid),
+		nil,
+		nil,
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("error adding participant. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status BadRequest; got %v", resp.Status)
+	}
+}
+
+func TestDirectMessage_Group(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	channelid := s.createDM(t, map[string]any{"userids": []int{2, 3}, "name": "plans"}, "u1", "1")
+	endpoint := func(userid int) string {
+		return fmt.Sprintf("/api/dms/%d/participants/%d", channelid, userid)
+	}
+
+	username := "u2"
+	password := "2"
+	resp, err := s.sendAuthRequest(http.MethodDelete, endpoint(3), nil, &username, &password)
+	if err != nil {
+		t.Fatalf("error removing participant. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected status Forbidden; got %v", resp.Status)
+	}
+
+	resp, err = s.sendAuthRequest(http.MethodDelete, endpoint(3), nil, nil, nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected owner to remove participant; err: %v", err)
+	}
+	resp, err = s.sendAuthRequest(http.MethodDelete, endpoint(1), nil, nil, nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected owner to leave; err: %v", err)
+	}
+
+	dms := s.getDMs(t, "u2", "2")
+	if len(dms) != 1 || dms[0].Name != "plans" || !dms[0].IsGroup {
+		t.Fatalf("unexpected dms %+v", dms)
+	}
+	if dms[0].OwnerId != 2 || len(dms[0].Participants) != 1 {
+		t.Fatalf("expected ownership to pass to u2; got %+v", dms[0])
+	}
+	if len(s.getDMs(t, "u1", "1")) != 0 {
+		t.Fatalf("expected u1 to have left the group")
+	}
+
+	resp, err = s.sendAuthRequest(http.MethodPut, endpoint(3), nil, &username, &password)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected participant to be added; err: %v", err)
+	}
+}
+
+func TestDirectMessage_GroupOwnerByJoinOrder(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	channelid := s.createDM(t, map[string]any{"userids": []int{2, 3}, "name": "plans"}, "u1", "1")
+	endpoint := func(userid int) string {
+		return fmt.Sprintf("/api/dms/%d/participants/%d", channelid, userid)
+	}
+	// u2 rejoins after u3 and so has been in the conversation for less time
+	for _, method := range []string{http.MethodDelete, http.MethodPut} {
+		resp, err := s.sendAuthRequest(method, endpoint(2), nil, nil, nil)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s participant: expected OK; err: %v", method, err)
+		}
+	}
+	resp, err := s.sendAuthRequest(http.MethodDelete, endpoint(1), nil, nil, nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected owner to leave; err: %v", err)
+	}
+	dms := s.getDMs(t, "u2", "2")
+	if len(dms) != 1 || dms[0].OwnerId != 3 {
+		t.Fatalf("expected ownership to pass to u3; got %+v", dms)
+	}
+	if len(dms[0].Participants) != 2 || dms[0].Participants[0].UserID != 3 {
+		t.Fatalf("expected participants in join order; got %+v", dms[0].Participants)
+	}
+}
+
+func TestDirectMessage_InvalidParticipants(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	for _, payload := range []map[string]any{
+		{"userids": []int{}},
+		{"userids": []int{1}},
+		{"userids": []int{99}},
+	} {
+		resp, err := s.sendAuthJSON(http.MethodPost, "/api/users/me/dms", payload, nil, nil)
+		if err != nil {
+			t.Fatalf("error creating dm. Err: %v", err)
+		}
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected status BadRequest for %v; got %v", payload, resp.Status)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"go-chat-react/internal/database"
+	chatmail "go-chat-react/internal/mail"
+)
+
+const maxEmailLength = 254
+
+// normalizeEmail checks that value is a bare email address and lowercases it
+// so addresses compare equal regardless of how they were typed.
+func normalizeEmail(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	address, err := mail.ParseAddress(value)
+	if err != nil || address.Address != value || len(value) > maxEmailLength {
+		return "", errors.New("error: invalid email address")
+	}
+	return strings.ToLower(value), nil
+}
+
+// appLink builds a link into the web client carrying a token.
+func (s *Server) appLink(page string, token string) string {
+	return fmt.Sprintf("%s/%s?token=%s", strings.TrimSuffix(s.appURL, "/"), page, url.QueryEscape(token))
+}
+
+func (s *Server) sendVerificationEmail(ctx context.Context, userid database.Id, email string) error {
+	token, err := s.issueAuthToken(userid, tokenPurposeVerifyEmail, email, emailVerificationTokenLifetime)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, chatmail.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: "Confirm this address for your go-chat account by opening the link below:\n\n" +
+			s.appLink("verify-email", token) + "\n\n" +
+			"If you did not add this address you can ignore this email.\n",
+	})
+}
+
+func (s *Server) GetEmail(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	email, err := s.db.GetUserEmail(userid)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"email": email.Email, "verified": email.Verified})
+}
+
+// UpdateEmail changes the caller's email address and mails a verification
+// link to it. Submitting the current unverified address again resends the
+// link, and an empty address removes it.
+func (s *Server) UpdateEmail(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	request := struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	valid, err := s.confirmPassword(userid, request.Password)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "invalid password", http.StatusForbidden)
+		return
+	}
+	email := ""
+	if strings.TrimSpace(request.Email) != "" {
+		email, err = normalizeEmail(request.Email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	current, err := s.db.GetUserEmail(userid)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if current.Email == email && current.Verified {
+		writeJSON(w, map[string]any{"email": email, "verified": true})
+		return
+	}
+	if current.Email != email {
+		err = s.db.SetUserEmail(userid, email)
+		if errors.Is(err, database.ErrRecordAlreadyExists) {
+			http.Error(w, "error: email address already in use", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "error: unable to update email", http.StatusInternalServerError)
+			return
+		}
+	}
+	if email != "" {
+		if err := s.sendVerificationEmail(r.Context(), userid, email); err != nil {
+			log.Printf("UpdateEmail: unable to send verification to %d: %v", userid, err)
+			http.Error(w, "error: unable to send verification email", http.StatusInternalServerError)
+			return
+		}
+	}
+	writeJSON(w, map[string]any{"email": email, "verified": false})
+}
+
+// VerifyEmail redeems an emailed verification link. It needs no session so
+// the link works from any device.
+func (s *Server) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	request := struct {
+		Token string `json:"token"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	token, err := s.redeemAuthToken(tokenPurposeVerifyEmail, request.Token)
+	if errors.Is(err, errInvalidAuthToken) {
+		http.Error(w, "error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	err = s.db.MarkEmailVerified(token.UserId, token.Email)
+	if errors.Is(err, database.ErrRecordNotFound) {
+		http.Error(w, "error: email address has changed since the link was sent", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "error: unable to verify email", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"userid": token.UserId, "email": token.Email, "verified": true})
+}
+
+// RequestPasswordReset mails a reset link to the owner of a verified email
+// address. The response is the same whether or not the address is known so
+// it cannot be used to discover accounts.
+func (s *Server) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	request := struct {
+		Email string `json:"email"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	address, err := normalizeEmail(request.Email)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.sendPasswordReset(r.Context(), address); err != nil {
+		log.Printf("RequestPasswordReset: %v", err)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *Server) sendPasswordReset(ctx context.Context, address string) error {
+	userid, err := s.db.GetUserIDFromEmail(address)
+	if errors.Is(err, database.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	email, err := s.db.GetUserEmail(userid)
+	if err != nil || !email.Verified {
+		return err
+	}
+	token, err := s.issueAuthToken(userid, tokenPurposePasswordReset, address, passwordResetTokenLifetime)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, chatmail.Message{
+		To:      address,
+		Subject: "Reset your password",
+		Body: "A password reset was requested for your go-chat account. Choose a new password by opening the link below:\n\n" +
+			s.appLink("reset-password", token) + "\n\n" +
+			"The link expires in one hour. If you did not request a reset you can ignore this email.\n",
+	})
+}
+
+// ConfirmPasswordReset sets a new password using an emailed reset link and
+// signs the account out everywhere.
+func (s *Server) ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	request := struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	// a password the policy refuses leaves the link usable for another try
+	token, err := s.checkAuthToken(tokenPurposePasswordReset, request.Token)
+	if errors.Is(err, errInvalidAuthToken) {
+		http.Error(w, "error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	user, err := s.db.GetUser(token.UserId)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.passwords.check(user.UserName, request.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	token, err = s.redeemAuthToken(tokenPurposePasswordReset, request.Token)
+	if errors.Is(err, errInvalidAuthToken) {
+		http.Error(w, "error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	err = s.db.UpdateUserPassword(token.UserId, request.Password)
+	if err != nil {
+		http.Error(w, "error: unable to update password", http.StatusInternalServerError)
+		return
+	}
+	if err := s.db.DeleteUserSessionToken(token.UserId); err != nil {
+		log.Printf("ConfirmPasswordReset: unable to revoke session of %d: %v", token.UserId, err)
+	}
+	s.closeSessionsOfUser(token.UserId)
+	writeJSON(w, map[string]any{"userid": token.UserId})
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+
+	"go-chat-react/internal/mail"
+)
+
+// recordingMailer keeps sent emails in memory for tests to inspect.
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, message mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+func (m *recordingMailer) sent() []mail.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]mail.Message(nil), m.messages...)
+}
+
+var tokenLinkPattern = regexp.MustCompile(`token=(\S+)`)
+
+// lastToken returns the token of the link in the last email sent to an
+// address.
+func (s *TestServer) lastToken(t *testing.T, address string) string {
+	messages := s.app.mailer.(*recordingMailer).sent()
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].To != address {
+			continue
+		}
+		match := tokenLinkPattern.FindStringSubmatch(messages[i].Body)
+		if match == nil {
+			t.Fatalf("no link in email %q", messages[i].Body)
+		}
+		token, err := url.QueryUnescape(match[1])
+		if err != nil {
+			t.Fatalf("error decoding token. Err: %v", err)
+		}
+		return token
+	}
+	t.Fatalf("no email sent to %s", address)
+	return ""
+}
+
+func (s *TestServer) postJSON(t *testing.T, path string, payload any, status int) *http.Response {
+	data, _ := json.Marshal(payload)
+	resp, err := s.server.Client().Post(s.server.URL+path, "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("POST %s: err: %v", path, err)
+	}
+	if resp.StatusCode != status {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("POST %s: expected status %d; got %v: %s", path, status, resp.Status, body)
+	}
+	return resp
+}
+
+func TestPasswordReset(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	mailer := s.app.mailer.(*recordingMailer)
+
+	// unknown and unverified addresses get the same answer but no email
+	s.postJSON(t, "/api/auth/password-reset", map[string]any{"email": "nobody@example.com"}, http.StatusAccepted)
+	s.postJSON(t, "/api/auth/password-reset", map[string]any{"email": "u2@example.com"}, http.StatusAccepted)
+	if len(mailer.sent()) != 0 {
+		t.Fatalf("expected no emails; got %+v", mailer.sent())
+	}
+	s.postJSON(t, "/api/auth/password-reset", map[string]any{"email": "not an address"}, http.StatusBadRequest)
+
+	s.postJSON(t, "/api/auth/password-reset", map[string]any{"email": "U1@example.com"}, http.StatusAccepted)
+	token := s.lastToken(t, "u1@example.com")
+	s.postJSON(t, "/api/auth/password-reset/confirm",
+		map[string]any{"token": token + "x", "password": "new password"}, http.StatusBadRequest)
+	s.postJSON(t, "/api/auth/verify-email", map[string]any{"token": token}, http.StatusBadRequest)
+	// the policy is checked against the account the link belongs to, and a
+	// refused password leaves the link usable
+	s.postJSON(t, "/api/auth/password-reset/confirm",
+		map[string]any{"token": token, "password": "my name is u1"}, http.StatusBadRequest)
+	s.postJSON(t, "/api/auth/password-reset/confirm",
+		map[string]any{"token": token, "password": "new password"}, http.StatusOK)
+	s.postJSON(t, "/api/auth/password-reset/confirm",
+		map[string]any{"token": token, "password": "another password"}, http.StatusBadRequest)
+
+	if _, err := s.getLoginCookie("u1", "1"); err == nil {
+		t.Fatalf("expected old password to be rejected")
+	}
+	if _, err := s.getLoginCookie("u1", "new password"); err != nil {
+		t.Fatalf("error logging in with new password. Err: %v", err)
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	s.expectStatus(t, http.MethodPut, "/api/users/me/email",
+		map[string]any{"email": "three@example.com", "password": "wrong"}, "u3", "3", http.StatusForbidden)
+	s.expectStatus(t, http.MethodPut, "/api/users/me/email",
+		map[string]any{"email": "u1@example.com", "password": "3"}, "u3", "3", http.StatusConflict)
+	s.expectStatus(t, http.MethodPut, "/api/users/me/email",
+		map[string]any{"email": "three@example.com", "password": "3"}, "u3", "3", http.StatusOK)
+	stale := s.lastToken(t, "three@example.com")
+	s.expectStatus(t, http.MethodPut, "/api/users/me/email",
+		map[string]any{"email": "3@example.com", "password": "3"}, "u3", "3", http.StatusOK)
+	token := s.lastToken(t, "3@example.com")
+
+	s.postJSON(t, "/api/auth/verify-email", map[string]any{"token": stale}, http.StatusBadRequest)
+	s.postJSON(t, "/api/auth/verify-email", map[string]any{"token": token}, http.StatusOK)
+
+	resp := s.expectStatus(t, http.MethodGet, "/api/users/me/email", nil, "u3", "3", http.StatusOK)
+	email := struct {
+		Email    string `json:"email"`
+		Verified bool   `json:"verified"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&email); err != nil {
+		t.Fatalf("error decoding response. Err: %v", err)
+	}
+	if email.Email != "3@example.com" || !email.Verified {
+		t.Fatalf("expected verified address; got %+v", email)
+	}
+}
+
+func TestCreateUser_WithEmail(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	s.postJSON(t, "/api/users",
+		map[string]any{"username": "u4", "password": "fourth password", "email": "u1@example.com"}, http.StatusBadRequest)
+	s.postJSON(t, "/api/users",
+		map[string]any{"username": "u4", "password": "fourth password", "email": "u4@example.com"}, http.StatusOK)
+	token := s.lastToken(t, "u4@example.com")
+	s.postJSON(t, "/api/auth/verify-email", map[string]any{"token": token}, http.StatusOK)
+}
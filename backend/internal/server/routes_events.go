@@ -0,0 +1,323 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"go-chat-react/internal/database"
+)
+
+const (
+	maxEventEndpointsPerServer = 10
+	maxEventEndpointURLLength  = 2048
+	eventDeliveriesPerPage     = 50
+)
+
+type EventEndpointInfo struct {
+	EndpointID database.Id `json:"endpointid"`
+	ServerID   database.Id `json:"serverid"`
+	CreatorID  database.Id `json:"creatorid"`
+	URL        string      `json:"url"`
+	Events     []string    `json:"events"`
+	Enabled    bool        `json:"enabled"`
+	Failures   int         `json:"failures"`
+	Created    time.Time   `json:"created"`
+}
+
+func fromDBEventEndpoint(endpoint database.EventEndpoint) EventEndpointInfo {
+	return EventEndpointInfo{
+		EndpointID: endpoint.EndpointId,
+		ServerID:   endpoint.ServerId,
+		CreatorID:  endpoint.CreatorId,
+		URL:        endpoint.URL,
+		Events:     endpoint.Events,
+		Enabled:    endpoint.Enabled,
+		Failures:   endpoint.Failures,
+		Created:    endpoint.Created,
+	}
+}
+
+type EventDeliveryInfo struct {
+	DeliveryID   database.Id `json:"deliveryid"`
+	Event        string      `json:"event"`
+	Status       string      `json:"status"`
+	Attempts     int         `json:"attempts"`
+	NextAttempt  *time.Time  `json:"next_attempt,omitempty"`
+	LastAttempt  *time.Time  `json:"last_attempt,omitempty"`
+	ResponseCode int         `json:"response_code,omitempty"`
+	Error        string      `json:"error,omitempty"`
+	Created      time.Time   `json:"created"`
+}
+
+func fromDBEventDelivery(delivery database.EventDelivery) EventDeliveryInfo {
+	info := EventDeliveryInfo{
+		DeliveryID:   delivery.DeliveryId,
+		Event:        delivery.Event,
+		Status:       delivery.Status,
+		Attempts:     delivery.Attempts,
+		LastAttempt:  delivery.LastAttempt,
+		ResponseCode: delivery.ResponseCode,
+		Error:        delivery.Error,
+		Created:      delivery.Created,
+	}
+	if delivery.Status == database.EventDeliveryPending {
+		info.NextAttempt = &delivery.NextAttempt
+	}
+	return info
+}
+
+// validateEventEndpoint checks the target of an outgoing webhook. Payloads
+// are signed but not encrypted, so only https endpoints are accepted.
+func validateEventEndpoint(rawURL string, events []string) error {
+	if len(rawURL) > maxEventEndpointURLLength {
+		return errors.New("error: url too long")
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return errors.New("error: url must be an https address")
+	}
+	if len(events) == 0 {
+		return errors.New("error: at least one event is required")
+	}
+	for _, event := range events {
+		if !slices.Contains(eventNames, event) {
+			return fmt.Errorf("error: unknown event %q", event)
+		}
+	}
+	return nil
+}
+
+// endpointAuditValues are the settings of an outgoing webhook recorded in
+// the audit log. The secret is left out.
+func endpointAuditValues(endpoint database.EventEndpoint) map[string]any {
+	return map[string]any{"url": endpoint.URL, "events": endpoint.Events, "enabled": endpoint.Enabled}
+}
+
+// getManagedServer loads the server in the path and checks that the caller
+// owns it.
+func (s *Server) getManagedServer(r *http.Request) (database.Server, httpErrorInfo, error) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		return database.Server{}, httpErrorInfo{http.StatusInternalServerError, err.Error()}, err
+	}
+	server, err := s.GetServerFromRequest(r)
+	if err != nil {
+		return database.Server{}, httpErrorInfo{http.StatusNotFound, err.Error()}, err
+	}
+	if server.OwnerId != userid {
+		return database.Server{}, httpErrorInfo{http.StatusForbidden, "error: user not owner of server"},
+			errors.New("not owner")
+	}
+	return server, httpErrorInfo{}, nil
+}
+
+// getManagedEventEndpoint resolves {endpointid} within a server the caller
+// owns. Endpoints of other servers are reported as missing.
+func (s *Server) getManagedEventEndpoint(r *http.Request) (database.EventEndpoint, httpErrorInfo, error) {
+	server, errorInfo, err := s.getManagedServer(r)
+	if err != nil {
+		return database.EventEndpoint{}, errorInfo, err
+	}
+	endpointid, err := parsePathFromID(r, "endpointid")
+	if err != nil {
+		return database.EventEndpoint{}, httpErrorInfo{http.StatusBadRequest, err.Error()}, err
+	}
+	endpoint, err := s.db.GetEventEndpoint(endpointid)
+	if err == nil && endpoint.ServerId != server.ServerId {
+		err = database.ErrRecordNotFound
+	}
+	if errors.Is(err, database.ErrRecordNotFound) {
+		return database.EventEndpoint{}, httpErrorInfo{http.StatusNotFound, "error: outgoing webhook not found"}, err
+	}
+	if err != nil {
+		return database.EventEndpoint{}, httpErrorInfo{http.StatusInternalServerError, "database error"}, err
+	}
+	return endpoint, httpErrorInfo{}, nil
+}
+
+func (s *Server) GetEventEndpoints(w http.ResponseWriter, r *http.Request) {
+	server, errorInfo, err := s.getManagedServer(r)
+	if err != nil {
+		http.Error(w, errorInfo.Message, errorInfo.StatusCode)
+		return
+	}
+	endpoints, err := s.db.GetEventEndpointsOfServer(server.ServerId)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	infos := make([]EventEndpointInfo, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		infos = append(infos, fromDBEventEndpoint(endpoint))
+	}
+	writeJSON(w, map[string]any{"endpoints": infos, "events": eventNames})
+}
+
+// CreateEventEndpoint registers an outgoing webhook. The returned secret
+// signs every delivery and cannot be shown again.
+func (s *Server) CreateEventEndpoint(w http.ResponseWriter, r *http.Request) {
+	server, errorInfo, err := s.getManagedServer(r)
+	if err != nil {
+		http.Error(w, errorInfo.Message, errorInfo.StatusCode)
+		return
+	}
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	request := struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	if err := validateEventEndpoint(request.URL, request.Events); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	existing, err := s.db.GetEventEndpointsOfServer(server.ServerId)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if len(existing) >= maxEventEndpointsPerServer {
+		http.Error(w, "error: outgoing webhook limit reached", http.StatusBadRequest)
+		return
+	}
+	secret := rand.Text()
+	endpointid, err := s.db.CreateEventEndpoint(database.EventEndpoint{
+		ServerId:  server.ServerId,
+		CreatorId: userid,
+		URL:       request.URL,
+		Secret:    secret,
+		Events:    slices.Compact(slices.Sorted(slices.Values(request.Events))),
+	})
+	if err != nil {
+		http.Error(w, "error: unable to create outgoing webhook", http.StatusInternalServerError)
+		return
+	}
+	endpoint, err := s.db.GetEventEndpoint(endpointid)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	s.recordAudit(r, database.AuditEntry{
+		ServerId:   server.ServerId,
+		Action:     auditEndpointCreate,
+		TargetType: database.AuditTargetEndpoint,
+		TargetId:   endpointid,
+		After:      endpointAuditValues(endpoint),
+	})
+	writeJSON(w, map[string]any{"endpoint": fromDBEventEndpoint(endpoint), "secret": secret})
+}
+
+// UpdateEventEndpoint changes the url or events of an outgoing webhook, or
+// turns it back on after it was disabled for failing.
+func (s *Server) UpdateEventEndpoint(w http.ResponseWriter, r *http.Request) {
+	endpoint, errorInfo, err := s.getManagedEventEndpoint(r)
+	if err != nil {
+		http.Error(w, errorInfo.Message, errorInfo.StatusCode)
+		return
+	}
+	previous := endpoint
+	request := struct {
+		URL     *string   `json:"url"`
+		Events  *[]string `json:"events"`
+		Enabled *bool     `json:"enabled"`
+	}{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	if request.URL != nil {
+		endpoint.URL = *request.URL
+	}
+	if request.Events != nil {
+		endpoint.Events = slices.Compact(slices.Sorted(slices.Values(*request.Events)))
+	}
+	if request.Enabled != nil {
+		endpoint.Enabled = *request.Enabled
+	}
+	if err := validateEventEndpoint(endpoint.URL, endpoint.Events); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = s.db.UpdateEventEndpoint(endpoint.EndpointId, endpoint.URL, endpoint.Events, endpoint.Enabled)
+	if err != nil {
+		http.Error(w, "error: unable to update outgoing webhook", http.StatusInternalServerError)
+		return
+	}
+	endpoint, err = s.db.GetEventEndpoint(endpoint.EndpointId)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	s.recordAudit(r, database.AuditEntry{
+		ServerId:   endpoint.ServerId,
+		Action:     auditEndpointUpdate,
+		TargetType: database.AuditTargetEndpoint,
+		TargetId:   endpoint.EndpointId,
+		Before:     endpointAuditValues(previous),
+		After:      endpointAuditValues(endpoint),
+	})
+	if endpoint.Enabled {
+		s.events.Wake()
+	}
+	writeJSON(w, map[string]any{"endpoint": fromDBEventEndpoint(endpoint)})
+}
+
+func (s *Server) DeleteEventEndpoint(w http.ResponseWriter, r *http.Request) {
+	endpoint, errorInfo, err := s.getManagedEventEndpoint(r)
+	if err != nil {
+		http.Error(w, errorInfo.Message, errorInfo.StatusCode)
+		return
+	}
+	if err := s.db.DeleteEventEndpoint(endpoint.EndpointId); err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	s.recordAudit(r, database.AuditEntry{
+		ServerId:   endpoint.ServerId,
+		Action:     auditEndpointDelete,
+		TargetType: database.AuditTargetEndpoint,
+		TargetId:   endpoint.EndpointId,
+		Before:     endpointAuditValues(endpoint),
+	})
+	writeJSON(w, map[string]any{"endpointid": endpoint.EndpointId})
+}
+
+// GetEventDeliveries returns the most recent deliveries of an outgoing
+// webhook, newest first.
+func (s *Server) GetEventDeliveries(w http.ResponseWriter, r *http.Request) {
+	endpoint, errorInfo, err := s.getManagedEventEndpoint(r)
+	if err != nil {
+		http.Error(w, errorInfo.Message, errorInfo.StatusCode)
+		return
+	}
+	count, err := parseCountFromQuery(r, eventDeliveriesPerPage)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	deliveries, err := s.db.GetEventDeliveries(endpoint.EndpointId, min(count, eventDeliveriesPerPage))
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	infos := make([]EventDeliveryInfo, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		infos = append(infos, fromDBEventDelivery(delivery))
+	}
+	writeJSON(w, map[string]any{"deliveries": infos})
+}
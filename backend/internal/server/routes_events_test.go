@@ -0,0 +1,243 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-chat-react/internal/unfurl"
+)
+
+// eventReceiver is an https endpoint that records the deliveries it gets
+// and answers with status.
+type eventReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	requests []receivedEvent
+}
+
+type receivedEvent struct {
+	header http.Header
+	body   []byte
+}
+
+func newEventReceiver(t *testing.T, status int) *eventReceiver {
+	receiver := &eventReceiver{status: status}
+	receiver.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+		receiver.requests = append(receiver.requests, receivedEvent{header: r.Header.Clone(), body: body})
+		w.WriteHeader(receiver.status)
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver
+}
+
+func (receiver *eventReceiver) received() []receivedEvent {
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	return append([]receivedEvent(nil), receiver.requests...)
+}
+
+func (s *TestServer) createEventEndpoint(t *testing.T, receiver *eventReceiver, events ...string) (EventEndpointInfo, string) {
+	s.app.events.client = receiver.Client()
+	resp := s.expectStatus(t, http.MethodPost, "/api/servers/1/outgoing-webhooks",
+		map[string]any{"url": receiver.URL, "events": events}, "u1", "1", http.StatusOK)
+	created := struct {
+		Endpoint EventEndpointInfo `json:"endpoint"`
+		Secret   string            `json:"secret"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("error decoding endpoint. Err: %v", err)
+	}
+	return created.Endpoint, created.Secret
+}
+
+func (s *TestServer) eventDeliveries(t *testing.T, endpointid int64) []EventDeliveryInfo {
+	resp := s.expectStatus(t, http.MethodGet,
+		fmt.Sprintf("/api/servers/1/outgoing-webhooks/%d/deliveries", endpointid), nil, "u1", "1", http.StatusOK)
+	result := struct {
+		Deliveries []EventDeliveryInfo `json:"deliveries"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("error decoding deliveries. Err: %v", err)
+	}
+	return result.Deliveries
+}
+
+func TestEventEndpoint_Deliver(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	receiver := newEventReceiver(t, http.StatusNoContent)
+	endpoint, secret := s.createEventEndpoint(t, receiver, eventMessageCreated)
+
+	s.expectStatus(t, http.MethodPost, "/api/channels/1/messages",
+		map[string]any{"message": "hello hooks"}, "u1", "1", http.StatusOK)
+	s.expectStatus(t, http.MethodPatch, "/api/channels/1",
+		map[string]any{"channelname": "renamed"}, "u1", "1", http.StatusOK)
+	if err := s.app.events.process(context.Background(), time.Now()); err != nil {
+		t.Fatalf("process: err: %v", err)
+	}
+
+	requests := receiver.received()
+	if len(requests) != 1 {
+		t.Fatalf("expected only the subscribed event to be delivered got %d", len(requests))
+	}
+	request := requests[0]
+	timestamp := request.header.Get(eventTimestampHeader)
+	if request.header.Get(eventSignatureHeader) != signEventPayload(secret, timestamp, request.body) {
+		t.Fatalf("signature %q does not match the body", request.header.Get(eventSignatureHeader))
+	}
+	if request.header.Get(eventSignatureHeader) == signEventPayload("other", timestamp, request.body) {
+		t.Fatalf("signature should depend on the secret")
+	}
+	event := struct {
+		Event    string        `json:"event"`
+		ServerID int64         `json:"serverid"`
+		Data     ServerMessage `json:"data"`
+	}{}
+	if err := json.Unmarshal(request.body, &event); err != nil {
+		t.Fatalf("error decoding event. Err: %v", err)
+	}
+	if event.Event != eventMessageCreated || event.ServerID != 1 || event.Data.Message != "hello hooks" ||
+		request.header.Get("X-Chat-Event") != eventMessageCreated {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	deliveries := s.eventDeliveries(t, int64(endpoint.EndpointID))
+	if len(deliveries) != 1 || deliveries[0].Status != "delivered" || deliveries[0].ResponseCode != http.StatusNoContent {
+		t.Fatalf("unexpected delivery log %+v", deliveries)
+	}
+	if err := s.app.events.process(context.Background(), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("process: err: %v", err)
+	}
+	if len(receiver.received()) != 1 {
+		t.Fatalf("expected delivered events not to be sent again")
+	}
+}
+
+func TestEventEndpoint_RefusesInternalAddresses(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	receiver := newEventReceiver(t, http.StatusNoContent)
+	endpoint, _ := s.createEventEndpoint(t, receiver, eventMessageCreated)
+	// the receiver listens on 127.0.0.1
+	s.app.events.client = unfurl.NewClient(time.Second, false)
+
+	s.expectStatus(t, http.MethodPost, "/api/channels/1/messages",
+		map[string]any{"message": "hello hooks"}, "u1", "1", http.StatusOK)
+	if err := s.app.events.process(context.Background(), time.Now()); err != nil {
+		t.Fatalf("process: err: %v", err)
+	}
+	if len(receiver.received()) != 0 {
+		t.Fatalf("expected nothing to reach the loopback address")
+	}
+	deliveries := s.eventDeliveries(t, int64(endpoint.EndpointID))
+	if len(deliveries) != 1 || deliveries[0].Status != "pending" || !strings.Contains(deliveries[0].Error, "address not allowed") {
+		t.Fatalf("unexpected delivery log %+v", deliveries)
+	}
+}
+
+func TestEventEndpoint_RetryAndDisable(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	receiver := newEventReceiver(t, http.StatusInternalServerError)
+	endpoint, _ := s.createEventEndpoint(t, receiver, eventMemberJoined)
+	ctx := context.Background()
+
+	s.app.publishEvent(1, eventMemberJoined, channelMemberEvent{UserId: 3, ChannelId: 1})
+	now := time.Now()
+	if err := s.app.events.process(ctx, now); err != nil {
+		t.Fatalf("process: err: %v", err)
+	}
+	deliveries := s.eventDeliveries(t, int64(endpoint.EndpointID))
+	if len(deliveries) != 1 || deliveries[0].Status != "pending" || deliveries[0].Attempts != 1 ||
+		deliveries[0].ResponseCode != http.StatusInternalServerError || deliveries[0].NextAttempt == nil {
+		t.Fatalf("unexpected delivery log %+v", deliveries)
+	}
+	if wait := deliveries[0].NextAttempt.Sub(now); wait < eventRetryBaseDelay-time.Second || wait > eventRetryBaseDelay+time.Second {
+		t.Fatalf("expected first retry after %v got %v", eventRetryBaseDelay, wait)
+	}
+
+	// nothing is sent before the backoff has passed
+	s.app.events.process(ctx, now.Add(eventRetryBaseDelay/2))
+	if len(receiver.received()) != 1 {
+		t.Fatalf("expected no attempt before the retry is due got %d", len(receiver.received()))
+	}
+	s.app.events.process(ctx, now.Add(eventRetryBaseDelay+time.Second))
+	deliveries = s.eventDeliveries(t, int64(endpoint.EndpointID))
+	if len(receiver.received()) != 2 || deliveries[0].Attempts != 2 {
+		t.Fatalf("expected a second attempt got %d requests and log %+v", len(receiver.received()), deliveries)
+	}
+
+	for range eventEndpointMaxFailures {
+		s.app.publishEvent(1, eventMemberJoined, channelMemberEvent{UserId: 3, ChannelId: 1})
+	}
+	s.app.events.process(ctx, now.Add(time.Minute))
+	if attempts := len(receiver.received()); attempts != eventEndpointMaxFailures {
+		t.Fatalf("expected the endpoint to stop after %d failures got %d attempts", eventEndpointMaxFailures, attempts)
+	}
+	resp := s.expectStatus(t, http.MethodGet, "/api/servers/1/outgoing-webhooks", nil, "u1", "1", http.StatusOK)
+	listed := struct {
+		Endpoints []EventEndpointInfo `json:"endpoints"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&listed); err != nil {
+		t.Fatalf("error decoding endpoints. Err: %v", err)
+	}
+	if len(listed.Endpoints) != 1 || listed.Endpoints[0].Enabled {
+		t.Fatalf("expected the endpoint to be disabled got %+v", listed.Endpoints)
+	}
+
+	// re-enabling resumes the queued deliveries
+	receiver.mu.Lock()
+	receiver.status = http.StatusOK
+	receiver.mu.Unlock()
+	s.expectStatus(t, http.MethodPatch, fmt.Sprintf("/api/servers/1/outgoing-webhooks/%d", endpoint.EndpointID),
+		map[string]any{"enabled": true}, "u1", "1", http.StatusOK)
+	s.app.events.process(ctx, now.Add(eventRetryMaxDelay))
+	for _, delivery := range s.eventDeliveries(t, int64(endpoint.EndpointID)) {
+		if delivery.Status != "delivered" {
+			t.Fatalf("expected all deliveries to succeed once re-enabled got %+v", delivery)
+		}
+	}
+}
+
+func TestEventEndpoint_Manage(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	receiver := newEventReceiver(t, http.StatusOK)
+	endpoint, _ := s.createEventEndpoint(t, receiver, eventChannelCreated)
+
+	for _, payload := range []map[string]any{
+		{"url": "http://hooks.example.com", "events": []string{eventChannelCreated}},
+		{"url": receiver.URL, "events": []string{"server.exploded"}},
+		{"url": receiver.URL, "events": []string{}},
+	} {
+		s.expectStatus(t, http.MethodPost, "/api/servers/1/outgoing-webhooks", payload, "u1", "1", http.StatusBadRequest)
+	}
+	s.expectStatus(t, http.MethodPost, "/api/servers/1/outgoing-webhooks",
+		map[string]any{"url": receiver.URL, "events": []string{eventChannelCreated}}, "u2", "2", http.StatusForbidden)
+	s.expectStatus(t, http.MethodGet, fmt.Sprintf("/api/servers/2/outgoing-webhooks/%d/deliveries", endpoint.EndpointID),
+		nil, "u2", "2", http.StatusNotFound)
+
+	s.expectStatus(t, http.MethodPost, "/api/servers/1/channels",
+		map[string]any{"channelname": "announcements"}, "u1", "1", http.StatusOK)
+	s.app.events.process(context.Background(), time.Now())
+	if len(receiver.received()) != 1 {
+		t.Fatalf("expected channel.created to be delivered got %d", len(receiver.received()))
+	}
+
+	s.expectStatus(t, http.MethodDelete, fmt.Sprintf("/api/servers/1/outgoing-webhooks/%d", endpoint.EndpointID),
+		nil, "u1", "1", http.StatusOK)
+	s.expectStatus(t, http.MethodGet, fmt.Sprintf("/api/servers/1/outgoing-webhooks/%d/deliveries", endpoint.EndpointID),
+		nil, "u1", "1", http.StatusNotFound)
+}
@@ -0,0 +1,404 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"go-chat-react/internal/database"
+)
+
+type FriendInfo struct {
+	UserID   database.Id `json:"userid"`
+	UserName string      `json:"username"`
+	Online   bool        `json:"online"`
+}
+
+type FriendRequestInfo struct {
+	UserID    database.Id `json:"userid"`
+	UserName  string      `json:"username"`
+	Timestamp string      `json:"timestamp"`
+}
+
+func (s *Server) isOnline(userid database.Id) bool {
+	s.sessions_mutex.RLock()
+	defer s.sessions_mutex.RUnlock()
+	return len(s.sessions_of_user[userid]) > 0
+}
+
+// blockedBetween reports whether either user has blocked the other.
+func (s *Server) blockedBetween(userid database.Id, otherid database.Id) (bool, error) {
+	blocked, err := s.db.HasBlocked(userid, otherid)
+	if err != nil || blocked {
+		return blocked, err
+	}
+	return s.db.HasBlocked(otherid, userid)
+}
+
+// errMessageBlocked rejects messages between users when one blocked the
+// other.
+var errMessageBlocked = errors.New("error: unable to message user")
+
+// checkDirectMessageBlock rejects messages to a one to one conversation when
+// either participant has blocked the other. Server channels and group DMs
+// are not affected.
+func (s *Server) checkDirectMessageBlock(userid database.Id, channelid database.Id) error {
+	channel, err := s.db.GetChannel(channelid)
+	if err != nil {
+		return err
+	}
+	if !channel.IsDirectMessage() {
+		return nil
+	}
+	dm, err := s.db.GetDirectMessage(channelid)
+	if err != nil {
+		return err
+	}
+	if dm.IsGroup {
+		return nil
+	}
+	for _, participant := range dm.Participants {
+		if participant.UserId == userid {
+			continue
+		}
+		blocked, err := s.blockedBetween(userid, participant.UserId)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return errMessageBlocked
+		}
+	}
+	return nil
+}
+
+// flagBlockedMessages marks the messages written by users the viewer has
+// blocked.
+func (s *Server) flagBlockedMessages(viewer database.Id, messages []ServerMessage) {
+	blocked, err := s.db.GetBlockedUsers(viewer)
+	if err != nil {
+		log.Printf("flagBlockedMessages: unable to fetch blocked users of %d: %v", viewer, err)
+		return
+	}
+	if len(blocked) == 0 {
+		return
+	}
+	blockedids := make(map[database.Id]bool, len(blocked))
+	for _, user := range blocked {
+		blockedids[user.UserId] = true
+	}
+	for i := range messages {
+		messages[i].Blocked = blockedids[messages[i].UserId]
+	}
+}
+
+// getOtherUserFromRequest resolves {userid} to an existing user other than
+// the caller.
+func (s *Server) getOtherUserFromRequest(
+	r *http.Request,
+	userid database.Id,
+) (database.User, httpErrorInfo, error) {
+	otherid, err := parsePathFromID(r, "userid")
+	if err != nil {
+		return database.User{}, httpErrorInfo{
+			http.StatusBadRequest,
+			"invalid request: unable to parse user id",
+		}, err
+	}
+	if otherid == userid {
+		err = errors.New("error: cannot target yourself")
+		return database.User{}, httpErrorInfo{http.StatusBadRequest, err.Error()}, err
+	}
+	user, err := s.db.GetUser(otherid)
+	if err != nil {
+		return database.User{}, httpErrorInfo{http.StatusNotFound, "error: unable to locate user"}, err
+	}
+	return user, httpErrorInfo{}, nil
+}
+
+func (s *Server) GetFriends(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	friends, err := s.db.GetFriends(userid)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	infos := make([]FriendInfo, len(friends))
+	for i, friend := range friends {
+		infos[i] = FriendInfo{
+			UserID:   friend.UserId,
+			UserName: friend.UserName,
+			Online:   s.isOnline(friend.UserId),
+		}
+	}
+	writeJSON(w, map[string]any{"friends": infos})
+}
+
+func (s *Server) RemoveFriend(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	friend, errInfo, err := s.getOtherUserFromRequest(r, userid)
+	if err != nil {
+		http.Error(w, errInfo.Message, errInfo.StatusCode)
+		return
+	}
+	err = s.db.RemoveFriend(userid, friend.UserId)
+	if errors.Is(err, database.ErrRecordNotFound) {
+		http.Error(w, "error: user is not a friend", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	s.notifyRelationship("friend_removed", userid, friend.UserId)
+}
+
+func (s *Server) GetFriendRequests(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	requests, err := s.db.GetFriendRequests(userid)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	incoming := []FriendRequestInfo{}
+	outgoing := []FriendRequestInfo{}
+	for _, request := range requests {
+		otherid := request.SenderId
+		if otherid == userid {
+			otherid = request.ReceiverId
+		}
+		other, err := s.db.GetUser(otherid)
+		if err != nil {
+			log.Printf("GetFriendRequests: unable to fetch user %d: %v", otherid, err)
+			continue
+		}
+		info := FriendRequestInfo{
+			UserID:    other.UserId,
+			UserName:  other.UserName,
+			Timestamp: request.Timestamp.String(),
+		}
+		if request.SenderId == userid {
+			outgoing = append(outgoing, info)
+		} else {
+			incoming = append(incoming, info)
+		}
+	}
+	writeJSON(w, map[string]any{"incoming": incoming, "outgoing": outgoing})
+}
+
+// SendFriendRequest asks the user given by id or username to become friends.
+// If they already asked the caller the friendship is formed immediately.
+func (s *Server) SendFriendRequest(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	request := struct {
+		UserId   database.Id `json:"userid"`
+		UserName string      `json:"username"`
+	}{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	target := request.UserId
+	if target == 0 && request.UserName != "" {
+		target, err = s.db.GetUserIDFromUserName(request.UserName)
+		if err != nil {
+			http.Error(w, "error: unable to locate user", http.StatusNotFound)
+			return
+		}
+	}
+	if target == userid {
+		http.Error(w, "error: cannot befriend yourself", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.db.GetUser(target); err != nil {
+		http.Error(w, "error: unable to locate user", http.StatusNotFound)
+		return
+	}
+	// The same message is used whichever side placed the block so that it
+	// cannot be used to find out who has blocked you.
+	blocked, err := s.blockedBetween(userid, target)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		http.Error(w, "error: unable to send friend request", http.StatusForbidden)
+		return
+	}
+	accepted, err := s.db.SendFriendRequest(userid, target)
+	if errors.Is(err, database.ErrRecordAlreadyExists) {
+		http.Error(w, "error: friend request already sent", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "error: unable to send friend request", http.StatusBadRequest)
+		return
+	}
+	if accepted {
+		s.notifyRelationship("friend_added", userid, target)
+	} else {
+		s.notifyRelationship("friend_request", userid, target)
+	}
+	writeJSON(w, map[string]any{"userid": target, "accepted": accepted})
+}
+
+func (s *Server) AcceptFriendRequest(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sender, errInfo, err := s.getOtherUserFromRequest(r, userid)
+	if err != nil {
+		http.Error(w, errInfo.Message, errInfo.StatusCode)
+		return
+	}
+	err = s.db.AcceptFriendRequest(userid, sender.UserId)
+	if errors.Is(err, database.ErrRecordNotFound) {
+		http.Error(w, "error: unable to locate friend request", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	s.notifyRelationship("friend_added", userid, sender.UserId)
+}
+
+func (s *Server) DeclineFriendRequest(w http.ResponseWriter, r *http.Request) {
+	s.deleteFriendRequest(w, r, false)
+}
+
+func (s *Server) CancelFriendRequest(w http.ResponseWriter, r *http.Request) {
+	s.deleteFriendRequest(w, r, true)
+}
+
+// deleteFriendRequest removes a pending request between the caller and
+// {userid}, sent by the caller when outgoing is set and received otherwise.
+func (s *Server) deleteFriendRequest(w http.ResponseWriter, r *http.Request, outgoing bool) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	other, errInfo, err := s.getOtherUserFromRequest(r, userid)
+	if err != nil {
+		http.Error(w, errInfo.Message, errInfo.StatusCode)
+		return
+	}
+	senderid, receiverid := other.UserId, userid
+	if outgoing {
+		senderid, receiverid = userid, other.UserId
+	}
+	err = s.db.DeleteFriendRequest(senderid, receiverid)
+	if errors.Is(err, database.ErrRecordNotFound) {
+		http.Error(w, "error: unable to locate friend request", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	s.notifyRelationship("friend_request_removed", userid, other.UserId)
+}
+
+func (s *Server) GetBlockedUsers(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	blocked, err := s.db.GetBlockedUsers(userid)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	users := make([]User, len(blocked))
+	for i, user := range blocked {
+		users[i] = User{UserID: user.UserId, UserName: user.UserName}
+	}
+	writeJSON(w, map[string]any{"blocked": users})
+}
+
+// BlockUser blocks {userid}, removing any friendship or pending friend
+// request with them. The blocked user is not notified.
+func (s *Server) BlockUser(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	target, errInfo, err := s.getOtherUserFromRequest(r, userid)
+	if err != nil {
+		http.Error(w, errInfo.Message, errInfo.StatusCode)
+		return
+	}
+	err = s.db.BlockUser(userid, target.UserId)
+	if errors.Is(err, database.ErrRecordAlreadyExists) {
+		http.Error(w, "error: user already blocked", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if byte_data, err := newServerResponse("user_blocked", map[string]any{"userid": target.UserId}); err == nil {
+		s.sendToUser(userid, byte_data)
+	}
+}
+
+func (s *Server) UnblockUser(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	target, errInfo, err := s.getOtherUserFromRequest(r, userid)
+	if err != nil {
+		http.Error(w, errInfo.Message, errInfo.StatusCode)
+		return
+	}
+	err = s.db.UnblockUser(userid, target.UserId)
+	if errors.Is(err, database.ErrRecordNotFound) {
+		http.Error(w, "error: user not blocked", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if byte_data, err := newServerResponse("user_unblocked", map[string]any{"userid": target.UserId}); err == nil {
+		s.sendToUser(userid, byte_data)
+	}
+}
+
+// notifyRelationship tells both users about a change between them. Each
+// side receives the id of the other user.
+func (s *Server) notifyRelationship(message_type string, userid database.Id, otherid database.Id) {
+	for _, pair := range [][2]database.Id{{userid, otherid}, {otherid, userid}} {
+		byte_data, err := newServerResponse(message_type, map[string]any{"userid": pair[1]})
+		if err != nil {
+			log.Printf("notifyRelationship: error marshalling %s: %v", message_type, err)
+			return
+		}
+		s.sendToUser(pair[0], byte_data)
+	}
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func (s *TestServer) expectStatus(
+	t *testing.T,
+	method string,
+	path string,
+	payload any,
+	username string,
+	password string,
+	status int,
+) *http.Response {
+	resp, err := s.sendAuthJSON(method, path, payload, &username, &password)
+	if err != nil {
+		t.Fatalf("%s %s: err: %v", method, path, err)
+	}
+	if resp.StatusCode != status {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("%s %s: expected status %d; got %v: %s", method, path, status, resp.Status, body)
+	}
+	return resp
+}
+
+func TestFriendRequest_Accept(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	s.expectStatus(t, http.MethodPost, "/api/users/me/friend-requests",
+		map[string]any{"username": "u2"}, "u1", "1", http.StatusOK)
+	s.expectStatus(t, http.MethodPost, "/api/users/me/friend-requests",
+		map[string]any{"userid": 2}, "u1", "1", http.StatusConflict)
+
+	resp := s.expectStatus(t, http.MethodGet, "/api/users/me/friend-requests", nil, "u2", "2", http.StatusOK)
+	requests := struct {
+		Incoming []FriendRequestInfo `json:"incoming"`
+		Outgoing []FriendRequestInfo `json:"outgoing"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&requests); err != nil {
+		t.Fatalf("error decoding friend requests. Err: %v", err)
+	}
+	if len(requests.Incoming) != 1 || requests.Incoming[0].UserID != 1 || len(requests.Outgoing) != 0 {
+		t.Fatalf("unexpected friend requests %+v", requests)
+	}
+
+	s.expectStatus(t, http.MethodPost, "/api/users/me/friend-requests/1/accept", nil, "u2", "2", http.StatusOK)
+	resp = s.expectStatus(t, http.MethodGet, "/api/users/me/friends", nil, "u1", "1", http.StatusOK)
+	friends := struct {
+		Friends []FriendInfo `json:"friends"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&friends); err != nil {
+		t.Fatalf("error decoding friends. Err: %v", err)
+	}
+	if len(friends.Friends) != 1 || friends.Friends[0].UserName != "u2" {
+		t.Fatalf("unexpected friends %+v", friends.Friends)
+	}
+
+	s.expectStatus(t, http.MethodDelete, "/api/users/me/friends/1", nil, "u2", "2", http.StatusOK)
+	s.expectStatus(t, http.MethodDelete, "/api/users/me/friends/1", nil, "u2", "2", http.StatusNotFound)
+}
+
+func TestFriendRequest_DeclineAndCancel(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	s.expectStatus(t, http.MethodPost, "/api/users/me/friend-requests",
+		map[string]any{"userid": 3}, "u1", "1", http.StatusOK)
+	s.expectStatus(t, http.MethodDelete, "/api/users/me/friend-requests/1", nil, "u3", "3", http.StatusNotFound)
+	s.expectStatus(t, http.MethodPost, "/api/users/me/friend-requests/1/decline", nil, "u3", "3", http.StatusOK)
+
+	s.expectStatus(t, http.MethodPost, "/api/users/me/friend-requests",
+		map[string]any{"userid": 3}, "u1", "1", http.StatusOK)
+	s.expectStatus(t, http.MethodDelete, "/api/users/me/friend-requests/3", nil, "u1", "1", http.StatusOK)
+	s.expectStatus(t, http.MethodPost, "/api/users/me/friend-requests/1/accept", nil, "u3", "3", http.StatusNotFound)
+}
+
+func TestBlockUser_PreventsContact(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	channelid := s.createDM(t, map[string]any{"userids": []int{3}}, "u1", "1")
+	s.expectStatus(t, http.MethodPut, "/api/users/me/blocks/1", nil, "u3", "3", http.StatusOK)
+	s.expectStatus(t, http.MethodPut, "/api/users/me/blocks/1", nil, "u3", "3", http.StatusConflict)
+
+	s.expectStatus(t, http.MethodPost, "/api/users/me/friend-requests",
+		map[string]any{"userid": 3}, "u1", "1", http.StatusForbidden)
+	s.expectStatus(t, http.MethodPost, "/api/users/me/dms",
+		map[string]any{"userids": []int{3}}, "u1", "1", http.StatusForbidden)
+	s.expectStatus(t, http.MethodPost, fmt.Sprintf("/api/channels/%d/messages", channelid),
+		map[string]any{"message": "hello?"}, "u1", "1", http.StatusForbidden)
+
+	resp := s.expectStatus(t, http.MethodGet, "/api/users/me/blocks", nil, "u3", "3", http.StatusOK)
+	blocked := struct {
+		Blocked []User `json:"blocked"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&blocked); err != nil {
+		t.Fatalf("error decoding blocked users. Err: %v", err)
+	}
+	if len(blocked.Blocked) != 1 || blocked.Blocked[0].UserID != 1 {
+		t.Fatalf("unexpected blocked users %+v", blocked.Blocked)
+	}
+
+	s.expectStatus(t, http.MethodDelete, "/api/users/me/blocks/1", nil, "u3", "3", http.StatusOK)
+	s.expectStatus(t, http.MethodPost, fmt.Sprintf("/api/channels/%d/messages", channelid),
+		map[string]any{"message": "hello?"}, "u1", "1", http.StatusOK)
+}
+
+func TestBlockUser_PreventsThreadReplies(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	channelid := s.createDM(t, map[string]any{"userids": []int{3}}, "u1", "1")
+	s.expectStatus(t, http.MethodPost, fmt.Sprintf("/api/channels/%d/messages", channelid),
+		map[string]any{"message": "hello"}, "u1", "1", http.StatusOK)
+	root := s.latestMessage(t, int(channelid))
+	s.expectStatus(t, http.MethodPut, "/api/users/me/blocks/1", nil, "u3", "3", http.StatusOK)
+
+	path := fmt.Sprintf("/api/channels/%d/messages/%d/thread", channelid, root.MessageID)
+	s.expectStatus(t, http.MethodPost, path, map[string]any{"message": "hello?"}, "u1", "1", http.StatusForbidden)
+	s.expectStatus(t, http.MethodPost, path, map[string]any{"message": "hello?"}, "u3", "3", http.StatusForbidden)
+}
+
+func TestBlockUser_PreventsUploads(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	channelid := s.createDM(t, map[string]any{"userids": []int{3}}, "u1", "1")
+	s.expectStatus(t, http.MethodPut, "/api/users/me/blocks/1", nil, "u3", "3", http.StatusOK)
+
+	resp, err := s.uploadFiles(int(channelid), "look", map[string][]byte{"a.txt": []byte("hello")}, "u1", "1")
+	if err != nil {
+		t.Fatalf("error uploading files. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected status Forbidden; got %v", resp.Status)
+	}
+}
+
+func TestBlockUser_FlagsMessages(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	s.expectStatus(t, http.MethodPut, "/api/users/me/blocks/1", nil, "u2", "2", http.StatusOK)
+	for _, user := range []struct {
+		name     string
+		password string
+		blocked  bool
+	}{{"u2", "2", true}, {"u1", "1", false}} {
+		resp := s.expectStatus(t, http.MethodGet, "/api/channels/1/messages", nil, user.name, user.password, http.StatusOK)
+		result := struct {
+			Messages []ServerMessage `json:"messages"`
+		}{}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatalf("error decoding messages. Err: %v", err)
+		}
+		if len(result.Messages) == 0 {
+			t.Fatalf("expected messages in channel")
+		}
+		for _, message := range result.Messages {
+			if message.Blocked != (user.blocked && message.UserId == 1) {
+				t.Fatalf("%s: unexpected blocked flag on %+v", user.name, message)
+			}
+		}
+	}
+}
+
+func TestPresenceAudience_ExcludesBlocked(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	if err := s.db.BlockUser(1, 3); err != nil {
+		t.Fatalf("BlockUser: err: %v", err)
+	}
+	audience := s.app.presenceAudience(1)
+	if len(audience) != 1 || audience[0] != 2 {
+		t.Fatalf("expected only user 2 in audience; got %v", audience)
+	}
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"go-chat-react/internal/database"
+)
+
+const (
+	maxNicknameLength = 32
+	nameHistoryCount  = 20
+)
+
+type MemberInfo struct {
+	UserID      database.Id `json:"userid"`
+	UserName    string      `json:"username"`
+	Nickname    string      `json:"nickname,omitempty"`
+	DisplayName string      `json:"display_name"`
+	AvatarURL   string      `json:"avatar_url,omitempty"`
+}
+
+type NameHistoryEntry struct {
+	Name      string `json:"name"`
+	Timestamp string `json:"timestamp"`
+}
+
+func fromDBMemberToMemberInfo(member database.ServerMember) MemberInfo {
+	return MemberInfo{
+		UserID:      member.UserId,
+		UserName:    member.UserName,
+		Nickname:    member.Nickname,
+		DisplayName: member.EffectiveName,
+		AvatarURL:   avatarURL(member.User),
+	}
+}
+
+// UpdateOwnNickname sets the caller's nickname in a server. An empty
+// nickname clears it.
+func (s *Server) UpdateOwnNickname(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.updateNickname(w, r, userid, userid)
+}
+
+// UpdateMemberNickname lets the server owner change the nickname of any
+// member. Members may also use it for themselves.
+func (s *Server) UpdateMemberNickname(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	target, err := parsePathFromID(r, "userid")
+	if err != nil {
+		http.Error(w, "invalid request: unable to parse user id", http.StatusBadRequest)
+		return
+	}
+	s.updateNickname(w, r, userid, target)
+}
+
+func (s *Server) updateNickname(
+	w http.ResponseWriter,
+	r *http.Request,
+	userid database.Id,
+	target database.Id,
+) {
+	serverid, err := parsePathFromID(r, "serverid")
+	if err != nil {
+		http.Error(w, "invalid request: unable to parse server id", http.StatusBadRequest)
+		return
+	}
+	server, err := s.db.GetServer(serverid)
+	if err != nil {
+		http.Error(w, "error: unable to locate server", http.StatusNotFound)
+		return
+	}
+	ismember, err := s.db.IsUserInServer(userid, serverid)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if !ismember {
+		http.Error(w, "error: unable to locate server", http.StatusNotFound)
+		return
+	}
+	if target != userid && server.OwnerId != userid {
+		http.Error(w, "error: only the server owner can change nicknames of others", http.StatusForbidden)
+		return
+	}
+	request := struct {
+		Nickname string `json:"nickname"`
+	}{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	nickname, err := validateProfileText("nickname", request.Nickname, maxNicknameLength, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	previous, _ := s.getServerMember(serverid, target)
+	err = s.db.UpdateUserNickname(target, serverid, nickname)
+	if errors.Is(err, database.ErrRecordNotFound) {
+		http.Error(w, "error: user not member of server", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "error: unable to update nickname", http.StatusInternalServerError)
+		return
+	}
+	member, err := s.getServerMember(serverid, target)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if target != userid && nickname != previous.Nickname {
+		s.recordAudit(r, database.AuditEntry{
+			ServerId:   serverid,
+			Action:     auditNicknameUpdate,
+			TargetType: database.AuditTargetMember,
+			TargetId:   target,
+			Before:     map[string]any{"nickname": previous.Nickname},
+			After:      map[string]any{"nickname": nickname},
+		})
+	}
+	info := fromDBMemberToMemberInfo(member)
+	byte_data, err := newServerResponse("member_updated", map[string]any{
+		"serverid": serverid,
+		"member":   info,
+	})
+	if err == nil {
+		s.broadcastToServer(serverid, byte_data)
+	}
+	writeJSON(w, info)
+}
+
+func (s *Server) getServerMember(serverid database.Id, userid database.Id) (database.ServerMember, error) {
+	members, err := s.db.GetServerMembers(serverid)
+	if err != nil {
+		return database.ServerMember{}, err
+	}
+	for _, member := range members {
+		if member.UserId == userid {
+			return member, nil
+		}
+	}
+	return database.ServerMember{}, database.ErrRecordNotFound
+}
+
+// GetNicknameHistory lists the previous nicknames of a member, visible to
+// everyone in the server.
+func (s *Server) GetNicknameHistory(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	serverid, err := parsePathFromID(r, "serverid")
+	if err != nil {
+		http.Error(w, "invalid request: unable to parse server id", http.StatusBadRequest)
+		return
+	}
+	target, err := parsePathFromID(r, "userid")
+	if err != nil {
+		http.Error(w, "invalid request: unable to parse user id", http.StatusBadRequest)
+		return
+	}
+	ismember, err := s.db.IsUserInServer(userid, serverid)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if !ismember {
+		http.Error(w, "error: unable to locate server", http.StatusNotFound)
+		return
+	}
+	entries, err := s.db.GetRecentNicknames(target, serverid, nameHistoryCount)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	history := make([]NameHistoryEntry, len(entries))
+	for i, entry := range entries {
+		history[i] = NameHistoryEntry{Name: entry.Nickname, Timestamp: entry.Timestamp.String()}
+	}
+	writeJSON(w, map[string]any{"userid": target, "serverid": serverid, "nicknames": history})
+}
+
+func (s *Server) GetUsernameHistory(w http.ResponseWriter, r *http.Request) {
+	userid, err := parsePathFromID(r, "userid")
+	if err != nil {
+		http.Error(w, "invalid request: unable to parse user id", http.StatusBadRequest)
+		return
+	}
+	if _, err := s.db.GetUser(userid); err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	entries, err := s.db.GetRecentUsernames(userid, nameHistoryCount)
+	if err != nil {
+		log.Printf("GetUsernameHistory: unable to fetch history of %d: %v", userid, err)
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	history := make([]NameHistoryEntry, len(entries))
+	for i, entry := range entries {
+		history[i] = NameHistoryEntry{Name: entry.Username, Timestamp: entry.Timestamp.String()}
+	}
+	writeJSON(w, map[string]any{"userid": userid, "usernames": history})
+}
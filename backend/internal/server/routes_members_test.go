@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestUpdateNickname(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	resp := s.expectStatus(t, http.MethodPatch, "/api/servers/1/members/me/nickname",
+		map[string]any{"nickname": " Third "}, "u3", "3", http.StatusOK)
+	member := MemberInfo{}
+	if err := json.NewDecoder(resp.Body).Decode(&member); err != nil {
+		t.Fatalf("error decoding member. Err: %v", err)
+	}
+	if member.UserID != 3 || member.Nickname != "Third" || member.DisplayName != "Third" {
+		t.Fatalf("unexpected member %+v", member)
+	}
+
+	// only the owner may change the nickname of someone else
+	s.expectStatus(t, http.MethodPatch, "/api/servers/1/members/1/nickname",
+		map[string]any{"nickname": "boss"}, "u3", "3", http.StatusForbidden)
+	s.expectStatus(t, http.MethodPatch, "/api/servers/1/members/3/nickname",
+		map[string]any{"nickname": ""}, "u1", "1", http.StatusOK)
+	s.expectStatus(t, http.MethodPatch, "/api/servers/1/members/2/nickname",
+		map[string]any{"nickname": "x"}, "u1", "1", http.StatusNotFound)
+	s.expectStatus(t, http.MethodPatch, "/api/servers/2/members/me/nickname",
+		map[string]any{"nickname": "x"}, "u3", "3", http.StatusNotFound)
+
+	resp = s.expectStatus(t, http.MethodGet, "/api/servers/1/members", nil, "u1", "1", http.StatusOK)
+	members := struct {
+		Users []MemberInfo `json:"users"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&members); err != nil {
+		t.Fatalf("error decoding members. Err: %v", err)
+	}
+	for _, member := range members.Users {
+		if member.UserID == 3 && (member.Nickname != "" || member.DisplayName != "u3") {
+			t.Fatalf("expected cleared nickname; got %+v", member)
+		}
+	}
+
+	resp = s.expectStatus(t, http.MethodGet, "/api/servers/1/members/3/nicknames", nil, "u1", "1", http.StatusOK)
+	history := struct {
+		Nicknames []NameHistoryEntry `json:"nicknames"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		t.Fatalf("error decoding history. Err: %v", err)
+	}
+	if len(history.Nicknames) < 2 || history.Nicknames[0].Name != "" || history.Nicknames[1].Name != "Third" {
+		t.Fatalf("unexpected nickname history %+v", history.Nicknames)
+	}
+	s.expectStatus(t, http.MethodGet, "/api/servers/1/members/3/nicknames", nil, "u2", "2", http.StatusNotFound)
+}
+
+func TestMessageDisplayName(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	s.expectStatus(t, http.MethodPatch, "/api/servers/1/members/me/nickname",
+		map[string]any{"nickname": "First"}, "u1", "1", http.StatusOK)
+	resp := s.expectStatus(t, http.MethodGet, "/api/channels/1/messages", nil, "u1", "1", http.StatusOK)
+	result := struct {
+		Messages []ServerMessage `json:"messages"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("error decoding messages. Err: %v", err)
+	}
+	for _, message := range result.Messages {
+		if message.UserId == 1 && message.DisplayName != "First" {
+			t.Fatalf("expected display name First; got %+v", message)
+		}
+	}
+}
+
+func TestGetUsernameHistory(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	resp := s.expectStatus(t, http.MethodGet, "/api/users/3/usernames", nil, "u1", "1", http.StatusOK)
+	history := struct {
+		Usernames []NameHistoryEntry `json:"usernames"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		t.Fatalf("error decoding history. Err: %v", err)
+	}
+	if len(history.Usernames) != 2 || history.Usernames[0].Name != "u3" {
+		t.Fatalf("unexpected username history %+v", history.Usernames)
+	}
+	s.expectStatus(t, http.MethodGet, "/api/users/99/usernames", nil, "u1", "1", http.StatusNotFound)
+}
@@ -0,0 +1,306 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-chat-react/internal/database"
+)
+
+const (
+	maxRestrictionDuration     = 28 * 24 * time.Hour
+	maxRestrictionReasonLength = 512
+)
+
+// restriction kinds, as shown to clients
+const (
+	restrictionTimeout = "timeout"
+	restrictionMute    = "mute"
+)
+
+type RestrictionInfo struct {
+	RestrictionID database.Id  `json:"restrictionid"`
+	Kind          string       `json:"kind"`
+	ServerID      database.Id  `json:"serverid"`
+	ChannelID     *database.Id `json:"channelid,omitempty"`
+	UserID        database.Id  `json:"userid"`
+	ModeratorID   database.Id  `json:"moderatorid"`
+	Reason        string       `json:"reason,omitempty"`
+	Expires       time.Time    `json:"expires"`
+	Created       time.Time    `json:"created"`
+}
+
+func fromDBRestriction(restriction database.Restriction) RestrictionInfo {
+	info := RestrictionInfo{
+		RestrictionID: restriction.RestrictionId,
+		Kind:          restrictionTimeout,
+		ServerID:      restriction.ServerId,
+		UserID:        restriction.UserId,
+		ModeratorID:   restriction.ModeratorId,
+		Reason:        restriction.Reason,
+		Expires:       restriction.Expires.UTC(),
+		Created:       restriction.Created,
+	}
+	if restriction.ChannelId != 0 {
+		info.Kind = restrictionMute
+		info.ChannelID = &restriction.ChannelId
+	}
+	return info
+}
+
+// restrictedError rejects a message from a member who is timed out or
+// muted. It tells them until when, and why when a reason was given.
+type restrictedError struct {
+	restriction database.Restriction
+}
+
+func (e *restrictedError) Error() string {
+	where := "timed out in this server"
+	if e.restriction.ChannelId != 0 {
+		where = "muted in this channel"
+	}
+	message := fmt.Sprintf("error: you are %s until %s", where, e.restriction.Expires.UTC().Format(time.RFC3339))
+	if e.restriction.Reason != "" {
+		message += ": " + e.restriction.Reason
+	}
+	return message
+}
+
+// checkRestriction rejects messages from members who are timed out in the
+// server of a channel or muted in the channel.
+func (s *Server) checkRestriction(userid database.Id, channelid database.Id) error {
+	restriction, err := s.db.GetPostingRestriction(userid, channelid, time.Now())
+	if errors.Is(err, database.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return &restrictedError{restriction: restriction}
+}
+
+// writeRestrictionError answers a request rejected by checkRestriction.
+func writeRestrictionError(w http.ResponseWriter, err error) {
+	var restricted *restrictedError
+	if errors.As(err, &restricted) {
+		http.Error(w, restricted.Error(), http.StatusForbidden)
+		return
+	}
+	http.Error(w, "database error", http.StatusInternalServerError)
+}
+
+// sendRestrictionUpdate tells the sessions of the member that a restriction
+// was placed on them or lifted.
+func (s *Server) sendRestrictionUpdate(message_type string, restriction database.Restriction) {
+	byte_data, err := newServerResponse(message_type, fromDBRestriction(restriction))
+	if err != nil {
+		log.Printf("sendRestrictionUpdate: error marshalling %s: %v", message_type, err)
+		return
+	}
+	s.sendToUser(restriction.UserId, byte_data)
+}
+
+// GetRestrictions lists the timeouts and mutes of a server that have not
+// expired yet.
+func (s *Server) GetRestrictions(w http.ResponseWriter, r *http.Request) {
+	server, errorInfo, err := s.getManagedServer(r)
+	if err != nil {
+		http.Error(w, errorInfo.Message, errorInfo.StatusCode)
+		return
+	}
+	restrictions, err := s.db.GetActiveRestrictions(server.ServerId, time.Now())
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	infos := make([]RestrictionInfo, 0, len(restrictions))
+	for _, restriction := range restrictions {
+		infos = append(infos, fromDBRestriction(restriction))
+	}
+	writeJSON(w, map[string]any{"restrictions": infos})
+}
+
+// CreateRestriction times a member out of a server, or mutes them in one
+// channel when a channelid is given, for a duration such as "10m" or "2d".
+// Restricting a member again in the same place replaces the restriction.
+func (s *Server) CreateRestriction(w http.ResponseWriter, r *http.Request) {
+	server, errorInfo, err := s.getManagedServer(r)
+	if err != nil {
+		http.Error(w, errorInfo.Message, errorInfo.StatusCode)
+		return
+	}
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	request := struct {
+		UserId    database.Id `json:"userid"`
+		ChannelId database.Id `json:"channelid"`
+		Duration  string      `json:"duration"`
+		Reason    string      `json:"reason"`
+	}{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	duration, err := parseCommandDuration(request.Duration)
+	if err != nil || duration <= 0 || duration > maxRestrictionDuration {
+		http.Error(w, "error: duration must be between 1s and 28d, such as 10m or 2d", http.StatusBadRequest)
+		return
+	}
+	reason := strings.TrimSpace(request.Reason)
+	if len(reason) > maxRestrictionReasonLength {
+		http.Error(w, "error: reason too long", http.StatusBadRequest)
+		return
+	}
+	if request.UserId == server.OwnerId {
+		http.Error(w, "error: the server owner cannot be restricted", http.StatusBadRequest)
+		return
+	}
+	member, err := s.db.IsUserInServer(request.UserId, server.ServerId)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if !member {
+		http.Error(w, "error: user not member of server", http.StatusNotFound)
+		return
+	}
+	if request.ChannelId != 0 {
+		channel, err := s.db.GetChannel(request.ChannelId)
+		if err != nil || channel.ServerId != server.ServerId {
+			http.Error(w, "error: unable to locate channel", http.StatusNotFound)
+			return
+		}
+	}
+	now := time.Now()
+	restrictionid, err := s.db.SetRestriction(database.Restriction{
+		ServerId:    server.ServerId,
+		ChannelId:   request.ChannelId,
+		UserId:      request.UserId,
+		ModeratorId: userid,
+		Reason:      reason,
+		Expires:     now.Add(duration),
+	}, now)
+	if err != nil {
+		http.Error(w, "error: unable to restrict member", http.StatusInternalServerError)
+		return
+	}
+	restriction, err := s.db.GetRestriction(restrictionid)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	info := fromDBRestriction(restriction)
+	action := auditMemberTimeout
+	if restriction.ChannelId != 0 {
+		action = auditMemberMute
+	}
+	s.recordAudit(r, database.AuditEntry{
+		ServerId:   server.ServerId,
+		Action:     action,
+		TargetType: database.AuditTargetMember,
+		TargetId:   restriction.UserId,
+		After:      restrictionAuditValues(restriction),
+		Reason:     reason,
+	})
+	s.sendRestrictionUpdate("member_restricted", restriction)
+	writeJSON(w, map[string]any{"restriction": info})
+}
+
+// DeleteRestriction lifts a timeout or mute before it expires.
+func (s *Server) DeleteRestriction(w http.ResponseWriter, r *http.Request) {
+	server, errorInfo, err := s.getManagedServer(r)
+	if err != nil {
+		http.Error(w, errorInfo.Message, errorInfo.StatusCode)
+		return
+	}
+	restrictionid, err := parsePathFromID(r, "restrictionid")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	restriction, err := s.db.GetRestriction(restrictionid)
+	if err == nil && (restriction.ServerId != server.ServerId || !restriction.Expires.After(time.Now())) {
+		err = database.ErrRecordNotFound
+	}
+	if errors.Is(err, database.ErrRecordNotFound) {
+		http.Error(w, "error: restriction not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.db.DeleteRestriction(restriction.RestrictionId); err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	s.recordAudit(r, database.AuditEntry{
+		ServerId:   server.ServerId,
+		Action:     auditRestrictLift,
+		TargetType: database.AuditTargetMember,
+		TargetId:   restriction.UserId,
+		Before:     restrictionAuditValues(restriction),
+	})
+	s.sendRestrictionUpdate("member_restriction_lifted", restriction)
+	writeJSON(w, map[string]any{"restrictionid": restriction.RestrictionId})
+}
+
+// restrictionAuditValues are the details of a restriction recorded in the
+// audit log.
+func restrictionAuditValues(restriction database.Restriction) map[string]any {
+	info := fromDBRestriction(restriction)
+	values := map[string]any{"kind": info.Kind, "expires": info.Expires}
+	if info.ChannelID != nil {
+		values["channelid"] = *info.ChannelID
+	}
+	return values
+}
+
+// rejectedMessageError is returned by ProcessMessage for a message its
+// user may not post in the channel, because they are restricted or blocked.
+type rejectedMessageError struct {
+	channelid database.Id
+	err       error
+}
+
+func (e *rejectedMessageError) Error() string { return e.err.Error() }
+
+func (e *rejectedMessageError) Unwrap() error { return e.err }
+
+// rejectedMessage marks err as the reason a message to channelid was not
+// posted. Other errors, such as database failures, are returned unchanged.
+func rejectedMessage(channelid database.Id, err error) error {
+	var restricted *restrictedError
+	if errors.As(err, &restricted) || errors.Is(err, errMessageBlocked) {
+		return &rejectedMessageError{channelid: channelid, err: err}
+	}
+	return err
+}
+
+// rejectMessage tells the connection that sent a message over the
+// websocket that it was not posted, and until when for restrictions.
+func (s *Server) rejectMessage(connid string, rejected *rejectedMessageError) {
+	data := map[string]any{
+		"channelid": rejected.channelid,
+		"message":   rejected.Error(),
+	}
+	var restricted *restrictedError
+	if errors.As(rejected, &restricted) {
+		data["expires"] = restricted.restriction.Expires.UTC()
+	}
+	byte_data, err := newServerResponse("message_rejected", data)
+	if err != nil {
+		log.Printf("rejectMessage: error marshalling message_rejected: %v", err)
+		return
+	}
+	s.ws_manager.SendToClient(connid, byte_data)
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go-chat-react/internal/database"
+	"go-chat-react/internal/websocket"
+)
+
+func (s *TestServer) restrict(t *testing.T, payload map[string]any) RestrictionInfo {
+	resp := s.expectStatus(t, http.MethodPost, "/api/servers/1/restrictions", payload, "u1", "1", http.StatusOK)
+	result := struct {
+		Restriction RestrictionInfo `json:"restriction"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("error decoding restriction. Err: %v", err)
+	}
+	return result.Restriction
+}
+
+func (s *TestServer) restrictions(t *testing.T) []RestrictionInfo {
+	resp := s.expectStatus(t, http.MethodGet, "/api/servers/1/restrictions", nil, "u1", "1", http.StatusOK)
+	result := struct {
+		Restrictions []RestrictionInfo `json:"restrictions"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("error decoding restrictions. Err: %v", err)
+	}
+	return result.Restrictions
+}
+
+func TestRestriction_MuteBlocksChannel(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+
+	mute := s.restrict(t, map[string]any{"userid": 3, "channelid": 2, "duration": "10m", "reason": "spam"})
+	if mute.Kind != restrictionMute || mute.ChannelID == nil || *mute.ChannelID != 2 || mute.ModeratorID != 1 {
+		t.Fatalf("unexpected mute %+v", mute)
+	}
+	if until := time.Until(mute.Expires); until < 9*time.Minute || until > 10*time.Minute {
+		t.Errorf("expected the mute to expire in 10 minutes; got %v", mute.Expires)
+	}
+
+	resp := s.expectStatus(t, http.MethodPost, "/api/channels/2/messages", map[string]any{"message": "hi"}, "u3", "3", http.StatusForbidden)
+	body, _ := io.ReadAll(resp.Body)
+	expires := mute.Expires.Format(time.RFC3339)
+	if !strings.Contains(string(body), "muted in this channel until "+expires+": spam") {
+		t.Errorf("expected the error to name the expiry and reason; got %q", body)
+	}
+	s.expectStatus(t, http.MethodPost, "/api/channels/2/messages/4/thread", map[string]any{"message": "hi"}, "u3", "3", http.StatusForbidden)
+	// nor can existing messages be edited into new ones
+	s.expectStatus(t, http.MethodPatch, "/api/channels/2/messages/4", map[string]any{"message": "edited"}, "u3", "3", http.StatusForbidden)
+	if message, err := s.db.GetMessage(4); err != nil || message.Contents == "edited" {
+		t.Fatalf("expected message 4 to be unchanged; got %+v err: %v", message, err)
+	}
+
+	s.expectStatus(t, http.MethodDelete, fmt.Sprintf("/api/servers/1/restrictions/%d", mute.RestrictionID), nil, "u1", "1", http.StatusOK)
+	s.expectStatus(t, http.MethodDelete, fmt.Sprintf("/api/servers/1/restrictions/%d", mute.RestrictionID), nil, "u1", "1", http.StatusNotFound)
+	s.expectStatus(t, http.MethodPost, "/api/channels/2/messages", map[string]any{"message": "hi"}, "u3", "3", http.StatusOK)
+
+	entries := s.auditLog(t, "")
+	if len(entries) != 2 || entries[0].Action != auditRestrictLift || entries[1].Action != auditMemberMute {
+		t.Fatalf("expected the mute and its lift to be audited; got %v", auditActionsOf(entries))
+	}
+	if entries[1].TargetID != 3 || entries[1].Reason != "spam" || entries[1].After["channelid"] != float64(2) {
+		t.Errorf("unexpected mute entry %+v", entries[1])
+	}
+}
+
+func TestRestriction_TimeoutBlocksSocket(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+
+	timeout := s.restrict(t, map[string]any{"userid": 3, "duration": "1d"})
+	if timeout.Kind != restrictionTimeout || timeout.ChannelID != nil {
+		t.Fatalf("unexpected timeout %+v", timeout)
+	}
+	if list := s.restrictions(t); len(list) != 1 || list[0].RestrictionID != timeout.RestrictionID {
+		t.Fatalf("expected the timeout to be listed; got %+v", list)
+	}
+
+	payload, _ := json.Marshal(map[string]any{
+		"message_type": "channel_message",
+		"payload":      map[string]any{"channel_id": 2, "message": "hi"},
+	})
+	_, data, err := s.app.ProcessMessage(context.Background(), 3, websocket.IncomingMessage{Payload: payload})
+	var restricted *restrictedError
+	if !errors.As(err, &restricted) || data != nil {
+		t.Fatalf("expected the message to be rejected; got %s err: %v", data, err)
+	}
+	if !strings.Contains(err.Error(), "timed out in this server until "+timeout.Expires.Format(time.RFC3339)) {
+		t.Errorf("unexpected rejection %q", err)
+	}
+
+	// restrictions lift once they expire
+	db := s.app.db
+	_, err = db.SetRestriction(database.Restriction{
+		ServerId: 1, UserId: 3, ModeratorId: 1, Expires: time.Now().Add(-time.Second),
+	}, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := s.restrictions(t); len(list) != 0 {
+		t.Fatalf("expected expired restrictions to be hidden; got %+v", list)
+	}
+	if _, _, err := s.app.ProcessMessage(context.Background(), 3, websocket.IncomingMessage{Payload: payload}); err != nil {
+		t.Fatalf("expected the timeout to have lifted; err: %v", err)
+	}
+}
+
+func TestRestriction_Validation(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+
+	path := "/api/servers/1/restrictions"
+	cases := []struct {
+		payload map[string]any
+		status  int
+	}{
+		{map[string]any{"userid": 3, "duration": "0s"}, http.StatusBadRequest},
+		{map[string]any{"userid": 3, "duration": "29d"}, http.StatusBadRequest},
+		{map[string]any{"userid": 3, "duration": "soon"}, http.StatusBadRequest},
+		{map[string]any{"userid": 1, "duration": "1h"}, http.StatusBadRequest},
+		{map[string]any{"userid": 2, "duration": "1h"}, http.StatusNotFound},
+		{map[string]any{"userid": 3, "channelid": 3, "duration": "1h"}, http.StatusNotFound},
+	}
+	for _, c := range cases {
+		s.expectStatus(t, http.MethodPost, path, c.payload, "u1", "1", c.status)
+	}
+	// only the owner moderates
+	s.expectStatus(t, http.MethodPost, path, map[string]any{"userid": 1, "duration": "1h"}, "u3", "3", http.StatusForbidden)
+	s.expectStatus(t, http.MethodGet, path, nil, "u3", "3", http.StatusForbidden)
+}
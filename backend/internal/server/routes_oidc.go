@@ -0,0 +1,290 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"go-chat-react/internal/database"
+	"go-chat-react/internal/oidc"
+)
+
+const (
+	tokenPurposeOIDCState = "oidc_state"
+	oidcStateCookie       = "oidc_state"
+	// oidcLoginLifetime is how long users have to sign in at the provider
+	oidcLoginLifetime     = 10 * time.Minute
+	maxProvisionedNameLen = 24
+)
+
+var errEmailOwnedByUnverifiedAccount = errors.New(
+	"an account with this email address exists but has not verified it, sign in with your password and verify it first",
+)
+
+var errEmailOwnedByTwoFactorAccount = errors.New(
+	"an account with this email address uses two-factor authentication, sign in with your password and code instead",
+)
+
+// oidcLogin is the state of a login in progress, kept in a signed cookie
+// between the start and callback requests.
+type oidcLogin struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Expires  int64  `json:"expires"`
+}
+
+func (s *Server) getOIDCProvider(w http.ResponseWriter, r *http.Request) (*oidc.Provider, bool) {
+	provider, ok := s.oidcProviders[r.PathValue("provider")]
+	if !ok {
+		http.Error(w, "error: unknown identity provider", http.StatusNotFound)
+	}
+	return provider, ok
+}
+
+// ssoFailed sends the browser back to the login page of the web client with
+// an explanation.
+func (s *Server) ssoFailed(w http.ResponseWriter, r *http.Request, message string) {
+	target := fmt.Sprintf("%s/login?sso_error=%s", strings.TrimSuffix(s.appURL, "/"), url.QueryEscape(message))
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+func (s *Server) GetOIDCProviders(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(s.oidcProviders))
+	for name := range s.oidcProviders {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	writeJSON(w, map[string]any{"providers": names})
+}
+
+// StartOIDCLogin redirects the browser to the identity provider.
+func (s *Server) StartOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := s.getOIDCProvider(w, r)
+	if !ok {
+		return
+	}
+	login := oidcLogin{Provider: provider.Name(), Expires: time.Now().Add(oidcLoginLifetime).Unix()}
+	var err error
+	if login.State, err = oidc.NewState(); err == nil {
+		if login.Nonce, err = oidc.NewState(); err == nil {
+			login.Verifier, err = oidc.NewVerifier()
+		}
+	}
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	authURL, err := provider.AuthCodeURL(r.Context(), login.State, login.Nonce, login.Verifier)
+	if err != nil {
+		log.Printf("StartOIDCLogin: %v", err)
+		http.Error(w, "error: identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+	data, err := json.Marshal(login)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    s.authTokens.sign(tokenPurposeOIDCState, base64.RawURLEncoding.EncodeToString(data)),
+		Path:     "/api/auth/oidc/",
+		MaxAge:   int(oidcLoginLifetime / time.Second),
+		HttpOnly: true,
+		// lax so the cookie comes along on the redirect back from the provider
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// readOIDCLogin returns the login started in this browser, if it is still
+// valid for the provider.
+func (s *Server) readOIDCLogin(r *http.Request, provider string) (oidcLogin, error) {
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		return oidcLogin{}, errors.New("no login in progress")
+	}
+	payload, err := s.authTokens.verify(tokenPurposeOIDCState, cookie.Value)
+	if err != nil {
+		return oidcLogin{}, err
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return oidcLogin{}, errInvalidAuthToken
+	}
+	var login oidcLogin
+	if err := json.Unmarshal(data, &login); err != nil {
+		return oidcLogin{}, errInvalidAuthToken
+	}
+	if login.Provider != provider || time.Now().Unix() > login.Expires {
+		return oidcLogin{}, errInvalidAuthToken
+	}
+	return login, nil
+}
+
+// OIDCCallback completes a login at an identity provider. The provider
+// account signs in the user it is linked to; otherwise it is linked to the
+// user with the same verified email address or a new user is created.
+// Accounts with two-factor authentication are never linked this way, since
+// that would skip their second factor; once linked, two-factor
+// authentication is left to the identity provider.
+func (s *Server) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := s.getOIDCProvider(w, r)
+	if !ok {
+		return
+	}
+	login, err := s.readOIDCLogin(r, provider.Name())
+	// the login is over either way
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/auth/oidc/", MaxAge: -1, HttpOnly: true})
+	if err != nil {
+		s.ssoFailed(w, r, "sign in expired, please try again")
+		return
+	}
+	query := r.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(login.State)) != 1 {
+		s.ssoFailed(w, r, "sign in expired, please try again")
+		return
+	}
+	if query.Get("error") != "" {
+		s.ssoFailed(w, r, "sign in was cancelled or denied")
+		return
+	}
+	claims, err := provider.Exchange(r.Context(), query.Get("code"), login.Verifier, login.Nonce)
+	if err != nil {
+		log.Printf("OIDCCallback: %s: %v", provider.Name(), err)
+		s.ssoFailed(w, r, "unable to verify sign in")
+		return
+	}
+	userid, err := s.resolveOIDCUser(provider.Name(), claims)
+	if errors.Is(err, errEmailOwnedByUnverifiedAccount) || errors.Is(err, errEmailOwnedByTwoFactorAccount) {
+		s.ssoFailed(w, r, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("OIDCCallback: %s: %v", provider.Name(), err)
+		s.ssoFailed(w, r, "unable to sign in")
+		return
+	}
+	if _, err := s.createSession(w, userid); err != nil {
+		s.ssoFailed(w, r, "unable to sign in")
+		return
+	}
+	http.Redirect(w, r, s.appURL, http.StatusFound)
+}
+
+func (s *Server) resolveOIDCUser(provider string, claims oidc.Claims) (database.Id, error) {
+	userid, err := s.db.GetUserIDFromIdentity(provider, claims.Subject)
+	if err == nil {
+		return userid, nil
+	}
+	if !errors.Is(err, database.ErrRecordNotFound) {
+		return 0, err
+	}
+	email := ""
+	if claims.EmailVerified {
+		// addresses the rest of the server would not accept are not linked
+		email, _ = normalizeEmail(claims.Email)
+	}
+	if email != "" {
+		userid, err := s.db.GetUserIDFromEmail(email)
+		if err == nil {
+			current, err := s.db.GetUserEmail(userid)
+			if err != nil {
+				return 0, err
+			}
+			// an unverified address may have been typed in by anyone
+			if !current.Verified {
+				return 0, errEmailOwnedByUnverifiedAccount
+			}
+			twofactor, err := s.db.GetTwoFactor(userid)
+			if err != nil && !errors.Is(err, database.ErrRecordNotFound) {
+				return 0, err
+			}
+			if err == nil && twofactor.Enabled {
+				return 0, errEmailOwnedByTwoFactorAccount
+			}
+			return userid, s.db.LinkUserIdentity(userid, provider, claims.Subject)
+		}
+		if !errors.Is(err, database.ErrRecordNotFound) {
+			return 0, err
+		}
+	}
+	return s.provisionOIDCUser(provider, claims, email)
+}
+
+// provisionOIDCUser creates the user for a provider account signing in for
+// the first time. The user has no password until they choose one, and
+// confirms sensitive changes without it until then.
+func (s *Server) provisionOIDCUser(provider string, claims oidc.Claims, email string) (database.Id, error) {
+	password, err := oidc.NewState()
+	if err != nil {
+		return 0, err
+	}
+	base := provisionedUsername(claims)
+	var userid database.Id
+	for attempt := 1; ; attempt++ {
+		username := base
+		if attempt > 1 {
+			username = fmt.Sprintf("%s%d", base, attempt)
+		}
+		userid, err = s.db.CreateUser(username, password)
+		if !errors.Is(err, database.ErrRecordAlreadyExists) || attempt == 100 {
+			break
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	// the random password only satisfies CreateUser, nobody ever learns it
+	if err := s.db.RemoveUserPassword(userid); err != nil {
+		return 0, err
+	}
+	if email != "" {
+		if err := s.db.SetUserEmail(userid, email); err != nil {
+			return 0, err
+		}
+		if err := s.db.MarkEmailVerified(userid, email); err != nil {
+			return 0, err
+		}
+	}
+	if name, err := validateProfileText("display name", claims.Name, maxDisplayNameLength, false); err == nil && name != "" {
+		if err := s.db.UpdateUserProfile(userid, database.UserProfile{DisplayName: name}); err != nil {
+			return 0, err
+		}
+	}
+	return userid, s.db.LinkUserIdentity(userid, provider, claims.Subject)
+}
+
+// provisionedUsername picks a username for a new user from the claims of
+// their identity provider account.
+func provisionedUsername(claims oidc.Claims) string {
+	candidates := []string{claims.PreferredUsername, strings.Split(claims.Email, "@")[0], claims.Name}
+	for _, candidate := range candidates {
+		var name strings.Builder
+		for _, r := range strings.ToLower(candidate) {
+			switch {
+			case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+				name.WriteRune(r)
+			case r == ' ':
+				name.WriteRune('_')
+			}
+			if name.Len() == maxProvisionedNameLen {
+				break
+			}
+		}
+		if name.Len() > 0 {
+			return name.String()
+		}
+	}
+	return "user"
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go-chat-react/internal/database"
+	"go-chat-react/internal/oidc"
+	"go-chat-react/internal/oidc/oidctest"
+)
+
+func (s *TestServer) addOIDCProvider(t *testing.T) *oidctest.Provider {
+	mock, err := oidctest.NewProvider("chat", "secret")
+	if err != nil {
+		t.Fatalf("error starting identity provider. Err: %v", err)
+	}
+	t.Cleanup(mock.Close)
+	s.app.oidcProviders = map[string]*oidc.Provider{
+		"corp": oidc.NewProvider(oidc.Config{
+			Name:         "corp",
+			Issuer:       mock.Issuer(),
+			ClientID:     "chat",
+			ClientSecret: "secret",
+			RedirectURL:  s.server.URL + "/api/auth/oidc/corp/callback",
+		}, nil),
+	}
+	return mock
+}
+
+func (s *TestServer) noRedirectGet(t *testing.T, target string, cookies ...*http.Cookie) *http.Response {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	req, _ := http.NewRequest(http.MethodGet, target, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s: err: %v", target, err)
+	}
+	return resp
+}
+
+func responseCookie(resp *http.Response, name string) *http.Cookie {
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == name && cookie.MaxAge >= 0 {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// ssoLogin signs in at the mock provider as user and returns the response
+// to the callback along with the url it was called with.
+func (s *TestServer) ssoLogin(t *testing.T, mock *oidctest.Provider, user oidctest.User) (*http.Response, *url.URL) {
+	resp := s.noRedirectGet(t, s.server.URL+"/api/auth/oidc/corp/start")
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("expected redirect to provider; got %v", resp.Status)
+	}
+	state := responseCookie(resp, oidcStateCookie)
+	if state == nil {
+		t.Fatalf("expected state cookie")
+	}
+	callback, err := mock.Authorize(resp.Header.Get("Location"), user)
+	if err != nil {
+		t.Fatalf("error signing in at provider. Err: %v", err)
+	}
+	return s.noRedirectGet(t, callback.String(), state), callback
+}
+
+// expectSSOSession checks that a callback signed in a user and returns
+// their id.
+func (s *TestServer) expectSSOSession(t *testing.T, resp *http.Response) database.Id {
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != s.app.appURL {
+		t.Fatalf("expected redirect to the app; got %v to %s", resp.Status, resp.Header.Get("Location"))
+	}
+	session := responseCookie(resp, "token")
+	if session == nil {
+		t.Fatalf("expected session cookie")
+	}
+	req, _ := http.NewRequest(http.MethodPost, s.server.URL+"/api/auth/session", nil)
+	req.AddCookie(session)
+	sessionResp, err := s.server.Client().Do(req)
+	if err != nil || sessionResp.StatusCode != http.StatusOK {
+		t.Fatalf("expected session to be valid; got %v err: %v", sessionResp.Status, err)
+	}
+	body := struct {
+		UserId database.Id `json:"userid"`
+	}{}
+	if err := json.NewDecoder(sessionResp.Body).Decode(&body); err != nil {
+		t.Fatalf("error decoding session. Err: %v", err)
+	}
+	return body.UserId
+}
+
+func expectSSOError(t *testing.T, resp *http.Response) {
+	location := resp.Header.Get("Location")
+	if resp.StatusCode != http.StatusFound || !strings.Contains(location, "/login?sso_error=") {
+		t.Fatalf("expected redirect to login with error; got %v to %s", resp.Status, location)
+	}
+	if responseCookie(resp, "token") != nil {
+		t.Fatalf("expected no session cookie")
+	}
+}
+
+func TestOIDCLogin_ProvisionsUser(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	mock := s.addOIDCProvider(t)
+	user := oidctest.User{
+		Subject:           "s1",
+		Email:             "Alice@corp.example.com",
+		EmailVerified:     true,
+		Name:              "Alice Smith",
+		PreferredUsername: "alice",
+	}
+	resp, _ := s.ssoLogin(t, mock, user)
+	if userid := s.expectSSOSession(t, resp); userid != 4 {
+		t.Fatalf("expected new user 4; got %d", userid)
+	}
+	profile := s.getProfile(t, "4")
+	if profile.UserName != "alice" || profile.DisplayName != "Alice Smith" {
+		t.Fatalf("unexpected provisioned profile %+v", profile)
+	}
+	email, _ := s.db.GetUserEmail(4)
+	if email.Email != "alice@corp.example.com" || !email.Verified {
+		t.Fatalf("expected verified email; got %+v", email)
+	}
+	// later logins reuse the linked user
+	resp, _ = s.ssoLogin(t, mock, user)
+	if userid := s.expectSSOSession(t, resp); userid != 4 {
+		t.Fatalf("expected user 4 again; got %d", userid)
+	}
+}
+
+func TestOIDCLogin_LinksByVerifiedEmail(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	mock := s.addOIDCProvider(t)
+	resp, _ := s.ssoLogin(t, mock, oidctest.User{Subject: "s1", Email: "u1@example.com", EmailVerified: true})
+	if userid := s.expectSSOSession(t, resp); userid != 1 {
+		t.Fatalf("expected link to user 1; got %d", userid)
+	}
+	// u2 never verified their address, so it cannot be claimed
+	resp, _ = s.ssoLogin(t, mock, oidctest.User{Subject: "s2", Email: "u2@example.com", EmailVerified: true})
+	expectSSOError(t, resp)
+	// nor can addresses the provider has not verified
+	resp, _ = s.ssoLogin(t, mock, oidctest.User{Subject: "s3", Email: "u1@example.com", PreferredUsername: "u1"})
+	if userid := s.expectSSOSession(t, resp); userid == 1 {
+		t.Fatalf("expected unverified address to create a new user")
+	}
+}
+
+func TestOIDCLogin_KeepsSecondFactor(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	mock := s.addOIDCProvider(t)
+	s.enableTwoFactor(t)
+	resp, _ := s.ssoLogin(t, mock, oidctest.User{Subject: "s1", Email: "u1@example.com", EmailVerified: true})
+	expectSSOError(t, resp)
+	if _, err := s.db.GetUserIDFromIdentity("corp", "s1"); !errors.Is(err, database.ErrRecordNotFound) {
+		t.Fatalf("expected the identity to stay unlinked; got %v", err)
+	}
+}
+
+func TestOIDCLogin_ProvisionedUserHasNoPassword(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	mock := s.addOIDCProvider(t)
+	resp, _ := s.ssoLogin(t, mock, oidctest.User{Subject: "s1", PreferredUsername: "alice"})
+	s.expectSSOSession(t, resp)
+	if _, err := s.getLoginCookie("alice", ""); err == nil {
+		t.Fatalf("expected password login to fail without a password")
+	}
+	// there is no current password to give when choosing the first one
+	body := strings.NewReader(`{"new_password": "a new passphrase"}`)
+	req, _ := http.NewRequest(http.MethodPost, s.server.URL+"/api/users/me/password", body)
+	req.AddCookie(responseCookie(resp, "token"))
+	changed, err := s.server.Client().Do(req)
+	if err != nil || changed.StatusCode != http.StatusOK {
+		t.Fatalf("expected password to be set; got %v err: %v", changed.Status, err)
+	}
+	if _, err := s.getLoginCookie("alice", "a new passphrase"); err != nil {
+		t.Fatalf("error logging in with new password. Err: %v", err)
+	}
+	s.expectStatus(t, http.MethodDelete, "/api/users/me",
+		map[string]any{"password": ""}, "alice", "a new passphrase", http.StatusForbidden)
+	s.expectStatus(t, http.MethodDelete, "/api/users/me",
+		map[string]any{"password": "a new passphrase"}, "alice", "a new passphrase", http.StatusOK)
+}
+
+func TestOIDCLogin_RejectsBadState(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	mock := s.addOIDCProvider(t)
+
+	resp := s.noRedirectGet(t, s.server.URL+"/api/auth/oidc/corp/start")
+	state := responseCookie(resp, oidcStateCookie)
+	callback, err := mock.Authorize(resp.Header.Get("Location"), oidctest.User{Subject: "s1"})
+	if err != nil {
+		t.Fatalf("error signing in at provider. Err: %v", err)
+	}
+	expectSSOError(t, s.noRedirectGet(t, callback.String()))
+
+	query := callback.Query()
+	query.Set("state", "forged")
+	forged := *callback
+	forged.RawQuery = query.Encode()
+	expectSSOError(t, s.noRedirectGet(t, forged.String(), state))
+
+	tampered := *state
+	tampered.Value = "x" + state.Value
+	expectSSOError(t, s.noRedirectGet(t, callback.String(), &tampered))
+
+	if resp := s.noRedirectGet(t, s.server.URL+"/api/auth/oidc/other/start"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected unknown provider to 404; got %v", resp.Status)
+	}
+}
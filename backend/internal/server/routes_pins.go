@@ -0,0 +1,192 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"go-chat-react/internal/database"
+)
+
+const maxPinLimit = 250
+
+const pinNoticeContents = "pinned a message to this channel."
+
+type PinnedServerMessage struct {
+	ServerMessage
+	PinnedBy database.Id `json:"pinned_by"`
+	PinnedAt string      `json:"pinned_at"`
+}
+
+type PinEvent struct {
+	ChannelId database.Id `json:"channelid"`
+	ServerId  database.Id `json:"serverid"`
+	MessageID database.Id `json:"messageid"`
+	UserId    database.Id `json:"userid"`
+}
+
+// getPinTargetFromRequest resolves the {channelid}/{messageid} pair of a pin
+// route and checks that the caller is a member of the channel.
+func (s *Server) getPinTargetFromRequest(
+	r *http.Request,
+	userid database.Id,
+) (database.Message, httpErrorInfo, error) {
+	channelid, err := parsePathFromID(r, "channelid")
+	if err != nil {
+		return database.Message{}, httpErrorInfo{http.StatusBadRequest, err.Error()}, err
+	}
+	messageid, err := parsePathFromID(r, "messageid")
+	if err != nil {
+		return database.Message{}, httpErrorInfo{http.StatusBadRequest, err.Error()}, err
+	}
+	inchannel, err := s.db.IsUserInChannel(userid, channelid)
+	if err != nil {
+		return database.Message{}, httpErrorInfo{
+			http.StatusBadRequest,
+			fmt.Sprintf("error: %s", err),
+		}, err
+	}
+	if !inchannel {
+		err = errors.New("user not in channel")
+		return database.Message{}, httpErrorInfo{http.StatusBadRequest, err.Error()}, err
+	}
+	message, err := s.db.GetMessage(messageid)
+	if errors.Is(err, database.ErrRecordNotFound) ||
+		(err == nil && message.ChannelId != channelid) {
+		err = errors.New("error: unable to locate message")
+		return database.Message{}, httpErrorInfo{http.StatusNotFound, err.Error()}, err
+	}
+	if err != nil {
+		return database.Message{}, httpErrorInfo{
+			http.StatusInternalServerError,
+			"error: unable to fetch message",
+		}, err
+	}
+	return message, httpErrorInfo{}, nil
+}
+
+func (s *Server) GetChannelPins(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	channelid, err := parsePathFromID(r, "channelid")
+	if err != nil {
+		http.Error(w, "invalid request: unable to parse channel id", http.StatusBadRequest)
+		return
+	}
+	inchannel, err := s.db.IsUserInChannel(userid, channelid)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error: %s", err), http.StatusBadRequest)
+		return
+	}
+	if !inchannel {
+		http.Error(w, "user not in channel", http.StatusBadRequest)
+		return
+	}
+	pins, err := s.db.GetPinnedMessages(channelid)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	payload := make([]PinnedServerMessage, len(pins))
+	for i, pin := range pins {
+		payload[i] = PinnedServerMessage{
+			ServerMessage: fromDBMessageToSeverMessage(pin.Message),
+			PinnedBy:      pin.PinnedBy,
+			PinnedAt:      pin.PinnedAt.Format(time.UnixDate),
+		}
+	}
+	writeJSON(w, map[string]any{"channelid": channelid, "pins": payload})
+}
+
+func (s *Server) PinMessage(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	message, errInfo, err := s.getPinTargetFromRequest(r, userid)
+	if err != nil {
+		http.Error(w, errInfo.Message, errInfo.StatusCode)
+		return
+	}
+	if message.Type != database.MessageTypeDefault {
+		http.Error(w, "error: unable to pin system message", http.StatusBadRequest)
+		return
+	}
+	err = s.db.PinMessage(message.ChannelId, message.MessageId, userid)
+	if errors.Is(err, database.ErrRecordAlreadyExists) {
+		http.Error(w, "error: message already pinned", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, database.ErrLimitReached) {
+		http.Error(w, "error: channel pin limit reached", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "error: unable to pin message", http.StatusBadRequest)
+		return
+	}
+
+	noticeid, err := s.db.CreateMessage(database.NewMessage{
+		ChannelId: message.ChannelId,
+		UserId:    userid,
+		Contents:  pinNoticeContents,
+		ReplyToId: &message.MessageId,
+		Type:      database.MessageTypePin,
+	})
+	if err != nil {
+		log.Printf("PinMessage: unable to create pin notice: %v", err)
+	} else if notice, err := s.db.GetMessage(noticeid); err == nil {
+		if byte_data, err := newServerResponse("message", fromDBMessageToSeverMessage(notice)); err == nil {
+			s.broadcastToChannel(notice.ServerId, notice.ChannelId, byte_data)
+		}
+		s.publishEvent(notice.ServerId, eventMessageCreated, fromDBMessageToSeverMessage(notice))
+	}
+	s.broadcastPinEvent("message_pinned", message, userid)
+}
+
+func (s *Server) UnpinMessage(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	message, errInfo, err := s.getPinTargetFromRequest(r, userid)
+	if err != nil {
+		http.Error(w, errInfo.Message, errInfo.StatusCode)
+		return
+	}
+	err = s.db.UnpinMessage(message.ChannelId, message.MessageId)
+	if errors.Is(err, database.ErrRecordNotFound) {
+		http.Error(w, "error: message not pinned", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "error: unable to unpin message", http.StatusBadRequest)
+		return
+	}
+	s.broadcastPinEvent("message_unpinned", message, userid)
+}
+
+func (s *Server) broadcastPinEvent(
+	message_type string,
+	message database.Message,
+	userid database.Id,
+) {
+	byte_data, err := newServerResponse(message_type, PinEvent{
+		ChannelId: message.ChannelId,
+		ServerId:  message.ServerId,
+		MessageID: message.MessageId,
+		UserId:    userid,
+	})
+	if err != nil {
+		log.Printf("broadcastPinEvent: error marshalling event: %v", err)
+		return
+	}
+	s.broadcastToChannel(message.ServerId, message.ChannelId, byte_data)
+}
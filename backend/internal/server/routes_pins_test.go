@@ -0,0 +1,132 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"go-chat-react/internal/database"
+)
+
+func TestPinMessage_Valid(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	resp, err := s.sendAuthRequest(http.MethodPut, "/api/channels/1/pins/2", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error sending request. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status OK; got %v", resp.Status)
+	}
+
+	resp, err = s.sendAuthRequest(http.MethodGet, "/api/channels/1/pins", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error sending request. Err: %v", err)
+	}
+	result := struct {
+		Pins []PinnedServerMessage `json:"pins"`
+	}{}
+	body, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Fatalf("error unmarshalling response body. Err: %v", err)
+	}
+	if len(result.Pins) != 1 {
+		t.Fatalf("expected 1 pin; got %d", len(result.Pins))
+	}
+	if result.Pins[0].MessageID != 2 || result.Pins[0].PinnedBy != 1 {
+		t.Fatalf("unexpected pin %+v", result.Pins[0])
+	}
+
+	// a notice referencing the pinned message is posted in the channel
+	resp, err = s.sendAuthRequest(http.MethodGet, "/api/channels/1/messages?count=1", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error sending request. Err: %v", err)
+	}
+	history := struct {
+		Messages []ServerMessage `json:"messages"`
+	}{}
+	body, _ = io.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &history); err != nil {
+		t.Fatalf("error unmarshalling response body. Err: %v", err)
+	}
+	if len(history.Messages) != 1 || history.Messages[0].Type != database.MessageTypePin {
+		t.Fatalf("expected pin notice; got %+v", history.Messages)
+	}
+	if history.Messages[0].ReplyTo == nil || history.Messages[0].ReplyTo.MessageID != 2 {
+		t.Fatalf("expected pin notice to reference message 2")
+	}
+
+	resp, err = s.sendAuthRequest(http.MethodPut, "/api/channels/1/pins/2", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error sending request. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status BadRequest; got %v", resp.Status)
+	}
+}
+
+func TestPinMessage_WrongChannel(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	// message 3 belongs to channel 3
+	resp, err := s.sendAuthRequest(http.MethodPut, "/api/channels/1/pins/3", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error sending request. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status NotFound; got %v", resp.Status)
+	}
+}
+
+func TestPinMessage_Limit(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	resp, err := s.sendAuthJSON(
+		http.MethodPatch,
+		"/api/channels/1",
+		map[string]any{"pinlimit": 1},
+		nil,
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("error sending request. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status OK; got %v", resp.Status)
+	}
+	resp, err = s.sendAuthRequest(http.MethodPut, "/api/channels/1/pins/1", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error sending request. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status OK; got %v", resp.Status)
+	}
+	resp, err = s.sendAuthRequest(http.MethodPut, "/api/channels/1/pins/2", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error sending request. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status BadRequest; got %v", resp.Status)
+	}
+}
+
+func TestUnpinMessage(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	resp, err := s.sendAuthRequest(http.MethodDelete, "/api/channels/1/pins/1", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error sending request. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status BadRequest; got %v", resp.Status)
+	}
+	s.sendAuthRequest(http.MethodPut, "/api/channels/1/pins/1", nil, nil, nil)
+	resp, err = s.sendAuthRequest(http.MethodDelete, "/api/channels/1/pins/1", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error sending request. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status OK; got %v", resp.Status)
+	}
+}
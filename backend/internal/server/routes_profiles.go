@@ -0,0 +1,302 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"go-chat-react/internal/database"
+	"go-chat-react/internal/media"
+	"go-chat-react/internal/storage"
+)
+
+const (
+	maxDisplayNameLength = 32
+	maxBioLength         = 190
+	maxPronounsLength    = 40
+	maxAvatarUploadSize  = 8 << 20
+	// avatars are stored as squares of this many pixels per side
+	avatarSize = 256
+)
+
+var bannerColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+type UserProfile struct {
+	UserID      database.Id `json:"userid"`
+	UserName    string      `json:"username"`
+	DisplayName string      `json:"display_name"`
+	AvatarURL   string      `json:"avatar_url,omitempty"`
+	BannerColor string      `json:"banner_color,omitempty"`
+	Bio         string      `json:"bio"`
+	Pronouns    string      `json:"pronouns"`
+	Bot         bool        `json:"bot,omitempty"`
+}
+
+// avatarURL returns the public URL of a user's avatar. The URL names the
+// stored blob so a new upload also changes the URL, letting clients cache
+// avatars indefinitely.
+func avatarURL(user database.User) string {
+	if user.AvatarKey == "" {
+		return ""
+	}
+	return fmt.Sprintf("/api/users/%d/avatar/%s", user.UserId, path.Base(user.AvatarKey))
+}
+
+func fromDBUserToProfile(user database.User) UserProfile {
+	return UserProfile{
+		UserID:      user.UserId,
+		UserName:    user.UserName,
+		DisplayName: user.DisplayName,
+		AvatarURL:   avatarURL(user),
+		BannerColor: user.BannerColor,
+		Bio:         user.Bio,
+		Pronouns:    user.Pronouns,
+		Bot:         user.IsBot,
+	}
+}
+
+// validateProfileText trims a profile field and checks its length in
+// characters. Newlines are only accepted where multiline is set.
+func validateProfileText(field string, value string, maxLength int, multiline bool) (string, error) {
+	value = strings.TrimSpace(value)
+	if !utf8.ValidString(value) {
+		return "", fmt.Errorf("error: %s is not valid text", field)
+	}
+	if utf8.RuneCountInString(value) > maxLength {
+		return "", fmt.Errorf("error: %s too long", field)
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) && !(multiline && r == '\n') {
+			return "", fmt.Errorf("error: %s contains invalid characters", field)
+		}
+	}
+	return value, nil
+}
+
+// UpdateProfile applies a partial update to the caller's profile. Fields
+// left out of the request keep their value; empty strings clear them.
+func (s *Server) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	request := struct {
+		DisplayName *string `json:"display_name"`
+		BannerColor *string `json:"banner_color"`
+		Bio         *string `json:"bio"`
+		Pronouns    *string `json:"pronouns"`
+	}{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	user, err := s.db.GetUser(userid)
+	if err != nil {
+		http.Error(w, "error: unable to fetch user", http.StatusInternalServerError)
+		return
+	}
+	profile := database.UserProfile{
+		DisplayName: user.DisplayName,
+		BannerColor: user.BannerColor,
+		Bio:         user.Bio,
+		Pronouns:    user.Pronouns,
+	}
+	if request.DisplayName != nil {
+		profile.DisplayName, err = validateProfileText("display name", *request.DisplayName, maxDisplayNameLength, false)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if request.Bio != nil {
+		profile.Bio, err = validateProfileText("bio", *request.Bio, maxBioLength, true)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if request.Pronouns != nil {
+		profile.Pronouns, err = validateProfileText("pronouns", *request.Pronouns, maxPronounsLength, false)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if request.BannerColor != nil {
+		if *request.BannerColor != "" && !bannerColorPattern.MatchString(*request.BannerColor) {
+			http.Error(w, "error: banner color must be of the form #rrggbb", http.StatusBadRequest)
+			return
+		}
+		profile.BannerColor = strings.ToLower(*request.BannerColor)
+	}
+	err = s.db.UpdateUserProfile(userid, profile)
+	if err != nil {
+		http.Error(w, "error: unable to update profile", http.StatusInternalServerError)
+		return
+	}
+	s.writeUpdatedProfile(w, userid)
+}
+
+// UploadAvatar replaces the caller's avatar with the uploaded image, cropped
+// to a square and scaled down to avatarSize.
+func (s *Server) UploadAvatar(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxAvatarUploadSize+(1<<20))
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		http.Error(w, "error: unable to parse upload", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxAvatarUploadSize+1))
+	if err != nil {
+		http.Error(w, "error: unable to read upload", http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxAvatarUploadSize {
+		http.Error(w, "error: file too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	avatar, err := media.Avatar(http.DetectContentType(data), data, avatarSize)
+	if err != nil {
+		http.Error(w, "error: avatar must be a png, jpeg or gif image", http.StatusBadRequest)
+		return
+	}
+	user, err := s.db.GetUser(userid)
+	if err != nil {
+		http.Error(w, "error: unable to fetch user", http.StatusInternalServerError)
+		return
+	}
+	key := fmt.Sprintf("avatars/%d/%s", userid, uuid.New().String())
+	err = s.blobs.Put(r.Context(), key, bytes.NewReader(avatar), int64(len(avatar)), "image/png")
+	if err != nil {
+		log.Printf("UploadAvatar: unable to store avatar of %d: %v", userid, err)
+		http.Error(w, "error: unable to store avatar", http.StatusInternalServerError)
+		return
+	}
+	err = s.db.SetUserAvatar(userid, key)
+	if err != nil {
+		s.deleteBlob(r.Context(), key)
+		http.Error(w, "error: unable to update avatar", http.StatusInternalServerError)
+		return
+	}
+	if user.AvatarKey != "" {
+		s.deleteBlob(r.Context(), user.AvatarKey)
+	}
+	s.writeUpdatedProfile(w, userid)
+}
+
+func (s *Server) DeleteAvatar(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	user, err := s.db.GetUser(userid)
+	if err != nil {
+		http.Error(w, "error: unable to fetch user", http.StatusInternalServerError)
+		return
+	}
+	if user.AvatarKey == "" {
+		http.Error(w, "error: no avatar set", http.StatusNotFound)
+		return
+	}
+	err = s.db.SetUserAvatar(userid, "")
+	if err != nil {
+		http.Error(w, "error: unable to update avatar", http.StatusInternalServerError)
+		return
+	}
+	s.deleteBlob(r.Context(), user.AvatarKey)
+	s.writeUpdatedProfile(w, userid)
+}
+
+// DownloadAvatar serves the current avatar of a user. Old avatar URLs stop
+// resolving once the avatar is replaced.
+func (s *Server) DownloadAvatar(w http.ResponseWriter, r *http.Request) {
+	userid, err := parsePathFromID(r, "userid")
+	if err != nil {
+		http.Error(w, "invalid request: unable to parse user id", http.StatusBadRequest)
+		return
+	}
+	user, err := s.db.GetUser(userid)
+	if errors.Is(err, database.ErrRecordNotFound) {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	avatarid := r.PathValue("avatarid")
+	if user.AvatarKey == "" || path.Base(user.AvatarKey) != avatarid {
+		http.Error(w, "error: unable to locate avatar", http.StatusNotFound)
+		return
+	}
+	etag := strconv.Quote(avatarid)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	blob, err := s.blobs.Get(r.Context(), user.AvatarKey)
+	if errors.Is(err, storage.ErrBlobNotFound) {
+		http.Error(w, "error: unable to locate avatar", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "error: unable to read avatar", http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, blob); err != nil {
+		log.Printf("DownloadAvatar: failed to write response: %v", err)
+	}
+}
+
+func (s *Server) deleteBlob(ctx context.Context, key string) {
+	err := s.blobs.Delete(ctx, key)
+	if err != nil && !errors.Is(err, storage.ErrBlobNotFound) {
+		log.Printf("deleteBlob: unable to delete %s: %v", key, err)
+	}
+}
+
+// writeUpdatedProfile responds with the current profile of a user and
+// pushes it as a user_updated event to the user and everyone sharing a
+// server with them.
+func (s *Server) writeUpdatedProfile(w http.ResponseWriter, userid database.Id) {
+	user, err := s.db.GetUser(userid)
+	if err != nil {
+		http.Error(w, "error: unable to fetch user", http.StatusInternalServerError)
+		return
+	}
+	profile := fromDBUserToProfile(user)
+	if byte_data, err := newServerResponse("user_updated", profile); err == nil {
+		s.sendToUser(userid, byte_data)
+		for _, peer := range s.serverPeers(userid) {
+			s.sendToUser(peer, byte_data)
+		}
+	}
+	writeJSON(w, profile)
+}
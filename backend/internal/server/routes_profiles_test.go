@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"testing"
+)
+
+func (s *TestServer) getProfile(t *testing.T, userid string) UserProfile {
+	resp, err := s.sendRequest(http.MethodGet, "/api/users/"+userid, nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("error getting profile. Err: %v", err)
+	}
+	profile := UserProfile{}
+	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
+		t.Fatalf("error decoding profile. Err: %v", err)
+	}
+	return profile
+}
+
+func (s *TestServer) uploadAvatar(t *testing.T, data []byte) *http.Response {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("avatar", "me.png")
+	part.Write(data)
+	writer.Close()
+	req, err := http.NewRequest(http.MethodPut, s.server.URL+"/api/users/me/avatar", &body)
+	if err != nil {
+		t.Fatalf("error building request. Err: %v", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	cookie, err := s.getLoginCookie("u1", "1")
+	if err != nil {
+		t.Fatalf("error logging in. Err: %v", err)
+	}
+	req.AddCookie(cookie)
+	resp, err := s.server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("error uploading avatar. Err: %v", err)
+	}
+	return resp
+}
+
+func TestUpdateProfile_Valid(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	s.expectStatus(t, http.MethodPatch, "/api/users/me/profile", map[string]any{
+		"display_name": "  User One ",
+		"banner_color": "#AABBCC",
+		"bio":          "line one\nline two",
+		"pronouns":     "they/them",
+	}, "u1", "1", http.StatusOK)
+	s.expectStatus(t, http.MethodPatch, "/api/users/me/profile",
+		map[string]any{"pronouns": ""}, "u1", "1", http.StatusOK)
+
+	profile := s.getProfile(t, "1")
+	if profile.UserName != "u1" || profile.DisplayName != "User One" || profile.BannerColor != "#aabbcc" {
+		t.Fatalf("unexpected profile %+v", profile)
+	}
+	if profile.Bio != "line one\nline two" || profile.Pronouns != "" {
+		t.Fatalf("unexpected profile %+v", profile)
+	}
+}
+
+func TestUpdateProfile_Invalid(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	for _, payload := range []map[string]any{
+		{"display_name": string(bytes.Repeat([]byte("a"), maxDisplayNameLength+1))},
+		{"display_name": "two\nlines"},
+		{"banner_color": "red"},
+		{"bio": string(bytes.Repeat([]byte("a"), maxBioLength+1))},
+	} {
+		s.expectStatus(t, http.MethodPatch, "/api/users/me/profile", payload, "u1", "1", http.StatusBadRequest)
+	}
+}
+
+func TestUploadAvatar(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewNRGBA(image.Rect(0, 0, 600, 300))); err != nil {
+		t.Fatalf("error encoding image. Err: %v", err)
+	}
+	if resp := s.uploadAvatar(t, img.Bytes()); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status OK; got %v", resp.Status)
+	}
+	first := s.getProfile(t, "1").AvatarURL
+	if first == "" {
+		t.Fatalf("expected avatar url")
+	}
+	resp, err := s.sendRequest(http.MethodGet, first, nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("error downloading avatar. Err: %v", err)
+	}
+	avatar, err := png.Decode(resp.Body)
+	if err != nil {
+		t.Fatalf("error decoding avatar. Err: %v", err)
+	}
+	if avatar.Bounds().Dx() != avatarSize || avatar.Bounds().Dy() != avatarSize {
+		t.Fatalf("expected %dpx square avatar; got %v", avatarSize, avatar.Bounds())
+	}
+
+	s.uploadAvatar(t, img.Bytes())
+	if resp, _ := s.sendRequest(http.MethodGet, first, nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected replaced avatar to be gone; got %v", resp.Status)
+	}
+	if resp := s.uploadAvatar(t, []byte("not an image")); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status BadRequest; got %v", resp.Status)
+	}
+
+	s.expectStatus(t, http.MethodDelete, "/api/users/me/avatar", nil, "u1", "1", http.StatusOK)
+	if profile := s.getProfile(t, "1"); profile.AvatarURL != "" {
+		t.Fatalf("expected avatar to be removed; got %+v", profile)
+	}
+}
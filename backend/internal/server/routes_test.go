@@ -2,21 +2,29 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"go-chat-react/internal/database"
+	"go-chat-react/internal/markdown"
+	"go-chat-react/internal/storage"
+	"go-chat-react/internal/unfurl"
 )
 
 var port = 8080
 
 type TestServer struct {
 	server *httptest.Server
+	db     *database.DBService
+	app    *Server
 }
 
 func setupTest(tb testing.TB) (*TestServer, func(tb testing.TB)) {
@@ -25,9 +33,36 @@ func setupTest(tb testing.TB) (*TestServer, func(tb testing.TB)) {
 		tb.Fatal("failed to create server")
 	}
 
-	s := Server{port: port, db: server}
+	s := &Server{
+		port:       port,
+		db:         server,
+		blobs:      storage.NewLocalStore(tb.TempDir()),
+		mailer:     &recordingMailer{},
+		authTokens: newTokenSigner([]byte("test secret")),
+		appURL:     "http://localhost:5173",
+		passwords:  newPasswordPolicy(defaultMinPasswordLength, []string{"password123"}),
+	}
+	s.thumbnails = newThumbnailWorker(s)
+	// tests unfurl links served by local httptest servers
+	s.previews = newLinkPreviewWorker(s, unfurl.NewFetcher(time.Second, true))
+	// deliveries are driven by calling process so tests control the clock
+	s.events = newEventDeliveryWorker(s, http.DefaultClient)
+	s.commands = newCommandRegistry(http.DefaultClient, nil)
+	s.reminders = newReminderWorker(s, reminderInterval)
+	ctx, cancel := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	for _, run := range []func(context.Context){s.thumbnails.Run, s.previews.Run} {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(ctx)
+		}()
+	}
 	httpserver := httptest.NewServer(s.RegisterRoutes(false))
-	return &TestServer{server: httpserver}, func(tb testing.TB) {
+	return &TestServer{server: httpserver, db: server, app: s}, func(tb testing.TB) {
+		httpserver.Close()
+		cancel()
+		workers.Wait()
 		server.Close()
 	}
 }
@@ -91,6 +126,43 @@ func (s *TestServer) sendAuthRequest(
 	return s.server.Client().Do(session)
 }
 
+// sendAuthJSON behaves like sendAuthRequest but accepts any JSON payload, for
+// endpoints that take non string fields.
+func (s *TestServer) sendAuthJSON(
+	method string,
+	endpoint string,
+	payload any,
+	usernameOverride *string,
+	passwordOverride *string,
+) (*http.Response, error) {
+	session, err := s.buildRequest(method, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	if payload != nil {
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal payload: %v", err)
+		}
+		session.Body = io.NopCloser(bytes.NewBuffer(jsonData))
+		session.ContentLength = int64(len(jsonData))
+	}
+	if usernameOverride == nil {
+		temp := "u1"
+		usernameOverride = &temp
+	}
+	if passwordOverride == nil {
+		temp := "1"
+		passwordOverride = &temp
+	}
+	cookie, err := s.getLoginCookie(*usernameOverride, *passwordOverride)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get login cookie: %v", err)
+	}
+	session.AddCookie(cookie)
+	return s.server.Client().Do(session)
+}
+
 // Function to perform login and retrieve the login cookie
 func (s *TestServer) getLoginCookie(username, password string) (*http.Cookie, error) {
 	loginReq := struct {
@@ -247,7 +319,7 @@ func TestCreateUser(t *testing.T) {
 	s, teardown := setupTest(t)
 	defer teardown(t)
 	endpoint := "/api/users"
-	payload := map[string]string{"username": "new_user", "password": "new_user_password"}
+	payload := map[string]string{"username": "new_user", "password": "correct horse battery"}
 	resp, _ := s.sendRequest(http.MethodPost, endpoint, payload)
 	// Assertions
 	if resp.StatusCode != http.StatusOK {
@@ -1034,3 +1106,30 @@ func TestSession_Valid(t *testing.T) {
 		}
 	*/
 }
+
+func TestGetChannelMessages_AST(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	s.postMessage(t, "**hi** <b>there</b>")
+	resp, err := s.sendAuthRequest(http.MethodGet, "/api/channels/1/messages?count=1", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error getting messages. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status OK; got %v", resp.Status)
+	}
+	result := struct {
+		Messages []ServerMessage `json:"messages"`
+	}{}
+	body, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Fatalf("error unmarshalling response body. Err: %v", err)
+	}
+	if len(result.Messages) != 1 {
+		t.Fatalf("expected one message; got %d", len(result.Messages))
+	}
+	ast := result.Messages[0].AST
+	if len(ast) != 2 || ast[0].Type != markdown.TypeBold || ast[1].Content != " <b>there</b>" {
+		t.Fatalf("unexpected ast %+v", ast)
+	}
+}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"go-chat-react/internal/database"
+)
+
+type ThreadUpdate struct {
+	RootId     database.Id `json:"rootid"`
+	ChannelId  database.Id `json:"channelid"`
+	ServerId   database.Id `json:"serverid"`
+	ReplyCount uint        `json:"reply_count"`
+	LastReply  string      `json:"last_reply,omitempty"`
+}
+
+// getThreadRootFromRequest resolves the {channelid}/{messageid} pair of a
+// thread route, checking that the caller can read the channel and that the
+// message is a valid thread root.
+func (s *Server) getThreadRootFromRequest(
+	r *http.Request,
+	userid database.Id,
+) (database.Message, httpErrorInfo, error) {
+	channelid, err := parsePathFromID(r, "channelid")
+	if err != nil {
+		return database.Message{}, httpErrorInfo{http.StatusBadRequest, err.Error()}, err
+	}
+	messageid, err := parsePathFromID(r, "messageid")
+	if err != nil {
+		return database.Message{}, httpErrorInfo{http.StatusBadRequest, err.Error()}, err
+	}
+	inchannel, err := s.db.IsUserInChannel(userid, channelid)
+	if err != nil {
+		return database.Message{}, httpErrorInfo{
+			http.StatusBadRequest,
+			fmt.Sprintf("error: %s", err),
+		}, err
+	}
+	if !inchannel {
+		err = errors.New("user not in channel")
+		return database.Message{}, httpErrorInfo{http.StatusBadRequest, err.Error()}, err
+	}
+	root, err := s.db.GetMessage(messageid)
+	if errors.Is(err, database.ErrRecordNotFound) || (err == nil && root.ChannelId != channelid) {
+		err = errors.New("error: unable to locate message")
+		return database.Message{}, httpErrorInfo{http.StatusNotFound, err.Error()}, err
+	}
+	if err != nil {
+		return database.Message{}, httpErrorInfo{
+			http.StatusInternalServerError,
+			"error: unable to fetch message",
+		}, err
+	}
+	if root.ThreadId != nil {
+		err = errors.New("error: message is already part of a thread")
+		return database.Message{}, httpErrorInfo{http.StatusBadRequest, err.Error()}, err
+	}
+	return root, httpErrorInfo{}, nil
+}
+
+func (s *Server) GetThread(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	root, errInfo, err := s.getThreadRootFromRequest(r, userid)
+	if err != nil {
+		http.Error(w, errInfo.Message, errInfo.StatusCode)
+		return
+	}
+	count, err := parseCountFromQuery(r, 30)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	before, err := parseIDFromQuery(r, "before")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	messages, err := s.db.GetThreadMessages(root.MessageId, before, count)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	servermessages := fromDBMessagesToServerMessages(messages)
+	s.flagBlockedMessages(userid, servermessages)
+	resp := map[string]any{
+		"root":     fromDBMessageToSeverMessage(root),
+		"messages": servermessages,
+	}
+	writeJSON(w, resp)
+}
+
+func (s *Server) CreateThreadMessage(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	root, errInfo, err := s.getThreadRootFromRequest(r, userid)
+	if err != nil {
+		http.Error(w, errInfo.Message, errInfo.StatusCode)
+		return
+	}
+	if err := s.checkDirectMessageBlock(userid, root.ChannelId); err != nil {
+		http.Error(w, "error: unable to message user", http.StatusForbidden)
+		return
+	}
+	if err := s.checkRestriction(userid, root.ChannelId); err != nil {
+		writeRestrictionError(w, err)
+		return
+	}
+	message_data := struct {
+		Message string       `json:"message"`
+		ReplyTo *database.Id `json:"reply_to"`
+	}{}
+	err = json.NewDecoder(r.Body).Decode(&message_data)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	if len(message_data.Message) > maxMessageLength {
+		http.Error(w, "error: message too long", http.StatusBadRequest)
+		return
+	}
+	if message_data.ReplyTo != nil {
+		err = s.validateReplyTarget(root.ChannelId, &root.MessageId, *message_data.ReplyTo)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	messageid, err := s.db.CreateMessage(database.NewMessage{
+		ChannelId: root.ChannelId,
+		UserId:    userid,
+		Contents:  message_data.Message,
+		ReplyToId: message_data.ReplyTo,
+		ThreadId:  &root.MessageId,
+	})
+	if err != nil {
+		http.Error(w, "error: unable to create message", http.StatusBadRequest)
+		return
+	}
+	s.previews.Enqueue(messageid, message_data.Message)
+	// both the thread starter and anyone who replies are subscribed so they
+	// are notified of later replies
+	for _, follower := range []database.Id{root.UserId, userid} {
+		if err := s.db.FollowThread(root.MessageId, follower); err != nil {
+			log.Printf("CreateThreadMessage: unable to follow thread %d: %v", root.MessageId, err)
+		}
+	}
+	s.notifyThread(root.MessageId, messageid, userid)
+
+	resp := map[string]any{
+		"messageid": messageid,
+	}
+	writeJSON(w, resp)
+}
+
+// notifyThread pushes a new thread reply to every follower except its author
+// and an updated reply count to everyone connected to the server.
+func (s *Server) notifyThread(rootid database.Id, messageid database.Id, authorid database.Id) {
+	dbmsg, err := s.db.GetMessage(messageid)
+	if err != nil {
+		log.Printf("notifyThread: unable to fetch message %d: %v", messageid, err)
+		return
+	}
+	followers, err := s.db.GetThreadFollowers(rootid)
+	if err != nil {
+		log.Printf("notifyThread: unable to fetch followers of %d: %v", rootid, err)
+		return
+	}
+	s.publishEvent(dbmsg.ServerId, eventMessageCreated, fromDBMessageToSeverMessage(dbmsg))
+	byte_data, err := newServerResponse("thread_message", fromDBMessageToSeverMessage(dbmsg))
+	if err != nil {
+		log.Printf("notifyThread: error marshalling message: %v", err)
+		return
+	}
+	for _, follower := range followers {
+		if follower != authorid {
+			s.sendToUser(follower, byte_data)
+		}
+	}
+
+	root, err := s.db.GetMessage(rootid)
+	if err != nil || root.Thread == nil {
+		return
+	}
+	update := ThreadUpdate{
+		RootId:     root.MessageId,
+		ChannelId:  root.ChannelId,
+		ServerId:   root.ServerId,
+		ReplyCount: root.Thread.ReplyCount,
+	}
+	if root.Thread.LastReply != nil {
+		update.LastReply = root.Thread.LastReply.Format(time.UnixDate)
+	}
+	byte_data, err = newServerResponse("thread_updated", update)
+	if err != nil {
+		log.Printf("notifyThread: error marshalling thread update: %v", err)
+		return
+	}
+	s.broadcastToChannel(root.ServerId, root.ChannelId, byte_data)
+}
+
+func (s *Server) FollowThread(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	root, errInfo, err := s.getThreadRootFromRequest(r, userid)
+	if err != nil {
+		http.Error(w, errInfo.Message, errInfo.StatusCode)
+		return
+	}
+	err = s.db.FollowThread(root.MessageId, userid)
+	if err != nil {
+		http.Error(w, "error: unable to follow thread", http.StatusBadRequest)
+		return
+	}
+}
+
+func (s *Server) UnfollowThread(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	root, errInfo, err := s.getThreadRootFromRequest(r, userid)
+	if err != nil {
+		http.Error(w, errInfo.Message, errInfo.StatusCode)
+		return
+	}
+	err = s.db.UnfollowThread(root.MessageId, userid)
+	if errors.Is(err, database.ErrRecordNotFound) {
+		http.Error(w, "error: not following thread", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "error: unable to unfollow thread", http.StatusBadRequest)
+		return
+	}
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go-chat-react/internal/database"
+	"go-chat-react/internal/storage"
+)
+
+func TestCreateChannelMessage_Reply(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	endpoint := "/api/channels/1/messages"
+	resp, err := s.sendAuthRequest(
+		http.MethodPost,
+		endpoint,
+		map[string]string{"message": "quoted"},
+		nil,
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("error sending request. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status OK; got %v", resp.Status)
+	}
+	created := struct {
+		MessageId uint `json:"messageid"`
+	}{}
+	body, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &created); err != nil {
+		t.Fatalf("error unmarshalling response body. Err: %v", err)
+	}
+
+	resp, err = s.sendAuthJSON(
+		http.MethodPost,
+		endpoint,
+		map[string]any{"message": "reply", "reply_to": created.MessageId},
+		nil,
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("error sending request. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status OK; got %v", resp.Status)
+	}
+	reply := struct {
+		MessageId uint `json:"messageid"`
+	}{}
+	body, _ = io.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &reply); err != nil {
+		t.Fatalf("error unmarshalling response body. Err: %v", err)
+	}
+
+	getresp, err := s.sendAuthRequest(
+		http.MethodGet,
+		"/api/channels/1/messages/"+strconv.Itoa(int(reply.MessageId)),
+		nil,
+		nil,
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("error getting message. Err: %v", err)
+	}
+	result := ServerMessage{}
+	body, _ = io.ReadAll(getresp.Body)
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Fatalf("error unmarshalling response body. Err: %v", err)
+	}
+	if result.ReplyTo == nil || result.ReplyTo.Message != "quoted" {
+		t.Fatalf("expected reply to quote parent; got %+v", result.ReplyTo)
+	}
+}
+
+func TestCreateChannelMessage_ReplyOtherChannel(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	// message 4 lives in channel 2
+	resp, err := s.sendAuthJSON(
+		http.MethodPost,
+		"/api/channels/1/messages",
+		map[string]any{"message": "reply", "reply_to": 4},
+		nil,
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("error sending request. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status BadRequest; got %v", resp.Status)
+	}
+}
+
+func TestThread_CreateAndList(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	endpoint := "/api/channels/1/messages/1/thread"
+	for _, message := range []string{"first", "second", "third"} {
+		resp, err := s.sendAuthRequest(
+			http.MethodPost,
+			endpoint,
+			map[string]string{"message": message},
+			nil,
+			nil,
+		)
+		if err != nil {
+			t.Fatalf("error sending request. Err: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status OK; got %v", resp.Status)
+		}
+	}
+
+	resp, err := s.sendAuthRequest(http.MethodGet, endpoint+"?count=2", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error sending request. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status OK; got %v", resp.Status)
+	}
+	result := struct {
+		Root     ServerMessage   `json:"root"`
+		Messages []ServerMessage `json:"messages"`
+	}{}
+	body, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Fatalf("error unmarshalling response body. Err: %v", err)
+	}
+	if result.Root.Thread == nil || result.Root.Thread.ReplyCount != 3 {
+		t.Fatalf("expected root with 3 replies; got %+v", result.Root.Thread)
+	}
+	if len(result.Messages) != 2 || result.Messages[0].Message != "third" {
+		t.Fatalf("unexpected thread page %+v", result.Messages)
+	}
+
+	resp, err = s.sendAuthRequest(
+		http.MethodGet,
+		endpoint+"?before="+strconv.Itoa(int(result.Messages[1].MessageID)),
+		nil,
+		nil,
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("error sending request. Err: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Fatalf("error unmarshalling response body. Err: %v", err)
+	}
+	if len(result.Messages) != 1 || result.Messages[0].Message != "first" {
+		t.Fatalf("unexpected second thread page %+v", result.Messages)
+	}
+
+	// replies are kept out of the channel history
+	resp, err = s.sendAuthRequest(http.MethodGet, "/api/channels/1/messages", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error sending request. Err: %v", err)
+	}
+	channel := struct {
+		Messages []struct {
+			ThreadId *uint
+		} `json:"messages"`
+	}{}
+	body, _ = io.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &channel); err != nil {
+		t.Fatalf("error unmarshalling response body. Err: %v", err)
+	}
+	for _, message := range channel.Messages {
+		if message.ThreadId != nil {
+			t.Fatalf("thread reply returned in channel history")
+		}
+	}
+}
+
+func TestThread_NotInChannel(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	username := "u3"
+	password := "3"
+	resp, err := s.sendAuthRequest(
+		http.MethodGet,
+		"/api/channels/1/messages/1/thread",
+		nil,
+		&username,
+		&password,
+	)
+	if err != nil {
+		t.Fatalf("error sending request. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status BadRequest; got %v", resp.Status)
+	}
+}
+
+func TestThread_FollowUnfollow(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	endpoint := "/api/channels/1/messages/1/thread/follow"
+	resp, err := s.sendAuthRequest(http.MethodPut, endpoint, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error sending request. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status OK; got %v", resp.Status)
+	}
+	resp, err = s.sendAuthRequest(http.MethodDelete, endpoint, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error sending request. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status OK; got %v", resp.Status)
+	}
+	resp, err = s.sendAuthRequest(http.MethodDelete, endpoint, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error sending request. Err: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status BadRequest; got %v", resp.Status)
+	}
+}
+
+func TestThread_DeleteRoot(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	resp := s.expectStatus(t, http.MethodPost, "/api/channels/1/messages/1/thread",
+		map[string]any{"message": "reply"}, "u2", "2", http.StatusOK)
+	created := struct {
+		MessageId database.Id `json:"messageid"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("error decoding reply. Err: %v", err)
+	}
+	ctx := context.Background()
+	if err := s.app.blobs.Put(ctx, "reply-file", strings.NewReader("data"), 4, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := s.db.CreateAttachment(database.Attachment{
+		ChannelId:   1,
+		UserId:      2,
+		MessageId:   &created.MessageId,
+		FileName:    "a.txt",
+		ContentType: "text/plain",
+		Size:        4,
+		StorageKey:  "reply-file",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.expectStatus(t, http.MethodDelete, "/api/channels/1/messages/1", nil, "u1", "1", http.StatusOK)
+	s.expectStatus(t, http.MethodGet, "/api/channels/1/messages/1/thread", nil, "u1", "1", http.StatusNotFound)
+	if _, err := s.db.GetMessage(created.MessageId); !errors.Is(err, database.ErrRecordNotFound) {
+		t.Fatalf("expected the reply to be deleted with its root; got %v", err)
+	}
+	if _, err := s.app.blobs.Get(ctx, "reply-file"); !errors.Is(err, storage.ErrBlobNotFound) {
+		t.Fatalf("expected the attachment of the reply to be deleted; got %v", err)
+	}
+}
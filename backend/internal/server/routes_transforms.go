@@ -1,17 +1,123 @@
 package server
 
 import (
+	"fmt"
 	"time"
 
 	"go-chat-react/internal/database"
 )
 
 func fromDBMessageToSeverMessage(message database.Message) ServerMessage {
-	return ServerMessage{
-		UserId:    message.UserId,
-		ChannelId: message.ChannelId,
-		MessageID: message.MessageId,
-		Message:   message.Contents,
-		Date:      message.Timestamp.Format(time.UnixDate),
+	smsg := ServerMessage{
+		UserId:      message.UserId,
+		ChannelId:   message.ChannelId,
+		ServerId:    message.ServerId,
+		MessageID:   message.MessageId,
+		Message:     message.Contents,
+		Date:        message.Timestamp.Format(time.UnixDate),
+		Type:        message.Type,
+		DisplayName: message.AuthorName,
+		ThreadId:    message.ThreadId,
+		AST:         message.AST,
 	}
+	if message.ReplyTo != nil {
+		smsg.ReplyTo = &MessageReply{
+			MessageID: message.ReplyTo.MessageId,
+			UserId:    message.ReplyTo.UserId,
+			Message:   message.ReplyTo.Contents,
+			Deleted:   message.ReplyTo.Deleted,
+		}
+	}
+	for _, attachment := range message.Attachments {
+		smsg.Attachments = append(smsg.Attachments, fromDBAttachmentToAttachmentInfo(attachment))
+	}
+	for _, embed := range message.Embeds {
+		smsg.Embeds = append(smsg.Embeds, EmbedInfo{
+			URL:         embed.URL,
+			Title:       embed.Title,
+			Description: embed.Description,
+			SiteName:    embed.SiteName,
+			ImageURL:    embed.ImageURL,
+		})
+	}
+	if message.Webhook != nil {
+		smsg.Webhook = &WebhookAuthorInfo{
+			WebhookID: message.Webhook.WebhookId,
+			AvatarURL: message.Webhook.AvatarURL,
+		}
+		if message.Webhook.UserName != "" {
+			smsg.DisplayName = message.Webhook.UserName
+		}
+		for _, embed := range message.Webhook.Embeds {
+			smsg.Embeds = append(smsg.Embeds, fromDBRichEmbedToEmbedInfo(embed))
+		}
+	}
+	if message.Thread != nil {
+		smsg.Thread = &ThreadInfo{ReplyCount: message.Thread.ReplyCount}
+		if message.Thread.LastReply != nil {
+			smsg.Thread.LastReply = message.Thread.LastReply.Format(time.UnixDate)
+		}
+	}
+	return smsg
+}
+
+func fromDBRichEmbedToEmbedInfo(embed database.RichEmbed) EmbedInfo {
+	info := EmbedInfo{
+		URL:          embed.URL,
+		Title:        embed.Title,
+		Description:  embed.Description,
+		ImageURL:     embed.ImageURL,
+		Color:        embed.Color,
+		AuthorName:   embed.AuthorName,
+		ThumbnailURL: embed.ThumbnailURL,
+		Footer:       embed.Footer,
+	}
+	for _, field := range embed.Fields {
+		info.Fields = append(info.Fields, EmbedFieldInfo{Name: field.Name, Value: field.Value, Inline: field.Inline})
+	}
+	return info
+}
+
+func fromDBMessagesToServerMessages(messages []database.Message) []ServerMessage {
+	smsgs := make([]ServerMessage, len(messages))
+	for i, message := range messages {
+		smsgs[i] = fromDBMessageToSeverMessage(message)
+	}
+	return smsgs
+}
+
+func fromDBChannelToChannelInfo(channel database.Channel) ChannelInfo {
+	return ChannelInfo{
+		ChannelId:   channel.ChannelId,
+		ServerId:    channel.ServerId,
+		ChannelName: channel.ChannelName,
+		Timestamp:   channel.Timestamp,
+		PinLimit:    channel.PinLimit,
+	}
+}
+
+func fromDBAttachmentToAttachmentInfo(attachment database.Attachment) AttachmentInfo {
+	info := AttachmentInfo{
+		AttachmentId: attachment.AttachmentId,
+		FileName:     attachment.FileName,
+		ContentType:  attachment.ContentType,
+		Size:         attachment.Size,
+		URL:          fmt.Sprintf("/api/attachments/%d", attachment.AttachmentId),
+		Width:        attachment.Width,
+		Height:       attachment.Height,
+		BlurHash:     attachment.BlurHash,
+	}
+	for _, thumbnail := range attachment.Thumbnails {
+		info.Thumbnails = append(info.Thumbnails, ThumbnailInfo{
+			Size:   thumbnail.Size,
+			Width:  thumbnail.Width,
+			Height: thumbnail.Height,
+			URL: fmt.Sprintf(
+				"/api/attachments/%d/thumbnails/%d",
+				attachment.AttachmentId,
+				thumbnail.Size,
+			),
+		})
+	}
+	return info
 }
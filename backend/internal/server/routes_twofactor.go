@@ -0,0 +1,362 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-chat-react/internal/database"
+	"go-chat-react/internal/totp"
+)
+
+const (
+	totpIssuer        = "go-chat"
+	recoveryCodeCount = 10
+	// recoveryCodeAlphabet leaves out characters that are easily confused
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+var errInvalidTwoFactorCode = errors.New("error: invalid code")
+
+// newRecoveryCodes returns fresh recovery codes along with the hashes that
+// are stored in their place.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	alphabetSize := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	for i := range codes {
+		var code strings.Builder
+		for j := 0; j < 10; j++ {
+			if j == 5 {
+				code.WriteByte('-')
+			}
+			n, err := rand.Int(rand.Reader, alphabetSize)
+			if err != nil {
+				return nil, nil, err
+			}
+			code.WriteByte(recoveryCodeAlphabet[n.Int64()])
+		}
+		codes[i] = code.String()
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes a recovery code as typed by the user, ignoring
+// case, spaces and dashes. Codes are random enough for an unsalted hash.
+func hashRecoveryCode(code string) string {
+	normalized := strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != totp.Digits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused recovery
+// code for a user with two-factor authentication enabled. Each code works
+// only once.
+func (s *Server) checkSecondFactor(twofactor database.TwoFactor, code string) error {
+	code = strings.TrimSpace(code)
+	var err error
+	if isTOTPCode(code) {
+		step, ok := totp.Validate(twofactor.Secret, code, time.Now(), 1)
+		if !ok {
+			return errInvalidTwoFactorCode
+		}
+		err = s.db.UseTwoFactorStep(twofactor.UserId, step)
+	} else {
+		err = s.db.UseRecoveryCode(twofactor.UserId, hashRecoveryCode(code))
+	}
+	if errors.Is(err, database.ErrRecordNotFound) {
+		return errInvalidTwoFactorCode
+	}
+	return err
+}
+
+// getEnabledTwoFactor returns the two-factor setup of a user, reporting an
+// http error when it is not enabled.
+func (s *Server) getEnabledTwoFactor(userid database.Id) (database.TwoFactor, httpErrorInfo, error) {
+	twofactor, err := s.db.GetTwoFactor(userid)
+	if errors.Is(err, database.ErrRecordNotFound) || (err == nil && !twofactor.Enabled) {
+		return twofactor, httpErrorInfo{
+			StatusCode: http.StatusBadRequest,
+			Message:    "error: two-factor authentication is not enabled",
+		}, errors.New("two-factor authentication is not enabled")
+	}
+	if err != nil {
+		return twofactor, httpErrorInfo{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "database error",
+		}, err
+	}
+	return twofactor, httpErrorInfo{}, nil
+}
+
+// CompleteTwoFactorLogin exchanges the challenge handed out by loginHandler
+// and a TOTP or recovery code for a session. A challenge is used up by the
+// first attempt, so a wrong code means logging in again.
+func (s *Server) CompleteTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	request := struct {
+		Challenge string `json:"challenge"`
+		Code      string `json:"code"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	challenge, err := s.redeemAuthToken(tokenPurposeLoginChallenge, request.Challenge)
+	if errors.Is(err, errInvalidAuthToken) {
+		http.Error(w, "error: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	twofactor, errInfo, err := s.getEnabledTwoFactor(challenge.UserId)
+	if err != nil {
+		http.Error(w, errInfo.Message, errInfo.StatusCode)
+		return
+	}
+	err = s.checkSecondFactor(twofactor, request.Code)
+	if errors.Is(err, errInvalidTwoFactorCode) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	s.startSession(w, challenge.UserId)
+}
+
+func (s *Server) GetTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	twofactor, err := s.db.GetTwoFactor(userid)
+	if err != nil && !errors.Is(err, database.ErrRecordNotFound) {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	remaining, err := s.db.CountRecoveryCodes(userid)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{
+		"enabled":                  twofactor.Enabled,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// EnrollTwoFactor generates a new TOTP secret for the caller. It only takes
+// effect once confirmed with a code from the authenticator app.
+func (s *Server) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	request := struct {
+		Password string `json:"password"`
+	}{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	valid, err := s.confirmPassword(userid, request.Password)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "invalid password", http.StatusForbidden)
+		return
+	}
+	current, err := s.db.GetTwoFactor(userid)
+	if err == nil && current.Enabled {
+		http.Error(w, "error: two-factor authentication already enabled", http.StatusConflict)
+		return
+	}
+	user, err := s.db.GetUser(userid)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	err = s.db.SetTwoFactorSecret(userid, secret)
+	if err != nil {
+		http.Error(w, "error: unable to start enrollment", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(totpIssuer, user.UserName, secret),
+	})
+}
+
+// ConfirmTwoFactor enables two-factor authentication once the caller proves
+// their authenticator app works, and returns the recovery codes. They are
+// only shown this once.
+func (s *Server) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	request := struct {
+		Code string `json:"code"`
+	}{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	twofactor, err := s.db.GetTwoFactor(userid)
+	if errors.Is(err, database.ErrRecordNotFound) {
+		http.Error(w, "error: no enrollment in progress", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if twofactor.Enabled {
+		http.Error(w, "error: two-factor authentication already enabled", http.StatusConflict)
+		return
+	}
+	step, ok := totp.Validate(twofactor.Secret, strings.TrimSpace(request.Code), time.Now(), 1)
+	if !ok {
+		http.Error(w, errInvalidTwoFactorCode.Error(), http.StatusBadRequest)
+		return
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	err = s.db.EnableTwoFactor(userid, step, hashes)
+	if err != nil {
+		log.Printf("ConfirmTwoFactor: unable to enable for %d: %v", userid, err)
+		http.Error(w, "error: unable to enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"enabled": true, "recovery_codes": codes})
+}
+
+// DisableTwoFactor turns two-factor authentication off, which takes both
+// the password and a code.
+func (s *Server) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	request := struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	valid, err := s.confirmPassword(userid, request.Password)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "invalid password", http.StatusForbidden)
+		return
+	}
+	twofactor, errInfo, err := s.getEnabledTwoFactor(userid)
+	if err != nil {
+		http.Error(w, errInfo.Message, errInfo.StatusCode)
+		return
+	}
+	err = s.checkSecondFactor(twofactor, request.Code)
+	if errors.Is(err, errInvalidTwoFactorCode) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	err = s.db.DisableTwoFactor(userid)
+	if err != nil {
+		http.Error(w, "error: unable to disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"enabled": false})
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes, for example
+// after running out.
+func (s *Server) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	request := struct {
+		Code string `json:"code"`
+	}{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	twofactor, errInfo, err := s.getEnabledTwoFactor(userid)
+	if err != nil {
+		http.Error(w, errInfo.Message, errInfo.StatusCode)
+		return
+	}
+	err = s.checkSecondFactor(twofactor, request.Code)
+	if errors.Is(err, errInvalidTwoFactorCode) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	err = s.db.SetRecoveryCodes(userid, hashes)
+	if err != nil {
+		http.Error(w, "error: unable to store recovery codes", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"recovery_codes": codes})
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"go-chat-react/internal/totp"
+)
+
+// enableTwoFactor enrolls u1 and returns the secret and recovery codes.
+func (s *TestServer) enableTwoFactor(t *testing.T) (string, []string) {
+	resp := s.expectStatus(t, http.MethodPost, "/api/users/me/2fa",
+		map[string]any{"password": "1"}, "u1", "1", http.StatusOK)
+	enrollment := struct {
+		Secret string `json:"secret"`
+		URI    string `json:"otpauth_uri"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&enrollment); err != nil {
+		t.Fatalf("error decoding enrollment. Err: %v", err)
+	}
+	if enrollment.Secret == "" || enrollment.URI == "" {
+		t.Fatalf("expected secret and uri; got %+v", enrollment)
+	}
+	s.expectStatus(t, http.MethodPost, "/api/users/me/2fa/confirm",
+		map[string]any{"code": "000000x"}, "u1", "1", http.StatusBadRequest)
+	code, _ := totp.CodeAt(enrollment.Secret, totp.Step(time.Now())-1)
+	resp = s.expectStatus(t, http.MethodPost, "/api/users/me/2fa/confirm",
+		map[string]any{"code": code}, "u1", "1", http.StatusOK)
+	confirmed := struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&confirmed); err != nil {
+		t.Fatalf("error decoding confirmation. Err: %v", err)
+	}
+	if len(confirmed.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("expected %d recovery codes; got %v", recoveryCodeCount, confirmed.RecoveryCodes)
+	}
+	return enrollment.Secret, confirmed.RecoveryCodes
+}
+
+func (s *TestServer) loginChallenge(t *testing.T) string {
+	resp := s.postJSON(t, "/api/auth/login", map[string]any{"username": "u1", "password": "1"}, http.StatusOK)
+	login := struct {
+		Required  bool   `json:"two_factor_required"`
+		Challenge string `json:"challenge"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&login); err != nil {
+		t.Fatalf("error decoding login. Err: %v", err)
+	}
+	if !login.Required || login.Challenge == "" {
+		t.Fatalf("expected a two-factor challenge; got %+v", login)
+	}
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "token" {
+			t.Fatalf("expected no session before the second factor")
+		}
+	}
+	return login.Challenge
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	secret, recovery := s.enableTwoFactor(t)
+
+	// a wrong code uses up the challenge
+	challenge := s.loginChallenge(t)
+	s.postJSON(t, "/api/auth/login/2fa", map[string]any{"challenge": challenge, "code": "000000"}, http.StatusUnauthorized)
+	code, _ := totp.CodeAt(secret, totp.Step(time.Now())+1)
+	s.postJSON(t, "/api/auth/login/2fa", map[string]any{"challenge": challenge, "code": code}, http.StatusUnauthorized)
+
+	challenge = s.loginChallenge(t)
+	resp := s.postJSON(t, "/api/auth/login/2fa", map[string]any{"challenge": challenge, "code": code}, http.StatusOK)
+	var session *http.Cookie
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "token" {
+			session = cookie
+		}
+	}
+	if session == nil {
+		t.Fatalf("expected a session cookie")
+	}
+
+	// codes cannot be replayed, recovery codes work once
+	challenge = s.loginChallenge(t)
+	s.postJSON(t, "/api/auth/login/2fa", map[string]any{"challenge": challenge, "code": code}, http.StatusUnauthorized)
+	challenge = s.loginChallenge(t)
+	s.postJSON(t, "/api/auth/login/2fa",
+		map[string]any{"challenge": challenge, "code": " " + recovery[0] + " "}, http.StatusOK)
+	challenge = s.loginChallenge(t)
+	s.postJSON(t, "/api/auth/login/2fa", map[string]any{"challenge": challenge, "code": recovery[0]}, http.StatusUnauthorized)
+
+	resp = s.expectCookieStatus(t, http.MethodGet, "/api/users/me/2fa", nil, session, http.StatusOK)
+	status := struct {
+		Enabled   bool `json:"enabled"`
+		Remaining int  `json:"recovery_codes_remaining"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("error decoding status. Err: %v", err)
+	}
+	if !status.Enabled || status.Remaining != recoveryCodeCount-1 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+}
+
+// twoFactorSession logs u1 in with a second factor.
+func (s *TestServer) twoFactorSession(t *testing.T, code string) *http.Cookie {
+	challenge := s.loginChallenge(t)
+	resp := s.postJSON(t, "/api/auth/login/2fa", map[string]any{"challenge": challenge, "code": code}, http.StatusOK)
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "token" {
+			return cookie
+		}
+	}
+	t.Fatalf("expected a session cookie")
+	return nil
+}
+
+func (s *TestServer) expectCookieStatus(
+	t *testing.T,
+	method string,
+	path string,
+	payload any,
+	cookie *http.Cookie,
+	status int,
+) *http.Response {
+	data, _ := json.Marshal(payload)
+	req, _ := http.NewRequest(method, s.server.URL+path, bytes.NewReader(data))
+	req.AddCookie(cookie)
+	resp, err := s.server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: err: %v", method, path, err)
+	}
+	if resp.StatusCode != status {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("%s %s: expected status %d; got %v: %s", method, path, status, resp.Status, body)
+	}
+	return resp
+}
+
+func TestTwoFactor_RecoveryCodesAndDisable(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	_, recovery := s.enableTwoFactor(t)
+	session := s.twoFactorSession(t, recovery[0])
+
+	s.expectCookieStatus(t, http.MethodPost, "/api/users/me/2fa",
+		map[string]any{"password": "1"}, session, http.StatusConflict)
+	resp := s.expectCookieStatus(t, http.MethodPost, "/api/users/me/2fa/recovery-codes",
+		map[string]any{"code": recovery[1]}, session, http.StatusOK)
+	regenerated := struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&regenerated); err != nil {
+		t.Fatalf("error decoding recovery codes. Err: %v", err)
+	}
+	// the old codes stopped working
+	s.expectCookieStatus(t, http.MethodDelete, "/api/users/me/2fa",
+		map[string]any{"password": "1", "code": recovery[2]}, session, http.StatusForbidden)
+	s.expectCookieStatus(t, http.MethodDelete, "/api/users/me/2fa",
+		map[string]any{"password": "wrong", "code": regenerated.RecoveryCodes[0]}, session, http.StatusForbidden)
+	s.expectCookieStatus(t, http.MethodDelete, "/api/users/me/2fa",
+		map[string]any{"password": "1", "code": regenerated.RecoveryCodes[0]}, session, http.StatusOK)
+
+	if _, err := s.getLoginCookie("u1", "1"); err != nil {
+		t.Fatalf("expected password login once disabled. Err: %v", err)
+	}
+}
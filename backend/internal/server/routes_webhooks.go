@@ -0,0 +1,473 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go-chat-react/internal/database"
+)
+
+const (
+	maxWebhookNameLength    = 80
+	maxWebhookEmbeds        = 10
+	maxWebhookEmbedFields   = 25
+	maxWebhookPayloadSize   = 64 << 10
+	maxWebhookEmbedTextSize = 4096
+)
+
+type WebhookInfo struct {
+	WebhookID database.Id `json:"webhookid"`
+	ChannelID database.Id `json:"channelid"`
+	UserID    database.Id `json:"userid"`
+	CreatorID database.Id `json:"creatorid"`
+	Name      string      `json:"name"`
+	Created   time.Time   `json:"created"`
+}
+
+func fromDBWebhook(webhook database.Webhook) WebhookInfo {
+	return WebhookInfo{
+		WebhookID: webhook.WebhookId,
+		ChannelID: webhook.ChannelId,
+		UserID:    webhook.UserId,
+		CreatorID: webhook.CreatorId,
+		Name:      webhook.Name,
+		Created:   webhook.Created,
+	}
+}
+
+func hashWebhookSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// webhookPayload accepts both the native shape and the one of Slack
+// incoming webhooks, so existing integrations can point at us unchanged.
+type webhookPayload struct {
+	Content   string         `json:"content"`
+	Username  string         `json:"username"`
+	AvatarURL string         `json:"avatar_url"`
+	Embeds    []webhookEmbed `json:"embeds"`
+
+	Text        string            `json:"text"`
+	IconURL     string            `json:"icon_url"`
+	Attachments []slackAttachment `json:"attachments"`
+	Blocks      []slackBlock      `json:"blocks"`
+}
+
+type webhookEmbed struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	// Color is an RGB integer as sent by Discord style clients
+	Color  int `json:"color"`
+	Author struct {
+		Name string `json:"name"`
+	} `json:"author"`
+	Image struct {
+		URL string `json:"url"`
+	} `json:"image"`
+	Thumbnail struct {
+		URL string `json:"url"`
+	} `json:"thumbnail"`
+	Footer struct {
+		Text string `json:"text"`
+	} `json:"footer"`
+	Fields []struct {
+		Name   string `json:"name"`
+		Value  string `json:"value"`
+		Inline bool   `json:"inline"`
+	} `json:"fields"`
+}
+
+type slackAttachment struct {
+	Fallback   string `json:"fallback"`
+	Color      string `json:"color"`
+	Pretext    string `json:"pretext"`
+	AuthorName string `json:"author_name"`
+	Title      string `json:"title"`
+	TitleLink  string `json:"title_link"`
+	Text       string `json:"text"`
+	Fields     []struct {
+		Title string `json:"title"`
+		Value string `json:"value"`
+		Short bool   `json:"short"`
+	} `json:"fields"`
+	ImageURL string `json:"image_url"`
+	ThumbURL string `json:"thumb_url"`
+	Footer   string `json:"footer"`
+}
+
+type slackBlock struct {
+	Type string `json:"type"`
+	Text *struct {
+		Text string `json:"text"`
+	} `json:"text"`
+}
+
+var slackColors = map[string]string{
+	"good":    "#2eb67d",
+	"warning": "#ecb22e",
+	"danger":  "#e01e5a",
+}
+
+var (
+	slackLinkPattern = regexp.MustCompile(`<([^<>|]+)(?:\|([^<>]*))?>`)
+	hexColorPattern  = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+var errEmptyWebhookMessage = errors.New("error: message needs content or embeds")
+
+// isSlack reports whether a payload only uses the Slack fields.
+func (p webhookPayload) isSlack() bool {
+	return p.Content == "" && len(p.Embeds) == 0 &&
+		(p.Text != "" || len(p.Attachments) > 0 || len(p.Blocks) > 0)
+}
+
+// slackToMarkdown rewrites the link and mention syntax of Slack mrkdwn into
+// our markdown and undoes its HTML escaping.
+func slackToMarkdown(text string) string {
+	text = slackLinkPattern.ReplaceAllStringFunc(text, func(match string) string {
+		parts := slackLinkPattern.FindStringSubmatch(match)
+		target, label := parts[1], parts[2]
+		switch {
+		case strings.HasPrefix(target, "!"):
+			// <!here>, <!channel> and <!everyone> are broadcast mentions
+			name, _, _ := strings.Cut(target[1:], "^")
+			return "@" + name
+		case label != "":
+			return fmt.Sprintf("[%s](%s)", label, target)
+		default:
+			return target
+		}
+	})
+	return strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&").Replace(text)
+}
+
+// webURL keeps http and https URLs and drops anything else.
+func webURL(raw string) string {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return ""
+	}
+	return parsed.String()
+}
+
+func truncateText(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut]
+}
+
+// normalize turns a payload of either shape into the message it posts.
+func (p webhookPayload) normalize() (string, database.WebhookAuthor, error) {
+	author := database.WebhookAuthor{
+		UserName:  truncateText(strings.TrimSpace(p.Username), maxWebhookNameLength),
+		AvatarURL: webURL(p.AvatarURL),
+	}
+	content := p.Content
+	if p.isSlack() {
+		author.AvatarURL = webURL(p.IconURL)
+		content = slackToMarkdown(p.Text)
+		if content == "" {
+			var lines []string
+			for _, block := range p.Blocks {
+				if block.Text != nil && (block.Type == "section" || block.Type == "header") {
+					lines = append(lines, slackToMarkdown(block.Text.Text))
+				}
+			}
+			content = strings.Join(lines, "\n")
+		}
+		for _, attachment := range p.Attachments {
+			author.Embeds = append(author.Embeds, attachment.toRichEmbed())
+		}
+	} else {
+		for _, embed := range p.Embeds {
+			author.Embeds = append(author.Embeds, embed.toRichEmbed())
+		}
+	}
+	if len(content) > maxMessageLength {
+		return "", database.WebhookAuthor{}, errors.New("error: message too long")
+	}
+	if len(author.Embeds) > maxWebhookEmbeds {
+		return "", database.WebhookAuthor{}, fmt.Errorf("error: at most %d embeds", maxWebhookEmbeds)
+	}
+	for _, embed := range author.Embeds {
+		if len(embed.Fields) > maxWebhookEmbedFields {
+			return "", database.WebhookAuthor{}, fmt.Errorf("error: at most %d fields per embed", maxWebhookEmbedFields)
+		}
+	}
+	if strings.TrimSpace(content) == "" && len(author.Embeds) == 0 {
+		return "", database.WebhookAuthor{}, errEmptyWebhookMessage
+	}
+	return content, author, nil
+}
+
+func (e webhookEmbed) toRichEmbed() database.RichEmbed {
+	embed := database.RichEmbed{
+		Title:        truncateText(e.Title, maxWebhookEmbedTextSize),
+		Description:  truncateText(e.Description, maxWebhookEmbedTextSize),
+		URL:          webURL(e.URL),
+		AuthorName:   truncateText(e.Author.Name, maxWebhookNameLength),
+		ImageURL:     webURL(e.Image.URL),
+		ThumbnailURL: webURL(e.Thumbnail.URL),
+		Footer:       truncateText(e.Footer.Text, maxWebhookEmbedTextSize),
+	}
+	if e.Color > 0 && e.Color <= 0xFFFFFF {
+		embed.Color = fmt.Sprintf("#%06x", e.Color)
+	}
+	for _, field := range e.Fields {
+		embed.Fields = append(embed.Fields, database.RichEmbedField{
+			Name:   truncateText(field.Name, maxWebhookEmbedTextSize),
+			Value:  truncateText(field.Value, maxWebhookEmbedTextSize),
+			Inline: field.Inline,
+		})
+	}
+	return embed
+}
+
+func (a slackAttachment) toRichEmbed() database.RichEmbed {
+	description := slackToMarkdown(a.Text)
+	if description == "" && a.Title == "" {
+		description = a.Fallback
+	}
+	if a.Pretext != "" {
+		description = strings.TrimSpace(slackToMarkdown(a.Pretext) + "\n" + description)
+	}
+	embed := database.RichEmbed{
+		Title:        truncateText(a.Title, maxWebhookEmbedTextSize),
+		Description:  truncateText(description, maxWebhookEmbedTextSize),
+		URL:          webURL(a.TitleLink),
+		AuthorName:   truncateText(a.AuthorName, maxWebhookNameLength),
+		ImageURL:     webURL(a.ImageURL),
+		ThumbnailURL: webURL(a.ThumbURL),
+		Footer:       truncateText(a.Footer, maxWebhookEmbedTextSize),
+	}
+	if color, ok := slackColors[a.Color]; ok {
+		embed.Color = color
+	} else if hexColorPattern.MatchString(a.Color) {
+		embed.Color = strings.ToLower(a.Color)
+	}
+	for _, field := range a.Fields {
+		embed.Fields = append(embed.Fields, database.RichEmbedField{
+			Name:   truncateText(field.Title, maxWebhookEmbedTextSize),
+			Value:  truncateText(slackToMarkdown(field.Value), maxWebhookEmbedTextSize),
+			Inline: field.Short,
+		})
+	}
+	return embed
+}
+
+// decodeWebhookPayload reads a JSON body, or the payload form field Slack
+// clients may send instead.
+func decodeWebhookPayload(r *http.Request) (webhookPayload, error) {
+	var payload webhookPayload
+	mediatype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediatype == "application/x-www-form-urlencoded" {
+		if err := r.ParseForm(); err != nil {
+			return webhookPayload{}, err
+		}
+		err := json.Unmarshal([]byte(r.PostForm.Get("payload")), &payload)
+		return payload, err
+	}
+	err := json.NewDecoder(r.Body).Decode(&payload)
+	return payload, err
+}
+
+// ExecuteWebhook posts a message into the channel of a webhook. The secret
+// in the URL is the only credential.
+func (s *Server) ExecuteWebhook(w http.ResponseWriter, r *http.Request) {
+	webhookid, err := parsePathFromID(r, "webhookid")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	webhook, err := s.db.GetWebhookByHash(webhookid, hashWebhookSecret(r.PathValue("secret")))
+	if errors.Is(err, database.ErrRecordNotFound) {
+		http.Error(w, "error: unknown webhook", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxWebhookPayloadSize)
+	payload, err := decodeWebhookPayload(r)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	content, author, err := payload.normalize()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	author.WebhookId = webhook.WebhookId
+
+	messageid, err := s.db.AddWebhookMessage(webhook.ChannelId, webhook.UserId, content, author)
+	if err != nil {
+		http.Error(w, "error: unable to create message", http.StatusInternalServerError)
+		return
+	}
+	s.previews.Enqueue(messageid, content)
+	dbmsg, err := s.db.GetMessage(messageid)
+	if err != nil {
+		http.Error(w, "error: unable to fetch message", http.StatusInternalServerError)
+		return
+	}
+	byte_data, err := newServerResponse("message", fromDBMessageToSeverMessage(dbmsg))
+	if err == nil {
+		s.broadcastToChannel(dbmsg.ServerId, dbmsg.ChannelId, byte_data)
+	}
+	s.publishEvent(dbmsg.ServerId, eventMessageCreated, fromDBMessageToSeverMessage(dbmsg))
+	if payload.isSlack() {
+		// Slack answers with a plain ok that some clients check for
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "ok")
+		return
+	}
+	writeJSON(w, map[string]any{"messageid": messageid})
+}
+
+// getManagedChannel loads the channel in the path and checks that the
+// caller owns its server. Direct messages have no webhooks.
+func (s *Server) getManagedChannel(r *http.Request) (database.Channel, httpErrorInfo, error) {
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		return database.Channel{}, httpErrorInfo{http.StatusInternalServerError, err.Error()}, err
+	}
+	channel, err := s.GetChannelFromRequest(r)
+	if err != nil {
+		return database.Channel{}, httpErrorInfo{http.StatusNotFound, "error: unable to locate channel"}, err
+	}
+	if channel.IsDirectMessage() {
+		return database.Channel{}, httpErrorInfo{http.StatusBadRequest, "error: direct messages have no webhooks"},
+			errors.New("direct message channel")
+	}
+	server, err := s.db.GetServer(channel.ServerId)
+	if err != nil {
+		return database.Channel{}, httpErrorInfo{http.StatusInternalServerError, "database error"}, err
+	}
+	if server.OwnerId != userid {
+		return database.Channel{}, httpErrorInfo{http.StatusForbidden, "error: user not owner of channel"},
+			errors.New("not owner")
+	}
+	return channel, httpErrorInfo{}, nil
+}
+
+func (s *Server) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	channel, errorInfo, err := s.getManagedChannel(r)
+	if err != nil {
+		http.Error(w, errorInfo.Message, errorInfo.StatusCode)
+		return
+	}
+	webhooks, err := s.db.GetWebhooksOfChannel(channel.ChannelId)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	infos := make([]WebhookInfo, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		infos = append(infos, fromDBWebhook(webhook))
+	}
+	writeJSON(w, map[string]any{"webhooks": infos})
+}
+
+// CreateWebhook adds a webhook to a channel. The returned URL holds the
+// secret and cannot be shown again.
+func (s *Server) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	channel, errorInfo, err := s.getManagedChannel(r)
+	if err != nil {
+		http.Error(w, errorInfo.Message, errorInfo.StatusCode)
+		return
+	}
+	userid, err := getUserIdFromContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	request := struct {
+		Name string `json:"name"`
+	}{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "error: unable to parse request", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(request.Name)
+	if name == "" || len(name) > maxWebhookNameLength {
+		http.Error(w, fmt.Sprintf("error: name must be 1 to %d characters", maxWebhookNameLength), http.StatusBadRequest)
+		return
+	}
+	secret := rand.Text()
+	webhookid, err := s.db.CreateWebhook(channel.ChannelId, userid, name, hashWebhookSecret(secret))
+	if err != nil {
+		http.Error(w, "error: unable to create webhook", http.StatusInternalServerError)
+		return
+	}
+	webhook, err := s.db.GetWebhook(webhookid)
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	s.recordAudit(r, database.AuditEntry{
+		ServerId:   channel.ServerId,
+		Action:     auditWebhookCreate,
+		TargetType: database.AuditTargetWebhook,
+		TargetId:   webhookid,
+		After:      map[string]any{"name": webhook.Name, "channelid": channel.ChannelId},
+	})
+	writeJSON(w, map[string]any{
+		"webhook": fromDBWebhook(webhook),
+		"url":     fmt.Sprintf("%s/api/webhooks/%d/%s", s.serverURL, webhookid, secret),
+	})
+}
+
+func (s *Server) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	channel, errorInfo, err := s.getManagedChannel(r)
+	if err != nil {
+		http.Error(w, errorInfo.Message, errorInfo.StatusCode)
+		return
+	}
+	webhookid, err := parsePathFromID(r, "webhookid")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	webhook, err := s.db.GetWebhook(webhookid)
+	if errors.Is(err, database.ErrRecordNotFound) || (err == nil && webhook.ChannelId != channel.ChannelId) {
+		http.Error(w, "error: webhook not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.db.DeleteWebhook(webhookid); err != nil {
+		http.Error(w, "database error", http.StatusInternalServerError)
+		return
+	}
+	s.recordAudit(r, database.AuditEntry{
+		ServerId:   channel.ServerId,
+		Action:     auditWebhookDelete,
+		TargetType: database.AuditTargetWebhook,
+		TargetId:   webhookid,
+		Before:     map[string]any{"name": webhook.Name, "channelid": channel.ChannelId},
+	})
+	writeJSON(w, map[string]any{"webhookid": webhookid})
+}
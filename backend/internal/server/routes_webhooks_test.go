@@ -0,0 +1,129 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func (s *TestServer) createWebhook(t *testing.T, channelid int, name string) (WebhookInfo, string) {
+	resp := s.expectStatus(t, http.MethodPost, fmt.Sprintf("/api/channels/%d/webhooks", channelid),
+		map[string]any{"name": name}, "u1", "1", http.StatusOK)
+	created := struct {
+		Webhook WebhookInfo `json:"webhook"`
+		URL     string      `json:"url"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("error decoding webhook. Err: %v", err)
+	}
+	parsed, err := url.Parse(created.URL)
+	if err != nil {
+		t.Fatalf("invalid webhook url %q", created.URL)
+	}
+	return created.Webhook, parsed.Path
+}
+
+func (s *TestServer) latestMessage(t *testing.T, channelid int) ServerMessage {
+	resp := s.expectStatus(t, http.MethodGet, fmt.Sprintf("/api/channels/%d/messages?count=1", channelid),
+		nil, "u1", "1", http.StatusOK)
+	result := struct {
+		Messages []ServerMessage `json:"messages"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("error decoding messages. Err: %v", err)
+	}
+	if len(result.Messages) == 0 {
+		t.Fatalf("expected messages in channel %d", channelid)
+	}
+	return result.Messages[0]
+}
+
+func TestWebhook_Execute(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	webhook, path := s.createWebhook(t, 1, "CI")
+
+	payload := `{"content": "build **passed**", "username": "Jenkins", "avatar_url": "https://ci.example.com/a.png",
+		"embeds": [{"title": "#42", "color": 65280, "fields": [{"name": "branch", "value": "main", "inline": true}]}]}`
+	resp, err := http.Post(s.server.URL+path, "application/json", strings.NewReader(payload))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST %s: unexpected response %v err: %v", path, resp, err)
+	}
+	message := s.latestMessage(t, 1)
+	if message.UserId != webhook.UserID || message.DisplayName != "Jenkins" || message.Webhook == nil ||
+		message.Webhook.AvatarURL != "https://ci.example.com/a.png" || message.Message != "build **passed**" {
+		t.Fatalf("unexpected webhook message %+v", message)
+	}
+	if len(message.Embeds) != 1 || message.Embeds[0].Color != "#00ff00" || message.Embeds[0].Fields[0].Value != "main" {
+		t.Fatalf("unexpected webhook embeds %+v", message.Embeds)
+	}
+
+	for _, body := range []string{`{}`, `{"content": "` + strings.Repeat("a", maxMessageLength+1) + `"}`} {
+		resp, err = http.Post(s.server.URL+path, "application/json", strings.NewReader(body))
+		if err != nil || resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("POST %s: expected status 400 got %v err: %v", path, resp, err)
+		}
+	}
+	resp, err = http.Post(s.server.URL+path+"x", "application/json", strings.NewReader(payload))
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("POST with wrong secret: expected status 404 got %v err: %v", resp, err)
+	}
+}
+
+func TestWebhook_SlackPayload(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	_, path := s.createWebhook(t, 1, "Alerts")
+
+	payload := `{"text": "<!here> disk full on <https://grafana.example.com/d/1|db-1> &amp; more",
+		"attachments": [{"color": "danger", "title": "Disk", "text": "95% used", "fields": [{"title": "host", "value": "db-1", "short": true}]}]}`
+	resp, err := http.PostForm(s.server.URL+path, url.Values{"payload": {payload}})
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST %s: unexpected response %v err: %v", path, resp, err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "ok" {
+		t.Fatalf("expected slack style ok response got %q", body)
+	}
+	message := s.latestMessage(t, 1)
+	if message.Message != "@here disk full on [db-1](https://grafana.example.com/d/1) & more" || message.DisplayName != "Alerts" {
+		t.Fatalf("unexpected slack message %+v", message)
+	}
+	if len(message.Embeds) != 1 || message.Embeds[0].Color != "#e01e5a" || !message.Embeds[0].Fields[0].Inline {
+		t.Fatalf("unexpected slack embeds %+v", message.Embeds)
+	}
+}
+
+func TestWebhook_Manage(t *testing.T) {
+	s, teardown := setupTest(t)
+	defer teardown(t)
+	webhook, path := s.createWebhook(t, 1, "CI")
+	s.expectStatus(t, http.MethodPost, "/api/channels/1/webhooks",
+		map[string]any{"name": "mine"}, "u2", "2", http.StatusForbidden)
+	s.expectStatus(t, http.MethodPost, "/api/channels/1/webhooks",
+		map[string]any{"name": " "}, "u1", "1", http.StatusBadRequest)
+
+	resp := s.expectStatus(t, http.MethodGet, "/api/channels/1/webhooks", nil, "u1", "1", http.StatusOK)
+	listed := struct {
+		Webhooks []WebhookInfo `json:"webhooks"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&listed); err != nil {
+		t.Fatalf("error decoding webhooks. Err: %v", err)
+	}
+	if len(listed.Webhooks) != 1 || listed.Webhooks[0].Name != "CI" {
+		t.Fatalf("unexpected webhooks %+v", listed.Webhooks)
+	}
+
+	s.expectStatus(t, http.MethodDelete, fmt.Sprintf("/api/channels/2/webhooks/%d", webhook.WebhookID),
+		nil, "u1", "1", http.StatusNotFound)
+	s.expectStatus(t, http.MethodDelete, fmt.Sprintf("/api/channels/1/webhooks/%d", webhook.WebhookID),
+		nil, "u1", "1", http.StatusOK)
+	resp, err := http.Post(s.server.URL+path, "application/json", strings.NewReader(`{"content": "hi"}`))
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("POST to deleted webhook: expected status 404 got %v err: %v", resp, err)
+	}
+}
@@ -7,11 +7,16 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	_ "github.com/joho/godotenv/autoload"
 
 	"go-chat-react/internal/database"
+	"go-chat-react/internal/mail"
+	"go-chat-react/internal/oidc"
+	"go-chat-react/internal/storage"
+	"go-chat-react/internal/unfurl"
 	"go-chat-react/internal/websocket"
 )
 
@@ -27,6 +32,8 @@ type UserService interface {
 	CreateUser(username string, password string) (database.Id, error)
 	UpdateUserName(userid database.Id, username string) error
 	GetRecentUsernames(userid database.Id, number uint) ([]database.UsernameLogEntry, error)
+	UpdateUserProfile(userid database.Id, profile database.UserProfile) error
+	SetUserAvatar(userid database.Id, avatarkey string) error
 }
 
 type ServerService interface {
@@ -37,7 +44,10 @@ type ServerService interface {
 	DeleteServer(serverid database.Id) error
 	UpdateServerName(serverid database.Id, servername string) error
 	IsUserInServer(userid database.Id, serverid database.Id) (bool, error)
-	AddUserToServer(serverid database.Id, userid database.Id, nickname string) error
+	AddUserToServer(userid database.Id, serverid database.Id, nickname string) error
+	GetServerMembers(serverid database.Id) ([]database.ServerMember, error)
+	UpdateUserNickname(userid database.Id, serverid database.Id, nickname string) error
+	GetRecentNicknames(userid database.Id, serverid database.Id, number uint) ([]database.UserNicknameLogEntry, error)
 }
 
 type ChannelService interface {
@@ -46,7 +56,8 @@ type ChannelService interface {
 	GetChannel(channelid database.Id) (database.Channel, error)
 	GetChannelsOfServer(serverid database.Id) ([]database.Channel, error)
 	UpdateChannel(channelid database.Id, username string) error
-	AddUserToChannel(channelid database.Id, userid database.Id) error
+	UpdateChannelPinLimit(channelid database.Id, pinlimit uint) error
+	AddUserToChannel(userid database.Id, channelid database.Id) error
 	RemoveUserFromChannel(channelid database.Id, userid database.Id) error
 	GetUsersInChannel(channelid database.Id) ([]database.User, error)
 	IsUserInChannel(userid database.Id, channelid database.Id) (bool, error)
@@ -57,7 +68,150 @@ type MessageService interface {
 	GetMessagesInChannel(channelid database.Id, number uint) ([]database.Message, error)
 	AddMessage(channelid database.Id, userid database.Id, message string) (database.Id, error)
 	UpdateMessage(messageid database.Id, message string) error
-	DeleteMessage(messageid database.Id) error
+	DeleteMessage(messageid database.Id) ([]database.Attachment, error)
+	CreateMessage(message database.NewMessage) (database.Id, error)
+}
+
+type ThreadService interface {
+	GetThreadMessages(rootid database.Id, before database.Id, number uint) ([]database.Message, error)
+	FollowThread(rootid database.Id, userid database.Id) error
+	UnfollowThread(rootid database.Id, userid database.Id) error
+	GetThreadFollowers(rootid database.Id) ([]database.Id, error)
+}
+
+type PinService interface {
+	PinMessage(channelid database.Id, messageid database.Id, userid database.Id) error
+	UnpinMessage(channelid database.Id, messageid database.Id) error
+	GetPinnedMessages(channelid database.Id) ([]database.PinnedMessage, error)
+}
+
+type AttachmentService interface {
+	CreateAttachment(attachment database.Attachment) (database.Id, error)
+	GetAttachment(attachmentid database.Id) (database.Attachment, error)
+	DeleteAttachment(attachmentid database.Id) error
+	GetServerAttachmentUsage(serverid database.Id) (int64, error)
+	SetAttachmentImageInfo(attachmentid database.Id, width int, height int, blurhash string) error
+	AddAttachmentThumbnail(thumbnail database.AttachmentThumbnail) error
+}
+
+type EmbedService interface {
+	GetLinkPreview(url string, maxAge time.Duration) (database.LinkPreview, error)
+	SaveLinkPreview(preview database.LinkPreview) error
+	AddMessageEmbed(messageid database.Id, url string) error
+}
+
+type DirectMessageService interface {
+	OpenDirectMessage(userid database.Id, otherid database.Id) (database.Id, error)
+	CreateGroupDirectMessage(ownerid database.Id, participants []database.Id, name string) (database.Id, error)
+	GetDirectMessage(channelid database.Id) (database.DirectMessage, error)
+	GetDirectMessagesOfUser(userid database.Id) ([]database.DirectMessage, error)
+	UpdateDirectMessageOwner(channelid database.Id, ownerid database.Id) error
+}
+
+type RelationshipService interface {
+	SendFriendRequest(senderid database.Id, receiverid database.Id) (bool, error)
+	AcceptFriendRequest(receiverid database.Id, senderid database.Id) error
+	DeleteFriendRequest(senderid database.Id, receiverid database.Id) error
+	GetFriendRequests(userid database.Id) ([]database.FriendRequest, error)
+	GetFriends(userid database.Id) ([]database.User, error)
+	AreFriends(userid database.Id, otherid database.Id) (bool, error)
+	RemoveFriend(userid database.Id, friendid database.Id) error
+	BlockUser(userid database.Id, blockedid database.Id) error
+	UnblockUser(userid database.Id, blockedid database.Id) error
+	GetBlockedUsers(userid database.Id) ([]database.User, error)
+	HasBlocked(userid database.Id, otherid database.Id) (bool, error)
+}
+
+type AccountService interface {
+	ScheduleAccountDeletion(userid database.Id, deleteAfter time.Time, removeMessages bool) error
+	CancelAccountDeletion(userid database.Id) error
+	IsDeletionPending(userid database.Id) (bool, error)
+	GetDueAccountDeletions(now time.Time) ([]database.AccountDeletion, error)
+	DeleteUserAccount(userid database.Id, removeMessages bool) (database.DeletedAccount, error)
+	GetMessagesOfUser(userid database.Id) ([]database.Message, error)
+	GetNicknamesOfUser(userid database.Id) ([]database.UserNicknameLogEntry, error)
+}
+
+type CredentialService interface {
+	SetUserEmail(userid database.Id, email string) error
+	GetUserEmail(userid database.Id) (database.UserEmail, error)
+	GetUserIDFromEmail(email string) (database.Id, error)
+	MarkEmailVerified(userid database.Id, email string) error
+	UpdateUserPassword(userid database.Id, password string) error
+	RemoveUserPassword(userid database.Id) error
+	GetUserIDFromIdentity(provider string, subject string) (database.Id, error)
+	LinkUserIdentity(userid database.Id, provider string, subject string) error
+	RotateUserSessionToken(userid database.Id) (string, time.Time, error)
+	CreateAuthToken(token database.AuthToken) error
+	GetAuthToken(tokenid string, purpose string) (database.AuthToken, error)
+	ConsumeAuthToken(tokenid string, purpose string) (database.AuthToken, error)
+}
+
+type TwoFactorService interface {
+	SetTwoFactorSecret(userid database.Id, secret string) error
+	GetTwoFactor(userid database.Id) (database.TwoFactor, error)
+	EnableTwoFactor(userid database.Id, step int64, codehashes []string) error
+	DisableTwoFactor(userid database.Id) error
+	UseTwoFactorStep(userid database.Id, step int64) error
+	SetRecoveryCodes(userid database.Id, codehashes []string) error
+	UseRecoveryCode(userid database.Id, codehash string) error
+	CountRecoveryCodes(userid database.Id) (int, error)
+}
+
+type BotService interface {
+	CreateBotUser(ownerid database.Id, username string) (database.Id, error)
+	GetBotsOfUser(ownerid database.Id) ([]database.User, error)
+	CreateAPIToken(token database.APIToken, tokenhash string) (database.Id, error)
+	GetAPITokensOfUser(userid database.Id) ([]database.APIToken, error)
+	GetAPITokenByHash(tokenhash string) (database.APIToken, error)
+	DeleteAPIToken(tokenid database.Id, userid database.Id) error
+	TouchAPIToken(tokenid database.Id, now time.Time) error
+}
+
+type WebhookService interface {
+	CreateWebhook(channelid database.Id, creatorid database.Id, name string, secrethash string) (database.Id, error)
+	GetWebhook(webhookid database.Id) (database.Webhook, error)
+	GetWebhookByHash(webhookid database.Id, secrethash string) (database.Webhook, error)
+	GetWebhooksOfChannel(channelid database.Id) ([]database.Webhook, error)
+	DeleteWebhook(webhookid database.Id) error
+	AddWebhookMessage(channelid database.Id, userid database.Id, contents string, author database.WebhookAuthor) (database.Id, error)
+}
+
+type EventService interface {
+	CreateEventEndpoint(endpoint database.EventEndpoint) (database.Id, error)
+	GetEventEndpoint(endpointid database.Id) (database.EventEndpoint, error)
+	GetEventEndpointsOfServer(serverid database.Id) ([]database.EventEndpoint, error)
+	UpdateEventEndpoint(endpointid database.Id, url string, events []string, enabled bool) error
+	DeleteEventEndpoint(endpointid database.Id) error
+	EnqueueEvent(serverid database.Id, event string, payload string, now time.Time) (int64, error)
+	GetDueEventDeliveries(now time.Time, limit uint) ([]database.EventDelivery, error)
+	GetEventDeliveries(endpointid database.Id, limit uint) ([]database.EventDelivery, error)
+	RecordEventDeliveryAttempt(delivery database.EventDelivery, succeeded bool, disableAfter int) (bool, error)
+	PruneEventDeliveries(before time.Time) error
+}
+
+type AuditService interface {
+	AddAuditEntry(entry database.AuditEntry) (database.Id, error)
+	GetAuditLog(serverid database.Id, filter database.AuditLogFilter, number uint) ([]database.AuditEntry, error)
+}
+
+type RestrictionService interface {
+	SetRestriction(restriction database.Restriction, now time.Time) (database.Id, error)
+	GetRestriction(restrictionid database.Id) (database.Restriction, error)
+	GetActiveRestrictions(serverid database.Id, now time.Time) ([]database.Restriction, error)
+	GetPostingRestriction(userid database.Id, channelid database.Id, now time.Time) (database.Restriction, error)
+	DeleteRestriction(restrictionid database.Id) error
+}
+
+type CommandService interface {
+	SetBotCommands(botid database.Id, commands []database.BotCommand) error
+	GetBotCommands(botid database.Id) ([]database.BotCommand, error)
+	GetBotCommandsOfServer(serverid database.Id) ([]database.BotCommand, error)
+	SetBotCallback(callback database.BotCallback) error
+	GetBotCallback(botid database.Id) (database.BotCallback, error)
+	CreateReminder(reminder database.Reminder) (database.Id, error)
+	GetDueReminders(now time.Time) ([]database.Reminder, error)
+	DeleteReminder(reminderid database.Id) error
 }
 
 type LifecycleService interface {
@@ -76,6 +230,21 @@ type (
 		ServerService
 		ChannelService
 		MessageService
+		ThreadService
+		PinService
+		AttachmentService
+		EmbedService
+		DirectMessageService
+		RelationshipService
+		AccountService
+		CredentialService
+		TwoFactorService
+		BotService
+		WebhookService
+		EventService
+		AuditService
+		RestrictionService
+		CommandService
 		LifecycleService
 	}
 )
@@ -104,6 +273,9 @@ func NewInMemoryDB() *database.DBService {
 	if err != nil {
 		log.Fatal(err)
 	}
+	// every connection to :memory: is a separate database, so pin the pool to
+	// one connection for background workers to see the same data
+	db.SetMaxOpenConns(1)
 
 	err = executeSQLFile(db, "../../schema.sql")
 	if err != nil {
@@ -148,21 +320,121 @@ func NewDB() *database.DBService {
 type Server struct {
 	port                int
 	sessions_in_channel map[database.Id]map[string]bool
+	sessions_of_user    map[database.Id]map[string]bool
+	sessions_mutex      sync.RWMutex
 	ws_manager          *websocket.WebSocketManager
 	db                  Service
+	blobs               storage.BlobStore
+	thumbnails          *thumbnailWorker
+	previews            *linkPreviewWorker
+	deletions           *accountDeletionWorker
+	events              *eventDeliveryWorker
+	commands            *commandRegistry
+	reminders           *reminderWorker
+	// deletionGrace is how long a deleted account can still be restored
+	deletionGrace time.Duration
+	mailer        mail.Mailer
+	authTokens    *tokenSigner
+	passwords     *passwordPolicy
+	// appURL is the address of the web client, used for links in emails
+	appURL string
+	// serverURL is the public address of this API, used for webhook URLs
+	serverURL     string
+	oidcProviders map[string]*oidc.Provider
 }
 
-func NewServer(logserver bool, port int) *http.Server {
-	fmt.Printf("opening on port %d", port)
-	db := NewDB()
-
-	NewServer := &Server{
-		port:                port,
+// New returns a Server backed by db and blobs with the defaults NewServer
+// starts from: mail is only logged, emailed links are signed with a random
+// key and no identity providers are configured. Bot callbacks and outgoing
+// webhooks time out and only reach public addresses. Background workers do
+// not run until Start is called.
+func New(db Service, blobs storage.BlobStore) *Server {
+	s := &Server{
 		sessions_in_channel: make(map[database.Id]map[string]bool),
+		sessions_of_user:    make(map[database.Id]map[string]bool),
 		ws_manager:          websocket.NewWebSocketManager(),
 
-		db: db,
+		db:            db,
+		blobs:         blobs,
+		deletionGrace: defaultDeletionGracePeriod,
+		mailer:        mail.NewLogMailer("go-chat <no-reply@localhost>"),
+		authTokens:    newRandomTokenSigner(),
+		passwords:     newPasswordPolicy(defaultMinPasswordLength, nil),
+		appURL:        "http://localhost:5173",
+		serverURL:     "http://localhost:8080",
+		oidcProviders: make(map[string]*oidc.Provider),
+	}
+	s.thumbnails = newThumbnailWorker(s)
+	s.previews = newLinkPreviewWorker(s, unfurl.NewFetcher(linkPreviewTimeout, false))
+	s.deletions = newAccountDeletionWorker(s, accountDeletionInterval)
+	s.events = newEventDeliveryWorker(s, unfurl.NewClient(eventDeliveryTimeout, false))
+	s.commands = newCommandRegistry(unfurl.NewClient(commandCallbackTimeout, false), nil)
+	s.reminders = newReminderWorker(s, reminderInterval)
+	return s
+}
+
+// Start runs the background workers until ctx is done.
+func (s *Server) Start(ctx context.Context) {
+	var workers sync.WaitGroup
+	for _, run := range []func(context.Context){
+		s.thumbnails.Run,
+		s.previews.Run,
+		s.deletions.Run,
+		s.events.Run,
+		s.reminders.Run,
+	} {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(ctx)
+		}()
 	}
+	workers.Wait()
+}
+
+func NewServer(logserver bool, port int) *http.Server {
+	fmt.Printf("opening on port %d", port)
+	db := NewDB()
+	blobs, err := storage.NewFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	mailer, err := mail.NewFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	passwords, err := passwordPolicyFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	appURL := os.Getenv("APP_URL")
+	if appURL == "" {
+		appURL = "http://localhost:5173"
+	}
+	serverURL := os.Getenv("SERVER_URL")
+	if serverURL == "" {
+		serverURL = fmt.Sprintf("http://localhost:%d", port)
+	}
+	oidcConfigs, err := oidc.ConfigsFromEnv(serverURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	oidcProviders := make(map[string]*oidc.Provider)
+	for _, config := range oidcConfigs {
+		oidcProviders[config.Name] = oidc.NewProvider(config, nil)
+	}
+
+	NewServer := New(db, blobs)
+	NewServer.port = port
+	NewServer.deletionGrace = deletionGracePeriodFromEnv()
+	NewServer.mailer = mailer
+	NewServer.authTokens = tokenSignerFromEnv()
+	NewServer.passwords = passwords
+	NewServer.appURL = appURL
+	NewServer.serverURL = serverURL
+	NewServer.oidcProviders = oidcProviders
+	NewServer.commands = newCommandRegistry(unfurl.NewClient(commandCallbackTimeout, false), giphyClientFromEnv())
+	go NewServer.Start(context.Background())
 	atomicdb, err := db.Atomic(context.Background(), nil)
 	if err != nil {
 		log.Fatal(err)
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+
+	"go-chat-react/internal/database"
+	"go-chat-react/internal/media"
+)
+
+// thumbnailSizes are the bounding boxes, in pixels, of the thumbnails
+// generated for every image attachment.
+var thumbnailSizes = []int{64, 320, 1024}
+
+const thumbnailQueueSize = 256
+
+// thumbnailWorker decodes image attachments in the background, storing their
+// dimensions, blurhash and thumbnails, then pushes the updated message to
+// the server so clients can swap in the previews.
+type thumbnailWorker struct {
+	server *Server
+	queue  chan database.Id
+}
+
+func newThumbnailWorker(server *Server) *thumbnailWorker {
+	return &thumbnailWorker{
+		server: server,
+		queue:  make(chan database.Id, thumbnailQueueSize),
+	}
+}
+
+// Enqueue schedules an attachment for processing. It never blocks; when the
+// queue is full the attachment is skipped and served without previews.
+func (w *thumbnailWorker) Enqueue(attachmentid database.Id) {
+	if w == nil {
+		return
+	}
+	select {
+	case w.queue <- attachmentid:
+	default:
+		log.Printf("thumbnailWorker: queue full, skipping attachment %d", attachmentid)
+	}
+}
+
+func (w *thumbnailWorker) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case attachmentid := <-w.queue:
+			if err := w.process(ctx, attachmentid); err != nil {
+				log.Printf("thumbnailWorker: attachment %d: %v", attachmentid, err)
+			}
+		}
+	}
+}
+
+func (w *thumbnailWorker) process(ctx context.Context, attachmentid database.Id) error {
+	s := w.server
+	attachment, err := s.db.GetAttachment(attachmentid)
+	if err != nil {
+		return err
+	}
+	if !media.IsSupportedImage(attachment.ContentType) {
+		return nil
+	}
+	blob, err := s.blobs.Get(ctx, attachment.StorageKey)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(io.LimitReader(blob, maxAttachmentSize+1))
+	blob.Close()
+	if err != nil {
+		return err
+	}
+	info, err := media.Process(attachment.ContentType, data, thumbnailSizes)
+	if err != nil {
+		return err
+	}
+
+	for _, thumbnail := range info.Thumbnails {
+		key := fmt.Sprintf("thumbnails/%d/%d-%d", attachment.ChannelId, attachment.AttachmentId, thumbnail.Size)
+		err = s.blobs.Put(ctx, key, bytes.NewReader(thumbnail.Data), int64(len(thumbnail.Data)), thumbnail.ContentType)
+		if err != nil {
+			return err
+		}
+		err = s.db.AddAttachmentThumbnail(database.AttachmentThumbnail{
+			AttachmentId: attachment.AttachmentId,
+			Size:         thumbnail.Size,
+			Width:        thumbnail.Width,
+			Height:       thumbnail.Height,
+			ContentType:  thumbnail.ContentType,
+			StorageKey:   key,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	err = s.db.SetAttachmentImageInfo(attachment.AttachmentId, info.Width, info.Height, info.BlurHash)
+	if err != nil {
+		return err
+	}
+
+	if attachment.MessageId == nil {
+		return nil
+	}
+	message, err := s.db.GetMessage(*attachment.MessageId)
+	if err != nil {
+		return err
+	}
+	byte_data, err := newServerResponse("message_updated", fromDBMessageToSeverMessage(message))
+	if err != nil {
+		return err
+	}
+	s.broadcastToChannel(message.ServerId, message.ChannelId, byte_data)
+	return nil
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore persists opaque binary objects under string keys. Keys use "/" as
+// a separator regardless of the backing implementation.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// NewFromEnv builds the blob store selected by BLOB_STORAGE ("local" or "s3").
+// Local storage is used when the variable is unset.
+func NewFromEnv() (BlobStore, error) {
+	switch os.Getenv("BLOB_STORAGE") {
+	case "", "local":
+		path := os.Getenv("BLOB_LOCAL_PATH")
+		if path == "" {
+			path = "./blobs"
+		}
+		return NewLocalStore(path), nil
+	case "s3":
+		return NewS3Store(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		})
+	default:
+		return nil, fmt.Errorf("unknown blob storage %q", os.Getenv("BLOB_STORAGE"))
+	}
+}
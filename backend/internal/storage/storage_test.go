@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testRoundTrip(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+	key := "attachments/1/abc"
+	data := []byte("hello world")
+	err := store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "text/plain")
+	if err != nil {
+		t.Fatalf("Put: err: %v", err)
+	}
+	r, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: err: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatalf("Get: err: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("Get: expected %q got %q", data, got)
+	}
+	err = store.Delete(ctx, key)
+	if err != nil {
+		t.Fatalf("Delete: err: %v", err)
+	}
+	_, err = store.Get(ctx, key)
+	if !errors.Is(err, ErrBlobNotFound) {
+		t.Fatalf("Get: expected ErrBlobNotFound got %v", err)
+	}
+}
+
+func TestLocalStore_RoundTrip(t *testing.T) {
+	testRoundTrip(t, NewLocalStore(t.TempDir()))
+}
+
+func TestLocalStore_RejectsTraversal(t *testing.T) {
+	store := NewLocalStore(t.TempDir())
+	err := store.Put(context.Background(), "../escape", strings.NewReader("x"), 1, "")
+	if err == nil {
+		t.Fatalf("Put: expected error for key outside of root")
+	}
+}
+
+// fakeS3 is a minimal S3 compatible server that checks request signatures
+// and keeps objects in memory.
+type fakeS3 struct {
+	t         *testing.T
+	bucket    string
+	secretKey string
+	mutex     sync.Mutex
+	objects   map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if !f.validSignature(r, body) {
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+f.bucket+"/")
+	if !ok {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[key] = body
+	case http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeS3) validSignature(r *http.Request, body []byte) bool {
+	auth := r.Header.Get("Authorization")
+	_, signature, ok := strings.Cut(auth, "Signature=")
+	if !ok {
+		return false
+	}
+	signed, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+	check := r.Clone(context.Background())
+	check.URL.Host = r.Host
+	check.Header.Del("Authorization")
+	signRequest(check, body, "us-east-1", "access", f.secretKey, signed)
+	_, expected, _ := strings.Cut(check.Header.Get("Authorization"), "Signature=")
+	return expected == signature
+}
+
+func TestS3Store_RoundTrip(t *testing.T) {
+	fake := &fakeS3{t: t, bucket: "chat", secretKey: "secret", objects: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	store, err := NewS3Store(S3Config{
+		Endpoint:  server.URL,
+		Bucket:    "chat",
+		AccessKey: "access",
+		SecretKey: "secret",
+	})
+	if err != nil {
+		t.Fatalf("NewS3Store: err: %v", err)
+	}
+	testRoundTrip(t, store)
+}
+
+func TestS3Store_BadCredentials(t *testing.T) {
+	fake := &fakeS3{t: t, bucket: "chat", secretKey: "secret", objects: map[string][]byte{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	store, err := NewS3Store(S3Config{
+		Endpoint:  server.URL,
+		Bucket:    "chat",
+		AccessKey: "access",
+		SecretKey: "wrong",
+	})
+	if err != nil {
+		t.Fatalf("NewS3Store: err: %v", err)
+	}
+	err = store.Put(context.Background(), "a", strings.NewReader("x"), 1, "text/plain")
+	if err == nil {
+		t.Fatalf("Put: expected error with invalid credentials")
+	}
+}
@@ -0,0 +1,68 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 test key of RFC 6238 appendix B.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeAt_RFC6238(t *testing.T) {
+	// the RFC lists eight digit codes, authenticator apps use the last six
+	for _, tc := range []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	} {
+		code, err := CodeAt(rfcSecret, Step(time.Unix(tc.unix, 0)))
+		if err != nil {
+			t.Fatalf("CodeAt: err: %v", err)
+		}
+		if code != tc.code {
+			t.Errorf("CodeAt(%d): expected %s got %s", tc.unix, tc.code, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: err: %v", err)
+	}
+	now := time.Now()
+	previous, _ := CodeAt(secret, Step(now)-1)
+	step, ok := Validate(secret, previous, now, 1)
+	if !ok || step != Step(now)-1 {
+		t.Fatalf("Validate: expected previous step to be accepted")
+	}
+	stale, _ := CodeAt(secret, Step(now)-3)
+	if _, ok := Validate(secret, stale, now, 1); ok {
+		t.Fatalf("Validate: expected stale code to be rejected")
+	}
+	if _, ok := Validate(secret, "12345", now, 1); ok {
+		t.Fatalf("Validate: expected short code to be rejected")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("go-chat", "u 1", "ABC")
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("url.Parse: err: %v", err)
+	}
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" || !strings.HasPrefix(parsed.Path, "/go-chat:u 1") {
+		t.Fatalf("URI: unexpected %s", uri)
+	}
+	if parsed.Query().Get("secret") != "ABC" || parsed.Query().Get("issuer") != "go-chat" {
+		t.Fatalf("URI: unexpected query %s", parsed.RawQuery)
+	}
+}
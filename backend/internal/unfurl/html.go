@@ -0,0 +1,66 @@
+package unfurl
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	tagPattern       = regexp.MustCompile(`(?is)<(meta|link)\b([^>]*)>`)
+	titlePattern     = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	attributePattern = regexp.MustCompile(`(?is)([a-z:_-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	headEndPattern   = regexp.MustCompile(`(?i)</head>|<body\b`)
+)
+
+type pageHead struct {
+	title  string
+	meta   map[string]string
+	oembed string
+}
+
+// parseHead pulls the title, meta tags and oEmbed discovery link out of the
+// head of an HTML document. Only the head is scanned and the first value of
+// every meta tag wins.
+func parseHead(document string) pageHead {
+	if loc := headEndPattern.FindStringIndex(document); loc != nil {
+		document = document[:loc[0]]
+	}
+	page := pageHead{meta: map[string]string{}}
+	if match := titlePattern.FindStringSubmatch(document); match != nil {
+		page.title = cleanText(match[1])
+	}
+	for _, match := range tagPattern.FindAllStringSubmatch(document, -1) {
+		attributes := parseAttributes(match[2])
+		switch strings.ToLower(match[1]) {
+		case "meta":
+			key := strings.ToLower(firstNonEmpty(attributes["property"], attributes["name"]))
+			if key == "" {
+				continue
+			}
+			if _, ok := page.meta[key]; !ok {
+				page.meta[key] = cleanText(attributes["content"])
+			}
+		case "link":
+			if strings.EqualFold(attributes["rel"], "alternate") &&
+				strings.EqualFold(attributes["type"], "application/json+oembed") &&
+				page.oembed == "" {
+				page.oembed = attributes["href"]
+			}
+		}
+	}
+	return page
+}
+
+func parseAttributes(raw string) map[string]string {
+	attributes := map[string]string{}
+	for _, match := range attributePattern.FindAllStringSubmatch(raw, -1) {
+		attributes[strings.ToLower(match[1])] = html.UnescapeString(match[2] + match[3] + match[4])
+	}
+	return attributes
+}
+
+// cleanText unescapes entities and collapses whitespace.
+func cleanText(value string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(value)), " ")
+}
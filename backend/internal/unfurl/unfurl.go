@@ -0,0 +1,301 @@
+// Package unfurl extracts links from message text and fetches OpenGraph and
+// oEmbed metadata for them so clients can render preview cards.
+package unfurl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// MaxURLsPerMessage bounds how many links of a single message are unfurled.
+	MaxURLsPerMessage = 5
+	defaultTimeout    = 5 * time.Second
+	defaultMaxBytes   = 1 << 20
+	maxRedirects      = 5
+	userAgent         = "go-chat-link-preview/1.0"
+)
+
+var (
+	ErrBlockedAddress = errors.New("unfurl: address not allowed")
+	ErrNoMetadata     = errors.New("unfurl: no preview metadata")
+)
+
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"'` + "`" + `]+`)
+
+// Preview is the metadata shown on a link card. URL is always the link as
+// posted, never the page's own og:url, so the card cannot point elsewhere.
+// Empty fields were not provided by the page.
+type Preview struct {
+	URL         string
+	Title       string
+	Description string
+	SiteName    string
+	ImageURL    string
+}
+
+// ExtractURLs returns the distinct http(s) links in text in order of
+// appearance, at most MaxURLsPerMessage of them. Links wrapped in <...> are
+// skipped, matching the common "suppress embed" convention.
+func ExtractURLs(text string) []string {
+	var urls []string
+	seen := map[string]bool{}
+	for _, match := range urlPattern.FindAllStringIndex(text, -1) {
+		if match[0] > 0 && text[match[0]-1] == '<' {
+			continue
+		}
+		raw := strings.TrimRight(text[match[0]:match[1]], ".,;:!?)]}*_~")
+		parsed, err := url.Parse(raw)
+		if err != nil || parsed.Host == "" {
+			continue
+		}
+		if seen[raw] {
+			continue
+		}
+		seen[raw] = true
+		urls = append(urls, raw)
+		if len(urls) == MaxURLsPerMessage {
+			break
+		}
+	}
+	return urls
+}
+
+// Fetcher downloads pages and extracts their preview metadata. Connections
+// to loopback, private, link-local and other internal ranges are refused
+// after DNS resolution, so neither redirects nor rebinding can reach
+// internal services.
+type Fetcher struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+// NewFetcher creates a fetcher with the given per request timeout. When
+// allowPrivate is set internal addresses are permitted, which is only
+// intended for tests against local servers.
+func NewFetcher(timeout time.Duration, allowPrivate bool) *Fetcher {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &Fetcher{
+		client: &http.Client{
+			Transport: newTransport(timeout, allowPrivate),
+			Timeout:   timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxRedirects {
+					return errors.New("unfurl: too many redirects")
+				}
+				if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+					return fmt.Errorf("unfurl: unsupported scheme %q", req.URL.Scheme)
+				}
+				return nil
+			},
+		},
+		maxBytes: defaultMaxBytes,
+	}
+}
+
+// NewClient returns a client for requests to other user supplied urls, such
+// as outgoing webhooks. Like a Fetcher it refuses internal addresses unless
+// allowPrivate is set, and it never follows redirects: the redirect response
+// itself is returned.
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &http.Client{
+		Transport: newTransport(timeout, allowPrivate),
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// newTransport dials only public addresses unless allowPrivate is set. The
+// check runs on the resolved address of every connection.
+func newTransport(timeout time.Duration, allowPrivate bool) *http.Transport {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || isBlockedIP(ip) {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+			}
+			return nil
+		}
+	}
+	return &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+}
+
+var blockedNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"127.0.0.0/8",
+		"169.254.0.0/16",
+		"172.16.0.0/12",
+		"192.0.0.0/24",
+		"192.168.0.0/16",
+		"198.18.0.0/15",
+		"224.0.0.0/4",
+		"240.0.0.0/4",
+		"::/128",
+		"::1/128",
+		"fc00::/7",
+		"fe80::/10",
+		"ff00::/8",
+	} {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+func isBlockedIP(ip net.IP) bool {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Fetcher) get(ctx context.Context, target string, accept string) (*http.Response, error) {
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("unfurl: unsupported scheme %q", parsed.Scheme)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", accept)
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unfurl: unexpected status %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// Fetch downloads target and returns its preview. Only the first megabyte
+// of the page is read. When the page advertises an oEmbed endpoint it is
+// consulted for anything OpenGraph did not provide.
+func (f *Fetcher) Fetch(ctx context.Context, target string) (Preview, error) {
+	resp, err := f.get(ctx, target, "text/html,application/xhtml+xml")
+	if err != nil {
+		return Preview{}, err
+	}
+	defer resp.Body.Close()
+	mediatype, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediatype != "text/html" && mediatype != "application/xhtml+xml" {
+		return Preview{}, fmt.Errorf("%w: content type %q", ErrNoMetadata, mediatype)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes))
+	if err != nil {
+		return Preview{}, err
+	}
+
+	page := parseHead(string(body))
+	preview := Preview{
+		URL:         target,
+		Title:       firstNonEmpty(page.meta["og:title"], page.meta["twitter:title"], page.title),
+		Description: firstNonEmpty(page.meta["og:description"], page.meta["twitter:description"], page.meta["description"]),
+		SiteName:    page.meta["og:site_name"],
+		ImageURL:    firstNonEmpty(page.meta["og:image"], page.meta["twitter:image"]),
+	}
+	if page.oembed != "" {
+		if oembed, err := f.fetchOEmbed(ctx, resolveURL(resp.Request.URL, page.oembed)); err == nil {
+			preview.Title = firstNonEmpty(preview.Title, oembed.Title)
+			preview.SiteName = firstNonEmpty(preview.SiteName, oembed.ProviderName)
+			preview.ImageURL = firstNonEmpty(preview.ImageURL, oembed.ThumbnailURL)
+		}
+	}
+	preview.ImageURL = resolveURL(resp.Request.URL, preview.ImageURL)
+	if preview.Title == "" && preview.Description == "" {
+		return Preview{}, ErrNoMetadata
+	}
+	preview.Title = truncate(preview.Title, 256)
+	preview.Description = truncate(preview.Description, 1024)
+	preview.SiteName = truncate(preview.SiteName, 256)
+	return preview, nil
+}
+
+type oembedResponse struct {
+	Title        string `json:"title"`
+	ProviderName string `json:"provider_name"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+func (f *Fetcher) fetchOEmbed(ctx context.Context, endpoint string) (oembedResponse, error) {
+	var oembed oembedResponse
+	resp, err := f.get(ctx, endpoint, "application/json")
+	if err != nil {
+		return oembed, err
+	}
+	defer resp.Body.Close()
+	err = json.NewDecoder(io.LimitReader(resp.Body, f.maxBytes)).Decode(&oembed)
+	return oembed, err
+}
+
+func resolveURL(base *url.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	parsed, err := base.Parse(ref)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return ""
+	}
+	return parsed.String()
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func truncate(value string, limit int) string {
+	runes := []rune(value)
+	if len(runes) <= limit {
+		return value
+	}
+	return string(runes[:limit-1]) + "…"
+}
@@ -0,0 +1,163 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExtractURLs(t *testing.T) {
+	text := "see https://example.com/a, and (https://example.com/b) " +
+		"not <https://example.com/hidden> but https://example.com/a again ftp://x.y"
+	got := ExtractURLs(text)
+	expected := []string{"https://example.com/a", "https://example.com/b"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("ExtractURLs: expected %v got %v", expected, got)
+	}
+	many := strings.Repeat("http://a.com/x ", 3) + "http://b.com http://c.com http://d.com http://e.com http://f.com"
+	if len(ExtractURLs(many)) != MaxURLsPerMessage {
+		t.Fatalf("ExtractURLs: expected at most %d urls", MaxURLsPerMessage)
+	}
+}
+
+func TestParseHead(t *testing.T) {
+	page := parseHead(`<html><head>
+		<title> Fallback
+			title </title>
+		<meta property="og:title" content="Tom &amp; Jerry">
+		<meta name='description' content='A cartoon'>
+		<link rel="alternate" type="application/json+oembed" href="/oembed?u=1">
+		</head><body><meta property="og:image" content="ignored"></body></html>`)
+	if page.title != "Fallback title" {
+		t.Errorf("parseHead: unexpected title %q", page.title)
+	}
+	if page.meta["og:title"] != "Tom & Jerry" || page.meta["description"] != "A cartoon" {
+		t.Errorf("parseHead: unexpected meta %v", page.meta)
+	}
+	if _, ok := page.meta["og:image"]; ok {
+		t.Errorf("parseHead: body tags should be ignored")
+	}
+	if page.oembed != "/oembed?u=1" {
+		t.Errorf("parseHead: unexpected oembed link %q", page.oembed)
+	}
+}
+
+func newSite(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/article", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head>
+			<meta property="og:title" content="Article">
+			<meta property="og:description" content="Something happened">
+			<meta property="og:image" content="/cover.png">
+			<link rel="alternate" type="application/json+oembed" href="/oembed">
+			</head></html>`))
+	})
+	mux.HandleFunc("/oembed", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"title":"ignored","provider_name":"Example Site"}`))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/article", http.StatusFound)
+	})
+	mux.HandleFunc("/huge", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head>"))
+		w.Write([]byte(strings.Repeat(" ", defaultMaxBytes)))
+		w.Write([]byte(`<title>too late</title></head>`))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(2 * time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png"))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetch(t *testing.T) {
+	site := newSite(t)
+	fetcher := NewFetcher(time.Second, true)
+	preview, err := fetcher.Fetch(context.Background(), site.URL+"/redirect")
+	if err != nil {
+		t.Fatalf("Fetch: err: %v", err)
+	}
+	expected := Preview{
+		URL:         site.URL + "/redirect",
+		Title:       "Article",
+		Description: "Something happened",
+		SiteName:    "Example Site",
+		ImageURL:    site.URL + "/cover.png",
+	}
+	if preview != expected {
+		t.Fatalf("Fetch: expected %+v got %+v", expected, preview)
+	}
+}
+
+func TestFetch_Limits(t *testing.T) {
+	site := newSite(t)
+	fetcher := NewFetcher(200*time.Millisecond, true)
+	for _, path := range []string{"/huge", "/slow", "/image", "/missing"} {
+		if _, err := fetcher.Fetch(context.Background(), site.URL+path); err == nil {
+			t.Errorf("Fetch %s: expected error", path)
+		}
+	}
+	if _, err := fetcher.Fetch(context.Background(), "file:///etc/passwd"); err == nil {
+		t.Errorf("Fetch: expected error for file scheme")
+	}
+}
+
+func TestFetch_BlocksPrivateAddresses(t *testing.T) {
+	site := newSite(t)
+	fetcher := NewFetcher(time.Second, false)
+	_, err := fetcher.Fetch(context.Background(), site.URL+"/article")
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("Fetch: expected ErrBlockedAddress got %v", err)
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	site := newSite(t)
+	if _, err := NewClient(time.Second, false).Get(site.URL + "/article"); !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("Get: expected ErrBlockedAddress got %v", err)
+	}
+	resp, err := NewClient(time.Second, true).Get(site.URL + "/redirect")
+	if err != nil {
+		t.Fatalf("Get: err: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 300 || resp.StatusCode > 399 {
+		t.Fatalf("Get: expected the redirect itself got %v", resp.Status)
+	}
+}
+
+func TestIsBlockedIP(t *testing.T) {
+	for ip, blocked := range map[string]bool{
+		"127.0.0.1":       true,
+		"10.1.2.3":        true,
+		"172.20.0.1":      true,
+		"192.168.1.1":     true,
+		"169.254.169.254": true,
+		"::1":             true,
+		"fd00::1":         true,
+		"::ffff:10.0.0.1": true,
+		"93.184.216.34":   false,
+		"2606:4700::1":    false,
+	} {
+		if isBlockedIP(net.ParseIP(ip)) != blocked {
+			t.Errorf("isBlockedIP(%s): expected %v", ip, blocked)
+		}
+	}
+}
@@ -1,9 +1,9 @@
 BEGIN TRANSACTION;
-INSERT INTO "ChannelTable" VALUES (1,1,'a','2024-08-11 16:21:34.482');
-INSERT INTO "ChannelTable" VALUES (2,1,'b','2024-08-11 16:21:34.482');
-INSERT INTO "ChannelTable" VALUES (3,2,'c','2024-08-11 16:21:34.482');
-INSERT INTO "ServerTable" VALUES (1,1,'server1');
-INSERT INTO "ServerTable" VALUES (2,2,'server2');
+INSERT INTO "ChannelTable" VALUES (1,1,'a','2024-08-11 16:21:34.482',50);
+INSERT INTO "ChannelTable" VALUES (2,1,'b','2024-08-11 16:21:34.482',50);
+INSERT INTO "ChannelTable" VALUES (3,2,'c','2024-08-11 16:21:34.482',50);
+INSERT INTO "ServerTable" VALUES (1,1,'server1',1073741824);
+INSERT INTO "ServerTable" VALUES (2,2,'server2',1073741824);
 INSERT INTO "UserNameLogTable" VALUES (1,1,'jsd','2024-08-11 16:21:34.482');
 INSERT INTO "UserNameLogTable" VALUES (2,2,'sdf','2024-08-11 16:21:37.504');
 INSERT INTO "UserNameLogTable" VALUES (3,3,'fdsajkl','2024-08-11 16:21:40.551');
@@ -25,9 +25,9 @@ INSERT INTO "UserNicknameLogTable" VALUES (8,3,1,'da','2024-08-11 16:35:27.378')
 INSERT INTO "UserNicknameLogTable" VALUES (9,1,1,'11','2024-08-11 16:35:33.416');
 INSERT INTO "UserNicknameLogTable" VALUES (10,2,2,'22','2024-08-11 16:35:35.372');
 INSERT INTO "UserNicknameLogTable" VALUES (11,3,1,'31','2024-08-11 16:35:37.261');
-INSERT INTO "UserTable" VALUES (1,'u1');
-INSERT INTO "UserTable" VALUES (2,'u2');
-INSERT INTO "UserTable" VALUES (3,'u3');
+INSERT INTO "UserTable" VALUES (1,'u1','','','','','','u1@example.com',1,0,0);
+INSERT INTO "UserTable" VALUES (2,'u2','','','','','','u2@example.com',0,0,0);
+INSERT INTO "UserTable" VALUES (3,'u3','','','','','','',0,0,0);
 INSERT INTO "UsersServerTable" VALUES (1,1,'11','2024-08-11 11:46:54.586');
 INSERT INTO "UsersServerTable" VALUES (2,2,'22','2024-08-11 12:03:51.120');
 INSERT INTO "UsersServerTable" VALUES (3,1,'31','2024-08-11 12:04:29.412');
@@ -35,11 +35,11 @@ INSERT INTO "UsersServerTable" VALUES (1,2,'aaa','2024-08-12 00:59:50.109');
 INSERT INTO "UserLoginTable" VALUES (1,'1salt1','salt1','token1','2024-11-16 20:50:08.398830109-05:00');
 INSERT INTO "UserLoginTable" VALUES (2,'2salt2','salt2','token2','2024-11-16 21:01:15.357025283-05:00');
 INSERT INTO "UserLoginTable" VALUES (3,'3salt3','salt3','c','2024-08-16 02:09:00.976');
-INSERT INTO "ChannelMessageTable" VALUES (1,1,1,'1111','2024-08-11 11:54:55.547',NULL,NULL);
-INSERT INTO "ChannelMessageTable" VALUES (2,1,1,'2111','2024-08-11 11:55:27.180',NULL,NULL);
-INSERT INTO "ChannelMessageTable" VALUES (3,3,2,'3232','2024-08-11 11:55:27.180',NULL,NULL);
-INSERT INTO "ChannelMessageTable" VALUES (4,2,3,'4123','2024-08-11 11:55:27.180',NULL,NULL);
-INSERT INTO "ChannelMessageTable" VALUES (5,1,1,'114','2024-08-16 02:09:00.976',NULL,NULL);
+INSERT INTO "ChannelMessageTable" VALUES (1,1,1,'1111','2024-08-11 11:54:55.547',NULL,NULL,NULL,NULL,'default',NULL);
+INSERT INTO "ChannelMessageTable" VALUES (2,1,1,'2111','2024-08-11 11:55:27.180',NULL,NULL,NULL,NULL,'default',NULL);
+INSERT INTO "ChannelMessageTable" VALUES (3,3,2,'3232','2024-08-11 11:55:27.180',NULL,NULL,NULL,NULL,'default',NULL);
+INSERT INTO "ChannelMessageTable" VALUES (4,2,3,'4123','2024-08-11 11:55:27.180',NULL,NULL,NULL,NULL,'default',NULL);
+INSERT INTO "ChannelMessageTable" VALUES (5,1,1,'114','2024-08-16 02:09:00.976',NULL,NULL,NULL,NULL,'default',NULL);
 INSERT INTO "UsersChannelTable" VALUES (1,1);
 INSERT INTO "UsersChannelTable" VALUES (3,2);
 INSERT INTO "UsersChannelTable" VALUES (2,3);
@@ -0,0 +1,260 @@
+// Package bot runs chat bots on top of the client package. A bot signs in
+// with the API token of a bot account, registers handlers for the events
+// and slash commands it cares about, and calls Run:
+//
+//	b, err := bot.New("https://chat.example.com", token, nil)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	b.Command(bot.Command{
+//		Name:        "ping",
+//		Description: "Check the bot is alive",
+//		Handler: func(ctx context.Context, c *bot.CommandContext) error {
+//			return c.Reply(ctx, "pong")
+//		},
+//	})
+//	log.Fatal(b.Run(ctx))
+//
+// The token needs the users:read and messages:read scopes to run, plus
+// messages:write to answer and commands:manage when commands are
+// registered. The server has no message reactions, so there are no
+// reaction events to handle.
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"go-chat-react/pkg/client"
+)
+
+// Options tunes a Bot. The zero value uses the defaults.
+type Options struct {
+	// HTTPClient makes the requests of the bot, http.DefaultClient when
+	// nil.
+	HTTPClient *http.Client
+	// Stream tunes how the bot reconnects when its connection drops.
+	Stream *client.StreamOptions
+	// SendRate is how many messages a second Send lets through once
+	// SendBurst messages went out at once.
+	SendRate  float64
+	SendBurst int
+	// Logger reports handler failures, log.Default when nil.
+	Logger *log.Logger
+}
+
+const (
+	defaultSendRate  = 5
+	defaultSendBurst = 5
+	// maxSendAttempts bounds how often Send retries a message the server
+	// rate limited.
+	maxSendAttempts = 3
+)
+
+// Message is a message the bot received.
+type Message struct {
+	client.Message
+	bot *Bot
+}
+
+// Reply answers the message in its channel.
+func (m *Message) Reply(ctx context.Context, text string) error {
+	_, err := m.bot.Send(ctx, m.ChannelID, text, m.MessageID)
+	return err
+}
+
+// MemberJoin is a user added to a channel the bot can see.
+type MemberJoin struct {
+	client.MembershipEvent
+	bot *Bot
+}
+
+// Send posts a message to the channel the user joined.
+func (m *MemberJoin) Send(ctx context.Context, text string) error {
+	_, err := m.bot.Send(ctx, m.ChannelID, text, 0)
+	return err
+}
+
+// Bot dispatches the events of a bot account to its handlers. Handlers are
+// registered before Run and each event is handled in its own goroutine, so
+// a slow handler does not hold up the others.
+type Bot struct {
+	client  *client.Client
+	stream  *client.StreamOptions
+	limiter *limiter
+	logger  *log.Logger
+
+	onMessage    []func(context.Context, *Message)
+	onMemberJoin []func(context.Context, *MemberJoin)
+	commands     map[string]Command
+	order        []string
+
+	mu sync.Mutex
+	me client.Session
+	wg sync.WaitGroup
+}
+
+// New creates a bot signing in with token on the server at baseURL. opts
+// may be nil.
+func New(baseURL string, token string, opts *Options) (*Bot, error) {
+	if token == "" {
+		return nil, errors.New("bot: missing token")
+	}
+	if opts == nil {
+		opts = &Options{}
+	}
+	c, err := client.New(baseURL, opts.HTTPClient)
+	if err != nil {
+		return nil, err
+	}
+	rate, burst := opts.SendRate, opts.SendBurst
+	if rate <= 0 {
+		rate = defaultSendRate
+	}
+	if burst <= 0 {
+		burst = defaultSendBurst
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &Bot{
+		client:   c.WithToken(token),
+		stream:   opts.Stream,
+		limiter:  newLimiter(rate, burst),
+		logger:   logger,
+		commands: map[string]Command{},
+	}, nil
+}
+
+// Client returns the client of the bot, for requests the bot package does
+// not wrap.
+func (b *Bot) Client() *client.Client {
+	return b.client
+}
+
+// Me returns the account of the bot, known once Run started.
+func (b *Bot) Me() client.Session {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.me
+}
+
+// OnMessage registers a handler for messages posted in the channels of the
+// bot. The bot's own messages are skipped.
+func (b *Bot) OnMessage(handler func(context.Context, *Message)) {
+	b.onMessage = append(b.onMessage, handler)
+}
+
+// OnMemberJoin registers a handler for users added to the channels of the
+// bot.
+func (b *Bot) OnMemberJoin(handler func(context.Context, *MemberJoin)) {
+	b.onMemberJoin = append(b.onMemberJoin, handler)
+}
+
+// Send posts a message to a channel, as a reply when replyTo is not zero.
+// Messages are spaced out to stay within the send rate, and a message the
+// server rate limits is sent again once it allows.
+func (b *Bot) Send(ctx context.Context, channelid client.ID, text string, replyTo client.ID) (*client.Posted, error) {
+	for attempt := 1; ; attempt++ {
+		if err := b.limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+		posted, err := b.client.SendMessage(ctx, channelid, text, replyTo)
+		var apiErr *client.Error
+		if attempt == maxSendAttempts || !errors.As(err, &apiErr) || !errors.Is(err, client.ErrRateLimited) {
+			return posted, err
+		}
+		wait := apiErr.RetryAfter
+		if wait <= 0 {
+			wait = time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Run connects the bot, registers its commands and handles events until
+// ctx is cancelled, which returns nil once running handlers finished. It
+// returns an error when the server refuses the token.
+func (b *Bot) Run(ctx context.Context) error {
+	me, err := b.client.Session(ctx)
+	if err != nil {
+		return fmt.Errorf("bot: session: %w", err)
+	}
+	b.mu.Lock()
+	b.me = *me
+	b.mu.Unlock()
+	if len(b.commands) > 0 {
+		if _, err := b.client.SetBotCommands(ctx, b.commandList(), ""); err != nil {
+			return fmt.Errorf("bot: register commands: %w", err)
+		}
+	}
+
+	stream := b.client.Stream(ctx, b.stream)
+	defer stream.Close()
+	defer b.wg.Wait()
+	for event := range stream.Events() {
+		b.dispatch(ctx, event)
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return fmt.Errorf("bot: stream: %w", stream.Err())
+}
+
+func (b *Bot) dispatch(ctx context.Context, event client.Event) {
+	switch event.Type {
+	case client.EventMessage:
+		var message client.Message
+		if err := event.Decode(&message); err != nil || message.UserID == b.Me().UserID {
+			return
+		}
+		for _, handler := range b.onMessage {
+			b.handle(event.Type, func() { handler(ctx, &Message{Message: message, bot: b}) })
+		}
+	case client.EventMemberJoined:
+		var joined client.MembershipEvent
+		if err := event.Decode(&joined); err != nil || joined.UserID == b.Me().UserID {
+			return
+		}
+		for _, handler := range b.onMemberJoin {
+			b.handle(event.Type, func() { handler(ctx, &MemberJoin{MembershipEvent: joined, bot: b}) })
+		}
+	case client.EventCommandInvoked:
+		var interaction client.Interaction
+		if err := event.Decode(&interaction); err != nil {
+			return
+		}
+		command, ok := b.commands[interaction.Command]
+		if !ok {
+			return
+		}
+		b.handle(event.Type, func() { b.runCommand(ctx, command, &interaction) })
+	case client.EventDisconnected:
+		b.logger.Printf("bot: disconnected: %v", event.Err)
+	}
+}
+
+// handle runs a handler in its own goroutine, logging rather than crashing
+// when it panics.
+func (b *Bot) handle(eventType string, run func()) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				b.logger.Printf("bot: %s handler panicked: %v", eventType, r)
+			}
+		}()
+		run()
+	}()
+}
@@ -0,0 +1,237 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-chat-react/internal/server"
+	"go-chat-react/internal/storage"
+	"go-chat-react/pkg/client"
+)
+
+// newTestBot serves the API over the mock data and creates a bot owned by
+// u1 in channel 1 of server 1. It returns the server, u1 signed in and the
+// bot.
+func newTestBot(t *testing.T) (*httptest.Server, *client.Client, *Bot) {
+	t.Helper()
+	db := server.NewInMemoryDB()
+	srv := server.New(db, storage.NewLocalStore(t.TempDir()))
+	ctx, cancel := context.WithCancel(context.Background())
+	go srv.Start(ctx)
+	ts := httptest.NewServer(srv.RegisterRoutes(false))
+	t.Cleanup(func() {
+		ts.Close()
+		cancel()
+	})
+
+	u1, err := client.New(ts.URL, ts.Client())
+	if err != nil {
+		t.Fatalf("New: err: %v", err)
+	}
+	if _, err := u1.Login(ctx, "u1", "1"); err != nil {
+		t.Fatalf("Login: err: %v", err)
+	}
+	botid, err := u1.CreateBot(ctx, "testbot")
+	if err != nil {
+		t.Fatalf("CreateBot: err: %v", err)
+	}
+	if err := db.AddUserToServer(uint(botid), 1, ""); err != nil {
+		t.Fatalf("AddUserToServer: err: %v", err)
+	}
+	if err := u1.AddChannelMember(ctx, 1, botid); err != nil {
+		t.Fatalf("AddChannelMember: err: %v", err)
+	}
+	created, err := u1.CreateBotAPIToken(ctx, botid, client.APITokenRequest{
+		Name:   "bot",
+		Scopes: []string{"users:read", "messages:read", "messages:write", "commands:manage"},
+	})
+	if err != nil {
+		t.Fatalf("CreateBotAPIToken: err: %v", err)
+	}
+	b, err := New(ts.URL, created.Token, &Options{
+		HTTPClient: ts.Client(),
+		Stream:     &client.StreamOptions{MinBackoff: 10 * time.Millisecond},
+		Logger:     log.New(io.Discard, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("New: err: %v", err)
+	}
+	return ts, u1, b
+}
+
+// run starts the bot and waits until it answers commands.
+func run(t *testing.T, b *Bot, u1 *client.Client) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run: err: %v", err)
+		}
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		posted, err := u1.SendMessage(context.Background(), 1, "/ping", 0)
+		if err == nil && posted.InteractionID != "" {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("the bot did not come online")
+}
+
+func nextEvent(t *testing.T, stream *client.Stream, eventType string, match func(client.Event) bool) client.Event {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event, ok := <-stream.Events():
+			if !ok {
+				t.Fatalf("stream ended waiting for %s: %v", eventType, stream.Err())
+			}
+			if event.Type == eventType && match(event) {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", eventType)
+		}
+	}
+}
+
+func messageFrom(userid client.ID, text string) func(client.Event) bool {
+	return func(event client.Event) bool {
+		var message client.Message
+		return event.Decode(&message) == nil && message.UserID == userid && message.Message == text
+	}
+}
+
+func TestBot(t *testing.T) {
+	_, u1, b := newTestBot(t)
+	ctx := context.Background()
+	b.Command(Command{
+		Name:        "ping",
+		Description: "Check the bot is alive",
+		Handler: func(ctx context.Context, c *CommandContext) error {
+			return c.ReplyEphemeral(ctx, "pong")
+		},
+	})
+	b.Command(Command{
+		Name:        "add",
+		Description: "Add two numbers",
+		Options: []client.CommandOption{
+			{Name: "a", Type: client.CommandOptionInteger, Required: true},
+			{Name: "b", Type: client.CommandOptionInteger, Required: true},
+		},
+		Handler: func(ctx context.Context, c *CommandContext) error {
+			if c.Int("b") == 0 {
+				return errors.New("b must not be zero")
+			}
+			return c.Reply(ctx, fmt.Sprint(c.Int("a")+c.Int("b")))
+		},
+	})
+	b.OnMessage(func(ctx context.Context, m *Message) {
+		m.Reply(ctx, "echo: "+m.Message.Message)
+	})
+	b.OnMemberJoin(func(ctx context.Context, m *MemberJoin) {
+		m.Send(ctx, fmt.Sprintf("welcome %d", m.UserID))
+	})
+
+	stream := u1.Stream(ctx, nil)
+	defer stream.Close()
+	nextEvent(t, stream, client.EventConnected, func(client.Event) bool { return true })
+	run(t, b, u1)
+	me := b.Me()
+	if me.UserName != "testbot" {
+		t.Fatalf("Me: unexpected session %+v", me)
+	}
+
+	if _, err := u1.SendMessage(ctx, 1, "hello", 0); err != nil {
+		t.Fatalf("SendMessage: err: %v", err)
+	}
+	var echo client.Message
+	if err := nextEvent(t, stream, client.EventMessage, messageFrom(me.UserID, "echo: hello")).Decode(&echo); err != nil {
+		t.Fatalf("Decode: err: %v", err)
+	}
+	if echo.ReplyTo == nil {
+		t.Fatalf("OnMessage: expected a reply, got %+v", echo)
+	}
+
+	if _, err := u1.SendMessage(ctx, 1, "/add 2 3", 0); err != nil {
+		t.Fatalf("SendMessage: err: %v", err)
+	}
+	nextEvent(t, stream, client.EventMessage, messageFrom(me.UserID, "5"))
+
+	if _, err := u1.SendMessage(ctx, 1, "/add 2 0", 0); err != nil {
+		t.Fatalf("SendMessage: err: %v", err)
+	}
+	nextEvent(t, stream, client.EventEphemeralMessage, func(event client.Event) bool {
+		var ephemeral client.EphemeralMessage
+		return event.Decode(&ephemeral) == nil && ephemeral.Message == "b must not be zero"
+	})
+
+	if err := u1.AddChannelMember(ctx, 1, 3); err != nil {
+		t.Fatalf("AddChannelMember: err: %v", err)
+	}
+	nextEvent(t, stream, client.EventMessage, messageFrom(me.UserID, "welcome 3"))
+}
+
+func TestRunRefused(t *testing.T) {
+	ts, _, _ := newTestBot(t)
+	b, err := New(ts.URL, "not-a-token", &Options{HTTPClient: ts.Client()})
+	if err != nil {
+		t.Fatalf("New: err: %v", err)
+	}
+	if err := b.Run(context.Background()); !errors.Is(err, client.ErrUnauthorized) {
+		t.Fatalf("Run: expected ErrUnauthorized, got %v", err)
+	}
+	if _, err := New(ts.URL, "", nil); err == nil {
+		t.Fatalf("New: expected an error without a token")
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(2, 2)
+	now := l.last
+	for i := range 2 {
+		if delay := l.reserve(now); delay != 0 {
+			t.Fatalf("reserve %d: expected no delay within the burst, got %v", i, delay)
+		}
+	}
+	if delay := l.reserve(now); delay != 500*time.Millisecond {
+		t.Fatalf("reserve: expected 500ms, got %v", delay)
+	}
+	if delay := l.reserve(now.Add(time.Second)); delay != 0 {
+		t.Fatalf("reserve: expected the bucket refilled, got %v", delay)
+	}
+}
+
+func TestCommandContext(t *testing.T) {
+	c := &CommandContext{Interaction: &client.Interaction{Args: map[string]any{
+		"text":  "hi",
+		"count": float64(3),
+		"loud":  true,
+		"in":    float64(90),
+		"user":  float64(2),
+		"tags":  []any{"a", float64(1)},
+	}}}
+	if c.String("text") != "hi" || c.Int("count") != 3 || !c.Bool("loud") || c.ID("user") != 2 {
+		t.Fatalf("unexpected values")
+	}
+	if c.Duration("in") != 90*time.Second {
+		t.Fatalf("Duration: got %v", c.Duration("in"))
+	}
+	if tags := c.Strings("tags"); len(tags) != 2 || tags[0] != "a" || tags[1] != "1" {
+		t.Fatalf("Strings: got %q", tags)
+	}
+	if c.Has("missing") || c.String("missing") != "" || c.Strings("missing") != nil {
+		t.Fatalf("expected missing options to be empty")
+	}
+}
@@ -0,0 +1,158 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go-chat-react/pkg/client"
+)
+
+// Command is a slash command the bot answers. The server parses the
+// arguments against Options before the handler runs, so handlers read them
+// already typed from the CommandContext. An error returned by the handler
+// is shown to the invoker alone.
+type Command struct {
+	Name        string
+	Description string
+	Usage       string
+	Options     []client.CommandOption
+	Handler     func(ctx context.Context, c *CommandContext) error
+}
+
+// Command registers a slash command, replacing any of the same name. The
+// commands are sent to the server when Run starts.
+func (b *Bot) Command(command Command) {
+	if _, ok := b.commands[command.Name]; !ok {
+		b.order = append(b.order, command.Name)
+	}
+	b.commands[command.Name] = command
+}
+
+func (b *Bot) commandList() []client.Command {
+	commands := make([]client.Command, 0, len(b.order))
+	for _, name := range b.order {
+		command := b.commands[name]
+		options := command.Options
+		if options == nil {
+			options = []client.CommandOption{}
+		}
+		commands = append(commands, client.Command{
+			Name:        command.Name,
+			Description: command.Description,
+			Usage:       command.Usage,
+			Options:     options,
+		})
+	}
+	return commands
+}
+
+func (b *Bot) runCommand(ctx context.Context, command Command, interaction *client.Interaction) {
+	c := &CommandContext{Interaction: interaction, bot: b}
+	err := command.Handler(ctx, c)
+	if err == nil || c.replied {
+		if err != nil {
+			b.logger.Printf("bot: /%s: %v", command.Name, err)
+		}
+		return
+	}
+	if replyErr := c.ReplyEphemeral(ctx, err.Error()); replyErr != nil {
+		b.logger.Printf("bot: /%s: %v, and could not tell the user: %v", command.Name, err, replyErr)
+	}
+}
+
+// CommandContext is an invocation of a command: who ran it where, with
+// which arguments. Each invocation can be answered once, within the
+// fifteen minutes the server keeps it.
+type CommandContext struct {
+	*client.Interaction
+	bot     *Bot
+	replied bool
+}
+
+// Bot returns the bot the command was sent to.
+func (c *CommandContext) Bot() *Bot {
+	return c.bot
+}
+
+// Reply answers the command with a message everyone in the channel sees.
+func (c *CommandContext) Reply(ctx context.Context, text string) error {
+	return c.respond(ctx, text, false)
+}
+
+// ReplyEphemeral answers the command with a message only the invoker sees.
+func (c *CommandContext) ReplyEphemeral(ctx context.Context, text string) error {
+	return c.respond(ctx, text, true)
+}
+
+func (c *CommandContext) respond(ctx context.Context, text string, ephemeral bool) error {
+	if err := c.bot.limiter.wait(ctx); err != nil {
+		return err
+	}
+	c.replied = true
+	_, err := c.bot.client.RespondToInteraction(ctx, c.InteractionID, text, ephemeral)
+	return err
+}
+
+// Has reports whether the invoker gave an option.
+func (c *CommandContext) Has(name string) bool {
+	_, ok := c.Args[name]
+	return ok
+}
+
+// String returns a string or text option, empty when not given.
+func (c *CommandContext) String(name string) string {
+	return stringValue(c.Args[name])
+}
+
+// Strings returns every value of a variadic option as text.
+func (c *CommandContext) Strings(name string) []string {
+	list, ok := c.Args[name].([]any)
+	if !ok {
+		if value, ok := c.Args[name]; ok {
+			return []string{stringValue(value)}
+		}
+		return nil
+	}
+	values := make([]string, len(list))
+	for i, item := range list {
+		values[i] = stringValue(item)
+	}
+	return values
+}
+
+// Int returns an integer option, zero when not given.
+func (c *CommandContext) Int(name string) int64 {
+	number, _ := c.Args[name].(float64)
+	return int64(number)
+}
+
+// Bool returns a boolean option, false when not given.
+func (c *CommandContext) Bool(name string) bool {
+	value, _ := c.Args[name].(bool)
+	return value
+}
+
+// Duration returns a duration option, zero when not given.
+func (c *CommandContext) Duration(name string) time.Duration {
+	return time.Duration(c.Int(name)) * time.Second
+}
+
+// ID returns a user or channel option, zero when not given.
+func (c *CommandContext) ID(name string) client.ID {
+	return client.ID(c.Int(name))
+}
+
+func stringValue(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return fmt.Sprint(value)
+	}
+}
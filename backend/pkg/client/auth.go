@@ -0,0 +1,93 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Login signs in with a username and password, keeping the session cookie
+// for later requests. Accounts with two-factor authentication only get a
+// challenge, see LoginResult.
+func (c *Client) Login(ctx context.Context, username string, password string) (*LoginResult, error) {
+	in := map[string]string{"username": username, "password": password}
+	var out LoginResult
+	if err := c.do(ctx, http.MethodPost, "/api/auth/login", nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CompleteTwoFactorLogin answers the challenge of a login with a code from
+// an authenticator app or a recovery code.
+func (c *Client) CompleteTwoFactorLogin(ctx context.Context, challenge string, code string) (*LoginResult, error) {
+	in := map[string]string{"challenge": challenge, "code": code}
+	var out LoginResult
+	if err := c.do(ctx, http.MethodPost, "/api/auth/login/2fa", nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// OIDCProviders lists the names of the single sign-on providers the server
+// accepts.
+func (c *Client) OIDCProviders(ctx context.Context) ([]string, error) {
+	var out struct {
+		Providers []string `json:"providers"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/auth/oidc/providers", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Providers, nil
+}
+
+// OIDCLoginURL returns where to send a browser to sign in with a provider.
+// The flow ends on the server's callback, so it cannot be driven by the
+// client itself.
+func (c *Client) OIDCLoginURL(provider string) string {
+	return c.url(pathf("/api/auth/oidc/%s/start", url.PathEscape(provider)), nil)
+}
+
+// Session returns the signed in user. Tokens need the users:read scope.
+func (c *Client) Session(ctx context.Context) (*Session, error) {
+	var out Session
+	if err := c.do(ctx, http.MethodPost, "/api/auth/session", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Logout ends the session.
+func (c *Client) Logout(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/api/auth/logout", nil, nil, nil)
+}
+
+// RequestPasswordReset mails a reset link to the account with a verified
+// email. It succeeds whether or not such an account exists.
+func (c *Client) RequestPasswordReset(ctx context.Context, email string) error {
+	in := map[string]string{"email": email}
+	return c.do(ctx, http.MethodPost, "/api/auth/password-reset", nil, in, nil)
+}
+
+// ConfirmPasswordReset sets a new password with the token of a reset link
+// and returns the id of the account.
+func (c *Client) ConfirmPasswordReset(ctx context.Context, token string, password string) (ID, error) {
+	in := map[string]string{"token": token, "password": password}
+	var out struct {
+		UserID ID `json:"userid"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/auth/password-reset/confirm", nil, in, &out); err != nil {
+		return 0, err
+	}
+	return out.UserID, nil
+}
+
+// VerifyEmail confirms an address with the token of a verification link.
+func (c *Client) VerifyEmail(ctx context.Context, token string) (*EmailStatus, error) {
+	in := map[string]string{"token": token}
+	var out EmailStatus
+	if err := c.do(ctx, http.MethodPost, "/api/auth/verify-email", nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
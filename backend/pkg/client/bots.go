@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// APITokens lists the tokens of the signed in user.
+func (c *Client) APITokens(ctx context.Context) (*APITokens, error) {
+	return c.apiTokens(ctx, "/api/users/me/tokens")
+}
+
+// CreateAPIToken issues a token for the signed in user.
+func (c *Client) CreateAPIToken(ctx context.Context, request APITokenRequest) (*CreatedAPIToken, error) {
+	return c.createAPIToken(ctx, "/api/users/me/tokens", request)
+}
+
+// DeleteAPIToken revokes a token of the signed in user.
+func (c *Client) DeleteAPIToken(ctx context.Context, tokenid ID) error {
+	return c.do(ctx, http.MethodDelete, pathf("/api/users/me/tokens/%d", tokenid), nil, nil, nil)
+}
+
+// Bots lists the bots the signed in user owns.
+func (c *Client) Bots(ctx context.Context) ([]Profile, error) {
+	var out struct {
+		Bots []Profile `json:"bots"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/users/me/bots", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Bots, nil
+}
+
+// CreateBot creates a bot account owned by the signed in user. Bots sign
+// in with tokens from CreateBotAPIToken.
+func (c *Client) CreateBot(ctx context.Context, username string) (ID, error) {
+	in := map[string]string{"username": username}
+	var out struct {
+		UserID ID `json:"userid"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/users/me/bots", nil, in, &out); err != nil {
+		return 0, err
+	}
+	return out.UserID, nil
+}
+
+// DeleteBot deletes a bot and revokes its tokens.
+func (c *Client) DeleteBot(ctx context.Context, botid ID) error {
+	return c.do(ctx, http.MethodDelete, pathf("/api/users/me/bots/%d", botid), nil, nil, nil)
+}
+
+// BotAPITokens lists the tokens of a bot.
+func (c *Client) BotAPITokens(ctx context.Context, botid ID) (*APITokens, error) {
+	return c.apiTokens(ctx, pathf("/api/users/me/bots/%d/tokens", botid))
+}
+
+// CreateBotAPIToken issues a token a bot signs in with.
+func (c *Client) CreateBotAPIToken(ctx context.Context, botid ID, request APITokenRequest) (*CreatedAPIToken, error) {
+	return c.createAPIToken(ctx, pathf("/api/users/me/bots/%d/tokens", botid), request)
+}
+
+// DeleteBotAPIToken revokes a token of a bot.
+func (c *Client) DeleteBotAPIToken(ctx context.Context, botid ID, tokenid ID) error {
+	return c.do(ctx, http.MethodDelete, pathf("/api/users/me/bots/%d/tokens/%d", botid, tokenid), nil, nil, nil)
+}
+
+func (c *Client) apiTokens(ctx context.Context, path string) (*APITokens, error) {
+	var out APITokens
+	if err := c.do(ctx, http.MethodGet, path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) createAPIToken(ctx context.Context, path string, request APITokenRequest) (*CreatedAPIToken, error) {
+	in := map[string]any{
+		"name":       request.Name,
+		"scopes":     request.Scopes,
+		"expires_in": int64(request.ExpiresIn.Seconds()),
+	}
+	var out CreatedAPIToken
+	if err := c.do(ctx, http.MethodPost, path, nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// BotCommands returns the slash commands the signed in bot registered.
+func (c *Client) BotCommands(ctx context.Context) (*BotCommands, error) {
+	var out BotCommands
+	if err := c.do(ctx, http.MethodGet, "/api/users/me/commands", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SetBotCommands replaces the slash commands of the signed in bot.
+// Interactions are posted to callbackURL, an https address, signed with
+// the returned CallbackSecret; with an empty URL they arrive over the
+// websocket as "command_invoked" events instead.
+func (c *Client) SetBotCommands(ctx context.Context, commands []Command, callbackURL string) (*BotCommands, error) {
+	if commands == nil {
+		commands = []Command{}
+	}
+	in := map[string]any{"commands": commands, "callback_url": callbackURL}
+	var out BotCommands
+	if err := c.do(ctx, http.MethodPut, "/api/users/me/commands", nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RespondToInteraction answers a command a user invoked, either in the
+// channel or, when ephemeral, to the invoker only.
+func (c *Client) RespondToInteraction(ctx context.Context, interactionid string, content string, ephemeral bool) (*Posted, error) {
+	in := map[string]any{"content": content, "ephemeral": ephemeral}
+	var out Posted
+	if err := c.do(ctx, http.MethodPost, pathf("/api/interactions/%s", url.PathEscape(interactionid)), nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
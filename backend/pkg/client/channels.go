@@ -0,0 +1,161 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// GetChannel returns a channel the signed in user is a member of.
+func (c *Client) GetChannel(ctx context.Context, channelid ID) (*Channel, error) {
+	var out Channel
+	if err := c.do(ctx, http.MethodGet, pathf("/api/channels/%d", channelid), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateChannel changes a channel of a server the signed in user owns.
+func (c *Client) UpdateChannel(ctx context.Context, channelid ID, update ChannelUpdate) error {
+	return c.do(ctx, http.MethodPatch, pathf("/api/channels/%d", channelid), nil, update, nil)
+}
+
+// DeleteChannel deletes a channel of a server the signed in user owns.
+func (c *Client) DeleteChannel(ctx context.Context, channelid ID) error {
+	return c.do(ctx, http.MethodDelete, pathf("/api/channels/%d", channelid), nil, nil, nil)
+}
+
+// ChannelMembers lists the users who can read a channel.
+func (c *Client) ChannelMembers(ctx context.Context, channelid ID) ([]User, error) {
+	var out struct {
+		Users []User `json:"users"`
+	}
+	if err := c.do(ctx, http.MethodGet, pathf("/api/channels/%d/members", channelid), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Users, nil
+}
+
+// AddChannelMember gives a member of the server access to one of its
+// channels. Only the owner of the server may do so.
+func (c *Client) AddChannelMember(ctx context.Context, channelid ID, userid ID) error {
+	in := map[string]string{"userid": strconv.FormatUint(uint64(userid), 10)}
+	return c.do(ctx, http.MethodPost, pathf("/api/channels/%d/members", channelid), nil, in, nil)
+}
+
+// RemoveChannelMember takes away the access of a user to a channel. Only
+// the owner of the server may do so.
+func (c *Client) RemoveChannelMember(ctx context.Context, channelid ID, userid ID) error {
+	in := map[string]string{"userid": strconv.FormatUint(uint64(userid), 10)}
+	return c.do(ctx, http.MethodDelete, pathf("/api/channels/%d/members", channelid), nil, in, nil)
+}
+
+// UploadAttachments posts a message with files attached. The message may
+// be empty.
+func (c *Client) UploadAttachments(ctx context.Context, channelid ID, message string, files []File) (*Posted, error) {
+	parts := make([]multipartFile, len(files))
+	for i, file := range files {
+		parts[i] = multipartFile{field: "file", name: file.Name, data: file.Data}
+	}
+	fields := map[string]string{"message": message}
+	var out Posted
+	path := pathf("/api/channels/%d/attachments", channelid)
+	if err := c.doMultipart(ctx, http.MethodPost, path, fields, parts, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DownloadAttachment fetches an attached file.
+func (c *Client) DownloadAttachment(ctx context.Context, attachmentid ID) (*Download, error) {
+	return c.download(ctx, pathf("/api/attachments/%d", attachmentid))
+}
+
+// DownloadThumbnail fetches a thumbnail of an image attachment. The sizes
+// offered are listed in Attachment.Thumbnails.
+func (c *Client) DownloadThumbnail(ctx context.Context, attachmentid ID, size int) (*Download, error) {
+	return c.download(ctx, pathf("/api/attachments/%d/thumbnails/%d", attachmentid, size))
+}
+
+// Webhooks lists the incoming webhooks of a channel the signed in user
+// manages.
+func (c *Client) Webhooks(ctx context.Context, channelid ID) ([]Webhook, error) {
+	var out struct {
+		Webhooks []Webhook `json:"webhooks"`
+	}
+	if err := c.do(ctx, http.MethodGet, pathf("/api/channels/%d/webhooks", channelid), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Webhooks, nil
+}
+
+// CreateWebhook adds an incoming webhook to a channel.
+func (c *Client) CreateWebhook(ctx context.Context, channelid ID, name string) (*CreatedWebhook, error) {
+	in := map[string]string{"name": name}
+	var out CreatedWebhook
+	if err := c.do(ctx, http.MethodPost, pathf("/api/channels/%d/webhooks", channelid), nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteWebhook removes an incoming webhook.
+func (c *Client) DeleteWebhook(ctx context.Context, channelid ID, webhookid ID) error {
+	return c.do(ctx, http.MethodDelete, pathf("/api/channels/%d/webhooks/%d", channelid, webhookid), nil, nil, nil)
+}
+
+// ParseWebhookURL splits the URL of an incoming webhook into its id and
+// secret.
+func ParseWebhookURL(webhookURL string) (ID, string, error) {
+	parsed, err := url.Parse(webhookURL)
+	if err != nil {
+		return 0, "", fmt.Errorf("client: invalid webhook url: %w", err)
+	}
+	rest, ok := strings.CutPrefix(parsed.Path, "/api/webhooks/")
+	idText, secret, found := strings.Cut(rest, "/")
+	if !ok || !found || secret == "" || strings.Contains(secret, "/") {
+		return 0, "", fmt.Errorf("client: %q is not a webhook url", webhookURL)
+	}
+	webhookid, err := strconv.ParseUint(idText, 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("client: %q is not a webhook url", webhookURL)
+	}
+	return ID(webhookid), secret, nil
+}
+
+// ExecuteWebhook posts a message through an incoming webhook. It needs no
+// sign in; the secret authorizes it.
+func (c *Client) ExecuteWebhook(ctx context.Context, webhookid ID, secret string, message WebhookMessage) (ID, error) {
+	var out struct {
+		MessageID ID `json:"messageid"`
+	}
+	path := pathf("/api/webhooks/%d/%s", webhookid, url.PathEscape(secret))
+	if err := c.do(ctx, http.MethodPost, path, nil, message, &out); err != nil {
+		return 0, err
+	}
+	return out.MessageID, nil
+}
+
+// Pins lists the pinned messages of a channel, most recently pinned first.
+func (c *Client) Pins(ctx context.Context, channelid ID) ([]PinnedMessage, error) {
+	var out struct {
+		Pins []PinnedMessage `json:"pins"`
+	}
+	if err := c.do(ctx, http.MethodGet, pathf("/api/channels/%d/pins", channelid), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Pins, nil
+}
+
+// PinMessage pins a message to its channel.
+func (c *Client) PinMessage(ctx context.Context, channelid ID, messageid ID) error {
+	return c.do(ctx, http.MethodPut, pathf("/api/channels/%d/pins/%d", channelid, messageid), nil, nil, nil)
+}
+
+// UnpinMessage unpins a message.
+func (c *Client) UnpinMessage(ctx context.Context, channelid ID, messageid ID) error {
+	return c.do(ctx, http.MethodDelete, pathf("/api/channels/%d/pins/%d", channelid, messageid), nil, nil, nil)
+}
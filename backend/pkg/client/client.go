@@ -0,0 +1,256 @@
+// Package client is a typed Go client for the go-chat REST and websocket
+// API.
+//
+// A Client signs in either with a session cookie, through Login or
+// CreateUser, or with an API token passed to WithToken. Every method takes a
+// context and returns an *Error when the server rejects the request, which
+// can be matched against ErrNotFound and the other sentinel errors with
+// errors.Is.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxErrorBody bounds how much of an error response is kept as its message.
+const maxErrorBody = 4 << 10
+
+// Client talks to one go-chat server. It is safe for concurrent use.
+type Client struct {
+	baseURL *url.URL
+	http    *http.Client
+	token   string
+	reason  string
+}
+
+// New returns a client for the server at baseURL, such as
+// "https://chat.example.com". httpClient may be nil. A cookie jar is added
+// when the client has none so a login lasts across requests; the caller's
+// client is never modified.
+func New(baseURL string, httpClient *http.Client) (*Client, error) {
+	parsed, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("client: invalid base url: %w", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("client: base url %q must be http or https", baseURL)
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+	if httpClient.Jar == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return nil, err
+		}
+		copied := *httpClient
+		copied.Jar = jar
+		httpClient = &copied
+	}
+	return &Client{baseURL: parsed, http: httpClient}, nil
+}
+
+// WithToken returns a copy of the client that authenticates with an API
+// token instead of the session cookie. Tokens only reach the routes their
+// scopes allow.
+func (c *Client) WithToken(token string) *Client {
+	copied := *c
+	copied.token = token
+	return &copied
+}
+
+// WithReason returns a copy of the client that gives reason for the
+// administrative changes it makes, such as deleting the message of another
+// member. Reasons are shown in the audit log of the server.
+func (c *Client) WithReason(reason string) *Client {
+	copied := *c
+	copied.reason = reason
+	return &copied
+}
+
+// BaseURL returns the address of the server.
+func (c *Client) BaseURL() string {
+	return c.baseURL.String()
+}
+
+func (c *Client) url(path string, query url.Values) string {
+	u := *c.baseURL
+	u.Path += path
+	if len(query) > 0 {
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+func (c *Client) newRequest(ctx context.Context, method string, target string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.reason != "" {
+		req.Header.Set("X-Audit-Log-Reason", url.PathEscape(c.reason))
+	}
+	return req, nil
+}
+
+// send performs a request and turns unsuccessful responses into an *Error.
+// The caller closes the body of the returned response.
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return nil, &Error{
+			StatusCode: resp.StatusCode,
+			Method:     req.Method,
+			Path:       req.URL.Path,
+			Message:    strings.TrimSpace(string(message)),
+			RetryAfter: retryAfter(resp.Header, time.Now()),
+		}
+	}
+	return resp, nil
+}
+
+// do sends in as a JSON body, when not nil, and decodes the response into
+// out, when not nil.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, in any, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := c.newRequest(ctx, method, c.url(path, query), body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	return decodeResponse(resp, out)
+}
+
+// decodeResponse decodes the body of a successful response into out, when
+// not nil, and closes it.
+func decodeResponse(resp *http.Response, out any) error {
+	defer resp.Body.Close()
+	if out == nil {
+		_, err := io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("client: %s %s: decoding response: %w", resp.Request.Method, resp.Request.URL.Path, err)
+	}
+	return nil
+}
+
+// multipartFile is one file field of a multipart upload.
+type multipartFile struct {
+	field string
+	name  string
+	data  []byte
+}
+
+// doMultipart sends files and plain fields as a multipart form and decodes
+// the response into out, when not nil.
+func (c *Client) doMultipart(ctx context.Context, method string, path string, fields map[string]string, files []multipartFile, out any) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for _, file := range files {
+		part, err := form.CreateFormFile(file.field, file.name)
+		if err != nil {
+			return err
+		}
+		if _, err := part.Write(file.data); err != nil {
+			return err
+		}
+	}
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			return err
+		}
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+	req, err := c.newRequest(ctx, method, c.url(path, nil), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	return decodeResponse(resp, out)
+}
+
+// download streams the body of a GET request. The caller closes it.
+func (c *Client) download(ctx context.Context, path string) (*Download, error) {
+	target := path
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		target = c.url(path, nil)
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+	return &Download{
+		ReadCloser:  resp.Body,
+		ContentType: resp.Header.Get("Content-Type"),
+		Size:        resp.ContentLength,
+	}, nil
+}
+
+// Download is a file served by the API, such as an attachment or avatar.
+type Download struct {
+	io.ReadCloser
+	ContentType string
+	// Size is -1 when the server did not announce it.
+	Size int64
+}
+
+// Download fetches a file by the URL the API handed out, such as
+// Attachment.URL or Profile.AvatarURL. Relative URLs are resolved against
+// the server.
+func (c *Client) Download(ctx context.Context, fileURL string) (*Download, error) {
+	return c.download(ctx, fileURL)
+}
+
+func pathf(format string, args ...any) string {
+	return fmt.Sprintf(format, args...)
+}
+
+func countQuery(count int) url.Values {
+	if count <= 0 {
+		return nil
+	}
+	return url.Values{"count": {strconv.Itoa(count)}}
+}
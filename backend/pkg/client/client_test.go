@@ -0,0 +1,513 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-chat-react/internal/server"
+	"go-chat-react/internal/storage"
+)
+
+// newTestServer serves the API over the mock data: users u1, u2 and u3
+// with passwords "1", "2" and "3", server 1 owned by u1 with channels 1 and
+// 2, and server 2 owned by u2 with channel 3.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := server.New(server.NewInMemoryDB(), storage.NewLocalStore(t.TempDir()))
+	ctx, cancel := context.WithCancel(context.Background())
+	go srv.Start(ctx)
+	ts := httptest.NewServer(srv.RegisterRoutes(false))
+	t.Cleanup(func() {
+		ts.Close()
+		cancel()
+	})
+	return ts
+}
+
+func newTestClient(t *testing.T, ts *httptest.Server) *Client {
+	t.Helper()
+	c, err := New(ts.URL, ts.Client())
+	if err != nil {
+		t.Fatalf("New: err: %v", err)
+	}
+	return c
+}
+
+func login(t *testing.T, ts *httptest.Server, username string, password string) *Client {
+	t.Helper()
+	c := newTestClient(t, ts)
+	if _, err := c.Login(context.Background(), username, password); err != nil {
+		t.Fatalf("Login(%s): err: %v", username, err)
+	}
+	return c
+}
+
+func TestNew(t *testing.T) {
+	for _, baseURL := range []string{"", "localhost:8080", "ftp://example.com", "://bad"} {
+		if _, err := New(baseURL, nil); err == nil {
+			t.Errorf("New(%q): expected an error", baseURL)
+		}
+	}
+	c, err := New("https://chat.example.com/", nil)
+	if err != nil {
+		t.Fatalf("New: err: %v", err)
+	}
+	if c.BaseURL() != "https://chat.example.com" {
+		t.Fatalf("BaseURL: got %q", c.BaseURL())
+	}
+	if got := c.OIDCLoginURL("google"); got != "https://chat.example.com/api/auth/oidc/google/start" {
+		t.Fatalf("OIDCLoginURL: got %q", got)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	c := newTestClient(t, ts)
+
+	_, err := c.Session(ctx)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || !errors.Is(err, ErrUnauthorized) || apiErr.Path != "/api/auth/session" {
+		t.Fatalf("Session: expected ErrUnauthorized, got %v", err)
+	}
+	if _, err := c.Login(ctx, "u1", "wrong"); !errors.Is(err, ErrBadRequest) {
+		t.Fatalf("Login: expected ErrBadRequest, got %v", err)
+	}
+
+	result, err := c.Login(ctx, "u1", "1")
+	if err != nil {
+		t.Fatalf("Login: err: %v", err)
+	}
+	if result.UserID != 1 || result.TwoFactorRequired {
+		t.Fatalf("Login: unexpected result %+v", result)
+	}
+	session, err := c.Session(ctx)
+	if err != nil {
+		t.Fatalf("Session: err: %v", err)
+	}
+	if session.UserID != 1 || session.UserName != "u1" {
+		t.Fatalf("Session: unexpected session %+v", session)
+	}
+
+	if err := c.Logout(ctx); err != nil {
+		t.Fatalf("Logout: err: %v", err)
+	}
+	if _, err := c.Session(ctx); err == nil {
+		t.Fatalf("Session: expected an error after Logout")
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	c := newTestClient(t, ts)
+
+	userid, err := c.CreateUser(ctx, "newuser", "a long password", "")
+	if err != nil {
+		t.Fatalf("CreateUser: err: %v", err)
+	}
+	bio := "hello"
+	profile, err := c.UpdateProfile(ctx, ProfileUpdate{Bio: &bio})
+	if err != nil {
+		t.Fatalf("UpdateProfile: err: %v", err)
+	}
+	if profile.UserID != userid || profile.Bio != "hello" {
+		t.Fatalf("UpdateProfile: unexpected profile %+v", profile)
+	}
+	profile, err = c.GetUser(ctx, userid)
+	if err != nil {
+		t.Fatalf("GetUser: err: %v", err)
+	}
+	if profile.UserName != "newuser" || profile.Bio != "hello" {
+		t.Fatalf("GetUser: unexpected profile %+v", profile)
+	}
+	if _, err := c.GetUser(ctx, 9999); err == nil {
+		t.Fatalf("GetUser: expected an error for a missing user")
+	}
+}
+
+func TestServersAndChannels(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	c := login(t, ts, "u1", "1")
+
+	servers, err := c.ServersOfUser(ctx, 1)
+	if err != nil {
+		t.Fatalf("ServersOfUser: err: %v", err)
+	}
+	if len(servers) != 2 {
+		t.Fatalf("ServersOfUser: expected 2 servers, got %+v", servers)
+	}
+	channels, err := c.ServerChannels(ctx, 1)
+	if err != nil {
+		t.Fatalf("ServerChannels: err: %v", err)
+	}
+	if len(channels) != 2 || channels[0].ServerID != 1 || channels[0].ChannelName == "" {
+		t.Fatalf("ServerChannels: unexpected channels %+v", channels)
+	}
+
+	serverid, err := c.CreateServer(ctx, "client test")
+	if err != nil {
+		t.Fatalf("CreateServer: err: %v", err)
+	}
+	got, err := c.GetServer(ctx, serverid)
+	if err != nil {
+		t.Fatalf("GetServer: err: %v", err)
+	}
+	if got.ServerName != "client test" || got.OwnerID != 1 {
+		t.Fatalf("GetServer: unexpected server %+v", got)
+	}
+	channelid, err := c.CreateChannel(ctx, serverid, "lobby")
+	if err != nil {
+		t.Fatalf("CreateChannel: err: %v", err)
+	}
+	name := "renamed"
+	if err := c.UpdateChannel(ctx, channelid, ChannelUpdate{ChannelName: &name}); err != nil {
+		t.Fatalf("UpdateChannel: err: %v", err)
+	}
+	channel, err := c.GetChannel(ctx, channelid)
+	if err != nil {
+		t.Fatalf("GetChannel: err: %v", err)
+	}
+	if channel.ChannelName != "renamed" || channel.ServerID != serverid {
+		t.Fatalf("GetChannel: unexpected channel %+v", channel)
+	}
+
+	members, err := c.ServerMembers(ctx, 1)
+	if err != nil {
+		t.Fatalf("ServerMembers: err: %v", err)
+	}
+	if len(members) != 2 {
+		t.Fatalf("ServerMembers: expected 2 members, got %+v", members)
+	}
+	member, err := c.SetNickname(ctx, 1, "boss")
+	if err != nil {
+		t.Fatalf("SetNickname: err: %v", err)
+	}
+	if member.Nickname != "boss" || member.DisplayName != "boss" {
+		t.Fatalf("SetNickname: unexpected member %+v", member)
+	}
+
+	u3 := login(t, ts, "u3", "3")
+	if err := u3.DeleteServer(ctx, 1); err == nil {
+		t.Fatalf("DeleteServer: expected an error for a non-owner")
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	c := login(t, ts, "u1", "1")
+
+	if err := c.WithReason("spam, again ✂").DeleteMessage(ctx, 2, 4); err != nil {
+		t.Fatalf("DeleteMessage: err: %v", err)
+	}
+	if err := c.RenameServer(ctx, 1, "renamed"); err != nil {
+		t.Fatalf("RenameServer: err: %v", err)
+	}
+	entries, err := c.AuditLog(ctx, 1, AuditLogQuery{})
+	if err != nil {
+		t.Fatalf("AuditLog: err: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Action != "server_update" || entries[0].After["servername"] != "renamed" {
+		t.Fatalf("AuditLog: unexpected entries %+v", entries)
+	}
+	if deletion := entries[1]; deletion.TargetID != 4 || deletion.ActorID != 1 || deletion.Reason != "spam, again ✂" {
+		t.Fatalf("AuditLog: unexpected deletion %+v", deletion)
+	}
+	filtered, err := c.AuditLog(ctx, 1, AuditLogQuery{Action: "message_delete", Count: 1})
+	if err != nil || len(filtered) != 1 || filtered[0].EntryID != entries[1].EntryID {
+		t.Fatalf("AuditLog: expected the deletion only got %+v err: %v", filtered, err)
+	}
+	older, err := c.AuditLog(ctx, 1, AuditLogQuery{Before: entries[1].EntryID})
+	if err != nil || len(older) != 0 {
+		t.Fatalf("AuditLog: expected nothing before the first entry got %+v err: %v", older, err)
+	}
+
+	u3 := login(t, ts, "u3", "3")
+	if _, err := u3.AuditLog(ctx, 1, AuditLogQuery{}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("AuditLog: expected ErrForbidden for a member got %v", err)
+	}
+}
+
+func TestMessages(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	c := login(t, ts, "u1", "1")
+
+	posted, err := c.SendMessage(ctx, 1, "hello from the client", 0)
+	if err != nil {
+		t.Fatalf("SendMessage: err: %v", err)
+	}
+	if posted.MessageID == 0 {
+		t.Fatalf("SendMessage: expected a message id, got %+v", posted)
+	}
+	reply, err := c.SendMessage(ctx, 1, "a reply", posted.MessageID)
+	if err != nil {
+		t.Fatalf("SendMessage: err: %v", err)
+	}
+	message, err := c.GetMessage(ctx, 1, reply.MessageID)
+	if err != nil {
+		t.Fatalf("GetMessage: err: %v", err)
+	}
+	if message.ReplyTo == nil || message.ReplyTo.MessageID != posted.MessageID || message.UserID != 1 {
+		t.Fatalf("GetMessage: unexpected message %+v", message)
+	}
+	if _, err := message.Time(); err != nil {
+		t.Fatalf("Message.Time: err: %v", err)
+	}
+
+	if err := c.EditMessage(ctx, 1, posted.MessageID, "edited"); err != nil {
+		t.Fatalf("EditMessage: err: %v", err)
+	}
+	messages, err := c.ChannelMessages(ctx, 1, 10)
+	if err != nil {
+		t.Fatalf("ChannelMessages: err: %v", err)
+	}
+	found := false
+	for _, m := range messages {
+		found = found || (m.MessageID == posted.MessageID && m.Message == "edited")
+	}
+	if !found {
+		t.Fatalf("ChannelMessages: edited message missing from %+v", messages)
+	}
+
+	threadReply, err := c.SendThreadMessage(ctx, 1, posted.MessageID, "in a thread", 0)
+	if err != nil {
+		t.Fatalf("SendThreadMessage: err: %v", err)
+	}
+	thread, err := c.Thread(ctx, 1, posted.MessageID, 0, 0)
+	if err != nil {
+		t.Fatalf("Thread: err: %v", err)
+	}
+	if thread.Root.MessageID != posted.MessageID || len(thread.Messages) != 1 || thread.Messages[0].MessageID != threadReply {
+		t.Fatalf("Thread: unexpected thread %+v", thread)
+	}
+
+	if err := c.PinMessage(ctx, 1, posted.MessageID); err != nil {
+		t.Fatalf("PinMessage: err: %v", err)
+	}
+	pins, err := c.Pins(ctx, 1)
+	if err != nil {
+		t.Fatalf("Pins: err: %v", err)
+	}
+	if len(pins) != 1 || pins[0].MessageID != posted.MessageID || pins[0].PinnedBy != 1 {
+		t.Fatalf("Pins: unexpected pins %+v", pins)
+	}
+
+	if err := c.DeleteMessage(ctx, 1, reply.MessageID); err != nil {
+		t.Fatalf("DeleteMessage: err: %v", err)
+	}
+	u2 := login(t, ts, "u2", "2")
+	if _, err := u2.SendMessage(ctx, 2, "hi", 0); !errors.Is(err, ErrBadRequest) {
+		t.Fatalf("SendMessage: expected ErrBadRequest for a non-member, got %v", err)
+	}
+	if _, err := u2.ChannelMessages(ctx, 2, 0); err == nil {
+		t.Fatalf("ChannelMessages: expected an error for a non-member")
+	}
+}
+
+func TestCommands(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	c := login(t, ts, "u1", "1")
+
+	commands, err := c.ChannelCommands(ctx, 1)
+	if err != nil {
+		t.Fatalf("ChannelCommands: err: %v", err)
+	}
+	if len(commands) == 0 {
+		t.Fatalf("ChannelCommands: expected the built-in commands")
+	}
+	complete, err := c.AutocompleteCommand(ctx, 1, "/shr")
+	if err != nil {
+		t.Fatalf("AutocompleteCommand: err: %v", err)
+	}
+	if len(complete.Suggestions) != 1 || complete.Suggestions[0].Value != "/shrug" {
+		t.Fatalf("AutocompleteCommand: unexpected suggestions %+v", complete.Suggestions)
+	}
+	posted, err := c.SendMessage(ctx, 1, "/help", 0)
+	if err != nil {
+		t.Fatalf("SendMessage: err: %v", err)
+	}
+	if posted.Ephemeral == nil || posted.Ephemeral.Command != "help" || posted.MessageID != 0 {
+		t.Fatalf("SendMessage: expected an ephemeral help, got %+v", posted)
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	c := login(t, ts, "u1", "1")
+
+	botid, err := c.CreateBot(ctx, "clientbot")
+	if err != nil {
+		t.Fatalf("CreateBot: err: %v", err)
+	}
+	created, err := c.CreateBotAPIToken(ctx, botid, APITokenRequest{
+		Name:      "reader",
+		Scopes:    []string{"messages:read"},
+		ExpiresIn: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("CreateBotAPIToken: err: %v", err)
+	}
+	if created.Token == "" || created.Info.Expires == nil {
+		t.Fatalf("CreateBotAPIToken: unexpected token %+v", created)
+	}
+	tokens, err := c.BotAPITokens(ctx, botid)
+	if err != nil {
+		t.Fatalf("BotAPITokens: err: %v", err)
+	}
+	if len(tokens.Tokens) != 1 || tokens.Tokens[0].TokenID != created.Info.TokenID || len(tokens.Scopes) == 0 {
+		t.Fatalf("BotAPITokens: unexpected tokens %+v", tokens)
+	}
+
+	bot := newTestClient(t, ts).WithToken(created.Token)
+	if _, err := bot.Session(ctx); !errors.Is(err, ErrForbidden) {
+		// the token lacks the users:read scope
+		t.Fatalf("Session: expected ErrForbidden, got %v", err)
+	}
+	if _, err := bot.ChannelCommands(ctx, 1); !errors.Is(err, ErrForbidden) {
+		// the bot has not joined any server
+		t.Fatalf("ChannelCommands: expected ErrForbidden, got %v", err)
+	}
+
+	if err := c.DeleteBotAPIToken(ctx, botid, created.Info.TokenID); err != nil {
+		t.Fatalf("DeleteBotAPIToken: err: %v", err)
+	}
+	if _, err := bot.ChannelCommands(ctx, 1); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("ChannelCommands: expected ErrUnauthorized after revoking, got %v", err)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	c := login(t, ts, "u1", "1")
+
+	created, err := c.CreateWebhook(ctx, 1, "ci")
+	if err != nil {
+		t.Fatalf("CreateWebhook: err: %v", err)
+	}
+	webhookid, secret, err := ParseWebhookURL(created.URL)
+	if err != nil {
+		t.Fatalf("ParseWebhookURL: err: %v", err)
+	}
+	if webhookid != created.Webhook.WebhookID {
+		t.Fatalf("ParseWebhookURL: got id %d, want %d", webhookid, created.Webhook.WebhookID)
+	}
+
+	anonymous := newTestClient(t, ts)
+	messageid, err := anonymous.ExecuteWebhook(ctx, webhookid, secret, WebhookMessage{Content: "build passed"})
+	if err != nil {
+		t.Fatalf("ExecuteWebhook: err: %v", err)
+	}
+	message, err := c.GetMessage(ctx, 1, messageid)
+	if err != nil {
+		t.Fatalf("GetMessage: err: %v", err)
+	}
+	if message.Message != "build passed" || message.Webhook == nil || message.Webhook.WebhookID != webhookid {
+		t.Fatalf("GetMessage: unexpected message %+v", message)
+	}
+	if _, err := anonymous.ExecuteWebhook(ctx, webhookid, "wrong", WebhookMessage{Content: "x"}); err == nil {
+		t.Fatalf("ExecuteWebhook: expected an error for a wrong secret")
+	}
+
+	if err := c.DeleteWebhook(ctx, 1, webhookid); err != nil {
+		t.Fatalf("DeleteWebhook: err: %v", err)
+	}
+	webhooks, err := c.Webhooks(ctx, 1)
+	if err != nil {
+		t.Fatalf("Webhooks: err: %v", err)
+	}
+	if len(webhooks) != 0 {
+		t.Fatalf("Webhooks: expected none, got %+v", webhooks)
+	}
+}
+
+func TestParseWebhookURL(t *testing.T) {
+	webhookid, secret, err := ParseWebhookURL("https://chat.example.com/api/webhooks/12/abc")
+	if err != nil || webhookid != 12 || secret != "abc" {
+		t.Fatalf("ParseWebhookURL: got %d, %q, %v", webhookid, secret, err)
+	}
+	for _, bad := range []string{
+		"https://chat.example.com/api/webhooks/12",
+		"https://chat.example.com/api/webhooks/x/abc",
+		"https://chat.example.com/api/channels/12/abc",
+		"https://chat.example.com/api/webhooks/12/abc/def",
+	} {
+		if _, _, err := ParseWebhookURL(bad); err == nil {
+			t.Errorf("ParseWebhookURL(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	c := login(t, ts, "u1", "1")
+
+	posted, err := c.UploadAttachments(ctx, 1, "notes attached", []File{{Name: "notes.txt", Data: []byte("some notes")}})
+	if err != nil {
+		t.Fatalf("UploadAttachments: err: %v", err)
+	}
+	if posted.MessageID == 0 || len(posted.Attachments) != 1 || posted.Attachments[0].FileName != "notes.txt" {
+		t.Fatalf("UploadAttachments: unexpected response %+v", posted)
+	}
+	download, err := c.Download(ctx, posted.Attachments[0].URL)
+	if err != nil {
+		t.Fatalf("Download: err: %v", err)
+	}
+	defer download.Close()
+	data, err := io.ReadAll(download)
+	if err != nil {
+		t.Fatalf("Download: read: %v", err)
+	}
+	if string(data) != "some notes" || !strings.HasPrefix(download.ContentType, "text/plain") {
+		t.Fatalf("Download: got %q as %q", data, download.ContentType)
+	}
+	if _, err := c.DownloadAttachment(ctx, 9999); err == nil {
+		t.Fatalf("DownloadAttachment: expected an error for a missing attachment")
+	}
+}
+
+func TestAvatar(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	c := login(t, ts, "u1", "1")
+
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	img.Set(1, 1, color.RGBA{R: 255, A: 255})
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		t.Fatalf("png.Encode: err: %v", err)
+	}
+	profile, err := c.UploadAvatar(ctx, "avatar.png", encoded.Bytes())
+	if err != nil {
+		t.Fatalf("UploadAvatar: err: %v", err)
+	}
+	if profile.AvatarURL == "" {
+		t.Fatalf("UploadAvatar: expected an avatar url, got %+v", profile)
+	}
+	download, err := c.Download(ctx, profile.AvatarURL)
+	if err != nil {
+		t.Fatalf("Download: err: %v", err)
+	}
+	download.Close()
+	if download.ContentType != "image/png" {
+		t.Fatalf("Download: got content type %q", download.ContentType)
+	}
+	if _, err := c.UploadAvatar(ctx, "avatar.png", []byte("not an image")); !errors.Is(err, ErrBadRequest) {
+		t.Fatalf("UploadAvatar: expected ErrBadRequest, got %v", err)
+	}
+}
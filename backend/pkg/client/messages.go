@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ChannelMessages returns the latest messages of a channel. A count of
+// zero uses the server's default.
+func (c *Client) ChannelMessages(ctx context.Context, channelid ID, count int) ([]Message, error) {
+	var out struct {
+		Messages []Message `json:"messages"`
+	}
+	path := pathf("/api/channels/%d/messages", channelid)
+	if err := c.do(ctx, http.MethodGet, path, countQuery(count), nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Messages, nil
+}
+
+// SendMessage posts a message to a channel, as a reply when replyTo is not
+// zero. Messages starting with "/" run a slash command instead; Posted
+// tells which happened.
+func (c *Client) SendMessage(ctx context.Context, channelid ID, message string, replyTo ID) (*Posted, error) {
+	var out Posted
+	path := pathf("/api/channels/%d/messages", channelid)
+	if err := c.do(ctx, http.MethodPost, path, nil, messageBody(message, replyTo), &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func messageBody(message string, replyTo ID) map[string]any {
+	in := map[string]any{"message": message}
+	if replyTo != 0 {
+		in["reply_to"] = replyTo
+	}
+	return in
+}
+
+// GetMessage returns a single message.
+func (c *Client) GetMessage(ctx context.Context, channelid ID, messageid ID) (*Message, error) {
+	var out Message
+	path := pathf("/api/channels/%d/messages/%d", channelid, messageid)
+	if err := c.do(ctx, http.MethodGet, path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// EditMessage replaces the text of a message the signed in user wrote.
+func (c *Client) EditMessage(ctx context.Context, channelid ID, messageid ID, message string) error {
+	in := map[string]string{"message": message}
+	path := pathf("/api/channels/%d/messages/%d", channelid, messageid)
+	return c.do(ctx, http.MethodPatch, path, nil, in, nil)
+}
+
+// DeleteMessage deletes a message the signed in user wrote, or any message
+// in a server they own.
+func (c *Client) DeleteMessage(ctx context.Context, channelid ID, messageid ID) error {
+	path := pathf("/api/channels/%d/messages/%d", channelid, messageid)
+	return c.do(ctx, http.MethodDelete, path, nil, nil, nil)
+}
+
+// Thread returns the root of a thread with a page of its replies. Replies
+// older than before are returned when it is not zero, which pages back
+// through long threads. A count of zero uses the server's default.
+func (c *Client) Thread(ctx context.Context, channelid ID, rootid ID, count int, before ID) (*Thread, error) {
+	query := countQuery(count)
+	if before != 0 {
+		if query == nil {
+			query = url.Values{}
+		}
+		query.Set("before", strconv.FormatUint(uint64(before), 10))
+	}
+	var out Thread
+	path := pathf("/api/channels/%d/messages/%d/thread", channelid, rootid)
+	if err := c.do(ctx, http.MethodGet, path, query, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SendThreadMessage replies in the thread of a message, starting the
+// thread when it has none.
+func (c *Client) SendThreadMessage(ctx context.Context, channelid ID, rootid ID, message string, replyTo ID) (ID, error) {
+	var out struct {
+		MessageID ID `json:"messageid"`
+	}
+	path := pathf("/api/channels/%d/messages/%d/thread", channelid, rootid)
+	if err := c.do(ctx, http.MethodPost, path, nil, messageBody(message, replyTo), &out); err != nil {
+		return 0, err
+	}
+	return out.MessageID, nil
+}
+
+// FollowThread subscribes the signed in user to replies in a thread.
+func (c *Client) FollowThread(ctx context.Context, channelid ID, rootid ID) error {
+	path := pathf("/api/channels/%d/messages/%d/thread/follow", channelid, rootid)
+	return c.do(ctx, http.MethodPut, path, nil, nil, nil)
+}
+
+// UnfollowThread unsubscribes the signed in user from a thread.
+func (c *Client) UnfollowThread(ctx context.Context, channelid ID, rootid ID) error {
+	path := pathf("/api/channels/%d/messages/%d/thread/follow", channelid, rootid)
+	return c.do(ctx, http.MethodDelete, path, nil, nil, nil)
+}
+
+// ChannelCommands lists the slash commands usable in a channel.
+func (c *Client) ChannelCommands(ctx context.Context, channelid ID) ([]Command, error) {
+	var out struct {
+		Commands []Command `json:"commands"`
+	}
+	if err := c.do(ctx, http.MethodGet, pathf("/api/channels/%d/commands", channelid), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Commands, nil
+}
+
+// AutocompleteCommand suggests how to continue text, a partially typed
+// command starting with "/".
+func (c *Client) AutocompleteCommand(ctx context.Context, channelid ID, text string) (*Autocomplete, error) {
+	var out Autocomplete
+	path := pathf("/api/channels/%d/commands/autocomplete", channelid)
+	if err := c.do(ctx, http.MethodGet, path, url.Values{"text": {text}}, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
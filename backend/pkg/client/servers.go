@@ -0,0 +1,233 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// CreateServer creates a server owned by the signed in user.
+func (c *Client) CreateServer(ctx context.Context, name string) (ID, error) {
+	in := map[string]string{"servername": name}
+	var out struct {
+		ServerID ID `json:"serverid"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/servers", nil, in, &out); err != nil {
+		return 0, err
+	}
+	return out.ServerID, nil
+}
+
+// GetServer returns the name and owner of a server.
+func (c *Client) GetServer(ctx context.Context, serverid ID) (*Server, error) {
+	var out Server
+	if err := c.do(ctx, http.MethodGet, pathf("/api/servers/%d", serverid), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RenameServer changes the name of a server the signed in user owns.
+func (c *Client) RenameServer(ctx context.Context, serverid ID, name string) error {
+	in := map[string]string{"servername": name}
+	return c.do(ctx, http.MethodPatch, pathf("/api/servers/%d", serverid), nil, in, nil)
+}
+
+// DeleteServer deletes a server the signed in user owns, with its channels
+// and messages.
+func (c *Client) DeleteServer(ctx context.Context, serverid ID) error {
+	return c.do(ctx, http.MethodDelete, pathf("/api/servers/%d", serverid), nil, nil, nil)
+}
+
+// ServerChannels lists the channels of a server the signed in user can see.
+func (c *Client) ServerChannels(ctx context.Context, serverid ID) ([]Channel, error) {
+	var out struct {
+		Channels []Channel `json:"channels"`
+	}
+	if err := c.do(ctx, http.MethodGet, pathf("/api/servers/%d/channels", serverid), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Channels, nil
+}
+
+// CreateChannel adds a channel to a server.
+func (c *Client) CreateChannel(ctx context.Context, serverid ID, name string) (ID, error) {
+	in := map[string]string{"channelname": name}
+	var out struct {
+		ChannelID ID `json:"channelid"`
+	}
+	if err := c.do(ctx, http.MethodPost, pathf("/api/servers/%d/channels", serverid), nil, in, &out); err != nil {
+		return 0, err
+	}
+	return out.ChannelID, nil
+}
+
+// ServerMembers lists the members of a server.
+func (c *Client) ServerMembers(ctx context.Context, serverid ID) ([]Member, error) {
+	var out struct {
+		Users []Member `json:"users"`
+	}
+	if err := c.do(ctx, http.MethodGet, pathf("/api/servers/%d/members", serverid), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Users, nil
+}
+
+// SetNickname sets the nickname of the signed in user in a server. An
+// empty nickname clears it.
+func (c *Client) SetNickname(ctx context.Context, serverid ID, nickname string) (*Member, error) {
+	return c.setNickname(ctx, pathf("/api/servers/%d/members/me/nickname", serverid), nickname)
+}
+
+// SetMemberNickname sets the nickname of another member, which only the
+// owner of the server may do.
+func (c *Client) SetMemberNickname(ctx context.Context, serverid ID, userid ID, nickname string) (*Member, error) {
+	return c.setNickname(ctx, pathf("/api/servers/%d/members/%d/nickname", serverid, userid), nickname)
+}
+
+func (c *Client) setNickname(ctx context.Context, path string, nickname string) (*Member, error) {
+	in := map[string]string{"nickname": nickname}
+	var out Member
+	if err := c.do(ctx, http.MethodPatch, path, nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// NicknameHistory lists the previous nicknames of a member.
+func (c *Client) NicknameHistory(ctx context.Context, serverid ID, userid ID) ([]NameHistoryEntry, error) {
+	var out struct {
+		Nicknames []NameHistoryEntry `json:"nicknames"`
+	}
+	path := pathf("/api/servers/%d/members/%d/nicknames", serverid, userid)
+	if err := c.do(ctx, http.MethodGet, path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Nicknames, nil
+}
+
+// ServerMessages returns the latest messages across the channels of a
+// server. A count of zero uses the server's default.
+func (c *Client) ServerMessages(ctx context.Context, serverid ID, count int) ([]Message, error) {
+	var out struct {
+		Messages []Message `json:"messages"`
+	}
+	path := pathf("/api/servers/%d/messages", serverid)
+	if err := c.do(ctx, http.MethodGet, path, countQuery(count), nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Messages, nil
+}
+
+// EventEndpoints lists the outgoing webhooks of a server the signed in
+// user owns.
+func (c *Client) EventEndpoints(ctx context.Context, serverid ID) (*EventEndpoints, error) {
+	var out EventEndpoints
+	path := pathf("/api/servers/%d/outgoing-webhooks", serverid)
+	if err := c.do(ctx, http.MethodGet, path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateEventEndpoint subscribes an https url to events of a server.
+func (c *Client) CreateEventEndpoint(ctx context.Context, serverid ID, url string, events []string) (*CreatedEventEndpoint, error) {
+	in := map[string]any{"url": url, "events": events}
+	var out CreatedEventEndpoint
+	path := pathf("/api/servers/%d/outgoing-webhooks", serverid)
+	if err := c.do(ctx, http.MethodPost, path, nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateEventEndpoint changes an outgoing webhook. Enabling it again
+// resets its failure count.
+func (c *Client) UpdateEventEndpoint(ctx context.Context, serverid ID, endpointid ID, update EventEndpointUpdate) (*EventEndpoint, error) {
+	var out struct {
+		Endpoint EventEndpoint `json:"endpoint"`
+	}
+	path := pathf("/api/servers/%d/outgoing-webhooks/%d", serverid, endpointid)
+	if err := c.do(ctx, http.MethodPatch, path, nil, update, &out); err != nil {
+		return nil, err
+	}
+	return &out.Endpoint, nil
+}
+
+// DeleteEventEndpoint removes an outgoing webhook.
+func (c *Client) DeleteEventEndpoint(ctx context.Context, serverid ID, endpointid ID) error {
+	path := pathf("/api/servers/%d/outgoing-webhooks/%d", serverid, endpointid)
+	return c.do(ctx, http.MethodDelete, path, nil, nil, nil)
+}
+
+// AuditLog lists the administrative changes made to a server the signed in
+// user owns, newest first.
+func (c *Client) AuditLog(ctx context.Context, serverid ID, q AuditLogQuery) ([]AuditEntry, error) {
+	query := countQuery(q.Count)
+	if query == nil {
+		query = url.Values{}
+	}
+	if q.ActorID != 0 {
+		query.Set("actorid", strconv.FormatUint(uint64(q.ActorID), 10))
+	}
+	if q.Action != "" {
+		query.Set("action", q.Action)
+	}
+	if q.Before != 0 {
+		query.Set("before", strconv.FormatUint(uint64(q.Before), 10))
+	}
+	var out struct {
+		Entries []AuditEntry `json:"entries"`
+	}
+	path := pathf("/api/servers/%d/audit-log", serverid)
+	if err := c.do(ctx, http.MethodGet, path, query, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Entries, nil
+}
+
+// Restrictions lists the timeouts and mutes of a server that have not
+// expired yet, soonest to expire first.
+func (c *Client) Restrictions(ctx context.Context, serverid ID) ([]Restriction, error) {
+	var out struct {
+		Restrictions []Restriction `json:"restrictions"`
+	}
+	path := pathf("/api/servers/%d/restrictions", serverid)
+	if err := c.do(ctx, http.MethodGet, path, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Restrictions, nil
+}
+
+// Restrict times a member out of a server or mutes them in a channel.
+// Restricting them again in the same place replaces the restriction.
+func (c *Client) Restrict(ctx context.Context, serverid ID, in RestrictionRequest) (*Restriction, error) {
+	var out struct {
+		Restriction Restriction `json:"restriction"`
+	}
+	path := pathf("/api/servers/%d/restrictions", serverid)
+	if err := c.do(ctx, http.MethodPost, path, nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out.Restriction, nil
+}
+
+// LiftRestriction ends a timeout or mute before it expires.
+func (c *Client) LiftRestriction(ctx context.Context, serverid ID, restrictionid ID) error {
+	path := pathf("/api/servers/%d/restrictions/%d", serverid, restrictionid)
+	return c.do(ctx, http.MethodDelete, path, nil, nil, nil)
+}
+
+// EventDeliveries lists the recent deliveries of an outgoing webhook,
+// newest first.
+func (c *Client) EventDeliveries(ctx context.Context, serverid ID, endpointid ID, count int) ([]EventDelivery, error) {
+	var out struct {
+		Deliveries []EventDelivery `json:"deliveries"`
+	}
+	path := pathf("/api/servers/%d/outgoing-webhooks/%d/deliveries", serverid, endpointid)
+	if err := c.do(ctx, http.MethodGet, path, countQuery(count), nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Deliveries, nil
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// DirectMessages lists the direct message channels of the signed in user.
+func (c *Client) DirectMessages(ctx context.Context) ([]DirectMessage, error) {
+	var out struct {
+		DMs []DirectMessage `json:"dms"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/users/me/dms", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.DMs, nil
+}
+
+// CreateDirectMessage opens a direct message with other users and returns
+// its channel. With more than one other user it is a group, which may be
+// given a name.
+func (c *Client) CreateDirectMessage(ctx context.Context, userids []ID, name string) (ID, error) {
+	in := map[string]any{"userids": userids, "name": name}
+	var out struct {
+		ChannelID ID `json:"channelid"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/users/me/dms", nil, in, &out); err != nil {
+		return 0, err
+	}
+	return out.ChannelID, nil
+}
+
+// AddDirectMessageParticipant adds a user to a group direct message.
+func (c *Client) AddDirectMessageParticipant(ctx context.Context, channelid ID, userid ID) error {
+	return c.do(ctx, http.MethodPut, pathf("/api/dms/%d/participants/%d", channelid, userid), nil, nil, nil)
+}
+
+// RemoveDirectMessageParticipant removes a user from a group direct
+// message. Anyone may remove themselves.
+func (c *Client) RemoveDirectMessageParticipant(ctx context.Context, channelid ID, userid ID) error {
+	return c.do(ctx, http.MethodDelete, pathf("/api/dms/%d/participants/%d", channelid, userid), nil, nil, nil)
+}
+
+// Friends lists the friends of the signed in user.
+func (c *Client) Friends(ctx context.Context) ([]Friend, error) {
+	var out struct {
+		Friends []Friend `json:"friends"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/users/me/friends", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Friends, nil
+}
+
+// RemoveFriend ends a friendship.
+func (c *Client) RemoveFriend(ctx context.Context, userid ID) error {
+	return c.do(ctx, http.MethodDelete, pathf("/api/users/me/friends/%d", userid), nil, nil, nil)
+}
+
+// FriendRequests lists the pending friend requests of the signed in user.
+func (c *Client) FriendRequests(ctx context.Context) (*FriendRequests, error) {
+	var out FriendRequests
+	if err := c.do(ctx, http.MethodGet, "/api/users/me/friend-requests", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SendFriendRequest asks a user to be friends. It reports true when the
+// user had already asked, which makes the two friends at once.
+func (c *Client) SendFriendRequest(ctx context.Context, userid ID) (bool, error) {
+	return c.sendFriendRequest(ctx, map[string]any{"userid": userid})
+}
+
+// SendFriendRequestByName is SendFriendRequest for a username.
+func (c *Client) SendFriendRequestByName(ctx context.Context, username string) (bool, error) {
+	return c.sendFriendRequest(ctx, map[string]any{"username": username})
+}
+
+func (c *Client) sendFriendRequest(ctx context.Context, in map[string]any) (bool, error) {
+	var out struct {
+		Accepted bool `json:"accepted"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/users/me/friend-requests", nil, in, &out); err != nil {
+		return false, err
+	}
+	return out.Accepted, nil
+}
+
+// AcceptFriendRequest accepts the request a user sent.
+func (c *Client) AcceptFriendRequest(ctx context.Context, userid ID) error {
+	return c.do(ctx, http.MethodPost, pathf("/api/users/me/friend-requests/%d/accept", userid), nil, nil, nil)
+}
+
+// DeclineFriendRequest declines the request a user sent.
+func (c *Client) DeclineFriendRequest(ctx context.Context, userid ID) error {
+	return c.do(ctx, http.MethodPost, pathf("/api/users/me/friend-requests/%d/decline", userid), nil, nil, nil)
+}
+
+// CancelFriendRequest withdraws a request sent to a user.
+func (c *Client) CancelFriendRequest(ctx context.Context, userid ID) error {
+	return c.do(ctx, http.MethodDelete, pathf("/api/users/me/friend-requests/%d", userid), nil, nil, nil)
+}
+
+// BlockedUsers lists the users the signed in user blocked.
+func (c *Client) BlockedUsers(ctx context.Context) ([]User, error) {
+	var out struct {
+		Blocked []User `json:"blocked"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/users/me/blocks", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Blocked, nil
+}
+
+// BlockUser blocks a user, which also ends any friendship with them.
+func (c *Client) BlockUser(ctx context.Context, userid ID) error {
+	return c.do(ctx, http.MethodPut, pathf("/api/users/me/blocks/%d", userid), nil, nil, nil)
+}
+
+// UnblockUser lifts a block.
+func (c *Client) UnblockUser(ctx context.Context, userid ID) error {
+	return c.do(ctx, http.MethodDelete, pathf("/api/users/me/blocks/%d", userid), nil, nil, nil)
+}
@@ -0,0 +1,354 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// Event types sent over the stream. EventConnected and EventDisconnected
+// are generated by the client as the connection comes and goes; the rest
+// come from the server, with the payload type named beside them.
+const (
+	EventConnected    = "stream.connected"
+	EventDisconnected = "stream.disconnected"
+
+	EventMessage              = "message"                   // Message
+	EventMessageUpdated       = "message_updated"           // Message
+	EventMessageDeleted       = "message_deleted"           // MessageDeleted
+	EventThreadMessage        = "thread_message"            // Message
+	EventThreadUpdated        = "thread_updated"            // ThreadUpdate
+	EventMessagePinned        = "message_pinned"            // PinEvent
+	EventMessageUnpinned      = "message_unpinned"          // PinEvent
+	EventEphemeralMessage     = "ephemeral_message"         // EphemeralMessage
+	EventCommandInvoked       = "command_invoked"           // Interaction
+	EventPresenceUpdated      = "presence_updated"          // PresenceUpdate
+	EventUserUpdated          = "user_updated"              // Profile
+	EventMemberUpdated        = "member_updated"            // MemberUpdate
+	EventMemberJoined         = "member_joined"             // MembershipEvent
+	EventMemberLeft           = "member_left"               // MembershipEvent
+	EventDMUpdated            = "dm_updated"                // DirectMessage
+	EventDMRemoved            = "dm_removed"                // ChannelRef
+	EventUserBlocked          = "user_blocked"              // UserRef
+	EventUserUnblocked        = "user_unblocked"            // UserRef
+	EventFriendRequest        = "friend_request"            // UserRef
+	EventFriendRequestRemoved = "friend_request_removed"    // UserRef
+	EventFriendAdded          = "friend_added"              // UserRef
+	EventFriendRemoved        = "friend_removed"            // UserRef
+	EventMessageRejected      = "message_rejected"          // MessageRejected
+	EventMemberRestricted     = "member_restricted"         // Restriction
+	EventRestrictionLifted    = "member_restriction_lifted" // Restriction
+)
+
+// MessageDeleted announces a message being deleted by its author.
+type MessageDeleted struct {
+	MessageID ID `json:"messageid"`
+	ChannelID ID `json:"channelid"`
+	ServerID  ID `json:"serverid"`
+}
+
+// MessageRejected is sent to the connection that sent a message its user
+// may not post, such as while muted or to someone who blocked them. Message
+// explains why; Expires is when a restriction lifts and zero otherwise.
+type MessageRejected struct {
+	ChannelID ID        `json:"channelid"`
+	Message   string    `json:"message"`
+	Expires   time.Time `json:"expires"`
+}
+
+// ThreadUpdate announces a new reply in a thread.
+type ThreadUpdate struct {
+	RootID     ID     `json:"rootid"`
+	ChannelID  ID     `json:"channelid"`
+	ServerID   ID     `json:"serverid"`
+	ReplyCount uint   `json:"reply_count"`
+	LastReply  string `json:"last_reply,omitempty"`
+}
+
+// PinEvent announces a message being pinned or unpinned by UserID.
+type PinEvent struct {
+	ChannelID ID `json:"channelid"`
+	ServerID  ID `json:"serverid"`
+	MessageID ID `json:"messageid"`
+	UserID    ID `json:"userid"`
+}
+
+// PresenceUpdate tells whether a user came "online" or went "offline".
+type PresenceUpdate struct {
+	UserID ID     `json:"userid"`
+	Status string `json:"status"`
+}
+
+// MemberUpdate announces a change to a member of a server, such as a new
+// nickname.
+type MemberUpdate struct {
+	ServerID ID     `json:"serverid"`
+	Member   Member `json:"member"`
+}
+
+// MembershipEvent announces a user joining or leaving a channel.
+type MembershipEvent struct {
+	ServerID  ID `json:"serverid"`
+	ChannelID ID `json:"channelid"`
+	UserID    ID `json:"userid"`
+}
+
+// UserRef names the other user of a friendship or block event.
+type UserRef struct {
+	UserID ID `json:"userid"`
+}
+
+// ChannelRef names the channel of an event.
+type ChannelRef struct {
+	ChannelID ID `json:"channelid"`
+}
+
+// Event is one message from the stream. Err is only set on
+// EventDisconnected, with the reason the connection dropped.
+type Event struct {
+	Type    string
+	Payload json.RawMessage
+	Err     error
+}
+
+// Decode unmarshals the payload into v, which should be a pointer to the
+// type listed for the event.
+func (e Event) Decode(v any) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+// ErrNotConnected is returned by Stream.Send while the stream is between
+// connections.
+var ErrNotConnected = errors.New("client: stream not connected")
+
+const (
+	defaultMinBackoff = 500 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+	// streamReadLimit bounds a single event. Messages carry their parsed
+	// markdown, so they are larger than the text alone.
+	streamReadLimit = 1 << 20
+	streamBuffer    = 64
+)
+
+// StreamOptions tunes how a Stream reconnects. The zero value uses the
+// defaults.
+type StreamOptions struct {
+	// MinBackoff is the wait before the first reconnect attempt, doubled
+	// after each failure up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Stream is a live connection to the server's websocket which reconnects
+// on its own whenever it drops. Events are read from Events until the
+// stream ends.
+type Stream struct {
+	client     *Client
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	events     chan Event
+	cancel     context.CancelFunc
+	done       chan struct{}
+
+	mu   sync.Mutex
+	conn *websocket.Conn
+	err  error
+}
+
+// Stream connects to the websocket in the background and keeps it
+// connected until ctx is cancelled, Close is called or the server refuses
+// the credentials of the client. opts may be nil.
+func (c *Client) Stream(ctx context.Context, opts *StreamOptions) *Stream {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Stream{
+		client:     c,
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
+		events:     make(chan Event, streamBuffer),
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	if opts != nil && opts.MinBackoff > 0 {
+		s.minBackoff = opts.MinBackoff
+	}
+	if opts != nil && opts.MaxBackoff > 0 {
+		s.maxBackoff = opts.MaxBackoff
+	}
+	s.maxBackoff = max(s.maxBackoff, s.minBackoff)
+	go s.run(ctx)
+	return s
+}
+
+// Events returns the events of the stream. It is closed when the stream
+// ends, after which Err tells why.
+func (s *Stream) Events() <-chan Event {
+	return s.events
+}
+
+// Err returns why the stream ended: the context error when it was cancelled
+// or closed, or an *Error when the server refused to connect. It is nil
+// while the stream runs.
+func (s *Stream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close ends the stream and waits for it to stop.
+func (s *Stream) Close() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+// Send posts a message to a channel over the current connection, as a
+// reply when replyTo is not zero. Unlike SendMessage the server does not
+// answer, so errors such as a missing membership go unreported; messages
+// only show up as EventMessage once stored.
+func (s *Stream) Send(ctx context.Context, channelid ID, message string, replyTo ID) error {
+	payload := map[string]any{"channel_id": channelid, "message": message}
+	if replyTo != 0 {
+		payload["reply_to"] = replyTo
+	}
+	data, err := json.Marshal(map[string]any{"message_type": "channel_message", "payload": payload})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+	if conn == nil {
+		return ErrNotConnected
+	}
+	return conn.Write(ctx, websocket.MessageText, data)
+}
+
+func (s *Stream) run(ctx context.Context) {
+	defer close(s.done)
+	defer close(s.events)
+	backoff := s.minBackoff
+	for {
+		conn, err := s.dial(ctx)
+		if err == nil {
+			backoff = s.minBackoff
+			err = s.read(ctx, conn)
+		}
+		if ctx.Err() != nil {
+			s.finish(ctx.Err())
+			return
+		}
+		if refused(err) {
+			s.finish(err)
+			return
+		}
+		if conn != nil && !s.emit(ctx, Event{Type: EventDisconnected, Err: err}) {
+			s.finish(ctx.Err())
+			return
+		}
+		select {
+		case <-ctx.Done():
+			s.finish(ctx.Err())
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, s.maxBackoff)
+	}
+}
+
+func (s *Stream) dial(ctx context.Context) (*websocket.Conn, error) {
+	target := s.client.url("/websocket", nil)
+	target = "ws" + strings.TrimPrefix(target, "http")
+	header := http.Header{}
+	if s.client.token != "" {
+		header.Set("Authorization", "Bearer "+s.client.token)
+	}
+	conn, resp, err := websocket.Dial(ctx, target, &websocket.DialOptions{
+		HTTPClient: s.client.http,
+		HTTPHeader: header,
+	})
+	if err != nil {
+		if resp != nil && resp.StatusCode != http.StatusSwitchingProtocols {
+			var message []byte
+			if resp.Body != nil {
+				message, _ = io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+			}
+			return nil, &Error{
+				StatusCode: resp.StatusCode,
+				Method:     http.MethodGet,
+				Path:       "/websocket",
+				Message:    strings.TrimSpace(string(message)),
+			}
+		}
+		return nil, err
+	}
+	conn.SetReadLimit(streamReadLimit)
+	return conn, nil
+}
+
+// read forwards events from a connection until it fails.
+func (s *Stream) read(ctx context.Context, conn *websocket.Conn) error {
+	s.setConn(conn)
+	defer func() {
+		s.setConn(nil)
+		conn.CloseNow()
+	}()
+	if !s.emit(ctx, Event{Type: EventConnected}) {
+		return ctx.Err()
+	}
+	for {
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			return err
+		}
+		var envelope struct {
+			Type    string          `json:"message_type"`
+			Payload json.RawMessage `json:"payload"`
+		}
+		if err := json.Unmarshal(data, &envelope); err != nil || envelope.Type == "" {
+			continue
+		}
+		if !s.emit(ctx, Event{Type: envelope.Type, Payload: envelope.Payload}) {
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *Stream) emit(ctx context.Context, event Event) bool {
+	select {
+	case s.events <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (s *Stream) setConn(conn *websocket.Conn) {
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+}
+
+func (s *Stream) finish(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+// refused reports whether the server turned the connection down for good,
+// as it does for missing or revoked credentials, rather than failing in a
+// way worth retrying.
+func refused(err error) bool {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	code := apiErr.StatusCode
+	return code >= 400 && code < 500 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests
+}
@@ -0,0 +1,301 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// nextEvent returns the next event of a type, skipping any others.
+func nextEvent(t *testing.T, stream *Stream, eventType string) Event {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event, ok := <-stream.Events():
+			if !ok {
+				t.Fatalf("stream ended waiting for %s: %v", eventType, stream.Err())
+			}
+			if event.Type == eventType {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", eventType)
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	u1 := login(t, ts, "u1", "1")
+	u2 := login(t, ts, "u2", "2")
+
+	stream := u1.Stream(ctx, nil)
+	defer stream.Close()
+	nextEvent(t, stream, EventConnected)
+
+	posted, err := u2.SendMessage(ctx, 1, "hello u1", 0)
+	if err != nil {
+		t.Fatalf("SendMessage: err: %v", err)
+	}
+	var message Message
+	if err := nextEvent(t, stream, EventMessage).Decode(&message); err != nil {
+		t.Fatalf("Decode: err: %v", err)
+	}
+	if message.MessageID != posted.MessageID || message.Message != "hello u1" || message.UserID != 2 {
+		t.Fatalf("EventMessage: unexpected message %+v", message)
+	}
+
+	if err := stream.Send(ctx, 1, "sent over the socket", message.MessageID); err != nil {
+		t.Fatalf("Send: err: %v", err)
+	}
+	if err := nextEvent(t, stream, EventMessage).Decode(&message); err != nil {
+		t.Fatalf("Decode: err: %v", err)
+	}
+	if message.Message != "sent over the socket" || message.ReplyTo == nil || message.ReplyTo.MessageID != posted.MessageID {
+		t.Fatalf("EventMessage: unexpected message %+v", message)
+	}
+
+	if _, err := u1.SetNickname(ctx, 1, "one"); err != nil {
+		t.Fatalf("SetNickname: err: %v", err)
+	}
+	var update MemberUpdate
+	if err := nextEvent(t, stream, EventMemberUpdated).Decode(&update); err != nil {
+		t.Fatalf("Decode: err: %v", err)
+	}
+	if update.ServerID != 1 || update.Member.UserID != 1 || update.Member.Nickname != "one" {
+		t.Fatalf("EventMemberUpdated: unexpected update %+v", update)
+	}
+
+	stream.Close()
+	for range stream.Events() {
+		// drain what was buffered before the close
+	}
+	if !errors.Is(stream.Err(), context.Canceled) {
+		t.Fatalf("Err: expected context.Canceled, got %v", stream.Err())
+	}
+	if err := stream.Send(ctx, 1, "too late", 0); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("Send: expected ErrNotConnected, got %v", err)
+	}
+}
+
+// connTracker records the connections a client dials so a test can cut
+// them.
+type connTracker struct {
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (c *connTracker) dial(ctx context.Context, network string, addr string) (net.Conn, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+	if err == nil {
+		c.mu.Lock()
+		c.conns = append(c.conns, conn)
+		c.mu.Unlock()
+	}
+	return conn, err
+}
+
+func (c *connTracker) closeAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, conn := range c.conns {
+		conn.Close()
+	}
+	c.conns = nil
+}
+
+func TestStreamReconnect(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	tracker := &connTracker{}
+	u1, err := New(ts.URL, &http.Client{Transport: &http.Transport{DialContext: tracker.dial}})
+	if err != nil {
+		t.Fatalf("New: err: %v", err)
+	}
+	if _, err := u1.Login(ctx, "u1", "1"); err != nil {
+		t.Fatalf("Login: err: %v", err)
+	}
+	u2 := login(t, ts, "u2", "2")
+
+	stream := u1.Stream(ctx, &StreamOptions{MinBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond})
+	defer stream.Close()
+	nextEvent(t, stream, EventConnected)
+
+	tracker.closeAll()
+	if event := nextEvent(t, stream, EventDisconnected); event.Err == nil {
+		t.Fatalf("EventDisconnected: expected the reason")
+	}
+	nextEvent(t, stream, EventConnected)
+
+	if _, err := u2.SendMessage(ctx, 1, "after reconnecting", 0); err != nil {
+		t.Fatalf("SendMessage: err: %v", err)
+	}
+	var message Message
+	if err := nextEvent(t, stream, EventMessage).Decode(&message); err != nil {
+		t.Fatalf("Decode: err: %v", err)
+	}
+	if message.Message != "after reconnecting" {
+		t.Fatalf("EventMessage: unexpected message %+v", message)
+	}
+}
+
+func TestStreamRefused(t *testing.T) {
+	ts := newTestServer(t)
+	stream := newTestClient(t, ts).Stream(context.Background(), nil)
+	defer stream.Close()
+	for event := range stream.Events() {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if !errors.Is(stream.Err(), ErrUnauthorized) {
+		t.Fatalf("Err: expected ErrUnauthorized, got %v", stream.Err())
+	}
+}
+
+func TestStreamWithToken(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	u1 := login(t, ts, "u1", "1")
+
+	created, err := u1.CreateAPIToken(ctx, APITokenRequest{Name: "stream", Scopes: []string{"messages:read"}})
+	if err != nil {
+		t.Fatalf("CreateAPIToken: err: %v", err)
+	}
+	stream := newTestClient(t, ts).WithToken(created.Token).Stream(ctx, nil)
+	defer stream.Close()
+	nextEvent(t, stream, EventConnected)
+
+	if _, err := u1.SendMessage(ctx, 1, "seen by the token", 0); err != nil {
+		t.Fatalf("SendMessage: err: %v", err)
+	}
+	var message Message
+	if err := nextEvent(t, stream, EventMessage).Decode(&message); err != nil {
+		t.Fatalf("Decode: err: %v", err)
+	}
+	if message.Message != "seen by the token" {
+		t.Fatalf("EventMessage: unexpected message %+v", message)
+	}
+}
+
+func TestStreamEditsAndDeletes(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	u1 := login(t, ts, "u1", "1")
+	u2 := login(t, ts, "u2", "2")
+
+	stream := u1.Stream(ctx, nil)
+	defer stream.Close()
+	nextEvent(t, stream, EventConnected)
+
+	posted, err := u2.SendMessage(ctx, 1, "tpyo", 0)
+	if err != nil {
+		t.Fatalf("SendMessage: err: %v", err)
+	}
+	if err := u2.EditMessage(ctx, 1, posted.MessageID, "typo"); err != nil {
+		t.Fatalf("EditMessage: err: %v", err)
+	}
+	var message Message
+	if err := nextEvent(t, stream, EventMessageUpdated).Decode(&message); err != nil {
+		t.Fatalf("Decode: err: %v", err)
+	}
+	if message.MessageID != posted.MessageID || message.Message != "typo" {
+		t.Fatalf("EventMessageUpdated: unexpected message %+v", message)
+	}
+
+	if err := u2.DeleteMessage(ctx, 1, posted.MessageID); err != nil {
+		t.Fatalf("DeleteMessage: err: %v", err)
+	}
+	var deleted MessageDeleted
+	if err := nextEvent(t, stream, EventMessageDeleted).Decode(&deleted); err != nil {
+		t.Fatalf("Decode: err: %v", err)
+	}
+	if deleted.MessageID != posted.MessageID || deleted.ChannelID != 1 || deleted.ServerID != 1 {
+		t.Fatalf("EventMessageDeleted: unexpected event %+v", deleted)
+	}
+}
+
+func TestStreamRestrictions(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	u1 := login(t, ts, "u1", "1")
+	u3 := login(t, ts, "u3", "3")
+
+	stream := u3.Stream(ctx, nil)
+	defer stream.Close()
+	nextEvent(t, stream, EventConnected)
+
+	mute, err := u1.Restrict(ctx, 1, RestrictionRequest{UserID: 3, ChannelID: 2, Duration: "1h", Reason: "cool off"})
+	if err != nil {
+		t.Fatalf("Restrict: err: %v", err)
+	}
+	if mute.Kind != RestrictionMute || mute.ChannelID != 2 || mute.Reason != "cool off" {
+		t.Fatalf("Restrict: unexpected restriction %+v", mute)
+	}
+	var restricted Restriction
+	if err := nextEvent(t, stream, EventMemberRestricted).Decode(&restricted); err != nil {
+		t.Fatalf("Decode: err: %v", err)
+	}
+	if restricted.RestrictionID != mute.RestrictionID || !restricted.Expires.Equal(mute.Expires) {
+		t.Fatalf("EventMemberRestricted: unexpected restriction %+v", restricted)
+	}
+
+	if err := stream.Send(ctx, 2, "still here", 0); err != nil {
+		t.Fatalf("Send: err: %v", err)
+	}
+	var rejected MessageRejected
+	if err := nextEvent(t, stream, EventMessageRejected).Decode(&rejected); err != nil {
+		t.Fatalf("Decode: err: %v", err)
+	}
+	if rejected.ChannelID != 2 || !rejected.Expires.Equal(mute.Expires) || !strings.Contains(rejected.Message, "cool off") {
+		t.Fatalf("EventMessageRejected: unexpected event %+v", rejected)
+	}
+	if _, err := u3.SendMessage(ctx, 2, "still here", 0); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("SendMessage: expected ErrForbidden while muted got %v", err)
+	}
+
+	list, err := u1.Restrictions(ctx, 1)
+	if err != nil || len(list) != 1 || list[0].RestrictionID != mute.RestrictionID {
+		t.Fatalf("Restrictions: expected the mute got %+v err: %v", list, err)
+	}
+	if err := u1.LiftRestriction(ctx, 1, mute.RestrictionID); err != nil {
+		t.Fatalf("LiftRestriction: err: %v", err)
+	}
+	nextEvent(t, stream, EventRestrictionLifted)
+	if _, err := u3.SendMessage(ctx, 2, "back", 0); err != nil {
+		t.Fatalf("SendMessage: err: %v", err)
+	}
+}
+
+func TestStreamBlockedDirectMessage(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	u1 := login(t, ts, "u1", "1")
+	u3 := login(t, ts, "u3", "3")
+	channelid, err := u1.CreateDirectMessage(ctx, []ID{3}, "")
+	if err != nil {
+		t.Fatalf("CreateDirectMessage: err: %v", err)
+	}
+	if err := u3.BlockUser(ctx, 1); err != nil {
+		t.Fatalf("BlockUser: err: %v", err)
+	}
+
+	stream := u1.Stream(ctx, nil)
+	defer stream.Close()
+	nextEvent(t, stream, EventConnected)
+	if err := stream.Send(ctx, channelid, "hello?", 0); err != nil {
+		t.Fatalf("Send: err: %v", err)
+	}
+	var rejected MessageRejected
+	if err := nextEvent(t, stream, EventMessageRejected).Decode(&rejected); err != nil {
+		t.Fatalf("Decode: err: %v", err)
+	}
+	if rejected.ChannelID != channelid || !rejected.Expires.IsZero() || !strings.Contains(rejected.Message, "unable to message user") {
+		t.Fatalf("EventMessageRejected: unexpected event %+v", rejected)
+	}
+}
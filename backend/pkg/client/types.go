@@ -0,0 +1,507 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ID identifies users, servers, channels, messages and every other record.
+type ID uint64
+
+// Message types. Anything other than MessageTypeDefault is a notice the
+// server posted rather than something a user wrote.
+const (
+	MessageTypeDefault = "default"
+	MessageTypePin     = "pin"
+)
+
+// Message is a channel message as the API shows it.
+type Message struct {
+	UserID    ID     `json:"userid"`
+	MessageID ID     `json:"messageid"`
+	ChannelID ID     `json:"channelid"`
+	ServerID  ID     `json:"serverid"`
+	Message   string `json:"message"`
+	Date      string `json:"date"`
+	Type      string `json:"type"`
+	// DisplayName is the author's nickname in the server, or their display
+	// name or username when none is set.
+	DisplayName string        `json:"display_name"`
+	ReplyTo     *MessageReply `json:"reply_to,omitempty"`
+	ThreadID    *ID           `json:"threadid,omitempty"`
+	Thread      *ThreadInfo   `json:"thread,omitempty"`
+	// AST is the parsed markdown of Message, kept raw for clients that
+	// render it themselves.
+	AST         json.RawMessage `json:"ast,omitempty"`
+	Attachments []Attachment    `json:"attachments,omitempty"`
+	Embeds      []Embed         `json:"embeds,omitempty"`
+	Blocked     bool            `json:"blocked,omitempty"`
+	Webhook     *WebhookAuthor  `json:"webhook,omitempty"`
+}
+
+// Time parses Date.
+func (m Message) Time() (time.Time, error) {
+	return time.Parse(time.UnixDate, m.Date)
+}
+
+type MessageReply struct {
+	MessageID ID     `json:"messageid"`
+	UserID    ID     `json:"userid"`
+	Message   string `json:"message"`
+	Deleted   bool   `json:"deleted"`
+}
+
+type ThreadInfo struct {
+	ReplyCount uint   `json:"reply_count"`
+	LastReply  string `json:"last_reply,omitempty"`
+}
+
+// Embed is a card attached to a message, either a link preview or one
+// supplied by a webhook.
+type Embed struct {
+	URL          string       `json:"url"`
+	Title        string       `json:"title,omitempty"`
+	Description  string       `json:"description,omitempty"`
+	SiteName     string       `json:"site_name,omitempty"`
+	ImageURL     string       `json:"image_url,omitempty"`
+	Color        string       `json:"color,omitempty"`
+	AuthorName   string       `json:"author_name,omitempty"`
+	ThumbnailURL string       `json:"thumbnail_url,omitempty"`
+	Footer       string       `json:"footer,omitempty"`
+	Fields       []EmbedField `json:"fields,omitempty"`
+}
+
+type EmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+// WebhookAuthor marks a message posted through an incoming webhook.
+type WebhookAuthor struct {
+	WebhookID ID     `json:"webhookid"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+}
+
+type Attachment struct {
+	AttachmentID ID          `json:"attachmentid"`
+	FileName     string      `json:"filename"`
+	ContentType  string      `json:"content_type"`
+	Size         int64       `json:"size"`
+	URL          string      `json:"url"`
+	Width        *int        `json:"width,omitempty"`
+	Height       *int        `json:"height,omitempty"`
+	BlurHash     *string     `json:"blurhash,omitempty"`
+	Thumbnails   []Thumbnail `json:"thumbnails,omitempty"`
+}
+
+// File is an attachment to upload.
+type File struct {
+	Name string
+	Data []byte
+}
+
+type Thumbnail struct {
+	Size   int    `json:"size"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+}
+
+type PinnedMessage struct {
+	Message
+	PinnedBy ID     `json:"pinned_by"`
+	PinnedAt string `json:"pinned_at"`
+}
+
+// Thread is the root of a thread with a page of its replies.
+type Thread struct {
+	Root     Message   `json:"root"`
+	Messages []Message `json:"messages"`
+}
+
+// Server is a community of channels. Some routes only fill the first three
+// fields.
+type Server struct {
+	ServerID    ID     `json:"serverid"`
+	OwnerID     ID     `json:"ownerid"`
+	ServerName  string `json:"servername"`
+	UploadQuota int64  `json:"uploadquota,omitempty"`
+}
+
+type Channel struct {
+	ChannelID   ID        `json:"channelid"`
+	ServerID    ID        `json:"serverid"`
+	ChannelName string    `json:"channelname"`
+	Timestamp   time.Time `json:"timestamp"`
+	PinLimit    uint      `json:"pinlimit"`
+}
+
+// ChannelUpdate changes the fields that are not nil.
+type ChannelUpdate struct {
+	ChannelName *string `json:"channelname,omitempty"`
+	PinLimit    *uint   `json:"pinlimit,omitempty"`
+}
+
+// User is the short form of an account used in member and participant
+// lists.
+type User struct {
+	UserID   ID     `json:"userid"`
+	UserName string `json:"username"`
+}
+
+// Member is a user as seen in a server.
+type Member struct {
+	UserID      ID     `json:"userid"`
+	UserName    string `json:"username"`
+	Nickname    string `json:"nickname,omitempty"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+}
+
+type Profile struct {
+	UserID      ID     `json:"userid"`
+	UserName    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	BannerColor string `json:"banner_color,omitempty"`
+	Bio         string `json:"bio"`
+	Pronouns    string `json:"pronouns"`
+	Bot         bool   `json:"bot,omitempty"`
+}
+
+// ProfileUpdate changes the fields that are not nil.
+type ProfileUpdate struct {
+	DisplayName *string `json:"display_name,omitempty"`
+	BannerColor *string `json:"banner_color,omitempty"`
+	Bio         *string `json:"bio,omitempty"`
+	Pronouns    *string `json:"pronouns,omitempty"`
+}
+
+// NameHistoryEntry is a previous username or nickname.
+type NameHistoryEntry struct {
+	Name      string `json:"name"`
+	Timestamp string `json:"timestamp"`
+}
+
+type DirectMessage struct {
+	ChannelID    ID       `json:"channelid"`
+	OwnerID      ID       `json:"ownerid"`
+	Name         string   `json:"name,omitempty"`
+	IsGroup      bool     `json:"is_group"`
+	Participants []User   `json:"participants"`
+	LastMessage  *Message `json:"last_message,omitempty"`
+}
+
+type Friend struct {
+	UserID   ID     `json:"userid"`
+	UserName string `json:"username"`
+	Online   bool   `json:"online"`
+}
+
+type FriendRequest struct {
+	UserID    ID     `json:"userid"`
+	UserName  string `json:"username"`
+	Timestamp string `json:"timestamp"`
+}
+
+type FriendRequests struct {
+	Incoming []FriendRequest `json:"incoming"`
+	Outgoing []FriendRequest `json:"outgoing"`
+}
+
+type APIToken struct {
+	TokenID  ID         `json:"tokenid"`
+	Name     string     `json:"name"`
+	Scopes   []string   `json:"scopes"`
+	Created  time.Time  `json:"created"`
+	LastUsed *time.Time `json:"last_used,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+}
+
+// APITokenRequest describes a token to create. ExpiresIn is at most a
+// year, and a zero ExpiresIn never expires.
+type APITokenRequest struct {
+	Name      string
+	Scopes    []string
+	ExpiresIn time.Duration
+}
+
+// CreatedAPIToken holds the secret of a new token, which is only shown
+// once.
+type CreatedAPIToken struct {
+	Token string   `json:"token"`
+	Info  APIToken `json:"info"`
+}
+
+// APITokens lists the tokens of an account with every scope a token can
+// hold.
+type APITokens struct {
+	Tokens []APIToken `json:"tokens"`
+	Scopes []string   `json:"scopes"`
+}
+
+type Webhook struct {
+	WebhookID ID        `json:"webhookid"`
+	ChannelID ID        `json:"channelid"`
+	UserID    ID        `json:"userid"`
+	CreatorID ID        `json:"creatorid"`
+	Name      string    `json:"name"`
+	Created   time.Time `json:"created"`
+}
+
+// CreatedWebhook holds the URL of a new webhook, which embeds its secret
+// and is only shown once.
+type CreatedWebhook struct {
+	Webhook Webhook `json:"webhook"`
+	URL     string  `json:"url"`
+}
+
+// WebhookMessage is posted through an incoming webhook.
+type WebhookMessage struct {
+	Content   string         `json:"content"`
+	Username  string         `json:"username,omitempty"`
+	AvatarURL string         `json:"avatar_url,omitempty"`
+	Embeds    []WebhookEmbed `json:"embeds,omitempty"`
+}
+
+type WebhookEmbed struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	URL         string `json:"url,omitempty"`
+	// Color is a 0xRRGGBB value.
+	Color     int                 `json:"color,omitempty"`
+	Author    *WebhookEmbedText   `json:"author,omitempty"`
+	Image     *WebhookEmbedURL    `json:"image,omitempty"`
+	Thumbnail *WebhookEmbedURL    `json:"thumbnail,omitempty"`
+	Footer    *WebhookEmbedFooter `json:"footer,omitempty"`
+	Fields    []EmbedField        `json:"fields,omitempty"`
+}
+
+type WebhookEmbedText struct {
+	Name string `json:"name"`
+}
+
+type WebhookEmbedURL struct {
+	URL string `json:"url"`
+}
+
+type WebhookEmbedFooter struct {
+	Text string `json:"text"`
+}
+
+type EventEndpoint struct {
+	EndpointID ID        `json:"endpointid"`
+	ServerID   ID        `json:"serverid"`
+	CreatorID  ID        `json:"creatorid"`
+	URL        string    `json:"url"`
+	Events     []string  `json:"events"`
+	Enabled    bool      `json:"enabled"`
+	Failures   int       `json:"failures"`
+	Created    time.Time `json:"created"`
+}
+
+// CreatedEventEndpoint holds the secret signing the deliveries of a new
+// endpoint, which is only shown once.
+type CreatedEventEndpoint struct {
+	Endpoint EventEndpoint `json:"endpoint"`
+	Secret   string        `json:"secret"`
+}
+
+// EventEndpoints lists the endpoints of a server with every event they can
+// subscribe to.
+type EventEndpoints struct {
+	Endpoints []EventEndpoint `json:"endpoints"`
+	Events    []string        `json:"events"`
+}
+
+// EventEndpointUpdate changes the fields that are not nil.
+type EventEndpointUpdate struct {
+	URL     *string   `json:"url,omitempty"`
+	Events  *[]string `json:"events,omitempty"`
+	Enabled *bool     `json:"enabled,omitempty"`
+}
+
+type EventDelivery struct {
+	DeliveryID   ID         `json:"deliveryid"`
+	Event        string     `json:"event"`
+	Status       string     `json:"status"`
+	Attempts     int        `json:"attempts"`
+	NextAttempt  *time.Time `json:"next_attempt,omitempty"`
+	LastAttempt  *time.Time `json:"last_attempt,omitempty"`
+	ResponseCode int        `json:"response_code,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	Created      time.Time  `json:"created"`
+}
+
+// AuditEntry is one administrative change to a server. Before and After
+// hold the values it changed, by field name.
+type AuditEntry struct {
+	EntryID    ID             `json:"entryid"`
+	ServerID   ID             `json:"serverid"`
+	ActorID    ID             `json:"actorid"`
+	Action     string         `json:"action"`
+	TargetType string         `json:"target_type"`
+	TargetID   ID             `json:"targetid"`
+	Before     map[string]any `json:"before"`
+	After      map[string]any `json:"after"`
+	Reason     string         `json:"reason,omitempty"`
+	Created    time.Time      `json:"created"`
+}
+
+// AuditLogQuery filters the audit log. Zero fields match every entry;
+// Before pages back from an entry id and Count defaults to the server's
+// page size.
+type AuditLogQuery struct {
+	ActorID ID
+	Action  string
+	Before  ID
+	Count   int
+}
+
+// Restriction kinds.
+const (
+	RestrictionTimeout = "timeout"
+	RestrictionMute    = "mute"
+)
+
+// Restriction keeps a member from posting until it expires. A timeout
+// covers the whole server and a mute only ChannelID.
+type Restriction struct {
+	RestrictionID ID        `json:"restrictionid"`
+	Kind          string    `json:"kind"`
+	ServerID      ID        `json:"serverid"`
+	ChannelID     ID        `json:"channelid,omitempty"`
+	UserID        ID        `json:"userid"`
+	ModeratorID   ID        `json:"moderatorid"`
+	Reason        string    `json:"reason,omitempty"`
+	Expires       time.Time `json:"expires"`
+	Created       time.Time `json:"created"`
+}
+
+// RestrictionRequest restricts UserID for Duration, such as "10m" or "2d".
+// Leaving ChannelID zero times them out of the server instead of muting
+// them in one channel.
+type RestrictionRequest struct {
+	UserID    ID     `json:"userid"`
+	ChannelID ID     `json:"channelid,omitempty"`
+	Duration  string `json:"duration"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Command option types.
+const (
+	CommandOptionString   = "string"
+	CommandOptionText     = "text"
+	CommandOptionInteger  = "integer"
+	CommandOptionBoolean  = "boolean"
+	CommandOptionUser     = "user"
+	CommandOptionChannel  = "channel"
+	CommandOptionDuration = "duration"
+)
+
+type CommandOption struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required,omitempty"`
+	Variadic    bool     `json:"variadic,omitempty"`
+	Choices     []string `json:"choices,omitempty"`
+}
+
+// Command is a slash command usable in a channel. BotID is zero for the
+// commands built into the server.
+type Command struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Usage       string          `json:"usage,omitempty"`
+	Options     []CommandOption `json:"options"`
+	BotID       ID              `json:"botid,omitempty"`
+}
+
+// BotCommands are the commands a bot registered. CallbackSecret is only
+// returned when the callback was just set.
+type BotCommands struct {
+	Commands       []Command `json:"commands"`
+	CallbackURL    string    `json:"callback_url"`
+	CallbackSecret string    `json:"callback_secret,omitempty"`
+}
+
+type CommandSuggestion struct {
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+}
+
+// Autocomplete suggests how to continue a partial command. Command and
+// Option are set once the command name is complete.
+type Autocomplete struct {
+	Command     *Command            `json:"command,omitempty"`
+	Option      *CommandOption      `json:"option,omitempty"`
+	Suggestions []CommandSuggestion `json:"suggestions"`
+}
+
+// EphemeralMessage is a command response only its invoker sees. UserID is
+// the bot that answered, zero for built-in commands.
+type EphemeralMessage struct {
+	ChannelID ID              `json:"channelid"`
+	ServerID  ID              `json:"serverid"`
+	UserID    ID              `json:"userid"`
+	Command   string          `json:"command"`
+	Message   string          `json:"message"`
+	AST       json.RawMessage `json:"ast,omitempty"`
+	Date      string          `json:"date"`
+}
+
+// Interaction is handed to a bot when one of its commands is used. Args
+// holds durations as whole seconds.
+type Interaction struct {
+	InteractionID string         `json:"interactionid"`
+	Command       string         `json:"command"`
+	Args          map[string]any `json:"args"`
+	UserID        ID             `json:"userid"`
+	ChannelID     ID             `json:"channelid"`
+	ServerID      ID             `json:"serverid"`
+	Timestamp     time.Time      `json:"timestamp"`
+}
+
+// Posted tells what became of a message or command. MessageID is set when a
+// message was stored, Ephemeral when only the sender was answered and
+// InteractionID when a bot will answer later.
+type Posted struct {
+	MessageID     ID                `json:"messageid,omitempty"`
+	Ephemeral     *EphemeralMessage `json:"ephemeral,omitempty"`
+	InteractionID string            `json:"interactionid,omitempty"`
+	Attachments   []Attachment      `json:"attachments,omitempty"`
+}
+
+// LoginResult is the outcome of a password login. When TwoFactorRequired is
+// set no session was started and Challenge must be completed with
+// CompleteTwoFactorLogin.
+type LoginResult struct {
+	UserID            ID     `json:"userid"`
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	Challenge         string `json:"challenge,omitempty"`
+	DeletionCancelled bool   `json:"deletion_cancelled,omitempty"`
+}
+
+type Session struct {
+	UserID   ID     `json:"userid"`
+	UserName string `json:"username"`
+}
+
+type EmailStatus struct {
+	Email    string `json:"email"`
+	Verified bool   `json:"verified"`
+}
+
+type TwoFactorStatus struct {
+	Enabled                bool `json:"enabled"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// TwoFactorEnrollment is the secret to add to an authenticator app before
+// confirming enrollment with one of its codes.
+type TwoFactorEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
@@ -0,0 +1,189 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// CreateUser registers an account and signs it in. The email is optional;
+// when given, a verification link is mailed to it.
+func (c *Client) CreateUser(ctx context.Context, username string, password string, email string) (ID, error) {
+	in := map[string]string{"username": username, "password": password, "email": email}
+	var out struct {
+		UserID ID `json:"userid"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/users", nil, in, &out); err != nil {
+		return 0, err
+	}
+	return out.UserID, nil
+}
+
+// GetUser returns the public profile of a user.
+func (c *Client) GetUser(ctx context.Context, userid ID) (*Profile, error) {
+	var out Profile
+	if err := c.do(ctx, http.MethodGet, pathf("/api/users/%d", userid), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateUser calls PATCH /api/users/{userid}, which the server keeps for
+// older clients and which changes nothing. Use UpdateProfile instead.
+func (c *Client) UpdateUser(ctx context.Context, userid ID) error {
+	return c.do(ctx, http.MethodPatch, pathf("/api/users/%d", userid), nil, nil, nil)
+}
+
+// ServersOfUser lists the servers a user is a member of.
+func (c *Client) ServersOfUser(ctx context.Context, userid ID) ([]Server, error) {
+	var out struct {
+		Servers []Server `json:"servers"`
+	}
+	if err := c.do(ctx, http.MethodGet, pathf("/api/users/%d/servers", userid), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Servers, nil
+}
+
+// UsernameHistory lists the previous usernames of a user.
+func (c *Client) UsernameHistory(ctx context.Context, userid ID) ([]NameHistoryEntry, error) {
+	var out struct {
+		Usernames []NameHistoryEntry `json:"usernames"`
+	}
+	if err := c.do(ctx, http.MethodGet, pathf("/api/users/%d/usernames", userid), nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Usernames, nil
+}
+
+// DownloadAvatar fetches an avatar image. Profile.AvatarURL can also be
+// passed to Download.
+func (c *Client) DownloadAvatar(ctx context.Context, userid ID, avatarid ID) (*Download, error) {
+	return c.download(ctx, pathf("/api/users/%d/avatar/%d", userid, avatarid))
+}
+
+// UpdateProfile changes the profile of the signed in user.
+func (c *Client) UpdateProfile(ctx context.Context, update ProfileUpdate) (*Profile, error) {
+	var out Profile
+	if err := c.do(ctx, http.MethodPatch, "/api/users/me/profile", nil, update, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UploadAvatar replaces the avatar of the signed in user with a PNG, JPEG
+// or GIF image.
+func (c *Client) UploadAvatar(ctx context.Context, filename string, image []byte) (*Profile, error) {
+	var out Profile
+	files := []multipartFile{{field: "avatar", name: filename, data: image}}
+	if err := c.doMultipart(ctx, http.MethodPut, "/api/users/me/avatar", nil, files, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteAvatar removes the avatar of the signed in user.
+func (c *Client) DeleteAvatar(ctx context.Context) (*Profile, error) {
+	var out Profile
+	if err := c.do(ctx, http.MethodDelete, "/api/users/me/avatar", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteAccount schedules the signed in account for deletion and returns
+// when it happens. Signing in again before then cancels it.
+func (c *Client) DeleteAccount(ctx context.Context, password string, removeMessages bool) (time.Time, error) {
+	in := map[string]any{"password": password, "remove_messages": removeMessages}
+	var out struct {
+		DeleteAfter time.Time `json:"delete_after"`
+	}
+	if err := c.do(ctx, http.MethodDelete, "/api/users/me", nil, in, &out); err != nil {
+		return time.Time{}, err
+	}
+	return out.DeleteAfter, nil
+}
+
+// ExportData downloads a zip archive of everything stored about the signed
+// in user.
+func (c *Client) ExportData(ctx context.Context) (*Download, error) {
+	return c.download(ctx, "/api/users/me/export")
+}
+
+// Email returns the address of the signed in user.
+func (c *Client) Email(ctx context.Context) (*EmailStatus, error) {
+	var out EmailStatus
+	if err := c.do(ctx, http.MethodGet, "/api/users/me/email", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateEmail changes the address of the signed in user, which stays
+// unverified until the mailed link is followed.
+func (c *Client) UpdateEmail(ctx context.Context, email string, password string) (*EmailStatus, error) {
+	in := map[string]string{"email": email, "password": password}
+	var out EmailStatus
+	if err := c.do(ctx, http.MethodPut, "/api/users/me/email", nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ChangePassword replaces the password of the signed in user. Other
+// sessions are signed out.
+func (c *Client) ChangePassword(ctx context.Context, current string, updated string) error {
+	in := map[string]string{"current_password": current, "new_password": updated}
+	return c.do(ctx, http.MethodPost, "/api/users/me/password", nil, in, nil)
+}
+
+// TwoFactorStatus tells whether two-factor authentication is enabled.
+func (c *Client) TwoFactorStatus(ctx context.Context) (*TwoFactorStatus, error) {
+	var out TwoFactorStatus
+	if err := c.do(ctx, http.MethodGet, "/api/users/me/2fa", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// EnrollTwoFactor starts enabling two-factor authentication. It takes
+// effect once ConfirmTwoFactor is called with a code for the secret.
+func (c *Client) EnrollTwoFactor(ctx context.Context, password string) (*TwoFactorEnrollment, error) {
+	in := map[string]string{"password": password}
+	var out TwoFactorEnrollment
+	if err := c.do(ctx, http.MethodPost, "/api/users/me/2fa", nil, in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ConfirmTwoFactor enables two-factor authentication and returns the
+// recovery codes, which are only shown once.
+func (c *Client) ConfirmTwoFactor(ctx context.Context, code string) ([]string, error) {
+	in := map[string]string{"code": code}
+	var out struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/users/me/2fa/confirm", nil, in, &out); err != nil {
+		return nil, err
+	}
+	return out.RecoveryCodes, nil
+}
+
+// DisableTwoFactor turns two-factor authentication off.
+func (c *Client) DisableTwoFactor(ctx context.Context, password string, code string) error {
+	in := map[string]string{"password": password, "code": code}
+	return c.do(ctx, http.MethodDelete, "/api/users/me/2fa", nil, in, nil)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes.
+func (c *Client) RegenerateRecoveryCodes(ctx context.Context, code string) ([]string, error) {
+	in := map[string]string{"code": code}
+	var out struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/api/users/me/2fa/recovery-codes", nil, in, &out); err != nil {
+		return nil, err
+	}
+	return out.RecoveryCodes, nil
+}
@@ -2,9 +2,10 @@ BEGIN TRANSACTION;
 DROP TABLE IF EXISTS "ChannelTable";
 CREATE TABLE IF NOT EXISTS "ChannelTable" (
 	"channelid"	INTEGER NOT NULL UNIQUE,
-	"serverid"	INTEGER NOT NULL,
+	"serverid"	INTEGER,
 	"channelname"	TEXT NOT NULL,
 	"timestamp"	DATETIME DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+	"pinlimit"	INTEGER NOT NULL DEFAULT 50,
 	PRIMARY KEY("channelid" AUTOINCREMENT),
 	UNIQUE("serverid","channelname"),
 	FOREIGN KEY("serverid") REFERENCES "ServerTable"("serverid")
@@ -14,6 +15,7 @@ CREATE TABLE IF NOT EXISTS "ServerTable" (
 	"serverid"	INTEGER NOT NULL,
 	"ownerid"	INTEGER NOT NULL,
 	"servername"	TEXT NOT NULL,
+	"uploadquota"	INTEGER NOT NULL DEFAULT 1073741824,
 	FOREIGN KEY("ownerid") REFERENCES "UserTable"("userid"),
 	PRIMARY KEY("serverid" AUTOINCREMENT)
 );
@@ -41,6 +43,15 @@ DROP TABLE IF EXISTS "UserTable";
 CREATE TABLE IF NOT EXISTS "UserTable" (
 	"userid"	INTEGER NOT NULL,
 	"username"	TEXT NOT NULL,
+	"displayname"	TEXT NOT NULL DEFAULT '',
+	"avatarkey"	TEXT NOT NULL DEFAULT '',
+	"bannercolor"	TEXT NOT NULL DEFAULT '',
+	"bio"	TEXT NOT NULL DEFAULT '',
+	"pronouns"	TEXT NOT NULL DEFAULT '',
+	"email"	TEXT NOT NULL DEFAULT '',
+	"emailverified"	INTEGER NOT NULL DEFAULT 0,
+	"isbot"	INTEGER NOT NULL DEFAULT 0,
+	"botowner"	INTEGER NOT NULL DEFAULT 0,
 	UNIQUE("username"),
 	PRIMARY KEY("userid" AUTOINCREMENT)
 );
@@ -72,9 +83,312 @@ CREATE TABLE IF NOT EXISTS "ChannelMessageTable" (
 	"timestamp"	DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
 	"editted"	INTEGER,
 	"edittimestamp"	DATETIME,
+	"replytoid"	INTEGER,
+	"threadid"	INTEGER,
+	"messagetype"	TEXT NOT NULL DEFAULT 'default',
+	"ast"	TEXT,
 	FOREIGN KEY("userid","channelid") REFERENCES "UsersChannelTable"("userid","channelid"),
 	PRIMARY KEY("messageid" AUTOINCREMENT)
 );
+DROP TABLE IF EXISTS "ThreadTable";
+CREATE TABLE IF NOT EXISTS "ThreadTable" (
+	"rootid"	INTEGER NOT NULL UNIQUE,
+	"replycount"	INTEGER NOT NULL DEFAULT 0,
+	"lastreply"	DATETIME,
+	FOREIGN KEY("rootid") REFERENCES "ChannelMessageTable"("messageid"),
+	PRIMARY KEY("rootid")
+);
+DROP TABLE IF EXISTS "ThreadFollowerTable";
+CREATE TABLE IF NOT EXISTS "ThreadFollowerTable" (
+	"rootid"	INTEGER NOT NULL,
+	"userid"	INTEGER NOT NULL,
+	"timestamp"	DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+	FOREIGN KEY("rootid") REFERENCES "ThreadTable"("rootid"),
+	FOREIGN KEY("userid") REFERENCES "UserTable"("userid"),
+	PRIMARY KEY("rootid","userid")
+);
+DROP TABLE IF EXISTS "PinnedMessageTable";
+CREATE TABLE IF NOT EXISTS "PinnedMessageTable" (
+	"messageid"	INTEGER NOT NULL UNIQUE,
+	"channelid"	INTEGER NOT NULL,
+	"pinnedby"	INTEGER NOT NULL,
+	"timestamp"	DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+	FOREIGN KEY("messageid") REFERENCES "ChannelMessageTable"("messageid"),
+	FOREIGN KEY("channelid") REFERENCES "ChannelTable"("channelid"),
+	FOREIGN KEY("pinnedby") REFERENCES "UserTable"("userid"),
+	PRIMARY KEY("messageid")
+);
+DROP TABLE IF EXISTS "AttachmentTable";
+CREATE TABLE IF NOT EXISTS "AttachmentTable" (
+	"attachmentid"	INTEGER NOT NULL UNIQUE,
+	"channelid"	INTEGER NOT NULL,
+	"userid"	INTEGER NOT NULL,
+	"messageid"	INTEGER,
+	"filename"	TEXT NOT NULL,
+	"contenttype"	TEXT NOT NULL,
+	"size"	INTEGER NOT NULL,
+	"storagekey"	TEXT NOT NULL UNIQUE,
+	"timestamp"	DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+	"width"	INTEGER,
+	"height"	INTEGER,
+	"blurhash"	TEXT,
+	FOREIGN KEY("channelid") REFERENCES "ChannelTable"("channelid"),
+	FOREIGN KEY("userid") REFERENCES "UserTable"("userid"),
+	FOREIGN KEY("messageid") REFERENCES "ChannelMessageTable"("messageid"),
+	PRIMARY KEY("attachmentid" AUTOINCREMENT)
+);
+DROP TABLE IF EXISTS "DirectMessageTable";
+CREATE TABLE IF NOT EXISTS "DirectMessageTable" (
+	"channelid"	INTEGER NOT NULL UNIQUE,
+	"ownerid"	INTEGER NOT NULL,
+	"name"	TEXT NOT NULL DEFAULT '',
+	"isgroup"	INTEGER NOT NULL DEFAULT 0,
+	"dmkey"	TEXT UNIQUE,
+	"timestamp"	DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+	FOREIGN KEY("channelid") REFERENCES "ChannelTable"("channelid"),
+	FOREIGN KEY("ownerid") REFERENCES "UserTable"("userid"),
+	PRIMARY KEY("channelid")
+);
+DROP TABLE IF EXISTS "FriendRequestTable";
+CREATE TABLE IF NOT EXISTS "FriendRequestTable" (
+	"senderid"	INTEGER NOT NULL,
+	"receiverid"	INTEGER NOT NULL,
+	"timestamp"	DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+	FOREIGN KEY("senderid") REFERENCES "UserTable"("userid"),
+	FOREIGN KEY("receiverid") REFERENCES "UserTable"("userid"),
+	PRIMARY KEY("senderid","receiverid")
+);
+DROP TABLE IF EXISTS "FriendTable";
+CREATE TABLE IF NOT EXISTS "FriendTable" (
+	"userid"	INTEGER NOT NULL,
+	"friendid"	INTEGER NOT NULL,
+	"timestamp"	DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+	FOREIGN KEY("userid") REFERENCES "UserTable"("userid"),
+	FOREIGN KEY("friendid") REFERENCES "UserTable"("userid"),
+	PRIMARY KEY("userid","friendid")
+);
+DROP TABLE IF EXISTS "BlockTable";
+CREATE TABLE IF NOT EXISTS "BlockTable" (
+	"userid"	INTEGER NOT NULL,
+	"blockedid"	INTEGER NOT NULL,
+	"timestamp"	DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+	FOREIGN KEY("userid") REFERENCES "UserTable"("userid"),
+	FOREIGN KEY("blockedid") REFERENCES "UserTable"("userid"),
+	PRIMARY KEY("userid","blockedid")
+);
+DROP TABLE IF EXISTS "AccountDeletionTable";
+CREATE TABLE IF NOT EXISTS "AccountDeletionTable" (
+	"userid"	INTEGER NOT NULL UNIQUE,
+	"requested"	DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+	"deleteafter"	DATETIME NOT NULL,
+	"removemessages"	INTEGER NOT NULL DEFAULT 0,
+	FOREIGN KEY("userid") REFERENCES "UserTable"("userid"),
+	PRIMARY KEY("userid")
+);
+DROP TABLE IF EXISTS "AuthTokenTable";
+CREATE TABLE IF NOT EXISTS "AuthTokenTable" (
+	"tokenid"	TEXT NOT NULL UNIQUE,
+	"userid"	INTEGER NOT NULL,
+	"purpose"	TEXT NOT NULL,
+	"email"	TEXT NOT NULL DEFAULT '',
+	"expires"	DATETIME NOT NULL,
+	FOREIGN KEY("userid") REFERENCES "UserTable"("userid"),
+	PRIMARY KEY("tokenid")
+);
+DROP TABLE IF EXISTS "TwoFactorTable";
+CREATE TABLE IF NOT EXISTS "TwoFactorTable" (
+	"userid"	INTEGER NOT NULL UNIQUE,
+	"secret"	TEXT NOT NULL,
+	"enabled"	INTEGER NOT NULL DEFAULT 0,
+	"laststep"	INTEGER NOT NULL DEFAULT 0,
+	FOREIGN KEY("userid") REFERENCES "UserTable"("userid"),
+	PRIMARY KEY("userid")
+);
+DROP TABLE IF EXISTS "RecoveryCodeTable";
+CREATE TABLE IF NOT EXISTS "RecoveryCodeTable" (
+	"userid"	INTEGER NOT NULL,
+	"codehash"	TEXT NOT NULL,
+	FOREIGN KEY("userid") REFERENCES "UserTable"("userid"),
+	PRIMARY KEY("userid","codehash")
+);
+DROP TABLE IF EXISTS "UserIdentityTable";
+CREATE TABLE IF NOT EXISTS "UserIdentityTable" (
+	"provider"	TEXT NOT NULL,
+	"subject"	TEXT NOT NULL,
+	"userid"	INTEGER NOT NULL,
+	"timestamp"	DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+	FOREIGN KEY("userid") REFERENCES "UserTable"("userid"),
+	PRIMARY KEY("provider","subject")
+);
+DROP TABLE IF EXISTS "APITokenTable";
+CREATE TABLE IF NOT EXISTS "APITokenTable" (
+	"tokenid"	INTEGER NOT NULL UNIQUE,
+	"userid"	INTEGER NOT NULL,
+	"name"	TEXT NOT NULL,
+	"tokenhash"	TEXT NOT NULL UNIQUE,
+	"scopes"	TEXT NOT NULL,
+	"created"	DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+	"lastused"	DATETIME,
+	"expires"	DATETIME,
+	FOREIGN KEY("userid") REFERENCES "UserTable"("userid"),
+	PRIMARY KEY("tokenid" AUTOINCREMENT)
+);
+DROP TABLE IF EXISTS "LinkPreviewTable";
+CREATE TABLE IF NOT EXISTS "LinkPreviewTable" (
+	"url"	TEXT NOT NULL,
+	"title"	TEXT NOT NULL,
+	"description"	TEXT NOT NULL,
+	"sitename"	TEXT NOT NULL,
+	"imageurl"	TEXT NOT NULL,
+	"timestamp"	DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+	PRIMARY KEY("url")
+);
+DROP TABLE IF EXISTS "MessageEmbedTable";
+CREATE TABLE IF NOT EXISTS "MessageEmbedTable" (
+	"messageid"	INTEGER NOT NULL,
+	"position"	INTEGER NOT NULL,
+	"url"	TEXT NOT NULL,
+	FOREIGN KEY("messageid") REFERENCES "ChannelMessageTable"("messageid"),
+	FOREIGN KEY("url") REFERENCES "LinkPreviewTable"("url"),
+	PRIMARY KEY("messageid","url")
+);
+DROP TABLE IF EXISTS "WebhookTable";
+CREATE TABLE IF NOT EXISTS "WebhookTable" (
+	"webhookid"	INTEGER NOT NULL UNIQUE,
+	"channelid"	INTEGER NOT NULL,
+	"userid"	INTEGER NOT NULL,
+	"creatorid"	INTEGER NOT NULL,
+	"name"	TEXT NOT NULL,
+	"secrethash"	TEXT NOT NULL,
+	"created"	DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+	FOREIGN KEY("channelid") REFERENCES "ChannelTable"("channelid"),
+	FOREIGN KEY("userid") REFERENCES "UserTable"("userid"),
+	FOREIGN KEY("creatorid") REFERENCES "UserTable"("userid"),
+	PRIMARY KEY("webhookid" AUTOINCREMENT)
+);
+DROP TABLE IF EXISTS "MessageWebhookTable";
+CREATE TABLE IF NOT EXISTS "MessageWebhookTable" (
+	"messageid"	INTEGER NOT NULL,
+	"webhookid"	INTEGER NOT NULL,
+	"username"	TEXT NOT NULL DEFAULT '',
+	"avatarurl"	TEXT NOT NULL DEFAULT '',
+	"embeds"	TEXT NOT NULL DEFAULT '[]',
+	FOREIGN KEY("messageid") REFERENCES "ChannelMessageTable"("messageid"),
+	FOREIGN KEY("webhookid") REFERENCES "WebhookTable"("webhookid"),
+	PRIMARY KEY("messageid")
+);
+DROP TABLE IF EXISTS "EventEndpointTable";
+CREATE TABLE IF NOT EXISTS "EventEndpointTable" (
+	"endpointid"	INTEGER NOT NULL UNIQUE,
+	"serverid"	INTEGER NOT NULL,
+	"creatorid"	INTEGER NOT NULL,
+	"url"	TEXT NOT NULL,
+	"secret"	TEXT NOT NULL,
+	"events"	TEXT NOT NULL,
+	"enabled"	INTEGER NOT NULL DEFAULT 1,
+	"failures"	INTEGER NOT NULL DEFAULT 0,
+	"created"	DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+	FOREIGN KEY("serverid") REFERENCES "ServerTable"("serverid"),
+	FOREIGN KEY("creatorid") REFERENCES "UserTable"("userid"),
+	PRIMARY KEY("endpointid" AUTOINCREMENT)
+);
+DROP TABLE IF EXISTS "EventDeliveryTable";
+CREATE TABLE IF NOT EXISTS "EventDeliveryTable" (
+	"deliveryid"	INTEGER NOT NULL UNIQUE,
+	"endpointid"	INTEGER NOT NULL,
+	"event"	TEXT NOT NULL,
+	"payload"	TEXT NOT NULL,
+	"status"	TEXT NOT NULL DEFAULT 'pending',
+	"attempts"	INTEGER NOT NULL DEFAULT 0,
+	"nextattempt"	DATETIME NOT NULL,
+	"lastattempt"	DATETIME,
+	"responsecode"	INTEGER NOT NULL DEFAULT 0,
+	"error"	TEXT NOT NULL DEFAULT '',
+	"created"	DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+	FOREIGN KEY("endpointid") REFERENCES "EventEndpointTable"("endpointid"),
+	PRIMARY KEY("deliveryid" AUTOINCREMENT)
+);
+DROP INDEX IF EXISTS "EventDeliveryDueIndex";
+CREATE INDEX IF NOT EXISTS "EventDeliveryDueIndex" ON "EventDeliveryTable"("status","nextattempt");
+DROP TABLE IF EXISTS "BotCommandTable";
+CREATE TABLE IF NOT EXISTS "BotCommandTable" (
+	"commandid"	INTEGER NOT NULL UNIQUE,
+	"userid"	INTEGER NOT NULL,
+	"name"	TEXT NOT NULL,
+	"description"	TEXT NOT NULL DEFAULT '',
+	"options"	TEXT NOT NULL DEFAULT '[]',
+	"created"	DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+	FOREIGN KEY("userid") REFERENCES "UserTable"("userid"),
+	UNIQUE("userid","name"),
+	PRIMARY KEY("commandid" AUTOINCREMENT)
+);
+DROP TABLE IF EXISTS "BotCallbackTable";
+CREATE TABLE IF NOT EXISTS "BotCallbackTable" (
+	"userid"	INTEGER NOT NULL UNIQUE,
+	"url"	TEXT NOT NULL,
+	"secret"	TEXT NOT NULL,
+	FOREIGN KEY("userid") REFERENCES "UserTable"("userid"),
+	PRIMARY KEY("userid")
+);
+DROP TABLE IF EXISTS "ReminderTable";
+CREATE TABLE IF NOT EXISTS "ReminderTable" (
+	"reminderid"	INTEGER NOT NULL UNIQUE,
+	"userid"	INTEGER NOT NULL,
+	"channelid"	INTEGER NOT NULL,
+	"message"	TEXT NOT NULL,
+	"due"	DATETIME NOT NULL,
+	"created"	DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+	FOREIGN KEY("userid") REFERENCES "UserTable"("userid"),
+	FOREIGN KEY("channelid") REFERENCES "ChannelTable"("channelid"),
+	PRIMARY KEY("reminderid" AUTOINCREMENT)
+);
+DROP INDEX IF EXISTS "ReminderDueIndex";
+CREATE INDEX IF NOT EXISTS "ReminderDueIndex" ON "ReminderTable"("due");
+DROP TABLE IF EXISTS "AttachmentThumbnailTable";
+CREATE TABLE IF NOT EXISTS "AttachmentThumbnailTable" (
+	"attachmentid"	INTEGER NOT NULL,
+	"size"	INTEGER NOT NULL,
+	"width"	INTEGER NOT NULL,
+	"height"	INTEGER NOT NULL,
+	"contenttype"	TEXT NOT NULL,
+	"storagekey"	TEXT NOT NULL UNIQUE,
+	FOREIGN KEY("attachmentid") REFERENCES "AttachmentTable"("attachmentid"),
+	PRIMARY KEY("attachmentid","size")
+);
+DROP TABLE IF EXISTS "AuditLogTable";
+CREATE TABLE IF NOT EXISTS "AuditLogTable" (
+	"entryid"	INTEGER NOT NULL UNIQUE,
+	"serverid"	INTEGER NOT NULL,
+	"actorid"	INTEGER NOT NULL,
+	"action"	TEXT NOT NULL,
+	"targettype"	TEXT NOT NULL,
+	"targetid"	INTEGER NOT NULL,
+	"before"	TEXT NOT NULL DEFAULT '{}',
+	"after"	TEXT NOT NULL DEFAULT '{}',
+	"reason"	TEXT NOT NULL DEFAULT '',
+	"created"	DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+	FOREIGN KEY("serverid") REFERENCES "ServerTable"("serverid"),
+	FOREIGN KEY("actorid") REFERENCES "UserTable"("userid"),
+	PRIMARY KEY("entryid" AUTOINCREMENT)
+);
+DROP INDEX IF EXISTS "AuditLogServerIndex";
+CREATE INDEX IF NOT EXISTS "AuditLogServerIndex" ON "AuditLogTable"("serverid","entryid");
+DROP TABLE IF EXISTS "RestrictionTable";
+CREATE TABLE IF NOT EXISTS "RestrictionTable" (
+	"restrictionid"	INTEGER NOT NULL UNIQUE,
+	"serverid"	INTEGER NOT NULL,
+	"channelid"	INTEGER NOT NULL DEFAULT 0,
+	"userid"	INTEGER NOT NULL,
+	"moderatorid"	INTEGER NOT NULL,
+	"reason"	TEXT NOT NULL DEFAULT '',
+	"expires"	DATETIME NOT NULL,
+	"created"	DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+	FOREIGN KEY("serverid") REFERENCES "ServerTable"("serverid"),
+	FOREIGN KEY("userid") REFERENCES "UserTable"("userid"),
+	FOREIGN KEY("moderatorid") REFERENCES "UserTable"("userid"),
+	UNIQUE("serverid","channelid","userid"),
+	PRIMARY KEY("restrictionid" AUTOINCREMENT)
+);
 DROP TABLE IF EXISTS "UsersChannelTable";
 CREATE TABLE IF NOT EXISTS "UsersChannelTable" (
 	"userid"	INTEGER NOT NULL,
@@ -83,6 +397,8 @@ CREATE TABLE IF NOT EXISTS "UsersChannelTable" (
 	FOREIGN KEY("channelid") REFERENCES "ChannelTable"("channelid"),
 	PRIMARY KEY("userid","channelid")
 );
+DROP INDEX IF EXISTS "UserEmailIndex";
+CREATE UNIQUE INDEX IF NOT EXISTS "UserEmailIndex" ON "UserTable"("email") WHERE "email" != '';
 DROP TRIGGER IF EXISTS "UpdateUserNameLog";
 CREATE TRIGGER UpdateUserNameLog AFTER UPDATE OF username ON UserTable 
 BEGIN
@@ -98,4 +414,77 @@ CREATE TRIGGER UpdateMessageLog AFTER UPDATE OF contents ON ChannelMessageTable
 BEGIN
 	UPDATE ChannelMessageTable SET editted = 1, edittimestamp = strftime('%Y-%m-%d %H:%M:%f', 'now') WHERE messageid = old.messageid;
 END;
+DROP TRIGGER IF EXISTS "AddThreadReply";
+CREATE TRIGGER AddThreadReply AFTER INSERT ON ChannelMessageTable WHEN new.threadid IS NOT NULL
+BEGIN
+	INSERT INTO ThreadTable (rootid, replycount, lastreply) VALUES (new.threadid, 1, new.timestamp)
+		ON CONFLICT(rootid) DO UPDATE SET replycount = replycount + 1, lastreply = new.timestamp;
+END;
+DROP TRIGGER IF EXISTS "RemoveMessagePin";
+CREATE TRIGGER RemoveMessagePin AFTER DELETE ON ChannelMessageTable
+BEGIN
+	DELETE FROM PinnedMessageTable WHERE messageid = old.messageid;
+END;
+DROP TRIGGER IF EXISTS "RemoveMessageAttachments";
+CREATE TRIGGER RemoveMessageAttachments AFTER DELETE ON ChannelMessageTable
+BEGIN
+	DELETE FROM AttachmentTable WHERE messageid = old.messageid;
+END;
+DROP TRIGGER IF EXISTS "RemoveMessageEmbeds";
+CREATE TRIGGER RemoveMessageEmbeds AFTER DELETE ON ChannelMessageTable
+BEGIN
+	DELETE FROM MessageEmbedTable WHERE messageid = old.messageid;
+END;
+DROP TRIGGER IF EXISTS "RemoveMessageWebhook";
+CREATE TRIGGER RemoveMessageWebhook AFTER DELETE ON ChannelMessageTable
+BEGIN
+	DELETE FROM MessageWebhookTable WHERE messageid = old.messageid;
+END;
+DROP TRIGGER IF EXISTS "RemoveChannelWebhooks";
+CREATE TRIGGER RemoveChannelWebhooks AFTER DELETE ON ChannelTable
+BEGIN
+	DELETE FROM WebhookTable WHERE channelid = old.channelid;
+END;
+DROP TRIGGER IF EXISTS "RemoveEndpointDeliveries";
+CREATE TRIGGER RemoveEndpointDeliveries AFTER DELETE ON EventEndpointTable
+BEGIN
+	DELETE FROM EventDeliveryTable WHERE endpointid = old.endpointid;
+END;
+DROP TRIGGER IF EXISTS "RemoveServerEndpoints";
+CREATE TRIGGER RemoveServerEndpoints AFTER DELETE ON ServerTable
+BEGIN
+	DELETE FROM EventEndpointTable WHERE serverid = old.serverid;
+END;
+DROP TRIGGER IF EXISTS "RemoveServerAuditLog";
+CREATE TRIGGER RemoveServerAuditLog AFTER DELETE ON ServerTable
+BEGIN
+	DELETE FROM AuditLogTable WHERE serverid = old.serverid;
+END;
+DROP TRIGGER IF EXISTS "RemoveServerRestrictions";
+CREATE TRIGGER RemoveServerRestrictions AFTER DELETE ON ServerTable
+BEGIN
+	DELETE FROM RestrictionTable WHERE serverid = old.serverid;
+END;
+DROP TRIGGER IF EXISTS "RemoveChannelRestrictions";
+CREATE TRIGGER RemoveChannelRestrictions AFTER DELETE ON ChannelTable
+BEGIN
+	DELETE FROM RestrictionTable WHERE channelid = old.channelid;
+END;
+DROP TRIGGER IF EXISTS "RemoveChannelReminders";
+CREATE TRIGGER RemoveChannelReminders AFTER DELETE ON ChannelTable
+BEGIN
+	DELETE FROM ReminderTable WHERE channelid = old.channelid;
+END;
+DROP TRIGGER IF EXISTS "RemoveAttachmentThumbnails";
+CREATE TRIGGER RemoveAttachmentThumbnails AFTER DELETE ON AttachmentTable
+BEGIN
+	DELETE FROM AttachmentThumbnailTable WHERE attachmentid = old.attachmentid;
+END;
+DROP TRIGGER IF EXISTS "RemoveThreadReply";
+CREATE TRIGGER RemoveThreadReply AFTER DELETE ON ChannelMessageTable WHEN old.threadid IS NOT NULL
+BEGIN
+	UPDATE ThreadTable SET replycount = replycount - 1,
+		lastreply = (SELECT MAX(timestamp) FROM ChannelMessageTable WHERE threadid = old.threadid)
+		WHERE rootid = old.threadid;
+END;
 COMMIT;